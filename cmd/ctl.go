@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/betterde/ects/internal/ctl"
+	"github.com/betterde/ects/models"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+var (
+	ctlCmd = &cobra.Command{
+		Use:   "ctl",
+		Short: "Control elastic crontab system through the master API",
+		Long:  "Control elastic crontab system through the master API, authenticated by an API token",
+	}
+
+	ctlLoginCmd = &cobra.Command{
+		Use:     "login",
+		Short:   "Save the master API address and token for later commands",
+		Long:    "Verify the master API address and token, then save them to ~/.ects/credentials.json so scripts do not need to pass them on every call",
+		Example: "ects ctl login --server https://ects.example.com --token <token>",
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := interruptible()
+			defer cancel()
+
+			client := connect()
+			if _, err := client.Pipelines(ctx); err != nil {
+				log.Fatal(err)
+			}
+
+			credentials := &ctl.Credentials{Server: client.Server, Token: client.Token}
+			if err := credentials.Save(); err != nil {
+				log.Fatal(err)
+			}
+
+			fmt.Fprintf(os.Stderr, "Logged in to %s\n", client.Server)
+		},
+	}
+
+	ctlRunCmd = &cobra.Command{
+		Use:   "run",
+		Short: "Inspect pipeline runs",
+	}
+
+	ctlRunLogsCmd = &cobra.Command{
+		Use:     "logs <run_id>",
+		Short:   "Print the output of a pipeline run",
+		Long:    "Print the output of a finished run, or tail the live output of a running one with automatic reconnect",
+		Example: "ects ctl run logs -f 20190201030000-2f1c9a",
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := interruptible()
+			defer cancel()
+
+			client := connect()
+			record, err := client.Run(ctx, args[0])
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if record.Status == models.RECORDRUNNING && follow {
+				notice := func(format string, args ...interface{}) {
+					fmt.Fprintf(os.Stderr, format, args...)
+				}
+				if record, err = client.Follow(ctx, record.Id, os.Stdout, notice); err != nil {
+					if err == context.Canceled {
+						return
+					}
+					log.Fatal(err)
+				}
+				fmt.Fprintf(os.Stderr, "Run %s ended with status %s\n", record.Id, status(record.Status))
+				exit(record)
+			}
+
+			for _, step := range record.Steps {
+				fmt.Printf("==> %s [%s]\n%s\n", step.TaskName, step.Status, step.Result)
+			}
+
+			if record.Status == models.RECORDRUNNING {
+				fmt.Fprintf(os.Stderr, "Run %s is still running, use -f to follow its output\n", record.Id)
+				return
+			}
+
+			fmt.Fprintf(os.Stderr, "Run %s ended with status %s\n", record.Id, status(record.Status))
+			exit(record)
+		},
+	}
+
+	server string
+	token  string
+	follow bool
+)
+
+func init() {
+	rootCmd.AddCommand(ctlCmd)
+	ctlCmd.AddCommand(ctlLoginCmd)
+	ctlCmd.AddCommand(ctlRunCmd)
+	ctlRunCmd.AddCommand(ctlRunLogsCmd)
+	ctlCmd.PersistentFlags().StringVar(&server, "server", os.Getenv("ECTS_SERVER"), "Set the master API address, defaults to $ECTS_SERVER, the saved credentials or http://127.0.0.1:9701")
+	ctlCmd.PersistentFlags().StringVar(&token, "token", os.Getenv("ECTS_TOKEN"), "Set the API token, defaults to $ECTS_TOKEN or the saved credentials")
+	ctlRunLogsCmd.Flags().BoolVarP(&follow, "follow", "f", false, "Follow the live output until the run ends")
+}
+
+// 执行记录状态的名称
+func status(code int) string {
+	switch code {
+	case models.RECORDFAILED:
+		return "failed"
+	case models.RECORDFINISHED:
+		return "finished"
+	case models.RECORDRUNNING:
+		return "running"
+	case models.RECORDLOST:
+		return "lost"
+	case models.RECORDTIMEOUT:
+		return "timeout"
+	case models.RECORDCANCELLED:
+		return "cancelled"
+	}
+
+	return fmt.Sprintf("%d", code)
+}
+
+// 执行未成功时以非零状态码退出，便于在部署脚本中判断
+func exit(record *models.PipelineRecords) {
+	if record.Status != models.RECORDFINISHED {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// 创建客户端，未通过参数或者环境变量指定时使用保存的凭据
+func connect() *ctl.Client {
+	credentials, err := ctl.LoadCredentials()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if server == "" {
+		server = credentials.Server
+	}
+	if server == "" {
+		server = "http://127.0.0.1:9701"
+	}
+
+	if token == "" {
+		token = credentials.Token
+	}
+
+	return ctl.New(server, token)
+}
+
+// 收到中断信号时取消的上下文
+func interruptible() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sign := make(chan os.Signal, 1)
+	signal.Notify(sign, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sign:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sign)
+	}()
+
+	return ctx, cancel
+}
+
+// 读取 JSON 文件，- 表示标准输入
+func decode(path string, out interface{}) error {
+	var (
+		data []byte
+		err  error
+	)
+
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+// 解析 KEY=VALUE 形式的参数
+func pairs(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	result := make(map[string]string, len(values))
+	for _, value := range values {
+		index := strings.IndexByte(value, '=')
+		if index < 1 {
+			return nil, fmt.Errorf("%s should be in the form KEY=VALUE", value)
+		}
+		result[value[:index]] = value[index+1:]
+	}
+
+	return result, nil
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/betterde/ects/internal/ctl"
+	"github.com/betterde/ects/models"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"text/tabwriter"
+)
+
+var (
+	ctlPipelineCmd = &cobra.Command{
+		Use:   "pipeline",
+		Short: "Manage pipelines",
+	}
+
+	ctlPipelineListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the pipelines visible to the token owner",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := interruptible()
+			defer cancel()
+
+			pipelines, err := connect().Pipelines(ctx)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(writer, "ID\tNAME\tSPEC\tSTATUS")
+			for _, pipeline := range pipelines {
+				state := "disabled"
+				if pipeline.Status == models.PIPELINEENABLED {
+					state = "enabled"
+				}
+				fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", pipeline.Id, pipeline.Name, pipeline.Spec, state)
+			}
+			writer.Flush()
+		},
+	}
+
+	ctlPipelineCreateCmd = &cobra.Command{
+		Use:     "create",
+		Short:   "Create a pipeline from a JSON file",
+		Long:    "Create a pipeline from a JSON file in the same format as the POST /api/pipeline request body, use - to read from stdin",
+		Example: "ects ctl pipeline create -f pipeline.json",
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := interruptible()
+			defer cancel()
+
+			pipeline := &models.Pipeline{}
+			if err := decode(file, pipeline); err != nil {
+				log.Fatal(err)
+			}
+
+			created, err := connect().CreatePipeline(ctx, pipeline)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			fmt.Println(created.Id)
+		},
+	}
+
+	ctlPipelineDeleteCmd = &cobra.Command{
+		Use:   "delete <pipeline_id>",
+		Short: "Delete a pipeline",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := interruptible()
+			defer cancel()
+
+			if err := connect().DeletePipeline(ctx, args[0]); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	ctlPipelineRunCmd = &cobra.Command{
+		Use:     "run <pipeline_id>",
+		Short:   "Run a pipeline immediately on its online nodes",
+		Long:    "Run a pipeline immediately on its online nodes and print the run IDs, with -f the output of each run is followed and the command exits non-zero if any run fails",
+		Example: "ects ctl pipeline run -p VERSION=1.2.0 -t commit=2f1c9a -f 8f0c1f4e-5d7a-4a41-9a3b-0c6c1f0e2d11",
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := interruptible()
+			defer cancel()
+
+			options := &ctl.RunOptions{}
+			var err error
+			if options.Parameters, err = pairs(parameters); err != nil {
+				log.Fatal(err)
+			}
+			if options.Tags, err = pairs(tags); err != nil {
+				log.Fatal(err)
+			}
+
+			client := connect()
+			triggers, err := client.RunPipeline(ctx, args[0], options)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			for _, trigger := range triggers {
+				fmt.Println(trigger.Id)
+			}
+
+			if !follow {
+				return
+			}
+
+			failed := false
+			notice := func(format string, args ...interface{}) {
+				fmt.Fprintf(os.Stderr, format, args...)
+			}
+			for _, trigger := range triggers {
+				record, err := client.Follow(ctx, trigger.Id, os.Stdout, notice)
+				if err != nil {
+					log.Fatal(err)
+				}
+				fmt.Fprintf(os.Stderr, "Run %s ended with status %s\n", record.Id, status(record.Status))
+				failed = failed || record.Status != models.RECORDFINISHED
+			}
+
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+
+	ctlPipelineKillCmd = &cobra.Command{
+		Use:   "kill <pipeline_id>",
+		Short: "Kill the running and queued runs of a pipeline on all nodes",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := interruptible()
+			defer cancel()
+
+			reply, err := connect().KillPipeline(ctx, args[0], run)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			fmt.Fprintf(os.Stderr, "Killed %d running and dropped %d queued runs\n", reply.Killed, reply.Dropped)
+		},
+	}
+
+	file       string
+	run        string
+	parameters []string
+	tags       []string
+)
+
+func init() {
+	ctlCmd.AddCommand(ctlPipelineCmd)
+	ctlPipelineCmd.AddCommand(ctlPipelineListCmd, ctlPipelineCreateCmd, ctlPipelineDeleteCmd, ctlPipelineRunCmd, ctlPipelineKillCmd)
+	ctlPipelineCreateCmd.Flags().StringVarP(&file, "file", "f", "-", "Set the JSON file describing the pipeline")
+	ctlPipelineRunCmd.Flags().StringArrayVarP(&parameters, "param", "p", nil, "Override a declared parameter, as NAME=VALUE")
+	ctlPipelineRunCmd.Flags().StringArrayVarP(&tags, "tag", "t", nil, "Attach a tag to the runs, as KEY=VALUE")
+	ctlPipelineRunCmd.Flags().BoolVarP(&follow, "follow", "f", false, "Follow the output of the runs until they end")
+	ctlPipelineKillCmd.Flags().StringVarP(&run, "run", "r", "", "Kill only the run with this ID")
+}
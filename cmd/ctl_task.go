@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/betterde/ects/models"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"text/tabwriter"
+)
+
+var (
+	ctlTaskCmd = &cobra.Command{
+		Use:   "task",
+		Short: "Manage tasks",
+	}
+
+	ctlTaskListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List tasks",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := interruptible()
+			defer cancel()
+
+			tasks, err := connect().Tasks(ctx, search)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(writer, "ID\tNAME\tMODE")
+			for _, task := range tasks {
+				fmt.Fprintf(writer, "%s\t%s\t%s\n", task.Id, task.Name, task.Mode)
+			}
+			writer.Flush()
+		},
+	}
+
+	ctlTaskCreateCmd = &cobra.Command{
+		Use:     "create",
+		Short:   "Create a task from a JSON file",
+		Long:    "Create a task from a JSON file in the same format as the POST /api/task request body, use - to read from stdin",
+		Example: "ects ctl task create -f task.json",
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := interruptible()
+			defer cancel()
+
+			task := &models.Task{}
+			if err := decode(file, task); err != nil {
+				log.Fatal(err)
+			}
+
+			created, err := connect().CreateTask(ctx, task)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			fmt.Println(created.Id)
+		},
+	}
+
+	ctlTaskDeleteCmd = &cobra.Command{
+		Use:   "delete <task_id>",
+		Short: "Delete a task",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := interruptible()
+			defer cancel()
+
+			if err := connect().DeleteTask(ctx, args[0]); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	search string
+)
+
+func init() {
+	ctlCmd.AddCommand(ctlTaskCmd)
+	ctlTaskCmd.AddCommand(ctlTaskListCmd, ctlTaskCreateCmd, ctlTaskDeleteCmd)
+	ctlTaskListCmd.Flags().StringVarP(&search, "search", "s", "", "Only list tasks whose name or ID contains the keyword")
+	ctlTaskCreateCmd.Flags().StringVarP(&file, "file", "f", "-", "Set the JSON file describing the task")
+}
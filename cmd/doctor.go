@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/betterde/ects/internal/doctor"
+	"github.com/betterde/ects/internal/service"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+)
+
+// doctorCmd represents the doctor command
+var (
+	doctorCmd = &cobra.Command{
+		Use:     "doctor",
+		Short:   "Check data integrity of elastic crontab system",
+		Long:    "Find pivot rows pointing to deleted tasks, pipelines or nodes and etcd keys without database rows",
+		Example: "ects doctor --repair",
+		Run: func(cmd *cobra.Command, args []string) {
+			bootstrap()
+			report, err := doctor.Check()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if len(report.Issues) == 0 {
+				fmt.Println("No integrity issues found")
+				return
+			}
+
+			for _, issue := range report.Issues {
+				fmt.Printf("[%s] %s: %s\n", issue.Kind, issue.Id, issue.Description)
+			}
+
+			if !repair {
+				fmt.Printf("%d issues found, run with --repair to fix them\n", len(report.Issues))
+				os.Exit(1)
+			}
+
+			repaired, err := doctor.Repair(report)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			fmt.Printf("%d issues repaired\n", repaired)
+		},
+	}
+
+	repair bool
+)
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorCmd.Flags().BoolVar(&repair, "repair", false, "Repair the issues found")
+	doctorCmd.Flags().StringSliceVar(&service.EndPoints, "etcd", []string{"127.0.0.1:2379"}, "Set Etcd endpoints")
+	etcdFlags(doctorCmd)
+	doctorCmd.Flags().StringVar(&service.ConfigKey, "config", "/ects/config", "Set the key used to get configuration information")
+}
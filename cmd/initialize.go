@@ -54,6 +54,7 @@ var (
 	user = &models.User{
 		Id:        uuid.NewV4().String(),
 		Manager:   true,
+		Role:      models.ROLEADMIN,
 		CreatedAt: utils.Time(time.Now()),
 		UpdatedAt: utils.Time(time.Now()),
 	}
@@ -71,9 +72,12 @@ func init() {
 	initializeCmd.Flags().StringVarP(&user.Name, "name", "n", "", "Set admin name")
 	initializeCmd.Flags().StringVarP(&user.Email, "email", "e", "", "Set admin email")
 	initializeCmd.Flags().StringVarP(&user.Password, "pass", "P", "", "Set admin pass")
+	etcdFlags(initializeCmd)
 }
 
 func startInitializeWeb() {
+	// 页面中填写的 ETCD 配置不包含证书和账号
+	secureEtcd()
 	app := iris.New()
 	app.Logger().SetLevel("disable")
 	app.OnErrorCode(404, func(ctx iris.Context) {
@@ -133,6 +137,7 @@ func startInitializeByConfigFile() {
 		}
 	}
 
+	secureEtcd()
 	discover.NewClient()
 
 	buf, err = json.Marshal(config.Conf)
@@ -4,7 +4,14 @@ import (
 	"context"
 	"fmt"
 	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/agent"
+	"github.com/betterde/ects/internal/budget"
 	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/internal/doctor"
+	"github.com/betterde/ects/internal/janitor"
+	"github.com/betterde/ects/internal/liveness"
+	"github.com/betterde/ects/internal/reconcile"
+	"github.com/betterde/ects/internal/rungroup"
 	"github.com/betterde/ects/internal/service"
 	"github.com/betterde/ects/internal/utils"
 	"github.com/betterde/ects/models"
@@ -15,8 +22,10 @@ import (
 	"github.com/satori/go.uuid"
 	"github.com/spf13/cobra"
 	"log"
+	"net"
 	"os"
 	"runtime"
+	"strconv"
 	"time"
 )
 
@@ -28,6 +37,7 @@ var (
 		Long:  "Run a master node service on this server",
 		Run: func(cmd *cobra.Command, args []string) {
 			bootstrap()
+			upgrade()
 			watch()
 			start()
 		},
@@ -40,6 +50,9 @@ var (
 	}
 
 	ctx, cancelFunc = context.WithCancel(context.Background())
+
+	reconcileInterval int
+	agentPort         int
 )
 
 func init() {
@@ -50,25 +63,69 @@ func init() {
 	masterCmd.Flags().StringVar(&master.Host, "host", "0.0.0.0", "Set listen on IP")
 	masterCmd.Flags().IntVar(&master.Port, "port", 9701, "Set listen on port")
 	masterCmd.Flags().StringSliceVar(&service.EndPoints, "etcd", []string{"127.0.0.1:2379"}, "Set Etcd endpoints")
+	etcdFlags(masterCmd)
 	masterCmd.Flags().StringVarP(&master.Id, "node", "n", uuid.NewV4().String(), "Set master node id")
 	masterCmd.Flags().StringVar(&master.Name, "name", "", "Set master node name")
 	masterCmd.Flags().StringVar(&master.Description, "desc", "master node", "Set master node description")
+	masterCmd.Flags().IntVar(&reconcileInterval, "reconcile", 60, "Set the interval in seconds of reconciling etcd with the database, 0 to disable")
 	masterCmd.Flags().StringVar(&service.ConfigKey, "config", "/ects/config", "Set the key used to get configuration information")
+	masterCmd.Flags().IntVar(&agentPort, "agent-port", agent.PORT, "Set the port of the agent service used by workers running in agent mode, 0 to disable")
 }
 
 func bootstrap() {
 	var err error
-	config.Conf.Etcd.EndPoints = service.EndPoints
-	discover.NewClient()
+	connectEtcd()
 	discover.GetConf(service.ConfigKey)
 	models.Engine, err = models.Connection()
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	if err := discover.PutAgentConf(service.ConfigKey); err != nil {
+		log.Println(err)
+	}
+}
+
+// 启动时同步新版本增加的数据表结构
+func upgrade() {
+	if err := models.Upgrade(); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func watch() {
+	go discover.Campaign(ctx, master.Id, advertise())
 	go discover.ServiceCluster.WatchNodes(master.Id, ctx)
+	go doctor.Watch(ctx, time.Hour)
+	go janitor.Run(ctx, time.Hour)
+	go budget.Run(ctx, time.Minute)
+	go liveness.Watch(ctx)
+	go liveness.Patrol(ctx, time.Minute)
+	go rungroup.Run(ctx, 30*time.Second)
+	if reconcileInterval > 0 {
+		go reconcile.Run(ctx, time.Duration(reconcileInterval)*time.Second)
+	}
+
+	// 代理模式的工作节点通过该服务读写数据，未配置令牌时不启用
+	if agentPort > 0 && config.Conf.Agent.Token != "" {
+		go func() {
+			if err := agent.Serve(net.JoinHostPort(master.Host, strconv.Itoa(agentPort)), config.Conf.Agent.Token, models.Database{}); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+}
+
+// 其他主节点转发请求时使用的地址
+func advertise() string {
+	host := master.Host
+	if host == "0.0.0.0" {
+		if ips := utils.GetIPs(); len(ips) > 0 {
+			host = ips[0]
+		}
+	}
+
+	return fmt.Sprintf("http://%s", net.JoinHostPort(host, strconv.Itoa(master.Port)))
 }
 
 // Service registry
@@ -100,6 +157,7 @@ func register() {
 }
 
 func start() {
+	master.Timezone = service.DetectTimezone()
 	service.Runtime = master
 	addr := fmt.Sprintf("%s:%d", service.Runtime.Host, service.Runtime.Port)
 	app := iris.New()
@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/internal/service"
 	"github.com/spf13/cobra"
 	"os"
 )
@@ -12,8 +15,39 @@ var rootCmd = &cobra.Command{
 	Version: "0.5.1",
 }
 
+// 命令行指定的连接 ETCD 使用的证书和账号
+var etcdSecurity config.EtcdSecurity
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
+
+// 添加连接 ETCD 使用的证书和账号参数，密码默认读取环境变量，避免出现在进程列表中
+func etcdFlags(command *cobra.Command) {
+	command.Flags().StringVar(&etcdSecurity.CACert, "etcd-cacert", "", "Set the CA certificate used to verify the Etcd server, use https:// endpoints when connecting with TLS")
+	command.Flags().StringVar(&etcdSecurity.Cert, "etcd-cert", "", "Set the client certificate used to connect to Etcd")
+	command.Flags().StringVar(&etcdSecurity.Key, "etcd-key", "", "Set the private key of the Etcd client certificate")
+	command.Flags().StringVar(&etcdSecurity.Username, "etcd-user", os.Getenv("ECTS_ETCD_USER"), "Set the Etcd user name, defaults to $ECTS_ETCD_USER")
+	command.Flags().StringVar(&etcdSecurity.Password, "etcd-password", "", "Set the Etcd password, defaults to $ECTS_ETCD_PASSWORD")
+}
+
+// 使用命令行指定的地址、证书和账号连接 ETCD，之后从 ETCD 读取的配置不包含证书和账号，不会覆盖
+func connectEtcd() {
+	config.Conf.Etcd.EndPoints = service.EndPoints
+	secureEtcd()
+	discover.NewClient()
+}
+
+// 使用命令行指定的证书和账号
+func secureEtcd() {
+	if etcdSecurity.Password == "" {
+		etcdSecurity.Password = os.Getenv("ECTS_ETCD_PASSWORD")
+	}
+
+	// 命令行未指定时使用配置文件中的设置
+	if etcdSecurity != (config.EtcdSecurity{}) {
+		config.Conf.Etcd.Security = etcdSecurity
+	}
+}
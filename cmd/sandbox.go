@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/betterde/ects/internal/sandbox"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"strings"
+)
+
+// sandboxCmd represents the sandbox command
+var (
+	sandboxCmd = &cobra.Command{
+		Use:    sandbox.COMMAND,
+		Short:  "Run a command inside the task sandbox",
+		Long:   "Initialize the namespaces created by the worker and run the command of a sandboxed task, only used by the worker itself",
+		Hidden: true,
+		Args:   cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			sandboxOptions.Command = strings.Join(args, " ")
+			code, err := sandbox.Init(sandboxOptions)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			os.Exit(code)
+		},
+	}
+
+	sandboxOptions = &sandbox.Options{}
+)
+
+func init() {
+	rootCmd.AddCommand(sandboxCmd)
+	sandboxCmd.Flags().StringVar(&sandboxOptions.User, "user", "", "Run the command as this user")
+	sandboxCmd.Flags().StringVar(&sandboxOptions.Dir, "dir", "", "Set the working directory of the command")
+}
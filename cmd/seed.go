@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/betterde/ects/internal/seed"
+	"github.com/betterde/ects/internal/service"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+)
+
+// seedCmd represents the seed command
+var (
+	seedCmd = &cobra.Command{
+		Use:     "seed",
+		Short:   "Seed the database of elastic crontab system",
+		Long:    "Create a demo project with sample tasks, disabled pipelines bound to an offline demo worker and a week of fake run history",
+		Example: "ects seed --demo",
+		Run: func(cmd *cobra.Command, args []string) {
+			if !demo {
+				fmt.Println("Nothing to seed, run with --demo to create the demo data")
+				os.Exit(1)
+			}
+
+			bootstrap()
+			upgrade()
+			summary, err := seed.Demo()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			fmt.Printf("Demo project %s created with %d tasks, %d pipelines, %d runs and %d steps, bound to worker %s\n",
+				summary.Project, summary.Tasks, summary.Pipelines, summary.Runs, summary.Steps, summary.Node)
+		},
+	}
+
+	demo bool
+)
+
+func init() {
+	rootCmd.AddCommand(seedCmd)
+	seedCmd.Flags().BoolVar(&demo, "demo", false, "Create the demo data")
+	seedCmd.Flags().StringSliceVar(&service.EndPoints, "etcd", []string{"127.0.0.1:2379"}, "Set Etcd endpoints")
+	etcdFlags(seedCmd)
+	seedCmd.Flags().StringVar(&service.ConfigKey, "config", "/ects/config", "Set the key used to get configuration information")
+}
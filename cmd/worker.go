@@ -2,8 +2,12 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/agent"
+	"github.com/betterde/ects/internal/control"
 	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/internal/metrics"
 	"github.com/betterde/ects/internal/pipeline"
 	"github.com/betterde/ects/internal/scheduler"
 	"github.com/betterde/ects/internal/service"
@@ -33,7 +37,12 @@ var (
 		Mode:    models.WORKER,
 		Status:  models.ONLINE,
 		Version: rootCmd.Version,
+		Policy:  &models.NodePolicy{},
 	}
+
+	metricsAddress string
+	agentAddress   string
+	agentToken     string
 )
 
 func init() {
@@ -45,12 +54,28 @@ func init() {
 	}
 	workerCmd.Flags().StringVar(&worker.Name, "name", "", "Set worker node name")
 	workerCmd.Flags().StringSliceVar(&service.EndPoints, "etcd", []string{"127.0.0.1:2379"}, "Set Etcd endpoints")
+	etcdFlags(workerCmd)
 	workerCmd.Flags().StringVarP(&worker.Id, "node", "n", "", "Set node id")
+	workerCmd.Flags().IntVar(&worker.Port, "port", control.PORT, "Set the port of the control service used by the master")
+	workerCmd.Flags().StringVar(&metricsAddress, "metrics", ":9703", "Set the listen address of the Prometheus metrics endpoint, empty to disable")
 	workerCmd.Flags().StringVar(&worker.Description, "desc", "worker node", "Set worker node description")
+	workerCmd.Flags().StringSliceVar(&worker.Volumes, "volumes", nil, "Advertise data volume labels or directories available on this node, e.g. warehouse,/data/archive")
+	workerCmd.Flags().IntVar(&worker.Capacity, "capacity", 0, "Set the max number of pipelines running at the same time, 0 means unlimited")
+	workerCmd.Flags().StringSliceVar(&worker.Policy.AllowModes, "allow-modes", nil, "Only run tasks of these modes, e.g. shell,http")
+	workerCmd.Flags().StringSliceVar(&worker.Policy.DenyModes, "deny-modes", nil, "Never run tasks of these modes")
+	workerCmd.Flags().StringSliceVar(&worker.Policy.AllowProjects, "allow-projects", nil, "Only run pipelines of these project ids")
+	workerCmd.Flags().StringSliceVar(&worker.Policy.DenyProjects, "deny-projects", nil, "Never run pipelines of these project ids")
+	workerCmd.Flags().StringSliceVar((*[]string)(&worker.Windows), "windows", nil, "Only run pipelines within these local time windows, e.g. 00:00-06:00,22:00-23:30")
 	workerCmd.Flags().StringVar(&service.ConfigKey, "config", "/ects/config", "Set the key used to get configuration information")
+	workerCmd.Flags().StringVar(&agentAddress, "agent", "", "Run in agent mode without database access, reading and writing data through the agent service of the master, e.g. 10.0.0.1:9704")
+	workerCmd.Flags().StringVar(&agentToken, "agent-token", os.Getenv("ECTS_AGENT_TOKEN"), "Set the token of the agent service, defaults to $ECTS_AGENT_TOKEN")
 }
 
 func listen() {
+	if err := worker.Windows.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
 	if worker.Id == "" {
 		worker.Id = uuid.NewV4().String()
 	}
@@ -63,19 +88,28 @@ func listen() {
 		}
 	}
 
-	if worker.Host == "0.0.0.0" {
+	if worker.Host == "" || worker.Host == "0.0.0.0" {
 		ips := utils.GetIPs()
 		if len(ips) > 0 {
 			worker.Host = ips[0]
 		}
 	}
 
-	config.Conf.Etcd.EndPoints = service.EndPoints
-	discover.NewClient()
-	discover.GetConf(service.ConfigKey)
-	models.Engine, err = models.Connection()
-	if err != nil {
-		log.Fatal(err)
+	connectEtcd()
+	if agentAddress != "" {
+		// 代理模式下读取不包含数据库连接和密钥的配置，所有数据通过主节点读写
+		discover.GetConf(config.AgentKey(service.ConfigKey))
+		remote, err := agent.Dial(agentAddress, agentToken)
+		if err != nil {
+			log.Fatal(err)
+		}
+		models.Repo = remote
+	} else {
+		discover.GetConf(service.ConfigKey)
+		models.Engine, err = models.Connection()
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	ips := utils.GetIPs()
@@ -83,6 +117,8 @@ func listen() {
 		service.Runtime.Host = ips[0]
 	}
 
+	worker.Capabilities = service.DetectCapabilities()
+	worker.Timezone = service.DetectTimezone()
 	service.Runtime = worker
 
 	ser, err := discover.NewService(service.Runtime)
@@ -101,6 +137,21 @@ func listen() {
 	go scheduler.Instance.Run(ctx)
 	go pipeline.WatchPipelines(service.Runtime.Id)
 
+	if metricsAddress != "" {
+		go func() {
+			if err := metrics.Serve(metricsAddress); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	// 主节点通过控制服务下发立即执行、强杀指令以及订阅输出
+	go func() {
+		if err := control.Serve(fmt.Sprintf(":%d", worker.Port), scheduler.Instance); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
 	sign := make(chan os.Signal, 1)
 	signal.Notify(sign, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
 
@@ -0,0 +1,19 @@
+package config
+
+// 代理模式的工作节点使用的配置，去掉数据库连接和各种密钥，工作节点只需要读取该配置
+func (conf *Config) Redact() *Config {
+	redacted := *conf
+	redacted.Database = Database{}
+	redacted.Auth.Secret = ""
+	redacted.Secrets.Key = ""
+	redacted.Agent.Token = ""
+	redacted.Identity.LDAP.BindPass = ""
+	redacted.Identity.OIDC.ClientSecret = ""
+
+	return &redacted
+}
+
+// 代理模式的配置在 ETCD 中的 Key
+func AgentKey(key string) string {
+	return key + "/agent"
+}
@@ -0,0 +1,20 @@
+package config
+
+// 未配置时启用的接口认证方式
+var DefaultAuthMethods = []string{"token", "jwt"}
+
+// 是否启用了指定的接口认证方式
+func (auth *Auth) Enabled(method string) bool {
+	methods := auth.Methods
+	if len(methods) == 0 {
+		methods = DefaultAuthMethods
+	}
+
+	for _, enabled := range methods {
+		if enabled == method {
+			return true
+		}
+	}
+
+	return false
+}
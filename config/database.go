@@ -0,0 +1,77 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+)
+
+const (
+	DRIVERMYSQL    = "mysql"
+	DRIVERPOSTGRES = "postgres"
+	DRIVERSQLITE   = "sqlite3"
+)
+
+// 使用的数据库驱动，未配置时使用 MySQL
+func (database *Database) Dialect() string {
+	if database.Driver == "" {
+		return DRIVERMYSQL
+	}
+
+	return database.Driver
+}
+
+// 校验数据库配置，MySQL 和 PostgreSQL 需要服务地址和账号，SQLite 只需要数据库文件路径
+func (database *Database) Check() error {
+	switch database.Dialect() {
+	case DRIVERMYSQL, DRIVERPOSTGRES:
+		if database.Host == "" || database.Port == 0 || database.User == "" || database.Pass == "" {
+			return errors.New("请填写数据库的地址、端口、用户名和密码")
+		}
+
+		if database.Dialect() == DRIVERMYSQL && database.Char == "" {
+			return errors.New("请填写数据库的字符集")
+		}
+	case DRIVERSQLITE:
+	default:
+		return fmt.Errorf("不支持的数据库类型 %s", database.Driver)
+	}
+
+	if database.Name == "" {
+		return errors.New("请填写数据库名称")
+	}
+
+	return nil
+}
+
+// 连接字符串，name 为空时只连接数据库服务，用于检查和创建数据库
+func (database *Database) DataSource(name string) string {
+	switch database.Dialect() {
+	case DRIVERPOSTGRES:
+		// PostgreSQL 必须连接到某个数据库，默认的 postgres 数据库总是存在
+		if name == "" {
+			name = "postgres"
+		}
+
+		mode := database.SSLMode
+		if mode == "" {
+			mode = "disable"
+		}
+
+		source := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(database.User, database.Pass),
+			Host:     net.JoinHostPort(database.Host, strconv.Itoa(database.Port)),
+			Path:     "/" + name,
+			RawQuery: url.Values{"sslmode": {mode}}.Encode(),
+		}
+		return source.String()
+	case DRIVERSQLITE:
+		// 多个协程同时写入时等待锁释放，而不是立即返回 database is locked
+		return database.Name + "?_busy_timeout=5000"
+	}
+
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s", database.User, database.Pass, database.Host, database.Port, name, database.Char)
+}
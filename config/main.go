@@ -8,21 +8,36 @@ import (
 
 type (
 	Etcd struct {
-		Killer    string   `json:"killer" yaml:"killer" validate:"required"`
 		Locker    string   `json:"locker" yaml:"locker" validate:"required"`
 		Service   string   `json:"service" yaml:"service" validate:"required"`
 		Pipeline  string   `json:"pipeline" yaml:"pipeline" validate:"required"`
+		Running   string   `json:"running,omitempty" yaml:"running" validate:"-"`
 		Config    string   `json:"config" yaml:"config" validate:"required"`
 		EndPoints []string `json:"endpoints" yaml:"endpoints" validate:"required"`
 		Timeout   int64    `json:"timeout" yaml:"timeout" validate:"required"`
+		// 监听超过该秒数没有收到事件和进度通知时重建，需要大于 ETCD 发送进度通知的间隔
+		WatchStall int64 `json:"watch_stall,omitempty" yaml:"watch_stall" validate:"-"`
+		// 连接 ETCD 使用的证书和账号，文件路径因节点而异，不保存到 ETCD 中的配置
+		Security EtcdSecurity `json:"-" yaml:"security" validate:"-"`
+	}
+	EtcdSecurity struct {
+		CACert   string `yaml:"cacert"`   // 校验 ETCD 服务端证书的 CA 证书，为空时使用系统的根证书
+		Cert     string `yaml:"cert"`     // 客户端证书，ETCD 开启客户端证书认证时需要
+		Key      string `yaml:"key"`      // 客户端证书的私钥
+		Username string `yaml:"username"` // ETCD 开启认证时使用的用户名
+		Password string `yaml:"password"` // ETCD 开启认证时使用的密码
 	}
 	Database struct {
-		Host string `json:"host" yaml:"host" validate:"required"`
-		Port int    `json:"port" yaml:"port" validate:"required"`
+		Host string `json:"host" yaml:"host" validate:"-"`
+		Port int    `json:"port" yaml:"port" validate:"-"`
 		Name string `json:"name" yaml:"name" validate:"required"`
-		User string `json:"user" yaml:"user" validate:"required"`
-		Pass string `json:"pass" yaml:"pass" validate:"required"`
-		Char string `json:"char" yaml:"char" validate:"required"`
+		User string `json:"user" yaml:"user" validate:"-"`
+		Pass string `json:"pass" yaml:"pass" validate:"-"`
+		Char string `json:"char" yaml:"char" validate:"-"`
+		// 数据库类型，mysql、postgres 或者 sqlite3，为空时使用 mysql，sqlite3 使用 name 作为数据库文件路径
+		Driver string `json:"driver,omitempty" yaml:"driver" validate:"omitempty,oneof=mysql postgres sqlite3"`
+		// PostgreSQL 的 SSL 模式，为空时使用 disable
+		SSLMode string `json:"sslmode,omitempty" yaml:"sslmode" validate:"-"`
 	}
 	User struct {
 		Name    string `json:"name" yaml:"-" validate:"required"`
@@ -33,6 +48,8 @@ type (
 	Auth struct {
 		Secret string `json:"secret" yaml:"secret" validate:"required"`
 		TTL    int64  `json:"ttl" yaml:"ttl" validate:"required"`
+		// 接口请求启用的认证方式，按照 token、jwt、ldap、oidc 的顺序尝试，未配置时只启用 token 和 jwt
+		Methods []string `json:"methods,omitempty" yaml:"methods" validate:"-"`
 	}
 	Notification struct {
 		Url        string `json:"url" yaml:"url" validate:"required"`
@@ -44,11 +61,86 @@ type (
 		Protocol   string `json:"protocol" yaml:"protocol" validate:"required"`
 		Encryption string `json:"encryption" yaml:"encryption" validate:"required"`
 	}
+	Retention struct {
+		Days    int `json:"days,omitempty" yaml:"days" validate:"-"`
+		Keep    int `json:"keep,omitempty" yaml:"keep" validate:"-"`       // 每条流水线最近的执行次数不受保留天数限制
+		Records int `json:"records,omitempty" yaml:"records" validate:"-"` // 执行记录保留的天数，超过后连同步骤记录一起删除，0 表示不删除
+		Rows    int `json:"rows,omitempty" yaml:"rows" validate:"-"`       // 每条流水线最多保留的执行记录数，0 表示不限制
+		Audit   int `json:"audit,omitempty" yaml:"audit" validate:"-"`     // 审计日志保留的天数，0 表示不删除
+		Batch   int `json:"batch,omitempty" yaml:"batch" validate:"-"`     // 每批删除的行数
+	}
+	Http struct {
+		Gzip bool `json:"gzip" yaml:"gzip" validate:"-"`
+		ETag bool `json:"etag" yaml:"etag" validate:"-"`
+		// 多个主节点同时运行时，非领导者的主节点直接处理查询请求，关闭后所有请求都转发给领导者
+		StandbyReads bool `json:"standby_reads" yaml:"standby_reads" validate:"-"`
+		// 在 /api/docs 提供 Swagger UI，页面资源从 SwaggerUrl 加载
+		Swagger    bool   `json:"swagger" yaml:"swagger" validate:"-"`
+		SwaggerUrl string `json:"swagger_url" yaml:"swagger_url" validate:"omitempty,url"`
+	}
+	Clock struct {
+		Source    string `json:"source" yaml:"source" validate:"-"`       // system 或者 monotonic
+		Authority string `json:"authority" yaml:"authority" validate:"-"` // 授时服务器地址，为空时不校准
+		Interval  int    `json:"interval" yaml:"interval" validate:"-"`   // 校准间隔秒数
+		MaxDrift  int    `json:"max_drift" yaml:"max_drift" validate:"-"` // 单次校准超过该毫秒数时记录日志
+	}
+	Run struct {
+		IdFormat  string `json:"id_format" yaml:"id_format" validate:"omitempty,oneof=uuid time"` // 执行记录ID的格式，uuid 或者按时间排序的 time
+		MaxOutput int    `json:"max_output" yaml:"max_output" validate:"min=0"`                   // 每个步骤保存的输出的最大字节数，超出时只保留末尾部分，0 表示不限制
+		Grace     int    `json:"grace" yaml:"grace" validate:"min=0"`                             // 终止时发送 SIGTERM 后等待进程退出的秒数，超过后发送 SIGKILL，0 使用默认的 10 秒
+	}
+	Secrets struct {
+		Key string `json:"key" yaml:"key" validate:"-"` // 加密任务密钥使用的口令，修改后已保存的密钥无法解密，为空时不能使用密钥
+	}
+	// 估算执行费用的模型，费用按照执行时长线性计算，全部为 0 时不估算
+	Cost struct {
+		Currency   string             `json:"currency" yaml:"currency" validate:"-"`
+		NodeMinute float64            `json:"node_minute" yaml:"node_minute" validate:"min=0"` // 节点每分钟的费用
+		Nodes      map[string]float64 `json:"nodes" yaml:"nodes" validate:"-"`                 // 按节点名称单独设置的每分钟费用，覆盖 NodeMinute
+		Modes      map[string]float64 `json:"modes" yaml:"modes" validate:"-"`                 // 各任务类型每分钟的额外费用，按照步骤的执行时长计算
+	}
+	// 代理模式的工作节点不连接数据库，通过主节点的代理服务读写数据
+	Agent struct {
+		Token string `json:"token" yaml:"token" validate:"-"` // 工作节点连接代理服务使用的令牌，为空时不启用代理服务
+	}
+	LDAP struct {
+		Address  string `json:"address" yaml:"address" validate:"-"`     // LDAP 服务地址，例如 ldap.example.com:389，为空时不启用
+		TLS      bool   `json:"tls" yaml:"tls" validate:"-"`             // 使用 LDAPS 连接
+		BindDN   string `json:"bind_dn" yaml:"bind_dn" validate:"-"`     // 查找用户时使用的账号，为空时匿名查找
+		BindPass string `json:"bind_pass" yaml:"bind_pass" validate:"-"` // 查找用户时使用的密码
+		BaseDN   string `json:"base_dn" yaml:"base_dn" validate:"-"`     // 查找用户的起点
+		Filter   string `json:"filter" yaml:"filter" validate:"-"`       // 查找用户的过滤条件，%s 替换为登录时输入的用户名
+		Email    string `json:"email" yaml:"email" validate:"-"`         // 邮箱属性
+		Name     string `json:"name" yaml:"name" validate:"-"`           // 姓名属性
+		Group    string `json:"group" yaml:"group" validate:"-"`         // 用户组属性
+	}
+	OIDC struct {
+		Issuer       string   `json:"issuer" yaml:"issuer" validate:"-"`               // 身份提供方地址，为空时不启用
+		ClientId     string   `json:"client_id" yaml:"client_id" validate:"-"`         // 客户端ID
+		ClientSecret string   `json:"client_secret" yaml:"client_secret" validate:"-"` // 客户端密钥
+		RedirectUrl  string   `json:"redirect_url" yaml:"redirect_url" validate:"-"`   // 回调地址，指向 /api/auth/oidc/callback
+		Scopes       []string `json:"scopes" yaml:"scopes" validate:"-"`               // 申请的权限范围
+		GroupsClaim  string   `json:"groups_claim" yaml:"groups_claim" validate:"-"`   // 用户信息中用户组的字段
+	}
+	Identity struct {
+		DefaultRole string            `json:"default_role" yaml:"default_role" validate:"omitempty,oneof=admin operator viewer"` // 没有匹配的用户组时使用的角色，为空时拒绝登录
+		Groups      map[string]string `json:"groups" yaml:"groups" validate:"-"`                                                 // 外部用户组对应的角色
+		LDAP        LDAP              `json:"ldap" yaml:"ldap"`
+		OIDC        OIDC              `json:"oidc" yaml:"oidc"`
+	}
 	Config struct {
 		Database     `json:"database"`
 		Auth         `json:"auth"`
 		Etcd         `json:"etcd"`
 		Notification `json:"notification"`
+		Retention    `json:"retention"`
+		Http         `json:"http"`
+		Clock        `json:"clock"`
+		Run          `json:"run"`
+		Identity     `json:"identity"`
+		Secrets      `json:"secrets"`
+		Cost         `json:"cost"`
+		Agent        `json:"agent"`
 	}
 )
 
@@ -58,7 +150,47 @@ var (
 )
 
 func Init() *Config {
-	return &Config{}
+	return &Config{
+		Etcd: Etcd{
+			Running:    "/ects/running",
+			WatchStall: 900,
+		},
+		Retention: Retention{
+			Days:  90,
+			Keep:  10,
+			Batch: 1000,
+		},
+		Http: Http{
+			Gzip:         true,
+			ETag:         true,
+			StandbyReads: true,
+			SwaggerUrl:   "https://cdn.jsdelivr.net/npm/swagger-ui-dist@3",
+		},
+		Clock: Clock{
+			Source:   "system",
+			Interval: 300,
+			MaxDrift: 500,
+		},
+		Run: Run{
+			IdFormat:  "uuid",
+			MaxOutput: 65535,
+		},
+		Cost: Cost{
+			Currency: "USD",
+		},
+		Identity: Identity{
+			LDAP: LDAP{
+				Filter: "(uid=%s)",
+				Email:  "mail",
+				Name:   "cn",
+				Group:  "memberOf",
+			},
+			OIDC: OIDC{
+				Scopes:      []string{"openid", "profile", "email"},
+				GroupsClaim: "groups",
+			},
+		},
+	}
 }
 
 // 检查配置文件是否存在
@@ -0,0 +1,12 @@
+package account
+
+import (
+	"github.com/betterde/ects/internal/openapi"
+	"github.com/betterde/ects/models"
+)
+
+// 接口说明，用于生成 OpenAPI 文档
+var Operations = []openapi.Operation{
+	{Method: "GET", Path: "", Summary: "获取当前用户信息", Result: models.User{}},
+	{Method: "PUT", Path: "/password", Summary: "修改密码，修改成功后签发新的令牌", Body: PasswordRequest{}},
+}
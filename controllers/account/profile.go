@@ -1,11 +1,15 @@
 package account
 
 import (
+	"github.com/betterde/ects/config"
 	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
 	"github.com/betterde/ects/services"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/kataras/iris"
 	"github.com/kataras/iris/mvc"
+	"gopkg.in/go-playground/validator.v9"
 )
 
 type (
@@ -18,6 +22,15 @@ type (
 		Email   string `json:"email"`
 		TeamId  string `json:"team_id"`
 		Manager bool   `json:"manager"`
+		Role    string `json:"role"`
+		// 管理员代理访问时为管理员ID
+		Impersonator string `json:"impersonator,omitempty"`
+		MustChange   bool   `json:"must_change"`
+	}
+	PasswordRequest struct {
+		Current  string `json:"current" validate:"required"`
+		Password string `json:"password" validate:"required,min=6,nefield=Current"`
+		Confirm  string `json:"confirm" validate:"eqfield=Password"`
 	}
 )
 
@@ -31,10 +44,13 @@ func (instance *Controller) Get(ctx iris.Context) mvc.Result {
 		return response.NotFound(err.Error())
 	}
 	return response.Success("请求成功", response.Payload{"data": &Profile{
-		ID:      user.Id,
-		Name:    user.Name,
-		Email:   user.Email,
-		Manager: user.Manager,
+		ID:           user.Id,
+		Name:         user.Name,
+		Email:        user.Email,
+		Manager:      user.Manager,
+		Role:         user.Authority(),
+		Impersonator: utils.GetImpersonator(ctx),
+		MustChange:   user.MustChange,
 	}})
 }
 
@@ -42,3 +58,43 @@ func (instance *Controller) Get(ctx iris.Context) mvc.Result {
 func (instance *Controller) Post(ctx iris.Context) mvc.Response {
 	return response.Success("业务逻辑尚未实现", response.Payload{"data": make([]interface{}, 0)})
 }
+
+// 修改密码，修改成功后签发新的令牌
+func (instance *Controller) PutPassword(ctx iris.Context) mvc.Response {
+	var params PasswordRequest
+	if err := ctx.ReadJSON(&params); err != nil {
+		return response.InternalServerError("参数解析失败", err)
+	}
+
+	if err := validator.New().Struct(params); err != nil {
+		return response.ValidationError("新密码至少 6 位，不能与当前密码相同且两次输入必须一致")
+	}
+
+	user, err := instance.Service.FindByID(utils.GetUID(ctx))
+	if err != nil {
+		return response.NotFound(err.Error())
+	}
+
+	if ok, _ := models.ValidatePassword(params.Current, []byte(user.Password)); !ok {
+		return response.Send(400, "当前密码错误", make(map[string]interface{}))
+	}
+
+	if err := services.ChangePassword(user, params.Password); err != nil {
+		return response.InternalServerError("修改密码失败", err)
+	}
+
+	if err := services.Audit(ctx, user, "CHANGE PASSWORD"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	token, err := services.IssueToken(user)
+	if err != nil {
+		return response.InternalServerError("签发令牌失败", err)
+	}
+
+	return response.Success("密码修改成功", response.Payload{"data": map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   config.Conf.Auth.TTL,
+	}})
+}
@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/services"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"time"
+)
+
+const (
+	COMMANDDAYS    = 7  // 未指定时间范围时校验最近几天的步骤
+	COMMANDMAXDAYS = 31 // 一次最多校验的天数
+)
+
+// 校验步骤的执行内容，列出摘要与任务当前定义和历史定义都不一致的步骤，只有管理员可以查询
+func (instance *Controller) GetCommands(ctx iris.Context) mvc.Response {
+	manager, err := services.IsManager(utils.GetUID(ctx))
+	if err != nil {
+		return response.InternalServerError("获取用户信息失败", err)
+	}
+
+	if !manager {
+		return response.Send(iris.StatusForbidden, "只有管理员可以校验执行内容", make(map[string]interface{}))
+	}
+
+	end := time.Now()
+	if to := ctx.URLParamTrim("to"); to != "" {
+		if end, err = parse(to); err != nil {
+			return response.ValidationError("结束时间格式有误，请使用 2006-01-02 或 2006-01-02 15:04:05")
+		}
+		// 只有日期时包含当天
+		if len(to) == len("2006-01-02") {
+			end = end.AddDate(0, 0, 1)
+		}
+	}
+
+	begin := end.AddDate(0, 0, -COMMANDDAYS)
+	if from := ctx.URLParamTrim("from"); from != "" {
+		if begin, err = parse(from); err != nil {
+			return response.ValidationError("开始时间格式有误，请使用 2006-01-02 或 2006-01-02 15:04:05")
+		}
+	}
+
+	if !begin.Before(end) || end.Sub(begin) > COMMANDMAXDAYS*24*time.Hour {
+		return response.ValidationError("开始时间必须早于结束时间，且一次最多校验 31 天")
+	}
+
+	cond := builder.Gte{"begin_with": begin}.And(builder.Lt{"begin_with": end})
+	for _, field := range []string{"node_id", "task_id"} {
+		if value := ctx.URLParamTrim(field); value != "" {
+			cond = cond.And(builder.Eq{field: value})
+		}
+	}
+
+	unexpected, err := services.VerifyCommands(cond)
+	if err != nil {
+		return response.InternalServerError("校验执行内容失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{"data": unexpected})
+}
@@ -0,0 +1,26 @@
+package audit
+
+import (
+	"github.com/betterde/ects/internal/openapi"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+)
+
+// 接口说明，用于生成 OpenAPI 文档
+var Operations = []openapi.Operation{
+	{Method: "GET", Path: "", Summary: "查询操作日志", Paged: true, Result: []models.Log{}, Query: []openapi.Parameter{
+		{Name: "user_id"},
+		{Name: "resource", Description: "操作对象的类型"},
+		{Name: "resource_id"},
+		{Name: "action"},
+		{Name: "operation"},
+		{Name: "from", Description: "开始时间，格式为 2006-01-02 或者 2006-01-02 15:04:05"},
+		{Name: "to", Description: "结束时间，格式同 from"},
+	}},
+	{Method: "GET", Path: "/commands", Summary: "列出执行内容摘要与任务定义不一致的步骤", Result: []services.UnexpectedCommand{}, Query: []openapi.Parameter{
+		{Name: "from", Description: "开始时间，默认为结束时间前 7 天"},
+		{Name: "to", Description: "结束时间，默认为当前时间"},
+		{Name: "node_id"},
+		{Name: "task_id"},
+	}},
+}
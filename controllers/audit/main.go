@@ -0,0 +1,87 @@
+package audit
+
+import (
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"strings"
+	"time"
+)
+
+type (
+	Controller struct{}
+)
+
+// 查询操作日志，支持按用户、操作对象、动作和时间范围筛选，非管理员只能查询自己的操作
+func (instance *Controller) Get(ctx iris.Context) mvc.Response {
+	manager, err := services.IsManager(utils.GetUID(ctx))
+	if err != nil {
+		return response.InternalServerError("获取用户信息失败", err)
+	}
+
+	cond := builder.NewCond()
+	if user := ctx.URLParamTrim("user_id"); user != "" {
+		// 代理期间的操作同时记录了管理员
+		cond = cond.And(builder.Eq{"user_id": user}.Or(builder.Eq{"impersonator": user}))
+	}
+	if !manager {
+		uid := utils.GetUID(ctx)
+		cond = cond.And(builder.Eq{"user_id": uid}.Or(builder.Eq{"impersonator": uid}))
+	}
+	if resource := ctx.URLParamTrim("resource"); resource != "" {
+		cond = cond.And(builder.Eq{"resource": resource})
+	}
+	if id := ctx.URLParamTrim("resource_id"); id != "" {
+		cond = cond.And(builder.Eq{"resource_id": id})
+	}
+	if action := ctx.URLParamTrim("action"); action != "" {
+		cond = cond.And(builder.Eq{"action": strings.ToUpper(action)})
+	}
+	if operation := ctx.URLParamTrim("operation"); operation != "" {
+		cond = cond.And(builder.Like{"operation", strings.ToUpper(operation)})
+	}
+
+	if from := ctx.URLParamTrim("from"); from != "" {
+		begin, err := parse(from)
+		if err != nil {
+			return response.ValidationError("开始时间格式有误，请使用 2006-01-02 或 2006-01-02 15:04:05")
+		}
+		cond = cond.And(builder.Gte{"created_at": begin})
+	}
+	if to := ctx.URLParamTrim("to"); to != "" {
+		end, err := parse(to)
+		if err != nil {
+			return response.ValidationError("结束时间格式有误，请使用 2006-01-02 或 2006-01-02 15:04:05")
+		}
+		// 只有日期时包含当天
+		if len(to) == len("2006-01-02") {
+			end = end.AddDate(0, 0, 1)
+		}
+		cond = cond.And(builder.Lt{"created_at": end})
+	}
+
+	page, limit, start := utils.Pagination(ctx)
+	logs := make([]models.Log, 0)
+	total, err := models.Engine.Where(cond).Limit(limit, start).Desc("created_at", "id").FindAndCount(&logs)
+	if err != nil {
+		return response.InternalServerError("获取操作日志失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{
+		"data": logs,
+		"meta": response.NewMeta(ctx, page, limit, total),
+	})
+}
+
+// 解析日期或者日期时间
+func parse(value string) (time.Time, error) {
+	if len(value) == len("2006-01-02") {
+		return time.ParseInLocation("2006-01-02", value, time.Local)
+	}
+
+	return time.ParseInLocation(models.DefaultTimeFormat, value, time.Local)
+}
@@ -1,14 +1,24 @@
 package auth
 
 import (
+	"errors"
+	"fmt"
 	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/identity"
+	"github.com/betterde/ects/internal/notify"
 	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/utils"
 	"github.com/betterde/ects/models"
 	"github.com/betterde/ects/services"
 	"github.com/kataras/iris"
 	"github.com/kataras/iris/mvc"
 	"gopkg.in/go-playground/validator.v9"
 	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type (
@@ -32,13 +42,37 @@ type (
 		AccessToken string `json:"access_token"`
 		TokenType   string `json:"token_type"`
 		ExpiresIn   int64  `json:"expires_in"`
+		MustChange  bool   `json:"must_change"`
 	}
+
+	ForgotRequest struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+
+	ResetRequest struct {
+		Token    string `json:"token" validate:"required"`
+		Password string `json:"password" validate:"required,min=6"`
+		Confirm  string `json:"confirm" validate:"eqfield=Password"`
+	}
+)
+
+var (
+	forgotByIP    = utils.NewLimiter(10, 15*time.Minute) // 同一来源地址 15 分钟内最多请求 10 次
+	forgotByEmail = utils.NewLimiter(3, time.Hour)       // 同一邮箱每小时最多发送 3 封重置邮件
 )
 
+// 保存 OIDC 登录流程 state 的 Cookie
+const OIDCSTATECOOKIE = "ects_oidc_state"
+
 // 路由分发
 func (instance *Controller) BeforeActivation(request mvc.BeforeActivation) {
 	request.Handle("POST", "/signin", "SignInHandler")
 	request.Handle("POST", "/signout", "SignOutHandler")
+	request.Handle("POST", "/forgot", "ForgotHandler")
+	request.Handle("POST", "/reset", "ResetHandler")
+	request.Handle("GET", "/providers", "ProvidersHandler")
+	request.Handle("GET", "/oidc/login", "OIDCLoginHandler")
+	request.Handle("GET", "/oidc/callback", "OIDCCallbackHandler")
 }
 
 // 用户登录逻辑
@@ -57,16 +91,207 @@ func (instance *Controller) SignInHandler(ctx iris.Context) mvc.Response {
 
 	token, err := instance.Service.Attempt(params.Username, params.Password)
 	if err != nil {
-		return response.UnAuthenticated(err.Error())
+		// 本地账号验证失败时尝试 LDAP
+		if !identity.LDAPEnabled() {
+			return response.UnAuthenticated(err.Error())
+		}
+
+		external, err := identity.Authenticate(params.Username, params.Password)
+		if err != nil {
+			if err != identity.ErrInvalidCredentials {
+				log.Println(err)
+			}
+			return response.UnAuthenticated(identity.ErrInvalidCredentials.Error())
+		}
+
+		_, token, err := services.SignInExternal(external)
+		if err != nil {
+			if err == identity.ErrNoRole {
+				return response.Send(iris.StatusForbidden, err.Error(), make(map[string]interface{}))
+			}
+			return response.InternalServerError("登录失败", err)
+		}
+
+		return response.Success("登录成功", response.Payload{"data": SignInSuccess{
+			AccessToken: token,
+			TokenType:   "Bearer",
+			ExpiresIn:   config.Conf.Auth.TTL,
+		}})
+	}
+
+	mustChange := false
+	if user := instance.Service.FindByEmail(params.Username); user != nil {
+		mustChange = user.MustChange
 	}
 
 	return response.Success("登录成功", response.Payload{"data": SignInSuccess{
 		AccessToken: token,
 		TokenType:   "Bearer",
 		ExpiresIn:   config.Conf.Auth.TTL,
+		MustChange:  mustChange,
 	}})
 }
 
+// 发送密码重置邮件，无论邮箱是否存在都返回相同的结果
+func (instance *Controller) ForgotHandler(ctx iris.Context) mvc.Response {
+	var params ForgotRequest
+	if err := ctx.ReadJSON(&params); err != nil {
+		return response.InternalServerError("参数解析失败", err)
+	}
+
+	if err := validator.New().Struct(params); err != nil {
+		return response.ValidationError("请输入正确的邮箱地址")
+	}
+
+	if !forgotByIP.Allow(ctx.RemoteAddr()) {
+		return response.Send(iris.StatusTooManyRequests, "请求过于频繁，请稍后再试", make(map[string]interface{}))
+	}
+
+	// 同一邮箱超出频率限制时不再发送，但返回相同的结果；邮件异步发送，避免通过响应时间判断邮箱是否存在
+	if forgotByEmail.Allow(strings.ToLower(params.Email)) {
+		go instance.sendResetMail(params.Email)
+	}
+
+	return response.Success("如果该邮箱已注册，你将收到一封密码重置邮件", response.Payload{"data": make(map[string]interface{})})
+}
+
+// 向已注册的邮箱发送密码重置邮件
+func (instance *Controller) sendResetMail(email string) {
+	if user := instance.Service.FindByEmail(email); user != nil {
+		token, err := services.IssueResetToken(user.Email)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		mailer := &notify.Mail{
+			From:        fmt.Sprintf("%s<%s>", "ECTS", config.Conf.Notification.User),
+			To:          user.Email,
+			Subject:     "重置密码",
+			Year:        time.Now().Year(),
+			SiteURL:     config.Conf.Notification.Url,
+			SiteTitle:   "Elastic Crontab System",
+			Greeting:    fmt.Sprintf("Hello %s", user.Name),
+			Intro:       fmt.Sprintf("我们收到了重置你的账户密码的请求，链接 %d 分钟内有效。", int(models.RESETEXPIRES.Minutes())),
+			ActionLabel: "重置密码",
+			ActionUrl:   fmt.Sprintf("%s/reset?token=%s", strings.TrimRight(config.Conf.Notification.Url, "/"), url.QueryEscape(token)),
+			Outro:       "如果这不是你本人的操作，请忽略这封邮件。",
+			Salutation:  "Regards",
+		}
+
+		if err := mailer.Generator("info").Send(); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// 使用邮件中的令牌重置密码
+func (instance *Controller) ResetHandler(ctx iris.Context) mvc.Response {
+	var params ResetRequest
+	if err := ctx.ReadJSON(&params); err != nil {
+		return response.InternalServerError("参数解析失败", err)
+	}
+
+	if err := validator.New().Struct(params); err != nil {
+		return response.ValidationError("密码至少 6 位且两次输入必须一致")
+	}
+
+	user, err := services.ResetPassword(params.Token, params.Password)
+	if err != nil {
+		if err == services.ErrInvalidResetToken {
+			return response.Send(400, err.Error(), make(map[string]interface{}))
+		}
+		return response.InternalServerError("重置密码失败", err)
+	}
+
+	if err := models.CreateLog(user, user.Id, "RESET PASSWORD"); err != nil {
+		log.Println(err)
+	}
+
+	return response.Success("密码重置成功", response.Payload{"data": make(map[string]interface{})})
+}
+
+// 获取启用的外部登录方式，登录页面据此显示单点登录入口
+func (instance *Controller) ProvidersHandler() mvc.Response {
+	return response.Success("请求成功", response.Payload{"data": map[string]bool{
+		identity.PROVIDERLDAP: identity.LDAPEnabled(),
+		identity.PROVIDEROIDC: identity.OIDCEnabled(),
+	}})
+}
+
+// 跳转到 OIDC 身份提供方，state 同时写入 Cookie，回调时校验是同一个浏览器发起的登录
+func (instance *Controller) OIDCLoginHandler(ctx iris.Context) mvc.Response {
+	if !identity.OIDCEnabled() {
+		return response.NotFound("未启用 OIDC 登录")
+	}
+
+	state, err := identity.NewState()
+	if err != nil {
+		return response.InternalServerError("生成登录请求失败", err)
+	}
+
+	location, err := identity.AuthCodeURL(state)
+	if err != nil {
+		return response.Coded(response.CODEUPSTREAM, response.BadGateway("获取身份提供方配置失败", "请检查 identity.oidc.issuer 配置", err))
+	}
+
+	ctx.SetCookie(&http.Cookie{
+		Name:     OIDCSTATECOOKIE,
+		Value:    state,
+		Path:     "/api/auth/oidc",
+		MaxAge:   int(identity.STATETTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return mvc.Response{Code: iris.StatusFound, Path: location}
+}
+
+// OIDC 身份提供方的回调，登录成功后将令牌通过 URL 片段交给前端，片段不会发送到服务器
+func (instance *Controller) OIDCCallbackHandler(ctx iris.Context) mvc.Response {
+	if !identity.OIDCEnabled() {
+		return response.NotFound("未启用 OIDC 登录")
+	}
+
+	// state 只能使用一次，删除 Cookie 时会同时清空请求中的 Cookie，需要先读取
+	cookie := ctx.GetCookie(OIDCSTATECOOKIE)
+	ctx.RemoveCookie(OIDCSTATECOOKIE, iris.CookiePath("/api/auth/oidc"))
+
+	state := ctx.URLParam("state")
+	if state == "" || state != cookie || identity.VerifyState(state) != nil {
+		return signInRedirect(url.Values{"error": {identity.ErrInvalidState.Error()}})
+	}
+
+	if reason := ctx.URLParam("error"); reason != "" {
+		return signInRedirect(url.Values{"error": {reason}})
+	}
+
+	external, err := identity.Exchange(ctx.URLParam("code"))
+	if err != nil {
+		log.Println(err)
+		return signInRedirect(url.Values{"error": {"身份提供方验证失败"}})
+	}
+
+	_, token, err := services.SignInExternal(external)
+	if err != nil {
+		if err != identity.ErrNoRole {
+			log.Println(err)
+			err = errors.New("登录失败")
+		}
+		return signInRedirect(url.Values{"error": {err.Error()}})
+	}
+
+	return signInRedirect(url.Values{
+		"access_token": {token},
+		"token_type":   {"Bearer"},
+		"expires_in":   {strconv.FormatInt(config.Conf.Auth.TTL, 10)},
+	})
+}
+
+func signInRedirect(fragment url.Values) mvc.Response {
+	return mvc.Response{Code: iris.StatusFound, Path: "/signin#" + fragment.Encode()}
+}
+
 // 用户注销逻辑
 func (instance *Controller) SignOutHandler(ctx iris.Context) mvc.Response {
 	return response.Success("", response.Payload{"data": make([]interface{}, 0)})
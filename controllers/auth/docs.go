@@ -0,0 +1,18 @@
+package auth
+
+import "github.com/betterde/ects/internal/openapi"
+
+// 接口说明，用于生成 OpenAPI 文档
+var Operations = []openapi.Operation{
+	{Method: "POST", Path: "/signin", Summary: "用户登录，返回 JWT", Body: SignIn{}},
+	{Method: "POST", Path: "/signout", Summary: "用户注销"},
+	{Method: "POST", Path: "/forgot", Summary: "发送密码重置邮件", Body: ForgotRequest{}},
+	{Method: "POST", Path: "/reset", Summary: "使用邮件中的令牌重置密码", Body: ResetRequest{}},
+	{Method: "GET", Path: "/providers", Summary: "获取启用的外部登录方式"},
+	{Method: "GET", Path: "/oidc/login", Summary: "跳转到 OIDC 身份提供方"},
+	{Method: "GET", Path: "/oidc/callback", Summary: "OIDC 身份提供方的回调", Query: []openapi.Parameter{
+		{Name: "code"},
+		{Name: "state"},
+		{Name: "error"},
+	}},
+}
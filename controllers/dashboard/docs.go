@@ -0,0 +1,19 @@
+package dashboard
+
+import (
+	"github.com/betterde/ects/internal/openapi"
+	"github.com/betterde/ects/services"
+)
+
+// 接口说明，用于生成 OpenAPI 文档
+var Operations = []openapi.Operation{
+	{Method: "GET", Path: "/nodes", Summary: "获取节点数据"},
+	{Method: "GET", Path: "/pipelines", Summary: "获取正在调度的流水线数量"},
+	{Method: "GET", Path: "/failtures", Summary: "获取流水线失败次数，包括执行超时"},
+	{Method: "GET", Path: "/costs", Summary: "估算可见的流水线在指定月份的执行费用", Result: services.CostReport{}, Query: []openapi.Parameter{
+		{Name: "month", Description: "统计月份，例如 2019-08"},
+	}},
+	{Method: "GET", Path: "/contention", Summary: "预测可见的流水线在节点上超过节点容量的同时执行", Result: []services.Contention{}, Query: []openapi.Parameter{
+		{Name: "hours", Type: "integer", Description: "检查接下来的小时数"},
+	}},
+}
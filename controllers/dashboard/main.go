@@ -2,13 +2,18 @@ package dashboard
 
 import (
 	"context"
+	"fmt"
 	"github.com/betterde/ects/config"
 	"github.com/betterde/ects/internal/discover"
 	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/utils"
 	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
 	"github.com/coreos/etcd/clientv3"
 	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
 	"github.com/kataras/iris/mvc"
+	"time"
 )
 
 type (
@@ -50,11 +55,56 @@ func (instance *Controller) GetPipelines() mvc.Response {
 	return response.Success("请求成功", response.Payload{"data": len(resp.Kvs)})
 }
 
-// 获取流水线失败次数
+// 获取流水线失败次数，包括执行超时
 func (instance *Controller) GetFailtures() mvc.Response {
-	if count, err := models.Engine.Where(builder.Eq{"status": 0}).Count(&models.PipelineRecords{}); err != nil {
+	if count, err := models.Engine.Where(builder.In("status", models.RECORDFAILED, models.RECORDTIMEOUT)).Count(&models.PipelineRecords{}); err != nil {
 		return response.InternalServerError("获取流水线执行记录失败", err)
 	} else {
 		return response.Success("请求成功", response.Payload{"data": count})
 	}
 }
+
+// 按照配置的费率估算当前用户可见的流水线在指定月份的执行费用
+func (instance *Controller) GetCosts(ctx iris.Context) mvc.Response {
+	month, err := time.ParseInLocation("2006-01", ctx.URLParamDefault("month", time.Now().Format("2006-01")), time.Local)
+	if err != nil {
+		return response.ValidationError("月份格式错误，例如 2019-08")
+	}
+
+	model := services.Cost()
+	if !model.Enabled() {
+		return response.ValidationError("尚未配置费率，请在配置文件的 cost 中设置")
+	}
+
+	visible, err := services.Visible(utils.GetUID(ctx))
+	if err != nil {
+		return response.InternalServerError("获取用户信息失败", err)
+	}
+
+	report, err := model.Report(visible, month)
+	if err != nil {
+		return response.InternalServerError("统计执行费用失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{"data": report})
+}
+
+// 预测当前用户可见的流水线接下来 hours 小时内在节点上同时执行超过节点容量的时间段
+func (instance *Controller) GetContention(ctx iris.Context) mvc.Response {
+	hours := ctx.URLParamIntDefault("hours", services.CONTENTIONHOURS)
+	if hours < 1 || hours > services.CONTENTIONMAXHOURS {
+		return response.ValidationError(fmt.Sprintf("检查范围须在 1 到 %d 小时之间", services.CONTENTIONMAXHOURS))
+	}
+
+	visible, err := services.Visible(utils.GetUID(ctx))
+	if err != nil {
+		return response.InternalServerError("获取用户信息失败", err)
+	}
+
+	contentions, err := services.Contentions(visible, "", time.Now(), hours)
+	if err != nil {
+		return response.InternalServerError("预测节点争用失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{"data": contentions})
+}
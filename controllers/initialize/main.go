@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"github.com/betterde/ects/config"
 	"github.com/betterde/ects/controllers/auth"
+	"github.com/betterde/ects/internal/discover"
 	"github.com/betterde/ects/internal/response"
 	"github.com/betterde/ects/internal/service"
 	"github.com/betterde/ects/internal/utils"
@@ -51,11 +52,18 @@ func (instance *Controller) Post(ctx iris.Context) mvc.Response {
 		return response.ValidationError("配置参数有误")
 	}
 
-	client, err := clientv3.New(clientv3.Config{
-		Endpoints:   params.Etcd.EndPoints,
-		DialTimeout: 10 * time.Second,
-	})
+	if err := params.Database.Check(); err != nil {
+		return response.ValidationError(err.Error())
+	}
+
+	// 连接 ETCD 的证书和账号只能通过启动参数或者配置文件指定
+	params.Etcd.Security = config.Conf.Etcd.Security
+	conf, err := discover.ClientConfig(&params.Etcd)
+	if err != nil {
+		return response.ValidationError(err.Error())
+	}
 
+	client, err := clientv3.New(conf)
 	if err != nil {
 		return response.InternalServerError("无法连接ETCD", err)
 	}
@@ -103,6 +111,7 @@ func (instance *Controller) Post(ctx iris.Context) mvc.Response {
 		Email:     params.User.Email,
 		Password:  string(pass),
 		Manager:   true,
+		Role:      models.ROLEADMIN,
 		CreatedAt: utils.Time(time.Now()),
 		UpdatedAt: utils.Time(time.Now()),
 	}
@@ -133,5 +142,7 @@ func (instance *Controller) GetDatabase(ctx iris.Context) mvc.Response {
 	config.Conf.Database.Port = ctx.Params().GetIntDefault("port", 3306)
 	config.Conf.Database.Char = ctx.URLParam("char")
 	config.Conf.Database.Name = ctx.URLParam("name")
+	config.Conf.Database.Driver = ctx.URLParam("driver")
+	config.Conf.Database.SSLMode = ctx.URLParam("sslmode")
 	return response.Success("Success", response.Payload{"data": map[string]bool{"exist": utils.IsDatabaseExist()}})
 }
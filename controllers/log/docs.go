@@ -0,0 +1,12 @@
+package log
+
+import "github.com/betterde/ects/internal/openapi"
+
+// 接口说明，用于生成 OpenAPI 文档
+var Operations = []openapi.Operation{
+	{Method: "GET", Path: "", Summary: "获取日志", Paged: true, Query: []openapi.Parameter{
+		{Name: "scene", Description: "pipeline、task 或者 user"},
+		{Name: "field", Description: "task 日志的筛选字段"},
+		{Name: "search"},
+	}},
+}
@@ -44,11 +44,7 @@ func (instance *Controller) Get(ctx iris.Context) mvc.Response {
 
 		return response.Success("请求成功", response.Payload{
 			"data": logs,
-			"meta": &response.Meta{
-				Limit: limit,
-				Page:  page,
-				Total: int(total),
-			},
+			"meta": response.NewMeta(ctx, page, limit, total),
 		})
 	case "task":
 		logs := make([]models.TaskRecords, 0)
@@ -65,11 +61,7 @@ func (instance *Controller) Get(ctx iris.Context) mvc.Response {
 
 		return response.Success("请求成功", response.Payload{
 			"data": logs,
-			"meta": &response.Meta{
-				Limit: limit,
-				Page:  page,
-				Total: int(total),
-			},
+			"meta": response.NewMeta(ctx, page, limit, total),
 		})
 	case "user":
 		logs := make([]models.Log, 0)
@@ -84,11 +76,7 @@ func (instance *Controller) Get(ctx iris.Context) mvc.Response {
 		}
 		return response.Success("Success", response.Payload{
 			"data": logs,
-			"meta": &response.Meta{
-				Limit: limit,
-				Page:  page,
-				Total: int(total),
-			}})
+			"meta": response.NewMeta(ctx, page, limit, total)})
 	}
 
 	return response.Send(400, "请选择日志类型", make([]interface{}, 0))
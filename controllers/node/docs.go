@@ -0,0 +1,24 @@
+package node
+
+import (
+	"github.com/betterde/ects/internal/openapi"
+	"github.com/betterde/ects/models"
+)
+
+// 接口说明，用于生成 OpenAPI 文档
+var Operations = []openapi.Operation{
+	{Method: "GET", Path: "", Summary: "获取节点列表", Paged: true, Result: []models.Node{}, Query: []openapi.Parameter{
+		{Name: "search", Description: "按照名称搜索"},
+	}},
+	{Method: "POST", Path: "", Summary: "创建节点", Body: CreateRequest{}, Result: models.Node{}},
+	{Method: "PUT", Path: "/{id}", Summary: "修改节点信息", Body: UpdateRequest{}},
+	{Method: "DELETE", Path: "/{id}", Summary: "删除节点"},
+	{Method: "PATCH", Path: "/{id}/drain", Summary: "排空节点或者恢复调度", Body: DrainRequest{}},
+	{Method: "GET", Path: "/{id}/probe", Summary: "检查节点的健康状况和时钟偏差"},
+	{Method: "GET", Path: "/{id}/runs", Summary: "获取节点执行的流水线和利用率", Query: []openapi.Parameter{
+		{Name: "hours", Type: "integer", Description: "统计最近的小时数"},
+	}},
+	{Method: "GET", Path: "/pipelines", Summary: "获取节点关联的流水线", Query: []openapi.Parameter{{Name: "node_id", Required: true}}},
+	{Method: "POST", Path: "/pipeline", Summary: "为节点绑定流水线", Body: models.PipelineNodePivot{}},
+	{Method: "DELETE", Path: "/pipeline/{id}", Summary: "解绑流水线"},
+}
@@ -1,10 +1,10 @@
 package node
 
 import (
-	"context"
 	"fmt"
-	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/control"
 	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/internal/request"
 	"github.com/betterde/ects/internal/response"
 	"github.com/betterde/ects/internal/utils"
 	"github.com/betterde/ects/models"
@@ -13,7 +13,6 @@ import (
 	"github.com/kataras/iris"
 	"github.com/kataras/iris/mvc"
 	"github.com/satori/go.uuid"
-	"gopkg.in/go-playground/validator.v9"
 	"log"
 	"time"
 )
@@ -32,8 +31,19 @@ type (
 		Name   string `json:"name" validate:"required"`
 		Remark string `json:"remark"`
 	}
+
+	DrainRequest struct {
+		Drained *bool `json:"drained" validate:"required"`
+	}
 )
 
+// 路由分发
+func (instance *Controller) BeforeActivation(request mvc.BeforeActivation) {
+	request.Handle("GET", "/{id:string}/runs", "Runs")
+	request.Handle("GET", "/{id:string}/probe", "Probe")
+	request.Handle("PATCH", "/{id:string}/drain", "PatchDrain")
+}
+
 // 获取节点列表
 func (instance *Controller) Get(ctx iris.Context) mvc.Response {
 	var (
@@ -93,23 +103,14 @@ func (instance *Controller) Get(ctx iris.Context) mvc.Response {
 
 	return response.Success("请求成功", response.Payload{
 		"data": nodes,
-		"meta": &response.Meta{
-			Limit: limit,
-			Page:  page,
-			Total: int(total),
-		}})
+		"meta": response.NewMeta(ctx, page, limit, total)})
 }
 
 // 创建节点
 func (instance *Controller) Post(ctx iris.Context) mvc.Response {
 	var params CreateRequest
-	validate := validator.New()
-	if err := ctx.ReadJSON(&params); err != nil {
-		return response.InternalServerError("参数解析失败", err)
-	}
-
-	if err := validate.Struct(params); err != nil {
-		return response.ValidationError("Please fill in the name")
+	if resp, ok := request.Bind(ctx, "node", &params); !ok {
+		return resp
 	}
 
 	worker := models.Node{
@@ -132,19 +133,14 @@ func (instance *Controller) Post(ctx iris.Context) mvc.Response {
 func (instance *Controller) PutBy(id string, ctx iris.Context) mvc.Response {
 	var params UpdateRequest
 	var worker models.Node
-	validate := validator.New()
-	if err := ctx.ReadJSON(&params); err != nil {
-		return response.InternalServerError("参数解析失败", err)
-	}
-
-	if err := validate.Struct(params); err != nil {
-		return response.ValidationError("Failed to validate params")
+	if resp, ok := request.Bind(ctx, "node", &params); !ok {
+		return resp
 	}
 
 	result, err := models.Engine.Id(id).Get(&worker)
 
 	if err != nil {
-		return response.NotFound("Node does not exist")
+		return response.Coded(response.CODENODENOTFOUND, response.NotFound("Node does not exist"))
 	}
 
 	if result {
@@ -153,13 +149,17 @@ func (instance *Controller) PutBy(id string, ctx iris.Context) mvc.Response {
 		if _, err := models.Engine.Id(id).Update(&worker); err != nil {
 			return response.Send(iris.StatusInternalServerError, "Failed to update node", err)
 		}
+
+		if err := services.Audit(ctx, &worker, "UPDATE NODE"); err != nil {
+			return response.InternalServerError("创建日志失败", err)
+		}
 	}
 
 	return response.Success("更新成功", response.Payload{"data": worker})
 }
 
 // 删除节点
-func (instance *Controller) DeleteBy(id string) mvc.Response {
+func (instance *Controller) DeleteBy(id string, ctx iris.Context) mvc.Response {
 	worker := models.Node{
 		Id: id,
 	}
@@ -191,6 +191,10 @@ func (instance *Controller) DeleteBy(id string) mvc.Response {
 		return response.InternalServerError("提交事务失败", err)
 	}
 
+	if err := services.Audit(ctx, &worker, "DELETE NODE"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
 	return response.Success("删除成功", response.Payload{"data": make(map[string]interface{})})
 }
 
@@ -235,14 +239,18 @@ func (instance *Controller) PostPipeline(ctx iris.Context) mvc.Response {
 		Id: uuid.NewV4().String(),
 	}
 
-	if err := ctx.ReadJSON(&relation); err != nil {
-		return response.InternalServerError("参数解析失败", err)
+	if fields := request.Decode(ctx, &relation); len(fields) > 0 {
+		return response.ValidationFailed(fields[0].Message, fields)
 	}
 
 	if err := relation.Store(); err != nil {
 		return response.InternalServerError("关联失败", err)
 	}
 
+	if err := services.Audit(ctx, &relation, "BIND PIPELINE"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
 	relation.Pipeline = &models.Pipeline{}
 
 	if _, err := models.Engine.Id(relation.PipelineId).Get(relation.Pipeline); err != nil {
@@ -250,8 +258,7 @@ func (instance *Controller) PostPipeline(ctx iris.Context) mvc.Response {
 	}
 
 	// 构建流水线数据
-	bytes, err := relation.Pipeline.Build()
-	if err != nil {
+	if _, err := relation.Pipeline.Build(); err != nil {
 		return response.InternalServerError("获取流水线相关信息失败", err)
 	}
 
@@ -259,17 +266,21 @@ func (instance *Controller) PostPipeline(ctx iris.Context) mvc.Response {
 		return response.Send(400, "当前流水线没有关联任何任务", make([]interface{}, 0))
 	}
 
-	key := fmt.Sprintf("%s/%s", config.Conf.Etcd.Pipeline, relation.Pipeline.Id)
-
-	if _, err := discover.Client.Put(context.TODO(), key, string(bytes)); err != nil {
-		return response.InternalServerError("同步到 ETCD 时出错", err)
+	if err := services.SyncPipeline(relation.Pipeline); err != nil {
+		return response.BadGateway("节点已关联，但同步到节点失败", services.SyncHint(relation.PipelineId), err)
 	}
 
-	if err := models.CreateLog(relation.Pipeline, utils.GetUID(ctx), "SYNC PIPELINE"); err != nil {
+	if err := services.Audit(ctx, relation.Pipeline, "SYNC PIPELINE"); err != nil {
 		return response.InternalServerError("创建日志失败", err)
 	}
 
-	return response.Success("关联成功", response.Payload{"data": relation})
+	// 检查节点是否满足任务的环境依赖
+	warnings, err := services.CheckRequirements(relation.PipelineId, []string{relation.NodeId})
+	if err != nil {
+		log.Println(err)
+	}
+
+	return response.Success("关联成功", response.Payload{"data": relation, "warnings": warnings})
 }
 
 // 解绑流水线
@@ -291,17 +302,190 @@ func (instance *Controller) DeletePipelineBy(id string, ctx iris.Context) mvc.Re
 		return response.InternalServerError("获取关联记录数量失败", err)
 	}
 
-	// 如果流水线未关联任何节点，则立即删除ETCD中的流水线
+	if _, err := models.Engine.Delete(&relation); err != nil {
+		return response.InternalServerError("解绑流水线失败", err)
+	}
+
+	if err := services.Audit(ctx, &relation, "UNBIND PIPELINE"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	// 如果流水线未关联任何节点，则立即删除ETCD中的流水线，否则同步剩余的节点
 	if count == 0 {
-		key := fmt.Sprintf("%s/%s", config.Conf.Etcd.Pipeline, relation.PipelineId)
-		if _, err := discover.Client.Delete(context.TODO(), key); err != nil {
-			return response.InternalServerError("删除ETCD中的流水线失败", err)
+		if err := services.RemovePipeline(relation.PipelineId); err != nil {
+			return response.BadGateway("已解绑，但从节点移除流水线失败", services.SyncHint(relation.PipelineId), err)
+		}
+	} else {
+		pipeline := &models.Pipeline{Id: relation.PipelineId}
+		if _, err := models.Engine.Get(pipeline); err != nil {
+			return response.InternalServerError("查询流水线信息失败", err)
+		}
+		if err := services.SyncPipeline(pipeline); err != nil {
+			return response.BadGateway("已解绑，但同步到节点失败", services.SyncHint(relation.PipelineId), err)
 		}
 	}
 
-	if _, err := models.Engine.Delete(&relation); err != nil {
-		return response.InternalServerError("解绑流水线失败", err)
+	return response.Success("解绑成功", response.Payload{"data": make([]interface{}, 0)})
+}
+
+// 通过控制服务检查节点的健康状况，并返回节点与主节点的时钟偏差
+func (instance *Controller) Probe(id string) mvc.Response {
+	node := models.Node{}
+	if exist, err := models.Engine.Id(id).Get(&node); err != nil {
+		return response.InternalServerError("查询节点信息失败", err)
+	} else if !exist {
+		return response.Coded(response.CODENODENOTFOUND, response.NotFound("节点不存在"))
 	}
 
-	return response.Success("解绑成功", response.Payload{"data": make([]interface{}, 0)})
+	if node.Mode != models.WORKER {
+		return response.Send(400, "只能检查工作节点", make(map[string]interface{}))
+	}
+
+	begin := time.Now()
+	reply, err := control.Probe(&node)
+	if err != nil {
+		return response.Coded(response.CODECONTROLUNAVAILABLE, response.BadGateway("节点的控制服务不可用", fmt.Sprintf("请检查节点 %s 的 %d 端口是否可以访问", node.Host, node.Port), err))
+	}
+	latency := time.Since(begin)
+
+	return response.Success("请求成功", response.Payload{
+		"data": reply,
+		"meta": map[string]interface{}{
+			"latency": latency.Nanoseconds() / int64(time.Millisecond),
+			"drift":   reply.Time.Sub(begin.Add(latency/2)).Nanoseconds() / int64(time.Millisecond),
+		},
+	})
+}
+
+// 将节点设置为维护状态或恢复调度，维护状态下节点不再执行新的流水线，正在执行的流水线继续执行
+func (instance *Controller) PatchDrain(id string, ctx iris.Context) mvc.Response {
+	params := DrainRequest{}
+	if resp, ok := request.Bind(ctx, "node", &params); !ok {
+		return resp
+	}
+
+	node := models.Node{}
+	if exist, err := models.Engine.Id(id).Get(&node); err != nil {
+		return response.InternalServerError("查询节点信息失败", err)
+	} else if !exist {
+		return response.Coded(response.CODENODENOTFOUND, response.NotFound("节点不存在"))
+	}
+
+	if node.Mode != models.WORKER {
+		return response.Send(400, "只能维护工作节点", make(map[string]interface{}))
+	}
+
+	// 维护中的节点离线时仍然保持维护状态，根据注册中心判断节点是否在线
+	registered, err := discover.Registered(node.Id)
+	if err != nil {
+		return response.BadGateway("查询节点注册信息失败", "请检查 ETCD 是否可用", err)
+	}
+
+	previous := node.Status
+	status, operation := models.DRAINED, "DRAIN NODE"
+	if !*params.Drained {
+		status, operation = models.OFFLINE, "UNDRAIN NODE"
+		if registered {
+			status = models.ONLINE
+		}
+	}
+
+	if _, err := models.Engine.Id(node.Id).Cols("status").Update(&models.Node{Status: status}); err != nil {
+		return response.InternalServerError("更新节点状态失败", err)
+	}
+	node.Status = status
+
+	// 离线的节点在重新上线时读取维护状态，在线的节点需要立即通知
+	var reply *control.ProbeReply
+	if registered {
+		if reply, err = control.Drain(&node, *params.Drained); err != nil {
+			if _, err := models.Engine.Id(node.Id).Cols("status").Update(&models.Node{Status: previous}); err != nil {
+				log.Println(err)
+			}
+			return response.Coded(response.CODECONTROLUNAVAILABLE, response.BadGateway("通知节点失败，已恢复原状态", fmt.Sprintf("请检查节点 %s 的 %d 端口是否可以访问", node.Host, node.Port), err))
+		}
+	}
+
+	if err := services.Audit(ctx, &node, operation); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("更新成功", response.Payload{"data": node, "meta": map[string]interface{}{"probe": reply}})
+}
+
+// 获取节点正在执行和历史执行的流水线，以及按小时统计的利用率
+func (instance *Controller) Runs(id string, ctx iris.Context) mvc.Response {
+	page, limit, start := utils.Pagination(ctx)
+	hours := ctx.URLParamIntDefault("hours", 24)
+	if hours <= 0 || hours > 24*7 {
+		return response.ValidationError("统计时长须在 1 到 168 小时之间")
+	}
+
+	running := make([]models.PipelineRecords, 0)
+	if err := models.Engine.Where(builder.Eq{"node_id": id, "status": models.RECORDRUNNING}).Desc("begin_with").Find(&running); err != nil {
+		return response.InternalServerError("查询正在执行的流水线失败", err)
+	}
+
+	history := make([]models.PipelineRecords, 0)
+	total, err := models.Engine.Where(builder.Eq{"node_id": id}.And(builder.Neq{"status": models.RECORDRUNNING})).Limit(limit, start).Desc("begin_with").FindAndCount(&history)
+	if err != nil {
+		return response.InternalServerError("查询历史执行记录失败", err)
+	}
+
+	now := time.Now()
+	since := now.Truncate(time.Hour).Add(-time.Duration(hours-1) * time.Hour)
+	records := make([]models.PipelineRecords, 0)
+	if err := models.Engine.Where(builder.Eq{"node_id": id}.And(builder.Gte{"finish_with": since}.Or(builder.Eq{"status": models.RECORDRUNNING}))).Find(&records); err != nil {
+		return response.InternalServerError("查询节点利用率失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{
+		"data": map[string]interface{}{
+			"running":     running,
+			"history":     history,
+			"utilization": utilization(records, since, hours, now),
+		},
+		"meta": response.NewMeta(ctx, page, limit, total),
+	})
+}
+
+// 将执行记录的耗时按小时分摊，计算每个小时的忙碌时长和利用率
+func utilization(records []models.PipelineRecords, since time.Time, hours int, now time.Time) []map[string]interface{} {
+	buckets := make([]map[string]interface{}, 0, hours)
+	for i := 0; i < hours; i++ {
+		begin := since.Add(time.Duration(i) * time.Hour)
+		end := begin.Add(time.Hour)
+		runs := 0
+		busy := 0.0
+		for _, record := range records {
+			beginWith := time.Time(record.BeginWith)
+			finishWith := time.Time(record.FinishWith)
+			if record.Status == models.RECORDRUNNING || finishWith.IsZero() {
+				finishWith = now
+			}
+
+			if finishWith.Before(begin) || !beginWith.Before(end) {
+				continue
+			}
+
+			if beginWith.Before(begin) {
+				beginWith = begin
+			}
+			if finishWith.After(end) {
+				finishWith = end
+			}
+
+			runs++
+			busy += finishWith.Sub(beginWith).Seconds()
+		}
+
+		buckets = append(buckets, map[string]interface{}{
+			"hour":  begin.Format(models.DefaultTimeFormat),
+			"runs":  runs,
+			"busy":  int64(busy),
+			"ratio": busy / time.Hour.Seconds(),
+		})
+	}
+
+	return buckets
 }
@@ -0,0 +1,32 @@
+package organization
+
+import (
+	"github.com/betterde/ects/internal/openapi"
+	"github.com/betterde/ects/models"
+)
+
+// 用户管理的接口说明，用于生成 OpenAPI 文档
+var UserOperations = []openapi.Operation{
+	{Method: "GET", Path: "", Summary: "获取用户列表", Paged: true, Result: []models.User{}, Query: []openapi.Parameter{
+		{Name: "scene", Description: "table 分页查询，selector 返回全部用户"},
+		{Name: "search", Description: "按照名称或者邮箱搜索"},
+	}},
+	{Method: "POST", Path: "", Summary: "创建用户", Body: CreateRequest{}},
+	{Method: "PUT", Path: "/{id}", Summary: "修改用户信息", Body: UpdateRequest{}},
+	{Method: "DELETE", Path: "/{id}", Summary: "删除用户"},
+	{Method: "POST", Path: "/{id}/impersonate", Summary: "以指定用户的身份访问系统"},
+}
+
+// 团队管理的接口说明，用于生成 OpenAPI 文档
+var TeamOperations = []openapi.Operation{
+	{Method: "GET", Path: "", Summary: "获取团队列表", Paged: true, Result: []models.Team{}, Query: []openapi.Parameter{
+		{Name: "scene", Description: "table 分页查询，selector 返回全部团队"},
+		{Name: "search", Description: "按照名称搜索"},
+	}},
+	{Method: "POST", Path: "", Summary: "创建团队", Body: models.Team{}},
+	{Method: "PUT", Path: "/{id}", Summary: "更新团队", Body: models.Team{}},
+	{Method: "DELETE", Path: "/{id}", Summary: "删除团队"},
+	{Method: "GET", Path: "/{id}/members", Summary: "获取团队成员", Result: []models.User{}},
+	{Method: "POST", Path: "/{id}/members", Summary: "添加团队成员", Body: MembersRequest{}},
+	{Method: "DELETE", Path: "/{id}/members/{uid}", Summary: "移除团队成员"},
+}
@@ -0,0 +1,314 @@
+package organization
+
+import (
+	"github.com/betterde/ects/internal/message"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"github.com/satori/go.uuid"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type (
+	TeamController struct{}
+
+	MembersRequest struct {
+		UsersId []string `json:"users_id" validate:"required,dive,uuid4"`
+	}
+)
+
+var authority = services.NewPermissionService()
+
+// 路由分发
+func (instance *TeamController) BeforeActivation(request mvc.BeforeActivation) {
+	request.Handle("GET", "/{id:string}/members", "Members")
+	request.Handle("POST", "/{id:string}/members", "AddMembers")
+	request.Handle("DELETE", "/{id:string}/members/{uid:string}", "RemoveMember")
+}
+
+// 获取团队列表
+func (instance *TeamController) Get(ctx iris.Context) mvc.Response {
+	var (
+		total int64
+		err   error
+	)
+	scene := ctx.URLParamDefault("scene", "table")
+	search := ctx.URLParamDefault("search", "")
+	teams := make([]models.Team, 0)
+
+	cond := builder.NewCond()
+	if search != "" {
+		cond = builder.Like{"name", search}
+	}
+
+	switch scene {
+	case "table":
+		page, limit, start := utils.Pagination(ctx)
+
+		if total, err = models.Engine.Where(cond).Limit(limit, start).Desc("created_at").FindAndCount(&teams); err != nil {
+			return response.InternalServerError("获取团队列表失败", err)
+		}
+
+		return response.Success("请求成功", response.Payload{
+			"data": teams,
+			"meta": response.NewMeta(ctx, page, limit, total),
+		})
+	case "selector":
+		if err = models.Engine.Where(cond).Find(&teams); err != nil {
+			return response.InternalServerError("获取团队列表失败", err)
+		}
+
+		return response.Success("请求成功", response.Payload{"data": teams})
+	}
+
+	return response.Success("数据使用场景有误", response.Payload{"data": make([]interface{}, 0)})
+}
+
+// 创建团队
+func (instance *TeamController) Post(ctx iris.Context) mvc.Response {
+	if resp, ok := manager(ctx); !ok {
+		return resp
+	}
+
+	team := models.Team{}
+
+	if err := ctx.ReadJSON(&team); err != nil {
+		return response.InternalServerError("参数解析失败", err)
+	}
+
+	if err := validator.New().Struct(team); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return response.ValidationError(message.Get("team", validationErrors))
+	}
+
+	team.Id = uuid.NewV4().String()
+	if err := team.Store(); err != nil {
+		return response.InternalServerError("创建团队失败", err)
+	}
+
+	if err := services.Audit(ctx, &team, "CREATE TEAM"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("创建成功", response.Payload{"data": team})
+}
+
+// 更新团队
+func (instance *TeamController) PutBy(id string, ctx iris.Context) mvc.Response {
+	if resp, ok := manager(ctx); !ok {
+		return resp
+	}
+
+	team := models.Team{}
+
+	if err := ctx.ReadJSON(&team); err != nil {
+		return response.InternalServerError("参数解析失败", err)
+	}
+
+	if err := validator.New().Struct(team); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return response.ValidationError(message.Get("team", validationErrors))
+	}
+
+	team.Id = id
+	if err := team.Update(); err != nil {
+		return response.InternalServerError("更新团队失败", err)
+	}
+
+	if err := services.Audit(ctx, &team, "UPDATE TEAM"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("更新成功", response.Payload{"data": team})
+}
+
+// 删除团队，共享给该团队的流水线和项目将不再限制可见范围
+func (instance *TeamController) DeleteBy(id string, ctx iris.Context) mvc.Response {
+	if resp, ok := manager(ctx); !ok {
+		return resp
+	}
+
+	team := models.Team{
+		Id: id,
+	}
+
+	session := models.Engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return response.InternalServerError("初始化事务失败", err)
+	}
+
+	if _, err := session.Where(builder.Eq{"team_id": id}).Delete(&models.TeamMember{}); err != nil {
+		_ = session.Rollback()
+		return response.InternalServerError("删除团队成员失败", err)
+	}
+
+	for _, bean := range []interface{}{new(models.Pipeline), new(models.Project)} {
+		if _, err := session.Table(bean).Where(builder.Eq{"team_id": id}).Update(map[string]interface{}{"team_id": ""}); err != nil {
+			_ = session.Rollback()
+			return response.InternalServerError("解除团队共享失败", err)
+		}
+	}
+
+	if _, err := session.Delete(&team); err != nil {
+		_ = session.Rollback()
+		return response.InternalServerError("删除团队失败", err)
+	}
+
+	if err := session.Commit(); err != nil {
+		return response.InternalServerError("提交事务失败", err)
+	}
+
+	if err := services.Audit(ctx, &team, "DELETE TEAM"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("删除成功", response.Payload{"data": make(map[string]interface{})})
+}
+
+// 获取团队成员
+func (instance *TeamController) Members(id string) mvc.Response {
+	members := make([]*models.TeamMember, 0)
+	if err := models.Engine.Where(builder.Eq{"team_id": id}).Find(&members); err != nil {
+		return response.InternalServerError("获取团队成员失败", err)
+	}
+
+	if len(members) == 0 {
+		return response.Success("请求成功", response.Payload{"data": members})
+	}
+
+	ids := make([]string, 0, len(members))
+	for _, member := range members {
+		ids = append(ids, member.UserId)
+	}
+
+	users := make(map[string]models.User)
+	if err := models.Engine.Where(builder.In("id", ids)).Find(&users); err != nil {
+		return response.InternalServerError("获取团队成员失败", err)
+	}
+
+	for _, member := range members {
+		if user, exist := users[member.UserId]; exist {
+			member.User = &user
+		}
+	}
+
+	return response.Success("请求成功", response.Payload{"data": members})
+}
+
+// 添加团队成员，已经是成员的用户将被忽略
+func (instance *TeamController) AddMembers(id string, ctx iris.Context) mvc.Response {
+	params := MembersRequest{}
+
+	if err := ctx.ReadJSON(&params); err != nil {
+		return response.InternalServerError("参数解析失败", err)
+	}
+
+	if err := validator.New().Struct(params); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return response.ValidationError(message.Get("team", validationErrors))
+	}
+
+	if resp, ok := membership(ctx, id); !ok {
+		return resp
+	}
+
+	if exist, err := models.Engine.Id(id).Exist(&models.Team{}); err != nil {
+		return response.InternalServerError("查询团队失败", err)
+	} else if !exist {
+		return response.NotFound("团队不存在")
+	}
+
+	existing := make([]string, 0)
+	if err := models.Engine.Table(new(models.TeamMember)).Cols("user_id").Where(builder.Eq{"team_id": id}).Find(&existing); err != nil {
+		return response.InternalServerError("获取团队成员失败", err)
+	}
+
+	joined := make(map[string]bool, len(existing))
+	for _, uid := range existing {
+		joined[uid] = true
+	}
+
+	members := make([]*models.TeamMember, 0)
+	for _, uid := range params.UsersId {
+		if joined[uid] {
+			continue
+		}
+		joined[uid] = true
+
+		members = append(members, &models.TeamMember{
+			Id:     uuid.NewV4().String(),
+			TeamId: id,
+			UserId: uid,
+		})
+	}
+
+	if len(members) > 0 {
+		if _, err := models.Engine.Insert(&members); err != nil {
+			return response.InternalServerError("添加团队成员失败", err)
+		}
+	}
+
+	for _, member := range members {
+		if err := services.Audit(ctx, member, "JOIN TEAM"); err != nil {
+			return response.InternalServerError("创建日志失败", err)
+		}
+	}
+
+	return response.Success("添加成功", response.Payload{"data": members})
+}
+
+// 移除团队成员
+func (instance *TeamController) RemoveMember(id, uid string, ctx iris.Context) mvc.Response {
+	if resp, ok := membership(ctx, id); !ok {
+		return resp
+	}
+
+	relation := models.TeamMember{}
+
+	exist, err := models.Engine.Where(builder.Eq{"team_id": id, "user_id": uid}).Get(&relation)
+	if err != nil {
+		return response.InternalServerError("查询团队成员失败", err)
+	}
+
+	if !exist {
+		return response.NotFound("该用户不是团队成员")
+	}
+
+	if err := relation.Destroy(); err != nil {
+		return response.InternalServerError("移除团队成员失败", err)
+	}
+
+	if err := services.Audit(ctx, &relation, "LEAVE TEAM"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("移除成功", response.Payload{"data": make(map[string]interface{})})
+}
+
+// 只有管理员可以创建、修改和删除团队
+func manager(ctx iris.Context) (mvc.Response, bool) {
+	ok, err := services.IsManager(utils.GetUID(ctx))
+	if err != nil {
+		return response.InternalServerError("获取用户信息失败", err), false
+	}
+
+	if !ok {
+		return response.Send(iris.StatusForbidden, "只有管理员可以管理团队", make(map[string]interface{})), false
+	}
+
+	return mvc.Response{}, true
+}
+
+// 管理员和团队现有成员可以管理团队成员
+func membership(ctx iris.Context, teamId string) (mvc.Response, bool) {
+	if err := authority.Authorize(utils.GetUID(ctx), teamId); err != nil {
+		return response.Error("查询团队成员失败", err), false
+	}
+
+	return mvc.Response{}, true
+}
@@ -1,7 +1,7 @@
 package organization
 
 import (
-	"github.com/betterde/ects/internal/message"
+	"github.com/betterde/ects/internal/request"
 	"github.com/betterde/ects/internal/response"
 	"github.com/betterde/ects/internal/utils"
 	"github.com/betterde/ects/models"
@@ -10,8 +10,6 @@ import (
 	"github.com/kataras/iris"
 	"github.com/kataras/iris/mvc"
 	"github.com/satori/go.uuid"
-	"gopkg.in/go-playground/validator.v9"
-	"log"
 	"time"
 )
 
@@ -26,15 +24,25 @@ type (
 		Pass    string `json:"pass" validate:"required"`
 		Confirm string `json:"confirm" validate:"eqfield=Pass"`
 		Manager bool   `json:"manager"`
+		// 未指定角色时根据 Manager 决定是管理员还是操作员
+		Role string `json:"role" validate:"omitempty,oneof=admin operator viewer"`
+		// 首次登录后必须修改密码
+		MustChange bool `json:"must_change"`
 	}
 
 	UpdateRequest struct {
 		Name    string `json:"name" validate:"required"`
 		Email   string `json:"email" validate:"required,email"`
 		Manager bool   `json:"manager"`
+		Role    string `json:"role" validate:"omitempty,oneof=admin operator viewer"`
 	}
 )
 
+// 路由分发
+func (instance *UserController) BeforeActivation(request mvc.BeforeActivation) {
+	request.Handle("POST", "/{id:string}/impersonate", "Impersonate")
+}
+
 // 获取用户列表
 func (instance *UserController) Get(ctx iris.Context) mvc.Response {
 	var (
@@ -61,11 +69,7 @@ func (instance *UserController) Get(ctx iris.Context) mvc.Response {
 
 		return response.Success("请求成功", response.Payload{
 			"data": users,
-			"meta": &response.Meta{
-				Limit: limit,
-				Page:  page,
-				Total: int(total),
-			},
+			"meta": response.NewMeta(ctx, page, limit, total),
 		})
 	case "selector":
 		if search == "" {
@@ -90,15 +94,8 @@ func (instance *UserController) Post(ctx iris.Context) mvc.Response {
 		params CreateRequest
 	)
 
-	validate := validator.New()
-
-	if err := ctx.ReadJSON(&params); err != nil {
-		return response.InternalServerError("参数解析失败", err)
-	}
-
-	if err := validate.Struct(params); err != nil {
-		validationErrors := err.(validator.ValidationErrors)
-		return response.ValidationError(message.Get("user", validationErrors))
+	if resp, ok := request.Bind(ctx, "user", &params); !ok {
+		return resp
 	}
 
 	pass, err := models.GeneratePassword(params.Pass)
@@ -111,19 +108,24 @@ func (instance *UserController) Post(ctx iris.Context) mvc.Response {
 	}
 
 	user := &models.User{
-		Id:        uuid.NewV4().String(),
-		Name:      params.Name,
-		Email:     params.Email,
-		Password:  string(pass),
-		Manager:   params.Manager,
-		CreatedAt: utils.Time(time.Now()),
-		UpdatedAt: utils.Time(time.Now()),
+		Id:         uuid.NewV4().String(),
+		Name:       params.Name,
+		Email:      params.Email,
+		Password:   string(pass),
+		MustChange: params.MustChange,
+		CreatedAt:  utils.Time(time.Now()),
+		UpdatedAt:  utils.Time(time.Now()),
 	}
+	user.Assign(role(params.Role, params.Manager))
 
 	if err := user.Store(); err != nil {
 		return response.InternalServerError("Failed to create user", err)
 	}
 
+	if err := services.Audit(ctx, user, "CREATE USER"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
 	return response.Success("创建成功", response.Payload{"data": user})
 }
 
@@ -132,14 +134,8 @@ func (instance *UserController) PutBy(id string, ctx iris.Context) mvc.Response
 	var params UpdateRequest
 	var user models.User
 
-	validate := validator.New()
-
-	if err := ctx.ReadJSON(&params); err != nil {
-		log.Println(err)
-	}
-
-	if err := validate.Struct(params); err != nil {
-		return response.ValidationError("Failed to validate params")
+	if resp, ok := request.Bind(ctx, "user", &params); !ok {
+		return resp
 	}
 
 	result, err := models.Engine.Id(id).Get(&user)
@@ -150,25 +146,85 @@ func (instance *UserController) PutBy(id string, ctx iris.Context) mvc.Response
 	if result {
 		user.Name = params.Name
 		user.Email = params.Email
-		user.Manager = params.Manager
+		user.Assign(role(params.Role, params.Manager))
 		if _, err := models.Engine.Id(id).Update(&user); err != nil {
 			return response.Send(iris.StatusInternalServerError, "Failed to update user", err)
 		}
+
+		if err := services.Audit(ctx, &user, "UPDATE USER"); err != nil {
+			return response.InternalServerError("创建日志失败", err)
+		}
 	}
 
 	return response.Success("Updated successful", response.Payload{"data": user})
 }
 
 // 删除用户
-func (instance *UserController) DeleteBy(id string) mvc.Response {
+func (instance *UserController) DeleteBy(id string, ctx iris.Context) mvc.Response {
 	user := &models.User{
 		Id: id,
 	}
 
-	_, err := models.Engine.Delete(user)
-	if err != nil {
+	if _, err := models.Engine.Delete(user); err != nil {
+		return response.InternalServerError("删除用户失败", err)
+	}
 
+	if err := services.Audit(ctx, user, "DELETE USER"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
 	}
 
 	return response.Success("Deleted successful", response.Payload{"data": make(map[string]interface{})})
 }
+
+// 管理员以指定用户的身份访问系统，代理期间的操作日志会记录管理员
+func (instance *UserController) Impersonate(id string, ctx iris.Context) mvc.Response {
+	if utils.GetImpersonator(ctx) != "" {
+		return response.Send(iris.StatusForbidden, "代理状态下不能再次代理其他用户", make(map[string]interface{}))
+	}
+
+	admin, err := instance.Service.FindByID(utils.GetUID(ctx))
+	if err != nil {
+		return response.NotFound(err.Error())
+	}
+
+	if !admin.Manager {
+		return response.Send(iris.StatusForbidden, "只有管理员可以代理其他用户", make(map[string]interface{}))
+	}
+
+	user, err := instance.Service.FindByID(id)
+	if err != nil {
+		return response.NotFound(err.Error())
+	}
+
+	if user.Id == admin.Id {
+		return response.Send(400, "不能代理自己", make(map[string]interface{}))
+	}
+
+	token, err := services.IssueImpersonationToken(admin, user)
+	if err != nil {
+		return response.InternalServerError("签发代理令牌失败", err)
+	}
+
+	if err := models.CreateImpersonatedLog(user, user.Id, admin.Id, "IMPERSONATE USER"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("代理成功", response.Payload{"data": map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"impersonator": admin.Id,
+	}})
+}
+
+// 兼容只传入 manager 的请求
+func role(role string, manager bool) string {
+	if role != "" {
+		return role
+	}
+
+	if manager {
+		return models.ROLEADMIN
+	}
+
+	return models.ROLEOPERATOR
+}
@@ -0,0 +1,206 @@
+package pipeline
+
+import (
+	"fmt"
+	"github.com/betterde/ects/internal/control"
+	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/internal/request"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/go-xorm/builder"
+	"github.com/go-xorm/xorm"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"log"
+)
+
+const (
+	BATCHENABLE  = "enable"
+	BATCHDISABLE = "disable"
+	BATCHDELETE  = "delete"
+)
+
+// 批量启用、禁用或者删除流水线，每次最多 500 条，禁用时可以同时撤回等待执行的指令、终止正在执行的流水线
+type BatchRequest struct {
+	Action       string   `json:"action" validate:"required,oneof=enable disable delete"`
+	Ids          []string `json:"ids" validate:"required,min=1,max=500,dive,uuid4"`
+	CancelQueued bool     `json:"cancel_queued"`
+	KillRunning  bool     `json:"kill_running"`
+}
+
+// 在一个数据库事务中批量修改流水线，ETCD 中的流水线分批写入，写入失败时回滚数据库并恢复已经写入的流水线
+func (instance *Controller) PostBatch(ctx iris.Context) mvc.Response {
+	params := BatchRequest{}
+	if resp, ok := request.Bind(ctx, "pipeline", &params); !ok {
+		return resp
+	}
+
+	ids := make([]string, 0, len(params.Ids))
+	seen := make(map[string]bool)
+	for _, id := range params.Ids {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	pipelines := make([]*models.Pipeline, 0, len(ids))
+	if err := models.Engine.In("id", ids).Find(&pipelines); err != nil {
+		return response.InternalServerError("查询流水线失败", err)
+	}
+
+	if len(pipelines) != len(ids) {
+		found := make(map[string]bool)
+		for _, pipeline := range pipelines {
+			found[pipeline.Id] = true
+		}
+		missing := make([]string, 0)
+		for _, id := range ids {
+			if !found[id] {
+				missing = append(missing, id)
+			}
+		}
+		return response.Coded(response.CODEPIPELINENOTFOUND, response.Send(iris.StatusNotFound, "部分流水线不存在", map[string]interface{}{"ids": missing}))
+	}
+
+	checked := make(map[string]bool)
+	for _, pipeline := range pipelines {
+		if checked[pipeline.TeamId] {
+			continue
+		}
+		if resp, ok := accessible(ctx, pipeline.TeamId); !ok {
+			return resp
+		}
+		checked[pipeline.TeamId] = true
+	}
+
+	// 修改后和修改前在 ETCD 中的流水线，未绑定节点的流水线没有下发到 ETCD
+	puts := make(map[string]string)
+	deletes := make([]string, 0)
+	previous := make(map[string]string)
+	for _, pipeline := range pipelines {
+		if params.Action == BATCHDELETE {
+			deletes = append(deletes, pipeline.Id)
+		}
+
+		origin, err := pipeline.Build()
+		if err != nil {
+			return response.InternalServerError("获取流水线相关信息失败", err)
+		}
+
+		if len(pipeline.Nodes) == 0 {
+			continue
+		}
+		previous[pipeline.Id] = string(origin)
+
+		if params.Action == BATCHDELETE {
+			continue
+		}
+
+		status := pipeline.Status
+		pipeline.Status = target(params.Action)
+		value, err := pipeline.ToString()
+		pipeline.Status = status
+		if err != nil {
+			return response.InternalServerError("获取流水线相关信息失败", err)
+		}
+		puts[pipeline.Id] = value
+	}
+
+	session := models.Engine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return response.InternalServerError("开启事务失败", err)
+	}
+
+	if err := batch(session, params.Action, ids); err != nil {
+		if err := session.Rollback(); err != nil {
+			log.Println(err)
+		}
+		return response.InternalServerError("批量修改流水线失败", err)
+	}
+
+	// 恢复 ETCD 中修改前的流水线，批量删除时重新写入被删除的流水线
+	restore := func() {
+		if err := discover.ApplyPipelines(previous, nil); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if err := discover.ApplyPipelines(puts, deletes); err != nil {
+		if err := session.Rollback(); err != nil {
+			log.Println(err)
+		}
+		restore()
+		return response.BadGateway("同步到节点失败，流水线未修改", "请稍后重试", err)
+	}
+
+	if err := session.Commit(); err != nil {
+		restore()
+		return response.InternalServerError("提交事务失败", err)
+	}
+
+	operation := "DELETE PIPELINE"
+	switch params.Action {
+	case BATCHENABLE:
+		operation = "ENABLE PIPELINE"
+	case BATCHDISABLE:
+		operation = "DISABLE PIPELINE"
+	}
+
+	for _, pipeline := range pipelines {
+		if params.Action != BATCHDELETE {
+			pipeline.Status = target(params.Action)
+			if _, exist := puts[pipeline.Id]; exist {
+				services.MarkSynced(pipeline.Id, true)
+			}
+		}
+
+		if err := services.Audit(ctx, pipeline, operation); err != nil {
+			return response.InternalServerError("创建日志失败", err)
+		}
+	}
+
+	meta := &control.KillReply{}
+	if params.Action == BATCHDISABLE && (params.CancelQueued || params.KillRunning) {
+		for _, pipeline := range pipelines {
+			reply, err := control.KillAll(&control.KillRequest{PipelineId: pipeline.Id, Running: params.KillRunning, Requester: utils.GetUID(ctx)})
+			if err != nil {
+				return response.Coded(response.CODECONTROLUNAVAILABLE, response.BadGateway(fmt.Sprintf("流水线已禁用，但部分节点未能处理流水线 %s 的强杀指令", pipeline.Name), "请稍后调用 POST /api/pipeline/killer 终止正在执行的流水线", err))
+			}
+			meta.Dropped += reply.Dropped
+			meta.Killed += reply.Killed
+		}
+	}
+
+	return response.Success("批量操作成功", response.Payload{"data": pipelines, "meta": meta})
+}
+
+// 批量操作后流水线的状态
+func target(action string) int {
+	if action == BATCHENABLE {
+		return models.PIPELINEENABLED
+	}
+
+	return models.PIPELINEDISABLED
+}
+
+// 在事务中修改数据库，删除时一并删除节点和任务的绑定关系、通知设置以及历史版本
+func batch(session *xorm.Session, action string, ids []string) error {
+	if action != BATCHDELETE {
+		_, err := session.In("id", ids).Cols("status").Update(&models.Pipeline{Status: target(action)})
+		return err
+	}
+
+	for _, relation := range []interface{}{&models.PipelineNodePivot{}, &models.PipelineTaskPivot{}, &models.PipelineNotification{}, &models.PipelineVersion{}} {
+		if _, err := session.Where(builder.In("pipeline_id", ids)).Delete(relation); err != nil {
+			return err
+		}
+	}
+
+	_, err := session.In("id", ids).Delete(&models.Pipeline{})
+	return err
+}
@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"fmt"
+	"github.com/betterde/ects/internal/request"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/service"
+	"github.com/betterde/ects/services"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"time"
+)
+
+// 模拟修改绑定的节点，可以直接指定节点，也可以按照节点能力选择节点
+type BindingPreviewRequest struct {
+	NodesId  []string          `json:"nodes_id" validate:"omitempty,dive,uuid4"`
+	Selector map[string]string `json:"selector" validate:"omitempty,max=20,dive,keys,min=1,max=64,endkeys,max=64"`
+	Count    int               `json:"count" validate:"min=0,max=50"`
+}
+
+// 预览修改绑定节点的影响，包括变更后的节点、移动的执行和容量冲突，不会修改绑定关系
+func (instance *Controller) PreviewNodes(id string, ctx iris.Context) mvc.Response {
+	params := BindingPreviewRequest{}
+	if resp, ok := request.Bind(ctx, "pipeline", &params); !ok {
+		return resp
+	}
+
+	if params.NodesId == nil && len(params.Selector) == 0 {
+		return response.ValidationError("请指定节点或者节点选择条件")
+	}
+
+	pipeline, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	nodesId := params.NodesId
+	if len(params.Selector) > 0 {
+		nodes, err := services.SelectNodes(params.Selector)
+		if err != nil {
+			return response.InternalServerError("查询节点失败", err)
+		}
+
+		nodesId = make([]string, 0, len(nodes))
+		for _, node := range nodes {
+			nodesId = append(nodesId, node.Id)
+		}
+	}
+
+	count := params.Count
+	if count == 0 {
+		count = 5
+	}
+
+	zone := pipeline.Timezone
+	if zone == "" {
+		zone = services.Timezones([]string{id})[id]
+	}
+	if zone == "" {
+		zone = service.Runtime.Timezone
+	}
+
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		return response.InternalServerError(fmt.Sprintf("加载时区 %s 失败", zone), err)
+	}
+
+	preview, err := services.PreviewBinding(pipeline, nodesId, location, count)
+	if err != nil {
+		return response.InternalServerError("预览绑定变更失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{"data": preview})
+}
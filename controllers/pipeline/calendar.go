@@ -0,0 +1,35 @@
+package pipeline
+
+import (
+	"fmt"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"time"
+)
+
+// 将流水线接下来 days 天的计划执行导出为 iCalendar 日历
+func (instance *Controller) Calendar(id string, ctx iris.Context) mvc.Response {
+	pipeline, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	days := ctx.URLParamIntDefault("days", services.CALENDARDAYS)
+	if days < 1 || days > services.CALENDARMAXDAYS {
+		return response.ValidationError(fmt.Sprintf("导出天数须在 1 到 %d 之间", services.CALENDARMAXDAYS))
+	}
+
+	calendar, err := services.Calendar(pipeline.Name, []models.Pipeline{*pipeline}, time.Now(), days)
+	if err != nil {
+		return response.InternalServerError("生成日历失败", err)
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="pipeline-%s.ics"`, pipeline.Id))
+	return mvc.Response{
+		ContentType: "text/calendar; charset=utf-8",
+		Content:     calendar,
+	}
+}
@@ -0,0 +1,36 @@
+package pipeline
+
+import (
+	"fmt"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/services"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"time"
+)
+
+// 预测流水线接下来 hours 小时内在绑定节点上与其他流水线同时执行超过节点容量的时间段
+func (instance *Controller) Contention(id string, ctx iris.Context) mvc.Response {
+	pipeline, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	hours := ctx.URLParamIntDefault("hours", services.CONTENTIONHOURS)
+	if hours < 1 || hours > services.CONTENTIONMAXHOURS {
+		return response.ValidationError(fmt.Sprintf("检查范围须在 1 到 %d 小时之间", services.CONTENTIONMAXHOURS))
+	}
+
+	visible, err := authority.Visible(utils.GetUID(ctx))
+	if err != nil {
+		return response.InternalServerError("获取用户信息失败", err)
+	}
+
+	contentions, err := services.Contentions(visible, pipeline.Id, time.Now(), hours)
+	if err != nil {
+		return response.InternalServerError("预测节点争用失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{"data": contentions})
+}
@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"github.com/betterde/ects/internal/openapi"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+)
+
+// 接口说明，用于生成 OpenAPI 文档
+var Operations = []openapi.Operation{
+	{Method: "GET", Path: "", Summary: "获取流水线列表", Paged: true, Result: []models.Pipeline{}, Query: []openapi.Parameter{
+		{Name: "scene", Description: "table 分页查询，selector 返回全部流水线"},
+		{Name: "search", Description: "按照ID或者名称搜索"},
+	}},
+	{Method: "POST", Path: "", Summary: "创建流水线", Body: models.Pipeline{}, Result: models.Pipeline{}},
+	{Method: "PUT", Path: "/{id}", Summary: "更新流水线", Body: models.Pipeline{}, Result: models.Pipeline{}},
+	{Method: "POST", Path: "/{id}/clone", Summary: "复制流水线及其步骤，不复制绑定的节点", Body: CloneRequest{}, Result: models.Pipeline{}},
+	{Method: "DELETE", Path: "/{id}", Summary: "删除流水线"},
+	{Method: "PATCH", Path: "/{id}", Summary: "同步流水线数据到 ETCD"},
+	{Method: "PATCH", Path: "/{id}/enabled", Summary: "启用或者禁用流水线", Body: EnabledRequest{}},
+	{Method: "PATCH", Path: "/{id}/status", Summary: "按照状态值启用或者禁用流水线", Body: StatusRequest{}},
+	{Method: "POST", Path: "/batch", Summary: "批量启用、禁用或者删除流水线", Body: BatchRequest{}, Result: []models.Pipeline{}},
+	{Method: "POST", Path: "/{id}/run", Summary: "手动执行流水线", Body: RunRequest{}},
+	{Method: "POST", Path: "/{id}/webhook", Summary: "由外部系统的 Webhook 触发执行，请求体不做解析", Query: []openapi.Parameter{
+		{Name: "params.NAME", Description: "覆盖参数 NAME 的默认值"},
+	}},
+	{Method: "POST", Path: "/{id}/fanout", Summary: "使用多组参数扇出执行流水线", Body: FanoutRequest{}, Result: models.RunGroup{}},
+	{Method: "POST", Path: "/{id}/backfill", Summary: "补跑一段时间内的计划执行", Body: BackfillRequest{}, Result: models.RunGroup{}},
+	{Method: "GET", Path: "/{id}/groups", Summary: "获取流水线的执行组", Paged: true, Result: []models.RunGroup{}},
+	{Method: "POST", Path: "/{id}/groups/{gid}/cancel", Summary: "取消整个执行组", Result: models.RunGroup{}},
+	{Method: "GET", Path: "/{id}/parameters", Summary: "获取流水线声明的参数和最近一次执行使用的值", Result: ParametersReply{}},
+	{Method: "POST", Path: "/killer", Summary: "终止正在执行的流水线", Body: KillPipelineRequest{}},
+	{Method: "GET", Path: "/description", Summary: "获取定时器表达式的可读描述", Query: []openapi.Parameter{
+		{Name: "spec", Description: "定时器表达式", Required: true},
+		{Name: "locale", Description: "描述使用的语言"},
+		{Name: "timezone", Description: "IANA 时区名称"},
+	}},
+	{Method: "GET", Path: "/preview", Summary: "校验定时器表达式并预览接下来的触发时间", Query: []openapi.Parameter{
+		{Name: "spec", Description: "定时器表达式", Required: true},
+		{Name: "count", Type: "integer", Description: "预览次数"},
+		{Name: "timezone", Description: "IANA 时区名称"},
+		{Name: "dst_policy", Description: "夏令时策略：skip、adjust 或 twice"},
+		{Name: "pipeline_id", Description: "未指定时区或夏令时策略时使用该流水线的设置"},
+	}},
+	{Method: "GET", Path: "/nodes", Summary: "获取流水线绑定的节点", Query: []openapi.Parameter{{Name: "pipeline_id", Required: true}}},
+	{Method: "POST", Path: "/nodes", Summary: "修改流水线绑定的节点", Body: BindNodeRequest{}},
+	{Method: "POST", Path: "/{id}/nodes/preview", Summary: "预览修改绑定节点的影响", Body: BindingPreviewRequest{}},
+	{Method: "GET", Path: "/tasks", Summary: "获取流水线的步骤", Query: []openapi.Parameter{{Name: "pipeline_id", Required: true}}},
+	{Method: "POST", Path: "/task", Summary: "为流水线添加步骤", Body: models.PipelineTaskPivot{}},
+	{Method: "PUT", Path: "/task/{id}", Summary: "更新步骤", Body: models.PipelineTaskPivot{}},
+	{Method: "DELETE", Path: "/task/{id}", Summary: "从流水线解绑任务"},
+	{Method: "PUT", Path: "/steps", Summary: "调整步骤顺序", Body: PutStepsRequest{}},
+	{Method: "POST", Path: "/{id}/tasks/batch", Summary: "批量创建任务和步骤", Body: BatchTasksRequest{}},
+	{Method: "GET", Path: "/{id}/notifications", Summary: "获取流水线的通知规则", Result: []models.PipelineNotification{}},
+	{Method: "POST", Path: "/{id}/notifications", Summary: "添加通知规则", Body: models.PipelineNotification{}},
+	{Method: "PUT", Path: "/{id}/notifications/{nid}", Summary: "更新通知规则", Body: models.PipelineNotification{}},
+	{Method: "DELETE", Path: "/{id}/notifications/{nid}", Summary: "删除通知规则"},
+	{Method: "GET", Path: "/{id}/versions", Summary: "获取流水线的历史版本", Paged: true, Result: []models.PipelineVersion{}},
+	{Method: "GET", Path: "/{id}/versions/diff", Summary: "比较两个版本的流水线定义", Result: []services.VersionChange{}, Query: []openapi.Parameter{
+		{Name: "from", Type: "integer", Description: "比较的起始版本", Required: true},
+		{Name: "to", Type: "integer", Description: "比较的目标版本，默认为最新版本"},
+	}},
+	{Method: "GET", Path: "/{id}/versions/{version}", Summary: "获取指定版本的流水线定义", Result: models.PipelineVersion{}},
+	{Method: "POST", Path: "/{id}/versions/{version}/rollback", Summary: "回滚到指定版本并重新下发到节点", Result: models.Pipeline{}},
+	{Method: "GET", Path: "/{id}/export", Summary: "导出流水线为 YAML 文档", Produces: "application/x-yaml"},
+	{Method: "POST", Path: "/import", Summary: "从 YAML 文档导入流水线，请求体为导出的文档", Result: models.Pipeline{}, Query: []openapi.Parameter{
+		{Name: "team_id", Description: "所属团队"},
+		{Name: "conflict", Description: "重名时的处理方式，fail 或者 rename"},
+	}},
+	{Method: "GET", Path: "/{id}/calendar", Summary: "导出接下来的计划执行为 iCalendar 日历", Produces: "text/calendar", Query: []openapi.Parameter{
+		{Name: "days", Type: "integer", Description: "导出的天数"},
+	}},
+	{Method: "GET", Path: "/{id}/contention", Summary: "预测流水线在绑定节点上超过节点容量的同时执行", Result: []services.Contention{}, Query: []openapi.Parameter{
+		{Name: "hours", Type: "integer", Description: "检查接下来的小时数"},
+	}},
+}
@@ -0,0 +1,271 @@
+package pipeline
+
+import (
+	"fmt"
+	"github.com/betterde/ects/internal/control"
+	"github.com/betterde/ects/internal/request"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/go-xorm/builder"
+	"github.com/gorhill/cronexpr"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"github.com/satori/go.uuid"
+	"log"
+	"strconv"
+	"time"
+)
+
+type (
+	// 使用多组参数各执行一次流水线
+	FanoutRequest struct {
+		Parameters []models.Variables `json:"parameters" validate:"required,min=1,max=500,dive,dive,max=4096"`
+		Tags       models.Tags        `json:"tags" validate:"max=20,dive,keys,min=1,max=64,endkeys,max=255"`
+	}
+	// 按照定时器补跑 [from, to] 内的计划执行
+	BackfillRequest struct {
+		From utils.Time  `json:"from"`
+		To   utils.Time  `json:"to"`
+		Tags models.Tags `json:"tags" validate:"max=20,dive,keys,min=1,max=64,endkeys,max=255"`
+	}
+)
+
+// 使用多组参数扇出执行流水线，所有执行归入同一个执行组
+func (instance *Controller) Fanout(id string, ctx iris.Context) mvc.Response {
+	params := FanoutRequest{}
+	if resp, ok := request.Bind(ctx, "pipeline", &params); !ok {
+		return resp
+	}
+
+	pipeline, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	triggers := make([]*models.Trigger, 0, len(params.Parameters))
+	for index, values := range params.Parameters {
+		parameters, err := pipeline.Parameters.Resolve(values)
+		if err != nil {
+			return response.ValidationError(fmt.Sprintf("第 %d 组参数：%s", index+1, err.Error()))
+		}
+
+		triggers = append(triggers, &models.Trigger{
+			Source:     models.TRIGGERFANOUT,
+			Tags:       params.Tags,
+			Parameters: parameters,
+		})
+	}
+
+	return dispatchGroup(ctx, pipeline, models.GROUPFANOUT, triggers)
+}
+
+// 补跑一段时间内错过的计划执行，所有执行归入同一个执行组
+func (instance *Controller) Backfill(id string, ctx iris.Context) mvc.Response {
+	params := BackfillRequest{}
+	if resp, ok := request.Bind(ctx, "pipeline", &params); !ok {
+		return resp
+	}
+
+	from, to := time.Time(params.From), time.Time(params.To)
+	if from.IsZero() || to.IsZero() || !from.Before(to) {
+		return response.ValidationError("请填写补跑的开始和结束时间，开始时间须早于结束时间")
+	}
+
+	if to.After(time.Now()) {
+		return response.ValidationError("补跑的结束时间不能晚于当前时间")
+	}
+
+	pipeline, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	expression, err := cronexpr.Parse(pipeline.Spec)
+	if err != nil {
+		return response.ValidationError(fmt.Sprintf("流水线的定时器表达式无效：%s", err.Error()))
+	}
+	pipeline.Expression = expression
+	pipeline.Location = pipeline.LoadLocation()
+
+	defaults, err := pipeline.Parameters.Resolve(nil)
+	if err != nil {
+		return response.ValidationError(err.Error())
+	}
+
+	triggers := make([]*models.Trigger, 0)
+	for fire := pipeline.Next(from.Add(-time.Second)); !fire.IsZero() && !fire.After(to); fire = pipeline.Next(fire) {
+		if len(triggers) == models.GROUPMAXRUNS {
+			return response.ValidationError(fmt.Sprintf("补跑的计划执行超过 %d 次，请缩小时间范围", models.GROUPMAXRUNS))
+		}
+
+		triggers = append(triggers, &models.Trigger{
+			Source:     models.TRIGGERBACKFILL,
+			Tags:       models.Tags{"planned": strconv.FormatInt(fire.Unix(), 10)}.Merge(params.Tags),
+			Parameters: defaults,
+		})
+	}
+
+	if len(triggers) == 0 {
+		return response.ValidationError("该时间范围内没有计划执行")
+	}
+
+	return dispatchGroup(ctx, pipeline, models.GROUPBACKFILL, triggers)
+}
+
+// 获取流水线的执行组，未结束的执行组返回实时的统计
+func (instance *Controller) Groups(id string, ctx iris.Context) mvc.Response {
+	if _, resp, ok := owned(ctx, id); !ok {
+		return resp
+	}
+
+	page, limit, start := utils.Pagination(ctx)
+	groups := make([]*models.RunGroup, 0)
+	total, err := models.Engine.Where(builder.Eq{"pipeline_id": id}).Limit(limit, start).Desc("created_at").FindAndCount(&groups)
+	if err != nil {
+		return response.InternalServerError("查询执行组失败", err)
+	}
+
+	for _, group := range groups {
+		if group.FinishWith.IsZero() {
+			if err := group.Tally(); err != nil {
+				return response.InternalServerError("统计执行组失败", err)
+			}
+		}
+	}
+
+	return response.Success("请求成功", response.Payload{
+		"data": groups,
+		"meta": response.NewMeta(ctx, page, limit, total),
+	})
+}
+
+// 取消整个执行组，丢弃节点上等待执行的指令并终止正在执行的流水线
+func (instance *Controller) CancelGroup(id, gid string, ctx iris.Context) mvc.Response {
+	pipeline, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	group := &models.RunGroup{}
+	exist, err := models.Engine.Where(builder.Eq{"id": gid, "pipeline_id": pipeline.Id}).Get(group)
+	if err != nil {
+		return response.InternalServerError("查询执行组失败", err)
+	}
+
+	if !exist {
+		return response.NotFound("执行组不存在")
+	}
+
+	if !group.FinishWith.IsZero() {
+		return response.Send(iris.StatusConflict, "执行组已经结束", make(map[string]interface{}))
+	}
+
+	if _, err := models.Engine.Id(group.Id).Where(builder.IsNull{"finish_with"}).Cols("status").Update(&models.RunGroup{Status: models.GROUPCANCELLED}); err != nil {
+		return response.InternalServerError("取消执行组失败", err)
+	}
+	group.Status = models.GROUPCANCELLED
+
+	reply, err := control.KillAll(&control.KillRequest{PipelineId: pipeline.Id, Running: true, GroupId: group.Id, Requester: utils.GetUID(ctx)})
+
+	if err := services.Audit(ctx, pipeline, "CANCEL RUN GROUP"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	if err != nil {
+		return response.Coded(response.CODECONTROLUNAVAILABLE, response.BadGateway("执行组已取消，但部分节点未能处理强杀指令", "请稍后重试", err))
+	}
+
+	return response.Success("执行组已取消", response.Payload{"data": group, "meta": reply})
+}
+
+// 创建执行组并将执行轮流下发到绑定的在线节点，下发失败的执行不计入执行组
+func dispatchGroup(ctx iris.Context, pipeline *models.Pipeline, kind string, triggers []*models.Trigger) mvc.Response {
+	if _, err := pipeline.Build(); err != nil {
+		return response.InternalServerError("获取流水线相关信息失败", err)
+	}
+
+	if len(pipeline.Steps) == 0 {
+		return response.Send(400, "该流水线未关联任何任务", make(map[string]interface{}))
+	}
+
+	if len(pipeline.Nodes) == 0 {
+		return response.Send(400, "该流水线未关联任何节点", make(map[string]interface{}))
+	}
+
+	nodes := make([]models.Node, 0)
+	if err := models.Engine.Where(builder.In("id", pipeline.Nodes).And(builder.Eq{"status": models.ONLINE})).Find(&nodes); err != nil {
+		return response.InternalServerError("查询节点信息失败", err)
+	}
+
+	if len(nodes) == 0 {
+		return response.Coded(response.CODENODEOFFLINE, response.Send(400, "该流水线绑定的节点均不在线", make(map[string]interface{})))
+	}
+
+	if _, err := services.CheckBudget(pipeline, false); err != nil {
+		return response.Error("查询项目预算失败", err)
+	}
+
+	uid := utils.GetUID(ctx)
+	runGroup := &models.RunGroup{
+		Id:         uuid.NewV4().String(),
+		PipelineId: pipeline.Id,
+		Kind:       kind,
+		UserId:     uid,
+		Status:     models.GROUPRUNNING,
+		Total:      len(triggers),
+	}
+
+	if err := runGroup.Store(); err != nil {
+		return response.InternalServerError("创建执行组失败", err)
+	}
+
+	dispatched := make([]*models.Trigger, 0, len(triggers))
+	var failed error
+	for index, trigger := range triggers {
+		trigger.Id = models.NewRunId()
+		trigger.Pipeline = pipeline
+		trigger.GroupId = runGroup.Id
+		trigger.Tags = models.Tags{"user": uid, "group": runGroup.Id}.Merge(trigger.Tags)
+
+		node := &nodes[index%len(nodes)]
+		if err := control.Trigger(node, trigger); err != nil {
+			failed = fmt.Errorf("节点 %s：%s", node.Name, err)
+			continue
+		}
+
+		dispatched = append(dispatched, trigger)
+	}
+
+	// 统计时只等待下发成功的执行
+	runGroup.Total = len(dispatched)
+	if len(dispatched) == 0 {
+		runGroup.Status = models.GROUPFAILED
+		runGroup.FinishWith = utils.Time(time.Now())
+	}
+
+	if _, err := models.Engine.Id(runGroup.Id).Cols("total", "status", "finish_with").Update(runGroup); err != nil {
+		log.Println(err)
+	}
+
+	if len(dispatched) == 0 {
+		return response.Coded(response.CODECONTROLUNAVAILABLE, response.BadGateway("下发执行指令失败", "绑定节点的控制服务不可用，请稍后重试", failed))
+	}
+
+	operation := "FANOUT PIPELINE"
+	if kind == models.GROUPBACKFILL {
+		operation = "BACKFILL PIPELINE"
+	}
+
+	if err := services.Audit(ctx, pipeline, operation); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	meta := map[string]interface{}{"dispatched": len(dispatched), "failed": len(triggers) - len(dispatched)}
+	if failed != nil {
+		meta["error"] = failed.Error()
+	}
+
+	return response.Success("执行指令已下发", response.Payload{"data": runGroup, "meta": meta})
+}
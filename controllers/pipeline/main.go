@@ -1,24 +1,27 @@
 package pipeline
 
 import (
-	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/control"
+	"github.com/betterde/ects/internal/cron"
 	"github.com/betterde/ects/internal/discover"
-	"github.com/betterde/ects/internal/message"
+	"github.com/betterde/ects/internal/request"
 	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/service"
 	"github.com/betterde/ects/internal/utils"
 	"github.com/betterde/ects/models"
 	"github.com/betterde/ects/services"
-	"github.com/coreos/etcd/clientv3"
 	"github.com/go-xorm/builder"
+	"github.com/gorhill/cronexpr"
 	"github.com/kataras/iris"
 	"github.com/kataras/iris/mvc"
 	"github.com/satori/go.uuid"
 	"gopkg.in/go-playground/validator.v9"
 	"log"
 	"sort"
+	"strings"
+	"time"
 )
 
 type (
@@ -31,18 +34,100 @@ type (
 	}
 	KillPipelineRequest struct {
 		PipelineId string `json:"pipeline_id" validate:"required,uuid4"`
+		RunId      string `json:"run_id" validate:"omitempty,uuid4"`                 // 不为空时只终止该次执行
+		Signal     string `json:"signal" validate:"omitempty,oneof=SIGTERM SIGKILL"` // 为空时使用 SIGTERM
+		Grace      int    `json:"grace" validate:"min=0,max=3600"`                   // 发送 SIGTERM 后等待进程退出的秒数，0 使用节点配置的宽限期
 	}
 	PutStepsRequest struct {
 		PipelineId string `json:"pipeline_id" validate:"required,uuid4"`
 		Origin     int    `json:"origin" validate:"numeric"`
 		Current    int    `json:"current" validate:"numeric"`
 	}
+	// 批量创建的步骤，依赖关系使用步骤在请求中的序号表示，只能依赖排在前面的步骤
+	BatchTask struct {
+		Task        models.Task    `json:"task" validate:"required"`
+		Timeout     int            `json:"timeout" validate:"numeric,min=-1"`
+		Interval    int            `json:"interval" validate:"numeric,min=-1,max=3600"`
+		Retries     int            `json:"retries" validate:"numeric,min=-1,max=10"`
+		Directory   string         `json:"directory" validate:"omitempty"`
+		User        string         `json:"user" validate:"omitempty"`
+		Environment string         `json:"environment" validate:"omitempty"`
+		Dependence  string         `json:"dependence" validate:"omitempty,oneof=strong weak"`
+		Pipe        int            `json:"pipe" validate:"numeric"`
+		Condition   string         `json:"condition" validate:"omitempty,oneof=on_success on_failure always"`
+		Depends     []int          `json:"depends" validate:"omitempty"`
+		LogLevel    string         `json:"log_level" validate:"omitempty,oneof=full quiet"`
+		TailLines   int            `json:"tail_lines" validate:"min=0,max=1000"`
+		Inherit     string         `json:"inherit" validate:"omitempty,oneof=all allowlist none"`
+		Allowlist   []string       `json:"allowlist" validate:"omitempty,max=100,dive,min=1,max=128"`
+		Outputs     models.Outputs `json:"outputs" validate:"-"`
+	}
+	// 复制流水线时指定的名称，为空时使用 Copy of 加原来的名称
+	CloneRequest struct {
+		Name string `json:"name" validate:"omitempty,max=255"`
+	}
+	// 手动执行时附带的触发来源信息，例如调用方传入的 Webhook 发送方、Git 提交，以及覆盖默认值的参数
+	RunRequest struct {
+		Tags       models.Tags      `json:"tags" validate:"max=20,dive,keys,min=1,max=64,endkeys,max=255"`
+		Parameters models.Variables `json:"parameters" validate:"omitempty,dive,max=4096"`
+	}
+	BatchTasksRequest struct {
+		Tasks []BatchTask `json:"tasks" validate:"required,min=1,dive"`
+	}
+	// 启用或禁用流水线，禁用时可以同时撤回等待执行的指令、终止正在执行的流水线
+	EnabledRequest struct {
+		Enabled      *bool `json:"enabled" validate:"required"`
+		CancelQueued bool  `json:"cancel_queued"`
+		KillRunning  bool  `json:"kill_running"`
+	}
+	// 与 EnabledRequest 相同，使用流水线的状态值表示是否启用
+	StatusRequest struct {
+		Status       *int `json:"status" validate:"required,oneof=0 1"`
+		CancelQueued bool `json:"cancel_queued"`
+		KillRunning  bool `json:"kill_running"`
+	}
+)
+
+const (
+	PREVIEWMAXCOUNT    = 50        // 最多预览的触发次数
+	WEBHOOKPARAMPREFIX = "params." // Webhook 查询参数中覆盖流水线参数的前缀
 )
 
 var (
-	validate = validator.New()
+	validate  = validator.New()
+	authority = services.NewPipelineService()
+
+	// 代码托管平台在 Webhook 中携带事件类型的请求头
+	webhookEvents = []string{"X-GitHub-Event", "X-Gitlab-Event", "X-Gitea-Event"}
 )
 
+func (instance *Controller) BeforeActivation(request mvc.BeforeActivation) {
+	request.Handle("GET", "/{id:string}/export", "Export")
+	request.Handle("POST", "/import", "Import")
+	request.Handle("POST", "/{id:string}/clone", "Clone")
+	request.Handle("GET", "/{id:string}/calendar", "Calendar")
+	request.Handle("GET", "/{id:string}/contention", "Contention")
+	request.Handle("GET", "/{id:string}/parameters", "Parameters")
+	request.Handle("POST", "/{id:string}/run", "Run")
+	request.Handle("POST", "/{id:string}/webhook", "Webhook")
+	request.Handle("POST", "/{id:string}/fanout", "Fanout")
+	request.Handle("POST", "/{id:string}/backfill", "Backfill")
+	request.Handle("GET", "/{id:string}/groups", "Groups")
+	request.Handle("POST", "/{id:string}/groups/{gid:string}/cancel", "CancelGroup")
+	request.Handle("POST", "/{id:string}/tasks/batch", "BatchTasks")
+	request.Handle("PATCH", "/{id:string}/enabled", "PatchEnabled")
+	request.Handle("PATCH", "/{id:string}/status", "PatchStatus")
+	request.Handle("POST", "/{id:string}/nodes/preview", "PreviewNodes")
+	request.Handle("GET", "/{id:string}/notifications", "Notifications")
+	request.Handle("POST", "/{id:string}/notifications", "AddNotification")
+	request.Handle("PUT", "/{id:string}/notifications/{nid:string}", "UpdateNotification")
+	request.Handle("DELETE", "/{id:string}/notifications/{nid:string}", "RemoveNotification")
+	request.Handle("GET", "/{id:string}/versions", "Versions")
+	request.Handle("GET", "/{id:string}/versions/diff", "DiffVersions")
+	request.Handle("GET", "/{id:string}/versions/{version:int}", "Version")
+	request.Handle("POST", "/{id:string}/versions/{version:int}/rollback", "RollbackVersion")
+}
+
 // 获取流水线列表
 func (instance *Controller) Get(ctx iris.Context) mvc.Response {
 	var (
@@ -52,35 +137,41 @@ func (instance *Controller) Get(ctx iris.Context) mvc.Response {
 	scene := ctx.URLParamDefault("scene", "table")
 	pipelines := make([]models.Pipeline, 0)
 
+	// 只显示当前用户可见的流水线
+	visible, err := authority.Visible(utils.GetUID(ctx))
+	if err != nil {
+		return response.InternalServerError("获取用户信息失败", err)
+	}
+
 	switch scene {
 	case "table":
 		search := ctx.URLParamDefault("search", "")
 		page, limit, start := utils.Pagination(ctx)
 
 		if search != "" {
-			total, err = models.Engine.Where(builder.Eq{"id": search}.Or(builder.Like{"name", search})).Limit(limit, start).Desc("created_at").FindAndCount(&pipelines)
+			total, err = models.Engine.Where(visible).And(builder.Eq{"id": search}.Or(builder.Like{"name", search})).Limit(limit, start).Desc("created_at").FindAndCount(&pipelines)
 		} else {
-			total, err = models.Engine.Limit(limit, start).Desc("created_at").FindAndCount(&pipelines)
+			total, err = models.Engine.Where(visible).Limit(limit, start).Desc("created_at").FindAndCount(&pipelines)
 		}
 
 		if err != nil {
 			return response.InternalServerError("Failed to query pipelines list", err)
 		}
 
+		describe(ctx, references(pipelines)...)
+
 		return response.Success("请求成功", response.Payload{
 			"data": pipelines,
-			"meta": &response.Meta{
-				Limit: limit,
-				Page:  page,
-				Total: int(total),
-			},
+			"meta": response.NewMeta(ctx, page, limit, total),
 		})
 	case "selector":
 		// 当数据使用场景为选择器时，查询所有数据
-		if err := models.Engine.Find(&pipelines); err != nil {
+		if err := models.Engine.Where(visible).Find(&pipelines); err != nil {
 			return response.InternalServerError("获取流水线列表失败", err)
 		}
 
+		describe(ctx, references(pipelines)...)
+
 		return response.Success("请求成功", response.Payload{"data": pipelines})
 	}
 
@@ -93,23 +184,52 @@ func (instance *Controller) Post(ctx iris.Context) mvc.Response {
 		Id: uuid.NewV4().String(),
 	}
 
-	if err := ctx.ReadJSON(&pipeline); err != nil {
-		return response.InternalServerError("参数解析失败", err)
+	if resp, ok := request.Bind(ctx, "pipeline", &pipeline); !ok {
+		return resp
+	}
+
+	if resp, ok := checkSpec(pipeline.Spec); !ok {
+		return resp
 	}
 
-	if err := validate.Struct(pipeline); err != nil {
-		validationErrors := err.(validator.ValidationErrors)
-		return response.ValidationError(message.Get("pipeline", validationErrors))
+	if resp, ok := checkTimezone(pipeline.Timezone); !ok {
+		return resp
 	}
 
+	if err := pipeline.Variables.Check(); err != nil {
+		return response.ValidationError(err.Error())
+	}
+
+	if err := pipeline.Parameters.Check(); err != nil {
+		return response.ValidationError(err.Error())
+	}
+
+	if resp, ok := accessible(ctx, pipeline.TeamId); !ok {
+		return resp
+	}
+
+	// 新建的流水线尚未下发到节点
+	pipeline.Synced = models.SYNCPENDING
+
+	if pipeline.Policy == "" {
+		pipeline.Policy = models.POLICYALL
+	}
+	concurrency(&pipeline)
+
 	if err := pipeline.Store(); err != nil {
 		return response.InternalServerError("Failed to create pipeline", err)
 	}
 
-	if err := models.CreateLog(&pipeline, utils.GetUID(ctx), "CREATE PIPELINE"); err != nil {
+	if _, err := services.RecordVersion(ctx, pipeline.Id, "CREATE PIPELINE"); err != nil {
+		return response.InternalServerError("保存流水线版本失败", err)
+	}
+
+	if err := services.Audit(ctx, &pipeline, "CREATE PIPELINE"); err != nil {
 		return response.InternalServerError("Failed to create log", err)
 	}
 
+	describe(ctx, &pipeline)
+
 	return response.Success("创建成功", response.Payload{"data": pipeline})
 }
 
@@ -117,38 +237,145 @@ func (instance *Controller) Post(ctx iris.Context) mvc.Response {
 func (instance *Controller) PutBy(id string, ctx iris.Context) mvc.Response {
 	pipeline := models.Pipeline{}
 
-	if err := ctx.ReadJSON(&pipeline); err != nil {
-		return response.InternalServerError("参数解析失败", err)
+	if resp, ok := request.Bind(ctx, "pipeline", &pipeline); !ok {
+		return resp
 	}
 
-	if err := validate.Struct(pipeline); err != nil {
-		validationErrors := err.(validator.ValidationErrors)
-		return response.ValidationError(message.Get("pipeline", validationErrors))
+	if resp, ok := checkSpec(pipeline.Spec); !ok {
+		return resp
 	}
+
+	if resp, ok := checkTimezone(pipeline.Timezone); !ok {
+		return resp
+	}
+
+	if err := pipeline.Variables.Check(); err != nil {
+		return response.ValidationError(err.Error())
+	}
+
+	if err := pipeline.Parameters.Check(); err != nil {
+		return response.ValidationError(err.Error())
+	}
+
+	// 既要能访问流水线当前所属的团队，也要能访问修改后的团队
+	if _, resp, ok := owned(ctx, id); !ok {
+		return resp
+	}
+
+	if resp, ok := accessible(ctx, pipeline.TeamId); !ok {
+		return resp
+	}
+
 	pipeline.Id = id
+	if pipeline.Policy == "" {
+		pipeline.Policy = models.POLICYALL
+	}
+	concurrency(&pipeline)
 	err := pipeline.Update()
 	if err != nil {
 		return response.InternalServerError("Failed to update pipeline", err)
 	}
 
-	key := fmt.Sprintf("%s/%s", config.Conf.Etcd.Pipeline, pipeline.Id)
+	if _, err := services.RecordVersion(ctx, pipeline.Id, "UPDATE PIPELINE"); err != nil {
+		return response.InternalServerError("保存流水线版本失败", err)
+	}
 
-	bytes, err := json.Marshal(&pipeline)
-	if err != nil {
-		log.Println(err)
+	if err := services.Audit(ctx, &pipeline, "UPDATE PIPELINE"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
 	}
 
-	if _, err := discover.Client.Put(context.TODO(), key, string(bytes)); err != nil {
-		return response.InternalServerError("Failed to delete pipeline", err)
+	// 同步完整的流水线数据，包含绑定的节点和步骤
+	if err := services.SyncPipeline(&pipeline); err != nil {
+		return response.BadGateway("流水线已保存，但同步到节点失败", services.SyncHint(pipeline.Id), err)
 	}
 
+	describe(ctx, &pipeline)
+
 	return response.Success("更新成功", response.Payload{"data": pipeline})
 }
 
+// 将定时器表达式转换为请求者语言的描述
+func (instance *Controller) GetDescription(ctx iris.Context) mvc.Response {
+	spec := ctx.URLParamDefault("spec", "")
+	if _, err := cronexpr.Parse(spec); err != nil {
+		return response.ValidationError("定时器表达式有误")
+	}
+
+	locale := ctx.URLParamDefault("locale", ctx.GetHeader("Accept-Language"))
+
+	return response.Success("请求成功", response.Payload{
+		"data": map[string]string{
+			"spec":        spec,
+			"description": cron.Describe(spec, cron.Locale(locale), ctx.URLParamDefault("timezone", service.Runtime.Timezone)),
+		},
+	})
+}
+
+// 校验定时器表达式并预览接下来的触发时间，未指定时区时使用流水线绑定节点的时区
+func (instance *Controller) GetPreview(ctx iris.Context) mvc.Response {
+	spec := ctx.URLParamDefault("spec", "")
+	if resp, ok := checkSpec(spec); !ok {
+		return resp
+	}
+
+	count := ctx.URLParamIntDefault("count", 5)
+	if count < 1 || count > PREVIEWMAXCOUNT {
+		return response.ValidationError(fmt.Sprintf("预览次数须在 1 到 %d 之间", PREVIEWMAXCOUNT))
+	}
+
+	zone := ctx.URLParamDefault("timezone", "")
+	policy := ctx.URLParamDefault("dst_policy", "")
+	if policy != "" && policy != models.DSTSKIP && policy != models.DSTADJUST && policy != models.DSTTWICE {
+		return response.ValidationError("夏令时策略须为 skip、adjust 或 twice")
+	}
+
+	if id := ctx.URLParamDefault("pipeline_id", ""); id != "" && (zone == "" || policy == "") {
+		pipeline, resp, ok := owned(ctx, id)
+		if !ok {
+			return resp
+		}
+
+		if policy == "" {
+			policy = pipeline.DST
+		}
+
+		if zone == "" {
+			zone = pipeline.Timezone
+			if zone == "" {
+				zone = services.Timezones([]string{id})[id]
+			}
+		}
+	}
+	if zone == "" {
+		zone = service.Runtime.Timezone
+	}
+
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		return response.ValidationError("时区有误，请使用 IANA 时区名称，例如 Asia/Shanghai")
+	}
+
+	fires := make([]string, 0, count)
+	expression := cronexpr.MustParse(spec)
+	for fire := models.NextFire(expression, time.Now(), location, policy); !fire.IsZero() && len(fires) < count; fire = models.NextFire(expression, fire, location, policy) {
+		fires = append(fires, fire.In(location).Format(time.RFC3339))
+	}
+
+	return response.Success("请求成功", response.Payload{
+		"data": map[string]interface{}{
+			"spec":       spec,
+			"timezone":   location.String(),
+			"dst_policy": policy,
+			"next":       fires,
+		},
+	})
+}
+
 // 删除流水线
 func (instance *Controller) DeleteBy(id string, ctx iris.Context) mvc.Response {
-	pipeline := models.Pipeline{
-		Id: id,
+	pipeline, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
 	}
 
 	session := models.Engine.NewSession()
@@ -173,27 +400,45 @@ func (instance *Controller) DeleteBy(id string, ctx iris.Context) mvc.Response {
 		return response.InternalServerError("解绑关联的任务失败", err)
 	}
 
+	// 删除通知设置
+	if _, err := session.Where(builder.Eq{"pipeline_id": pipeline.Id}).Delete(&models.PipelineNotification{}); err != nil {
+		if err := session.Rollback(); err != nil {
+			log.Println(err)
+		}
+		return response.InternalServerError("删除通知设置失败", err)
+	}
+
+	// 删除历史版本
+	if _, err := session.Where(builder.Eq{"pipeline_id": pipeline.Id}).Delete(&models.PipelineVersion{}); err != nil {
+		if err := session.Rollback(); err != nil {
+			log.Println(err)
+		}
+		return response.InternalServerError("删除流水线版本失败", err)
+	}
+
 	// 删除流水线
-	if _, err := session.Delete(&pipeline); err != nil {
+	if _, err := session.Id(pipeline.Id).Delete(&models.Pipeline{}); err != nil {
 		if err := session.Rollback(); err != nil {
 			log.Println(err)
 		}
 		return response.InternalServerError("从数据库中删除流水线失败", err)
 	}
 
-	key := fmt.Sprintf("%s/%s", config.Conf.Etcd.Pipeline, pipeline.Id)
-
-	if _, err := discover.Client.Delete(context.TODO(), key); err != nil {
+	if err := discover.DeletePipeline(pipeline.Id); err != nil {
 		if err := session.Rollback(); err != nil {
 			log.Println(err)
 		}
-		return response.InternalServerError("从ETCD中删除流水线失败", err)
+		return response.BadGateway("从节点移除流水线失败，流水线未删除", "请稍后重试", err)
 	}
 
 	if err := session.Commit(); err != nil {
 		return response.InternalServerError("提交事务失败", err)
 	}
 
+	if err := services.Audit(ctx, pipeline, "DELETE PIPELINE"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
 	return response.Success("删除成功", response.Payload{"data": make(map[string]interface{})})
 }
 
@@ -205,6 +450,10 @@ func (instance *Controller) GetNodes(ctx iris.Context) mvc.Response {
 		return response.ValidationError("pipeline id is required")
 	}
 
+	if _, resp, ok := owned(ctx, id); !ok {
+		return resp
+	}
+
 	relations := make([]models.PipelineNodePivot, 0)
 
 	if err := models.Engine.Where(builder.Eq{"pipeline_id": id}).Find(&relations); err != nil {
@@ -230,13 +479,13 @@ func (instance *Controller) GetNodes(ctx iris.Context) mvc.Response {
 func (instance *Controller) PostNodes(ctx iris.Context) mvc.Response {
 	params := BindNodeRequest{}
 
-	if err := ctx.ReadJSON(&params); err != nil {
-		return response.InternalServerError("参数解析失败", err)
+	if resp, ok := request.Bind(ctx, "pipeline", &params); !ok {
+		return resp
 	}
 
-	if err := validate.Struct(params); err != nil {
-		validationErrors := err.(validator.ValidationErrors)
-		return response.ValidationError(message.Get("pipeline", validationErrors))
+	pipeline, resp, ok := owned(ctx, params.PipelineId)
+	if !ok {
+		return resp
 	}
 
 	if _, err := models.Engine.Where(builder.Eq{"pipeline_id": params.PipelineId}).Delete(&models.PipelineNodePivot{}); err != nil {
@@ -257,26 +506,26 @@ func (instance *Controller) PostNodes(ctx iris.Context) mvc.Response {
 		return response.InternalServerError("Failed to bind pipeline to node", err)
 	}
 
-	pipeline := &models.Pipeline{
-		Id: params.PipelineId,
+	pipeline.Nodes = params.NodesId
+	if _, err := services.RecordVersion(ctx, pipeline.Id, "BIND NODES"); err != nil {
+		return response.InternalServerError("保存流水线版本失败", err)
 	}
 
-	if _, err := models.Engine.Get(pipeline); err != nil {
-		return response.InternalServerError("Failed to bind pipeline to node", err)
+	if err := services.Audit(ctx, pipeline, "BIND NODES"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
 	}
 
-	pipeline.Nodes = params.NodesId
-	bytes, err := json.Marshal(pipeline)
-	if err != nil {
-		log.Println(err)
+	if err := services.SyncPipeline(pipeline); err != nil {
+		return response.BadGateway("节点已绑定，但同步到节点失败", services.SyncHint(pipeline.Id), err)
 	}
-	// Update etcd pipeline nodes
-	key := fmt.Sprintf("%s/%s", config.Conf.Etcd.Pipeline, pipeline.Id)
-	if _, err := discover.Client.Put(context.TODO(), key, string(bytes)); err != nil {
+
+	// 检查节点是否满足任务的环境依赖
+	warnings, err := services.CheckRequirements(pipeline.Id, params.NodesId)
+	if err != nil {
 		log.Println(err)
 	}
 
-	return response.Success("绑定成功", response.Payload{"data": relations})
+	return response.Success("绑定成功", response.Payload{"data": relations, "warnings": warnings})
 }
 
 // 获取流水线绑定的任务
@@ -287,6 +536,10 @@ func (instance *Controller) GetTasks(ctx iris.Context) mvc.Response {
 		return response.ValidationError("pipeline id is required")
 	}
 
+	if _, resp, ok := owned(ctx, id); !ok {
+		return resp
+	}
+
 	relations := make([]models.PipelineTaskPivot, 0)
 
 	if err := models.Engine.Where(builder.Eq{"pipeline_id": id}).Asc("step").Find(&relations); err != nil {
@@ -317,13 +570,12 @@ func (instance *Controller) GetTasks(ctx iris.Context) mvc.Response {
 func (instance *Controller) PutSteps(ctx iris.Context) mvc.Response {
 	params := PutStepsRequest{}
 
-	if err := ctx.ReadJSON(&params); err != nil {
-		return response.InternalServerError("参数解析失败", err)
+	if resp, ok := request.Bind(ctx, "pipeline", &params); !ok {
+		return resp
 	}
 
-	if err := validate.Struct(params); err != nil {
-		validationErrors := err.(validator.ValidationErrors)
-		return response.ValidationError(message.Get("pipeline", validationErrors))
+	if _, resp, ok := owned(ctx, params.PipelineId); !ok {
+		return resp
 	}
 
 	relations := make([]*models.PipelineTaskPivot, 0)
@@ -376,6 +628,17 @@ func (instance *Controller) PutSteps(ctx iris.Context) mvc.Response {
 		return response.InternalServerError("排序失败", err)
 	}
 
+	// 步骤变更后需要重新同步到节点
+	services.MarkSynced(params.PipelineId, false)
+
+	if _, err := services.RecordVersion(ctx, params.PipelineId, "REORDER STEPS"); err != nil {
+		return response.InternalServerError("保存流水线版本失败", err)
+	}
+
+	if err := services.Audit(ctx, relations[params.Origin], "REORDER STEPS"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
 	sort.Slice(relations, func(before, after int) bool {
 		return relations[before].Step < relations[after].Step
 	})
@@ -406,13 +669,40 @@ func (instance *Controller) PostTask(ctx iris.Context) mvc.Response {
 		Id: uuid.NewV4().String(),
 	}
 
-	if err := ctx.ReadJSON(&pivot); err != nil {
-		return response.InternalServerError("参数解析失败", err)
+	if resp, ok := request.Bind(ctx, "pipeline", &pivot); !ok {
+		return resp
+	}
+
+	if _, resp, ok := owned(ctx, pivot.PipelineId); !ok {
+		return resp
+	}
+
+	if pivot.Pipe == 1 && pivot.Retries > 0 {
+		return response.ValidationError("管道模式的步骤不支持重试")
+	}
+
+	if pivot.Pipe == 1 && !successOnly(pivot.Condition) {
+		return response.ValidationError("管道模式的步骤只能在前面的步骤成功时执行")
+	}
+
+	if err := checkOutputs(pivot.Pipe, pivot.Outputs); err != nil {
+		return response.ValidationError(err.Error())
 	}
 
-	if err := validate.Struct(pivot); err != nil {
-		validationErrors := err.(validator.ValidationErrors)
-		return response.ValidationError(message.Get("pipeline", validationErrors))
+	if pivot.Condition == "" {
+		pivot.Condition = models.CONDITIONSUCCESS
+	}
+
+	if pivot.LogLevel == "" {
+		pivot.LogLevel = models.LOGFULL
+	}
+
+	if pivot.Inherit == "" {
+		pivot.Inherit = models.INHERITALL
+	}
+
+	if resp, ok := checkDepends(&pivot); !ok {
+		return resp
 	}
 
 	if count, err := models.Engine.Where(builder.Eq{"pipeline_id": pivot.PipelineId}).Count(&models.PipelineTaskPivot{}); err != nil {
@@ -431,8 +721,163 @@ func (instance *Controller) PostTask(ctx iris.Context) mvc.Response {
 	}
 
 	pivot.Task = &task
+	services.MarkSynced(pivot.PipelineId, false)
+
+	if _, err := services.RecordVersion(ctx, pivot.PipelineId, "BIND TASK"); err != nil {
+		return response.InternalServerError("保存流水线版本失败", err)
+	}
+
+	if err := services.Audit(ctx, &pivot, "BIND TASK"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	// 检查已绑定的节点是否满足任务的环境依赖
+	warnings, err := services.CheckRequirements(pivot.PipelineId, nil)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return response.Success("绑定成功", response.Payload{"data": pivot, "warnings": warnings})
+}
+
+// 批量创建任务并按照顺序绑定到流水线
+func (instance *Controller) BatchTasks(id string, ctx iris.Context) mvc.Response {
+	pipeline, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	params := BatchTasksRequest{}
+	if resp, ok := request.Bind(ctx, "task", &params); !ok {
+		return resp
+	}
+
+	pivots := make([]*models.PipelineTaskPivot, 0, len(params.Tasks))
+	for index, item := range params.Tasks {
+		if item.Pipe == 1 && item.Retries > 0 {
+			return response.ValidationError(fmt.Sprintf("第 %d 个步骤为管道模式，不支持重试", index+1))
+		}
+
+		if item.Pipe == 1 && !successOnly(item.Condition) {
+			return response.ValidationError(fmt.Sprintf("第 %d 个步骤为管道模式，只能在前面的步骤成功时执行", index+1))
+		}
+
+		if err := checkOutputs(item.Pipe, item.Outputs); err != nil {
+			return response.ValidationError(fmt.Sprintf("第 %d 个步骤：%s", index+1, err))
+		}
+
+		task := item.Task
+		task.Id = uuid.NewV4().String()
+
+		pivot := &models.PipelineTaskPivot{
+			Id:          uuid.NewV4().String(),
+			PipelineId:  pipeline.Id,
+			TaskId:      task.Id,
+			Timeout:     item.Timeout,
+			Interval:    item.Interval,
+			Retries:     item.Retries,
+			Directory:   item.Directory,
+			User:        item.User,
+			Environment: item.Environment,
+			Dependence:  item.Dependence,
+			Pipe:        item.Pipe,
+			Condition:   item.Condition,
+			LogLevel:    item.LogLevel,
+			TailLines:   item.TailLines,
+			Inherit:     item.Inherit,
+			Allowlist:   item.Allowlist,
+			Outputs:     item.Outputs,
+			Task:        &task,
+		}
+
+		if pivot.Dependence == "" {
+			pivot.Dependence = models.DEPENDENCESTRONG
+		}
+
+		if pivot.Condition == "" {
+			pivot.Condition = models.CONDITIONSUCCESS
+		}
+
+		if pivot.LogLevel == "" {
+			pivot.LogLevel = models.LOGFULL
+		}
+
+		if pivot.Inherit == "" {
+			pivot.Inherit = models.INHERITALL
+		}
 
-	return response.Success("绑定成功", response.Payload{"data": pivot})
+		for _, depend := range item.Depends {
+			if depend < 0 || depend >= index {
+				return response.ValidationError(fmt.Sprintf("第 %d 个步骤只能依赖排在它前面的步骤", index+1))
+			}
+			pivot.Depends = append(pivot.Depends, pivots[depend].Id)
+		}
+
+		pivots = append(pivots, pivot)
+	}
+
+	session := models.Engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return response.InternalServerError("初始化事务失败", err)
+	}
+
+	rollback := func(reason string, err error) mvc.Response {
+		if err := session.Rollback(); err != nil {
+			log.Println(err)
+		}
+		return response.InternalServerError(reason, err)
+	}
+
+	// 锁定流水线，避免并发绑定时步骤序号重复
+	if _, err := session.ForUpdate().Id(pipeline.Id).Get(&models.Pipeline{}); err != nil {
+		return rollback("查询流水线失败", err)
+	}
+
+	count, err := session.Where(builder.Eq{"pipeline_id": pipeline.Id}).Count(&models.PipelineTaskPivot{})
+	if err != nil {
+		return rollback("查询流水线的步骤失败", err)
+	}
+
+	for index, pivot := range pivots {
+		if _, err := session.InsertOne(pivot.Task); err != nil {
+			return rollback("创建任务失败", err)
+		}
+
+		pivot.Step = int(count) + index + 1
+		if _, err := session.InsertOne(pivot); err != nil {
+			return rollback("绑定任务失败", err)
+		}
+	}
+
+	if err := session.Commit(); err != nil {
+		return response.InternalServerError("提交事务失败", err)
+	}
+
+	services.MarkSynced(pipeline.Id, false)
+
+	if _, err := services.RecordVersion(ctx, pipeline.Id, "BATCH BIND TASKS"); err != nil {
+		return response.InternalServerError("保存流水线版本失败", err)
+	}
+
+	if err := services.Audit(ctx, pipeline, "BATCH BIND TASKS"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	// 与单独创建任务一样记录任务的定义，用于校验执行内容
+	for _, pivot := range pivots {
+		if err := services.Audit(ctx, pivot.Task, "CREATE TASK"); err != nil {
+			return response.InternalServerError("创建日志失败", err)
+		}
+	}
+
+	// 检查已绑定的节点是否满足任务的环境依赖
+	warnings, err := services.CheckRequirements(pipeline.Id, nil)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return response.Success("创建成功", response.Payload{"data": pivots, "warnings": warnings})
 }
 
 // 修改绑定关系
@@ -445,18 +890,63 @@ func (instance *Controller) PutTaskBy(id string, ctx iris.Context) mvc.Response
 		Id: id,
 	}
 
-	if err := ctx.ReadJSON(&relation); err != nil {
-		return response.InternalServerError("请求参数解析失败", err)
+	if resp, ok := request.Bind(ctx, "pipeline", &relation); !ok {
+		return resp
+	}
+
+	// 检查关联关系原本所属的流水线，不允许把步骤挪到其他流水线
+	origin := models.PipelineTaskPivot{}
+	if exist, err := models.Engine.Id(id).Get(&origin); err != nil {
+		return response.InternalServerError("查询关联关系失败", err)
+	} else if !exist {
+		return response.NotFound("关联关系不存在")
+	}
+
+	if _, resp, ok := owned(ctx, origin.PipelineId); !ok {
+		return resp
+	}
+	relation.PipelineId = origin.PipelineId
+
+	if relation.Pipe == 1 && relation.Retries > 0 {
+		return response.ValidationError("管道模式的步骤不支持重试")
 	}
 
-	if err := validate.Struct(relation); err != nil {
-		validationErrors := err.(validator.ValidationErrors)
-		return response.ValidationError(message.Get("pipeline", validationErrors))
+	if relation.Pipe == 1 && !successOnly(relation.Condition) {
+		return response.ValidationError("管道模式的步骤只能在前面的步骤成功时执行")
+	}
+
+	if err := checkOutputs(relation.Pipe, relation.Outputs); err != nil {
+		return response.ValidationError(err.Error())
+	}
+
+	if relation.Condition == "" {
+		relation.Condition = models.CONDITIONSUCCESS
+	}
+
+	if relation.LogLevel == "" {
+		relation.LogLevel = models.LOGFULL
+	}
+
+	if relation.Inherit == "" {
+		relation.Inherit = models.INHERITALL
+	}
+
+	if resp, ok := checkDepends(&relation); !ok {
+		return resp
 	}
 
 	if err := relation.Update(); err != nil {
 		return response.InternalServerError("更新关联信息失败", err)
 	}
+	services.MarkSynced(relation.PipelineId, false)
+
+	if _, err := services.RecordVersion(ctx, relation.PipelineId, "UPDATE STEP"); err != nil {
+		return response.InternalServerError("保存流水线版本失败", err)
+	}
+
+	if err := services.Audit(ctx, &relation, "UPDATE STEP"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
 
 	return response.Success("更新成功", response.Payload{"data": relation})
 }
@@ -472,17 +962,49 @@ func (instance *Controller) DeleteTaskBy(id string, ctx iris.Context) mvc.Respon
 	}
 
 	// 查询数据
-	if _, err := models.Engine.Get(&relation); err != nil {
+	if exist, err := models.Engine.Get(&relation); err != nil || !exist {
 		return response.NotFound("关联关系不存在")
 	}
 
+	if _, resp, ok := owned(ctx, relation.PipelineId); !ok {
+		return resp
+	}
+
 	// 删除数据
 	if err := relation.Destroy(); err != nil {
 		return response.InternalServerError("解绑任务失败", err)
 	}
 
+	// 移除其他步骤对该步骤的依赖
+	relations := make([]*models.PipelineTaskPivot, 0)
+	if err := models.Engine.Where(builder.Eq{"pipeline_id": relation.PipelineId}).Find(&relations); err != nil {
+		return response.InternalServerError("查询关联关系失败", err)
+	}
+
+	for _, item := range relations {
+		depends := make([]string, 0)
+		for _, depend := range item.Depends {
+			if depend != relation.Id {
+				depends = append(depends, depend)
+			}
+		}
+
+		if len(depends) != len(item.Depends) {
+			item.Depends = depends
+			if err := item.Update(); err != nil {
+				return response.InternalServerError("更新关联信息失败", err)
+			}
+		}
+	}
+
+	services.MarkSynced(relation.PipelineId, false)
+
 	// 记录日志
-	if err := models.CreateLog(&relation, utils.GetUID(ctx), "UNBIND TASK"); err != nil {
+	if _, err := services.RecordVersion(ctx, relation.PipelineId, "UNBIND TASK"); err != nil {
+		return response.InternalServerError("保存流水线版本失败", err)
+	}
+
+	if err := services.Audit(ctx, &relation, "UNBIND TASK"); err != nil {
 		return response.InternalServerError("创建日志失败", err)
 	}
 
@@ -491,61 +1013,413 @@ func (instance *Controller) DeleteTaskBy(id string, ctx iris.Context) mvc.Respon
 
 // 同步流水线数据到 ETCD
 func (instance *Controller) PatchBy(id string, ctx iris.Context) mvc.Response {
-	pipeline := models.Pipeline{
-		Id: id,
+	pipeline, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	if _, err := pipeline.Build(); err != nil {
+		return response.InternalServerError("获取流水线相关信息失败", err)
+	}
+
+	if len(pipeline.Steps) == 0 {
+		return response.Send(400, "该流水线未关联任何任务", make([]interface{}, 0))
+	}
+
+	if len(pipeline.Nodes) == 0 {
+		return response.Send(400, "该流水线未关联任何节点", make([]interface{}, 0))
+	}
+
+	if err := services.SyncPipeline(pipeline); err != nil {
+		return response.BadGateway("同步到节点失败", services.SyncHint(pipeline.Id), err)
+	}
+
+	if err := services.Audit(ctx, pipeline, "SYNC PIPELINE"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("同步成功", response.Payload{"data": pipeline})
+}
+
+// 只修改流水线的启用状态，数据库和 ETCD 中的状态同时更新
+func (instance *Controller) PatchEnabled(id string, ctx iris.Context) mvc.Response {
+	params := EnabledRequest{}
+	if resp, ok := request.Bind(ctx, "pipeline", &params); !ok {
+		return resp
+	}
+
+	status := models.PIPELINEDISABLED
+	if *params.Enabled {
+		status = models.PIPELINEENABLED
+	}
+
+	return toggle(ctx, id, status, params.CancelQueued, params.KillRunning)
+}
+
+// 按照状态值启用或者禁用流水线，禁用后节点停止调度，流水线的定义保持不变
+func (instance *Controller) PatchStatus(id string, ctx iris.Context) mvc.Response {
+	params := StatusRequest{}
+	if resp, ok := request.Bind(ctx, "pipeline", &params); !ok {
+		return resp
+	}
+
+	return toggle(ctx, id, *params.Status, params.CancelQueued, params.KillRunning)
+}
+
+// 修改流水线的启用状态，禁用时可以同时撤回等待执行的指令、终止正在执行的流水线
+func toggle(ctx iris.Context, id string, status int, cancelQueued, killRunning bool) mvc.Response {
+	pipeline, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	operation := "DISABLE PIPELINE"
+	if status == models.PIPELINEENABLED {
+		operation = "ENABLE PIPELINE"
+	}
+	previous := pipeline.Status
+
+	session := models.Engine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return response.InternalServerError("开启事务失败", err)
+	}
+
+	rollback := func() {
+		if err := session.Rollback(); err != nil {
+			log.Println(err)
+		}
 	}
 
-	if _, err := models.Engine.Get(&pipeline); err != nil {
-		return response.InternalServerError("查询详情失败", err)
+	if _, err := session.Id(pipeline.Id).Cols("status").Update(&models.Pipeline{Status: status}); err != nil {
+		rollback()
+		return response.InternalServerError("更新流水线状态失败", err)
 	}
 
+	pipeline.Status = status
 	bytes, err := pipeline.Build()
 	if err != nil {
+		rollback()
 		return response.InternalServerError("获取流水线相关信息失败", err)
 	}
 
-	key := fmt.Sprintf("%s/%s", config.Conf.Etcd.Pipeline, pipeline.Id)
+	// 未绑定节点的流水线没有下发到 ETCD
+	synced := len(pipeline.Nodes) > 0
+	if synced {
+		if err := discover.PutPipeline(pipeline.Id, string(bytes)); err != nil {
+			rollback()
+			return response.BadGateway("同步到节点失败，流水线状态未修改", "请稍后重试", err)
+		}
+	}
+
+	if err := session.Commit(); err != nil {
+		// 数据库提交失败时恢复 ETCD 中的状态
+		if synced {
+			pipeline.Status = previous
+			if bytes, err := pipeline.ToString(); err != nil {
+				log.Println(err)
+			} else if err := discover.PutPipeline(pipeline.Id, bytes); err != nil {
+				log.Println(err)
+			}
+		}
+		return response.InternalServerError("更新流水线状态失败", err)
+	}
+
+	if synced {
+		services.MarkSynced(pipeline.Id, true)
+	}
+
+	meta := &control.KillReply{}
+	if status == models.PIPELINEDISABLED && (cancelQueued || killRunning) {
+		reply, err := control.KillAll(&control.KillRequest{PipelineId: pipeline.Id, Running: killRunning, Requester: utils.GetUID(ctx)})
+		if err != nil {
+			return response.Coded(response.CODECONTROLUNAVAILABLE, response.BadGateway("流水线已禁用，但部分节点未能处理强杀指令", "请稍后调用 POST /api/pipeline/killer 终止正在执行的流水线", err))
+		}
+		meta = reply
+	}
+
+	if err := services.Audit(ctx, pipeline, operation); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("修改成功", response.Payload{"data": pipeline, "meta": meta})
+}
+
+// 忽略定时器，立即在绑定的在线节点上执行一次流水线
+func (instance *Controller) Run(id string, ctx iris.Context) mvc.Response {
+	pipeline, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	// 请求体可以为空
+	params := RunRequest{}
+	if ctx.GetContentLength() > 0 {
+		if resp, ok := request.Bind(ctx, "pipeline", &params); !ok {
+			return resp
+		}
+	}
+
+	return dispatch(ctx, pipeline, models.TRIGGERMANUAL, params)
+}
+
+// 外部系统通过 Webhook 触发执行，请求体是发送方的原始内容，不做解析，通过 params.NAME 查询参数覆盖参数的默认值
+func (instance *Controller) Webhook(id string, ctx iris.Context) mvc.Response {
+	pipeline, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	params := RunRequest{Tags: make(models.Tags), Parameters: make(models.Variables)}
+	for key, value := range ctx.URLParams() {
+		if strings.HasPrefix(key, WEBHOOKPARAMPREFIX) {
+			params.Parameters[strings.TrimPrefix(key, WEBHOOKPARAMPREFIX)] = value
+		}
+	}
+
+	// 记录常见代码托管平台的事件类型和发送方
+	for _, header := range webhookEvents {
+		if event := ctx.GetHeader(header); event != "" {
+			params.Tags["event"] = event
+			break
+		}
+	}
+
+	if sender := ctx.GetHeader("User-Agent"); sender != "" {
+		if len(sender) > 255 {
+			sender = sender[:255]
+		}
+		params.Tags["webhook"] = sender
+	}
+
+	if resp, ok := request.Validate("pipeline", &params); !ok {
+		return resp
+	}
+
+	return dispatch(ctx, pipeline, models.TRIGGERWEBHOOK, params)
+}
+
+// 使用请求中的参数和来源信息，在绑定的在线节点上执行一次流水线
+func dispatch(ctx iris.Context, pipeline *models.Pipeline, source string, params RunRequest) mvc.Response {
+	// 调用方可以传入关联ID，用于在外部追踪系统中关联本次执行
+	correlation := ctx.GetHeader(models.CORRELATIONHEADER)
+	if correlation != "" && !models.ValidCorrelationId(correlation) {
+		return response.ValidationError(fmt.Sprintf("%s 不能超过 %d 个字符，且只能包含字母、数字和 _.:/@+=-", models.CORRELATIONHEADER, models.CORRELATIONMAXLEN))
+	}
+
+	parameters, err := pipeline.Parameters.Resolve(params.Parameters)
+	if err != nil {
+		return response.ValidationError(err.Error())
+	}
+
+	if _, err := pipeline.Build(); err != nil {
+		return response.InternalServerError("获取流水线相关信息失败", err)
+	}
 
 	if len(pipeline.Steps) == 0 {
-		return response.Send(400, "该流水线未关联任何任务", make([]interface{}, 0))
+		return response.Send(400, "该流水线未关联任何任务", make(map[string]interface{}))
 	}
 
 	if len(pipeline.Nodes) == 0 {
-		return response.Send(400, "该流水线未关联任何节点", make([]interface{}, 0))
+		return response.Send(400, "该流水线未关联任何节点", make(map[string]interface{}))
+	}
+
+	nodes := make([]models.Node, 0)
+	if err := models.Engine.Where(builder.In("id", pipeline.Nodes).And(builder.Eq{"status": models.ONLINE})).Find(&nodes); err != nil {
+		return response.InternalServerError("查询节点信息失败", err)
 	}
 
-	if _, err := discover.Client.Put(context.TODO(), key, string(bytes)); err != nil {
-		return response.InternalServerError("同步到 ETCD 时出错", err)
+	if len(nodes) == 0 {
+		return response.Coded(response.CODENODEOFFLINE, response.Send(400, "该流水线绑定的节点均不在线", make(map[string]interface{})))
+	}
+
+	// 超出项目预算时拒绝执行，推迟执行时由节点等到预算恢复后执行
+	warning, err := services.CheckBudget(pipeline, true)
+	if err != nil {
+		return response.Error("查询项目预算失败", err)
 	}
 
-	if err := models.CreateLog(&pipeline, utils.GetUID(ctx), "SYNC PIPELINE"); err != nil {
+	triggers := make([]*models.Trigger, 0, len(nodes))
+	for index := range nodes {
+		trigger := &models.Trigger{
+			Id:       models.NewRunId(),
+			Source:   source,
+			Pipeline: pipeline,
+			Tags:     models.Tags{"user": utils.GetUID(ctx)}.Merge(params.Tags),
+
+			CorrelationId: correlation,
+			Parameters:    parameters,
+		}
+
+		if err := control.Trigger(&nodes[index], trigger); err != nil {
+			return response.Coded(response.CODECONTROLUNAVAILABLE, response.BadGateway("下发执行指令失败", fmt.Sprintf("节点 %s 的控制服务不可用，请稍后重试", nodes[index].Name), err))
+		}
+
+		triggers = append(triggers, trigger)
+	}
+
+	if err := services.Audit(ctx, pipeline, "RUN PIPELINE"); err != nil {
 		return response.InternalServerError("创建日志失败", err)
 	}
 
-	return response.Success("同步成功", response.Payload{"data": pipeline})
+	if correlation != "" {
+		ctx.Header(models.CORRELATIONHEADER, correlation)
+	}
+
+	if warning != "" {
+		return response.Success("执行指令已下发", response.Payload{"data": triggers, "warnings": []string{warning}})
+	}
+
+	return response.Success("执行指令已下发", response.Payload{"data": triggers})
 }
 
 // 创建强杀指令
 func (instance *Controller) PostKiller(ctx iris.Context) mvc.Response {
 	params := KillPipelineRequest{}
 
-	if err := ctx.ReadJSON(&params); err != nil {
-		return response.InternalServerError("参数解析失败", err)
+	if resp, ok := request.Bind(ctx, "pipeline", &params); !ok {
+		return resp
+	}
+
+	pipeline, resp, ok := owned(ctx, params.PipelineId)
+	if !ok {
+		return resp
+	}
+
+	reply, err := control.KillAll(&control.KillRequest{
+		PipelineId: params.PipelineId,
+		Running:    true,
+		RunId:      params.RunId,
+		Requester:  utils.GetUID(ctx),
+		Signal:     params.Signal,
+		Grace:      params.Grace,
+	})
+
+	operation := "KILL PIPELINE"
+	if params.RunId != "" {
+		operation = "KILL RUN"
 	}
 
-	if err := validate.Struct(params); err != nil {
-		validationErrors := err.(validator.ValidationErrors)
-		return response.ValidationError(message.Get("pipeline", validationErrors))
+	// 部分节点未能处理时也已经终止了其余节点上的执行
+	if err := services.Audit(ctx, pipeline, operation); err != nil {
+		return response.InternalServerError("创建日志失败", err)
 	}
 
-	res, err := discover.Client.Grant(context.TODO(), 2)
 	if err != nil {
-		log.Println(err)
+		return response.Coded(response.CODECONTROLUNAVAILABLE, response.BadGateway("部分节点未能处理强杀指令", "请稍后重试", err))
 	}
+	return response.Success("", response.Payload{"data": reply})
+}
 
-	key := fmt.Sprintf("%s/%s", config.Conf.Etcd.Killer, params.PipelineId)
-	if _, err := discover.Client.Put(context.TODO(), key, "pipeline", clientv3.WithLease(res.ID)); err != nil {
-		log.Println(err)
+// 只能将流水线共享给自己所在的团队
+func accessible(ctx iris.Context, teamId string) (mvc.Response, bool) {
+	if err := authority.Authorize(utils.GetUID(ctx), teamId); err != nil {
+		return response.Error("查询团队成员失败", err), false
+	}
+
+	return mvc.Response{}, true
+}
+
+// 确定并发策略，并同步旧版本客户端使用的重复执行开关
+func concurrency(pipeline *models.Pipeline) {
+	pipeline.Concurrency = pipeline.ConcurrencyMode()
+	pipeline.Overlap = 0
+	if pipeline.Concurrency == models.CONCURRENCYALLOW {
+		pipeline.Overlap = 1
+	}
+}
+
+// 查询流水线并检查当前用户是否可以访问其所属团队的数据
+func owned(ctx iris.Context, id string) (*models.Pipeline, mvc.Response, bool) {
+	pipeline, err := authority.Find(utils.GetUID(ctx), id)
+	if err != nil {
+		return nil, response.Error("查询流水线失败", err), false
+	}
+
+	return pipeline, mvc.Response{}, true
+}
+
+// 补充流水线定时器的可读描述，优先使用流水线指定的时区，其次使用绑定节点的时区，未绑定节点或节点时区不一致时使用主节点的时区
+func describe(ctx iris.Context, pipelines ...*models.Pipeline) {
+	locale := cron.Locale(ctx.GetHeader("Accept-Language"))
+
+	ids := make([]string, 0, len(pipelines))
+	for _, pipeline := range pipelines {
+		ids = append(ids, pipeline.Id)
+	}
+	zones := services.Timezones(ids)
+
+	for _, pipeline := range pipelines {
+		if _, err := cronexpr.Parse(pipeline.Spec); err != nil {
+			continue
+		}
+
+		pipeline.SpecText = cron.Describe(pipeline.Spec, locale, services.Timezone(pipeline, zones))
+	}
+}
+
+// 校验定时器表达式，无法解析或者永远不会触发的表达式返回 422
+func checkSpec(spec string) (mvc.Response, bool) {
+	expression, err := cronexpr.Parse(spec)
+	if err != nil {
+		return response.ValidationError(fmt.Sprintf("定时器表达式有误: %s", err.Error())), false
 	}
-	return response.Success("", response.Payload{"data": make(map[string]interface{})})
+
+	if expression.Next(time.Now()).IsZero() {
+		return response.ValidationError("定时器表达式永远不会触发"), false
+	}
+
+	return mvc.Response{}, true
+}
+
+// 校验流水线的时区，只支持 IANA 时区名称
+func checkTimezone(zone string) (mvc.Response, bool) {
+	if zone == "" {
+		return mvc.Response{}, true
+	}
+
+	if _, err := time.LoadLocation(zone); err != nil {
+		return response.ValidationError("时区有误，请使用 IANA 时区名称，例如 Asia/Shanghai"), false
+	}
+
+	return mvc.Response{}, true
+}
+
+// 获取流水线列表中各元素的指针
+func references(pipelines []models.Pipeline) []*models.Pipeline {
+	result := make([]*models.Pipeline, 0, len(pipelines))
+	for index := range pipelines {
+		result = append(result, &pipelines[index])
+	}
+
+	return result
+}
+
+// 步骤是否只在前面的步骤成功时执行，管道模式的步骤与后一个步骤同时执行，不支持其他执行条件
+func successOnly(condition string) bool {
+	return condition == "" || condition == models.CONDITIONSUCCESS
+}
+
+// 检查步骤的输出映射，管道模式的步骤标准输出写入下一步，不能传递输出
+func checkOutputs(pipe int, outputs models.Outputs) error {
+	if pipe == 1 && len(outputs) > 0 {
+		return errors.New("管道模式的步骤不支持传递输出")
+	}
+
+	return outputs.Check()
+}
+
+// 检查步骤依赖的合法性，pivot 为新增或修改后的步骤
+func checkDepends(pivot *models.PipelineTaskPivot) (mvc.Response, bool) {
+	steps := make([]*models.PipelineTaskPivot, 0)
+	if err := models.Engine.Where(builder.Eq{"pipeline_id": pivot.PipelineId}).And(builder.Neq{"id": pivot.Id}).Find(&steps); err != nil {
+		return response.InternalServerError("查询关联关系失败", err), false
+	}
+
+	if err := models.CheckDepends(append(steps, pivot)); err != nil {
+		return response.ValidationError(err.Error()), false
+	}
+
+	return mvc.Response{}, true
 }
@@ -0,0 +1,154 @@
+package pipeline
+
+import (
+	"github.com/betterde/ects/internal/message"
+	"github.com/betterde/ects/internal/request"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"github.com/satori/go.uuid"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// 获取流水线的通知设置，不返回加签密钥
+func (instance *Controller) Notifications(id string, ctx iris.Context) mvc.Response {
+	if _, resp, ok := owned(ctx, id); !ok {
+		return resp
+	}
+
+	notifications := make([]models.PipelineNotification, 0)
+	if err := models.Engine.Where(builder.Eq{"pipeline_id": id}).Asc("created_at").Find(&notifications); err != nil {
+		return response.InternalServerError("获取通知设置失败", err)
+	}
+
+	for index := range notifications {
+		notifications[index].Secret = ""
+	}
+
+	return response.Success("请求成功", response.Payload{"data": notifications})
+}
+
+// 添加通知设置
+func (instance *Controller) AddNotification(id string, ctx iris.Context) mvc.Response {
+	notification := models.PipelineNotification{}
+	if fields := request.Decode(ctx, &notification); len(fields) > 0 {
+		return response.ValidationFailed(fields[0].Message, fields)
+	}
+
+	if _, resp, ok := owned(ctx, id); !ok {
+		return resp
+	}
+
+	if resp, ok := checkNotification(&notification); !ok {
+		return resp
+	}
+
+	notification.Id = uuid.NewV4().String()
+	notification.PipelineId = id
+	if err := notification.Store(); err != nil {
+		return response.InternalServerError("添加通知设置失败", err)
+	}
+
+	if err := services.Audit(ctx, &notification, "CREATE NOTIFICATION"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	notification.Secret = ""
+	return response.Success("添加成功", response.Payload{"data": notification})
+}
+
+// 更新通知设置，未填写加签密钥时保留原来的密钥
+func (instance *Controller) UpdateNotification(id, nid string, ctx iris.Context) mvc.Response {
+	if _, resp, ok := owned(ctx, id); !ok {
+		return resp
+	}
+
+	origin := models.PipelineNotification{}
+	if exist, err := models.Engine.Where(builder.Eq{"id": nid, "pipeline_id": id}).Get(&origin); err != nil {
+		return response.InternalServerError("查询通知设置失败", err)
+	} else if !exist {
+		return response.NotFound("通知设置不存在")
+	}
+
+	notification := models.PipelineNotification{}
+	if fields := request.Decode(ctx, &notification); len(fields) > 0 {
+		return response.ValidationFailed(fields[0].Message, fields)
+	}
+
+	if resp, ok := checkNotification(&notification); !ok {
+		return resp
+	}
+
+	notification.Id = origin.Id
+	notification.PipelineId = origin.PipelineId
+	notification.CreatedAt = origin.CreatedAt
+	if notification.Secret == "" && notification.Channel == models.CHANNELDINGTALK {
+		notification.Secret = origin.Secret
+	}
+
+	if err := notification.Update(); err != nil {
+		return response.InternalServerError("更新通知设置失败", err)
+	}
+
+	if err := services.Audit(ctx, &notification, "UPDATE NOTIFICATION"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	notification.Secret = ""
+	return response.Success("更新成功", response.Payload{"data": notification})
+}
+
+// 删除通知设置
+func (instance *Controller) RemoveNotification(id, nid string, ctx iris.Context) mvc.Response {
+	if _, resp, ok := owned(ctx, id); !ok {
+		return resp
+	}
+
+	notification := models.PipelineNotification{}
+	if exist, err := models.Engine.Where(builder.Eq{"id": nid, "pipeline_id": id}).Get(&notification); err != nil {
+		return response.InternalServerError("查询通知设置失败", err)
+	} else if !exist {
+		return response.NotFound("通知设置不存在")
+	}
+
+	if err := notification.Destroy(); err != nil {
+		return response.InternalServerError("删除通知设置失败", err)
+	}
+
+	if err := services.Audit(ctx, &notification, "DELETE NOTIFICATION"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("删除成功", response.Payload{"data": make(map[string]interface{})})
+}
+
+// 校验通知设置，邮件渠道填写邮箱地址，其他渠道填写 Webhook 地址
+func checkNotification(notification *models.PipelineNotification) (mvc.Response, bool) {
+	if err := validate.Struct(notification); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return response.ValidationError(message.Get("pipeline", validationErrors)), false
+	}
+
+	rule := "url"
+	if notification.Channel == models.CHANNELMAIL {
+		rule = "email"
+	}
+
+	if err := validate.Var(notification.Target, rule); err != nil {
+		return response.ValidationError("通知地址格式有误"), false
+	}
+
+	if !notification.OnSuccess && !notification.OnFailure && !notification.OnTimeout {
+		return response.ValidationError("请至少选择一个通知事件"), false
+	}
+
+	// 只有钉钉机器人使用加签密钥
+	if notification.Channel != models.CHANNELDINGTALK {
+		notification.Secret = ""
+	}
+
+	return mvc.Response{}, true
+}
@@ -0,0 +1,46 @@
+package pipeline
+
+import (
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+)
+
+// 手动执行对话框使用的参数信息
+type ParametersReply struct {
+	Parameters models.Parameters `json:"parameters"`         // 声明的参数及其默认值
+	LastRun    string            `json:"last_run,omitempty"` // 最近一次执行的记录ID
+	Last       models.Variables  `json:"last"`               // 最近一次执行使用的参数，只包含当前仍然声明的参数
+}
+
+// 获取流水线声明的参数和最近一次执行使用的值，用于渲染手动执行的对话框
+func (instance *Controller) Parameters(id string, ctx iris.Context) mvc.Response {
+	pipeline, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	reply := ParametersReply{Parameters: pipeline.Parameters, Last: make(models.Variables)}
+	if reply.Parameters == nil {
+		reply.Parameters = make(models.Parameters, 0)
+	}
+
+	record := models.PipelineRecords{}
+	exist, err := models.Engine.Where(builder.Eq{"pipeline_id": pipeline.Id}).Cols("id", "parameters").Desc("created_at").Get(&record)
+	if err != nil {
+		return response.InternalServerError("查询执行记录失败", err)
+	}
+
+	if exist {
+		reply.LastRun = record.Id
+		for _, parameter := range reply.Parameters {
+			if value, used := record.Parameters[parameter.Name]; used {
+				reply.Last[parameter.Name] = value
+			}
+		}
+	}
+
+	return response.Success("请求成功", response.Payload{"data": reply})
+}
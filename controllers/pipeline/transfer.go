@@ -0,0 +1,181 @@
+package pipeline
+
+import (
+	"fmt"
+	"github.com/betterde/ects/internal/request"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"io/ioutil"
+	"net/http"
+)
+
+// 导出流水线及其任务、步骤和绑定的节点为 YAML 文档，用于备份或者迁移到其他环境
+func (instance *Controller) Export(id string, ctx iris.Context) mvc.Response {
+	pipeline, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	document, err := services.ExportPipeline(pipeline)
+	if err != nil {
+		return response.InternalServerError("导出流水线失败", err)
+	}
+
+	if err := services.Audit(ctx, pipeline, "EXPORT PIPELINE"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="pipeline-%s.yaml"`, pipeline.Id))
+	return mvc.Response{
+		ContentType: "application/x-yaml; charset=utf-8",
+		Content:     document,
+	}
+}
+
+// 复制流水线及其步骤，复制出的流水线没有绑定节点并处于禁用状态，绑定节点后再启用
+func (instance *Controller) Clone(id string, ctx iris.Context) mvc.Response {
+	// 请求体可以为空
+	params := CloneRequest{}
+	if ctx.GetContentLength() > 0 {
+		if resp, ok := request.Bind(ctx, "pipeline", &params); !ok {
+			return resp
+		}
+	}
+
+	source, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	pipeline, err := services.ClonePipeline(source, params.Name)
+	if err != nil {
+		return response.InternalServerError("复制流水线失败", err)
+	}
+
+	if _, err := services.RecordVersion(ctx, pipeline.Id, "CLONE PIPELINE"); err != nil {
+		return response.InternalServerError("保存流水线版本失败", err)
+	}
+
+	if err := services.Audit(ctx, pipeline, "CLONE PIPELINE"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	describe(ctx, pipeline)
+
+	return response.Success("复制成功", response.Payload{"data": pipeline})
+}
+
+// 从导出的 YAML 文档创建流水线，通过 team_id 指定所属团队，conflict 为 rename 时重名的流水线自动改名，否则拒绝导入
+func (instance *Controller) Import(ctx iris.Context) mvc.Response {
+	conflict := ctx.URLParamDefault("conflict", services.CONFLICTFAIL)
+	if conflict != services.CONFLICTFAIL && conflict != services.CONFLICTRENAME {
+		return response.ValidationError("conflict 只能是 fail 或者 rename")
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(ctx.ResponseWriter(), ctx.Request().Body, request.MAXBODY))
+	if err != nil {
+		return response.ValidationError(fmt.Sprintf("读取请求体失败，文档不能超过 %d 字节", request.MAXBODY))
+	}
+
+	bundle, err := services.ParsePipeline(data)
+	if err != nil {
+		return response.ValidationError(fmt.Sprintf("解析流水线文档失败：%s", err))
+	}
+
+	if resp, ok := request.Validate("pipeline", bundle.Pipeline); !ok {
+		return resp
+	}
+
+	if resp, ok := checkSpec(bundle.Pipeline.Spec); !ok {
+		return resp
+	}
+
+	if resp, ok := checkTimezone(bundle.Pipeline.Timezone); !ok {
+		return resp
+	}
+
+	if err := bundle.Pipeline.Variables.Check(); err != nil {
+		return response.ValidationError(err.Error())
+	}
+
+	if err := bundle.Pipeline.Parameters.Check(); err != nil {
+		return response.ValidationError(err.Error())
+	}
+
+	for _, task := range bundle.Tasks {
+		if resp, ok := request.Validate("task", task); !ok {
+			return resp
+		}
+
+		if err := task.Variables.Check(); err != nil {
+			return response.ValidationError(err.Error())
+		}
+	}
+
+	for _, step := range bundle.Steps {
+		if resp, ok := request.Validate("pipeline", step); !ok {
+			return resp
+		}
+	}
+
+	teamId := ctx.URLParamDefault("team_id", "")
+	if resp, ok := accessible(ctx, teamId); !ok {
+		return resp
+	}
+
+	if bundle.Pipeline.Policy == "" {
+		bundle.Pipeline.Policy = models.POLICYALL
+	}
+	concurrency(bundle.Pipeline)
+
+	pipeline, warnings, err := services.ImportPipeline(bundle, teamId, conflict)
+	switch {
+	case err == services.ErrPipelineExists:
+		return response.Send(iris.StatusConflict, "已存在同名的流水线，可以指定 conflict=rename 自动改名", make(map[string]interface{}))
+	case err == services.ErrUnknownTask || err == models.ErrUnknownDepends || err == models.ErrCyclicDepends:
+		return response.ValidationError(err.Error())
+	case err != nil:
+		return response.InternalServerError("导入流水线失败", err)
+	}
+
+	if _, err := services.RecordVersion(ctx, pipeline.Id, "IMPORT PIPELINE"); err != nil {
+		return response.InternalServerError("保存流水线版本失败", err)
+	}
+
+	if err := services.Audit(ctx, pipeline, "IMPORT PIPELINE"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	// 记录步骤引用的任务的定义，用于校验执行内容
+	used := map[string]bool{pipeline.Finished: true, pipeline.Failed: true}
+	for _, step := range bundle.Steps {
+		used[step.TaskId] = true
+	}
+	for _, task := range bundle.Tasks {
+		if !used[task.Id] {
+			continue
+		}
+		if err := services.Audit(ctx, task, "CREATE TASK"); err != nil {
+			return response.InternalServerError("创建日志失败", err)
+		}
+	}
+
+	if len(pipeline.Nodes) > 0 {
+		if err := services.SyncPipeline(pipeline); err != nil {
+			return response.BadGateway("流水线已导入，但同步到节点失败", services.SyncHint(pipeline.Id), err)
+		}
+
+		checked, err := services.CheckRequirements(pipeline.Id, pipeline.Nodes)
+		if err != nil {
+			return response.InternalServerError("检查环境依赖失败", err)
+		}
+		warnings = append(warnings, checked...)
+	}
+
+	describe(ctx, pipeline)
+
+	return response.Success("导入成功", response.Payload{"data": pipeline, "warnings": warnings})
+}
@@ -0,0 +1,144 @@
+package pipeline
+
+import (
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+)
+
+// 获取流水线的历史版本，按照版本号倒序排列
+func (instance *Controller) Versions(id string, ctx iris.Context) mvc.Response {
+	if _, resp, ok := owned(ctx, id); !ok {
+		return resp
+	}
+
+	page, limit, start := utils.Pagination(ctx)
+	versions := make([]*models.PipelineVersion, 0)
+	total, err := models.Engine.Where(builder.Eq{"pipeline_id": id}).Omit("snapshot").Limit(limit, start).Desc("version").FindAndCount(&versions)
+	if err != nil {
+		return response.InternalServerError("查询流水线版本失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{
+		"data": versions,
+		"meta": response.NewMeta(ctx, page, limit, total),
+	})
+}
+
+// 获取指定版本的流水线定义
+func (instance *Controller) Version(id string, version int, ctx iris.Context) mvc.Response {
+	if _, resp, ok := owned(ctx, id); !ok {
+		return resp
+	}
+
+	record, resp, ok := versionOf(id, version)
+	if !ok {
+		return resp
+	}
+
+	return response.Success("请求成功", response.Payload{"data": record})
+}
+
+// 比较两个版本的流水线定义，to 未指定时与最新版本比较
+func (instance *Controller) DiffVersions(id string, ctx iris.Context) mvc.Response {
+	if _, resp, ok := owned(ctx, id); !ok {
+		return resp
+	}
+
+	from, err := ctx.URLParamInt("from")
+	if err != nil {
+		return response.ValidationError("请指定要比较的版本 from")
+	}
+
+	to := ctx.URLParamIntDefault("to", 0)
+	if to == 0 {
+		latest := &models.PipelineVersion{}
+		if _, err := models.Engine.Where(builder.Eq{"pipeline_id": id}).Cols("version").Desc("version").Get(latest); err != nil {
+			return response.InternalServerError("查询流水线版本失败", err)
+		}
+		to = latest.Version
+	}
+
+	before, resp, ok := versionOf(id, from)
+	if !ok {
+		return resp
+	}
+
+	after, resp, ok := versionOf(id, to)
+	if !ok {
+		return resp
+	}
+
+	changes, err := services.DiffVersions(before, after)
+	if err != nil {
+		return response.InternalServerError("比较流水线版本失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{
+		"data": changes,
+		"meta": map[string]interface{}{"from": from, "to": to},
+	})
+}
+
+// 将流水线回滚到指定版本并重新下发到节点，回滚本身也会产生一个新版本
+func (instance *Controller) RollbackVersion(id string, version int, ctx iris.Context) mvc.Response {
+	current, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	record, resp, ok := versionOf(id, version)
+	if !ok {
+		return resp
+	}
+
+	pipeline, warnings, err := services.RollbackPipeline(current, record)
+	switch {
+	case err == services.ErrVersionTask:
+		return response.ValidationError(err.Error())
+	case err != nil && pipeline == nil:
+		return response.InternalServerError("回滚流水线失败", err)
+	}
+
+	if _, err := services.RecordVersion(ctx, id, "ROLLBACK PIPELINE"); err != nil {
+		return response.InternalServerError("保存流水线版本失败", err)
+	}
+
+	if err := services.Audit(ctx, pipeline, "ROLLBACK PIPELINE"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	// 数据库已经回滚，同步失败时流水线标记为待同步
+	if err != nil {
+		return response.BadGateway("流水线已回滚，但同步到节点失败", services.SyncHint(pipeline.Id), err)
+	}
+
+	describe(ctx, pipeline)
+
+	return response.Success("回滚成功", response.Payload{"data": pipeline, "warnings": warnings})
+}
+
+// 查询流水线的指定版本并解析其中的定义
+func versionOf(id string, version int) (*models.PipelineVersion, mvc.Response, bool) {
+	record := &models.PipelineVersion{}
+	exist, err := models.Engine.Where(builder.Eq{"pipeline_id": id, "version": version}).Get(record)
+	if err != nil {
+		return nil, response.InternalServerError("查询流水线版本失败", err), false
+	}
+
+	if !exist {
+		return nil, response.NotFound("流水线版本不存在"), false
+	}
+
+	definition, err := services.DefinitionOf(record)
+	if err != nil {
+		return nil, response.InternalServerError("解析流水线版本失败", err), false
+	}
+	record.Definition = definition
+
+	return record, mvc.Response{}, true
+}
@@ -0,0 +1,28 @@
+package project
+
+import (
+	"github.com/betterde/ects/internal/openapi"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+)
+
+// 接口说明，用于生成 OpenAPI 文档
+var Operations = []openapi.Operation{
+	{Method: "GET", Path: "", Summary: "获取项目列表", Paged: true, Result: []models.Project{}, Query: []openapi.Parameter{
+		{Name: "scene", Description: "table 分页查询，selector 返回全部项目"},
+		{Name: "search", Description: "按照名称搜索"},
+	}},
+	{Method: "POST", Path: "", Summary: "创建项目", Body: models.Project{}, Result: models.Project{}},
+	{Method: "PUT", Path: "/{id}", Summary: "更新项目", Body: models.Project{}},
+	{Method: "DELETE", Path: "/{id}", Summary: "删除项目"},
+	{Method: "GET", Path: "/{id}/concurrency", Summary: "获取项目正在执行的流水线和并发上限"},
+	{Method: "GET", Path: "/{id}/budget", Summary: "获取项目本月使用的节点分钟和预算"},
+	{Method: "GET", Path: "/{id}/report", Summary: "获取项目的月度 SLA 报表", Result: []services.SLAEntry{}, Query: []openapi.Parameter{
+		{Name: "month", Description: "统计月份，例如 2019-08"},
+		{Name: "tolerance", Type: "integer", Description: "允许的延迟分钟数"},
+		{Name: "format", Description: "json 或者 csv"},
+	}},
+	{Method: "GET", Path: "/{id}/calendar", Summary: "导出启用的流水线接下来的计划执行为 iCalendar 日历", Produces: "text/calendar", Query: []openapi.Parameter{
+		{Name: "days", Type: "integer", Description: "导出的天数"},
+	}},
+}
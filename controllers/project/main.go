@@ -0,0 +1,341 @@
+package project
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/internal/message"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"github.com/satori/go.uuid"
+	"gopkg.in/go-playground/validator.v9"
+	"log"
+	"math"
+	"strconv"
+	"time"
+)
+
+type (
+	Controller struct{}
+)
+
+var (
+	validate  = validator.New()
+	authority = services.NewProjectService()
+)
+
+// 路由分发
+func (instance *Controller) BeforeActivation(request mvc.BeforeActivation) {
+	request.Handle("GET", "/{id:string}/concurrency", "Concurrency")
+	request.Handle("GET", "/{id:string}/budget", "Budget")
+	request.Handle("GET", "/{id:string}/report", "Report")
+	request.Handle("GET", "/{id:string}/calendar", "Calendar")
+}
+
+// 获取项目列表
+func (instance *Controller) Get(ctx iris.Context) mvc.Response {
+	var (
+		total int64
+		err   error
+	)
+	scene := ctx.URLParamDefault("scene", "table")
+	projects := make([]models.Project, 0)
+
+	// 只显示当前用户可见的项目
+	visible, err := authority.Visible(utils.GetUID(ctx))
+	if err != nil {
+		return response.InternalServerError("获取用户信息失败", err)
+	}
+
+	switch scene {
+	case "table":
+		search := ctx.URLParamDefault("search", "")
+		page, limit, start := utils.Pagination(ctx)
+
+		if search != "" {
+			total, err = models.Engine.Where(visible).And(builder.Eq{"id": search}.Or(builder.Like{"name", search})).Limit(limit, start).Desc("created_at").FindAndCount(&projects)
+		} else {
+			total, err = models.Engine.Where(visible).Limit(limit, start).Desc("created_at").FindAndCount(&projects)
+		}
+
+		if err != nil {
+			return response.InternalServerError("获取项目列表失败", err)
+		}
+
+		return response.Success("请求成功", response.Payload{
+			"data": projects,
+			"meta": response.NewMeta(ctx, page, limit, total),
+		})
+	case "selector":
+		if err := models.Engine.Where(visible).Find(&projects); err != nil {
+			return response.InternalServerError("获取项目列表失败", err)
+		}
+
+		return response.Success("请求成功", response.Payload{"data": projects})
+	}
+
+	return response.Success("数据使用场景有误", response.Payload{"data": make([]interface{}, 0)})
+}
+
+// 创建项目
+func (instance *Controller) Post(ctx iris.Context) mvc.Response {
+	project := models.Project{}
+
+	if err := ctx.ReadJSON(&project); err != nil {
+		return response.InternalServerError("参数解析失败", err)
+	}
+
+	if err := validate.Struct(project); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return response.ValidationError(message.Get("project", validationErrors))
+	}
+
+	if project.BudgetAction == "" {
+		project.BudgetAction = models.BUDGETDENY
+	}
+
+	if resp, ok := accessible(ctx, project.TeamId); !ok {
+		return resp
+	}
+
+	project.Id = uuid.NewV4().String()
+
+	if err := project.Store(); err != nil {
+		return response.InternalServerError("创建项目失败", err)
+	}
+
+	if err := services.Audit(ctx, &project, "CREATE PROJECT"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("创建成功", response.Payload{"data": project})
+}
+
+// 更新项目
+func (instance *Controller) PutBy(id string, ctx iris.Context) mvc.Response {
+	project := models.Project{}
+
+	if err := ctx.ReadJSON(&project); err != nil {
+		return response.InternalServerError("参数解析失败", err)
+	}
+
+	if err := validate.Struct(project); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return response.ValidationError(message.Get("project", validationErrors))
+	}
+
+	if project.BudgetAction == "" {
+		project.BudgetAction = models.BUDGETDENY
+	}
+
+	// 既要能访问项目当前所属的团队，也要能访问修改后的团队
+	if _, resp, ok := owned(ctx, id); !ok {
+		return resp
+	}
+
+	if resp, ok := accessible(ctx, project.TeamId); !ok {
+		return resp
+	}
+
+	project.Id = id
+
+	if err := project.Update(); err != nil {
+		return response.InternalServerError("更新项目失败", err)
+	}
+
+	if err := services.Audit(ctx, &project, "UPDATE PROJECT"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("更新成功", response.Payload{"data": project})
+}
+
+// 删除项目，项目下的流水线将解除归属关系
+func (instance *Controller) DeleteBy(id string, ctx iris.Context) mvc.Response {
+	project, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	session := models.Engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return response.InternalServerError("初始化事务失败", err)
+	}
+
+	if _, err := session.Table(new(models.Pipeline)).Where(builder.Eq{"project_id": id}).Update(map[string]interface{}{"project_id": ""}); err != nil {
+		if err := session.Rollback(); err != nil {
+			log.Println(err)
+		}
+		return response.InternalServerError("解除流水线归属失败", err)
+	}
+
+	if _, err := session.Id(id).Delete(&models.Project{}); err != nil {
+		if err := session.Rollback(); err != nil {
+			log.Println(err)
+		}
+		return response.InternalServerError("删除项目失败", err)
+	}
+
+	if err := session.Commit(); err != nil {
+		return response.InternalServerError("提交事务失败", err)
+	}
+
+	if err := services.Audit(ctx, project, "DELETE PROJECT"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("删除成功", response.Payload{"data": make(map[string]interface{})})
+}
+
+// 获取项目当前正在执行的流水线和并发上限
+func (instance *Controller) Concurrency(id string, ctx iris.Context) mvc.Response {
+	project, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	runs, err := discover.Running(id)
+	if err != nil {
+		return response.InternalServerError("获取正在执行的流水线失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{"data": map[string]interface{}{
+		"limit":   project.MaxConcurrency,
+		"running": len(runs),
+		"runs":    runs,
+	}})
+}
+
+// 获取项目本月使用的节点分钟和预算
+func (instance *Controller) Budget(id string, ctx iris.Context) mvc.Response {
+	project, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	month := services.MonthOf(time.Now())
+	used, err := services.BudgetUsed(project.Id, month, month.AddDate(0, 1, 0))
+	if err != nil {
+		return response.InternalServerError("统计项目用量失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{"data": map[string]interface{}{
+		"month":    month.Format("2006-01"),
+		"budget":   project.Budget,
+		"action":   project.BudgetAction,
+		"used":     math.Round(used*100) / 100,
+		"exceeded": project.Budget > 0 && used >= float64(project.Budget),
+	}})
+}
+
+// 获取项目的月度 SLA 报表，format 为 csv 时下载 CSV 文件
+func (instance *Controller) Report(id string, ctx iris.Context) mvc.Response {
+	project, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	month, err := time.ParseInLocation("2006-01", ctx.URLParamDefault("month", time.Now().Format("2006-01")), time.Local)
+	if err != nil {
+		return response.ValidationError("月份格式错误，例如 2019-08")
+	}
+
+	tolerance := ctx.URLParamIntDefault("tolerance", 5)
+	if tolerance < 0 || tolerance > 24*60 {
+		return response.ValidationError("允许的延迟须在 0 到 1440 分钟之间")
+	}
+
+	entries, err := services.SLAReport(project.Id, month, time.Duration(tolerance)*time.Minute)
+	if err != nil {
+		return response.InternalServerError("统计流水线执行记录失败", err)
+	}
+
+	switch ctx.URLParamDefault("format", "json") {
+	case "json":
+		return response.Success("请求成功", response.Payload{"data": entries})
+	case "csv":
+		buffer := &bytes.Buffer{}
+		writer := csv.NewWriter(buffer)
+		rows := [][]string{{"pipeline_id", "name", "spec", "scheduled", "executed", "missed", "succeeded", "on_time", "on_time_rate"}}
+		for _, entry := range entries {
+			rows = append(rows, []string{
+				entry.PipelineId,
+				entry.Name,
+				entry.Spec,
+				strconv.Itoa(entry.Scheduled),
+				strconv.Itoa(entry.Executed),
+				strconv.Itoa(entry.Missed),
+				strconv.Itoa(entry.Succeeded),
+				strconv.Itoa(entry.OnTime),
+				strconv.FormatFloat(entry.OnTimeRate, 'f', 2, 64),
+			})
+		}
+
+		if err := writer.WriteAll(rows); err != nil {
+			return response.InternalServerError("生成报表失败", err)
+		}
+
+		ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="sla-%s-%s.csv"`, project.Id, month.Format("2006-01")))
+		return mvc.Response{
+			ContentType: "text/csv; charset=utf-8",
+			Content:     buffer.Bytes(),
+		}
+	}
+
+	return response.ValidationError("报表格式只支持 json 和 csv")
+}
+
+// 只能将项目共享给自己所在的团队
+func accessible(ctx iris.Context, teamId string) (mvc.Response, bool) {
+	if err := authority.Authorize(utils.GetUID(ctx), teamId); err != nil {
+		return response.Error("查询团队成员失败", err), false
+	}
+
+	return mvc.Response{}, true
+}
+
+// 查询项目并检查当前用户是否可以访问其所属团队的数据
+func owned(ctx iris.Context, id string) (*models.Project, mvc.Response, bool) {
+	project, err := authority.Find(utils.GetUID(ctx), id)
+	if err != nil {
+		return nil, response.Error("查询项目失败", err), false
+	}
+
+	return project, mvc.Response{}, true
+}
+
+// 将项目中启用的流水线接下来 days 天的计划执行导出为 iCalendar 日历，可以导入共享日历查看批处理窗口
+func (instance *Controller) Calendar(id string, ctx iris.Context) mvc.Response {
+	project, resp, ok := owned(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	days := ctx.URLParamIntDefault("days", services.CALENDARDAYS)
+	if days < 1 || days > services.CALENDARMAXDAYS {
+		return response.ValidationError(fmt.Sprintf("导出天数须在 1 到 %d 之间", services.CALENDARMAXDAYS))
+	}
+
+	pipelines := make([]models.Pipeline, 0)
+	if err := models.Engine.Where(builder.Eq{"project_id": project.Id, "status": models.PIPELINEENABLED}).Asc("name").Find(&pipelines); err != nil {
+		return response.InternalServerError("查询流水线失败", err)
+	}
+
+	calendar, err := services.Calendar(project.Name, pipelines, time.Now(), days)
+	if err != nil {
+		return response.InternalServerError("生成日历失败", err)
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="project-%s.ics"`, project.Id))
+	return mvc.Response{
+		ContentType: "text/calendar; charset=utf-8",
+		Content:     calendar,
+	}
+}
@@ -0,0 +1,14 @@
+package ratelimit
+
+import (
+	"github.com/betterde/ects/internal/openapi"
+	"github.com/betterde/ects/models"
+)
+
+// 接口说明，用于生成 OpenAPI 文档
+var Operations = []openapi.Operation{
+	{Method: "GET", Path: "", Summary: "获取限流分组列表", Result: []models.RateLimit{}},
+	{Method: "POST", Path: "", Summary: "创建限流分组", Body: models.RateLimit{}},
+	{Method: "PUT", Path: "/{id}", Summary: "更新限流分组", Body: models.RateLimit{}},
+	{Method: "DELETE", Path: "/{id}", Summary: "删除限流分组"},
+}
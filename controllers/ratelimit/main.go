@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"github.com/betterde/ects/internal/message"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"github.com/satori/go.uuid"
+	"gopkg.in/go-playground/validator.v9"
+	"regexp"
+)
+
+type (
+	Controller struct{}
+)
+
+var (
+	validate = validator.New()
+	// 分组名称会作为 ETCD 键的一部分
+	namePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+)
+
+// 获取限流分组列表
+func (instance *Controller) Get(ctx iris.Context) mvc.Response {
+	limits := make([]models.RateLimit, 0)
+	if err := models.Engine.Asc("name").Find(&limits); err != nil {
+		return response.InternalServerError("获取限流分组失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{"data": limits})
+}
+
+// 创建限流分组
+func (instance *Controller) Post(ctx iris.Context) mvc.Response {
+	limit := models.RateLimit{}
+
+	if err := ctx.ReadJSON(&limit); err != nil {
+		return response.InternalServerError("参数解析失败", err)
+	}
+
+	if resp, ok := check(&limit); !ok {
+		return resp
+	}
+
+	limit.Id = uuid.NewV4().String()
+	if err := limit.Store(); err != nil {
+		return response.InternalServerError("创建限流分组失败", err)
+	}
+
+	if err := services.Audit(ctx, &limit, "CREATE RATELIMIT"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("创建成功", response.Payload{"data": limit})
+}
+
+// 更新限流分组，任务通过名称引用分组，因此名称不能修改
+func (instance *Controller) PutBy(id string, ctx iris.Context) mvc.Response {
+	origin := models.RateLimit{}
+	if exist, err := models.Engine.Id(id).Get(&origin); err != nil {
+		return response.InternalServerError("查询限流分组失败", err)
+	} else if !exist {
+		return response.NotFound("限流分组不存在")
+	}
+
+	limit := models.RateLimit{}
+	if err := ctx.ReadJSON(&limit); err != nil {
+		return response.InternalServerError("参数解析失败", err)
+	}
+
+	limit.Id = id
+	limit.Name = origin.Name
+	if err := validate.Struct(limit); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return response.ValidationError(message.Get("ratelimit", validationErrors))
+	}
+
+	if err := limit.Update(); err != nil {
+		return response.InternalServerError("更新限流分组失败", err)
+	}
+
+	if err := services.Audit(ctx, &limit, "UPDATE RATELIMIT"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("更新成功", response.Payload{"data": limit})
+}
+
+// 删除限流分组，仍有任务引用时不能删除
+func (instance *Controller) DeleteBy(id string, ctx iris.Context) mvc.Response {
+	limit := models.RateLimit{}
+	if exist, err := models.Engine.Id(id).Get(&limit); err != nil {
+		return response.InternalServerError("查询限流分组失败", err)
+	} else if !exist {
+		return response.NotFound("限流分组不存在")
+	}
+
+	count, err := models.Engine.Where(builder.Eq{"rate_limit": limit.Name}).Count(&models.Task{})
+	if err != nil {
+		return response.InternalServerError("查询引用限流分组的任务失败", err)
+	}
+
+	if count > 0 {
+		return response.Send(400, "仍有任务引用该限流分组", make(map[string]interface{}))
+	}
+
+	if err := limit.Destroy(); err != nil {
+		return response.InternalServerError("删除限流分组失败", err)
+	}
+
+	if err := services.Audit(ctx, &limit, "DELETE RATELIMIT"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("删除成功", response.Payload{"data": make(map[string]interface{})})
+}
+
+// 校验限流分组的参数和名称是否可用
+func check(limit *models.RateLimit) (mvc.Response, bool) {
+	if err := validate.Struct(limit); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return response.ValidationError(message.Get("ratelimit", validationErrors)), false
+	}
+
+	if !namePattern.MatchString(limit.Name) {
+		return response.ValidationError("分组名称只能包含字母、数字、下划线、点和短横线"), false
+	}
+
+	count, err := models.Engine.Where(builder.Eq{"name": limit.Name}).Count(&models.RateLimit{})
+	if err != nil {
+		return response.InternalServerError("查询限流分组失败", err), false
+	}
+
+	if count > 0 {
+		return response.Send(400, "限流分组名称已存在", make(map[string]interface{})), false
+	}
+
+	return mvc.Response{}, true
+}
@@ -0,0 +1,69 @@
+package run
+
+import (
+	"github.com/betterde/ects/internal/diff"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"time"
+)
+
+// 比较步骤的输出和上一次成功执行中同一步骤的输出，标记新增的错误行
+func (instance *Controller) StepDiff(id string, taskId string, ctx iris.Context) mvc.Response {
+	record := models.PipelineRecords{}
+	exist, err := models.Engine.Id(id).Get(&record)
+	if err != nil {
+		return response.InternalServerError("查询执行记录失败", err)
+	}
+
+	if !exist {
+		return response.Coded(response.CODERUNNOTFOUND, response.NotFound("执行记录不存在"))
+	}
+
+	if resp, ok := accessible(ctx, &record); !ok {
+		return resp
+	}
+
+	// 步骤重试时有多条记录，使用最后一条
+	current := models.TaskRecords{}
+	exist, err = models.Engine.Where(builder.Eq{"pipeline_record_id": id, "task_id": taskId}).Desc("id").Get(&current)
+	if err != nil {
+		return response.InternalServerError("查询步骤执行记录失败", err)
+	}
+
+	if !exist {
+		return response.NotFound("步骤执行记录不存在")
+	}
+
+	succeeded := builder.Select("id").From(record.TableName()).Where(builder.Eq{"pipeline_id": record.PipelineId, "status": models.RECORDFINISHED}.And(builder.Neq{"id": id}))
+	baseline := models.TaskRecords{}
+	exist, err = models.Engine.Where(builder.Eq{"task_id": taskId, "status": "finished"}.And(builder.In("pipeline_record_id", succeeded), builder.Lt{"begin_with": time.Time(current.BeginWith)})).Desc("begin_with").Get(&baseline)
+	if err != nil {
+		return response.InternalServerError("查询上一次成功的执行记录失败", err)
+	}
+
+	if !exist {
+		return response.NotFound("没有可以比较的成功执行记录")
+	}
+
+	return response.Success("请求成功", response.Payload{
+		"data": map[string]interface{}{
+			"current":  summary(&current),
+			"baseline": summary(&baseline),
+			"diff":     diff.Text(baseline.Result, current.Result),
+		},
+	})
+}
+
+// 比较结果中不返回完整输出
+func summary(step *models.TaskRecords) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                 step.Id,
+		"pipeline_record_id": step.PipelineRecordId,
+		"status":             step.Status,
+		"exit_code":          step.ExitCode,
+		"begin_with":         step.BeginWith,
+	}
+}
@@ -0,0 +1,47 @@
+package run
+
+import (
+	"github.com/betterde/ects/internal/openapi"
+	"github.com/betterde/ects/models"
+)
+
+// 执行记录的接口说明，用于生成 OpenAPI 文档
+var Operations = []openapi.Operation{
+	{Method: "GET", Path: "", Summary: "获取流水线执行历史", Paged: true, Result: []models.PipelineRecords{}, Query: []openapi.Parameter{
+		{Name: "pipeline_id"},
+		{Name: "node_id"},
+		{Name: "trigger", Description: "触发方式"},
+		{Name: "group_id", Description: "执行组ID"},
+		{Name: "status", Type: "integer", Description: "执行状态"},
+		{Name: "tag", Description: "按标签筛选，格式为 name:value，可以指定多个"},
+		{Name: "from", Description: "开始时间的下限，格式为 2006-01-02 或者 2006-01-02 15:04:05"},
+		{Name: "to", Description: "开始时间的上限，格式同 from"},
+	}},
+	{Method: "GET", Path: "/{id}", Summary: "获取执行记录详情，包含每个步骤的执行记录", Result: models.PipelineRecords{}},
+	{Method: "GET", Path: "/tasks", Summary: "获取任务执行历史", Paged: true, Result: []models.TaskRecords{}, Query: []openapi.Parameter{
+		{Name: "task_id"},
+		{Name: "node_id"},
+		{Name: "pipeline_record_id"},
+		{Name: "status"},
+		{Name: "command_hash", Description: "执行内容的 SHA-256 摘要"},
+		{Name: "from", Description: "开始时间的下限"},
+		{Name: "to", Description: "开始时间的上限"},
+	}},
+	{Method: "POST", Path: "/{id}/replay", Summary: "使用执行记录中的流水线快照重新执行"},
+	{Method: "POST", Path: "/{id}/kill", Summary: "终止执行节点上的一次执行", Body: KillRunRequest{}},
+	{Method: "POST", Path: "/{id}/steps/{tid}/kill", Summary: "只终止执行中的一个步骤，流水线按照步骤失败继续执行", Body: KillRunRequest{}},
+	{Method: "GET", Path: "/{id}/logs", Summary: "实时推送正在执行的流水线的输出", Produces: "text/event-stream"},
+	{Method: "GET", Path: "/{id}/output", Summary: "获取各步骤保存的输出", Query: []openapi.Parameter{
+		{Name: "task_id", Description: "只获取指定任务的输出"},
+	}},
+	{Method: "GET", Path: "/{id}/steps/{tid}/diff", Summary: "比较步骤的输出和上一次成功执行的输出"},
+	{Method: "GET", Path: "/{id}/shares", Summary: "获取执行记录的分享链接"},
+	{Method: "POST", Path: "/{id}/shares", Summary: "创建执行记录的分享链接", Body: ShareRequest{}},
+	{Method: "DELETE", Path: "/{id}/shares/{sid}", Summary: "撤销分享链接"},
+}
+
+// 分享链接的接口说明，不需要登录
+var ShareOperations = []openapi.Operation{
+	{Method: "GET", Path: "/{token}", Summary: "通过分享链接查看执行记录详情"},
+	{Method: "GET", Path: "/{token}/logs", Summary: "通过分享链接实时查看正在执行的流水线的输出", Produces: "text/event-stream"},
+}
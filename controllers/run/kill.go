@@ -0,0 +1,96 @@
+package run
+
+import (
+	"github.com/betterde/ects/internal/control"
+	"github.com/betterde/ects/internal/request"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+)
+
+type (
+	// 终止执行或步骤的方式，请求体可以为空
+	KillRunRequest struct {
+		Signal string `json:"signal" validate:"omitempty,oneof=SIGTERM SIGKILL"` // 为空时使用 SIGTERM
+		Grace  int    `json:"grace" validate:"min=0,max=3600"`                   // 发送 SIGTERM 后等待进程退出的秒数，0 使用节点配置的宽限期
+	}
+)
+
+// 终止执行节点上的一次执行，不影响该流水线的其他执行
+func (instance *Controller) Kill(id string, ctx iris.Context) mvc.Response {
+	return kill(ctx, id, "")
+}
+
+// 只终止执行中的一个步骤，流水线按照该步骤失败继续执行，被终止的步骤不会重试
+func (instance *Controller) KillStep(id, tid string, ctx iris.Context) mvc.Response {
+	return kill(ctx, id, tid)
+}
+
+// 向执行所在节点的控制服务下发终止指令，taskId 为空时终止整个执行
+func kill(ctx iris.Context, id, taskId string) mvc.Response {
+	params := KillRunRequest{}
+	if ctx.GetContentLength() > 0 {
+		if resp, ok := request.Bind(ctx, "pipeline", &params); !ok {
+			return resp
+		}
+	}
+
+	record, resp, ok := shared(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	if record.Status != models.RECORDRUNNING {
+		return response.Send(iris.StatusConflict, "执行已经结束", make(map[string]interface{}))
+	}
+
+	node := models.Node{}
+	if _, err := models.Engine.Id(record.NodeId).Get(&node); err != nil {
+		return response.InternalServerError("查询节点信息失败", err)
+	}
+
+	// 维护中的节点仍在执行已经开始的流水线
+	if node.Status != models.ONLINE && node.Status != models.DRAINED {
+		return response.Coded(response.CODENODEOFFLINE, response.Send(400, "执行节点不在线，无法终止", make(map[string]interface{})))
+	}
+
+	uid := utils.GetUID(ctx)
+	operation := "KILL STEP"
+	if taskId == "" {
+		operation = "KILL RUN"
+		if _, err := models.Cancel(builder.Eq{"id": record.Id}, nil, models.CANCELREQUESTED, uid); err != nil {
+			return response.InternalServerError("更新执行记录失败", err)
+		}
+	}
+
+	reply, err := control.Kill(&node, &control.KillRequest{
+		PipelineId: record.PipelineId,
+		Running:    true,
+		RunId:      record.Id,
+		StepId:     taskId,
+		Requester:  uid,
+		Signal:     params.Signal,
+		Grace:      params.Grace,
+	})
+	if err != nil {
+		return response.Coded(response.CODECONTROLUNAVAILABLE, response.BadGateway("下发终止指令失败", "执行节点的控制服务不可用，请稍后重试", err))
+	}
+
+	if err := services.Audit(ctx, record, operation); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	if reply.Killed == 0 {
+		warning := "该执行已不在节点上运行"
+		if taskId != "" {
+			warning = "该步骤当前没有在执行"
+		}
+		return response.Success("终止指令已下发", response.Payload{"data": reply, "warnings": []string{warning}})
+	}
+
+	return response.Success("终止指令已下发", response.Payload{"data": reply})
+}
@@ -0,0 +1,354 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/betterde/ects/internal/control"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	Controller struct{}
+)
+
+var authority = services.NewRecordService()
+
+// 路由分发
+func (instance *Controller) BeforeActivation(request mvc.BeforeActivation) {
+	request.Handle("POST", "/{id:string}/replay", "Replay")
+	request.Handle("POST", "/{id:string}/kill", "Kill")
+	request.Handle("POST", "/{id:string}/steps/{tid:string}/kill", "KillStep")
+	request.Handle("GET", "/{id:string}/logs", "Logs")
+	request.Handle("GET", "/{id:string}/output", "Output")
+	request.Handle("GET", "/{id:string}/steps/{tid:string}/diff", "StepDiff")
+	request.Handle("GET", "/{id:string}/shares", "Shares")
+	request.Handle("POST", "/{id:string}/shares", "AddShare")
+	request.Handle("DELETE", "/{id:string}/shares/{sid:string}", "RemoveShare")
+}
+
+// 通过执行节点的控制服务实时推送正在执行的流水线的输出，使用 Server-Sent Events 格式
+func (instance *Controller) Logs(id string, ctx iris.Context) {
+	record := models.PipelineRecords{}
+	if exist, err := models.Engine.Id(id).Get(&record); err != nil {
+		response.InternalServerError("查询执行记录失败", err).Dispatch(ctx)
+		return
+	} else if !exist {
+		response.Coded(response.CODERUNNOTFOUND, response.NotFound("执行记录不存在")).Dispatch(ctx)
+		return
+	}
+
+	if resp, ok := accessible(ctx, &record); !ok {
+		resp.Dispatch(ctx)
+		return
+	}
+
+	stream(ctx, &record)
+}
+
+// 推送正在执行的流水线的输出
+func stream(ctx iris.Context, record *models.PipelineRecords) {
+	if record.Status != models.RECORDRUNNING {
+		response.Send(400, "流水线已执行结束，请查看执行记录中的输出", make(map[string]interface{})).Dispatch(ctx)
+		return
+	}
+
+	node := models.Node{}
+	if _, err := models.Engine.Id(record.NodeId).Get(&node); err != nil {
+		response.InternalServerError("查询节点信息失败", err).Dispatch(ctx)
+		return
+	}
+
+	// 重连时浏览器通过 Last-Event-ID 传入最后收到的偏移量，命令行等客户端也可以使用 offset 参数
+	offset, err := strconv.ParseInt(ctx.GetHeader("Last-Event-ID"), 10, 64)
+	if err != nil {
+		offset = ctx.URLParamInt64Default("offset", 0)
+	}
+
+	ctx.ContentType("text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+
+	err = control.Logs(ctx.Request().Context(), &node, record.Id, offset, func(chunk *control.LogChunk) error {
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(ctx, "id: %d\ndata: %s\n\n", chunk.Offset+int64(len(chunk.Data)), data); err != nil {
+			return err
+		}
+		ctx.ResponseWriter().Flush()
+		return nil
+	})
+
+	if err != nil && err != context.Canceled {
+		if _, err := fmt.Fprintf(ctx, "event: error\ndata: %s\n\n", err.Error()); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
+	if _, err := fmt.Fprint(ctx, "event: end\ndata: {}\n\n"); err != nil {
+		log.Println(err)
+	}
+}
+
+// 使用原始执行记录中的流水线快照重新执行
+func (instance *Controller) Replay(id string, ctx iris.Context) mvc.Response {
+	record := models.PipelineRecords{}
+
+	exist, err := models.Engine.Id(id).Get(&record)
+	if err != nil {
+		return response.InternalServerError("查询执行记录失败", err)
+	}
+
+	if !exist {
+		return response.Coded(response.CODERUNNOTFOUND, response.NotFound("执行记录不存在"))
+	}
+
+	if record.Snapshot == "" {
+		return response.Send(400, "该执行记录没有保存流水线快照，无法重放", make(map[string]interface{}))
+	}
+
+	pipeline := &models.Pipeline{}
+	if err := json.Unmarshal([]byte(record.Snapshot), pipeline); err != nil {
+		return response.InternalServerError("解析流水线快照失败", err)
+	}
+
+	if resp, ok := accessible(ctx, &record); !ok {
+		return resp
+	}
+
+	// 超出项目预算时拒绝重放，推迟执行时由节点等到预算恢复后执行
+	warning, err := services.CheckBudget(pipeline, true)
+	if err != nil {
+		return response.Error("查询项目预算失败", err)
+	}
+
+	node := models.Node{}
+	if _, err := models.Engine.Id(record.NodeId).Get(&node); err != nil {
+		return response.InternalServerError("查询节点信息失败", err)
+	}
+
+	if node.Status != models.ONLINE {
+		return response.Coded(response.CODENODEOFFLINE, response.Send(400, "原执行节点不在线，无法重放", make(map[string]interface{})))
+	}
+
+	// 未传入关联ID时沿用原始执行的关联ID
+	correlation := ctx.GetHeader(models.CORRELATIONHEADER)
+	if correlation == "" {
+		correlation = record.CorrelationId
+	} else if !models.ValidCorrelationId(correlation) {
+		return response.ValidationError(fmt.Sprintf("%s 不能超过 %d 个字符，且只能包含字母、数字和 _.:/@+=-", models.CORRELATIONHEADER, models.CORRELATIONMAXLEN))
+	}
+
+	trigger := &models.Trigger{
+		Id:       models.NewRunId(),
+		Source:   models.TRIGGERREPLAY,
+		ReplayOf: record.Id,
+		Pipeline: pipeline,
+		Tags:     models.Tags{"user": utils.GetUID(ctx)}.Merge(record.Tags),
+
+		CorrelationId: correlation,
+		Parameters:    record.Parameters,
+	}
+
+	if err := control.Trigger(&node, trigger); err != nil {
+		return response.Coded(response.CODECONTROLUNAVAILABLE, response.BadGateway("下发重放指令失败", "原执行节点的控制服务不可用，请稍后重试", err))
+	}
+
+	if err := services.Audit(ctx, &record, "REPLAY PIPELINE"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	if correlation != "" {
+		ctx.Header(models.CORRELATIONHEADER, correlation)
+	}
+
+	if warning != "" {
+		return response.Success("重放指令已下发", response.Payload{"data": trigger, "warnings": []string{warning}})
+	}
+
+	return response.Success("重放指令已下发", response.Payload{"data": trigger})
+}
+
+// 获取流水线执行历史，支持按流水线、节点、状态、触发方式和开始时间筛选
+func (instance *Controller) Get(ctx iris.Context) mvc.Response {
+	page, limit, start := utils.Pagination(ctx)
+
+	visible, err := authority.Visible(utils.GetUID(ctx))
+	if err != nil {
+		return response.InternalServerError("获取用户信息失败", err)
+	}
+
+	// 只显示当前用户可见的流水线的执行记录
+	cond := builder.In("pipeline_id", builder.Select("id").From(new(models.Pipeline).TableName()).Where(visible))
+
+	for _, field := range []string{"pipeline_id", "node_id", "trigger", "group_id"} {
+		if value := ctx.URLParamDefault(field, ""); value != "" {
+			cond = cond.And(builder.Eq{field: value})
+		}
+	}
+
+	if status := ctx.URLParamIntDefault("status", -1); status >= 0 {
+		cond = cond.And(builder.Eq{"status": status})
+	}
+
+	// 按标签筛选，格式为 tag=name:value，可以指定多个
+	for _, tag := range ctx.Request().URL.Query()["tag"] {
+		cond = cond.And(tagged(tag))
+	}
+
+	period, err := between(ctx, "begin_with")
+	if err != nil {
+		return response.ValidationError(err.Error())
+	}
+
+	records := make([]models.PipelineRecords, 0)
+	total, err := models.Engine.Where(cond.And(period)).Limit(limit, start).Desc("begin_with").FindAndCount(&records)
+	if err != nil {
+		return response.InternalServerError("查询执行记录失败", err)
+	}
+
+	for index := range records {
+		records[index].Steps = make([]*models.TaskRecords, 0)
+	}
+
+	return response.Success("请求成功", response.Payload{
+		"data": records,
+		"meta": response.NewMeta(ctx, page, limit, total),
+	})
+}
+
+// 获取执行记录详情，包含每个步骤的执行记录
+func (instance *Controller) GetBy(id string, ctx iris.Context) mvc.Response {
+	record := models.PipelineRecords{}
+
+	exist, err := models.Engine.Id(id).Get(&record)
+	if err != nil {
+		return response.InternalServerError("查询执行记录失败", err)
+	}
+
+	if !exist {
+		return response.Coded(response.CODERUNNOTFOUND, response.NotFound("执行记录不存在"))
+	}
+
+	if resp, ok := accessible(ctx, &record); !ok {
+		return resp
+	}
+
+	if err := models.Engine.Where(builder.Eq{"pipeline_record_id": record.Id}).Asc("id").Find(&record.Steps); err != nil {
+		return response.InternalServerError("查询步骤执行记录失败", err)
+	}
+
+	if model := services.Cost(); model.Enabled() && record.Status != models.RECORDRUNNING {
+		record.Cost = model.Estimate(&record, record.Steps)
+	}
+
+	return response.Success("请求成功", response.Payload{"data": record})
+}
+
+// 获取任务执行历史，支持按任务、节点、状态、执行内容摘要和开始时间筛选
+func (instance *Controller) GetTasks(ctx iris.Context) mvc.Response {
+	page, limit, start := utils.Pagination(ctx)
+
+	visible, err := authority.Visible(utils.GetUID(ctx))
+	if err != nil {
+		return response.InternalServerError("获取用户信息失败", err)
+	}
+
+	pipelines := builder.Select("id").From(new(models.Pipeline).TableName()).Where(visible)
+	cond := builder.In("pipeline_record_id", builder.Select("id").From(new(models.PipelineRecords).TableName()).Where(builder.In("pipeline_id", pipelines)))
+
+	for _, field := range []string{"task_id", "node_id", "pipeline_record_id", "status", "command_hash"} {
+		if value := ctx.URLParamDefault(field, ""); value != "" {
+			cond = cond.And(builder.Eq{field: value})
+		}
+	}
+
+	period, err := between(ctx, "begin_with")
+	if err != nil {
+		return response.ValidationError(err.Error())
+	}
+
+	records := make([]models.TaskRecords, 0)
+	total, err := models.Engine.Where(cond.And(period)).Limit(limit, start).Desc("begin_with").FindAndCount(&records)
+	if err != nil {
+		return response.InternalServerError("查询任务执行记录失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{
+		"data": records,
+		"meta": response.NewMeta(ctx, page, limit, total),
+	})
+}
+
+// 检查当前用户是否可以访问执行记录，以流水线当前所属的团队为准，流水线已删除时使用快照中的团队
+func accessible(ctx iris.Context, record *models.PipelineRecords) (mvc.Response, bool) {
+	if err := authority.Check(utils.GetUID(ctx), record); err != nil {
+		return response.Error("查询流水线失败", err), false
+	}
+
+	return mvc.Response{}, true
+}
+
+// 构造标签的查询条件，标签以 JSON 保存，键按照字母顺序排列
+func tagged(tag string) builder.Cond {
+	parts := strings.SplitN(tag, ":", 2)
+	key, _ := json.Marshal(parts[0])
+	if len(parts) == 1 {
+		return builder.Like{"tags", string(key) + ":"}
+	}
+
+	value, _ := json.Marshal(parts[1])
+	return builder.Like{"tags", string(key) + ":" + string(value)}
+}
+
+// 根据 from 和 to 参数构造时间范围的查询条件，格式为 2006-01-02 或者 2006-01-02 15:04:05
+func between(ctx iris.Context, column string) (builder.Cond, error) {
+	cond := builder.NewCond()
+	for param, operator := range map[string]string{"from": ">=", "to": "<="} {
+		value := ctx.URLParamDefault(param, "")
+		if value == "" {
+			continue
+		}
+
+		moment, err := parseTime(value)
+		if err != nil {
+			return nil, err
+		}
+
+		if operator == ">=" {
+			cond = cond.And(builder.Gte{column: moment})
+		} else {
+			// 只指定日期时包含当天
+			if len(value) == len("2006-01-02") {
+				moment = moment.Add(24*time.Hour - time.Second)
+			}
+			cond = cond.And(builder.Lte{column: moment})
+		}
+	}
+
+	return cond, nil
+}
+
+// 解析筛选条件中的时间
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02"} {
+		if moment, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return moment, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("时间格式错误: %s", value)
+}
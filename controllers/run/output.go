@@ -0,0 +1,62 @@
+package run
+
+import (
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+)
+
+// 获取执行记录中各步骤保存的输出，可以通过 task_id 只获取指定任务的输出，超过大小限制的输出只保存了末尾部分
+func (instance *Controller) Output(id string, ctx iris.Context) mvc.Response {
+	record := models.PipelineRecords{}
+	exist, err := models.Engine.Id(id).Get(&record)
+	if err != nil {
+		return response.InternalServerError("查询执行记录失败", err)
+	}
+
+	if !exist {
+		return response.Coded(response.CODERUNNOTFOUND, response.NotFound("执行记录不存在"))
+	}
+
+	if resp, ok := accessible(ctx, &record); !ok {
+		return resp
+	}
+
+	cond := builder.Eq{"pipeline_record_id": id}
+	if taskId := ctx.URLParamDefault("task_id", ""); taskId != "" {
+		cond["task_id"] = taskId
+	}
+
+	steps := make([]models.TaskRecords, 0)
+	if err := models.Engine.Where(cond).Cols("id", "task_id", "task_name", "worker_name", "status", "exit_code", "truncated", "result", "stdout", "stderr", "begin_with", "finish_with").Asc("id").Find(&steps); err != nil {
+		return response.InternalServerError("查询步骤执行记录失败", err)
+	}
+
+	outputs := make([]map[string]interface{}, 0, len(steps))
+	for _, step := range steps {
+		outputs = append(outputs, map[string]interface{}{
+			"id":          step.Id,
+			"task_id":     step.TaskId,
+			"task_name":   step.TaskName,
+			"worker_name": step.WorkerName,
+			"status":      step.Status,
+			"exit_code":   step.ExitCode,
+			"truncated":   step.Truncated,
+			"result":      step.Result,
+			"stdout":      step.Stdout,
+			"stderr":      step.Stderr,
+			"begin_with":  step.BeginWith,
+			"finish_with": step.FinishWith,
+		})
+	}
+
+	return response.Success("请求成功", response.Payload{
+		"data": map[string]interface{}{
+			"id":     record.Id,
+			"status": record.Status,
+			"steps":  outputs,
+		},
+	})
+}
@@ -0,0 +1,182 @@
+package run
+
+import (
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"gopkg.in/go-playground/validator.v9"
+	"time"
+)
+
+type (
+	// 无需登录即可查看分享的执行记录
+	ShareController struct{}
+	ShareRequest    struct {
+		Note string `json:"note" validate:"max=255"`
+		// 有效小时数
+		Hours int `json:"hours" validate:"required,gte=1,lte=720"`
+	}
+)
+
+// 路由分发
+func (instance *ShareController) BeforeActivation(request mvc.BeforeActivation) {
+	request.Handle("GET", "/{token:string}/logs", "Logs")
+}
+
+// 获取执行记录的分享链接
+func (instance *Controller) Shares(id string, ctx iris.Context) mvc.Response {
+	record, resp, ok := shared(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	shares := make([]*models.RunShare, 0)
+	if err := models.Engine.Where(builder.Eq{"run_id": record.Id}).Desc("created_at").Find(&shares); err != nil {
+		return response.InternalServerError("获取分享链接失败", err)
+	}
+
+	links := make([]map[string]interface{}, 0, len(shares))
+	for _, share := range shares {
+		links = append(links, link(share, services.ShareToken(share)))
+	}
+
+	return response.Success("请求成功", response.Payload{"data": links})
+}
+
+// 创建执行记录的分享链接
+func (instance *Controller) AddShare(id string, ctx iris.Context) mvc.Response {
+	params := ShareRequest{}
+	if err := ctx.ReadJSON(&params); err != nil {
+		return response.InternalServerError("参数解析失败", err)
+	}
+
+	if err := validator.New().Struct(params); err != nil {
+		return response.ValidationError("有效期必须在 1 到 720 小时之间，备注不能超过 255 个字符")
+	}
+
+	record, resp, ok := shared(ctx, id)
+	if !ok {
+		return resp
+	}
+
+	ttl := time.Duration(params.Hours) * time.Hour
+	if ttl > models.SHAREMAXTTL {
+		ttl = models.SHAREMAXTTL
+	}
+
+	share, token, err := services.IssueShareLink(utils.GetUID(ctx), record, params.Note, ttl)
+	if err != nil {
+		return response.InternalServerError("创建分享链接失败", err)
+	}
+
+	if err := services.Audit(ctx, share, "SHARE RUN"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("创建成功", response.Payload{"data": link(share, token)})
+}
+
+// 撤销分享链接
+func (instance *Controller) RemoveShare(id, sid string, ctx iris.Context) mvc.Response {
+	if _, resp, ok := shared(ctx, id); !ok {
+		return resp
+	}
+
+	share := &models.RunShare{}
+	if exist, err := models.Engine.Where(builder.Eq{"id": sid, "run_id": id}).Get(share); err != nil {
+		return response.InternalServerError("查询分享链接失败", err)
+	} else if !exist {
+		return response.NotFound("分享链接不存在")
+	}
+
+	if err := share.Destroy(); err != nil {
+		return response.InternalServerError("撤销分享链接失败", err)
+	}
+
+	if err := services.Audit(ctx, share, "REVOKE SHARED RUN"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("撤销成功", response.Payload{"data": make(map[string]interface{})})
+}
+
+// 通过分享链接查看执行记录详情
+func (instance *ShareController) GetBy(token string, ctx iris.Context) mvc.Response {
+	record, resp, ok := visit(ctx, token)
+	if !ok {
+		return resp
+	}
+
+	if err := models.Engine.Where(builder.Eq{"pipeline_record_id": record.Id}).Asc("id").Find(&record.Steps); err != nil {
+		return response.InternalServerError("查询步骤执行记录失败", err)
+	}
+
+	pipeline := models.Pipeline{}
+	if _, err := models.Engine.Id(record.PipelineId).Cols("name").Get(&pipeline); err != nil {
+		return response.InternalServerError("查询流水线失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{"data": map[string]interface{}{
+		"record":   record,
+		"pipeline": pipeline.Name,
+	}})
+}
+
+// 通过分享链接实时查看正在执行的流水线的输出
+func (instance *ShareController) Logs(token string, ctx iris.Context) {
+	record, resp, ok := visit(ctx, token)
+	if !ok {
+		resp.Dispatch(ctx)
+		return
+	}
+
+	stream(ctx, record)
+}
+
+// 查询执行记录并检查当前用户是否可以分享
+func shared(ctx iris.Context, id string) (*models.PipelineRecords, mvc.Response, bool) {
+	record := &models.PipelineRecords{}
+	if exist, err := models.Engine.Id(id).Get(record); err != nil {
+		return nil, response.InternalServerError("查询执行记录失败", err), false
+	} else if !exist {
+		return nil, response.Coded(response.CODERUNNOTFOUND, response.NotFound("执行记录不存在")), false
+	}
+
+	if resp, ok := accessible(ctx, record); !ok {
+		return nil, resp, false
+	}
+
+	return record, mvc.Response{}, true
+}
+
+// 校验分享链接并查询分享的执行记录
+func visit(ctx iris.Context, token string) (*models.PipelineRecords, mvc.Response, bool) {
+	share, err := services.VisitShareLink(token, ctx.RemoteAddr())
+	if err == services.ErrInvalidShareLink {
+		return nil, response.Send(iris.StatusForbidden, err.Error(), make(map[string]interface{})), false
+	} else if err != nil {
+		return nil, response.InternalServerError("校验分享链接失败", err), false
+	}
+
+	record := &models.PipelineRecords{}
+	if exist, err := models.Engine.Id(share.RunId).Get(record); err != nil {
+		return nil, response.InternalServerError("查询执行记录失败", err), false
+	} else if !exist {
+		return nil, response.Coded(response.CODERUNNOTFOUND, response.NotFound("执行记录不存在")), false
+	}
+
+	return record, mvc.Response{}, true
+}
+
+// 分享链接的信息，令牌可以随时根据分享记录重新生成
+func link(share *models.RunShare, token string) map[string]interface{} {
+	return map[string]interface{}{
+		"share": share,
+		"token": token,
+		"path":  "/api/share/" + token,
+	}
+}
@@ -0,0 +1,13 @@
+package secret
+
+import (
+	"github.com/betterde/ects/internal/openapi"
+	"github.com/betterde/ects/models"
+)
+
+// 接口说明，用于生成 OpenAPI 文档
+var Operations = []openapi.Operation{
+	{Method: "GET", Path: "", Summary: "获取密钥列表，不返回密钥的值", Result: []models.Secret{}},
+	{Method: "POST", Path: "", Summary: "创建密钥", Body: models.Secret{}},
+	{Method: "DELETE", Path: "/{id}", Summary: "删除密钥"},
+}
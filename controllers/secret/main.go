@@ -0,0 +1,137 @@
+package secret
+
+import (
+	"github.com/betterde/ects/internal/message"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"github.com/satori/go.uuid"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type (
+	Controller struct{}
+)
+
+var (
+	validate = validator.New()
+)
+
+// 获取密钥列表，不返回密钥的值
+func (instance *Controller) Get(ctx iris.Context) mvc.Response {
+	secrets := make([]models.Secret, 0)
+	if err := models.Engine.Omit("cipher").Asc("name").Find(&secrets); err != nil {
+		return response.InternalServerError("获取密钥失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{"data": secrets})
+}
+
+// 创建密钥，值加密后保存，创建后不再返回
+func (instance *Controller) Post(ctx iris.Context) mvc.Response {
+	secret := models.Secret{}
+	if err := ctx.ReadJSON(&secret); err != nil {
+		return response.InternalServerError("参数解析失败", err)
+	}
+
+	if err := validate.Struct(secret); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return response.ValidationError(message.Get("secret", validationErrors))
+	}
+
+	if !models.SecretName.MatchString(secret.Name) {
+		return response.ValidationError("密钥名称只能包含字母、数字和下划线，且不能以数字开头")
+	}
+
+	count, err := models.Engine.Where(builder.Eq{"name": secret.Name}).Count(&models.Secret{})
+	if err != nil {
+		return response.InternalServerError("查询密钥失败", err)
+	}
+
+	if count > 0 {
+		return response.Send(400, "密钥名称已存在", make(map[string]interface{}))
+	}
+
+	secret.Id = uuid.NewV4().String()
+	if err := secret.Store(); err != nil {
+		if err == models.ErrSecretKey {
+			return response.Send(400, err.Error(), make(map[string]interface{}))
+		}
+		return response.InternalServerError("创建密钥失败", err)
+	}
+
+	if err := services.Audit(ctx, &secret, "CREATE SECRET"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("创建成功", response.Payload{"data": secret})
+}
+
+// 删除密钥，仍有任务引用时不能删除
+func (instance *Controller) DeleteBy(id string, ctx iris.Context) mvc.Response {
+	secret := models.Secret{}
+	if exist, err := models.Engine.Id(id).Get(&secret); err != nil {
+		return response.InternalServerError("查询密钥失败", err)
+	} else if !exist {
+		return response.NotFound("密钥不存在")
+	}
+
+	tasks := make([]models.Task, 0)
+	if err := models.Engine.Cols("id", "name", "content", "url", "env", "variables").Find(&tasks); err != nil {
+		return response.InternalServerError("查询引用密钥的任务失败", err)
+	}
+
+	for _, task := range tasks {
+		texts := append([]string{task.Content, task.Url}, task.Env...)
+		for _, value := range task.Variables {
+			texts = append(texts, value)
+		}
+
+		for _, name := range models.SecretNames(texts...) {
+			if name == secret.Name {
+				return response.Send(400, "任务 "+task.Name+" 仍在引用该密钥", make(map[string]interface{}))
+			}
+		}
+	}
+
+	pipelines := make([]models.Pipeline, 0)
+	if err := models.Engine.Where(builder.Like{"variables", "secret."}).Cols("id", "name", "variables").Find(&pipelines); err != nil {
+		return response.InternalServerError("查询引用密钥的流水线失败", err)
+	}
+
+	for _, pipeline := range pipelines {
+		for _, value := range pipeline.Variables {
+			for _, name := range models.SecretNames(value) {
+				if name == secret.Name {
+					return response.Send(400, "流水线 "+pipeline.Name+" 的环境变量仍在引用该密钥", make(map[string]interface{}))
+				}
+			}
+		}
+	}
+
+	pivots := make([]models.PipelineTaskPivot, 0)
+	if err := models.Engine.Where(builder.Like{"environment", "secret."}).Cols("pipeline_id", "environment").Find(&pivots); err != nil {
+		return response.InternalServerError("查询引用密钥的步骤失败", err)
+	}
+
+	for _, pivot := range pivots {
+		for _, name := range models.SecretNames(pivot.Environment) {
+			if name == secret.Name {
+				return response.Send(400, "流水线 "+pivot.PipelineId+" 的步骤仍在引用该密钥", make(map[string]interface{}))
+			}
+		}
+	}
+
+	if err := secret.Destroy(); err != nil {
+		return response.InternalServerError("删除密钥失败", err)
+	}
+
+	if err := services.Audit(ctx, &secret, "DELETE SECRET"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("删除成功", response.Payload{"data": make(map[string]interface{})})
+}
@@ -0,0 +1,24 @@
+package setting
+
+import (
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/openapi"
+	"github.com/betterde/ects/models"
+)
+
+// 接口说明，用于生成 OpenAPI 文档
+var Operations = []openapi.Operation{
+	{Method: "GET", Path: "/notification", Summary: "获取通知配置信息"},
+	{Method: "PUT", Path: "/notification", Summary: "更新服务配置", Body: config.Notification{}},
+	{Method: "POST", Path: "/mail", Summary: "测试发送邮件功能", Body: struct {
+		Email string `json:"email" validate:"email"`
+	}{}},
+	{Method: "GET", Path: "/templates", Summary: "获取通知模板列表", Result: []models.NotificationTemplate{}, Query: []openapi.Parameter{
+		{Name: "channel"},
+		{Name: "project_id"},
+	}},
+	{Method: "POST", Path: "/template", Summary: "创建通知模板", Body: models.NotificationTemplate{}},
+	{Method: "PUT", Path: "/template/{id}", Summary: "更新通知模板", Body: models.NotificationTemplate{}},
+	{Method: "DELETE", Path: "/template/{id}", Summary: "删除通知模板"},
+	{Method: "POST", Path: "/template/preview", Summary: "预览模板渲染结果", Body: PreviewRequest{}},
+}
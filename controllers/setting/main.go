@@ -6,17 +6,30 @@ import (
 	"fmt"
 	"github.com/betterde/ects/config"
 	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/internal/message"
 	"github.com/betterde/ects/internal/notify"
 	"github.com/betterde/ects/internal/response"
 	"github.com/betterde/ects/internal/utils"
 	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/go-xorm/builder"
 	"github.com/kataras/iris"
 	"github.com/kataras/iris/mvc"
+	"github.com/satori/go.uuid"
+	"gopkg.in/go-playground/validator.v9"
 	"time"
 )
 
 type (
-	Controller struct{}
+	Controller     struct{}
+	PreviewRequest struct {
+		models.NotificationTemplate
+		RecordId string `json:"record_id" validate:"omitempty,uuid4"`
+	}
+)
+
+var (
+	validate = validator.New()
 )
 
 // 获取通知配置信息
@@ -87,9 +100,180 @@ func (instance *Controller) PutNotification(ctx iris.Context) mvc.Response {
 		return response.InternalServerError("序列化失败", err)
 	}
 
-	if _, err := discover.Client.Put(context.TODO(), config.Conf.Etcd.Config, string(bytes)); err != nil {
-		return response.InternalServerError("更新配置失败", err)
+	if err := discover.Put(config.Conf.Etcd.Config, string(bytes)); err != nil {
+		return response.BadGateway("更新配置失败", "请稍后重试", err)
+	}
+
+	if err := discover.PutAgentConf(config.Conf.Etcd.Config); err != nil {
+		return response.BadGateway("更新代理模式的配置失败", "请稍后重试", err)
 	}
 
 	return response.Success("请求成功", response.Payload{"data": params})
 }
+
+// 获取通知模板列表
+func (instance *Controller) GetTemplates(ctx iris.Context) mvc.Response {
+	templates := make([]models.NotificationTemplate, 0)
+	cond := builder.NewCond()
+
+	if channel := ctx.URLParamDefault("channel", ""); channel != "" {
+		cond = cond.And(builder.Eq{"channel": channel})
+	}
+
+	if projectId := ctx.URLParamDefault("project_id", ""); projectId != "" {
+		cond = cond.And(builder.Eq{"project_id": projectId})
+	}
+
+	if err := models.Engine.Where(cond).Asc("channel", "event").Find(&templates); err != nil {
+		return response.InternalServerError("获取通知模板失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{"data": templates})
+}
+
+// 创建通知模板
+func (instance *Controller) PostTemplate(ctx iris.Context) mvc.Response {
+	tpl := models.NotificationTemplate{}
+
+	if err := ctx.ReadJSON(&tpl); err != nil {
+		return response.InternalServerError("参数解析失败", err)
+	}
+
+	if resp, ok := validateTemplate(&tpl); !ok {
+		return resp
+	}
+
+	count, err := models.Engine.Where(builder.Eq{"channel": tpl.Channel, "event": tpl.Event, "project_id": tpl.ProjectId}).Count(&models.NotificationTemplate{})
+	if err != nil {
+		return response.InternalServerError("查询通知模板失败", err)
+	}
+
+	if count > 0 {
+		return response.Send(400, "该渠道和事件的模板已存在", make(map[string]interface{}))
+	}
+
+	tpl.Id = uuid.NewV4().String()
+	if err := tpl.Store(); err != nil {
+		return response.InternalServerError("创建通知模板失败", err)
+	}
+
+	if err := services.Audit(ctx, &tpl, "CREATE TEMPLATE"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("创建成功", response.Payload{"data": tpl})
+}
+
+// 更新通知模板
+func (instance *Controller) PutTemplateBy(id string, ctx iris.Context) mvc.Response {
+	tpl := models.NotificationTemplate{}
+
+	if err := ctx.ReadJSON(&tpl); err != nil {
+		return response.InternalServerError("参数解析失败", err)
+	}
+
+	if resp, ok := validateTemplate(&tpl); !ok {
+		return resp
+	}
+
+	tpl.Id = id
+	if err := tpl.Update(); err != nil {
+		return response.InternalServerError("更新通知模板失败", err)
+	}
+
+	if err := services.Audit(ctx, &tpl, "UPDATE TEMPLATE"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("更新成功", response.Payload{"data": tpl})
+}
+
+// 删除通知模板，删除后将使用上一级模板
+func (instance *Controller) DeleteTemplateBy(id string, ctx iris.Context) mvc.Response {
+	tpl := models.NotificationTemplate{
+		Id: id,
+	}
+
+	if err := tpl.Destroy(); err != nil {
+		return response.InternalServerError("删除通知模板失败", err)
+	}
+
+	if err := services.Audit(ctx, &tpl, "DELETE TEMPLATE"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("删除成功", response.Payload{"data": make(map[string]interface{})})
+}
+
+// 使用指定的执行记录预览模板渲染结果，未指定时使用最近一次执行记录
+func (instance *Controller) PostTemplatePreview(ctx iris.Context) mvc.Response {
+	params := PreviewRequest{}
+
+	if err := ctx.ReadJSON(&params); err != nil {
+		return response.InternalServerError("参数解析失败", err)
+	}
+
+	if resp, ok := validateTemplate(&params.NotificationTemplate); !ok {
+		return resp
+	}
+
+	record := &models.PipelineRecords{}
+	session := models.Engine.Desc("created_at")
+	if params.RecordId != "" {
+		session = session.Where(builder.Eq{"id": params.RecordId})
+	}
+
+	exist, err := session.Get(record)
+	if err != nil {
+		return response.InternalServerError("查询执行记录失败", err)
+	}
+
+	if !exist {
+		return response.NotFound("没有可用于预览的执行记录")
+	}
+
+	pipeline := &models.Pipeline{}
+	if _, err := models.Engine.Id(record.PipelineId).Get(pipeline); err != nil {
+		return response.InternalServerError("查询流水线失败", err)
+	}
+
+	steps := make([]*models.TaskRecords, 0)
+	if err := models.Engine.Where(builder.Eq{"pipeline_record_id": record.Id}).Find(&steps); err != nil {
+		return response.InternalServerError("查询任务执行记录失败", err)
+	}
+
+	subject, content, err := notify.Execute(&params.NotificationTemplate, &notify.Context{
+		Pipeline: pipeline,
+		Record:   record,
+		Steps:    steps,
+		Event:    params.Event,
+		// 执行组的汇总通知使用示例数据预览
+		Group: &models.RunGroup{Id: record.Id, PipelineId: pipeline.Id, Kind: models.GROUPFANOUT, Status: models.GROUPFAILED, Total: 10, Succeeded: 8, Failed: 1, Pending: 1},
+	})
+	if err != nil {
+		return response.ValidationError(err.Error())
+	}
+
+	return response.Success("请求成功", response.Payload{"data": map[string]string{
+		"subject": subject,
+		"content": content,
+	}})
+}
+
+// 校验模板参数和语法
+func validateTemplate(tpl *models.NotificationTemplate) (mvc.Response, bool) {
+	if err := validate.Struct(tpl); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return response.ValidationError(message.Get("setting", validationErrors)), false
+	}
+
+	if tpl.Channel == models.CHANNELMAIL && tpl.Subject == "" {
+		return response.ValidationError("请填写邮件标题模板"), false
+	}
+
+	if err := notify.Parse(tpl); err != nil {
+		return response.ValidationError(fmt.Sprintf("模板语法错误：%s", err.Error())), false
+	}
+
+	return mvc.Response{}, true
+}
@@ -0,0 +1,18 @@
+package system
+
+import (
+	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/internal/openapi"
+)
+
+// 接口说明，用于生成 OpenAPI 文档
+var Operations = []openapi.Operation{
+	{Method: "GET", Path: "/integrity", Summary: "检查数据一致性"},
+	{Method: "POST", Path: "/integrity/repair", Summary: "修复数据一致性问题"},
+	{Method: "GET", Path: "/state-snapshot", Summary: "导出 ETCD 中流水线、节点和系统配置的一致性快照", Result: discover.Snapshot{}, Query: []openapi.Parameter{
+		{Name: "download", Description: "为 true 时作为附件下载"},
+	}},
+	{Method: "POST", Path: "/state-snapshot/restore", Summary: "将快照恢复到当前 ETCD 集群", Body: discover.Snapshot{}, Result: discover.Restoration{}, Query: []openapi.Parameter{
+		{Name: "prune", Description: "为 true 时删除快照中不存在的流水线"},
+	}},
+}
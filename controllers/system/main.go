@@ -0,0 +1,97 @@
+package system
+
+import (
+	"fmt"
+	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/internal/doctor"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/services"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+)
+
+type (
+	Controller struct{}
+)
+
+// 路由分发
+func (instance *Controller) BeforeActivation(request mvc.BeforeActivation) {
+	request.Handle("GET", "/state-snapshot", "StateSnapshot")
+	request.Handle("POST", "/state-snapshot/restore", "RestoreStateSnapshot")
+}
+
+// 检查数据一致性
+func (instance *Controller) GetIntegrity() mvc.Response {
+	report, err := doctor.Check()
+	if err != nil {
+		return response.InternalServerError("数据一致性检查失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{"data": report})
+}
+
+// 修复数据一致性问题
+func (instance *Controller) PostIntegrityRepair(ctx iris.Context) mvc.Response {
+	report, err := doctor.Check()
+	if err != nil {
+		return response.InternalServerError("数据一致性检查失败", err)
+	}
+
+	repaired, err := doctor.Repair(report)
+	if err != nil {
+		return response.InternalServerError("修复数据一致性问题失败", err)
+	}
+
+	if repaired > 0 {
+		if err := services.Audit(ctx, report, "REPAIR INTEGRITY"); err != nil {
+			return response.InternalServerError("创建日志失败", err)
+		}
+	}
+
+	return response.Success("修复成功", response.Payload{"data": map[string]interface{}{
+		"repaired": repaired,
+		"issues":   report.Issues,
+	}})
+}
+
+// 导出 ETCD 中流水线、节点和系统配置在同一修订版本下的快照，用于迁移到其他 ETCD 集群
+func (instance *Controller) StateSnapshot(ctx iris.Context) mvc.Response {
+	snapshot, err := discover.TakeSnapshot()
+	if err != nil {
+		return response.BadGateway("导出 ETCD 快照失败", "请检查 ETCD 集群的状态", err)
+	}
+
+	// 下载的文件只包含快照本身，可以直接用于恢复
+	if ctx.URLParamDefault("download", "") == "true" {
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=ects-state-%d.json", snapshot.Revision))
+		return mvc.Response{Code: iris.StatusOK, Object: snapshot}
+	}
+
+	return response.Success("请求成功", response.Payload{"data": snapshot})
+}
+
+// 将导出的快照恢复到当前 ETCD 集群，prune 为 true 时删除快照中不存在的流水线
+func (instance *Controller) RestoreStateSnapshot(ctx iris.Context) mvc.Response {
+	snapshot := discover.Snapshot{}
+	if err := ctx.ReadJSON(&snapshot); err != nil {
+		return response.ValidationError("快照格式错误")
+	}
+
+	restoration, err := discover.RestoreSnapshot(&snapshot, ctx.URLParamDefault("prune", "") == "true")
+	if err == discover.ErrNotLeader {
+		return response.Send(iris.StatusServiceUnavailable, "主节点正在切换，请稍后重试", make(map[string]interface{}))
+	}
+
+	if err != nil {
+		if restoration == nil {
+			return response.ValidationError(err.Error())
+		}
+		return response.BadGateway("恢复 ETCD 快照失败", "已经写入的流水线不会回滚，请检查 ETCD 集群的状态后重试", err)
+	}
+
+	if err := services.Audit(ctx, restoration, "RESTORE STATE SNAPSHOT"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("恢复成功", response.Payload{"data": restoration})
+}
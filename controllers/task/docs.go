@@ -0,0 +1,26 @@
+package task
+
+import (
+	"github.com/betterde/ects/internal/openapi"
+	"github.com/betterde/ects/models"
+)
+
+// 接口说明，用于生成 OpenAPI 文档
+var Operations = []openapi.Operation{
+	{Method: "GET", Path: "", Summary: "获取任务列表", Paged: true, Result: []models.Task{}, Query: []openapi.Parameter{
+		{Name: "search", Description: "按照名称搜索"},
+	}},
+	{Method: "POST", Path: "", Summary: "创建任务", Body: models.Task{}, Result: models.Task{}},
+	{Method: "PUT", Path: "/{id}", Summary: "更新任务", Body: UpdateRequest{}},
+	{Method: "DELETE", Path: "/{id}", Summary: "删除任务"},
+}
+
+// 任务模板的接口说明
+var TemplateOperations = []openapi.Operation{
+	{Method: "GET", Path: "", Summary: "获取任务模板列表", Result: []models.TaskTemplate{}},
+	{Method: "GET", Path: "/{id}", Summary: "获取任务模板", Result: models.TaskTemplate{}},
+	{Method: "POST", Path: "", Summary: "创建任务模板", Body: models.TaskTemplate{}, Result: models.TaskTemplate{}},
+	{Method: "PUT", Path: "/{id}", Summary: "更新任务模板", Body: models.TaskTemplate{}, Result: models.TaskTemplate{}},
+	{Method: "DELETE", Path: "/{id}", Summary: "删除任务模板"},
+	{Method: "POST", Path: "/{id}/tasks", Summary: "填写参数从模板创建任务，可以同时绑定到流水线", Body: TemplateTaskRequest{}, Result: models.PipelineTaskPivot{}},
+}
@@ -1,7 +1,8 @@
 package task
 
 import (
-	"github.com/betterde/ects/internal/message"
+	"fmt"
+	"github.com/betterde/ects/internal/request"
 	"github.com/betterde/ects/internal/response"
 	"github.com/betterde/ects/internal/utils"
 	"github.com/betterde/ects/models"
@@ -10,8 +11,10 @@ import (
 	"github.com/kataras/iris"
 	"github.com/kataras/iris/mvc"
 	"github.com/satori/go.uuid"
-	"gopkg.in/go-playground/validator.v9"
 	"log"
+	"path"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -21,14 +24,31 @@ type (
 	}
 
 	UpdateRequest struct {
-		Name        string `json:"name" validate:"required"`
-		Content     string `json:"content" validate:"required"`
-		Description string `json:"description"`
+		Name          string           `json:"name" validate:"required"`
+		Content       string           `json:"content" validate:"required"`
+		Description   string           `json:"description"`
+		Requirements  []string         `json:"requirements"`
+		Locality      []string         `json:"locality" validate:"omitempty,dive,max=255"`
+		Image         string           `json:"image"`
+		Env           []string         `json:"env"`
+		Volumes       []string         `json:"volumes"`
+		Network       string           `json:"network"`
+		Sandbox       bool             `json:"sandbox"`
+		StreamUrl     string           `json:"stream_url" validate:"omitempty,url"`
+		Timeout       int              `json:"timeout" validate:"gte=0"`
+		Retries       int              `json:"retries" validate:"gte=0,lte=10"`
+		RetryInterval int              `json:"retry_interval" validate:"gte=0,lte=3600"`
+		Backoff       float64          `json:"backoff" validate:"gte=0,lte=10"`
+		RateLimit     string           `json:"rate_limit" validate:"max=64"`
+		Variables     models.Variables `json:"variables" validate:"omitempty,dive,max=4096"`
 	}
 )
 
 var (
-	validate = validator.New()
+	// Docker 网络名称和镜像名称允许的字符
+	networkPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	imagePattern   = regexp.MustCompile(`^[a-z0-9][a-zA-Z0-9_.\-/:@]*$`)
+	envPattern     = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*=`)
 )
 
 // 获取任务列表
@@ -57,11 +77,7 @@ func (instance *Controller) Get(ctx iris.Context) mvc.Result {
 
 		return response.Success("请求成功", response.Payload{
 			"data": tasks,
-			"meta": &response.Meta{
-				Limit: limit,
-				Page:  page,
-				Total: int(total),
-			}})
+			"meta": response.NewMeta(ctx, page, limit, total)})
 	case "selector":
 		if err := models.Engine.Find(&tasks); err != nil {
 			return response.InternalServerError("查询任务列表失败", err)
@@ -75,13 +91,20 @@ func (instance *Controller) Get(ctx iris.Context) mvc.Result {
 func (instance *Controller) Post(ctx iris.Context) mvc.Result {
 	task := models.Task{}
 
-	if err := ctx.ReadJSON(&task); err != nil {
-		return response.InternalServerError("参数解析失败", err)
+	if resp, ok := request.Bind(ctx, "task", &task); !ok {
+		return resp
 	}
 
-	if err := validate.Struct(task); err != nil {
-		validationErrors := err.(validator.ValidationErrors)
-		return response.ValidationError(message.Get("task", validationErrors))
+	if resp, ok := checkDocker(&task); !ok {
+		return resp
+	}
+
+	if resp, ok := checkRateLimit(&task); !ok {
+		return resp
+	}
+
+	if err := task.Variables.Check(); err != nil {
+		return response.ValidationError(err.Error())
 	}
 
 	task.Id = uuid.NewV4().String()
@@ -90,40 +113,76 @@ func (instance *Controller) Post(ctx iris.Context) mvc.Result {
 		return response.InternalServerError("Failed to create taks", err)
 	}
 
+	if err := services.Audit(ctx, &task, "CREATE TASK"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
 	return response.Success("Created successful", response.Payload{"data": task})
 }
 
 // 更新任务
 func (instance *Controller) PutBy(id string, ctx iris.Context) mvc.Result {
 	var params UpdateRequest
-	validate := validator.New()
 
-	if err := ctx.ReadJSON(&params); err != nil {
-		return response.InternalServerError("参数解析失败", err)
+	if resp, ok := request.Bind(ctx, "task", &params); !ok {
+		return resp
 	}
 
-	if err := validate.Struct(params); err != nil {
-		validationErrors := err.(validator.ValidationErrors)
-		return response.ValidationError(message.Get("task", validationErrors))
+	origin := &models.Task{}
+	if exist, err := models.Engine.Id(id).Get(origin); err != nil {
+		return response.InternalServerError("查询任务失败", err)
+	} else if !exist {
+		return response.Coded(response.CODETASKNOTFOUND, response.NotFound("任务不存在"))
 	}
 
 	task := &models.Task{
-		Id:          id,
-		Name:        params.Name,
-		Content:     params.Content,
-		Description: params.Description,
-		UpdatedAt:   utils.Time(time.Now()),
+		Id:            id,
+		Name:          params.Name,
+		Mode:          origin.Mode,
+		Content:       params.Content,
+		Description:   params.Description,
+		Requirements:  params.Requirements,
+		Locality:      params.Locality,
+		Image:         params.Image,
+		Env:           params.Env,
+		Volumes:       params.Volumes,
+		Network:       params.Network,
+		Sandbox:       params.Sandbox,
+		StreamUrl:     params.StreamUrl,
+		Timeout:       params.Timeout,
+		Retries:       params.Retries,
+		RetryInterval: params.RetryInterval,
+		Backoff:       params.Backoff,
+		RateLimit:     params.RateLimit,
+		Variables:     params.Variables,
+		UpdatedAt:     utils.Time(time.Now()),
+	}
+
+	if resp, ok := checkDocker(task); !ok {
+		return resp
+	}
+
+	if resp, ok := checkRateLimit(task); !ok {
+		return resp
+	}
+
+	if err := task.Variables.Check(); err != nil {
+		return response.ValidationError(err.Error())
 	}
 
 	if err := task.Update(); err != err {
 		return response.InternalServerError("更新失败", err)
 	}
 
+	if err := services.Audit(ctx, task, "UPDATE TASK"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
 	return response.Success("更新成功", response.Payload{"data": task})
 }
 
 // 删除任务
-func (instance *Controller) DeleteBy(id string) mvc.Result {
+func (instance *Controller) DeleteBy(id string, ctx iris.Context) mvc.Result {
 	task := &models.Task{
 		Id: id,
 	}
@@ -132,5 +191,72 @@ func (instance *Controller) DeleteBy(id string) mvc.Result {
 		return response.InternalServerError("Failed to deleted task", err)
 	}
 
+	if err := services.Audit(ctx, task, "DELETE TASK"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
 	return response.Success("Deleted successful", response.Payload{"data": make(map[string]interface{})})
 }
+
+// 校验任务引用的限流分组是否存在
+func checkRateLimit(task *models.Task) (mvc.Result, bool) {
+	if task.RateLimit == "" {
+		return nil, true
+	}
+
+	count, err := models.Engine.Where(builder.Eq{"name": task.RateLimit}).Count(&models.RateLimit{})
+	if err != nil {
+		return response.InternalServerError("查询限流分组失败", err), false
+	}
+
+	if count == 0 {
+		return response.ValidationError("限流分组不存在"), false
+	}
+
+	return nil, true
+}
+
+// 校验 Docker 任务的镜像、环境变量、挂载卷和网络，其他类型的任务清空这些字段，非 Shell 任务清空沙箱选项
+func checkDocker(task *models.Task) (mvc.Result, bool) {
+	// 沙箱只用于在节点上直接执行的 Shell 任务
+	if task.Mode != models.MODESHELL {
+		task.Sandbox = false
+	}
+
+	if task.Mode != models.MODEDOCKER {
+		task.Image, task.Env, task.Volumes, task.Network = "", nil, nil, ""
+		return nil, true
+	}
+
+	if task.Image == "" {
+		return response.ValidationError("请填写 Docker 镜像"), false
+	}
+
+	if !imagePattern.MatchString(task.Image) {
+		return response.ValidationError("Docker 镜像名称格式有误"), false
+	}
+
+	for _, env := range task.Env {
+		if !envPattern.MatchString(env) {
+			return response.ValidationError(fmt.Sprintf("环境变量 %s 格式有误，应为 KEY=VALUE", env)), false
+		}
+	}
+
+	// 挂载卷格式为 宿主机路径:容器路径[:ro|rw]，宿主机路径也可以是命名卷
+	for _, volume := range task.Volumes {
+		parts := strings.Split(volume, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || !path.IsAbs(parts[1]) {
+			return response.ValidationError(fmt.Sprintf("挂载卷 %s 格式有误，应为 宿主机路径:容器路径[:ro|rw]", volume)), false
+		}
+
+		if len(parts) == 3 && parts[2] != "ro" && parts[2] != "rw" {
+			return response.ValidationError(fmt.Sprintf("挂载卷 %s 的访问模式只能是 ro 或 rw", volume)), false
+		}
+	}
+
+	if task.Network != "" && !networkPattern.MatchString(task.Network) {
+		return response.ValidationError("Docker 网络名称格式有误"), false
+	}
+
+	return nil, true
+}
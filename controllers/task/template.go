@@ -0,0 +1,270 @@
+package task
+
+import (
+	"github.com/betterde/ects/internal/request"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"github.com/satori/go.uuid"
+	"log"
+)
+
+type (
+	TemplateController struct{}
+
+	// 从模板创建任务，指定流水线时同时绑定为流水线的最后一个步骤
+	TemplateTaskRequest struct {
+		Name       string           `json:"name" validate:"max=255"`
+		Parameters models.Variables `json:"parameters" validate:"omitempty,dive,max=4096"`
+		PipelineId string           `json:"pipeline_id" validate:"omitempty,uuid4"`
+	}
+)
+
+var pipelines = services.NewPipelineService()
+
+// 路由分发
+func (instance *TemplateController) BeforeActivation(request mvc.BeforeActivation) {
+	request.Handle("POST", "/{id:string}/tasks", "CreateTask")
+}
+
+// 获取任务模板列表
+func (instance *TemplateController) Get(ctx iris.Context) mvc.Response {
+	templates := make([]models.TaskTemplate, 0)
+	if err := models.Engine.Asc("name").Find(&templates); err != nil {
+		return response.InternalServerError("查询任务模板失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{"data": templates})
+}
+
+// 获取任务模板
+func (instance *TemplateController) GetBy(id string) mvc.Response {
+	template, resp, ok := findTemplate(id)
+	if !ok {
+		return resp
+	}
+
+	return response.Success("请求成功", response.Payload{"data": template})
+}
+
+// 创建任务模板
+func (instance *TemplateController) Post(ctx iris.Context) mvc.Response {
+	template := models.TaskTemplate{}
+	if resp, ok := request.Bind(ctx, "task", &template); !ok {
+		return resp
+	}
+
+	if err := template.Check(); err != nil {
+		return response.ValidationError(err.Error())
+	}
+
+	if exist, err := models.Engine.Where(builder.Eq{"name": template.Name}).Exist(&models.TaskTemplate{}); err != nil {
+		return response.InternalServerError("查询任务模板失败", err)
+	} else if exist {
+		return response.Send(iris.StatusConflict, "任务模板名称已存在", make(map[string]interface{}))
+	}
+
+	template.Id = uuid.NewV4().String()
+	if err := template.Store(); err != nil {
+		return response.InternalServerError("创建任务模板失败", err)
+	}
+
+	if err := services.Audit(ctx, &template, "CREATE TASK TEMPLATE"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("创建成功", response.Payload{"data": template})
+}
+
+// 更新任务模板，已经从模板创建的任务不受影响
+func (instance *TemplateController) PutBy(id string, ctx iris.Context) mvc.Response {
+	origin, resp, ok := findTemplate(id)
+	if !ok {
+		return resp
+	}
+
+	template := models.TaskTemplate{}
+	if resp, ok := request.Bind(ctx, "task", &template); !ok {
+		return resp
+	}
+
+	if err := template.Check(); err != nil {
+		return response.ValidationError(err.Error())
+	}
+
+	if template.Name != origin.Name {
+		if exist, err := models.Engine.Where(builder.Eq{"name": template.Name}).Exist(&models.TaskTemplate{}); err != nil {
+			return response.InternalServerError("查询任务模板失败", err)
+		} else if exist {
+			return response.Send(iris.StatusConflict, "任务模板名称已存在", make(map[string]interface{}))
+		}
+	}
+
+	template.Id = id
+	if err := template.Update(); err != nil {
+		return response.InternalServerError("更新任务模板失败", err)
+	}
+
+	if err := services.Audit(ctx, &template, "UPDATE TASK TEMPLATE"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("更新成功", response.Payload{"data": template})
+}
+
+// 删除任务模板
+func (instance *TemplateController) DeleteBy(id string, ctx iris.Context) mvc.Response {
+	template, resp, ok := findTemplate(id)
+	if !ok {
+		return resp
+	}
+
+	if err := template.Destroy(); err != nil {
+		return response.InternalServerError("删除任务模板失败", err)
+	}
+
+	if err := services.Audit(ctx, template, "DELETE TASK TEMPLATE"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("删除成功", response.Payload{"data": make(map[string]interface{})})
+}
+
+// 填写参数替换模板中的占位符创建任务，指定流水线时同时绑定到流水线
+func (instance *TemplateController) CreateTask(id string, ctx iris.Context) mvc.Result {
+	params := TemplateTaskRequest{}
+	if resp, ok := request.Bind(ctx, "task", &params); !ok {
+		return resp
+	}
+
+	template, resp, ok := findTemplate(id)
+	if !ok {
+		return resp
+	}
+
+	task, err := template.Render(params.Name, params.Parameters)
+	if err != nil {
+		return response.ValidationError(err.Error())
+	}
+
+	if resp, ok := request.Validate("task", task); !ok {
+		return resp
+	}
+
+	if resp, ok := checkDocker(task); !ok {
+		return resp
+	}
+
+	if err := task.Variables.Check(); err != nil {
+		return response.ValidationError(err.Error())
+	}
+
+	var pipeline *models.Pipeline
+	if params.PipelineId != "" {
+		if pipeline, err = pipelines.Find(utils.GetUID(ctx), params.PipelineId); err != nil {
+			return response.Error("查询流水线失败", err)
+		}
+	}
+
+	task.Id = uuid.NewV4().String()
+	pivot, err := storeTask(task, pipeline)
+	if err != nil {
+		return response.InternalServerError("创建任务失败", err)
+	}
+
+	if err := services.Audit(ctx, task, "CREATE TASK"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	if pivot == nil {
+		return response.Success("创建成功", response.Payload{"data": task})
+	}
+
+	services.MarkSynced(pipeline.Id, false)
+
+	if _, err := services.RecordVersion(ctx, pipeline.Id, "BIND TASK"); err != nil {
+		return response.InternalServerError("保存流水线版本失败", err)
+	}
+
+	if err := services.Audit(ctx, pivot, "BIND TASK"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	// 检查已绑定的节点是否满足任务的环境依赖
+	warnings, err := services.CheckRequirements(pipeline.Id, nil)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return response.Success("创建成功", response.Payload{"data": pivot, "warnings": warnings})
+}
+
+// 查询任务模板
+func findTemplate(id string) (*models.TaskTemplate, mvc.Response, bool) {
+	template := &models.TaskTemplate{}
+	exist, err := models.Engine.Id(id).Get(template)
+	if err != nil {
+		return nil, response.InternalServerError("查询任务模板失败", err), false
+	}
+
+	if !exist {
+		return nil, response.NotFound("任务模板不存在"), false
+	}
+
+	return template, mvc.Response{}, true
+}
+
+// 在同一个事务中创建任务，指定流水线时追加为流水线的最后一个步骤
+func storeTask(task *models.Task, pipeline *models.Pipeline) (*models.PipelineTaskPivot, error) {
+	session := models.Engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+
+	rollback := func(err error) (*models.PipelineTaskPivot, error) {
+		if err := session.Rollback(); err != nil {
+			log.Println(err)
+		}
+		return nil, err
+	}
+
+	if _, err := session.InsertOne(task); err != nil {
+		return rollback(err)
+	}
+
+	var pivot *models.PipelineTaskPivot
+	if pipeline != nil {
+		// 锁定流水线，避免并发绑定时步骤序号重复
+		if _, err := session.ForUpdate().Id(pipeline.Id).Get(&models.Pipeline{}); err != nil {
+			return rollback(err)
+		}
+
+		count, err := session.Where(builder.Eq{"pipeline_id": pipeline.Id}).Count(&models.PipelineTaskPivot{})
+		if err != nil {
+			return rollback(err)
+		}
+
+		pivot = &models.PipelineTaskPivot{
+			Id:         uuid.NewV4().String(),
+			PipelineId: pipeline.Id,
+			TaskId:     task.Id,
+			Step:       int(count) + 1,
+			Dependence: models.DEPENDENCESTRONG,
+			Condition:  models.CONDITIONSUCCESS,
+			LogLevel:   models.LOGFULL,
+			Inherit:    models.INHERITALL,
+			Task:       task,
+		}
+
+		if _, err := session.InsertOne(pivot); err != nil {
+			return rollback(err)
+		}
+	}
+
+	return pivot, session.Commit()
+}
@@ -0,0 +1,15 @@
+package token
+
+import (
+	"github.com/betterde/ects/internal/openapi"
+	"github.com/betterde/ects/models"
+)
+
+// 接口说明，用于生成 OpenAPI 文档
+var Operations = []openapi.Operation{
+	{Method: "GET", Path: "", Summary: "获取当前用户的 API 令牌", Paged: true, Result: []models.Token{}, Query: []openapi.Parameter{
+		{Name: "scene", Description: "管理员指定 all 时返回全部令牌"},
+	}},
+	{Method: "POST", Path: "", Summary: "签发 API 令牌，令牌明文只在响应中出现一次", Body: CreateRequest{}},
+	{Method: "DELETE", Path: "/{id}", Summary: "撤销 API 令牌"},
+}
@@ -0,0 +1,129 @@
+package token
+
+import (
+	"github.com/betterde/ects/internal/message"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"gopkg.in/go-playground/validator.v9"
+	"time"
+)
+
+type (
+	Controller struct {
+		Service services.UserService
+	}
+	CreateRequest struct {
+		Name string `json:"name" validate:"required,max=255"`
+		Role string `json:"role" validate:"required,oneof=admin operator viewer"`
+		// 有效天数，为 0 时不过期
+		Days int `json:"days" validate:"gte=0,lte=3650"`
+	}
+)
+
+var (
+	validate = validator.New()
+)
+
+// 获取当前用户的 API 令牌，管理员可以查看全部令牌
+func (instance *Controller) Get(ctx iris.Context) mvc.Response {
+	user, resp, ok := instance.user(ctx)
+	if !ok {
+		return resp
+	}
+
+	cond := builder.NewCond()
+	if user.Authority() != models.ROLEADMIN || ctx.URLParamDefault("scene", "mine") != "all" {
+		cond = builder.Eq{"user_id": user.Id}
+	}
+
+	page, limit, start := utils.Pagination(ctx)
+	tokens := make([]models.Token, 0)
+	total, err := models.Engine.Where(cond).Limit(limit, start).Desc("created_at").FindAndCount(&tokens)
+	if err != nil {
+		return response.InternalServerError("获取令牌列表失败", err)
+	}
+
+	return response.Success("请求成功", response.Payload{
+		"data": tokens,
+		"meta": response.NewMeta(ctx, page, limit, total),
+	})
+}
+
+// 签发 API 令牌，令牌明文只在响应中出现一次
+func (instance *Controller) Post(ctx iris.Context) mvc.Response {
+	var params CreateRequest
+	if err := ctx.ReadJSON(&params); err != nil {
+		return response.InternalServerError("参数解析失败", err)
+	}
+
+	if err := validate.Struct(params); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		return response.ValidationError(message.Get("token", validationErrors))
+	}
+
+	user, resp, ok := instance.user(ctx)
+	if !ok {
+		return resp
+	}
+
+	if !user.Can(params.Role) {
+		return response.Send(iris.StatusForbidden, "令牌的权限范围不能超过当前用户的角色", make(map[string]interface{}))
+	}
+
+	token, plain, err := services.IssueAPIToken(user, params.Name, params.Role, time.Duration(params.Days)*24*time.Hour)
+	if err != nil {
+		return response.InternalServerError("签发令牌失败", err)
+	}
+
+	if err := services.Audit(ctx, token, "CREATE TOKEN"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("创建成功，令牌只显示一次，请妥善保存", response.Payload{"data": map[string]interface{}{
+		"token":      token,
+		"plain_text": plain,
+	}})
+}
+
+// 撤销 API 令牌，管理员可以撤销任何用户的令牌
+func (instance *Controller) DeleteBy(id string, ctx iris.Context) mvc.Response {
+	user, resp, ok := instance.user(ctx)
+	if !ok {
+		return resp
+	}
+
+	token := &models.Token{}
+	exist, err := models.Engine.Id(id).Get(token)
+	if err != nil {
+		return response.InternalServerError("获取令牌失败", err)
+	}
+
+	if !exist || (token.UserId != user.Id && user.Authority() != models.ROLEADMIN) {
+		return response.NotFound("令牌不存在")
+	}
+
+	if _, err := models.Engine.Id(id).Delete(&models.Token{}); err != nil {
+		return response.InternalServerError("撤销令牌失败", err)
+	}
+
+	if err := services.Audit(ctx, token, "REVOKE TOKEN"); err != nil {
+		return response.InternalServerError("创建日志失败", err)
+	}
+
+	return response.Success("撤销成功", response.Payload{"data": make(map[string]interface{})})
+}
+
+// 获取当前用户，路由限定了令牌只能由登录的用户管理
+func (instance *Controller) user(ctx iris.Context) (*models.User, mvc.Response, bool) {
+	user, err := instance.Service.FindByID(utils.GetUID(ctx))
+	if err != nil {
+		return nil, response.NotFound(err.Error()), false
+	}
+
+	return user, mvc.Response{}, true
+}
@@ -0,0 +1,141 @@
+package actuator
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type (
+	// 用户终止执行或步骤时指定的方式
+	Termination struct {
+		Requester string
+		Signal    syscall.Signal // 首先发送的信号，SIGKILL 时立即结束进程
+		Grace     time.Duration  // 发送 SIGTERM 后等待进程退出的时间，0 使用配置的宽限期
+	}
+	// 正在执行的步骤
+	step struct {
+		cancel context.CancelFunc
+	}
+	targetKey struct{}
+	// 上下文所属的执行和步骤
+	target struct {
+		runId  string
+		taskId string
+	}
+)
+
+// 被用户终止的执行和步骤，以及正在执行的步骤的终止函数，调度器保存执行结果后释放
+var cancellations = struct {
+	sync.Mutex
+	runs    map[string]*Termination
+	steps   map[target]*Termination
+	running map[target]map[*step]bool // 同一个任务可以在流水线中绑定多次
+}{runs: make(map[string]*Termination), steps: make(map[target]*Termination), running: make(map[target]map[*step]bool)}
+
+// 标记执行被用户终止，需要在取消执行的上下文之前调用
+func Cancel(runId string, termination *Termination) {
+	cancellations.Lock()
+	defer cancellations.Unlock()
+
+	cancellations.runs[runId] = termination
+}
+
+// 只终止执行中该任务的步骤，流水线按照步骤失败继续执行，返回步骤是否正在执行
+func KillStep(runId, taskId string, termination *Termination) bool {
+	cancellations.Lock()
+	defer cancellations.Unlock()
+
+	key := target{runId: runId, taskId: taskId}
+	if len(cancellations.running[key]) == 0 {
+		return false
+	}
+
+	cancellations.steps[key] = termination
+	for running := range cancellations.running[key] {
+		running.cancel()
+	}
+
+	return true
+}
+
+// 释放执行的终止标记
+func Forget(runId string) {
+	cancellations.Lock()
+	defer cancellations.Unlock()
+
+	delete(cancellations.runs, runId)
+	for key := range cancellations.steps {
+		if key.runId == runId {
+			delete(cancellations.steps, key)
+		}
+	}
+}
+
+// 登记正在执行的步骤，返回可以单独终止的上下文和步骤结束时注销的函数
+func track(ctx context.Context, runId, taskId string) (context.Context, func()) {
+	key := target{runId: runId, taskId: taskId}
+	sctx, cancel := context.WithCancel(context.WithValue(ctx, targetKey{}, key))
+	running := &step{cancel: cancel}
+
+	cancellations.Lock()
+	defer cancellations.Unlock()
+
+	if cancellations.running[key] == nil {
+		cancellations.running[key] = make(map[*step]bool)
+	}
+	cancellations.running[key][running] = true
+
+	return sctx, func() {
+		cancel()
+
+		cancellations.Lock()
+		defer cancellations.Unlock()
+
+		delete(cancellations.running[key], running)
+		if len(cancellations.running[key]) == 0 {
+			delete(cancellations.running, key)
+		}
+	}
+}
+
+// 执行是否被用户终止
+func cancelled(runId string) (*Termination, bool) {
+	cancellations.Lock()
+	defer cancellations.Unlock()
+
+	termination, exist := cancellations.runs[runId]
+	return termination, exist
+}
+
+// 上下文所属的步骤是否被用户单独终止
+func killed(ctx context.Context) (*Termination, bool) {
+	key, ok := ctx.Value(targetKey{}).(target)
+	if !ok {
+		return nil, false
+	}
+
+	cancellations.Lock()
+	defer cancellations.Unlock()
+
+	termination, exist := cancellations.steps[key]
+	return termination, exist
+}
+
+// 终止上下文中的进程的方式，单独终止步骤的设置优先，没有用户终止时返回 nil
+func terminationOf(ctx context.Context) *Termination {
+	key, ok := ctx.Value(targetKey{}).(target)
+	if !ok {
+		return nil
+	}
+
+	cancellations.Lock()
+	defer cancellations.Unlock()
+
+	if termination, exist := cancellations.steps[key]; exist {
+		return termination
+	}
+
+	return cancellations.runs[key.runId]
+}
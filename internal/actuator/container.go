@@ -0,0 +1,65 @@
+package actuator
+
+import (
+	"context"
+	"github.com/satori/go.uuid"
+	"log"
+	"os/exec"
+)
+
+type imageKey struct{}
+
+// 流水线指定了执行镜像时，其中的 Shell 步骤在容器中执行
+func WithImage(ctx context.Context, image string) context.Context {
+	if image == "" {
+		return ctx
+	}
+
+	return context.WithValue(ctx, imageKey{}, image)
+}
+
+// 获取流水线指定的执行镜像
+func imageFrom(ctx context.Context) string {
+	image, _ := ctx.Value(imageKey{}).(string)
+	return image
+}
+
+// 构造在容器中执行命令的参数，工作目录挂载到容器中的相同路径
+func (actuator *Shell) containerize(name string) []string {
+	args := []string{"run", "--rm", "-i", "--name", name}
+	if actuator.User != "" {
+		args = append(args, "--user", actuator.User)
+	}
+
+	if actuator.Dir != "" {
+		args = append(args, "-v", actuator.Dir+":"+actuator.Dir, "-w", actuator.Dir)
+	}
+
+	for _, env := range actuator.Env {
+		if env != "" {
+			args = append(args, "-e", env)
+		}
+	}
+
+	return append(args, actuator.Image, "/bin/sh", "-c", actuator.Command)
+}
+
+// 创建执行命令，节点没有安装 Docker 时直接在节点上执行，返回容器名称
+func (actuator *Shell) command() (*exec.Cmd, string) {
+	if actuator.Image != "" {
+		if _, err := exec.LookPath("docker"); err == nil {
+			name := "ects-" + uuid.NewV4().String()
+			return exec.Command("docker", actuator.containerize(name)...), name
+		}
+		log.Printf("Docker is not available, run %s on the host instead of image %s\n", actuator.Command, actuator.Image)
+	}
+
+	return exec.Command("/bin/bash", "-c", actuator.Command), ""
+}
+
+// 终止 Docker 客户端不会停止容器，超时或被取消时需要删除容器
+func removeContainer(name string) {
+	if err := exec.Command("docker", "rm", "-f", name).Run(); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,64 @@
+package actuator
+
+import (
+	"context"
+	"github.com/betterde/ects/models"
+	"github.com/satori/go.uuid"
+	"io"
+	"os/exec"
+)
+
+type (
+	// 在指定镜像的容器中执行命令，与流水线的执行镜像不同，节点没有安装 Docker 时直接失败
+	Docker struct {
+		Image   string
+		Env     []string
+		Volumes []string
+		Network string
+		User    string
+		Dir     string // 容器中的工作目录
+		Command string
+		Output  io.Writer // 实时推送记录的输出
+	}
+)
+
+// 执行 Docker 任务
+func (actuator *Docker) Exec(ctx context.Context) *models.TaskRecords {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return &models.TaskRecords{Status: "failed", Result: "节点未安装 Docker：" + err.Error(), ExitCode: -1}
+	}
+
+	name := "ects-" + uuid.NewV4().String()
+	shell := &Shell{Output: actuator.Output}
+	return shell.run(ctx, exec.Command("docker", actuator.arguments(name)...), name)
+}
+
+// 构造 docker run 的参数
+func (actuator *Docker) arguments(name string) []string {
+	args := []string{"run", "--rm", "-i", "--name", name}
+	if actuator.User != "" {
+		args = append(args, "--user", actuator.User)
+	}
+
+	if actuator.Dir != "" {
+		args = append(args, "-w", actuator.Dir)
+	}
+
+	if actuator.Network != "" {
+		args = append(args, "--network", actuator.Network)
+	}
+
+	for _, volume := range actuator.Volumes {
+		if volume != "" {
+			args = append(args, "-v", volume)
+		}
+	}
+
+	for _, env := range actuator.Env {
+		if env != "" {
+			args = append(args, "-e", env)
+		}
+	}
+
+	return append(args, actuator.Image, "/bin/sh", "-c", actuator.Command)
+}
@@ -0,0 +1,83 @@
+package actuator
+
+import (
+	"context"
+	"github.com/betterde/ects/models"
+)
+
+// 按照步骤之间的依赖关系执行，没有依赖关系的分支同时执行，依赖关系中的步骤不支持管道模式
+// 强依赖的前置步骤失败后，后续步骤按照执行条件判断是否执行，失败状态沿依赖关系继续传递
+func RunGraph(ctx context.Context, runId string, steps []*models.PipelineTaskPivot) []*models.TaskRecords {
+	type finished struct {
+		pivot  *models.PipelineTaskPivot
+		record *models.TaskRecords
+	}
+
+	pending := make(map[string]int, len(steps))
+	blocked := make(map[string]bool) // 前置步骤是否失败
+	dependents := make(map[string][]*models.PipelineTaskPivot)
+	for _, step := range steps {
+		pending[step.Id] = len(step.Depends)
+		for _, id := range step.Depends {
+			dependents[id] = append(dependents[id], step)
+		}
+	}
+
+	records := make([]*models.TaskRecords, 0, len(steps))
+	results := make(chan finished, len(steps))
+	running := 0
+
+	start := func(pivot *models.PipelineTaskPivot) {
+		running++
+		go func() {
+			results <- finished{pivot: pivot, record: RunStep(ctx, runId, pivot)}
+		}()
+	}
+
+	// 步骤结束或被跳过后，启动依赖已全部满足的后续步骤
+	var release func(pivot *models.PipelineTaskPivot, failed bool)
+	release = func(pivot *models.PipelineTaskPivot, failed bool) {
+		for _, dependent := range dependents[pivot.Id] {
+			if failed && pivot.Dependence != models.DEPENDENCEWEAK {
+				blocked[dependent.Id] = true
+			}
+
+			pending[dependent.Id]--
+			if pending[dependent.Id] > 0 {
+				continue
+			}
+
+			if dependent.Runnable(blocked[dependent.Id]) {
+				start(dependent)
+			} else {
+				release(dependent, blocked[dependent.Id])
+			}
+		}
+	}
+
+	for _, step := range steps {
+		if len(step.Depends) == 0 {
+			if step.Runnable(false) {
+				start(step)
+			} else {
+				release(step, false)
+			}
+		}
+	}
+
+	for running > 0 {
+		result := <-results
+		running--
+		records = append(records, result.record)
+
+		select {
+		case <-ctx.Done():
+			// 流水线被终止后不再启动新的步骤
+			continue
+		default:
+			release(result.pivot, result.record.Status != "finished" || blocked[result.pivot.Id])
+		}
+	}
+
+	return records
+}
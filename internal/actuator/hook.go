@@ -13,6 +13,8 @@ type (
 		Url     string
 		Method  string
 		Content string
+		// 外部系统传入的关联ID，通过请求头传递
+		CorrelationId string
 	}
 )
 
@@ -26,6 +28,9 @@ func (actuator *Hook) Exec(ctx context.Context) *models.TaskRecords {
 		return record
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if actuator.CorrelationId != "" {
+		req.Header.Set(models.CORRELATIONHEADER, actuator.CorrelationId)
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		record.Result = err.Error()
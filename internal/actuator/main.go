@@ -2,13 +2,19 @@ package actuator
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/control"
+	"github.com/betterde/ects/internal/discover"
 	"github.com/betterde/ects/internal/notify"
 	"github.com/betterde/ects/internal/service"
 	"github.com/betterde/ects/internal/utils"
 	"github.com/betterde/ects/models"
-	uuid "github.com/satori/go.uuid"
+	"io"
+	"log"
+	"net/http"
+	"os"
 	"strings"
 	"time"
 )
@@ -20,62 +26,164 @@ type (
 )
 
 // 执行流水线
-func RunPipeline(ctx context.Context, pipeline *models.Pipeline, resChan chan *models.Result) {
+func RunPipeline(ctx context.Context, trigger *models.Trigger, resChan chan *models.Result) {
+	pipeline := trigger.Pipeline
+	ctx = WithImage(ctx, pipeline.Image)
+	ctx = WithVariables(ctx, pipeline.Variables)
 	if len(pipeline.Steps) > 0 {
+		if trigger.Id == "" {
+			trigger.Id = models.NewRunId()
+		}
+
+		// 定时触发时使用参数的默认值
+		if trigger.Parameters == nil && len(pipeline.Parameters) > 0 {
+			trigger.Parameters = pipeline.Parameters.Defaults()
+		}
+		ctx = WithParameters(ctx, trigger.Parameters)
+		ctx = WithOutputs(ctx)
+
 		record := &models.PipelineRecords{
-			Id:         uuid.NewV4().String(),
+			Id:         trigger.Id,
 			PipelineId: pipeline.Id,
 			NodeId:     service.Runtime.Id,
 			WorkerName: service.Runtime.Name,
 			Spec:       pipeline.Spec,
-			Status:     1,
-			Duration:   0,
+			Trigger:    trigger.Source,
+			ReplayOf:   trigger.ReplayOf,
+			Attempt:    trigger.Attempt,
+			Tags:       trigger.Tags,
+			Status:     models.RECORDRUNNING,
+
+			CorrelationId: trigger.CorrelationId,
+			Parameters:    trigger.Parameters,
+			GroupId:       trigger.GroupId,
+			Duration:      0,
+		}
+
+		if record.Attempt < 1 {
+			record.Attempt = 1
+		}
+
+		// 保存执行时的流水线快照，用于重放
+		if snapshot, err := json.Marshal(pipeline); err != nil {
+			log.Println(err)
+		} else {
+			record.Snapshot = string(snapshot)
 		}
 		beginWith := time.Now()
+		record.BeginWith = utils.Time(beginWith)
+		record.CreatedAt = utils.Time(beginWith)
+		record.UpdatedAt = utils.Time(beginWith)
+		record.HeartbeatAt = utils.Time(beginWith)
+
+		// 开始执行时即保存记录，以便查询正在执行的流水线
+		if err := models.Repo.StoreRun(record); err != nil {
+			log.Println(err)
+		}
+
+		// 主节点根据心跳判断执行是否仍在进行
+		hctx, stopHeartbeat := context.WithCancel(context.Background())
+		go record.Heartbeat(hctx)
+		defer stopHeartbeat()
+		control.Start(record.Id)
+		defer control.Finish(record.Id)
+		log.Printf("Run %s of pipeline %s started by %s\n", record.Reference(), pipeline.Id, record.Trigger)
+
 		result := &models.Result{}
-		// 按照任务的排序，逐个执行
-		for _, pivot := range pipeline.Steps {
-			var pctx context.Context
-			var cancelFunc func()
-
-			// 如果设置了超时时间则
-			if pivot.Timeout == 0 {
-				pctx, cancelFunc = context.WithCancel(ctx)
-			} else {
-				pctx, cancelFunc = context.WithTimeout(ctx, time.Duration(pivot.Timeout)*time.Second)
+
+		// 流水线的超时时间包含所有步骤，不包含成功或失败时触发的任务
+		var sctx context.Context
+		var cancelFunc context.CancelFunc
+		if pipeline.Timeout > 0 {
+			sctx, cancelFunc = context.WithTimeout(ctx, time.Duration(pipeline.Timeout)*time.Second)
+		} else {
+			sctx, cancelFunc = context.WithCancel(ctx)
+		}
+		defer cancelFunc()
+
+		// 保存步骤的执行记录，返回是否有步骤失败
+		collect := func(steps []*models.TaskRecords) bool {
+			failed := false
+			for _, taskRecord := range steps {
+				taskRecord.PipelineRecordId = record.Id
+				taskRecord.CreatedAt = utils.Time(time.Now())
+				result.Steps = append(result.Steps, taskRecord)
+				if taskRecord.Status != "finished" {
+					failed = true
+				}
+			}
+			return failed
+		}
+
+		// 节点管理员限制了可以执行的项目和任务类型时，不执行任何步骤
+		if step, err := service.Runtime.Policy.Permit(pipeline); err != nil {
+			if step == nil {
+				step = pipeline.Steps[0]
 			}
-			taskRecord := RunStep(pctx, pivot)
+			collect([]*models.TaskRecords{describe(&models.TaskRecords{Status: "failed", Result: err.Error()}, step, time.Now())})
+			record.Status = models.RECORDFAILED
+			goto END
+		}
 
-			taskRecord.Timeout = pivot.Timeout
-			taskRecord.Retries = pivot.Retries
-			taskRecord.PipelineRecordId = record.Id
-			taskRecord.CreatedAt = utils.Time(time.Now())
+		// 声明了依赖关系时按照依赖关系执行
+		if models.Dependent(pipeline.Steps) {
+			if collect(RunGraph(sctx, record.Id, pipeline.Steps)) {
+				record.Status = models.RECORDFAILED
+			}
+			goto END
+		}
 
-			result.Steps = append(result.Steps, taskRecord)
-			if taskRecord.Status == "failed" {
-				record.Status = 0
-				goto END
+		// 按照任务的排序，逐个执行，有步骤失败后只执行失败时执行和总是执行的步骤
+		for index, failed := 0, false; index < len(pipeline.Steps); index++ {
+			pivot := pipeline.Steps[index]
+			if !pivot.Runnable(failed) {
+				continue
 			}
 
-			select {
-			case <-ctx.Done():
-				cancelFunc()
+			// 流水线被终止后不再执行任何步骤，超时后的清理步骤不受流水线超时时间的限制
+			if ctx.Err() != nil {
 				break
-			default:
-				continue
+			}
+
+			rctx := sctx
+			if sctx.Err() != nil {
+				rctx = ctx
+			}
+
+			steps := make([]*models.TaskRecords, 0)
+
+			// 管道模式下的连续 Shell 步骤同时执行
+			if chain := Chain(pipeline.Steps, index); len(chain) > 1 {
+				steps = RunChain(rctx, record.Id, chain)
+				index += len(chain) - 1
+			} else {
+				steps = append(steps, RunStep(rctx, record.Id, pivot))
+			}
+
+			if collect(steps) {
+				record.Status = models.RECORDFAILED
+				failed = true
 			}
 		}
 	END:
+		// 被用户终止的执行不触发失败时的任务和通知
+		if termination, ok := cancelled(record.Id); ok && ctx.Err() != nil {
+			record.Status = models.RECORDCANCELLED
+			record.Cancellation = models.CANCELLED
+			record.CancelledBy = termination.Requester
+		} else if sctx.Err() == context.DeadlineExceeded {
+			record.Status = models.RECORDTIMEOUT
+		} else if record.Status == models.RECORDRUNNING {
+			record.Status = models.RECORDFINISHED
+		}
 		finishWith := time.Now()
 		record.Duration = int64(finishWith.Sub(beginWith).Seconds())
-		record.BeginWith = utils.Time(beginWith)
+		log.Printf("Run %s of pipeline %s ended with status %d in %d seconds\n", record.Reference(), pipeline.Id, record.Status, record.Duration)
 		record.FinishWith = utils.Time(finishWith)
-		record.FinishWith = utils.Time(time.Now())
-		record.CreatedAt = utils.Time(time.Now())
 		record.UpdatedAt = utils.Time(time.Now())
 
 		// 当流水线成功时触发
-		if record.Status == 1 && pipeline.Finished != "" {
+		if record.Status == models.RECORDFINISHED && pipeline.Finished != "" && service.Runtime.Policy.AllowMode(pipeline.FinishedTask.Mode) {
 			switch pipeline.FinishedTask.Mode {
 			case models.MODESHELL:
 				shell := &Shell{
@@ -89,14 +197,26 @@ func RunPipeline(ctx context.Context, pipeline *models.Pipeline, resChan chan *m
 			case models.MODEHTTP:
 				break
 			case models.MODEHOOK:
+				sendHook(ctx, pipeline.FinishedTask, models.EVENTSUCCESS, &notify.Context{
+					Pipeline: pipeline,
+					Record:   record,
+					Steps:    result.Steps,
+					Event:    models.EVENTSUCCESS,
+				})
 				break
 			case models.MODEMAIL:
+				sendNotification(ctx, pipeline.FinishedTask, models.EVENTSUCCESS, &notify.Context{
+					Pipeline: pipeline,
+					Record:   record,
+					Steps:    result.Steps,
+					Event:    models.EVENTSUCCESS,
+				})
 				break
 			}
 		}
 
-		// 当流水线失败时触发
-		if record.Status == 0 && pipeline.Failed != "" {
+		// 当流水线失败或超时时触发
+		if (record.Status == models.RECORDFAILED || record.Status == models.RECORDTIMEOUT) && pipeline.Failed != "" && service.Runtime.Policy.AllowMode(pipeline.FailedTask.Mode) {
 			switch pipeline.FailedTask.Mode {
 			case models.MODESHELL:
 				shell := &Shell{
@@ -110,57 +230,259 @@ func RunPipeline(ctx context.Context, pipeline *models.Pipeline, resChan chan *m
 			case models.MODEHTTP:
 				break
 			case models.MODEHOOK:
+				sendHook(ctx, pipeline.FailedTask, models.EVENTFAILURE, &notify.Context{
+					Pipeline: pipeline,
+					Record:   record,
+					Steps:    result.Steps,
+					Event:    models.EVENTFAILURE,
+				})
 				break
 			case models.MODEMAIL:
+				sendNotification(ctx, pipeline.FailedTask, models.EVENTFAILURE, &notify.Context{
+					Pipeline: pipeline,
+					Record:   record,
+					Steps:    result.Steps,
+					Event:    models.EVENTFAILURE,
+				})
 				break
 			}
 		}
 
+		// 按照流水线的通知设置发送执行结果，执行组内的执行由主节点在整组结束后发送汇总通知
+		if event := notify.Event(record.Status); event != "" && record.GroupId == "" {
+			notify.Deliver(&notify.Context{
+				Pipeline: pipeline,
+				Record:   record,
+				Steps:    result.Steps,
+				Event:    event,
+			})
+		}
+
 		result.Pipeline = record
 		resChan <- result
 	}
 }
 
 // 运行任务
-func RunStep(ctx context.Context, pivot *models.PipelineTaskPivot) *models.TaskRecords {
-	record := &models.TaskRecords{}
+func RunStep(ctx context.Context, runId string, pivot *models.PipelineTaskPivot) *models.TaskRecords {
 	beginWith := time.Now()
-	if pivot.Retries == 0 {
-		record = runActuator(ctx, pivot)
-	} else {
-		for i := 0; i < pivot.Retries; i++ {
-			record = runActuator(ctx, pivot)
-			if record.Status == "finished" {
-				break
-			}
+
+	// 包括重试的等待时间在内，步骤可以被单独终止
+	ctx, release := track(ctx, runId, pivot.TaskId)
+	defer release()
+
+	// 步骤上设置的重试次数和重试间隔优先于任务的重试策略
+	retries := pivot.EffectiveRetries()
+
+	// 每次执行（包括重试）单独计算超时时间，等待限流的时间不计入
+	execute := func() *models.TaskRecords {
+		if record := throttle(ctx, pivot.Task); record != nil {
+			return record
+		}
+		pctx, cancelFunc := stepContext(ctx, pivot)
+		defer cancelFunc()
+		return expire(pctx, runId, runActuator(pctx, runId, pivot))
+	}
+
+	record := execute()
+	// 被单独终止的步骤不再重试
+	for attempt := 1; attempt <= retries && record.Status != "finished" && record.Status != "killed"; attempt++ {
+		wait := pivot.RetryWait(attempt)
+		log.Printf("Step %s failed, retry %d/%d in %s\n", pivot.Id, attempt, retries, wait)
+		select {
+		case <-ctx.Done():
+			return describe(expire(ctx, runId, record), pivot, beginWith)
+		case <-time.After(wait):
+		}
+		record = execute()
+	}
+
+	return describe(record, pivot, beginWith)
+}
+
+// 等待任务引用的限流分组放行，等待期间流水线被终止时返回失败的执行记录，限流不可用时不阻止执行
+func throttle(ctx context.Context, task *models.Task) *models.TaskRecords {
+	if task.RateLimit == "" {
+		return nil
+	}
+
+	limit, exist, err := models.Repo.RateLimit(task.RateLimit)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	if !exist {
+		log.Printf("Rate limit %s of task %s does not exist\n", task.RateLimit, task.Id)
+		return nil
+	}
+
+	wait, err := discover.Reserve(limit.Name, limit.Rate, limit.Capacity())
+	if err != nil {
+		log.Printf("Failed to reserve rate limit %s: %s\n", limit.Name, err)
+		return nil
+	}
+
+	if wait == 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return &models.TaskRecords{Status: "failed", Result: fmt.Sprintf("等待限流分组 %s 放行时被终止", limit.Name), ExitCode: -1}
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// 创建步骤执行的上下文，步骤上设置的超时时间优先于任务的超时时间
+func stepContext(ctx context.Context, pivot *models.PipelineTaskPivot) (context.Context, context.CancelFunc) {
+	timeout := pivot.EffectiveTimeout()
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+}
+
+// 超过步骤或者流水线的超时时间被终止的步骤记录为超时，被用户终止的执行中的步骤记录为已终止，被单独终止的步骤记录为 killed
+func expire(ctx context.Context, runId string, record *models.TaskRecords) *models.TaskRecords {
+	if record.Status == "finished" {
+		return record
+	}
+
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		record.Status = "timeout"
+		record.Result += "\n执行超时"
+	case context.Canceled:
+		if _, ok := killed(ctx); ok {
+			record.Status = "killed"
+			record.Result += "\n步骤被单独终止"
+		} else if _, ok := cancelled(runId); ok {
+			record.Status = "cancelled"
+			record.Result += "\n执行被终止"
 		}
 	}
 
+	return record
+}
+
+// 补充任务执行记录的任务和节点信息，保存执行时的任务定义快照，之后修改任务不影响历史记录
+func describe(record *models.TaskRecords, pivot *models.PipelineTaskPivot, beginWith time.Time) *models.TaskRecords {
 	record.TaskId = pivot.TaskId
 	record.NodeId = service.Runtime.Id
 	record.TaskName = pivot.Task.Name
 	record.WorkerName = service.Runtime.Name
 	record.Content = pivot.Task.Content
+	record.CommandHash = pivot.Task.CommandHash()
 	record.Mode = pivot.Task.Mode
-	record.Timeout = pivot.Timeout
-	record.Retries = pivot.Retries
+	record.Url = pivot.Task.Url
+	record.Method = pivot.Task.Method
+	record.Directory = pivot.Directory
+	record.User = pivot.User
+	record.Environment = pivot.Environment
+	record.Timeout = pivot.EffectiveTimeout()
+	record.Retries = pivot.EffectiveRetries()
+	if quiet, lines := pivot.Quiet(); quiet {
+		record.Result = tail(record.Result, lines)
+		record.Stdout = tail(record.Stdout, lines)
+		record.Stderr = tail(record.Stderr, lines)
+	}
+	// 超过大小限制的输出只保存末尾部分
+	if limit := config.Conf.Run.MaxOutput; limit > 0 {
+		var result, stdout, stderr bool
+		record.Result, result = utils.TailBytes(record.Result, limit)
+		record.Stdout, stdout = utils.TailBytes(record.Stdout, limit)
+		record.Stderr, stderr = utils.TailBytes(record.Stderr, limit)
+		record.Truncated = result || stdout || stderr
+	}
 	finishWith := time.Now()
 	record.BeginWith = utils.Time(beginWith)
-	record.FinishWith = utils.Time(time.Now())
+	record.FinishWith = utils.Time(finishWith)
 	record.Duration = int64(finishWith.Sub(beginWith).Seconds())
 	return record
 }
 
-func runActuator(ctx context.Context, pivot *models.PipelineTaskPivot) *models.TaskRecords {
+// 保留输出的末尾几行
+func tail(output string, lines int) string {
+	trimmed := strings.TrimRight(output, "\n")
+	index := len(trimmed)
+	for count := 0; count < lines; count++ {
+		index = strings.LastIndexByte(trimmed[:index], '\n')
+		if index < 0 {
+			return output
+		}
+	}
+
+	return output[index+1:]
+}
+
+// 步骤输出的实时推送目标，任务配置了推送地址时同时推送到该地址，返回关闭推送的函数
+func output(runId string, pivot *models.PipelineTaskPivot) (io.Writer, func()) {
+	writer := control.Writer(runId, pivot.TaskId)
+	if pivot.Task.StreamUrl == "" {
+		return writer, func() {}
+	}
+
+	stream := NewStream(pivot.Task.StreamUrl, runId, pivot.TaskId)
+	return io.MultiWriter(writer, stream), func() {
+		if err := stream.Close(); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// 合并环境变量并替换引用的密钥后执行步骤，输出中的密钥会被遮盖，步骤的输出传递给之后开始的步骤
+func runActuator(ctx context.Context, runId string, pivot *models.PipelineTaskPivot) *models.TaskRecords {
+	revealed, secrets, err := reveal(inherit(ctx, pivot))
+	if err != nil {
+		return &models.TaskRecords{Status: "failed", Result: err.Error(), ExitCode: -1}
+	}
+
+	step, read := receive(ctx, revealed)
+	record := invoke(ctx, runId, step)
+	capture(pivot, record, read())
+	record = mask(record, secrets)
+	if record != nil {
+		publish(ctx, record.Outputs)
+	}
+
+	return record
+}
+
+func invoke(ctx context.Context, runId string, pivot *models.PipelineTaskPivot) *models.TaskRecords {
 	switch pivot.Task.Mode {
 	case models.MODESHELL:
 		shell := &Shell{
 			User:    pivot.User,
-			Env:     strings.Split(pivot.Environment, " "),
+			Env:     environ(pivot),
 			Dir:     pivot.Directory,
 			Command: pivot.Task.Content,
+			Image:   imageFrom(ctx),
+			Sandbox: pivot.Task.Sandbox,
+			// 按照步骤的设置过滤节点的环境变量，避免凭证泄露给不需要的步骤
+			Inherited: pivot.Inherited(os.Environ()),
 		}
+		// 每次执行（包括重试）单独建立一次推送
+		writer, closer := output(runId, pivot)
+		shell.Output = writer
+		defer closer()
 		return shell.Exec(ctx)
+	case models.MODEDOCKER:
+		docker := &Docker{
+			Image:   pivot.Task.Image,
+			Env:     append(append([]string{}, pivot.Task.Env...), environ(pivot)...),
+			Volumes: pivot.Task.Volumes,
+			Network: pivot.Task.Network,
+			User:    pivot.User,
+			Dir:     pivot.Directory,
+			Command: pivot.Task.Content,
+		}
+		writer, closer := output(runId, pivot)
+		docker.Output = writer
+		defer closer()
+		return docker.Exec(ctx)
 	case models.MODEMAIL:
 		mail := Mail{
 			Mail: &notify.Mail{
@@ -196,3 +518,56 @@ func runActuator(ctx context.Context, pivot *models.PipelineTaskPivot) *models.T
 
 	return nil
 }
+
+// 使用通知模板渲染并发送流水线执行结果
+func sendNotification(ctx context.Context, task *models.Task, event string, nctx *notify.Context) {
+	subject, content, err := notify.Render(models.CHANNELMAIL, event, nctx)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	mail := Mail{
+		Mail: &notify.Mail{
+			From:       fmt.Sprintf("%s<%s>", "ECTS", config.Conf.Notification.User),
+			To:         task.Url,
+			Subject:    subject,
+			Year:       time.Now().Year(),
+			SiteURL:    config.Conf.Notification.Url,
+			SiteTitle:  "Elastic Crontab System",
+			Greeting:   "Hello",
+			Intro:      content,
+			Salutation: "Regards",
+		},
+	}
+
+	if record := mail.Exec(ctx); record.Status == "failed" {
+		log.Println(record.Result)
+	}
+}
+
+// 使用通知模板渲染请求体并调用钩子
+func sendHook(ctx context.Context, task *models.Task, event string, nctx *notify.Context) {
+	_, content, err := notify.Render(models.CHANNELHOOK, event, nctx)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	method := task.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	hook := &Hook{
+		Url:     task.Url,
+		Method:  method,
+		Content: content,
+		// 接收方可以据此关联到外部系统中的请求
+		CorrelationId: nctx.Record.CorrelationId,
+	}
+
+	if record := hook.Exec(ctx); record.Status == "failed" {
+		log.Println(record.Result)
+	}
+}
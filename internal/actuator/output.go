@@ -0,0 +1,148 @@
+package actuator
+
+import (
+	"context"
+	"github.com/betterde/ects/models"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+)
+
+type (
+	outputsKey struct{}
+	// 本次执行中前面的步骤传递的输出，依赖关系中同时执行的步骤会并发写入
+	outputs struct {
+		sync.Mutex
+		values models.Variables
+	}
+)
+
+// 为本次执行创建保存步骤输出的空间
+func WithOutputs(ctx context.Context) context.Context {
+	return context.WithValue(ctx, outputsKey{}, &outputs{values: make(models.Variables)})
+}
+
+// 保存步骤的输出，之后开始的步骤执行时注入环境变量
+func publish(ctx context.Context, values models.Variables) {
+	store, ok := ctx.Value(outputsKey{}).(*outputs)
+	if !ok || len(values) == 0 {
+		return
+	}
+
+	store.Lock()
+	defer store.Unlock()
+
+	for name, value := range values {
+		store.values[name] = value
+	}
+}
+
+// 前面的步骤已经传递的输出
+func received(ctx context.Context) models.Variables {
+	store, ok := ctx.Value(outputsKey{}).(*outputs)
+	if !ok {
+		return nil
+	}
+
+	store.Lock()
+	defer store.Unlock()
+
+	return models.MergeVariables(store.values)
+}
+
+// 将前面步骤的输出注入步骤的环境变量，需要读取 ECTS_OUTPUT 文件时同时创建文件，返回步骤副本和读取写入的值的函数
+// 输出在解密密钥之后注入，其中的密钥引用不会被替换
+func receive(ctx context.Context, pivot *models.PipelineTaskPivot) (*models.PipelineTaskPivot, func() models.Variables) {
+	values := received(ctx)
+	read := func() models.Variables { return nil }
+
+	// 容器和沙箱中的进程无法写入节点上的文件，只能通过标准输出传递
+	if pivot.Outputs.Written() && pivot.Task.Mode == models.MODESHELL && imageFrom(ctx) == "" && !pivot.Task.Sandbox {
+		if path, err := outputFile(pivot.User); err != nil {
+			log.Println(err)
+		} else {
+			values = models.MergeVariables(values, models.Variables{models.OUTPUTFILE: path})
+			read = func() models.Variables {
+				return readOutputs(path)
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		return pivot, read
+	}
+
+	task := *pivot.Task
+	task.Variables = models.MergeVariables(pivot.Task.Variables, values)
+	step := *pivot
+	step.Task = &task
+	return &step, read
+}
+
+// 创建步骤写入输出的临时文件，指定了运行用户时将文件交给该用户
+func outputFile(username string) (string, error) {
+	file, err := ioutil.TempFile("", "ects-output-")
+	if err != nil {
+		return "", err
+	}
+
+	path := file.Name()
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+
+	if username != "" {
+		credential, err := getCredential(username)
+		if err != nil {
+			_ = os.Remove(path)
+			return "", err
+		}
+
+		if err := os.Chown(path, int(credential.Uid), int(credential.Gid)); err != nil {
+			_ = os.Remove(path)
+			return "", err
+		}
+	}
+
+	return path, nil
+}
+
+// 读取写入 ECTS_OUTPUT 文件的值后删除文件
+func readOutputs(path string) models.Variables {
+	defer func() {
+		if err := os.Remove(path); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	defer file.Close()
+
+	content, err := ioutil.ReadAll(io.LimitReader(file, models.MAXOUTPUTS*models.MAXOUTPUT))
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	return models.ParseOutputs(string(content))
+}
+
+// 按照步骤的映射取出输出，HTTP 任务使用响应内容作为标准输出
+func capture(pivot *models.PipelineTaskPivot, record *models.TaskRecords, written models.Variables) {
+	if record == nil || len(pivot.Outputs) == 0 {
+		return
+	}
+
+	stdout := record.Stdout
+	if pivot.Task.Mode == models.MODEHTTP {
+		stdout = record.Result
+	}
+
+	record.Outputs = pivot.Outputs.Resolve(stdout, written)
+}
@@ -0,0 +1,139 @@
+package actuator
+
+import (
+	"context"
+	"github.com/betterde/ects/models"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// 获取从指定步骤开始，通过管道连接的连续 Shell 步骤
+func Chain(steps []*models.PipelineTaskPivot, start int) []*models.PipelineTaskPivot {
+	chain := []*models.PipelineTaskPivot{steps[start]}
+
+	for index := start; index < len(steps)-1; index++ {
+		current, next := steps[index], steps[index+1]
+		if current.Pipe == 0 || current.Task == nil || next.Task == nil {
+			break
+		}
+
+		// 只在失败时执行的步骤不能接收前面步骤的输出
+		if next.Condition == models.CONDITIONFAILURE {
+			break
+		}
+
+		if current.Task.Mode != models.MODESHELL || next.Task.Mode != models.MODESHELL {
+			break
+		}
+
+		chain = append(chain, next)
+	}
+
+	return chain
+}
+
+// 同时执行管道连接的步骤，上一步的标准输出作为下一步的标准输入
+// 管道中的步骤无法单独重新执行，因此不支持重试
+func RunChain(ctx context.Context, runId string, chain []*models.PipelineTaskPivot) []*models.TaskRecords {
+	records := make([]*models.TaskRecords, len(chain))
+	shells := make([]*Shell, len(chain))
+	closers := make([][]*os.File, len(chain))
+	secrets := make([][]string, len(chain))
+	reads := make([]func() models.Variables, len(chain))
+
+	for index, pivot := range chain {
+		if pivot.EffectiveRetries() > 0 {
+			log.Printf("Step %s is piped, retries ignored\n", pivot.Id)
+		}
+
+		revealed, values, err := reveal(inherit(ctx, pivot))
+		if err != nil {
+			discard(reads)
+			for i, pivot := range chain {
+				records[i] = describe(&models.TaskRecords{Status: "failed", Result: err.Error(), ExitCode: -1}, pivot, time.Now())
+			}
+			return records
+		}
+		secrets[index] = values
+
+		// 管道中只有最后一个步骤的标准输出可以作为输出
+		step, read := receive(ctx, revealed)
+		reads[index] = read
+		shells[index] = &Shell{
+			User:      pivot.User,
+			Env:       environ(step),
+			Dir:       pivot.Directory,
+			Command:   step.Task.Content,
+			Image:     imageFrom(ctx),
+			Sandbox:   pivot.Task.Sandbox,
+			Inherited: pivot.Inherited(os.Environ()),
+		}
+		writer, closer := output(runId, pivot)
+		shells[index].Output = writer
+		defer closer()
+	}
+
+	for index := 0; index < len(chain)-1; index++ {
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			for i, pivot := range chain {
+				records[i] = describe(&models.TaskRecords{Status: "failed", Result: err.Error()}, pivot, time.Now())
+			}
+			closeAll(closers)
+			discard(reads)
+			return records
+		}
+
+		shells[index].Stdout = writer
+		shells[index].Upstream = true
+		shells[index+1].Stdin = reader
+		closers[index] = append(closers[index], writer)
+		closers[index+1] = append(closers[index+1], reader)
+	}
+
+	var wg sync.WaitGroup
+	for index, pivot := range chain {
+		wg.Add(1)
+		go func(index int, pivot *models.PipelineTaskPivot) {
+			defer wg.Done()
+			// 单独终止管道中的步骤时，其他步骤读写管道失败后结束
+			sctx, release := track(ctx, runId, pivot.TaskId)
+			defer release()
+			pctx, cancelFunc := stepContext(sctx, pivot)
+			defer cancelFunc()
+
+			beginWith := time.Now()
+			record := expire(pctx, runId, shells[index].Exec(pctx))
+
+			// 进程结束后关闭本进程持有的管道，使下一步读到 EOF，上一步写入时收到 SIGPIPE
+			for _, file := range closers[index] {
+				_ = file.Close()
+			}
+			capture(pivot, record, reads[index]())
+			records[index] = describe(mask(record, secrets[index]), pivot, beginWith)
+			publish(ctx, records[index].Outputs)
+		}(index, pivot)
+	}
+	wg.Wait()
+
+	return records
+}
+
+func closeAll(closers [][]*os.File) {
+	for _, files := range closers {
+		for _, file := range files {
+			_ = file.Close()
+		}
+	}
+}
+
+// 步骤没有执行时删除已经创建的 ECTS_OUTPUT 文件
+func discard(reads []func() models.Variables) {
+	for _, read := range reads {
+		if read != nil {
+			read()
+		}
+	}
+}
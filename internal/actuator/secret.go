@@ -0,0 +1,75 @@
+package actuator
+
+import (
+	"github.com/betterde/ects/models"
+	"strings"
+)
+
+const SECRETMASK = "******" // 输出中密钥的值替换为该字符串
+
+// 执行前解密并替换步骤中引用的密钥，返回替换后的步骤副本和密钥的值，执行记录仍然保存替换前的内容
+func reveal(pivot *models.PipelineTaskPivot) (*models.PipelineTaskPivot, []string, error) {
+	texts := append([]string{pivot.Task.Content, pivot.Task.Url, pivot.Environment}, pivot.Task.Env...)
+	for _, value := range pivot.Task.Variables {
+		texts = append(texts, value)
+	}
+
+	names := models.SecretNames(texts...)
+	if len(names) == 0 {
+		return pivot, nil, nil
+	}
+
+	values, err := models.Repo.OpenSecrets(names)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	replace := func(text string) string {
+		return models.SecretReference.ReplaceAllStringFunc(text, func(reference string) string {
+			return values[models.SecretReference.FindStringSubmatch(reference)[1]]
+		})
+	}
+
+	task := *pivot.Task
+	task.Content = replace(task.Content)
+	task.Url = replace(task.Url)
+	task.Env = make([]string, 0, len(pivot.Task.Env))
+	for _, env := range pivot.Task.Env {
+		task.Env = append(task.Env, replace(env))
+	}
+	task.Variables = make(models.Variables, len(pivot.Task.Variables))
+	for name, value := range pivot.Task.Variables {
+		task.Variables[name] = replace(value)
+	}
+
+	revealed := *pivot
+	revealed.Task = &task
+	revealed.Environment = replace(pivot.Environment)
+
+	secrets := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != "" {
+			secrets = append(secrets, value)
+		}
+	}
+
+	return &revealed, secrets, nil
+}
+
+// 遮盖执行输出中出现的密钥
+func mask(record *models.TaskRecords, secrets []string) *models.TaskRecords {
+	if record == nil {
+		return record
+	}
+
+	for _, secret := range secrets {
+		record.Result = strings.Replace(record.Result, secret, SECRETMASK, -1)
+		record.Stdout = strings.Replace(record.Stdout, secret, SECRETMASK, -1)
+		record.Stderr = strings.Replace(record.Stderr, secret, SECRETMASK, -1)
+		for name, value := range record.Outputs {
+			record.Outputs[name] = strings.Replace(value, secret, SECRETMASK, -1)
+		}
+	}
+
+	return record
+}
@@ -1,28 +1,65 @@
 package actuator
 
 import (
+	"bytes"
 	"context"
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/sandbox"
 	"github.com/betterde/ects/models"
+	"io"
+	"log"
 	"os/exec"
 	"os/user"
 	"strconv"
 	"syscall"
+	"time"
 )
 
+// 终止进程时默认的宽限期
+const KILLGRACE = 10 * time.Second
+
 type (
 	Shell struct {
 		User    string
 		Env     []string
 		Dir     string
 		Command string
+		Stdin   io.Reader // 管道模式下上一步的输出
+		Stdout  io.Writer // 管道模式下输出到下一步，此时只记录标准错误
+		Output  io.Writer // 实时推送记录的输出
+		Image   string    // 在指定镜像的容器中执行
+		Sandbox bool      // 在 Linux 命名空间沙箱中执行，指定镜像时由容器隔离
+		// 从节点继承的环境变量，为 nil 时继承全部
+		Inherited []string
+		// 管道中非末尾的步骤，下游提前结束导致收到 SIGPIPE 时视为成功，与未开启 pipefail 的 bash 一致
+		Upstream bool
 	}
 )
 
 // 执行 Shell 任务
 func (actuator *Shell) Exec(ctx context.Context) *models.TaskRecords {
-	cmd := exec.CommandContext(ctx, "/bin/bash", "-c", actuator.Command)
+	if actuator.Sandbox && actuator.Image == "" {
+		cmd, err := sandbox.Command(&sandbox.Options{User: actuator.User, Dir: actuator.Dir, Command: actuator.Command})
+		if err != nil {
+			return &models.TaskRecords{Status: "failed", Result: err.Error(), ExitCode: -1}
+		}
+		return actuator.run(ctx, cmd, "")
+	}
+
+	cmd, container := actuator.command()
+	return actuator.run(ctx, cmd, container)
+}
+
+// 执行命令并记录输出，container 不为空时命令为 Docker 客户端，被终止时需要删除容器
+func (actuator *Shell) run(ctx context.Context, cmd *exec.Cmd, container string) *models.TaskRecords {
 	record := &models.TaskRecords{}
-	if actuator.User != "" {
+	// 使用独立的进程组，超时或被终止时连同子进程一起结束，沙箱进程已设置命名空间
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	// 沙箱在初始化完成后才切换执行用户
+	if actuator.User != "" && container == "" && !actuator.Sandbox {
 		credential, err := getCredential(actuator.User)
 		if err != nil {
 			record.Status = "failed"
@@ -32,28 +69,144 @@ func (actuator *Shell) Exec(ctx context.Context) *models.TaskRecords {
 		cmd.SysProcAttr.Credential = credential
 	}
 
-	resChan := make(chan struct {
-		output []byte
-		err    error
-	})
-
-	go func() {
-		output, err := cmd.CombinedOutput()
-		resChan <- struct {
-			output []byte
-			err    error
-		}{output: output, err: err}
-	}()
-	res := <-resChan
-	record.Result = string(res.output)
-	if res.err != nil {
+	// 合并输出按照写入顺序记录，同时分别记录标准输出和标准错误
+	buffer := new(bytes.Buffer)
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+
+	var recorder io.Writer = buffer
+	if actuator.Output != nil {
+		recorder = io.MultiWriter(buffer, actuator.Output)
+	}
+
+	// Docker 客户端需要节点的环境变量，容器的环境变量通过参数传入
+	if container == "" && actuator.Inherited != nil {
+		cmd.Env = actuator.Inherited
+		for _, env := range actuator.Env {
+			if env != "" {
+				cmd.Env = append(cmd.Env, env)
+			}
+		}
+	}
+
+	cmd.Stdin = actuator.Stdin
+	cmd.Stderr = io.MultiWriter(recorder, stderr)
+	if actuator.Stdout == nil {
+		cmd.Stdout = io.MultiWriter(recorder, stdout)
+	} else {
+		cmd.Stdout = actuator.Stdout
+	}
+
+	err := cmd.Start()
+	if err == nil {
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				terminate(cmd.Process.Pid, done, terminationOf(ctx))
+			case <-done:
+			}
+		}()
+		err = cmd.Wait()
+		close(done)
+	}
+
+	if container != "" && ctx.Err() != nil {
+		removeContainer(container)
+	}
+	record.Result = buffer.String()
+	record.Stdout = stdout.String()
+	record.Stderr = stderr.String()
+	record.ExitCode = exitCode(err)
+	if err != nil && !(actuator.Upstream && brokenPipe(err)) {
 		record.Status = "failed"
+		// 进程未能启动时没有任何输出，记录启动失败的原因
+		if _, ok := err.(*exec.ExitError); !ok && record.Result == "" {
+			record.Result = err.Error()
+		}
 	} else {
 		record.Status = "finished"
 	}
 	return record
 }
 
+// 先发送 SIGTERM 给进程清理的机会，宽限期内没有退出时发送 SIGKILL，子进程可能仍然持有输出管道，只结束 bash 会导致一直等待输出
+// 用户终止时可以指定直接发送 SIGKILL 或者使用其他的宽限期
+func terminate(pid int, done <-chan struct{}, termination *Termination) {
+	wait := grace()
+	if termination != nil {
+		if termination.Signal == syscall.SIGKILL {
+			wait = 0
+		} else if termination.Grace > 0 {
+			wait = termination.Grace
+		}
+	}
+
+	if wait > 0 {
+		if err := syscall.Kill(-pid, syscall.SIGTERM); err != nil {
+			log.Println(err)
+		}
+
+		select {
+		case <-done:
+			return
+		case <-time.After(wait):
+			log.Printf("Process group %d did not exit after SIGTERM, sending SIGKILL\n", pid)
+		}
+	}
+
+	if err := syscall.Kill(-pid, syscall.SIGKILL); err != nil {
+		log.Println(err)
+	}
+}
+
+// 发送 SIGTERM 后等待进程退出的时间
+func grace() time.Duration {
+	if config.Conf != nil && config.Conf.Run.Grace > 0 {
+		return time.Duration(config.Conf.Run.Grace) * time.Second
+	}
+
+	return KILLGRACE
+}
+
+// 获取进程的退出码，被信号终止时与 bash 一致使用 128+信号值，进程未能启动时为 -1
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return -1
+	}
+
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return -1
+	}
+
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+
+	return status.ExitStatus()
+}
+
+// 进程是否因为 SIGPIPE 退出，bash 执行复合命令时以 128+13 作为退出码
+func brokenPipe(err error) bool {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return false
+	}
+
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return false
+	}
+
+	return (status.Signaled() && status.Signal() == syscall.SIGPIPE) || status.ExitStatus() == 128+int(syscall.SIGPIPE)
+}
+
 // 获取执行证书
 func getCredential(username string) (*syscall.Credential, error) {
 	sysuser, err := user.Lookup(username)
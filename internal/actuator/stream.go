@@ -0,0 +1,164 @@
+package actuator
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	STREAMBUFFER  = 256              // 缓冲的输出片段数量，下游处理不过来时丢弃新的片段
+	STREAMTIMEOUT = 10 * time.Second // 建立连接和等待响应的超时时间
+	STREAMGRACE   = 5 * time.Second  // 任务结束后等待剩余输出推送完成的时间
+)
+
+type (
+	// 将任务输出以 NDJSON 格式通过分块传输推送到下游地址
+	Stream struct {
+		mutex   sync.Mutex
+		chunks  chan *Chunk
+		done    chan struct{}
+		cancel  context.CancelFunc
+		closed  bool
+		seq     int
+		dropped int
+		RunId   string
+		TaskId  string
+	}
+	// 推送的输出片段
+	Chunk struct {
+		RunId   string    `json:"run_id"`
+		TaskId  string    `json:"task_id"`
+		Seq     int       `json:"seq"`
+		Time    time.Time `json:"time"`
+		Data    string    `json:"data"`
+		Dropped int       `json:"dropped,omitempty"`
+		EOF     bool      `json:"eof,omitempty"`
+	}
+)
+
+var (
+	// 推送会持续到任务结束，因此不设置整体超时，只限制建立连接和等待响应的时间
+	streamClient = &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: STREAMTIMEOUT}).DialContext,
+			TLSHandshakeTimeout:   STREAMTIMEOUT,
+			ResponseHeaderTimeout: STREAMTIMEOUT,
+		},
+	}
+)
+
+// 建立到下游地址的推送连接，输出先写入有界缓冲区，下游缓慢或不可用时只丢弃输出，不影响任务执行
+func NewStream(url, runId, taskId string) *Stream {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &Stream{
+		chunks: make(chan *Chunk, STREAMBUFFER),
+		done:   make(chan struct{}),
+		cancel: cancel,
+		RunId:  runId,
+		TaskId: taskId,
+	}
+
+	reader, writer := io.Pipe()
+
+	// 将缓冲区中的片段编码后写入请求体
+	go func() {
+		encoder := json.NewEncoder(writer)
+		for chunk := range stream.chunks {
+			if err := encoder.Encode(chunk); err != nil {
+				// 下游已断开，继续消费缓冲区以免阻塞写入
+				for range stream.chunks {
+				}
+				break
+			}
+		}
+		_ = writer.Close()
+	}()
+
+	go func() {
+		defer close(stream.done)
+		// 请求失败时关闭读取端，使写入请求体的协程退出
+		defer reader.Close()
+
+		req, err := http.NewRequest(http.MethodPost, url, reader)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-ndjson")
+
+		resp, err := streamClient.Do(req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			log.Printf("Output stream to %s responded with status %d\n", url, resp.StatusCode)
+		}
+	}()
+
+	return stream
+}
+
+// 推送一段输出，缓冲区已满时丢弃
+func (stream *Stream) Write(data []byte) (int, error) {
+	stream.send(string(data), false)
+	return len(data), nil
+}
+
+// 推送结束标记，下游在限定时间内没有处理完时直接断开
+func (stream *Stream) Close() error {
+	stream.send("", true)
+
+	stream.mutex.Lock()
+	stream.closed = true
+	close(stream.chunks)
+	stream.mutex.Unlock()
+
+	select {
+	case <-stream.done:
+	case <-time.After(STREAMGRACE):
+		log.Println("Output stream did not finish in time, connection aborted")
+	}
+	stream.cancel()
+
+	return nil
+}
+
+func (stream *Stream) send(data string, eof bool) {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	if stream.closed {
+		return
+	}
+
+	stream.seq++
+	chunk := &Chunk{
+		RunId:   stream.RunId,
+		TaskId:  stream.TaskId,
+		Seq:     stream.seq,
+		Time:    time.Now(),
+		Data:    data,
+		Dropped: stream.dropped,
+		EOF:     eof,
+	}
+
+	select {
+	case stream.chunks <- chunk:
+		stream.dropped = 0
+	default:
+		stream.dropped++
+	}
+}
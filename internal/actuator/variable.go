@@ -0,0 +1,66 @@
+package actuator
+
+import (
+	"context"
+	"github.com/betterde/ects/models"
+	"strings"
+)
+
+type (
+	variablesKey  struct{}
+	parametersKey struct{}
+)
+
+// 流水线定义的环境变量，执行步骤时与任务的环境变量合并
+func WithVariables(ctx context.Context, variables models.Variables) context.Context {
+	if len(variables) == 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, variablesKey{}, variables)
+}
+
+// 本次执行使用的参数，覆盖流水线和任务的同名环境变量
+func WithParameters(ctx context.Context, parameters models.Variables) context.Context {
+	if len(parameters) == 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, parametersKey{}, parameters)
+}
+
+// 合并流水线、任务的环境变量和本次执行的参数，任务覆盖流水线的同名变量，参数覆盖两者，
+// 并将任务内容、请求地址和环境变量中的 {{ params.NAME }} 替换为参数值，返回合并后的步骤副本
+func inherit(ctx context.Context, pivot *models.PipelineTaskPivot) *models.PipelineTaskPivot {
+	variables, _ := ctx.Value(variablesKey{}).(models.Variables)
+	parameters, _ := ctx.Value(parametersKey{}).(models.Variables)
+	if len(variables) == 0 && len(parameters) == 0 {
+		return pivot
+	}
+
+	fill := func(text string) string {
+		return models.SubstituteParameters(text, parameters)
+	}
+
+	task := *pivot.Task
+	task.Content = fill(task.Content)
+	task.Url = fill(task.Url)
+	task.Env = make([]string, 0, len(pivot.Task.Env))
+	for _, env := range pivot.Task.Env {
+		task.Env = append(task.Env, fill(env))
+	}
+	task.Variables = make(models.Variables)
+	for name, value := range models.MergeVariables(variables, pivot.Task.Variables, parameters) {
+		task.Variables[name] = fill(value)
+	}
+
+	inherited := *pivot
+	inherited.Task = &task
+	inherited.Environment = fill(pivot.Environment)
+	return &inherited
+}
+
+// 步骤进程的环境变量，步骤上设置的环境变量优先级最高
+func environ(pivot *models.PipelineTaskPivot) []string {
+	return append(pivot.Task.Variables.Environ(), strings.Split(pivot.Environment, " ")...)
+}
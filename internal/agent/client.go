@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/betterde/ects/internal/control"
+	"github.com/betterde/ects/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log"
+	"time"
+)
+
+// 通过主节点的代理服务读写数据，工作节点不需要数据库的账号
+type Remote struct {
+	conn  *grpc.ClientConn
+	token string
+}
+
+// 连接主节点的代理服务，连接在第一次调用时建立
+func Dial(address, token string) (*Remote, error) {
+	conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithDefaultCallOptions(grpc.CallContentSubtype(control.CODEC)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Remote{conn: conn, token: token}, nil
+}
+
+// 调用代理服务，主节点不可用时等待后重试，避免主节点重启期间丢失执行结果
+func (remote *Remote) invoke(method string, in, out interface{}) error {
+	var err error
+	for attempt := 0; attempt <= RETRIES; attempt++ {
+		if attempt > 0 {
+			log.Printf("Agent call %s failed, retry %d/%d: %s\n", method, attempt, RETRIES, err)
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT)
+		ctx = metadata.AppendToOutgoingContext(ctx, HEADER, SCHEME+remote.token)
+		err = remote.conn.Invoke(ctx, fmt.Sprintf("/%s/%s", SERVICE, method), in, out)
+		cancel()
+
+		if status.Code(err) != codes.Unavailable {
+			return unwrap(err)
+		}
+	}
+
+	return err
+}
+
+// 主节点返回的业务错误只保留错误信息，与直接访问数据库时一致
+func unwrap(err error) error {
+	if s, ok := status.FromError(err); ok && s.Code() == codes.Unknown {
+		return errors.New(s.Message())
+	}
+
+	return err
+}
+
+func (remote *Remote) StoreRun(record *models.PipelineRecords) error {
+	return remote.invoke("StoreRun", &RunRequest{Record: record, Snapshot: record.Snapshot}, &Ack{})
+}
+
+func (remote *Remote) Heartbeat(runId string, at time.Time) error {
+	return remote.invoke("Heartbeat", &HeartbeatRequest{RunId: runId, At: at}, &Ack{})
+}
+
+func (remote *Remote) Cancelling(runId, requester string) error {
+	return remote.invoke("Cancelling", &CancelRequest{RunId: runId, Requester: requester}, &Ack{})
+}
+
+func (remote *Remote) FinishRun(record *models.PipelineRecords) (bool, error) {
+	reply := &FinishReply{}
+	err := remote.invoke("FinishRun", &RunRequest{Record: record, Snapshot: record.Snapshot}, reply)
+	return reply.Finished, err
+}
+
+func (remote *Remote) StoreStep(step *models.TaskRecords) error {
+	return remote.invoke("StoreStep", &StepRequest{Step: step}, &Ack{})
+}
+
+func (remote *Remote) LastScheduled(pipelineId, nodeId string) (time.Time, bool, error) {
+	reply := &ScheduledReply{}
+	err := remote.invoke("LastScheduled", &ScheduledRequest{PipelineId: pipelineId, NodeId: nodeId}, reply)
+	return reply.Time, reply.Exist, err
+}
+
+func (remote *Remote) Node(id string) (*models.Node, error) {
+	reply := &NodeReply{}
+	if err := remote.invoke("Node", &IdRequest{Id: id}, reply); err != nil {
+		return nil, err
+	}
+
+	if reply.Node == nil {
+		return &models.Node{}, nil
+	}
+
+	return reply.Node, nil
+}
+
+func (remote *Remote) Concurrency(projectId string) (int, error) {
+	reply := &ConcurrencyReply{}
+	err := remote.invoke("Concurrency", &IdRequest{Id: projectId}, reply)
+	return reply.Max, err
+}
+
+func (remote *Remote) RateLimit(name string) (*models.RateLimit, bool, error) {
+	reply := &RateLimitReply{}
+	if err := remote.invoke("RateLimit", &IdRequest{Id: name}, reply); err != nil {
+		return nil, false, err
+	}
+
+	return reply.Limit, reply.Exist && reply.Limit != nil, nil
+}
+
+func (remote *Remote) OpenSecrets(names []string) (map[string]string, error) {
+	reply := &SecretsReply{}
+	err := remote.invoke("OpenSecrets", &SecretsRequest{Names: names}, reply)
+	return reply.Values, err
+}
+
+func (remote *Remote) Notifications(pipelineId string) ([]models.PipelineNotification, error) {
+	reply := &NotificationsReply{}
+	err := remote.invoke("Notifications", &IdRequest{Id: pipelineId}, reply)
+	return reply.Notifications, err
+}
+
+func (remote *Remote) Template(channel, event, projectId string) (*models.NotificationTemplate, bool, error) {
+	reply := &TemplateReply{}
+	if err := remote.invoke("Template", &TemplateRequest{Channel: channel, Event: event, ProjectId: projectId}, reply); err != nil {
+		return nil, false, err
+	}
+
+	return reply.Template, reply.Exist && reply.Template != nil, nil
+}
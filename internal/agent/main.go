@@ -0,0 +1,210 @@
+package agent
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"github.com/betterde/ects/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net"
+	"time"
+)
+
+const (
+	SERVICE = "ects.Agent"     // 代理模式的工作节点通过主节点读写数据的服务
+	PORT    = 9704             // 主节点默认的代理服务端口
+	TIMEOUT = 10 * time.Second // 单次调用的超时时间
+	RETRIES = 5                // 主节点不可用时的重试次数
+	HEADER  = "authorization"  // 携带令牌的元数据
+	SCHEME  = "Bearer "        // 令牌的前缀
+)
+
+var ErrUnauthenticated = status.Error(codes.Unauthenticated, "代理服务的令牌无效")
+
+type (
+	RunRequest struct {
+		Record   *models.PipelineRecords `json:"record"`
+		Snapshot string                  `json:"snapshot"` // 快照不参与 JSON 序列化，需要单独传递
+	}
+	FinishReply struct {
+		Finished bool `json:"finished"`
+	}
+	HeartbeatRequest struct {
+		RunId string    `json:"run_id"`
+		At    time.Time `json:"at"`
+	}
+	CancelRequest struct {
+		RunId     string `json:"run_id"`
+		Requester string `json:"requester"`
+	}
+	StepRequest struct {
+		Step *models.TaskRecords `json:"step"`
+	}
+	ScheduledRequest struct {
+		PipelineId string `json:"pipeline_id"`
+		NodeId     string `json:"node_id"`
+	}
+	ScheduledReply struct {
+		Time  time.Time `json:"time"`
+		Exist bool      `json:"exist"`
+	}
+	IdRequest struct {
+		Id string `json:"id"`
+	}
+	NodeReply struct {
+		Node *models.Node `json:"node"`
+	}
+	ConcurrencyReply struct {
+		Max int `json:"max"`
+	}
+	RateLimitReply struct {
+		Limit *models.RateLimit `json:"limit"`
+		Exist bool              `json:"exist"`
+	}
+	SecretsRequest struct {
+		Names []string `json:"names"`
+	}
+	SecretsReply struct {
+		Values map[string]string `json:"values"`
+	}
+	NotificationsReply struct {
+		Notifications []models.PipelineNotification `json:"notifications"`
+	}
+	TemplateRequest struct {
+		Channel   string `json:"channel"`
+		Event     string `json:"event"`
+		ProjectId string `json:"project_id"`
+	}
+	TemplateReply struct {
+		Template *models.NotificationTemplate `json:"template"`
+		Exist    bool                         `json:"exist"`
+	}
+	Ack struct{}
+)
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: SERVICE,
+	HandlerType: (*models.Repository)(nil),
+	Methods: []grpc.MethodDesc{
+		unary("StoreRun", func() interface{} { return new(RunRequest) }, func(repo models.Repository, in interface{}) (interface{}, error) {
+			request := in.(*RunRequest)
+			if request.Record == nil {
+				return nil, status.Error(codes.InvalidArgument, "缺少执行记录")
+			}
+			request.Record.Snapshot = request.Snapshot
+			return &Ack{}, repo.StoreRun(request.Record)
+		}),
+		unary("Heartbeat", func() interface{} { return new(HeartbeatRequest) }, func(repo models.Repository, in interface{}) (interface{}, error) {
+			request := in.(*HeartbeatRequest)
+			return &Ack{}, repo.Heartbeat(request.RunId, request.At)
+		}),
+		unary("Cancelling", func() interface{} { return new(CancelRequest) }, func(repo models.Repository, in interface{}) (interface{}, error) {
+			request := in.(*CancelRequest)
+			return &Ack{}, repo.Cancelling(request.RunId, request.Requester)
+		}),
+		unary("FinishRun", func() interface{} { return new(RunRequest) }, func(repo models.Repository, in interface{}) (interface{}, error) {
+			request := in.(*RunRequest)
+			if request.Record == nil {
+				return nil, status.Error(codes.InvalidArgument, "缺少执行记录")
+			}
+			// 保存执行结果时更新全部字段，需要保留快照
+			request.Record.Snapshot = request.Snapshot
+			finished, err := repo.FinishRun(request.Record)
+			return &FinishReply{Finished: finished}, err
+		}),
+		unary("StoreStep", func() interface{} { return new(StepRequest) }, func(repo models.Repository, in interface{}) (interface{}, error) {
+			request := in.(*StepRequest)
+			if request.Step == nil {
+				return nil, status.Error(codes.InvalidArgument, "缺少步骤的执行记录")
+			}
+			return &Ack{}, repo.StoreStep(request.Step)
+		}),
+		unary("LastScheduled", func() interface{} { return new(ScheduledRequest) }, func(repo models.Repository, in interface{}) (interface{}, error) {
+			request := in.(*ScheduledRequest)
+			last, exist, err := repo.LastScheduled(request.PipelineId, request.NodeId)
+			return &ScheduledReply{Time: last, Exist: exist}, err
+		}),
+		unary("Node", func() interface{} { return new(IdRequest) }, func(repo models.Repository, in interface{}) (interface{}, error) {
+			node, err := repo.Node(in.(*IdRequest).Id)
+			return &NodeReply{Node: node}, err
+		}),
+		unary("Concurrency", func() interface{} { return new(IdRequest) }, func(repo models.Repository, in interface{}) (interface{}, error) {
+			max, err := repo.Concurrency(in.(*IdRequest).Id)
+			return &ConcurrencyReply{Max: max}, err
+		}),
+		unary("RateLimit", func() interface{} { return new(IdRequest) }, func(repo models.Repository, in interface{}) (interface{}, error) {
+			limit, exist, err := repo.RateLimit(in.(*IdRequest).Id)
+			return &RateLimitReply{Limit: limit, Exist: exist}, err
+		}),
+		unary("OpenSecrets", func() interface{} { return new(SecretsRequest) }, func(repo models.Repository, in interface{}) (interface{}, error) {
+			values, err := repo.OpenSecrets(in.(*SecretsRequest).Names)
+			return &SecretsReply{Values: values}, err
+		}),
+		unary("Notifications", func() interface{} { return new(IdRequest) }, func(repo models.Repository, in interface{}) (interface{}, error) {
+			notifications, err := repo.Notifications(in.(*IdRequest).Id)
+			return &NotificationsReply{Notifications: notifications}, err
+		}),
+		unary("Template", func() interface{} { return new(TemplateRequest) }, func(repo models.Repository, in interface{}) (interface{}, error) {
+			request := in.(*TemplateRequest)
+			tpl, exist, err := repo.Template(request.Channel, request.Event, request.ProjectId)
+			return &TemplateReply{Template: tpl, Exist: exist}, err
+		}),
+	},
+}
+
+// 在主节点上启动代理服务，所有调用都需要携带令牌
+func Serve(address, token string, repo models.Repository) error {
+	if token == "" {
+		return fmt.Errorf("未配置代理服务的令牌")
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	server := grpc.NewServer(grpc.UnaryInterceptor(authenticate(token)))
+	server.RegisterService(&serviceDesc, repo)
+	return server.Serve(listener)
+}
+
+// 校验调用方携带的令牌
+func authenticate(token string) grpc.UnaryServerInterceptor {
+	expected := []byte(SCHEME + token)
+	return func(ctx context.Context, in interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get(HEADER)
+		if len(values) != 1 || subtle.ConstantTimeCompare([]byte(values[0]), expected) != 1 {
+			return nil, ErrUnauthenticated
+		}
+
+		return handler(ctx, in)
+	}
+}
+
+// 创建一元调用的处理函数，request 创建请求的实例
+func unary(method string, request func() interface{}, call func(repo models.Repository, in interface{}) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: method,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := request()
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+
+			handle := func(ctx context.Context, in interface{}) (interface{}, error) {
+				return call(srv.(models.Repository), in)
+			}
+
+			if interceptor == nil {
+				return handle(ctx, in)
+			}
+
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fmt.Sprintf("/%s/%s", SERVICE, method)}
+			return interceptor(ctx, in, info, handle)
+		},
+	}
+}
@@ -0,0 +1,137 @@
+package budget
+
+import (
+	"context"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/internal/notify"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/go-xorm/builder"
+	"log"
+	"time"
+)
+
+// 定期统计设置了预算的项目本月使用的节点分钟，更新超出预算的项目供工作节点检查，只在领导者上执行
+func Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !discover.Leading() {
+				continue
+			}
+
+			if exceeded, err := Evaluate(time.Now()); err != nil {
+				log.Println(err)
+			} else if len(exceeded) > 0 {
+				log.Printf("%d projects exceeded their monthly budget\n", len(exceeded))
+			}
+		}
+	}
+}
+
+// 更新各项目的预算状态，本月首次超出预算时通知项目的负责人，返回新超出预算的项目
+func Evaluate(now time.Time) ([]*discover.Budget, error) {
+	projects := make([]models.Project, 0)
+	if err := models.Engine.Where(builder.Gt{"budget": 0}).Cols("id", "name", "team_id", "budget", "budget_action").Find(&projects); err != nil {
+		return nil, err
+	}
+
+	current, err := discover.Budgets()
+	if err != nil {
+		return nil, err
+	}
+
+	month := services.MonthOf(now)
+	exceeded := make([]*discover.Budget, 0)
+	for _, project := range projects {
+		used, err := services.BudgetUsed(project.Id, month, month.AddDate(0, 1, 0))
+		if err != nil {
+			return exceeded, err
+		}
+
+		previous, exist := current[project.Id]
+		delete(current, project.Id)
+
+		if used < float64(project.Budget) {
+			if exist {
+				if err := discover.DeleteBudget(project.Id); err != nil {
+					return exceeded, err
+				}
+				log.Printf("Project %s is back within its budget\n", project.Id)
+			}
+			continue
+		}
+
+		budget := &discover.Budget{
+			ProjectId: project.Id,
+			Month:     month.Format("2006-01"),
+			Used:      used,
+			Limit:     project.Budget,
+			Action:    project.BudgetAction,
+		}
+
+		if err := discover.PutBudget(budget); err != nil {
+			return exceeded, err
+		}
+
+		// 同一个月只通知一次，领导者切换后也不重复通知
+		if !exist || previous.Month != budget.Month {
+			exceeded = append(exceeded, budget)
+			go notifyOwners(project, budget)
+		}
+	}
+
+	// 取消了预算或者已经删除的项目
+	for id := range current {
+		if err := discover.DeleteBudget(id); err != nil {
+			return exceeded, err
+		}
+	}
+
+	return exceeded, nil
+}
+
+// 通过邮件通知项目所属团队的成员，项目没有所属团队时通知管理员
+func notifyOwners(project models.Project, budget *discover.Budget) {
+	users := make([]models.User, 0)
+	owners := builder.Or(builder.Eq{"role": models.ROLEADMIN}, builder.Eq{"manager": true})
+	if project.TeamId != "" {
+		owners = builder.In("id", builder.Select("user_id").From(new(models.TeamMember).TableName()).Where(builder.Eq{"team_id": project.TeamId}))
+	}
+
+	if err := models.Engine.Where(builder.Neq{"email": ""}.And(owners)).Find(&users); err != nil {
+		log.Println(err)
+		return
+	}
+
+	action := "拒绝执行"
+	if budget.Action == models.BUDGETDEFER {
+		action = "推迟到预算恢复后执行"
+	}
+
+	for _, user := range users {
+		mailer := &notify.Mail{
+			From:       fmt.Sprintf("%s<%s>", "ECTS", config.Conf.Notification.User),
+			To:         user.Email,
+			Subject:    fmt.Sprintf("项目 %s 超出本月预算", project.Name),
+			Year:       time.Now().Year(),
+			SiteURL:    config.Conf.Notification.Url,
+			SiteTitle:  "Elastic Crontab System",
+			Greeting:   fmt.Sprintf("Hello %s", user.Name),
+			Intro:      fmt.Sprintf("项目 %s 在 %s 已使用 %.0f 节点分钟，超出每月 %d 分钟的预算。本月剩余时间内该项目的非关键流水线将%s，关键流水线不受影响。", project.Name, budget.Month, budget.Used, budget.Limit, action),
+			Outro:      "如需继续执行，请调整项目的预算或者将流水线标记为关键流水线。",
+			Salutation: "Regards",
+		}
+
+		if err := mailer.Generator("info").Send(); err != nil {
+			log.Println(err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package clock
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	SOURCESYSTEM    = "system"    // 直接使用系统时间
+	SOURCEMONOTONIC = "monotonic" // 使用单调时钟推算时间，系统时间被调整时不受影响
+
+	NTPEPOCHOFFSET = 2208988800      // 1900 年到 1970 年的秒数
+	NTPTIMEOUT     = 5 * time.Second // 请求授时服务器的超时时间
+)
+
+var ErrInvalidResponse = errors.New("授时服务器的响应无效")
+
+type (
+	Clock struct {
+		mutex     sync.RWMutex
+		source    string
+		anchor    time.Time     // 启动时的时间，带有单调时钟读数
+		offset    time.Duration // 与授时服务器的偏差
+		authority string        // 授时服务器地址，为空时不校准
+		maxDrift  time.Duration // 单次校准超过该偏差时记录日志
+	}
+)
+
+// 创建时钟，source 为 monotonic 时以启动时的系统时间为基准，之后只使用单调时钟推算
+func New(source, authority string, maxDrift time.Duration) *Clock {
+	if source != SOURCEMONOTONIC {
+		source = SOURCESYSTEM
+	}
+
+	return &Clock{
+		source:    source,
+		anchor:    time.Now(),
+		authority: authority,
+		maxDrift:  maxDrift,
+	}
+}
+
+// 获取当前时间，已补偿与授时服务器的偏差
+func (clock *Clock) Now() time.Time {
+	clock.mutex.RLock()
+	defer clock.mutex.RUnlock()
+
+	return clock.local().Add(clock.offset)
+}
+
+// 未校准的本地时间，去掉单调时钟读数，以便和定时器计算出的时间比较
+func (clock *Clock) local() time.Time {
+	if clock.source == SOURCEMONOTONIC {
+		return clock.anchor.Add(time.Since(clock.anchor)).Round(0)
+	}
+
+	return time.Now().Round(0)
+}
+
+// 定期向授时服务器校准，未配置授时服务器时直接返回
+func (clock *Clock) Sync(interval time.Duration, done <-chan struct{}) {
+	if clock.authority == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := clock.calibrate(); err != nil {
+			log.Printf("Failed to calibrate clock with %s: %s\n", clock.authority, err)
+		}
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// 向授时服务器请求一次时间并更新偏差
+func (clock *Clock) calibrate() error {
+	offset, err := query(clock.authority, clock.local)
+	if err != nil {
+		return err
+	}
+
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	if drift := offset - clock.offset; drift > clock.maxDrift || -drift > clock.maxDrift {
+		log.Printf("Clock drifted %s from %s\n", drift, clock.authority)
+	}
+	clock.offset = offset
+
+	return nil
+}
+
+// 使用 SNTP 协议获取本地时间与授时服务器的偏差
+func query(authority string, now func() time.Time) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(authority); err != nil {
+		authority = net.JoinHostPort(authority, "123")
+	}
+
+	conn, err := net.DialTimeout("udp", authority, NTPTIMEOUT)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(NTPTIMEOUT)); err != nil {
+		return 0, err
+	}
+
+	// LI = 0，版本号为 3，客户端模式
+	request := make([]byte, 48)
+	request[0] = 0x1B
+
+	sent := now()
+	if _, err := conn.Write(request); err != nil {
+		return 0, err
+	}
+
+	response := make([]byte, 48)
+	if n, err := conn.Read(response); err != nil {
+		return 0, err
+	} else if n < 48 {
+		return 0, ErrInvalidResponse
+	}
+	received := now()
+
+	return offset(response, sent, received)
+}
+
+// 根据服务器的接收和发送时间计算偏差：((T2 - T1) + (T3 - T4)) / 2
+func offset(response []byte, sent, received time.Time) (time.Duration, error) {
+	if len(response) < 48 || response[1] == 0 {
+		return 0, ErrInvalidResponse
+	}
+
+	receive := ntpTime(response[32:40])
+	transmit := ntpTime(response[40:48])
+
+	return (receive.Sub(sent) + transmit.Sub(received)) / 2, nil
+}
+
+// 解析 NTP 时间戳，前 32 位为秒，后 32 位为秒的小数部分
+func ntpTime(data []byte) time.Time {
+	seconds := int64(binary.BigEndian.Uint32(data[:4])) - NTPEPOCHOFFSET
+	fraction := int64(binary.BigEndian.Uint32(data[4:8]))
+	return time.Unix(seconds, fraction*int64(time.Second)>>32)
+}
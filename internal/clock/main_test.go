@@ -0,0 +1,61 @@
+package clock
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// 模拟授时服务器，返回比本地时间快 skew 的时间
+func serve(t *testing.T, skew time.Duration) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		defer conn.Close()
+		buffer := make([]byte, 48)
+		_, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+
+		response := make([]byte, 48)
+		response[0] = 0x1C
+		response[1] = 2
+		stamp := func(data []byte, moment time.Time) {
+			binary.BigEndian.PutUint32(data[:4], uint32(moment.Unix()+NTPEPOCHOFFSET))
+			binary.BigEndian.PutUint32(data[4:8], uint32((int64(moment.Nanosecond())<<32)/int64(time.Second)))
+		}
+		stamp(response[32:40], time.Now().Add(skew))
+		stamp(response[40:48], time.Now().Add(skew))
+		_, _ = conn.WriteTo(response, addr)
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestCalibrate(t *testing.T) {
+	clock := New(SOURCEMONOTONIC, serve(t, 3*time.Second), time.Second)
+	if err := clock.calibrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := clock.Now().Sub(time.Now()) - 3*time.Second; diff > 50*time.Millisecond || diff < -50*time.Millisecond {
+		t.Errorf("expected the clock to be 3s ahead, got %s", clock.Now().Sub(time.Now()))
+	}
+}
+
+func TestOffsetRejectsUnsynchronized(t *testing.T) {
+	if _, err := offset(make([]byte, 48), time.Now(), time.Now()); err != ErrInvalidResponse {
+		t.Errorf("expected ErrInvalidResponse for stratum 0, got %v", err)
+	}
+}
+
+func TestSourceDefaultsToSystem(t *testing.T) {
+	if clock := New("unknown", "", 0); clock.source != SOURCESYSTEM {
+		t.Errorf("expected system source, got %s", clock.source)
+	}
+}
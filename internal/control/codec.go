@@ -0,0 +1,27 @@
+package control
+
+import (
+	"encoding/json"
+	"google.golang.org/grpc/encoding"
+)
+
+// 控制通道的消息直接使用模型的 JSON 序列化，无需维护 proto 定义
+const CODEC = "json"
+
+type codec struct{}
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (codec) Name() string {
+	return CODEC
+}
@@ -0,0 +1,151 @@
+package control
+
+import (
+	"io"
+	"sync"
+)
+
+const (
+	HUBBUFFER  = 256     // 每个订阅者最多缓存的日志片段数，订阅者读取过慢时丢弃新的片段，避免阻塞任务执行
+	HUBHISTORY = 1 << 20 // 每个正在执行的流水线保留的最近输出字节数，用于断线重连后从偏移量续传
+)
+
+type (
+	// 执行过程中实时输出的日志片段
+	LogChunk struct {
+		RunId  string `json:"run_id"`
+		TaskId string `json:"task_id"`
+		Offset int64  `json:"offset"` // 片段在整个执行输出中的起始字节偏移量
+		Data   []byte `json:"data"`
+	}
+	// 正在执行的流水线的输出
+	feed struct {
+		subscribers map[chan *LogChunk]struct{}
+		history     []*LogChunk // 最近的输出片段
+		size        int         // 保留的输出字节数
+		offset      int64       // 已经输出的字节数
+	}
+	hub struct {
+		mutex sync.Mutex
+		feeds map[string]*feed
+	}
+	writer struct {
+		runId  string
+		taskId string
+	}
+)
+
+var logs = &hub{feeds: make(map[string]*feed)}
+
+// 创建向订阅者发布步骤输出的 Writer
+func Writer(runId, taskId string) io.Writer {
+	return &writer{runId: runId, taskId: taskId}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	data := make([]byte, len(p))
+	copy(data, p)
+	logs.publish(&LogChunk{RunId: w.runId, TaskId: w.taskId, Data: data})
+	return len(p), nil
+}
+
+// 流水线开始执行，之后才能订阅输出
+func Start(runId string) {
+	logs.mutex.Lock()
+	defer logs.mutex.Unlock()
+
+	if logs.feeds[runId] == nil {
+		logs.feeds[runId] = &feed{subscribers: make(map[chan *LogChunk]struct{})}
+	}
+}
+
+// 流水线执行结束，关闭所有订阅
+func Finish(runId string) {
+	logs.mutex.Lock()
+	defer logs.mutex.Unlock()
+
+	if feed, exist := logs.feeds[runId]; exist {
+		for channel := range feed.subscribers {
+			close(channel)
+		}
+	}
+	delete(logs.feeds, runId)
+}
+
+func (hub *hub) publish(chunk *LogChunk) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	feed, exist := hub.feeds[chunk.RunId]
+	if !exist {
+		return
+	}
+
+	chunk.Offset = feed.offset
+	feed.offset += int64(len(chunk.Data))
+	feed.history = append(feed.history, chunk)
+	feed.size += len(chunk.Data)
+	for len(feed.history) > 1 && feed.size-len(feed.history[0].Data) >= HUBHISTORY {
+		feed.size -= len(feed.history[0].Data)
+		feed.history[0] = nil
+		feed.history = feed.history[1:]
+	}
+
+	for channel := range feed.subscribers {
+		select {
+		case channel <- chunk:
+		default:
+		}
+	}
+}
+
+// 订阅执行记录的输出，先返回偏移量之后仍保留的片段，再通过通道推送新的片段，流水线不在当前节点执行时返回 false
+func (hub *hub) subscribe(runId string, offset int64) ([]*LogChunk, <-chan *LogChunk, func(), bool) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	feed, running := hub.feeds[runId]
+	if !running {
+		return nil, nil, nil, false
+	}
+
+	channel := make(chan *LogChunk, HUBBUFFER)
+	feed.subscribers[channel] = struct{}{}
+
+	return feed.since(offset), channel, func() {
+		hub.mutex.Lock()
+		defer hub.mutex.Unlock()
+
+		if feed, exist := hub.feeds[runId]; exist {
+			if _, exist := feed.subscribers[channel]; exist {
+				delete(feed.subscribers, channel)
+				close(channel)
+			}
+		}
+	}, true
+}
+
+// 偏移量之后仍保留的片段，偏移量落在片段中间时只返回剩余的部分
+func (feed *feed) since(offset int64) []*LogChunk {
+	backlog := make([]*LogChunk, 0)
+	for _, chunk := range feed.history {
+		end := chunk.Offset + int64(len(chunk.Data))
+		if end <= offset {
+			continue
+		}
+
+		if chunk.Offset < offset {
+			backlog = append(backlog, &LogChunk{
+				RunId:  chunk.RunId,
+				TaskId: chunk.TaskId,
+				Offset: offset,
+				Data:   chunk.Data[offset-chunk.Offset:],
+			})
+			continue
+		}
+
+		backlog = append(backlog, chunk)
+	}
+
+	return backlog
+}
@@ -0,0 +1,59 @@
+package control
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResume(t *testing.T) {
+	Start("resume")
+	defer Finish("resume")
+
+	output := Writer("resume", "task")
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := output.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backlog, chunks, cancel, ok := logs.subscribe("resume", 9)
+	if !ok {
+		t.Fatal("expected the run to be subscribable")
+	}
+	defer cancel()
+
+	text := ""
+	for _, chunk := range backlog {
+		text += string(chunk.Data)
+	}
+	if text != "ond\nthird\n" || backlog[0].Offset != 9 {
+		t.Errorf("expected to resume from the middle of the second chunk, got %q at %d", text, backlog[0].Offset)
+	}
+
+	if _, err := output.Write([]byte("fourth\n")); err != nil {
+		t.Fatal(err)
+	}
+	if chunk := <-chunks; chunk.Offset != 19 || string(chunk.Data) != "fourth\n" {
+		t.Errorf("expected the live chunk at offset 19, got %q at %d", chunk.Data, chunk.Offset)
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	Start("limit")
+	defer Finish("limit")
+
+	output := Writer("limit", "task")
+	block := strings.Repeat("x", HUBHISTORY/4)
+	for index := 0; index < 8; index++ {
+		if _, err := output.Write([]byte(block)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backlog, _, cancel, _ := logs.subscribe("limit", 0)
+	defer cancel()
+
+	if len(backlog) != 4 || backlog[0].Offset != int64(4*len(block)) {
+		t.Errorf("expected only the latest %d bytes to be kept, got %d chunks", HUBHISTORY, len(backlog))
+	}
+}
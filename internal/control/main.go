@@ -0,0 +1,357 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	SERVICE = "ects.Control"  // 主节点与工作节点之间的控制服务
+	PORT    = 9702            // 工作节点默认的控制服务端口
+	TIMEOUT = 5 * time.Second // 单次调用的超时时间
+
+	SIGNALTERM = "SIGTERM" // 先请求进程退出，超过宽限期后强制结束
+	SIGNALKILL = "SIGKILL" // 立即强制结束进程
+)
+
+var ErrNotRunning = errors.New("执行记录不在该节点上运行")
+
+type (
+	// 工作节点实现的控制接口
+	Handler interface {
+		Trigger(trigger *models.Trigger) error         // 立即执行流水线
+		Kill(request *KillRequest) (*KillReply, error) // 丢弃等待执行的指令，需要时同时终止正在执行的流水线
+		Probe() (*ProbeReply, error)                   // 健康检查
+		Drain(drained bool) (*ProbeReply, error)       // 进入或退出维护状态，正在执行的流水线不受影响
+	}
+	TriggerRequest struct {
+		Trigger *models.Trigger `json:"trigger"`
+	}
+	KillRequest struct {
+		PipelineId string `json:"pipeline_id"`
+		Running    bool   `json:"running"`             // 是否同时终止正在执行的流水线
+		RunId      string `json:"run_id,omitempty"`    // 不为空时只处理该次执行，其他执行和等待执行的指令不受影响
+		GroupId    string `json:"group_id,omitempty"`  // 不为空时只处理该执行组内的执行
+		Requester  string `json:"requester,omitempty"` // 发出强杀指令的用户ID，记录在节点的日志中
+		StepId     string `json:"step_id,omitempty"`   // 不为空时只终止该次执行中该任务的步骤，需要同时指定执行记录
+		Signal     string `json:"signal,omitempty"`    // 首先发送的信号，SIGKILL 时立即结束进程，为空时使用 SIGTERM
+		Grace      int    `json:"grace,omitempty"`     // 发送 SIGTERM 后等待进程退出的秒数，0 使用节点配置的宽限期
+	}
+	KillReply struct {
+		Dropped int `json:"dropped"` // 丢弃的等待执行的指令数量
+		Killed  int `json:"killed"`  // 终止的正在执行的流水线数量
+	}
+	ProbeRequest struct{}
+	DrainRequest struct {
+		Drained bool `json:"drained"`
+	}
+	ProbeReply struct {
+		Id       string    `json:"id"`
+		Name     string    `json:"name"`
+		Version  string    `json:"version"`
+		Running  int       `json:"running"` // 正在执行的流水线数量
+		Queued   int       `json:"queued"`  // 等待执行的指令数量
+		Planned  int       `json:"planned"` // 调度计划中的流水线数量
+		Time     time.Time `json:"time"`    // 节点的当前时间，用于检查时钟偏差
+		Capacity int       `json:"capacity"`
+		Drained  bool      `json:"drained"` // 是否处于维护状态
+	}
+	LogRequest struct {
+		RunId  string `json:"run_id"`
+		Offset int64  `json:"offset"` // 从该字节偏移量开始推送，用于断线重连后续传
+	}
+	Ack struct{}
+)
+
+var (
+	serviceDesc = grpc.ServiceDesc{
+		ServiceName: SERVICE,
+		HandlerType: (*Handler)(nil),
+		Methods: []grpc.MethodDesc{
+			{MethodName: "Trigger", Handler: triggerHandler},
+			{MethodName: "Kill", Handler: killHandler},
+			{MethodName: "Probe", Handler: probeHandler},
+			{MethodName: "Drain", Handler: drainHandler},
+		},
+		Streams: []grpc.StreamDesc{
+			{StreamName: "Logs", Handler: logsHandler, ServerStreams: true},
+		},
+	}
+
+	// 到工作节点的连接，按地址复用
+	conns = make(map[string]*grpc.ClientConn)
+	mutex sync.Mutex
+)
+
+// 在工作节点上启动控制服务
+func Serve(address string, handler Handler) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	server := grpc.NewServer()
+	server.RegisterService(&serviceDesc, handler)
+	return server.Serve(listener)
+}
+
+// 调用时使用的拦截器，未设置拦截器时直接调用
+func intercept(ctx context.Context, srv interface{}, method string, in interface{}, interceptor grpc.UnaryServerInterceptor, call func(ctx context.Context, in interface{}) (interface{}, error)) (interface{}, error) {
+	if interceptor == nil {
+		return call(ctx, in)
+	}
+
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fmt.Sprintf("/%s/%s", SERVICE, method)}
+	return interceptor(ctx, in, info, call)
+}
+
+func triggerHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TriggerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+
+	return intercept(ctx, srv, "Trigger", in, interceptor, func(ctx context.Context, in interface{}) (interface{}, error) {
+		request := in.(*TriggerRequest)
+		if request.Trigger == nil || request.Trigger.Pipeline == nil {
+			return nil, status.Error(codes.InvalidArgument, "缺少需要执行的流水线")
+		}
+		return &Ack{}, srv.(Handler).Trigger(request.Trigger)
+	})
+}
+
+func killHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KillRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+
+	return intercept(ctx, srv, "Kill", in, interceptor, func(ctx context.Context, in interface{}) (interface{}, error) {
+		return srv.(Handler).Kill(in.(*KillRequest))
+	})
+}
+
+func probeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ProbeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+
+	return intercept(ctx, srv, "Probe", in, interceptor, func(ctx context.Context, in interface{}) (interface{}, error) {
+		return srv.(Handler).Probe()
+	})
+}
+
+func drainHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DrainRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+
+	return intercept(ctx, srv, "Drain", in, interceptor, func(ctx context.Context, in interface{}) (interface{}, error) {
+		return srv.(Handler).Drain(in.(*DrainRequest).Drained)
+	})
+}
+
+// 推送正在执行的流水线的输出，流水线结束时关闭
+func logsHandler(srv interface{}, stream grpc.ServerStream) error {
+	in := new(LogRequest)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+
+	backlog, chunks, cancel, ok := logs.subscribe(in.RunId, in.Offset)
+	if !ok {
+		return status.Error(codes.NotFound, ErrNotRunning.Error())
+	}
+	defer cancel()
+
+	for _, chunk := range backlog {
+		if err := stream.SendMsg(chunk); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				return nil
+			}
+			if err := stream.SendMsg(chunk); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// 获取到工作节点的连接
+func dial(node *models.Node) (*grpc.ClientConn, error) {
+	if node.Host == "" || node.Port == 0 {
+		return nil, fmt.Errorf("节点 %s 未提供控制服务地址", node.Name)
+	}
+
+	address := net.JoinHostPort(node.Host, fmt.Sprintf("%d", node.Port))
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if conn, exist := conns[address]; exist {
+		return conn, nil
+	}
+
+	conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithDefaultCallOptions(grpc.CallContentSubtype(CODEC)))
+	if err != nil {
+		return nil, err
+	}
+
+	conns[address] = conn
+	return conn, nil
+}
+
+// 调用工作节点的控制服务
+func invoke(node *models.Node, method string, in, out interface{}) error {
+	conn, err := dial(node)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT)
+	defer cancel()
+
+	return conn.Invoke(ctx, fmt.Sprintf("/%s/%s", SERVICE, method), in, out)
+}
+
+// 向指定节点下发立即执行的指令
+func Trigger(node *models.Node, trigger *models.Trigger) error {
+	return invoke(node, "Trigger", &TriggerRequest{Trigger: trigger}, &Ack{})
+}
+
+// 根据节点ID下发立即执行的指令
+func Dispatch(nodeId string, trigger *models.Trigger) error {
+	node := &models.Node{}
+	exist, err := models.Engine.Id(nodeId).Get(node)
+	if err != nil {
+		return err
+	}
+
+	if !exist {
+		return fmt.Errorf("节点 %s 不存在", nodeId)
+	}
+
+	return Trigger(node, trigger)
+}
+
+// 通知所有在线的工作节点终止流水线，流水线可能由备用节点或者重试时选择的其他节点执行
+func KillAll(request *KillRequest) (*KillReply, error) {
+	nodes := make([]models.Node, 0)
+	// 维护中的节点可能仍有正在执行的流水线
+	if err := models.Engine.Where(builder.Eq{"mode": models.WORKER, "status": []string{models.ONLINE, models.DRAINED}}).Find(&nodes); err != nil {
+		return nil, err
+	}
+
+	// 先记录终止请求，工作节点收到指令后更新为正在终止
+	if request.Running {
+		if _, err := models.Cancel(request.cond(), nil, models.CANCELREQUESTED, request.Requester); err != nil {
+			return nil, err
+		}
+	}
+
+	total := &KillReply{}
+	var failed error
+	for index := range nodes {
+		reply, err := Kill(&nodes[index], request)
+		if err != nil {
+			failed = fmt.Errorf("节点 %s：%s", nodes[index].Name, err)
+			continue
+		}
+		total.Dropped += reply.Dropped
+		total.Killed += reply.Killed
+	}
+
+	return total, failed
+}
+
+// 强杀指令范围内的执行记录
+func (request *KillRequest) cond() builder.Cond {
+	cond := builder.Eq{"pipeline_id": request.PipelineId}
+	if request.RunId != "" {
+		cond["id"] = request.RunId
+	}
+	if request.GroupId != "" {
+		cond["group_id"] = request.GroupId
+	}
+
+	return cond
+}
+
+// 通知节点丢弃等待执行的指令，需要时同时终止正在执行的流水线
+func Kill(node *models.Node, request *KillRequest) (*KillReply, error) {
+	reply := &KillReply{}
+	err := invoke(node, "Kill", request, reply)
+	return reply, err
+}
+
+// 检查节点的健康状况
+func Probe(node *models.Node) (*ProbeReply, error) {
+	reply := &ProbeReply{}
+	err := invoke(node, "Probe", &ProbeRequest{}, reply)
+	return reply, err
+}
+
+// 通知节点进入或退出维护状态
+func Drain(node *models.Node, drained bool) (*ProbeReply, error) {
+	reply := &ProbeReply{}
+	err := invoke(node, "Drain", &DrainRequest{Drained: drained}, reply)
+	return reply, err
+}
+
+// 从指定的字节偏移量开始订阅节点上正在执行的流水线的输出，handle 返回错误或 ctx 结束时停止
+func Logs(ctx context.Context, node *models.Node, runId string, offset int64, handle func(chunk *LogChunk) error) error {
+	conn, err := dial(node)
+	if err != nil {
+		return err
+	}
+
+	stream, err := conn.NewStream(ctx, &serviceDesc.Streams[0], fmt.Sprintf("/%s/Logs", SERVICE))
+	if err != nil {
+		return err
+	}
+
+	if err := stream.SendMsg(&LogRequest{RunId: runId, Offset: offset}); err != nil {
+		return err
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	for {
+		chunk := new(LogChunk)
+		if err := stream.RecvMsg(chunk); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if status.Code(err) == codes.NotFound {
+				return ErrNotRunning
+			}
+			return err
+		}
+
+		if err := handle(chunk); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	LOCALEZH = "zh"
+	LOCALEEN = "en"
+)
+
+type (
+	// 各语言的描述用语
+	phrases struct {
+		every     string   // 每个单位，如 every minute
+		step      string   // 间隔，如 every 5 minutes
+		rng       string   // 范围
+		at        string   // 指定值
+		separator string   // 列表分隔符
+		joiner    string   // 各部分的连接符
+		clock     string   // 固定时刻
+		daily     string   // 每天
+		weekdays  string   // 工作日
+		weekends  string   // 周末
+		weekly    string   // 每周的某几天
+		monthly   string   // 每月的某几天
+		lastDay   string   // 每月最后一天
+		months    string   // 月份
+		years     string   // 年份
+		units     []string // 秒、分、时的单位名称
+		each      []string // 每个单位时使用的名称
+		plural    []string // 秒、分、时的复数单位名称
+		weekNames []string
+		monthName []string
+	}
+)
+
+var (
+	vocabulary = map[string]*phrases{
+		LOCALEEN: {
+			every:     "every %s",
+			step:      "every %d %s",
+			rng:       "%s %s through %s",
+			at:        "at %s %s",
+			separator: ", ",
+			joiner:    " ",
+			clock:     "at %s",
+			daily:     "every day",
+			weekdays:  "every weekday",
+			weekends:  "every weekend",
+			weekly:    "every %s",
+			monthly:   "on day %s of the month",
+			lastDay:   "on the last day of the month",
+			months:    "in %s",
+			years:     "in %s",
+			units:     []string{"second", "minute", "hour"},
+			each:      []string{"second", "minute", "hour"},
+			plural:    []string{"seconds", "minutes", "hours"},
+			weekNames: []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+			monthName: []string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		},
+		LOCALEZH: {
+			every:     "每%s",
+			step:      "每%d%s",
+			rng:       "%[2]s至%[3]s%[1]s",
+			at:        "%[2]s%[1]s",
+			separator: "、",
+			joiner:    " ",
+			clock:     "%s",
+			daily:     "每天",
+			weekdays:  "每个工作日",
+			weekends:  "每个周末",
+			weekly:    "每%s",
+			monthly:   "每月%s日",
+			lastDay:   "每月最后一天",
+			months:    "%s",
+			years:     "%s年",
+			units:     []string{"秒", "分", "时"},
+			each:      []string{"秒", "分钟", "小时"},
+			plural:    []string{"秒", "分钟", "小时"},
+			weekNames: []string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"},
+			monthName: []string{"1月", "2月", "3月", "4月", "5月", "6月", "7月", "8月", "9月", "10月", "11月", "12月"},
+		},
+	}
+
+	// 预定义的表达式
+	macros = map[string]string{
+		"@yearly":   "0 0 0 1 1 * *",
+		"@annually": "0 0 0 1 1 * *",
+		"@monthly":  "0 0 0 1 * * *",
+		"@weekly":   "0 0 0 * * 0 *",
+		"@daily":    "0 0 0 * * * *",
+		"@midnight": "0 0 0 * * * *",
+		"@hourly":   "0 0 * * * * *",
+	}
+
+	weekAbbr  = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+	monthAbbr = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+)
+
+// 根据 Accept-Language 请求头选择描述语言，默认中文
+func Locale(header string) string {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.ToLower(strings.TrimSpace(strings.SplitN(tag, ";", 2)[0]))
+		language := strings.SplitN(tag, "-", 2)[0]
+		if _, exist := vocabulary[language]; exist {
+			return language
+		}
+	}
+
+	return LOCALEZH
+}
+
+// 将定时器表达式转换为可读的描述，表达式需要事先通过 cronexpr 校验，zone 为执行节点的时区名称
+func Describe(spec, locale, zone string) string {
+	words, exist := vocabulary[locale]
+	if !exist {
+		words = vocabulary[LOCALEZH]
+	}
+
+	fields := normalize(spec)
+	if fields == nil {
+		return spec
+	}
+	second, minute, hour, dom, month, dow, year := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5], fields[6]
+
+	parts := make([]string, 0)
+
+	if day := words.day(dom, dow); day != "" {
+		parts = append(parts, day)
+	}
+
+	if month != "*" && month != "?" {
+		parts = append(parts, fmt.Sprintf(words.months, words.list(month, monthAbbr, words.monthName, 1)))
+	}
+
+	if year != "*" && year != "?" {
+		parts = append(parts, fmt.Sprintf(words.years, year))
+	}
+
+	if single(minute) && single(hour) && single(second) {
+		clock := fmt.Sprintf("%02s:%02s", hour, minute)
+		if second != "0" {
+			clock = fmt.Sprintf("%s:%02s", clock, second)
+		}
+		if len(parts) == 0 {
+			parts = append(parts, words.daily)
+		}
+		parts = append(parts, fmt.Sprintf(words.clock, clock))
+	} else {
+		times := make([]string, 0)
+		if second != "0" {
+			times = append(times, words.unit(second, 0))
+		}
+		if !(minute == "*" && second != "0") {
+			times = append(times, words.unit(minute, 1))
+		}
+		if hour != "*" || (minute != "*" && !strings.HasPrefix(minute, "*/")) {
+			times = append(times, words.unit(hour, 2))
+		}
+		parts = append(parts, strings.Join(times, words.separator))
+	}
+
+	if zone != "" {
+		parts = append(parts, zone)
+	}
+
+	return strings.Join(parts, words.joiner)
+}
+
+// 统一转换为秒、分、时、日、月、周、年七个字段
+func normalize(spec string) []string {
+	spec = strings.TrimSpace(spec)
+	if expanded, exist := macros[strings.ToLower(spec)]; exist {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append(append([]string{"0"}, fields...), "*")
+	case 6:
+		fields = append([]string{"0"}, fields...)
+	case 7:
+	default:
+		return nil
+	}
+
+	return fields
+}
+
+// 描述秒、分、时字段
+func (words *phrases) unit(field string, index int) string {
+	if field == "*" {
+		return fmt.Sprintf(words.every, words.each[index])
+	}
+
+	if strings.HasPrefix(field, "*/") || strings.HasPrefix(field, "0/") {
+		if step, err := strconv.Atoi(field[2:]); err == nil {
+			return fmt.Sprintf(words.step, step, words.plural[index])
+		}
+	}
+
+	if bounds := strings.Split(field, "-"); len(bounds) == 2 && single(bounds[0]) && single(bounds[1]) {
+		return fmt.Sprintf(words.rng, words.units[index], bounds[0], bounds[1])
+	}
+
+	return fmt.Sprintf(words.at, words.units[index], strings.Replace(field, ",", words.separator, -1))
+}
+
+// 描述日和周字段
+func (words *phrases) day(dom, dow string) string {
+	wildDom := dom == "*" || dom == "?"
+	wildDow := dow == "*" || dow == "?"
+
+	switch {
+	case wildDom && wildDow:
+		return ""
+	case wildDom:
+		switch strings.ToUpper(dow) {
+		case "1-5", "MON-FRI":
+			return words.weekdays
+		case "0,6", "6,0", "6,7", "SAT,SUN", "SUN,SAT":
+			return words.weekends
+		}
+		return fmt.Sprintf(words.weekly, words.list(dow, weekAbbr, words.weekNames, 0))
+	case wildDow:
+		if strings.ToUpper(dom) == "L" {
+			return words.lastDay
+		}
+		return fmt.Sprintf(words.monthly, strings.Replace(dom, ",", words.separator, -1))
+	}
+
+	return fmt.Sprintf(words.monthly, dom) + words.separator + fmt.Sprintf(words.weekly, words.list(dow, weekAbbr, words.weekNames, 0))
+}
+
+// 将周或月字段中的数字和缩写转换为名称，无法识别的部分保持原样
+func (words *phrases) list(field string, abbr, names []string, offset int) string {
+	items := strings.Split(field, ",")
+	for index, item := range items {
+		bounds := strings.Split(item, "-")
+		for i, bound := range bounds {
+			bounds[i] = name(bound, abbr, names, offset)
+		}
+		if len(bounds) == 2 {
+			items[index] = fmt.Sprintf(words.rng, "", bounds[0], bounds[1])
+			items[index] = strings.TrimSpace(items[index])
+		} else {
+			items[index] = strings.Join(bounds, "-")
+		}
+	}
+
+	return strings.Join(items, words.separator)
+}
+
+func name(value string, abbr, names []string, offset int) string {
+	for index, item := range abbr {
+		if strings.ToUpper(value) == item {
+			return names[index]
+		}
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return value
+	}
+
+	// 周日可以写作 0 或 7
+	number = (number - offset) % len(names)
+	if number < 0 {
+		return value
+	}
+
+	return names[number]
+}
+
+func single(field string) bool {
+	if field == "" {
+		return false
+	}
+	_, err := strconv.Atoi(field)
+	return err == nil
+}
@@ -0,0 +1,59 @@
+package cron
+
+import (
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	cases := []struct {
+		spec   string
+		locale string
+		expect string
+	}{
+		{"30 2 * * 1-5", LOCALEEN, "every weekday at 02:30 Asia/Shanghai"},
+		{"30 2 * * 1-5", LOCALEZH, "每个工作日 02:30 Asia/Shanghai"},
+		{"*/5 * * * *", LOCALEEN, "every 5 minutes Asia/Shanghai"},
+		{"*/5 * * * *", LOCALEZH, "每5分钟 Asia/Shanghai"},
+		{"0 * * * *", LOCALEEN, "at minute 0, every hour Asia/Shanghai"},
+		{"0 8-18 * * MON-WED", LOCALEEN, "every Monday through Wednesday at minute 0, hour 8 through 18 Asia/Shanghai"},
+		{"0 8-18 * * MON-WED", LOCALEZH, "每周一至周三 0分、8至18时 Asia/Shanghai"},
+		{"30 * * * SAT,SUN", LOCALEEN, "every weekend at minute 30, every hour Asia/Shanghai"},
+		{"15 9 1,15 * *", LOCALEZH, "每月1、15日 09:15 Asia/Shanghai"},
+		{"0 12 L * ? *", LOCALEEN, "on the last day of the month at 12:00 Asia/Shanghai"},
+		{"0 0 9,21 * * 2019", LOCALEEN, "on day 9, 21 of the month in 2019 at 00:00 Asia/Shanghai"},
+		{"*/10 * * * * * *", LOCALEEN, "every 10 seconds Asia/Shanghai"},
+		{"*/10 * * * * * *", LOCALEZH, "每10秒 Asia/Shanghai"},
+		{"0 0 9 1 JAN-MAR ? *", LOCALEEN, "on day 1 of the month in January through March at 09:00 Asia/Shanghai"},
+		{"30 15 10 * * * *", LOCALEEN, "every day at 10:15:30 Asia/Shanghai"},
+		{"@daily", LOCALEEN, "every day at 00:00 Asia/Shanghai"},
+		{"@weekly", LOCALEZH, "每周日 00:00 Asia/Shanghai"},
+		{"@hourly", LOCALEEN, "at minute 0, every hour Asia/Shanghai"},
+		{"@monthly", LOCALEEN, "on day 1 of the month at 00:00 Asia/Shanghai"},
+	}
+
+	for _, c := range cases {
+		if result := Describe(c.spec, c.locale, "Asia/Shanghai"); result != c.expect {
+			t.Errorf("%s (%s)：期望 %q，实际 %q", c.spec, c.locale, c.expect, result)
+		}
+	}
+
+	if result := Describe("* * *", LOCALEEN, ""); result != "* * *" {
+		t.Errorf("无法识别的表达式应该原样返回，实际 %q", result)
+	}
+}
+
+func TestLocale(t *testing.T) {
+	cases := map[string]string{
+		"":                        LOCALEZH,
+		"en-US,en;q=0.9":          LOCALEEN,
+		"zh-CN,zh;q=0.9,en;q=0.8": LOCALEZH,
+		"fr-FR,en;q=0.5":          LOCALEEN,
+		"fr-FR":                   LOCALEZH,
+	}
+
+	for header, expect := range cases {
+		if result := Locale(header); result != expect {
+			t.Errorf("%q：期望 %s，实际 %s", header, expect, result)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package ctl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// 保存在用户目录中的主节点地址和 API 令牌，避免每次调用都传入
+type Credentials struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+}
+
+// 凭据文件的路径
+func CredentialsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".ects", "credentials.json"), nil
+}
+
+// 读取保存的凭据，尚未登录时返回空的凭据
+func LoadCredentials() (*Credentials, error) {
+	credentials := &Credentials{}
+
+	path, err := CredentialsPath()
+	if err != nil {
+		return credentials, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return credentials, nil
+	}
+	if err != nil {
+		return credentials, err
+	}
+
+	return credentials, json.Unmarshal(data, credentials)
+}
+
+// 保存凭据，文件只有当前用户可以读写
+func (credentials *Credentials) Save() error {
+	path, err := CredentialsPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(credentials, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,264 @@
+package ctl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/betterde/ects/models"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RECONNECTMIN = time.Second      // 断线后第一次重连前等待的时间，之后每次翻倍
+	RECONNECTMAX = 30 * time.Second // 重连前最多等待的时间
+)
+
+var ErrFinished = errors.New("流水线已执行结束")
+
+type (
+	// 通过主节点的接口管理系统，使用 API 令牌或者登录后获得的 JWT 认证
+	Client struct {
+		Server string
+		Token  string
+		http   *http.Client
+	}
+	// 接口的统一响应格式
+	envelope struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+		Meta    *meta           `json:"meta"`
+	}
+	// 列表接口的分页信息
+	meta struct {
+		Page       int `json:"page"`
+		TotalPages int `json:"total_pages"`
+	}
+	// 日志流中的事件
+	event struct {
+		Name string
+		Id   string
+		Data string
+	}
+)
+
+func New(server, token string) *Client {
+	return &Client{
+		Server: strings.TrimRight(server, "/"),
+		Token:  token,
+		http:   &http.Client{},
+	}
+}
+
+// 获取执行记录详情，包含每个步骤的执行记录
+func (client *Client) Run(ctx context.Context, id string) (*models.PipelineRecords, error) {
+	record := &models.PipelineRecords{}
+	if _, err := client.call(ctx, http.MethodGet, fmt.Sprintf("/api/run/%s", id), nil, record); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// 持续输出正在执行的流水线的日志，断线后从最后收到的偏移量重连，流水线结束时返回执行记录
+func (client *Client) Follow(ctx context.Context, id string, output io.Writer, notice func(format string, args ...interface{})) (*models.PipelineRecords, error) {
+	offset := int64(0)
+	wait := RECONNECTMIN
+
+	for {
+		received, err := client.stream(ctx, id, offset, output)
+		if received > offset {
+			offset = received
+			wait = RECONNECTMIN
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		// 日志流结束或断开时，根据执行记录判断是否需要重连
+		record, recordErr := client.Run(ctx, id)
+		if recordErr == nil && record.Status != models.RECORDRUNNING {
+			return record, nil
+		}
+
+		if err == nil {
+			err = recordErr
+		}
+		if err != nil {
+			notice("Log stream interrupted: %s, reconnecting in %s from offset %d\n", err, wait, offset)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+
+		if wait *= 2; wait > RECONNECTMAX {
+			wait = RECONNECTMAX
+		}
+	}
+}
+
+// 建立一次日志流连接，返回最后收到的偏移量，流水线已结束时返回 ErrFinished
+func (client *Client) stream(ctx context.Context, id string, offset int64, output io.Writer) (int64, error) {
+	req, err := client.request(ctx, http.MethodGet, fmt.Sprintf("/api/run/%s/logs?offset=%d", id, offset), nil)
+	if err != nil {
+		return offset, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := client.http.Do(req)
+	if err != nil {
+		return offset, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest {
+		return offset, ErrFinished
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return offset, fmt.Errorf("日志接口返回状态码 %d", resp.StatusCode)
+	}
+
+	err = events(resp.Body, func(evt *event) error {
+		switch evt.Name {
+		case "error":
+			return errors.New(evt.Data)
+		case "end":
+			return io.EOF
+		}
+
+		chunk := &struct {
+			Data []byte `json:"data"`
+		}{}
+		if err := json.Unmarshal([]byte(evt.Data), chunk); err != nil {
+			return err
+		}
+
+		if _, err := output.Write(chunk.Data); err != nil {
+			return err
+		}
+
+		if next, err := strconv.ParseInt(evt.Id, 10, 64); err == nil {
+			offset = next
+		}
+
+		return nil
+	})
+
+	if err == io.EOF {
+		return offset, nil
+	}
+
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return offset, err
+}
+
+// 调用接口并将响应中的 data 解析到 out，返回分页信息
+func (client *Client) call(ctx context.Context, method, path string, body interface{}, out interface{}) (*meta, error) {
+	req, err := client.request(ctx, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &envelope{}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, fmt.Errorf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%d %s", resp.StatusCode, result.Message)
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(result.Data, out); err != nil {
+			return nil, err
+		}
+	}
+
+	return result.Meta, nil
+}
+
+func (client *Client) request(ctx context.Context, method, path string, body interface{}) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, client.Server+path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if client.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+client.Token)
+	}
+
+	return req.WithContext(ctx), nil
+}
+
+// 解析 Server-Sent Events，handle 返回错误时停止
+func events(body io.Reader, handle func(evt *event) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	evt := &event{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if evt.Data != "" || evt.Name != "" {
+				if err := handle(evt); err != nil {
+					return err
+				}
+			}
+			evt = &event{}
+			continue
+		}
+
+		field, value := line, ""
+		if index := strings.IndexByte(line, ':'); index >= 0 {
+			field, value = line[:index], strings.TrimPrefix(line[index+1:], " ")
+		}
+
+		switch field {
+		case "event":
+			evt.Name = value
+		case "id":
+			evt.Id = value
+		case "data":
+			if evt.Data != "" {
+				evt.Data += "\n"
+			}
+			evt.Data += value
+		}
+	}
+
+	return scanner.Err()
+}
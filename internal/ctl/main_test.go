@@ -0,0 +1,30 @@
+package ctl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvents(t *testing.T) {
+	body := "id: 6\ndata: {\"data\":\"aGVsbG8K\"}\n\nevent: error\ndata: node\ndata: unreachable\n\n"
+
+	received := make([]*event, 0)
+	if err := events(strings.NewReader(body), func(evt *event) error {
+		received = append(received, evt)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(received))
+	}
+
+	if received[0].Id != "6" || received[0].Name != "" {
+		t.Errorf("unexpected first event %+v", received[0])
+	}
+
+	if received[1].Name != "error" || received[1].Data != "node\nunreachable" {
+		t.Errorf("expected multi-line data to be joined, got %+v", received[1])
+	}
+}
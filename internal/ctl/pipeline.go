@@ -0,0 +1,61 @@
+package ctl
+
+import (
+	"context"
+	"fmt"
+	"github.com/betterde/ects/internal/control"
+	"github.com/betterde/ects/models"
+	"net/http"
+)
+
+// 手动执行时附带的标签和参数
+type RunOptions struct {
+	Tags       models.Tags      `json:"tags,omitempty"`
+	Parameters models.Variables `json:"parameters,omitempty"`
+}
+
+// 获取当前用户可见的全部流水线
+func (client *Client) Pipelines(ctx context.Context) ([]models.Pipeline, error) {
+	pipelines := make([]models.Pipeline, 0)
+	if _, err := client.call(ctx, http.MethodGet, "/api/pipeline?scene=selector", nil, &pipelines); err != nil {
+		return nil, err
+	}
+
+	return pipelines, nil
+}
+
+// 创建流水线
+func (client *Client) CreatePipeline(ctx context.Context, pipeline *models.Pipeline) (*models.Pipeline, error) {
+	created := &models.Pipeline{}
+	if _, err := client.call(ctx, http.MethodPost, "/api/pipeline", pipeline, created); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// 删除流水线
+func (client *Client) DeletePipeline(ctx context.Context, id string) error {
+	_, err := client.call(ctx, http.MethodDelete, fmt.Sprintf("/api/pipeline/%s", id), nil, nil)
+	return err
+}
+
+// 立即在绑定的在线节点上执行一次流水线，返回每个节点的执行指令
+func (client *Client) RunPipeline(ctx context.Context, id string, options *RunOptions) ([]*models.Trigger, error) {
+	triggers := make([]*models.Trigger, 0)
+	if _, err := client.call(ctx, http.MethodPost, fmt.Sprintf("/api/pipeline/%s/run", id), options, &triggers); err != nil {
+		return nil, err
+	}
+
+	return triggers, nil
+}
+
+// 终止流水线在所有节点上正在执行和等待执行的指令，runId 不为空时只终止该次执行
+func (client *Client) KillPipeline(ctx context.Context, id, runId string) (*control.KillReply, error) {
+	reply := &control.KillReply{}
+	if _, err := client.call(ctx, http.MethodPost, "/api/pipeline/killer", map[string]string{"pipeline_id": id, "run_id": runId}, reply); err != nil {
+		return nil, err
+	}
+
+	return reply, nil
+}
@@ -0,0 +1,45 @@
+package ctl
+
+import (
+	"context"
+	"fmt"
+	"github.com/betterde/ects/models"
+	"net/http"
+	"net/url"
+)
+
+const TASKPAGESIZE = 100 // 分页获取任务列表时每页的数量
+
+// 获取名称或者ID包含 search 的全部任务
+func (client *Client) Tasks(ctx context.Context, search string) ([]models.Task, error) {
+	tasks := make([]models.Task, 0)
+	for page := 1; ; page++ {
+		query := url.Values{"page": {fmt.Sprint(page)}, "limit": {fmt.Sprint(TASKPAGESIZE)}, "search": {search}}
+		batch := make([]models.Task, 0, TASKPAGESIZE)
+		meta, err := client.call(ctx, http.MethodGet, "/api/task?"+query.Encode(), nil, &batch)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, batch...)
+
+		if meta == nil || page >= meta.TotalPages || len(batch) == 0 {
+			return tasks, nil
+		}
+	}
+}
+
+// 创建任务
+func (client *Client) CreateTask(ctx context.Context, task *models.Task) (*models.Task, error) {
+	created := &models.Task{}
+	if _, err := client.call(ctx, http.MethodPost, "/api/task", task, created); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// 删除任务
+func (client *Client) DeleteTask(ctx context.Context, id string) error {
+	_, err := client.call(ctx, http.MethodDelete, fmt.Sprintf("/api/task/%s", id), nil, nil)
+	return err
+}
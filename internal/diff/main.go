@@ -0,0 +1,133 @@
+package diff
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	EQUAL  = "="
+	INSERT = "+"
+	DELETE = "-"
+
+	MAXLINES = 1000 // 参与比较的最大行数，超出时只比较最后的部分
+)
+
+var errorPattern = regexp.MustCompile(`(?i)\b(error|exception|fatal|panic|traceback|fail(ed|ure)?)\b`)
+
+type (
+	// 比较结果中的一行
+	Line struct {
+		Op    string `json:"op"`
+		Text  string `json:"text"`
+		Error bool   `json:"error"` // 新增的行是否像是错误信息
+	}
+	// 两段输出的比较结果
+	Result struct {
+		Lines     []*Line  `json:"lines"`
+		Inserted  int      `json:"inserted"`
+		Deleted   int      `json:"deleted"`
+		Errors    []string `json:"errors"`    // 新增的错误行
+		Truncated bool     `json:"truncated"` // 输出超过 MAXLINES 行时只比较最后的部分
+	}
+)
+
+// 按行比较两段输出
+func Text(before, after string) *Result {
+	a, truncatedBefore := split(before)
+	b, truncatedAfter := split(after)
+
+	result := &Result{
+		Lines:     make([]*Line, 0, len(b)),
+		Errors:    make([]string, 0),
+		Truncated: truncatedBefore || truncatedAfter,
+	}
+
+	for _, line := range Lines(a, b) {
+		switch line.Op {
+		case INSERT:
+			result.Inserted++
+			if line.Error {
+				result.Errors = append(result.Errors, line.Text)
+			}
+		case DELETE:
+			result.Deleted++
+		}
+		result.Lines = append(result.Lines, line)
+	}
+
+	return result
+}
+
+// 使用最长公共子序列计算从 a 到 b 的逐行变更
+func Lines(a, b []string) []*Line {
+	// 相同的开头和结尾不参与计算
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]*Line, 0, len(a)+len(b))
+	for _, text := range a[:prefix] {
+		lines = append(lines, &Line{Op: EQUAL, Text: text})
+	}
+
+	x, y := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	lengths := make([][]int32, len(x)+1)
+	for i := range lengths {
+		lengths[i] = make([]int32, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			lines = append(lines, &Line{Op: EQUAL, Text: x[i]})
+			i++
+			j++
+		case j < len(y) && (i == len(x) || lengths[i][j+1] >= lengths[i+1][j]):
+			lines = append(lines, &Line{Op: INSERT, Text: y[j], Error: errorPattern.MatchString(y[j])})
+			j++
+		default:
+			lines = append(lines, &Line{Op: DELETE, Text: x[i]})
+			i++
+		}
+	}
+
+	for _, text := range a[len(a)-suffix:] {
+		lines = append(lines, &Line{Op: EQUAL, Text: text})
+	}
+
+	return lines
+}
+
+// 拆分为行，超过 MAXLINES 行时只保留最后的部分
+func split(text string) ([]string, bool) {
+	text = strings.TrimRight(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	if text == "" {
+		return []string{}, false
+	}
+
+	lines := strings.Split(text, "\n")
+	if len(lines) > MAXLINES {
+		return lines[len(lines)-MAXLINES:], true
+	}
+
+	return lines, false
+}
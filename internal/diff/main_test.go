@@ -0,0 +1,35 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestText(t *testing.T) {
+	before := "start\nconnect db\nprocessed 10 rows\ndone\n"
+	after := "start\nconnect db\nERROR: connection reset\nprocessed 3 rows\ndone\n"
+
+	result := Text(before, after)
+	if result.Inserted != 2 || result.Deleted != 1 {
+		t.Errorf("expected 2 inserted and 1 deleted lines, got %d and %d", result.Inserted, result.Deleted)
+	}
+
+	if len(result.Errors) != 1 || result.Errors[0] != "ERROR: connection reset" {
+		t.Errorf("expected the new error line to be highlighted, got %v", result.Errors)
+	}
+
+	ops := make([]string, 0, len(result.Lines))
+	for _, line := range result.Lines {
+		ops = append(ops, line.Op)
+	}
+	if strings.Join(ops, "") != "==+-+=" && strings.Join(ops, "") != "==++-=" {
+		t.Errorf("unexpected operations %v", ops)
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	long := strings.Repeat("line\n", MAXLINES+10)
+	if result := Text(long, long); !result.Truncated || result.Inserted != 0 || len(result.Lines) != MAXLINES {
+		t.Errorf("expected %d equal lines from a truncated output, got %d", MAXLINES, len(result.Lines))
+	}
+}
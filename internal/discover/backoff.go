@@ -0,0 +1,73 @@
+package discover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/betterde/ects/internal/metrics"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"log"
+	"time"
+)
+
+const (
+	WATCHBACKOFF    = time.Second // 监听中断后第一次重建前等待的时间，之后每次翻倍
+	WATCHMAXBACKOFF = time.Minute // 重建监听前最长等待的时间
+	WATCHHEALTHY    = time.Minute // 监听持续超过该时间后视为已经恢复，重新从最短的等待时间开始
+)
+
+var ErrWatchClosed = errors.New("监听已关闭")
+
+// 监听中断后重建的退避，ETCD 长时间不可用时避免频繁重试
+type Backoff struct {
+	next    time.Duration
+	started time.Time // 本次监听开始的时间
+}
+
+// 开始一次加载和监听
+func (backoff *Backoff) Start() {
+	backoff.started = time.Now()
+}
+
+// 等待后重建监听，ctx 结束时返回 false
+func (backoff *Backoff) Wait(ctx context.Context) bool {
+	wait := backoff.Delay(time.Now())
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(wait):
+		return true
+	}
+}
+
+// 计算重建前需要等待的时间，连续中断时翻倍
+func (backoff *Backoff) Delay(now time.Time) time.Duration {
+	if backoff.next == 0 || (!backoff.started.IsZero() && now.Sub(backoff.started) >= WATCHHEALTHY) {
+		backoff.next = WATCHBACKOFF
+	}
+
+	wait := backoff.next
+	if backoff.next *= 2; backoff.next > WATCHMAXBACKOFF {
+		backoff.next = WATCHMAXBACKOFF
+	}
+
+	return wait
+}
+
+// 检查监听的响应，版本被压缩或者监听被取消时返回错误，由调用方重新加载全部数据后从当前版本监听
+func Interrupted(watch string, resp *clientv3.WatchResponse) error {
+	err := resp.Err()
+	if err == nil {
+		return nil
+	}
+
+	if err == rpctypes.ErrCompacted {
+		log.Printf("Watch %s fell behind the compacted revision %d, reloading\n", watch, resp.CompactRevision)
+		metrics.WatchRestarts.WithLabelValues(watch, "compacted").Inc()
+	} else {
+		metrics.WatchRestarts.WithLabelValues(watch, "error").Inc()
+	}
+
+	return fmt.Errorf("监听 %s 中断：%s", watch, err)
+}
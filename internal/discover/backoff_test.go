@@ -0,0 +1,30 @@
+package discover
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	now := time.Date(2019, 2, 1, 3, 0, 0, 0, time.Local)
+	backoff := &Backoff{started: now}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+	for _, wait := range expected {
+		if delay := backoff.Delay(now); delay != wait {
+			t.Fatalf("expected to wait %v, got %v", wait, delay)
+		}
+	}
+
+	for attempt := 0; attempt < 10; attempt++ {
+		backoff.Delay(now)
+	}
+	if delay := backoff.Delay(now); delay != WATCHMAXBACKOFF {
+		t.Errorf("expected the delay to be capped at %v, got %v", WATCHMAXBACKOFF, delay)
+	}
+
+	// 监听持续足够长的时间后从最短的等待时间开始
+	if delay := backoff.Delay(now.Add(WATCHHEALTHY)); delay != WATCHBACKOFF {
+		t.Errorf("expected a healthy watch to reset the delay, got %v", delay)
+	}
+}
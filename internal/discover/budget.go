@@ -0,0 +1,75 @@
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"github.com/coreos/etcd/clientv3"
+)
+
+// 超出月度预算的项目，由主节点定期更新，工作节点执行非关键流水线前检查
+type Budget struct {
+	ProjectId string  `json:"project_id"`
+	Month     string  `json:"month"`
+	Used      float64 `json:"used"`  // 本月已使用的节点分钟
+	Limit     int     `json:"limit"` // 每月的节点分钟预算
+	Action    string  `json:"action"`
+}
+
+// 标记项目超出预算
+func PutBudget(budget *Budget) error {
+	bytes, err := json.Marshal(budget)
+	if err != nil {
+		return err
+	}
+
+	return Put(budgetKey(budget.ProjectId), string(bytes))
+}
+
+// 解除项目超出预算的标记
+func DeleteBudget(projectId string) error {
+	return Delete(budgetKey(projectId))
+}
+
+// 获取项目超出预算的状态，项目没有超出预算时返回 nil
+func Exhausted(projectId string) (*Budget, error) {
+	resp, err := Client.Get(context.TODO(), budgetKey(projectId))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+
+	budget := &Budget{}
+	if err := json.Unmarshal(resp.Kvs[0].Value, budget); err != nil {
+		return nil, err
+	}
+
+	return budget, nil
+}
+
+// 获取所有超出预算的项目
+func Budgets() (map[string]*Budget, error) {
+	resp, err := Client.Get(context.TODO(), budgetKey(""), clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	budgets := make(map[string]*Budget, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		budget := &Budget{}
+		if err := json.Unmarshal(kv.Value, budget); err != nil {
+			continue
+		}
+		budgets[budget.ProjectId] = budget
+	}
+
+	return budgets, nil
+}
+
+func budgetKey(projectId string) string {
+	return fmt.Sprintf("%s/budget/%s", config.Conf.Etcd.Running, projectId)
+}
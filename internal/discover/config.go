@@ -21,3 +21,13 @@ func GetConf(key string) {
 		}
 	}
 }
+
+// 发布代理模式的工作节点使用的配置，不包含数据库连接和密钥
+func PutAgentConf(key string) error {
+	bytes, err := json.Marshal(config.Conf.Redact())
+	if err != nil {
+		return err
+	}
+
+	return Put(config.AgentKey(key), string(bytes))
+}
@@ -0,0 +1,178 @@
+package discover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	LEADERTTL = 10  // 主节点选举会话的有效期，主节点崩溃后其他主节点最多等待该秒数接管
+	TXNMAXOPS = 128 // 单个事务最多包含的操作数，与 ETCD 默认的 --max-txn-ops 一致
+)
+
+var ErrNotLeader = errors.New("当前主节点不是领导者，不能修改流水线")
+
+type (
+	// 当前主节点的领导权，key 和 rev 用于在写入时确认领导权仍然有效
+	leadership struct {
+		mutex   sync.RWMutex
+		leading bool
+		key     string
+		rev     int64
+	}
+)
+
+var leader = &leadership{}
+
+// 参与主节点选举，address 为当前主节点的 API 地址，成为领导者后保持到会话失效，然后重新参与选举
+func Campaign(ctx context.Context, id, address string) {
+	for {
+		if err := campaign(ctx, id, address); err != nil {
+			log.Printf("Master %s campaign failed: %s\n", id, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func campaign(ctx context.Context, id, address string) error {
+	session, err := concurrency.NewSession(Client, concurrency.WithTTL(LEADERTTL))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	election := concurrency.NewElection(session, electionKey())
+	if err := election.Campaign(ctx, address); err != nil {
+		return err
+	}
+
+	leader.set(true, election.Key(), election.Rev())
+	log.Printf("Master %s elected as leader\n", id)
+	defer leader.set(false, "", 0)
+
+	select {
+	case <-session.Done():
+		log.Printf("Master %s lost leadership\n", id)
+	case <-ctx.Done():
+		resignCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := election.Resign(resignCtx); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return nil
+}
+
+// 当前主节点是否为领导者
+func Leading() bool {
+	leader.mutex.RLock()
+	defer leader.mutex.RUnlock()
+	return leader.leading
+}
+
+// 获取领导者的 API 地址，尚未选出领导者时返回空
+func Leader() (string, error) {
+	resp, err := Client.Get(context.TODO(), electionKey()+"/", clientv3.WithFirstCreate()...)
+	if err != nil {
+		return "", err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return "", nil
+	}
+
+	return string(resp.Kvs[0].Value), nil
+}
+
+// 以领导者身份写入流水线，领导权已经失效时返回 ErrNotLeader
+func PutPipeline(id, value string) error {
+	return fenced(clientv3.OpPut(pipelineKey(id), value))
+}
+
+// 以领导者身份删除流水线，领导权已经失效时返回 ErrNotLeader
+func DeletePipeline(id string) error {
+	return fenced(clientv3.OpDelete(pipelineKey(id)))
+}
+
+// 以领导者身份批量写入和删除流水线，操作按照 TXNMAXOPS 分成多个事务，失败时之前的事务已经生效
+func ApplyPipelines(puts map[string]string, deletes []string) error {
+	ops := make([]clientv3.Op, 0, len(puts)+len(deletes))
+	for id, value := range puts {
+		ops = append(ops, clientv3.OpPut(pipelineKey(id), value))
+	}
+	for _, id := range deletes {
+		ops = append(ops, clientv3.OpDelete(pipelineKey(id)))
+	}
+
+	for begin := 0; begin < len(ops); begin += TXNMAXOPS {
+		end := begin + TXNMAXOPS
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		if err := fenced(ops[begin:end]...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 仅在选举键仍然属于当前主节点时执行，避免失去领导权的主节点覆盖新领导者的写入
+func fenced(ops ...clientv3.Op) error {
+	leader.mutex.RLock()
+	leading, key, rev := leader.leading, leader.key, leader.rev
+	leader.mutex.RUnlock()
+
+	if !leading {
+		return ErrNotLeader
+	}
+
+	succeeded := false
+	err := retry(func(ctx context.Context) error {
+		resp, err := Client.Txn(ctx).If(clientv3.Compare(clientv3.CreateRevision(key), "=", rev)).Then(ops...).Commit()
+		if err != nil {
+			return err
+		}
+
+		succeeded = resp.Succeeded
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if !succeeded {
+		return ErrNotLeader
+	}
+
+	return nil
+}
+
+func (leadership *leadership) set(leading bool, key string, rev int64) {
+	leadership.mutex.Lock()
+	defer leadership.mutex.Unlock()
+	leadership.leading, leadership.key, leadership.rev = leading, key, rev
+}
+
+func electionKey() string {
+	return fmt.Sprintf("%s/leader", config.Conf.Locker)
+}
+
+func pipelineKey(id string) string {
+	return fmt.Sprintf("%s/%s", config.Conf.Etcd.Pipeline, id)
+}
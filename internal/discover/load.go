@@ -0,0 +1,158 @@
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/models"
+	"github.com/coreos/etcd/clientv3"
+	"log"
+	"time"
+)
+
+const (
+	HEARTBEAT = 5 * time.Second // 节点上报负载的间隔
+	LOADTTL   = 15              // 负载信息的有效期，节点停止上报后自动删除
+	ELECTTTL  = 300             // 执行节点选举结果的保留时间
+)
+
+type (
+	// 节点心跳上报的负载
+	Load struct {
+		NodeId   string    `json:"node_id"`
+		Load     float64   `json:"load"`     // 最近一分钟的系统平均负载
+		CPU      int       `json:"cpu"`      // CPU 核数
+		Running  int       `json:"running"`  // 正在执行的流水线数量
+		Capacity int       `json:"capacity"` // 同时执行的流水线上限，0 表示不限制
+		Drained  bool      `json:"drained"`  // 是否处于维护状态
+		Closed   bool      `json:"closed"`   // 是否处于执行时间段外
+		Volumes  []string  `json:"volumes"`  // 节点提供的数据卷标签或目录
+		Time     time.Time `json:"time"`
+	}
+)
+
+// 上报节点的负载
+func Report(load *Load) error {
+	value, err := json.Marshal(load)
+	if err != nil {
+		return err
+	}
+
+	res, err := Client.Grant(context.TODO(), LOADTTL)
+	if err != nil {
+		return err
+	}
+
+	_, err = Client.Put(context.TODO(), fmt.Sprintf("%s/load/%s", config.Conf.Etcd.Running, load.NodeId), string(value), clientv3.WithLease(res.ID))
+	return err
+}
+
+// 获取所有节点最近上报的负载
+func Loads() (map[string]*Load, error) {
+	resp, err := Client.Get(context.TODO(), fmt.Sprintf("%s/load/", config.Conf.Etcd.Running), clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	loads := make(map[string]*Load)
+	for _, kv := range resp.Kvs {
+		load := &Load{}
+		if err := json.Unmarshal(kv.Value, load); err != nil {
+			log.Println(err)
+			continue
+		}
+		loads[load.NodeId] = load
+	}
+
+	return loads, nil
+}
+
+// 负载评分，按 CPU 核数折算系统负载，并加上并发名额的占用比例
+func (load *Load) Score() float64 {
+	score := load.Load
+	if load.CPU > 0 {
+		score = load.Load / float64(load.CPU)
+	}
+
+	if load.Capacity > 0 {
+		score += float64(load.Running) / float64(load.Capacity)
+	}
+
+	return score
+}
+
+// 是否可以执行新的流水线
+func (load *Load) Available() bool {
+	return !load.Drained && !load.Closed && (load.Capacity == 0 || load.Running < load.Capacity)
+}
+
+// 在候选节点中选择负载最低的节点，负载相同时选择正在执行的流水线较少、ID 较小的节点，没有可用节点时返回空
+func LeastLoaded(candidates []string, loads map[string]*Load) string {
+	var best *Load
+	for _, id := range candidates {
+		load, exist := loads[id]
+		if !exist || !load.Available() {
+			continue
+		}
+
+		if best == nil || load.Score() < best.Score() ||
+			(load.Score() == best.Score() && (load.Running < best.Running || (load.Running == best.Running && load.NodeId < best.NodeId))) {
+			best = load
+		}
+	}
+
+	if best == nil {
+		return ""
+	}
+
+	return best.NodeId
+}
+
+// 在候选节点中选择提供数据位置最多的可用节点，没有节点提供任何数据位置时返回全部候选节点
+func Nearest(candidates, hints []string, loads map[string]*Load) []string {
+	if len(hints) == 0 {
+		return candidates
+	}
+
+	best, nearest := 0, make([]string, 0)
+	for _, id := range candidates {
+		load, exist := loads[id]
+		if !exist || !load.Available() {
+			continue
+		}
+
+		score := models.LocalityScore(load.Volumes, hints)
+		switch {
+		case score > best:
+			best, nearest = score, []string{id}
+		case score == best && score > 0:
+			nearest = append(nearest, id)
+		}
+	}
+
+	if best == 0 {
+		return candidates
+	}
+
+	return nearest
+}
+
+// 竞选流水线在计划时间的执行节点，每个计划时间只有一个节点成功
+func Elect(pipelineId string, planWith time.Time, node string) (bool, error) {
+	res, err := Client.Grant(context.TODO(), ELECTTTL)
+	if err != nil {
+		return false, err
+	}
+
+	key := fmt.Sprintf("%s/elect/%s/%d", config.Conf.Etcd.Locker, pipelineId, planWith.Unix())
+	txnResp, err := Client.Txn(context.TODO()).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, node, clientv3.WithLease(res.ID))).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+
+	return txnResp.Succeeded, nil
+}
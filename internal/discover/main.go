@@ -8,6 +8,7 @@ import (
 	"github.com/betterde/ects/config"
 	"github.com/betterde/ects/internal/service"
 	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/pkg/transport"
 	"log"
 	"sync"
 	"time"
@@ -29,14 +30,47 @@ var (
 
 // New ETCD V3 Client
 func NewClient() {
-	if Client, err = clientv3.New(clientv3.Config{
-		Endpoints:   config.Conf.Etcd.EndPoints,
-		DialTimeout: 10 * time.Second,
-	}); err != nil {
+	conf, invalid := ClientConfig(&config.Conf.Etcd)
+	if invalid != nil {
+		log.Fatal(invalid)
+	}
+
+	if Client, err = clientv3.New(conf); err != nil {
 		log.Println(err)
 	}
 }
 
+// 连接 ETCD 的配置，指定了证书时使用 TLS，指定了用户名时使用账号认证
+func ClientConfig(etcd *config.Etcd) (clientv3.Config, error) {
+	security := etcd.Security
+	conf := clientv3.Config{
+		Endpoints:   etcd.EndPoints,
+		DialTimeout: 10 * time.Second,
+		Username:    security.Username,
+		Password:    security.Password,
+	}
+
+	if security.CACert != "" || security.Cert != "" || security.Key != "" {
+		if (security.Cert == "") != (security.Key == "") {
+			return conf, errors.New("ETCD 的客户端证书和私钥需要同时指定")
+		}
+
+		info := transport.TLSInfo{
+			CertFile:      security.Cert,
+			KeyFile:       security.Key,
+			TrustedCAFile: security.CACert,
+		}
+
+		tls, err := info.ClientConfig()
+		if err != nil {
+			return conf, fmt.Errorf("加载 ETCD 的证书失败：%s", err)
+		}
+		conf.TLS = tls
+	}
+
+	return conf, nil
+}
+
 func NewService(instance *service.Instance) (*Service, error) {
 	if nil != err {
 		return nil, err
@@ -92,6 +126,16 @@ func (service *Service) Register(ttlSecond int64) error {
 	}
 }
 
+// 节点是否仍在注册中心，节点崩溃或停止后租约失效，注册信息随之删除
+func Registered(id string) (bool, error) {
+	resp, err := Client.Get(context.TODO(), fmt.Sprintf("%s/%s", config.Conf.Etcd.Service, id), clientv3.WithCountOnly())
+	if err != nil {
+		return false, err
+	}
+
+	return resp.Count > 0, nil
+}
+
 // Stop service
 func (service *Service) Stop() {
 	close(service.close)
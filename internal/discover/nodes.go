@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/metrics"
 	"github.com/betterde/ects/models"
 	"github.com/coreos/etcd/clientv3"
 	"github.com/coreos/etcd/mvcc/mvccpb"
@@ -12,23 +13,39 @@ import (
 	"time"
 )
 
+// 监听节点的注册和离线并更新数据库中的节点状态，监听中断后从当前版本重新监听，期间遗漏的变更由对账修复
 func (cluster *Cluster) WatchNodes(id string, ctx context.Context) {
-	var curRevision int64 = 0
-
+	backoff := &Backoff{}
 	for {
-		rangeResp, err := Client.Get(context.TODO(), config.Conf.Etcd.Service, clientv3.WithPrefix())
+		backoff.Start()
+		if err := watchNodes(ctx, id); err != nil && ctx.Err() == nil {
+			log.Println(err)
+		}
 
-		if err != nil {
-			continue
+		if !backoff.Wait(ctx) {
+			return
 		}
-		// 从当前版本开始订阅
-		curRevision = rangeResp.Header.Revision + 1
-		break
 	}
+}
 
-	watchChan := Client.Watch(ctx, config.Conf.Etcd.Service, clientv3.WithPrefix(), clientv3.WithRev(curRevision), clientv3.WithPrevKV())
+func watchNodes(ctx context.Context, id string) error {
+	rangeResp, err := Client.Get(ctx, config.Conf.Etcd.Service, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		return err
+	}
+
+	watchCtx, guard := Guarded(ctx, "nodes")
+	defer guard.Stop()
+
+	// 从当前版本开始订阅
+	watchChan := Client.Watch(watchCtx, config.Conf.Etcd.Service, clientv3.WithPrefix(), clientv3.WithRev(rangeResp.Header.Revision+1), clientv3.WithPrevKV(), clientv3.WithProgressNotify())
 
 	for watchResp := range watchChan {
+		guard.Touch()
+		if err := Interrupted("nodes", &watchResp); err != nil {
+			return err
+		}
+		metrics.Watched("nodes", &watchResp)
 		for _, event := range watchResp.Events {
 			var node models.Node
 			leaseCtx, cancelFunc := context.WithTimeout(ctx, 5*time.Second)
@@ -53,9 +70,15 @@ func (cluster *Cluster) WatchNodes(id string, ctx context.Context) {
 
 				result := seize(leaseCtx, node.Id, id)
 				if result {
-					node.Status = models.OFFLINE
-					if err := node.Update(); err != nil {
+					// 维护中的节点重启后也不能参与调度，保持维护状态
+					origin := &models.Node{}
+					if _, err := models.Engine.Id(node.Id).Cols("status").Get(origin); err != nil {
 						log.Println(err)
+					} else if !origin.Drained() {
+						node.Status = models.OFFLINE
+						if err := node.Update(); err != nil {
+							log.Println(err)
+						}
 					}
 					log.Printf("节点：%s 离线", node.Id)
 				}
@@ -64,6 +87,8 @@ func (cluster *Cluster) WatchNodes(id string, ctx context.Context) {
 			cancelFunc()
 		}
 	}
+
+	return ErrWatchClosed
 }
 
 // 抢用于更新节点信息的锁
@@ -0,0 +1,100 @@
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"github.com/coreos/etcd/clientv3"
+	"math"
+	"time"
+)
+
+const RESERVEATTEMPTS = 10 // 多个节点同时预留令牌发生冲突时的最大尝试次数
+
+var ErrReserveContended = errors.New("预留限流令牌时冲突过多")
+
+type (
+	// 限流分组的令牌桶，保存在 ETCD 中由所有工作节点共享
+	bucket struct {
+		Tokens  float64   `json:"tokens"`
+		Updated time.Time `json:"updated"`
+	}
+)
+
+// 从限流分组中预留一个令牌，返回执行前需要等待的时间
+func Reserve(name string, rate, capacity float64) (time.Duration, error) {
+	key := fmt.Sprintf("%s/limits/%s", config.Conf.Etcd.Running, name)
+
+	for attempt := 0; attempt < RESERVEATTEMPTS; attempt++ {
+		wait, reserved, err := reserve(key, rate, capacity)
+		if err != nil {
+			return 0, err
+		}
+
+		if reserved {
+			return wait, nil
+		}
+	}
+
+	return 0, ErrReserveContended
+}
+
+// 读取令牌桶并在版本未变化时写回，其他节点先写入时返回 false
+func reserve(key string, rate, capacity float64) (time.Duration, bool, error) {
+	timeout := time.Duration(config.Conf.Etcd.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	resp, err := Client.Get(ctx, key)
+	if err != nil {
+		return 0, false, err
+	}
+
+	state := bucket{}
+	cmp := clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+	if len(resp.Kvs) > 0 {
+		if err := json.Unmarshal(resp.Kvs[0].Value, &state); err != nil {
+			return 0, false, err
+		}
+		cmp = clientv3.Compare(clientv3.ModRevision(key), "=", resp.Kvs[0].ModRevision)
+	}
+
+	next, wait := state.take(rate, capacity, time.Now())
+	bytes, err := json.Marshal(next)
+	if err != nil {
+		return 0, false, err
+	}
+
+	txnResp, err := Client.Txn(ctx).If(cmp).Then(clientv3.OpPut(key, string(bytes))).Commit()
+	if err != nil {
+		return 0, false, err
+	}
+
+	return wait, txnResp.Succeeded, nil
+}
+
+// 按照经过的时间补充令牌后取走一个，令牌不足时同样取走，之后的执行排在后面等待
+func (state bucket) take(rate, capacity float64, now time.Time) (bucket, time.Duration) {
+	tokens := capacity
+	if !state.Updated.IsZero() {
+		// 节点之间的时钟偏差不能让令牌桶的时间倒退
+		if now.Before(state.Updated) {
+			now = state.Updated
+		}
+		tokens = math.Min(capacity, state.Tokens+now.Sub(state.Updated).Seconds()*rate)
+	}
+
+	tokens--
+	next := bucket{Tokens: tokens, Updated: now}
+	if tokens >= 0 {
+		return next, 0
+	}
+
+	return next, time.Duration(-tokens / rate * float64(time.Second))
+}
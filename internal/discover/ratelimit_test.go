@@ -0,0 +1,30 @@
+package discover
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTake(t *testing.T) {
+	now := time.Date(2019, 2, 1, 3, 0, 0, 0, time.Local)
+
+	state, wait := bucket{}.take(2, 2, now)
+	if wait != 0 || state.Tokens != 1 {
+		t.Fatalf("expected a full bucket to grant immediately, got %v with %v tokens left", wait, state.Tokens)
+	}
+
+	state, _ = state.take(2, 2, now)
+	state, wait = state.take(2, 2, now)
+	if wait != 500*time.Millisecond {
+		t.Errorf("expected to wait 500ms for the third token, got %v", wait)
+	}
+
+	// 时钟落后的节点不能回退令牌桶的时间
+	if next, wait := state.take(2, 2, now.Add(-time.Minute)); !next.Updated.Equal(now) || wait != time.Second {
+		t.Errorf("expected a skewed clock to queue behind, got %v at %v", wait, next.Updated)
+	}
+
+	if next, _ := state.take(2, 2, now.Add(time.Hour)); next.Tokens != 1 {
+		t.Errorf("expected the refill to be capped at the capacity, got %v tokens", next.Tokens)
+	}
+}
@@ -0,0 +1,52 @@
+package discover
+
+import (
+	"context"
+	"github.com/betterde/ects/config"
+	"github.com/coreos/etcd/clientv3"
+	"time"
+)
+
+const (
+	RETRYATTEMPTS = 3                      // 写入 ETCD 的最大尝试次数
+	RETRYBACKOFF  = 200 * time.Millisecond // 第一次重试前等待的时间，之后每次翻倍
+)
+
+// 写入 ETCD，失败时重试
+func Put(key, value string, opts ...clientv3.OpOption) error {
+	return retry(func(ctx context.Context) error {
+		_, err := Client.Put(ctx, key, value, opts...)
+		return err
+	})
+}
+
+// 删除 ETCD 中的键，失败时重试
+func Delete(key string, opts ...clientv3.OpOption) error {
+	return retry(func(ctx context.Context) error {
+		_, err := Client.Delete(ctx, key, opts...)
+		return err
+	})
+}
+
+// 按照退避时间重试，每次请求的超时时间使用配置中的 ETCD 超时时间
+func retry(operation func(ctx context.Context) error) (err error) {
+	timeout := time.Duration(config.Conf.Etcd.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	for attempt := 0; attempt < RETRYATTEMPTS; attempt++ {
+		if attempt > 0 {
+			time.Sleep(RETRYBACKOFF << uint(attempt-1))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err = operation(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,137 @@
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"github.com/coreos/etcd/clientv3"
+	"log"
+	"time"
+)
+
+type (
+	// 正在执行的流水线
+	Run struct {
+		Id         string    `json:"id"`
+		PipelineId string    `json:"pipeline_id"`
+		ProjectId  string    `json:"project_id,omitempty"`
+		NodeId     string    `json:"node_id"`
+		BeginWith  time.Time `json:"begin_with"`
+		// 外部系统传入的关联ID
+		CorrelationId string `json:"correlation_id,omitempty"`
+		// 所属的执行组
+		GroupId string `json:"group_id,omitempty"`
+	}
+	// 执行登记，执行期间持续续租，结束或节点崩溃后租约失效，登记和占用的并发名额随之释放
+	Registration struct {
+		Run     *Run
+		leaseID clientv3.LeaseID
+		cancel  context.CancelFunc
+	}
+)
+
+// 登记正在执行的流水线，limit 大于 0 时需要先占用项目的并发名额，名额已满时返回 nil
+func Acquire(run *Run, limit int) (*Registration, error) {
+	res, err := Client.Grant(context.TODO(), 10)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	registration := &Registration{
+		Run:     run,
+		leaseID: res.ID,
+		cancel:  cancel,
+	}
+
+	if run.ProjectId != "" && limit > 0 {
+		acquired := false
+		for slot := 0; slot < limit; slot++ {
+			key := fmt.Sprintf("%s/slots/%s/%d", config.Conf.Etcd.Running, run.ProjectId, slot)
+			txnResp, err := Client.Txn(context.TODO()).
+				If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+				Then(clientv3.OpPut(key, run.Id, clientv3.WithLease(res.ID))).
+				Commit()
+			if err != nil {
+				registration.Release()
+				return nil, err
+			}
+
+			if txnResp.Succeeded {
+				acquired = true
+				break
+			}
+		}
+
+		if !acquired {
+			registration.Release()
+			return nil, nil
+		}
+	}
+
+	bytes, err := json.Marshal(run)
+	if err != nil {
+		registration.Release()
+		return nil, err
+	}
+
+	key := fmt.Sprintf("%s/runs/%s", config.Conf.Etcd.Running, run.Id)
+	if _, err := Client.Put(context.TODO(), key, string(bytes), clientv3.WithLease(res.ID)); err != nil {
+		registration.Release()
+		return nil, err
+	}
+
+	keepAlive, err := Client.KeepAlive(ctx, res.ID)
+	if err != nil {
+		registration.Release()
+		return nil, err
+	}
+
+	go func() {
+		for range keepAlive {
+		}
+	}()
+
+	return registration, nil
+}
+
+// 执行结束后释放登记和并发名额
+func (registration *Registration) Release() {
+	registration.cancel()
+	if _, err := Client.Revoke(context.TODO(), registration.leaseID); err != nil {
+		log.Println(err)
+	}
+}
+
+// 获取正在执行的流水线，projectId 为空时返回全部
+func Running(projectId string) ([]*Run, error) {
+	resp, err := Client.Get(context.TODO(), fmt.Sprintf("%s/runs/", config.Conf.Etcd.Running), clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]*Run, 0)
+	for _, kv := range resp.Kvs {
+		run := &Run{}
+		if err := json.Unmarshal(kv.Value, run); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		if projectId == "" || run.ProjectId == projectId {
+			runs = append(runs, run)
+		}
+	}
+
+	return runs, nil
+}
+
+// 日志中使用的执行描述，包含外部系统的关联ID
+func (run *Run) Reference() string {
+	if run.CorrelationId == "" {
+		return run.Id
+	}
+
+	return fmt.Sprintf("%s [correlation %s]", run.Id, run.CorrelationId)
+}
@@ -0,0 +1,211 @@
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"github.com/coreos/etcd/clientv3"
+	"strings"
+	"time"
+)
+
+const (
+	SNAPSHOTVERSION = 1 // 快照格式的版本，恢复时只接受相同版本的快照
+
+	SNAPSHOTPIPELINE = "pipeline" // 流水线
+	SNAPSHOTNODE     = "node"     // 节点注册信息，由节点续租维持，恢复时跳过
+	SNAPSHOTCONFIG   = "config"   // 系统配置
+)
+
+type (
+	// 快照中的一个键，Key 为相对于所属前缀的路径，不同集群配置了不同的前缀时也可以恢复
+	SnapshotEntry struct {
+		Key            string `json:"key"`
+		Value          string `json:"value"`
+		CreateRevision int64  `json:"create_revision"`
+		ModRevision    int64  `json:"mod_revision"`
+		Leased         bool   `json:"leased"` // 绑定了租约的键会随租约失效，恢复到其他集群没有意义
+	}
+	// ETCD 状态快照，所有前缀在同一个修订版本读取
+	Snapshot struct {
+		Version   int                        `json:"version"`
+		ClusterId uint64                     `json:"cluster_id"`
+		MemberId  uint64                     `json:"member_id"`
+		Revision  int64                      `json:"revision"`
+		RaftTerm  uint64                     `json:"raft_term"`
+		TakenAt   time.Time                  `json:"taken_at"`
+		Prefixes  map[string]string          `json:"prefixes"` // 导出时各类数据的前缀
+		Entries   map[string][]SnapshotEntry `json:"entries"`
+	}
+	// 恢复快照的结果
+	Restoration struct {
+		Revision  int64    `json:"revision"` // 恢复的快照的修订版本
+		Pipelines int      `json:"pipelines"`
+		Pruned    []string `json:"pruned"` // 快照中不存在而被删除的流水线
+		Config    bool     `json:"config"`
+		Skipped   int      `json:"skipped"` // 跳过的节点注册信息
+	}
+)
+
+// 导出流水线、节点和系统配置在同一修订版本下的状态
+func TakeSnapshot() (*Snapshot, error) {
+	prefixes := map[string]string{
+		SNAPSHOTPIPELINE: config.Conf.Etcd.Pipeline,
+		SNAPSHOTNODE:     config.Conf.Etcd.Service,
+		SNAPSHOTCONFIG:   config.Conf.Etcd.Config,
+	}
+
+	snapshot := &Snapshot{
+		Version:  SNAPSHOTVERSION,
+		TakenAt:  time.Now(),
+		Prefixes: prefixes,
+		Entries:  make(map[string][]SnapshotEntry, len(prefixes)),
+	}
+
+	// 第一次读取确定修订版本，之后的读取固定在该版本上
+	for _, kind := range []string{SNAPSHOTPIPELINE, SNAPSHOTNODE, SNAPSHOTCONFIG} {
+		prefix := prefixes[kind]
+		opts := make([]clientv3.OpOption, 0, 2)
+		if kind != SNAPSHOTCONFIG {
+			opts = append(opts, clientv3.WithPrefix())
+		}
+		if snapshot.Revision > 0 {
+			opts = append(opts, clientv3.WithRev(snapshot.Revision))
+		}
+
+		resp, err := Client.Get(context.TODO(), snapshotPrefix(kind, prefix), opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		if snapshot.Revision == 0 {
+			snapshot.Revision = resp.Header.Revision
+			snapshot.ClusterId = resp.Header.ClusterId
+			snapshot.MemberId = resp.Header.MemberId
+			snapshot.RaftTerm = resp.Header.RaftTerm
+		}
+
+		entries := make([]SnapshotEntry, 0, len(resp.Kvs))
+		for _, kv := range resp.Kvs {
+			entries = append(entries, SnapshotEntry{
+				Key:            strings.TrimPrefix(string(kv.Key), snapshotPrefix(kind, prefix)),
+				Value:          string(kv.Value),
+				CreateRevision: kv.CreateRevision,
+				ModRevision:    kv.ModRevision,
+				Leased:         kv.Lease != 0,
+			})
+		}
+		snapshot.Entries[kind] = entries
+	}
+
+	return snapshot, nil
+}
+
+// 以领导者身份将快照恢复到当前集群，prune 为 true 时删除快照中不存在的流水线，节点注册信息由节点重新注册，不会恢复；
+// 快照无效时返回的结果为空
+func RestoreSnapshot(snapshot *Snapshot, prune bool) (*Restoration, error) {
+	if snapshot.Version != SNAPSHOTVERSION {
+		return nil, fmt.Errorf("不支持版本为 %d 的快照", snapshot.Version)
+	}
+
+	restoration := &Restoration{Revision: snapshot.Revision, Pruned: make([]string, 0)}
+	restoration.Skipped = len(snapshot.Entries[SNAPSHOTNODE])
+
+	puts := make(map[string]string, len(snapshot.Entries[SNAPSHOTPIPELINE]))
+	for _, entry := range snapshot.Entries[SNAPSHOTPIPELINE] {
+		if entry.Key == "" || strings.Contains(entry.Key, "/") {
+			return nil, fmt.Errorf("快照中的流水线键 %s 无效", entry.Key)
+		}
+
+		if !json.Valid([]byte(entry.Value)) {
+			return nil, fmt.Errorf("快照中的流水线 %s 不是有效的 JSON", entry.Key)
+		}
+		puts[entry.Key] = entry.Value
+	}
+
+	configs := snapshot.Entries[SNAPSHOTCONFIG]
+	if len(configs) > 1 {
+		return nil, errors.New("快照中的系统配置无效")
+	}
+
+	var restored *config.Config
+	if len(configs) == 1 {
+		restored = &config.Config{}
+		if err := json.Unmarshal([]byte(configs[0].Value), restored); err != nil {
+			return nil, fmt.Errorf("快照中的系统配置无效：%s", err)
+		}
+
+		// 保留当前集群的 ETCD 配置，避免节点重启后连接到导出快照的集群
+		restored.Etcd = config.Conf.Etcd
+	}
+
+	deletes := make([]string, 0)
+	if prune {
+		resp, err := Client.Get(context.TODO(), snapshotPrefix(SNAPSHOTPIPELINE, config.Conf.Etcd.Pipeline), clientv3.WithPrefix(), clientv3.WithKeysOnly())
+		if err != nil {
+			return restoration, err
+		}
+
+		for _, kv := range resp.Kvs {
+			id := strings.TrimPrefix(string(kv.Key), snapshotPrefix(SNAPSHOTPIPELINE, config.Conf.Etcd.Pipeline))
+			if _, exist := puts[id]; !exist {
+				deletes = append(deletes, id)
+			}
+		}
+	}
+
+	if err := ApplyPipelines(puts, deletes); err != nil {
+		return restoration, err
+	}
+	restoration.Pipelines = len(puts)
+	restoration.Pruned = deletes
+
+	if restored != nil {
+		bytes, err := json.Marshal(restored)
+		if err != nil {
+			return restoration, err
+		}
+
+		if err := Put(config.Conf.Etcd.Config, string(bytes)); err != nil {
+			return restoration, err
+		}
+
+		// 代理模式的节点读取去掉了敏感信息的配置
+		if bytes, err = json.Marshal(restored.Redact()); err != nil {
+			return restoration, err
+		}
+
+		if err := Put(config.AgentKey(config.Conf.Etcd.Config), string(bytes)); err != nil {
+			return restoration, err
+		}
+		restoration.Config = true
+	}
+
+	return restoration, nil
+}
+
+// 读取时使用的前缀，目录类的前缀以 / 结尾，避免匹配到名称相同开头的其他前缀
+func snapshotPrefix(kind, prefix string) string {
+	if kind == SNAPSHOTCONFIG {
+		return prefix
+	}
+
+	return strings.TrimRight(prefix, "/") + "/"
+}
+
+// 恢复结果只用于记录操作日志，不保存到数据库
+func (restoration *Restoration) Store() error {
+	return nil
+}
+
+func (restoration *Restoration) Update() error {
+	return nil
+}
+
+// 序列化
+func (restoration *Restoration) ToString() (string, error) {
+	result, err := json.Marshal(restoration)
+	return string(result), err
+}
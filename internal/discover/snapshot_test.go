@@ -0,0 +1,27 @@
+package discover
+
+import (
+	"testing"
+)
+
+func TestRestoreSnapshotRejectsInvalid(t *testing.T) {
+	snapshots := map[string]*Snapshot{
+		"version": {Version: SNAPSHOTVERSION + 1},
+		"key": {Version: SNAPSHOTVERSION, Entries: map[string][]SnapshotEntry{
+			SNAPSHOTPIPELINE: {{Key: "a/b", Value: "{}"}},
+		}},
+		"value": {Version: SNAPSHOTVERSION, Entries: map[string][]SnapshotEntry{
+			SNAPSHOTPIPELINE: {{Key: "a", Value: "{"}},
+		}},
+		"config": {Version: SNAPSHOTVERSION, Entries: map[string][]SnapshotEntry{
+			SNAPSHOTCONFIG: {{Value: "[]"}},
+		}},
+	}
+
+	// 无效的快照在访问 ETCD 之前被拒绝，不会写入任何数据
+	for name, snapshot := range snapshots {
+		if restoration, err := RestoreSnapshot(snapshot, false); err == nil || restoration != nil {
+			t.Errorf("expected invalid %s to be rejected, got %v, %v", name, restoration, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package discover
+
+import (
+	"context"
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/metrics"
+	"github.com/coreos/etcd/clientv3"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+const WATCHSTALL = 900 * time.Second // 未配置时判定监听停滞的时间，需要大于 ETCD 发送进度通知的间隔
+
+// 监听停滞检测，ETCD 可用但长时间没有收到事件和进度通知时取消监听，由调用方重建
+type Guard struct {
+	name    string
+	timeout time.Duration
+	seen    int64 // 最后一次收到响应的 Unix 纳秒时间
+	cancel  context.CancelFunc
+}
+
+// 创建监听使用的 ctx 和停滞检测，监听需要使用 clientv3.WithProgressNotify 接收进度通知
+func Guarded(ctx context.Context, name string) (context.Context, *Guard) {
+	timeout := time.Duration(config.Conf.Etcd.WatchStall) * time.Second
+	if timeout <= 0 {
+		timeout = WATCHSTALL
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	guard := &Guard{
+		name:    name,
+		timeout: timeout,
+		seen:    time.Now().UnixNano(),
+		cancel:  cancel,
+	}
+
+	go guard.run(ctx)
+	return ctx, guard
+}
+
+// 收到事件或进度通知
+func (guard *Guard) Touch() {
+	atomic.StoreInt64(&guard.seen, time.Now().UnixNano())
+}
+
+// 监听结束时停止检测
+func (guard *Guard) Stop() {
+	guard.cancel()
+}
+
+func (guard *Guard) run(ctx context.Context) {
+	ticker := time.NewTicker(guard.timeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			idle := now.Sub(time.Unix(0, atomic.LoadInt64(&guard.seen)))
+			if idle < guard.timeout {
+				continue
+			}
+
+			// ETCD 不可用时由客户端自动恢复监听，此时不重建
+			if err := healthy(ctx); err != nil {
+				log.Printf("Watch %s idle for %s, etcd is unavailable: %s\n", guard.name, idle.Truncate(time.Second), err)
+				continue
+			}
+
+			log.Printf("Warning: watch %s stalled for %s while etcd is healthy, rebuilding\n", guard.name, idle.Truncate(time.Second))
+			metrics.WatchStalls.WithLabelValues(guard.name).Inc()
+			guard.cancel()
+			return
+		}
+	}
+}
+
+// 检查 ETCD 是否可以正常读取
+func healthy(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := Client.Get(ctx, config.Conf.Etcd.Service, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	return err
+}
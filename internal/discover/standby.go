@@ -0,0 +1,63 @@
+package discover
+
+import (
+	"context"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"github.com/coreos/etcd/clientv3"
+	"time"
+)
+
+// 记录流水线在计划时间已经由主节点处理，供备用节点判断是否需要接管
+func Fire(pipelineId string, planWith time.Time, node string) error {
+	res, err := Client.Grant(context.TODO(), 300)
+	if err != nil {
+		return err
+	}
+
+	_, err = Client.Put(context.TODO(), fireKey(pipelineId, planWith), node, clientv3.WithLease(res.ID))
+	return err
+}
+
+// 判断流水线在计划时间是否已经由主节点处理
+func Fired(pipelineId string, planWith time.Time) (bool, error) {
+	resp, err := Client.Get(context.TODO(), fireKey(pipelineId, planWith), clientv3.WithCountOnly())
+	if err != nil {
+		return false, err
+	}
+
+	return resp.Count > 0, nil
+}
+
+func fireKey(pipelineId string, planWith time.Time) string {
+	return fmt.Sprintf("%s/fire/%s/%d", config.Conf.Etcd.Locker, pipelineId, planWith.Unix())
+}
+
+// 记录节点在计划时间处于执行时间段外，将本次执行转交给其他节点
+func Reroute(pipelineId string, planWith time.Time, node string) error {
+	res, err := Client.Grant(context.TODO(), 300)
+	if err != nil {
+		return err
+	}
+
+	_, err = Client.Put(context.TODO(), rerouteKey(pipelineId, planWith), node, clientv3.WithLease(res.ID))
+	return err
+}
+
+// 获取在计划时间转交本次执行的节点
+func Rerouted(pipelineId string, planWith time.Time) (string, bool, error) {
+	resp, err := Client.Get(context.TODO(), rerouteKey(pipelineId, planWith))
+	if err != nil {
+		return "", false, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return "", false, nil
+	}
+
+	return string(resp.Kvs[0].Value), true, nil
+}
+
+func rerouteKey(pipelineId string, planWith time.Time) string {
+	return fmt.Sprintf("%s/reroute/%s/%d", config.Conf.Etcd.Locker, pipelineId, planWith.Unix())
+}
@@ -1,9 +1,9 @@
 package discover
 
 import (
+	"github.com/betterde/ects/config"
 	"github.com/coreos/etcd/clientv3"
 	"log"
-	"time"
 )
 
 type (
@@ -17,11 +17,14 @@ var (
 )
 
 func NewCluster(endpoints []string) *Cluster {
-	client, err := clientv3.New(clientv3.Config{
-		Endpoints:   endpoints,
-		DialTimeout: 10 * time.Second,
-	})
+	etcd := config.Conf.Etcd
+	etcd.EndPoints = endpoints
+	conf, err := ClientConfig(&etcd)
+	if err != nil {
+		log.Println(err)
+	}
 
+	client, err := clientv3.New(conf)
 	if err != nil {
 		log.Println(err)
 	}
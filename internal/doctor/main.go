@@ -0,0 +1,218 @@
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/models"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/go-xorm/builder"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	ISSUETASKPIVOT    = "task_pivot"    // 流水线和任务的关联指向不存在的流水线或任务
+	ISSUENODEPIVOT    = "node_pivot"    // 流水线和节点的关联指向不存在的流水线或节点
+	ISSUEFINISHED     = "finished"      // 流水线成功时执行的任务不存在
+	ISSUEFAILED       = "failed"        // 流水线失败时执行的任务不存在
+	ISSUEETCDPIPELINE = "etcd_pipeline" // Etcd 中的流水线在数据库中不存在
+)
+
+type (
+	Issue struct {
+		Kind        string `json:"kind"`
+		Id          string `json:"id"`
+		Reference   string `json:"reference"`
+		Description string `json:"description"`
+	}
+	Report struct {
+		Issues    []*Issue  `json:"issues"`
+		CheckedAt time.Time `json:"checked_at"`
+	}
+)
+
+// 检查数据库关联和 Etcd 中的数据是否一致
+func Check() (*Report, error) {
+	report := &Report{
+		Issues:    make([]*Issue, 0),
+		CheckedAt: time.Now(),
+	}
+
+	pipelines := make(map[string]models.Pipeline)
+	if err := models.Engine.Find(&pipelines); err != nil {
+		return nil, err
+	}
+
+	tasks, err := ids(new(models.Task))
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := ids(new(models.Node))
+	if err != nil {
+		return nil, err
+	}
+
+	taskPivots := make([]models.PipelineTaskPivot, 0)
+	if err := models.Engine.Find(&taskPivots); err != nil {
+		return nil, err
+	}
+
+	for _, pivot := range taskPivots {
+		if _, exist := pipelines[pivot.PipelineId]; !exist {
+			report.add(ISSUETASKPIVOT, pivot.Id, pivot.PipelineId, "流水线 %s 不存在", pivot.PipelineId)
+			continue
+		}
+
+		if _, exist := tasks[pivot.TaskId]; !exist {
+			report.add(ISSUETASKPIVOT, pivot.Id, pivot.TaskId, "任务 %s 不存在", pivot.TaskId)
+		}
+	}
+
+	nodePivots := make([]models.PipelineNodePivot, 0)
+	if err := models.Engine.Find(&nodePivots); err != nil {
+		return nil, err
+	}
+
+	for _, pivot := range nodePivots {
+		if _, exist := pipelines[pivot.PipelineId]; !exist {
+			report.add(ISSUENODEPIVOT, pivot.Id, pivot.PipelineId, "流水线 %s 不存在", pivot.PipelineId)
+			continue
+		}
+
+		if _, exist := nodes[pivot.NodeId]; !exist {
+			report.add(ISSUENODEPIVOT, pivot.Id, pivot.NodeId, "节点 %s 不存在", pivot.NodeId)
+		}
+	}
+
+	for id, pipeline := range pipelines {
+		if pipeline.Finished != "" {
+			if _, exist := tasks[pipeline.Finished]; !exist {
+				report.add(ISSUEFINISHED, id, pipeline.Finished, "流水线成功时执行的任务 %s 不存在", pipeline.Finished)
+			}
+		}
+
+		if pipeline.Failed != "" {
+			if _, exist := tasks[pipeline.Failed]; !exist {
+				report.add(ISSUEFAILED, id, pipeline.Failed, "流水线失败时执行的任务 %s 不存在", pipeline.Failed)
+			}
+		}
+	}
+
+	resp, err := discover.Client.Get(context.TODO(), config.Conf.Etcd.Pipeline, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, kv := range resp.Kvs {
+		key := string(kv.Key)
+		id := key[strings.LastIndex(key, "/")+1:]
+		if _, exist := pipelines[id]; !exist {
+			report.add(ISSUEETCDPIPELINE, key, id, "流水线 %s 在数据库中不存在", id)
+		}
+	}
+
+	return report, nil
+}
+
+// 修复检查出的问题，返回修复的数量
+func Repair(report *Report) (repaired int, err error) {
+	for _, issue := range report.Issues {
+		var affected int64
+		switch issue.Kind {
+		case ISSUETASKPIVOT:
+			affected, err = models.Engine.Delete(&models.PipelineTaskPivot{Id: issue.Id})
+		case ISSUENODEPIVOT:
+			affected, err = models.Engine.Delete(&models.PipelineNodePivot{Id: issue.Id})
+		case ISSUEFINISHED, ISSUEFAILED:
+			// 字段名和问题类型一致，仅在仍指向该任务时清空
+			affected, err = models.Engine.Table(new(models.Pipeline)).Where(builder.Eq{"id": issue.Id, issue.Kind: issue.Reference}).Update(map[string]interface{}{issue.Kind: ""})
+		case ISSUEETCDPIPELINE:
+			var resp *clientv3.DeleteResponse
+			if resp, err = discover.Client.Delete(context.TODO(), issue.Id); err == nil {
+				affected = resp.Deleted
+			}
+		}
+
+		if err != nil {
+			return repaired, err
+		}
+
+		// 检查之后已经被其他请求修复的问题没有影响任何数据，不计入修复数量
+		if affected > 0 {
+			repaired++
+		}
+	}
+
+	return repaired, nil
+}
+
+// 定期检查数据一致性并记录日志
+func Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !discover.Leading() {
+				continue
+			}
+
+			report, err := Check()
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			for _, issue := range report.Issues {
+				log.Printf("Integrity issue [%s] %s: %s\n", issue.Kind, issue.Id, issue.Description)
+			}
+		}
+	}
+}
+
+func (report *Report) add(kind, id, reference, format string, args ...interface{}) {
+	report.Issues = append(report.Issues, &Issue{
+		Kind:        kind,
+		Id:          id,
+		Reference:   reference,
+		Description: fmt.Sprintf(format, args...),
+	})
+}
+
+// 检查结果只用于记录操作日志，不保存到数据库
+func (report *Report) Store() error {
+	return nil
+}
+
+func (report *Report) Update() error {
+	return nil
+}
+
+// 将检查结果转换为 JSON 字符串
+func (report *Report) ToString() (string, error) {
+	result, err := json.Marshal(report)
+	return string(result), err
+}
+
+// 获取表中所有记录的 ID 集合
+func ids(bean interface{}) (map[string]struct{}, error) {
+	list := make([]string, 0)
+	if err := models.Engine.Table(bean).Cols("id").Find(&list); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]struct{}, len(list))
+	for _, id := range list {
+		result[id] = struct{}{}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,196 @@
+package identity
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+const (
+	CLASSUNIVERSAL   = 0x00
+	CLASSAPPLICATION = 0x40
+	CLASSCONTEXT     = 0x80
+	CONSTRUCTED      = 0x20
+
+	TAGBOOLEAN     = 0x01
+	TAGINTEGER     = 0x02
+	TAGOCTETSTRING = 0x04
+	TAGENUMERATED  = 0x0A
+	TAGSEQUENCE    = 0x10
+	TAGSET         = 0x11
+
+	BERMAXLENGTH = 16 << 20 // 单个报文的最大长度
+)
+
+var ErrMalformed = errors.New("LDAP 报文格式有误")
+
+type (
+	// BER 编码的 TLV 结构，只支持单字节的标签
+	packet struct {
+		tag      byte // 包含类型和是否为复合结构
+		value    []byte
+		children []*packet
+	}
+)
+
+func primitive(tag byte, value []byte) *packet {
+	return &packet{tag: tag, value: value}
+}
+
+func constructed(tag byte, children ...*packet) *packet {
+	return &packet{tag: tag | CONSTRUCTED, children: children}
+}
+
+func octets(value string) *packet {
+	return primitive(TAGOCTETSTRING, []byte(value))
+}
+
+func integer(tag byte, value int) *packet {
+	bytes := []byte{byte(value)}
+	for value >>= 8; value != 0 && value != -1; value >>= 8 {
+		bytes = append([]byte{byte(value)}, bytes...)
+	}
+	// 最高位表示符号，正数需要补零
+	if value == 0 && bytes[0]&0x80 != 0 {
+		bytes = append([]byte{0}, bytes...)
+	}
+	return primitive(tag, bytes)
+}
+
+func boolean(value bool) *packet {
+	if value {
+		return primitive(TAGBOOLEAN, []byte{0xFF})
+	}
+	return primitive(TAGBOOLEAN, []byte{0})
+}
+
+// 编码为字节
+func (p *packet) bytes() []byte {
+	value := p.value
+	if p.tag&CONSTRUCTED != 0 {
+		value = nil
+		for _, child := range p.children {
+			value = append(value, child.bytes()...)
+		}
+	}
+
+	result := []byte{p.tag}
+	if length := len(value); length < 0x80 {
+		result = append(result, byte(length))
+	} else {
+		size := make([]byte, 0, 4)
+		for ; length > 0; length >>= 8 {
+			size = append([]byte{byte(length)}, size...)
+		}
+		result = append(result, 0x80|byte(len(size)))
+		result = append(result, size...)
+	}
+
+	return append(result, value...)
+}
+
+// 读取整数值
+func (p *packet) int() int {
+	value := 0
+	for index, b := range p.value {
+		if index == 0 && b&0x80 != 0 {
+			value = -1
+		}
+		value = value<<8 | int(b)
+	}
+	return value
+}
+
+func (p *packet) string() string {
+	return string(p.value)
+}
+
+// 获取指定位置的子结构，不存在时返回空结构，避免调用方逐层检查
+func (p *packet) child(index int) *packet {
+	if index < len(p.children) {
+		return p.children[index]
+	}
+	return &packet{}
+}
+
+// 从连接中读取一个完整的报文
+func read(reader *bufio.Reader) (*packet, error) {
+	tag, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	first, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	length := int(first)
+	if first&0x80 != 0 {
+		size := int(first & 0x7F)
+		if size == 0 || size > 4 {
+			return nil, ErrMalformed
+		}
+		length = 0
+		for index := 0; index < size; index++ {
+			b, err := reader.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			length = length<<8 | int(b)
+		}
+	}
+
+	if length > BERMAXLENGTH {
+		return nil, ErrMalformed
+	}
+
+	value := make([]byte, length)
+	if _, err := io.ReadFull(reader, value); err != nil {
+		return nil, err
+	}
+
+	return parse(tag, value)
+}
+
+// 解析报文内容，复合结构递归解析子结构
+func parse(tag byte, value []byte) (*packet, error) {
+	p := &packet{tag: tag, value: value}
+	if tag&CONSTRUCTED == 0 {
+		return p, nil
+	}
+
+	for offset := 0; offset < len(value); {
+		if offset+2 > len(value) {
+			return nil, ErrMalformed
+		}
+
+		childTag := value[offset]
+		length := int(value[offset+1])
+		offset += 2
+		if length&0x80 != 0 {
+			size := length & 0x7F
+			if size == 0 || size > 4 || offset+size > len(value) {
+				return nil, ErrMalformed
+			}
+			length = 0
+			for _, b := range value[offset : offset+size] {
+				length = length<<8 | int(b)
+			}
+			offset += size
+		}
+
+		if length < 0 || offset+length > len(value) {
+			return nil, ErrMalformed
+		}
+
+		child, err := parse(childTag, value[offset:offset+length])
+		if err != nil {
+			return nil, err
+		}
+		p.children = append(p.children, child)
+		offset += length
+	}
+
+	return p, nil
+}
@@ -0,0 +1,51 @@
+package identity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// 接口请求认证成功的外部身份的缓存时长，避免每个请求都访问身份提供方
+const CACHETTL = time.Minute
+
+type cached struct {
+	identity *Identity
+	expires  time.Time
+}
+
+var (
+	cache      = make(map[string]*cached)
+	cacheMutex sync.Mutex
+)
+
+// 按凭证缓存认证成功的外部身份，只保存凭证的摘要，认证失败的结果不缓存
+func Cached(provider, credential string, load func() (*Identity, error)) (*Identity, error) {
+	sum := sha256.Sum256([]byte(provider + "\x00" + credential))
+	key := hex.EncodeToString(sum[:])
+
+	cacheMutex.Lock()
+	item, exist := cache[key]
+	cacheMutex.Unlock()
+	if exist && time.Now().Before(item.expires) {
+		return item.identity, nil
+	}
+
+	result, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	for stale, entry := range cache {
+		if !now.Before(entry.expires) {
+			delete(cache, stale)
+		}
+	}
+	cache[key] = &cached{identity: result, expires: now.Add(CACHETTL)}
+
+	return result, nil
+}
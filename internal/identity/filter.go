@@ -0,0 +1,138 @@
+package identity
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	FILTERAND      = CLASSCONTEXT | CONSTRUCTED | 0
+	FILTEROR       = CLASSCONTEXT | CONSTRUCTED | 1
+	FILTERNOT      = CLASSCONTEXT | CONSTRUCTED | 2
+	FILTEREQUALITY = CLASSCONTEXT | CONSTRUCTED | 3
+	FILTERPRESENT  = CLASSCONTEXT | 7
+)
+
+// 转义过滤条件中的用户输入
+func EscapeFilter(value string) string {
+	var builder strings.Builder
+	for index := 0; index < len(value); index++ {
+		switch c := value[index]; c {
+		case '\\', '*', '(', ')', 0:
+			builder.WriteString(fmt.Sprintf("\\%02x", c))
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	return builder.String()
+}
+
+// 编译过滤条件，只支持与、或、非、等于和存在判断，足够按用户名查找用户
+func compile(filter string) (*packet, error) {
+	p, rest, err := compileFilter(strings.TrimSpace(filter))
+	if err != nil {
+		return nil, err
+	}
+
+	if rest != "" {
+		return nil, fmt.Errorf("过滤条件 %s 末尾有多余的内容", filter)
+	}
+
+	return p, nil
+}
+
+func compileFilter(filter string) (*packet, string, error) {
+	if !strings.HasPrefix(filter, "(") {
+		return nil, "", fmt.Errorf("过滤条件 %s 必须以括号开始", filter)
+	}
+
+	body := filter[1:]
+	if body == "" {
+		return nil, "", fmt.Errorf("过滤条件 %s 不完整", filter)
+	}
+
+	switch body[0] {
+	case '&', '|':
+		tag := byte(FILTERAND)
+		if body[0] == '|' {
+			tag = FILTEROR
+		}
+
+		p := &packet{tag: tag}
+		rest := body[1:]
+		for strings.HasPrefix(rest, "(") {
+			child, remain, err := compileFilter(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			p.children = append(p.children, child)
+			rest = remain
+		}
+
+		if !strings.HasPrefix(rest, ")") || len(p.children) == 0 {
+			return nil, "", fmt.Errorf("过滤条件 %s 不完整", filter)
+		}
+		return p, rest[1:], nil
+	case '!':
+		child, rest, err := compileFilter(body[1:])
+		if err != nil {
+			return nil, "", err
+		}
+
+		if !strings.HasPrefix(rest, ")") {
+			return nil, "", fmt.Errorf("过滤条件 %s 不完整", filter)
+		}
+		return &packet{tag: FILTERNOT, children: []*packet{child}}, rest[1:], nil
+	}
+
+	end := strings.IndexByte(body, ')')
+	if end < 0 {
+		return nil, "", fmt.Errorf("过滤条件 %s 不完整", filter)
+	}
+
+	item := body[:end]
+	equal := strings.IndexByte(item, '=')
+	if equal <= 0 || strings.ContainsAny(item[equal-1:equal], "<>~:") {
+		return nil, "", fmt.Errorf("不支持的过滤条件 %s", item)
+	}
+
+	attribute, value := item[:equal], item[equal+1:]
+	if value == "*" {
+		return primitive(FILTERPRESENT, []byte(attribute)), body[end+1:], nil
+	}
+
+	if strings.Contains(value, "*") {
+		return nil, "", fmt.Errorf("不支持的过滤条件 %s", item)
+	}
+
+	decoded, err := unescapeFilter(value)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &packet{tag: FILTEREQUALITY, children: []*packet{octets(attribute), primitive(TAGOCTETSTRING, decoded)}}, body[end+1:], nil
+}
+
+// 还原过滤条件中 \XX 形式的转义
+func unescapeFilter(value string) ([]byte, error) {
+	result := make([]byte, 0, len(value))
+	for index := 0; index < len(value); index++ {
+		if value[index] != '\\' {
+			result = append(result, value[index])
+			continue
+		}
+
+		if index+2 >= len(value) {
+			return nil, fmt.Errorf("过滤条件的值 %s 转义有误", value)
+		}
+
+		decoded, err := hex.DecodeString(value[index+1 : index+3])
+		if err != nil {
+			return nil, fmt.Errorf("过滤条件的值 %s 转义有误", value)
+		}
+		result = append(result, decoded...)
+		index += 2
+	}
+	return result, nil
+}
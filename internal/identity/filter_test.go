@@ -0,0 +1,46 @@
+package identity
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	p, err := compile("(&(objectClass=person)(uid=" + EscapeFilter("a*b") + "))")
+	if err != nil {
+		t.Fatalf("编译过滤条件失败：%v", err)
+	}
+
+	if p.tag != FILTERAND || len(p.children) != 2 {
+		t.Fatalf("与条件有误：%x %d", p.tag, len(p.children))
+	}
+
+	if value := p.child(1).child(1).value; !bytes.Equal(value, []byte("a*b")) {
+		t.Errorf("转义的值还原有误：%q", value)
+	}
+
+	if p, err := compile("(mail=*)"); err != nil || p.tag != FILTERPRESENT {
+		t.Errorf("存在判断编译有误：%v", err)
+	}
+
+	for _, filter := range []string{"uid=a", "(uid=a", "(uid>=a)", "(uid=a*)", "(&)", "(uid=a)(uid=b)"} {
+		if _, err := compile(filter); err == nil {
+			t.Errorf("过滤条件 %s 应该编译失败", filter)
+		}
+	}
+}
+
+func TestPacket(t *testing.T) {
+	long := make([]byte, 300)
+	message := constructed(TAGSEQUENCE, integer(TAGINTEGER, 200), primitive(TAGOCTETSTRING, long))
+
+	encoded := message.bytes()
+	decoded, err := parse(encoded[0], encoded[4:])
+	if err != nil {
+		t.Fatalf("解析报文失败：%v", err)
+	}
+
+	if decoded.child(0).int() != 200 || len(decoded.child(1).value) != 300 {
+		t.Errorf("报文解析结果有误：%d %d", decoded.child(0).int(), len(decoded.child(1).value))
+	}
+}
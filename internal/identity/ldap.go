@@ -0,0 +1,234 @@
+package identity
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	LDAPBINDREQUEST    = CLASSAPPLICATION | CONSTRUCTED | 0
+	LDAPBINDRESPONSE   = CLASSAPPLICATION | CONSTRUCTED | 1
+	LDAPUNBINDREQUEST  = CLASSAPPLICATION | 2
+	LDAPSEARCHREQUEST  = CLASSAPPLICATION | CONSTRUCTED | 3
+	LDAPSEARCHENTRY    = CLASSAPPLICATION | CONSTRUCTED | 4
+	LDAPSEARCHDONE     = CLASSAPPLICATION | CONSTRUCTED | 5
+	LDAPSEARCHREF      = CLASSAPPLICATION | CONSTRUCTED | 19
+	LDAPSIMPLEAUTH     = CLASSCONTEXT | 0
+	LDAPSUCCESS        = 0
+	LDAPINVALIDCREDS   = 49
+	LDAPSCOPESUBTREE   = 2
+	LDAPDEREFNEVER     = 0
+	LDAPSEARCHMAXENTRY = 2 // 只需要判断是否唯一
+)
+
+type (
+	// 只实现登录需要的绑定和查找操作
+	ldapConn struct {
+		conn      net.Conn
+		reader    *bufio.Reader
+		messageId int
+	}
+	ldapEntry struct {
+		dn         string
+		attributes map[string][]string
+	}
+)
+
+// 判断是否启用了 LDAP 登录
+func LDAPEnabled() bool {
+	return config.Conf != nil && config.Conf.Identity.LDAP.Address != ""
+}
+
+// 使用 LDAP 验证用户名和密码：先查找用户的 DN，再使用该 DN 和密码绑定
+func Authenticate(username, password string) (*Identity, error) {
+	// 密码为空时 LDAP 会作为匿名绑定处理并返回成功
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	options := config.Conf.Identity.LDAP
+	conn, err := dialLDAP(options.Address, options.TLS)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+
+	if options.BindDN != "" {
+		if err := conn.bind(options.BindDN, options.BindPass); err != nil {
+			return nil, fmt.Errorf("LDAP 查找账号绑定失败：%s", err)
+		}
+	}
+
+	entries, err := conn.search(options.BaseDN, fmt.Sprintf(options.Filter, EscapeFilter(username)), []string{options.Email, options.Name, options.Group})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+
+	entry := entries[0]
+	if err := conn.bind(entry.dn, password); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Provider: PROVIDERLDAP,
+		Subject:  entry.dn,
+		Email:    entry.first(options.Email),
+		Name:     entry.first(options.Name),
+		Groups:   entry.attributes[strings.ToLower(options.Group)],
+	}
+
+	if identity.Email == "" {
+		return nil, fmt.Errorf("LDAP 用户 %s 缺少邮箱属性 %s", entry.dn, options.Email)
+	}
+
+	return identity, nil
+}
+
+func dialLDAP(address string, secure bool) (*ldapConn, error) {
+	dialer := &net.Dialer{Timeout: TIMEOUT}
+
+	var conn net.Conn
+	var err error
+	if secure {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(TIMEOUT)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &ldapConn{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// 发送请求，返回消息ID
+func (c *ldapConn) send(op *packet) (int, error) {
+	c.messageId++
+	message := constructed(TAGSEQUENCE, integer(TAGINTEGER, c.messageId), op)
+	_, err := c.conn.Write(message.bytes())
+	return c.messageId, err
+}
+
+// 读取指定消息ID的响应
+func (c *ldapConn) receive(id int) (*packet, error) {
+	for {
+		message, err := read(c.reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if message.child(0).int() == id {
+			return message.child(1), nil
+		}
+	}
+}
+
+func (c *ldapConn) bind(dn, password string) error {
+	id, err := c.send(constructed(LDAPBINDREQUEST, integer(TAGINTEGER, 3), octets(dn), primitive(LDAPSIMPLEAUTH, []byte(password))))
+	if err != nil {
+		return err
+	}
+
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+
+	if op.tag != LDAPBINDRESPONSE {
+		return ErrMalformed
+	}
+
+	switch code := op.child(0).int(); code {
+	case LDAPSUCCESS:
+		return nil
+	case LDAPINVALIDCREDS:
+		return ErrInvalidCredentials
+	default:
+		return fmt.Errorf("LDAP 绑定失败：%d %s", code, op.child(2).string())
+	}
+}
+
+func (c *ldapConn) search(base, filter string, attributes []string) ([]*ldapEntry, error) {
+	compiled, err := compile(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := constructed(TAGSEQUENCE)
+	for _, attribute := range attributes {
+		selected.children = append(selected.children, octets(attribute))
+	}
+
+	id, err := c.send(constructed(LDAPSEARCHREQUEST,
+		octets(base),
+		integer(TAGENUMERATED, LDAPSCOPESUBTREE),
+		integer(TAGENUMERATED, LDAPDEREFNEVER),
+		integer(TAGINTEGER, LDAPSEARCHMAXENTRY),
+		integer(TAGINTEGER, int(TIMEOUT/time.Second)),
+		boolean(false),
+		compiled,
+		selected,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*ldapEntry, 0)
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+
+		switch op.tag {
+		case LDAPSEARCHENTRY:
+			entry := &ldapEntry{dn: op.child(0).string(), attributes: make(map[string][]string)}
+			for _, attribute := range op.child(1).children {
+				name := strings.ToLower(attribute.child(0).string())
+				for _, value := range attribute.child(1).children {
+					entry.attributes[name] = append(entry.attributes[name], value.string())
+				}
+			}
+			entries = append(entries, entry)
+		case LDAPSEARCHREF:
+			continue
+		case LDAPSEARCHDONE:
+			// 超出数量限制时同样说明用户不唯一
+			if code := op.child(0).int(); code != LDAPSUCCESS && len(entries) < LDAPSEARCHMAXENTRY {
+				return nil, fmt.Errorf("LDAP 查找失败：%d %s", code, op.child(2).string())
+			}
+			return entries, nil
+		default:
+			return nil, errors.New("LDAP 查找返回了未知的响应")
+		}
+	}
+}
+
+// 解除绑定后关闭连接，解除绑定没有响应
+func (c *ldapConn) close() {
+	_, _ = c.send(primitive(LDAPUNBINDREQUEST, nil))
+	c.conn.Close()
+}
+
+// 获取属性的第一个值，属性名不区分大小写
+func (entry *ldapEntry) first(name string) string {
+	if values := entry.attributes[strings.ToLower(name)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
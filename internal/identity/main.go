@@ -0,0 +1,104 @@
+package identity
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PROVIDERLDAP = "ldap"
+	PROVIDEROIDC = "oidc"
+
+	TIMEOUT  = 10 * time.Second // 请求身份提供方的超时时间
+	STATETTL = 10 * time.Minute // OIDC 登录流程的有效期
+)
+
+var (
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+	ErrNoRole             = errors.New("外部账号不属于任何有权限的用户组")
+	ErrInvalidState       = errors.New("登录请求无效或已过期，请重新登录")
+)
+
+type (
+	// 身份提供方返回的用户信息
+	Identity struct {
+		Provider string
+		Subject  string // 在身份提供方中的唯一标识
+		Email    string
+		Name     string
+		Groups   []string
+	}
+)
+
+// 根据用户组映射角色，匹配多个用户组时取权限最高的角色，没有匹配的用户组时返回空字符串
+func (identity *Identity) Role() string {
+	role := ""
+	for _, group := range identity.Groups {
+		for name, mapped := range config.Conf.Identity.Groups {
+			if !models.ValidRole(mapped) || !matchGroup(group, name) {
+				continue
+			}
+
+			if role == "" || !models.Covers(role, mapped) {
+				role = mapped
+			}
+		}
+	}
+
+	return role
+}
+
+// 用户组可以是完整的 DN，也可以只使用 DN 中第一个 RDN 的值，例如 cn=ops,ou=groups,dc=example,dc=com 可以写作 ops
+func matchGroup(group, name string) bool {
+	if strings.EqualFold(group, name) {
+		return true
+	}
+
+	first := strings.SplitN(group, ",", 2)[0]
+	if equal := strings.IndexByte(first, '='); equal >= 0 {
+		return strings.EqualFold(strings.TrimSpace(first[equal+1:]), name)
+	}
+
+	return false
+}
+
+// 生成 OIDC 登录流程的 state，包含过期时间和签名，回调时无需查询存储
+func NewState() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	payload := fmt.Sprintf("%d.%s", time.Now().Add(STATETTL).Unix(), hex.EncodeToString(nonce))
+	return payload + "." + sign(payload), nil
+}
+
+// 校验 state 的签名和有效期
+func VerifyState(state string) error {
+	index := strings.LastIndexByte(state, '.')
+	if index < 0 || !hmac.Equal([]byte(state[index+1:]), []byte(sign(state[:index]))) {
+		return ErrInvalidState
+	}
+
+	expires, err := strconv.ParseInt(strings.SplitN(state, ".", 2)[0], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return ErrInvalidState
+	}
+
+	return nil
+}
+
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(config.Conf.Auth.Secret))
+	mac.Write([]byte("oidc:" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
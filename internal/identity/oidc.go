@@ -0,0 +1,209 @@
+package identity
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+type (
+	// 身份提供方的配置信息
+	provider struct {
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	}
+	tokenResponse struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+)
+
+var (
+	client = &http.Client{Timeout: TIMEOUT}
+
+	// 身份提供方的配置只在首次成功获取后缓存
+	discovered *provider
+	mutex      sync.Mutex
+)
+
+// 判断是否启用了 OIDC 登录
+func OIDCEnabled() bool {
+	return config.Conf != nil && config.Conf.Identity.OIDC.Issuer != ""
+}
+
+// 获取身份提供方的配置
+func discover() (*provider, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if discovered != nil {
+		return discovered, nil
+	}
+
+	resp, err := client.Get(strings.TrimSuffix(config.Conf.Identity.OIDC.Issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("获取身份提供方配置失败：%s", resp.Status)
+	}
+
+	result := &provider{}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, err
+	}
+
+	if result.AuthorizationEndpoint == "" || result.TokenEndpoint == "" || result.UserinfoEndpoint == "" {
+		return nil, errors.New("身份提供方配置缺少授权、令牌或用户信息地址")
+	}
+
+	discovered = result
+	return discovered, nil
+}
+
+// 生成跳转到身份提供方的授权地址
+func AuthCodeURL(state string) (string, error) {
+	endpoints, err := discover()
+	if err != nil {
+		return "", err
+	}
+
+	options := config.Conf.Identity.OIDC
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {options.ClientId},
+		"redirect_uri":  {options.RedirectUrl},
+		"scope":         {strings.Join(options.Scopes, " ")},
+		"state":         {state},
+	}
+
+	separator := "?"
+	if strings.Contains(endpoints.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return endpoints.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// 使用授权码换取访问令牌，再通过用户信息接口获取用户的身份
+func Exchange(code string) (*Identity, error) {
+	endpoints, err := discover()
+	if err != nil {
+		return nil, err
+	}
+
+	options := config.Conf.Identity.OIDC
+	resp, err := client.PostForm(endpoints.TokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {options.RedirectUrl},
+		"client_id":     {options.ClientId},
+		"client_secret": {options.ClientSecret},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	token := &tokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(token); err != nil {
+		return nil, err
+	}
+
+	if token.Error != "" || token.AccessToken == "" {
+		return nil, fmt.Errorf("换取访问令牌失败：%s %s", token.Error, token.ErrorDescription)
+	}
+
+	claims, err := userinfo(endpoints.UserinfoEndpoint, token.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return claimsIdentity(claims, options.GroupsClaim)
+}
+
+// 使用身份提供方签发的访问令牌获取用户的身份，用于直接携带访问令牌的接口请求
+func Introspect(accessToken string) (*Identity, error) {
+	endpoints, err := discover()
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := userinfo(endpoints.UserinfoEndpoint, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return claimsIdentity(claims, config.Conf.Identity.OIDC.GroupsClaim)
+}
+
+// 获取用户信息
+func userinfo(endpoint, accessToken string) (map[string]interface{}, error) {
+	request, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("获取用户信息失败：%s", resp.Status)
+	}
+
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// 从用户信息中提取身份，邮箱未验证时拒绝登录，避免通过修改邮箱冒充其他用户
+func claimsIdentity(claims map[string]interface{}, groupsClaim string) (*Identity, error) {
+	identity := &Identity{Provider: PROVIDEROIDC}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+
+	if identity.Subject == "" || identity.Email == "" {
+		return nil, errors.New("用户信息缺少 sub 或 email")
+	}
+
+	if verified, exist := claims["email_verified"].(bool); exist && !verified {
+		return nil, fmt.Errorf("邮箱 %s 尚未验证", identity.Email)
+	}
+
+	switch groups := claims[groupsClaim].(type) {
+	case []interface{}:
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				identity.Groups = append(identity.Groups, name)
+			}
+		}
+	case string:
+		identity.Groups = strings.Fields(strings.Replace(groups, ",", " ", -1))
+	}
+
+	return identity, nil
+}
@@ -0,0 +1,128 @@
+package janitor
+
+import (
+	"context"
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"log"
+	"time"
+)
+
+// 定期清理过期的任务输出、执行记录和审计日志
+func Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !discover.Leading() {
+				continue
+			}
+
+			if cleaned, err := Sweep(time.Now()); err != nil {
+				log.Println(err)
+			} else if cleaned > 0 {
+				log.Printf("Janitor cleaned output of %d task records\n", cleaned)
+			}
+
+			if records, logs, err := Prune(time.Now()); err != nil {
+				log.Println(err)
+			} else if records > 0 || logs > 0 {
+				log.Printf("Janitor pruned %d run records and %d audit logs\n", records, logs)
+			}
+		}
+	}
+}
+
+// 清理超出保留时间的任务输出，流水线设置了保留天数时优先使用流水线的设置，每条流水线最近的若干次执行始终保留
+func Sweep(now time.Time) (cleaned int64, err error) {
+	pipelines := make([]models.Pipeline, 0)
+	if err = models.Engine.Cols("id", "retention", "keep").Find(&pipelines); err != nil {
+		return
+	}
+
+	ids := make([]string, 0, len(pipelines))
+	for _, pipeline := range pipelines {
+		ids = append(ids, pipeline.Id)
+
+		days, keep := policy(&pipeline)
+		if days <= 0 {
+			continue
+		}
+
+		pinned, err := latest(pipeline.Id, keep)
+		if err != nil {
+			return cleaned, err
+		}
+
+		affected, err := clean(builder.Eq{"pipeline_id": pipeline.Id}.And(exclude(pinned)), now.AddDate(0, 0, -days))
+		if err != nil {
+			return cleaned, err
+		}
+		cleaned += affected
+	}
+
+	if config.Conf.Retention.Days <= 0 {
+		return
+	}
+
+	// 已删除的流水线的执行记录
+	affected, err := clean(defaults(ids), now.AddDate(0, 0, -config.Conf.Retention.Days))
+	cleaned += affected
+	return
+}
+
+// 流水线实际使用的保留天数和始终保留的执行次数，未单独设置时使用全局设置
+func policy(pipeline *models.Pipeline) (days int, keep int) {
+	days, keep = pipeline.Retention, pipeline.Keep
+	if days <= 0 {
+		days = config.Conf.Retention.Days
+	}
+	if keep <= 0 {
+		keep = config.Conf.Retention.Keep
+	}
+	return
+}
+
+// 获取流水线最近的执行记录ID
+func latest(pipelineId string, keep int) ([]string, error) {
+	ids := make([]string, 0, keep)
+	if keep <= 0 {
+		return ids, nil
+	}
+
+	err := models.Engine.Table(new(models.PipelineRecords)).Cols("id").Where(builder.Eq{"pipeline_id": pipelineId}).Desc("created_at").Limit(keep).Find(&ids)
+	return ids, err
+}
+
+// 排除始终保留的执行记录，没有需要保留的记录时不能使用空的 NOT IN 条件
+func exclude(pinned []string) builder.Cond {
+	if len(pinned) == 0 {
+		return builder.NewCond()
+	}
+
+	return builder.NotIn("id", pinned)
+}
+
+// 不属于任何现有流水线的执行记录，没有流水线时不能使用空的 NOT IN 条件
+func defaults(ids []string) builder.Cond {
+	if len(ids) == 0 {
+		return builder.NewCond()
+	}
+
+	return builder.NotIn("pipeline_id", ids)
+}
+
+// 清空符合条件且早于截止时间的任务输出，保留执行记录本身
+func clean(cond builder.Cond, before time.Time) (int64, error) {
+	records := builder.Select("id").From(new(models.PipelineRecords).TableName()).Where(cond.And(builder.Lt{"created_at": before}))
+
+	return models.Engine.Table(new(models.TaskRecords)).
+		Where(builder.In("pipeline_record_id", records).And(builder.Neq{"result": ""})).
+		Update(map[string]interface{}{"result": ""})
+}
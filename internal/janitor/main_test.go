@@ -0,0 +1,60 @@
+package janitor
+
+import (
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"testing"
+)
+
+func TestDefaults(t *testing.T) {
+	sql, args, err := builder.ToSQL(defaults(nil).And(builder.Lt{"created_at": 1}))
+	if err != nil {
+		t.Fatalf("没有流水线单独设置保留天数时生成条件失败：%v", err)
+	}
+	if sql != "created_at<?" || len(args) != 1 {
+		t.Errorf("没有流水线单独设置保留天数时条件有误：%s %v", sql, args)
+	}
+
+	sql, args, err = builder.ToSQL(defaults([]string{"a", "b"}))
+	if err != nil {
+		t.Fatalf("生成条件失败：%v", err)
+	}
+	if sql != "pipeline_id NOT IN (?,?)" || len(args) != 2 {
+		t.Errorf("排除单独设置的流水线时条件有误：%s %v", sql, args)
+	}
+}
+
+func TestExclude(t *testing.T) {
+	sql, _, err := builder.ToSQL(builder.Eq{"pipeline_id": "a"}.And(exclude(nil)))
+	if err != nil || sql != "pipeline_id=?" {
+		t.Errorf("没有需要保留的记录时条件有误：%s %v", sql, err)
+	}
+
+	sql, args, err := builder.ToSQL(builder.Eq{"pipeline_id": "a"}.And(exclude([]string{"x", "y"})))
+	if err != nil || sql != "pipeline_id=? AND id NOT IN (?,?)" || len(args) != 3 {
+		t.Errorf("排除保留的记录时条件有误：%s %v %v", sql, args, err)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	config.Conf = config.Init()
+
+	if days, keep := policy(&models.Pipeline{}); days != config.Conf.Retention.Days || keep != config.Conf.Retention.Keep {
+		t.Errorf("未单独设置时应使用全局设置，实际为 %d 天 %d 次", days, keep)
+	}
+
+	if days, keep := policy(&models.Pipeline{Retention: 365, Keep: 4}); days != 365 || keep != 4 {
+		t.Errorf("应优先使用流水线的设置，实际为 %d 天 %d 次", days, keep)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	if rows := limit(100, 10); rows != 100 {
+		t.Errorf("最大保留数量大于始终保留的次数时应使用最大保留数量，实际为 %d", rows)
+	}
+
+	if rows := limit(5, 10); rows != 10 {
+		t.Errorf("最大保留数量不能少于始终保留的次数，实际为 %d", rows)
+	}
+}
@@ -0,0 +1,172 @@
+package janitor
+
+import (
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"github.com/go-xorm/xorm"
+	"log"
+	"time"
+)
+
+const PRUNEBATCH = 1000 // 未配置时每批删除的行数
+
+// 删除超出保留天数或者超出每条流水线最大保留数量的执行记录，以及超出保留天数的审计日志，正在执行的记录不会被删除
+func Prune(now time.Time) (records int64, logs int64, err error) {
+	days, rows := config.Conf.Retention.Records, config.Conf.Retention.Rows
+
+	if days > 0 || rows > 0 {
+		pipelines := make([]models.Pipeline, 0)
+		if err = models.Engine.Cols("id", "keep").Find(&pipelines); err != nil {
+			return
+		}
+
+		ids := make([]string, 0, len(pipelines))
+		for _, pipeline := range pipelines {
+			ids = append(ids, pipeline.Id)
+			_, keep := policy(&pipeline)
+
+			var affected int64
+			if days > 0 {
+				var pinned []string
+				if pinned, err = latest(pipeline.Id, keep); err != nil {
+					return
+				}
+
+				affected, err = prune(builder.Eq{"pipeline_id": pipeline.Id}.And(exclude(pinned), builder.Lt{"created_at": now.AddDate(0, 0, -days)}), 0)
+				records += affected
+				if err != nil {
+					return
+				}
+			}
+
+			if rows > 0 {
+				affected, err = prune(builder.Eq{"pipeline_id": pipeline.Id}, limit(rows, keep))
+				records += affected
+				if err != nil {
+					return
+				}
+			}
+		}
+
+		// 已删除的流水线的执行记录
+		if days > 0 {
+			var affected int64
+			affected, err = prune(defaults(ids).And(builder.Lt{"created_at": now.AddDate(0, 0, -days)}), 0)
+			records += affected
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	if config.Conf.Retention.Audit > 0 {
+		logs, err = audit(now.AddDate(0, 0, -config.Conf.Retention.Audit))
+	}
+
+	return
+}
+
+// 每条流水线实际保留的执行记录数，不少于始终保留的执行次数
+func limit(rows int, keep int) int {
+	if rows < keep {
+		return keep
+	}
+
+	return rows
+}
+
+// 每批删除的行数
+func batch() int {
+	if config.Conf.Retention.Batch > 0 {
+		return config.Conf.Retention.Batch
+	}
+
+	return PRUNEBATCH
+}
+
+// 按照创建时间从新到旧跳过 offset 条记录后分批删除符合条件的执行记录
+func prune(cond builder.Cond, offset int) (int64, error) {
+	cond = cond.And(builder.Neq{"status": models.RECORDRUNNING})
+	size := batch()
+
+	var deleted int64
+	for {
+		ids := make([]string, 0, size)
+		if err := models.Engine.Table(new(models.PipelineRecords)).Cols("id").Where(cond).Desc("created_at").Limit(size, offset).Find(&ids); err != nil {
+			return deleted, err
+		}
+
+		if len(ids) == 0 {
+			return deleted, nil
+		}
+
+		if err := remove(ids); err != nil {
+			return deleted, err
+		}
+		deleted += int64(len(ids))
+
+		if len(ids) < size {
+			return deleted, nil
+		}
+	}
+}
+
+// 在同一个事务中删除执行记录和关联的步骤记录、分享链接
+func remove(ids []string) error {
+	session := models.Engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	if _, err := session.Where(builder.In("pipeline_record_id", ids)).Delete(&models.TaskRecords{}); err != nil {
+		return rollback(session, err)
+	}
+
+	if _, err := session.Where(builder.In("run_id", ids)).Delete(&models.RunShare{}); err != nil {
+		return rollback(session, err)
+	}
+
+	if _, err := session.Where(builder.In("id", ids)).Delete(&models.PipelineRecords{}); err != nil {
+		return rollback(session, err)
+	}
+
+	return session.Commit()
+}
+
+// 回滚事务，返回导致回滚的错误
+func rollback(session *xorm.Session, err error) error {
+	if err := session.Rollback(); err != nil {
+		log.Println(err)
+	}
+
+	return err
+}
+
+// 分批删除早于截止时间的审计日志
+func audit(before time.Time) (int64, error) {
+	size := batch()
+
+	var deleted int64
+	for {
+		ids := make([]int64, 0, size)
+		if err := models.Engine.Table(new(models.Log)).Cols("id").Where(builder.Lt{"created_at": before}).Asc("id").Limit(size).Find(&ids); err != nil {
+			return deleted, err
+		}
+
+		if len(ids) == 0 {
+			return deleted, nil
+		}
+
+		affected, err := models.Engine.Where(builder.In("id", ids)).Delete(&models.Log{})
+		deleted += affected
+		if err != nil {
+			return deleted, err
+		}
+
+		if len(ids) < size {
+			return deleted, nil
+		}
+	}
+}
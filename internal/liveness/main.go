@@ -0,0 +1,246 @@
+package liveness
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/control"
+	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/internal/metrics"
+	"github.com/betterde/ects/models"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/go-xorm/builder"
+	"log"
+	"strings"
+	"time"
+)
+
+// 监听执行登记，登记因租约过期被删除而记录仍在执行中时，将执行标记为失联并按照流水线的重试次数重新下发
+func Watch(ctx context.Context) {
+	backoff := &discover.Backoff{}
+	for {
+		backoff.Start()
+		if err := watch(ctx); err != nil && ctx.Err() == nil {
+			log.Println(err)
+		}
+
+		// 监听中断后重新获取登记并监听，避免失联检测停止
+		if !backoff.Wait(ctx) {
+			return
+		}
+	}
+}
+
+func watch(ctx context.Context) error {
+	prefix := fmt.Sprintf("%s/runs/", config.Conf.Etcd.Running)
+
+	resp, err := discover.Client.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return err
+	}
+
+	// 主节点启动前已经失联的执行
+	sweep(registered(prefix, resp), time.Now())
+
+	watchCtx, guard := discover.Guarded(ctx, "runs")
+	defer guard.Stop()
+
+	watchChan := discover.Client.Watch(watchCtx, prefix, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1), clientv3.WithProgressNotify())
+	for watchResp := range watchChan {
+		guard.Touch()
+		if err := discover.Interrupted("runs", &watchResp); err != nil {
+			return err
+		}
+		metrics.Watched("runs", &watchResp)
+		for _, event := range watchResp.Events {
+			if event.Type == mvccpb.DELETE {
+				lost(strings.TrimPrefix(string(event.Kv.Key), prefix))
+			}
+		}
+	}
+
+	return discover.ErrWatchClosed
+}
+
+// 定期巡检正在执行的记录，补充处理监听期间遗漏的失联，只在领导者上执行
+func Patrol(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	prefix := fmt.Sprintf("%s/runs/", config.Conf.Etcd.Running)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !discover.Leading() {
+				continue
+			}
+
+			resp, err := discover.Client.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			if count := sweep(registered(prefix, resp), time.Now()); count > 0 {
+				log.Printf("Watchdog marked %d zombie runs as lost\n", count)
+			}
+		}
+	}
+}
+
+// 获取有执行登记的执行记录ID
+func registered(prefix string, resp *clientv3.GetResponse) map[string]bool {
+	alive := make(map[string]bool, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		alive[strings.TrimPrefix(string(kv.Key), prefix)] = true
+	}
+	return alive
+}
+
+// 处理没有执行登记、执行节点已离线或者心跳超时的正在执行的记录，返回标记为失联的数量
+func sweep(alive map[string]bool, now time.Time) int {
+	records := make([]models.PipelineRecords, 0)
+	// 留出节点登记执行的时间
+	before := now.Add(-30 * time.Second)
+	if err := models.Engine.Cols("id", "node_id", "heartbeat_at").Where(builder.Eq{"status": models.RECORDRUNNING}.And(builder.Lt{"created_at": before})).Find(&records); err != nil {
+		log.Println(err)
+		return 0
+	}
+
+	nodes := make([]models.Node, 0)
+	if err := models.Engine.Cols("id", "status").Where(builder.Eq{"mode": models.WORKER}).Find(&nodes); err != nil {
+		log.Println(err)
+		return 0
+	}
+
+	statuses := make(map[string]string, len(nodes))
+	for _, node := range nodes {
+		statuses[node.Id] = node.Status
+	}
+
+	count := 0
+	for index := range records {
+		if zombie(&records[index], alive, statuses, now) && lost(records[index].Id) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// 判断正在执行的记录是否已经失联，旧版本的工作节点不更新心跳，只检查执行登记和节点状态
+func zombie(record *models.PipelineRecords, alive map[string]bool, statuses map[string]string, now time.Time) bool {
+	if !alive[record.Id] {
+		return true
+	}
+
+	if status, exist := statuses[record.NodeId]; !exist || status == models.OFFLINE {
+		return true
+	}
+
+	heartbeat := time.Time(record.HeartbeatAt)
+	return !heartbeat.IsZero() && now.Sub(heartbeat) > 3*models.RECORDHEARTBEAT
+}
+
+// 将执行标记为失联，多个主节点同时处理时只有一个会成功
+func lost(id string) bool {
+	now := time.Now()
+	affected, err := models.Engine.Table(new(models.PipelineRecords)).Where(builder.Eq{"id": id, "status": models.RECORDRUNNING}).Update(map[string]interface{}{
+		"status":      models.RECORDLOST,
+		"finish_with": now,
+		"updated_at":  now,
+	})
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+
+	if affected == 0 {
+		return false
+	}
+
+	record := &models.PipelineRecords{}
+	if _, err := models.Engine.Id(id).Get(record); err != nil {
+		log.Println(err)
+		return true
+	}
+
+	log.Printf("Run %s of pipeline %s on node %s lost\n", record.Reference(), record.PipelineId, record.NodeId)
+	metrics.Observe(record)
+
+	if err := retry(record); err != nil {
+		log.Println(err)
+	}
+
+	return true
+}
+
+// 按照流水线的重试次数，将失联的执行下发到在线的节点
+func retry(record *models.PipelineRecords) error {
+	pipeline := &models.Pipeline{}
+	exist, err := models.Engine.Id(record.PipelineId).Get(pipeline)
+	if err != nil {
+		return err
+	}
+
+	if !exist || record.Attempt > pipeline.Retries || record.Snapshot == "" {
+		return nil
+	}
+
+	snapshot := &models.Pipeline{}
+	if err := json.Unmarshal([]byte(record.Snapshot), snapshot); err != nil {
+		return err
+	}
+
+	node, err := pick(record)
+	if err != nil {
+		return err
+	}
+
+	if node == "" {
+		return fmt.Errorf("no online node to retry run %s", record.Id)
+	}
+
+	trigger := &models.Trigger{
+		Id:       models.NewRunId(),
+		Source:   models.TRIGGERRETRY,
+		ReplayOf: record.Id,
+		Attempt:  record.Attempt + 1,
+		Pipeline: snapshot,
+		Tags:     record.Tags,
+
+		CorrelationId: record.CorrelationId,
+		Parameters:    record.Parameters,
+		GroupId:       record.GroupId,
+	}
+
+	if err := control.Dispatch(node, trigger); err != nil {
+		return err
+	}
+
+	log.Printf("Run %s retried as %s on node %s\n", record.Reference(), trigger.Id, node)
+	return nil
+}
+
+// 选择重试的节点，优先选择流水线绑定的其他在线节点
+func pick(record *models.PipelineRecords) (string, error) {
+	nodes := make([]models.Node, 0)
+	bound := builder.Select("node_id").From(new(models.PipelineNodePivot).TableName()).Where(builder.Eq{"pipeline_id": record.PipelineId})
+	if err := models.Engine.Where(builder.In("id", bound).And(builder.Eq{"status": models.ONLINE})).Find(&nodes); err != nil {
+		return "", err
+	}
+
+	candidate := ""
+	for _, node := range nodes {
+		if node.Id != record.NodeId {
+			return node.Id, nil
+		}
+		candidate = node.Id
+	}
+
+	return candidate, nil
+}
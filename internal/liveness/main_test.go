@@ -0,0 +1,32 @@
+package liveness
+
+import (
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"testing"
+	"time"
+)
+
+func TestZombie(t *testing.T) {
+	now := time.Now()
+	alive := map[string]bool{"a": true}
+	statuses := map[string]string{"online": models.ONLINE, "offline": models.OFFLINE}
+
+	cases := []struct {
+		record *models.PipelineRecords
+		zombie bool
+	}{
+		{&models.PipelineRecords{Id: "a", NodeId: "online", HeartbeatAt: utils.Time(now)}, false},
+		{&models.PipelineRecords{Id: "a", NodeId: "online"}, false},
+		{&models.PipelineRecords{Id: "b", NodeId: "online", HeartbeatAt: utils.Time(now)}, true},
+		{&models.PipelineRecords{Id: "a", NodeId: "offline", HeartbeatAt: utils.Time(now)}, true},
+		{&models.PipelineRecords{Id: "a", NodeId: "deleted", HeartbeatAt: utils.Time(now)}, true},
+		{&models.PipelineRecords{Id: "a", NodeId: "online", HeartbeatAt: utils.Time(now.Add(-4 * models.RECORDHEARTBEAT))}, true},
+	}
+
+	for index, item := range cases {
+		if zombie(item.record, alive, statuses, now) != item.zombie {
+			t.Errorf("第 %d 条记录的判断有误，期望 %v", index, item.zombie)
+		}
+	}
+}
@@ -7,14 +7,25 @@ import (
 
 var (
 	modules = map[string]map[string]map[string]string{
-		"task":     taskMessage(),
-		"user":     userMessage(),
-		"role":     roleMessage(),
-		"team":     teamMessage(),
-		"pipeline": pipelineMessage(),
+		"task":      taskMessage(),
+		"user":      userMessage(),
+		"role":      roleMessage(),
+		"team":      teamMessage(),
+		"pipeline":  pipelineMessage(),
+		"project":   projectMessage(),
+		"setting":   settingMessage(),
+		"token":     tokenMessage(),
+		"ratelimit": rateLimitMessage(),
+		"secret":    secretMessage(),
+		"node":      nodeMessage(),
 	}
 )
 
+// 获取模块中字段未通过校验规则时的提示，没有定义时返回空字符串
+func Lookup(module, field, rule string) string {
+	return modules[module][field][rule]
+}
+
 // 获取制定模块表单验证的单条消息
 func Get(module string, validationErrors validator.ValidationErrors) string {
 	first := validationErrors[0]
@@ -0,0 +1,12 @@
+package message
+
+func nodeMessage() map[string]map[string]string {
+	return map[string]map[string]string{
+		"Name": {
+			"required": "请填写节点名称",
+		},
+		"Drained": {
+			"required": "请选择进入或退出维护状态",
+		},
+	}
+}
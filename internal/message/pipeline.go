@@ -17,11 +17,93 @@ func pipelineMessage() map[string]map[string]string {
 		"Finished": {
 			"required": "Please select a task to perform on finished",
 		},
+		"Standby": {
+			"uuid4": "Please select a valid standby node",
+		},
 		"Failed": {
 			"required": "Please select a task to perform on failure",
 		},
 		"Overlap": {
 			"required": "Please select whether to repeat execution",
 		},
+		"Concurrency": {
+			"oneof": "Concurrency policy must be allow, forbid or replace",
+		},
+		"Misfire": {
+			"oneof": "Misfire policy must be skip, once or all",
+		},
+		"Depends": {
+			"uuid4": "Please select valid steps to depend on",
+		},
+		"Pipe": {
+			"numeric": "Please select whether to pipe output to the next step",
+		},
+		"Policy": {
+			"oneof": "Scheduling policy must be all, any or least-loaded",
+		},
+		"Inherit": {
+			"oneof": "Environment inheritance must be all, allowlist or none",
+		},
+		"Allowlist": {
+			"max": "Allowlist can contain at most 100 variables",
+		},
+		"LogLevel": {
+			"oneof": "Log level must be full or quiet",
+		},
+		"Condition": {
+			"oneof": "Condition must be on_success, on_failure or always",
+		},
+		"TailLines": {
+			"min": "Tail lines must not be negative",
+			"max": "Tail lines must not exceed 1000",
+		},
+		"Retries": {
+			"numeric": "Retries must be a number",
+			"min":     "Retries must not be negative, steps accept -1 to disable the task's retries",
+			"max":     "Retries must not exceed 10",
+		},
+		"Interval": {
+			"numeric": "Retry interval must be a number",
+			"min":     "Retry interval must not be negative, steps accept -1 to retry immediately",
+			"max":     "Retry interval must not exceed 3600 seconds",
+		},
+		"Retention": {
+			"numeric": "Retention days must be a number",
+			"min":     "Retention days must not be negative",
+		},
+		"Keep": {
+			"numeric": "Pinned runs must be a number",
+			"min":     "Pinned runs must not be negative",
+		},
+		"Timeout": {
+			"numeric": "Timeout must be a number",
+			"min":     "Timeout must not be negative, steps accept -1 to disable the task's timeout",
+		},
+		"Timezone": {
+			"max": "Timezone must not exceed 64 characters",
+		},
+		"DST": {
+			"oneof": "DST policy must be skip, adjust or twice",
+		},
+		"Tags": {
+			"max": "At most 20 tags are allowed",
+			"min": "Tag name must not be empty",
+		},
+		"Image": {
+			"max": "Image name must not exceed 255 characters",
+		},
+		"Variables": {
+			"max": "Environment variable value must not exceed 4096 characters",
+		},
+		"Enabled": {
+			"required": "Please choose to enable or disable the pipeline",
+		},
+		"Signal": {
+			"oneof": "Signal must be SIGTERM or SIGKILL",
+		},
+		"Grace": {
+			"min": "Grace period must not be negative",
+			"max": "Grace period must not exceed 3600 seconds",
+		},
 	}
 }
@@ -0,0 +1,20 @@
+package message
+
+func projectMessage() map[string]map[string]string {
+	return map[string]map[string]string{
+		"Name": {
+			"required": "Please enter a project name",
+		},
+		"MaxConcurrency": {
+			"numeric": "Max concurrency must be a number",
+			"min":     "Max concurrency must not be negative",
+		},
+		"Budget": {
+			"numeric": "Budget must be a number",
+			"min":     "Budget must not be negative",
+		},
+		"BudgetAction": {
+			"oneof": "Budget action must be deny or defer",
+		},
+	}
+}
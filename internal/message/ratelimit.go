@@ -0,0 +1,18 @@
+package message
+
+func rateLimitMessage() map[string]map[string]string {
+	return map[string]map[string]string{
+		"Name": {
+			"required": "请填写分组名称",
+			"max":      "分组名称不能超过 64 个字符",
+		},
+		"Rate": {
+			"gt":  "每秒次数必须大于 0",
+			"lte": "每秒次数不能超过 10000",
+		},
+		"Burst": {
+			"gte": "突发次数不能小于 0",
+			"lte": "突发次数不能超过 10000",
+		},
+	}
+}
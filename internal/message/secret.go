@@ -0,0 +1,17 @@
+package message
+
+func secretMessage() map[string]map[string]string {
+	return map[string]map[string]string{
+		"Name": {
+			"required": "请填写密钥名称",
+			"max":      "密钥名称不能超过 64 个字符",
+		},
+		"Value": {
+			"required": "请填写密钥的值",
+			"max":      "密钥的值不能超过 4096 个字符",
+		},
+		"Description": {
+			"max": "描述不能超过 255 个字符",
+		},
+	}
+}
@@ -0,0 +1,20 @@
+package message
+
+func settingMessage() map[string]map[string]string {
+	return map[string]map[string]string{
+		"Channel": {
+			"required": "Please select a notification channel",
+			"oneof":    "Unsupported notification channel",
+		},
+		"Event": {
+			"required": "Please select a notification event",
+			"oneof":    "Unsupported notification event",
+		},
+		"Subject": {
+			"required": "Please enter a subject template",
+		},
+		"Content": {
+			"required": "Please enter a content template",
+		},
+	}
+}
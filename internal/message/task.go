@@ -28,9 +28,24 @@ func taskMessage() map[string]map[string]string {
 		},
 		"Retries": {
 			"gte": "请填写重试次数",
+			"lte": "重试次数不能超过 10 次",
+		},
+		"RetryInterval": {
+			"gte": "请填写重试间隔时间",
+			"lte": "重试间隔时间不能超过 3600 秒",
+		},
+		"Backoff": {
+			"gte": "重试间隔的增长倍数不能为负数",
+			"lte": "重试间隔的增长倍数不能超过 10",
 		},
 		"Status": {
 			"required": "请选择任务状态",
 		},
+		"StreamUrl": {
+			"url": "输出流推送地址格式有误",
+		},
+		"Variables": {
+			"max": "环境变量的值不能超过 4096 个字符",
+		},
 	}
 }
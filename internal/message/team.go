@@ -5,5 +5,9 @@ func teamMessage() map[string]map[string]string {
 		"Name": {
 			"required": "Please enter a team name",
 		},
+		"UsersId": {
+			"required": "Please select the users to join the team",
+			"uuid4":    "Invalid user id",
+		},
 	}
 }
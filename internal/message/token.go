@@ -0,0 +1,18 @@
+package message
+
+func tokenMessage() map[string]map[string]string {
+	return map[string]map[string]string{
+		"Name": {
+			"required": "请填写令牌名称",
+			"max":      "令牌名称不能超过 255 个字符",
+		},
+		"Role": {
+			"required": "请选择令牌的权限范围",
+			"oneof":    "权限范围只能是 admin、operator 或 viewer",
+		},
+		"Days": {
+			"gte": "有效天数不能小于 0",
+			"lte": "有效天数不能超过 3650",
+		},
+	}
+}
@@ -20,5 +20,8 @@ func userMessage() map[string]map[string]string {
 		"Manager": {
 			"required": "请选择是否是管理员",
 		},
+		"Role": {
+			"oneof": "角色只能是 admin、operator 或 viewer",
+		},
 	}
 }
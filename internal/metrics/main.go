@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"github.com/betterde/ects/models"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+const NAMESPACE = "ects"
+
+var (
+	// 流水线执行次数，按触发方式和执行结果统计
+	Runs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "pipeline_runs_total",
+		Help:      "Number of finished pipeline runs.",
+	}, []string{"pipeline_id", "trigger", "status"})
+
+	// 流水线失败次数，包含执行失败、超时和节点失联
+	Failures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "pipeline_failures_total",
+		Help:      "Number of failed, timed out and lost pipeline runs.",
+	}, []string{"pipeline_id", "status"})
+
+	// 流水线执行耗时
+	Duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "pipeline_run_duration_seconds",
+		Help:      "Duration of finished pipeline runs.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 16),
+	}, []string{"pipeline_id"})
+
+	// 调度器等待立即执行的指令数量
+	QueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "scheduler",
+		Name:      "queue_depth",
+		Help:      "Number of triggers waiting to be launched.",
+	})
+
+	// 调度器正在执行的流水线数量
+	Running = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "scheduler",
+		Name:      "running",
+		Help:      "Number of pipeline runs in progress.",
+	})
+
+	// 调度计划中的流水线数量，包括作为备用节点的流水线
+	Planned = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "scheduler",
+		Name:      "planned",
+		Help:      "Number of pipelines in the schedule plan.",
+	})
+
+	// ETCD 监听收到事件时落后于最新版本的数量
+	WatchLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "etcd",
+		Name:      "watch_lag_revisions",
+		Help:      "Revisions between the latest event received by a watch and the store revision.",
+	}, []string{"watch"})
+
+	// ETCD 监听最后一次收到响应的时间
+	WatchSeen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "etcd",
+		Name:      "watch_last_response_timestamp_seconds",
+		Help:      "Unix time of the last response received by a watch.",
+	}, []string{"watch"})
+
+	// ETCD 监听最后一次收到事件的时间，不包括进度通知
+	WatchEvent = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "etcd",
+		Name:      "watch_last_event_timestamp_seconds",
+		Help:      "Unix time of the last event received by a watch.",
+	}, []string{"watch"})
+
+	// ETCD 可用但监听停滞而被重建的次数
+	WatchStalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "etcd",
+		Name:      "watch_stalls_total",
+		Help:      "Number of watches rebuilt after receiving neither events nor progress notifications while etcd was healthy.",
+	}, []string{"watch"})
+
+	// ETCD 监听因版本被压缩或者出错而中断的次数，中断后重新加载并监听
+	WatchRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "etcd",
+		Name:      "watch_restarts_total",
+		Help:      "Number of watches reloaded after being interrupted by compaction or an error.",
+	}, []string{"watch", "reason"})
+
+	// 最近一次对账发现的 ETCD 与数据库之间的差异数量
+	ReconcileDrift = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "reconcile",
+		Name:      "drift",
+		Help:      "Divergences between etcd and the database found by the last reconciliation.",
+	}, []string{"kind"})
+
+	// 对账修复的差异数量
+	ReconcileRepairs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "reconcile",
+		Name:      "repairs_total",
+		Help:      "Number of divergences repaired by reconciliation.",
+	}, []string{"kind"})
+
+	// 最后一次完成对账的时间
+	ReconcileLast = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "reconcile",
+		Name:      "last_run_timestamp_seconds",
+		Help:      "Unix time of the last finished reconciliation.",
+	})
+
+	// API 请求数量，按处理请求的主节点角色统计，forwarded 为转发给领导者的请求
+	Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "api",
+		Name:      "requests_total",
+		Help:      "Number of API requests by the role of the master serving them.",
+	}, []string{"served"})
+
+	statuses = map[int]string{
+		models.RECORDFAILED:    "failed",
+		models.RECORDFINISHED:  "finished",
+		models.RECORDRUNNING:   "running",
+		models.RECORDLOST:      "lost",
+		models.RECORDTIMEOUT:   "timeout",
+		models.RECORDCANCELLED: "cancelled",
+	}
+)
+
+func init() {
+	prometheus.MustRegister(Runs, Failures, Duration, QueueDepth, Running, Planned, WatchLag, WatchSeen, WatchEvent, WatchStalls, WatchRestarts, ReconcileDrift, ReconcileRepairs, ReconcileLast, Requests)
+}
+
+// 记录流水线的执行结果
+func Observe(record *models.PipelineRecords) {
+	status := statuses[record.Status]
+	Runs.WithLabelValues(record.PipelineId, record.Trigger, status).Inc()
+
+	// 被用户终止的执行不计入失败
+	if record.Status != models.RECORDFINISHED && record.Status != models.RECORDCANCELLED {
+		Failures.WithLabelValues(record.PipelineId, status).Inc()
+	}
+
+	if record.Status != models.RECORDLOST {
+		Duration.WithLabelValues(record.PipelineId).Observe(time.Time(record.FinishWith).Sub(time.Time(record.BeginWith)).Seconds())
+	}
+}
+
+// 记录 ETCD 监听的延迟
+func Watched(watch string, resp *clientv3.WatchResponse) {
+	WatchSeen.WithLabelValues(watch).SetToCurrentTime()
+
+	if count := len(resp.Events); count > 0 {
+		WatchEvent.WithLabelValues(watch).SetToCurrentTime()
+		WatchLag.WithLabelValues(watch).Set(float64(resp.Header.Revision - resp.Events[count-1].Kv.ModRevision))
+	}
+}
+
+// 提供给 Prometheus 抓取的接口
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// 在工作节点上单独监听抓取接口
+func Serve(address string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	return http.ListenAndServe(address, mux)
+}
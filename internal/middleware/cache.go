@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"github.com/kataras/iris"
+	"log"
+	"strings"
+)
+
+// 小于该长度的响应压缩收益不大，直接返回
+const GZIPMINLENGTH = 1024
+
+// 为数据量较大的 GET 接口计算 ETag 并按需压缩响应，数据未变化时返回 304
+func Cache(ctx iris.Context) {
+	// 实时推送的接口不能缓冲响应
+	if ctx.Method() != iris.MethodGet || (!config.Conf.Http.ETag && !config.Conf.Http.Gzip) || strings.Contains(ctx.GetHeader("Accept"), "text/event-stream") {
+		ctx.Next()
+		return
+	}
+
+	ctx.Record()
+	ctx.Next()
+
+	recorder := ctx.Recorder()
+	if recorder.StatusCode() != iris.StatusOK {
+		return
+	}
+
+	body := recorder.Body()
+
+	if config.Conf.Http.ETag {
+		etag := fmt.Sprintf(`W/"%x"`, sha1.Sum(body))
+		ctx.Header("ETag", etag)
+		if match(ctx.GetHeader("If-None-Match"), etag) {
+			recorder.ResetBody()
+			ctx.StatusCode(iris.StatusNotModified)
+			return
+		}
+	}
+
+	if config.Conf.Http.Gzip && len(body) >= GZIPMINLENGTH && ctx.ClientSupportsGzip() {
+		buffer := &bytes.Buffer{}
+		writer := gzip.NewWriter(buffer)
+		if _, err := writer.Write(body); err != nil {
+			log.Println(err)
+			return
+		}
+		if err := writer.Close(); err != nil {
+			log.Println(err)
+			return
+		}
+
+		ctx.Header("Vary", "Accept-Encoding")
+		ctx.Header("Content-Encoding", "gzip")
+		ctx.Header("Content-Length", fmt.Sprintf("%d", buffer.Len()))
+		recorder.SetBody(buffer.Bytes())
+	}
+}
+
+// 判断 If-None-Match 中是否包含当前的 ETag
+func match(header string, etag string) bool {
+	for _, item := range strings.Split(header, ",") {
+		item = strings.TrimSpace(item)
+		if item == "*" || item == etag || "W/"+item == etag {
+			return true
+		}
+	}
+
+	return false
+}
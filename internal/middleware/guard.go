@@ -1,29 +1,220 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
 	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/identity"
 	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
 	"github.com/dgrijalva/jwt-go"
 	jwtmiddleware "github.com/iris-contrib/middleware/jwt"
 	"github.com/kataras/iris"
 	"log"
+	"strings"
+)
+
+const (
+	AUTHTOKEN = "token" // 用户签发的 API 令牌
+	AUTHJWT   = "jwt"   // 登录后获得的 JWT
+	AUTHLDAP  = "ldap"  // 使用 LDAP 账号和密码的 HTTP Basic 认证
+	AUTHOIDC  = "oidc"  // 身份提供方签发的访问令牌
+
+	AUTHMETHOD = "auth" // 记录请求认证方式的上下文键
 )
 
 var (
-	JWTHandler = jwtmiddleware.New(jwtmiddleware.Config{
-		ValidationKeyGetter: func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.Conf.Auth.Secret), nil
-		},
-		SigningMethod: jwt.SigningMethodHS256,
-		ErrorHandler: func(ctx iris.Context, s string) {
-			ctx.StatusCode(iris.StatusUnauthorized)
-			if _, err := ctx.JSON(response.Response{
-				Code:    iris.StatusUnauthorized,
-				Message: "Unauthenticated.",
-				Data:    make(map[string]interface{}),
-			}); err != nil {
-				log.Println(err)
+	// 请求没有携带该认证方式能够识别的凭证，交给下一个认证方式处理
+	ErrNoCredentials = errors.New("请求未携带该认证方式的凭证")
+
+	// 按顺序尝试的认证方式，只有配置文件的 auth.methods 中启用的认证方式参与认证
+	authenticators = []*Authenticator{
+		// API 令牌有固定的前缀，放在最前面避免被当作 JWT 解析
+		{Name: AUTHTOKEN, Identify: apiToken},
+		{Name: AUTHJWT, Identify: signedToken},
+		{Name: AUTHLDAP, Identify: ldapBasic},
+		{Name: AUTHOIDC, Identify: oidcBearer},
+	}
+)
+
+type (
+	// 认证方式，识别出用户时返回与登录签发的 JWT 相同结构的声明，后续的中间件和控制器不需要区分
+	Authenticator struct {
+		Name     string
+		Identify func(ctx iris.Context) (jwt.MapClaims, error)
+	}
+)
+
+// 注册新的认证方式，排在已有的认证方式之后
+func RegisterAuthenticator(authenticator *Authenticator) {
+	authenticators = append(authenticators, authenticator)
+}
+
+// 按顺序尝试启用的认证方式，由第一个识别出凭证的认证方式决定认证结果
+func Authenticate(ctx iris.Context) {
+	for _, authenticator := range authenticators {
+		if !config.Conf.Auth.Enabled(authenticator.Name) {
+			continue
+		}
+
+		claims, err := authenticator.Identify(ctx)
+		if err == ErrNoCredentials {
+			continue
+		}
+
+		if err != nil {
+			unauthenticated(ctx)
+			return
+		}
+
+		ctx.Values().Set("jwt", &jwt.Token{Valid: true, Claims: claims})
+		ctx.Values().Set(AUTHMETHOD, authenticator.Name)
+		ctx.Next()
+		return
+	}
+
+	unauthenticated(ctx)
+}
+
+// 限定接口接受的认证方式，在路由注册时声明
+func Require(methods ...string) iris.Handler {
+	return func(ctx iris.Context) {
+		method := ctx.Values().GetString(AUTHMETHOD)
+		for _, allowed := range methods {
+			if method == allowed {
+				ctx.Next()
+				return
 			}
-		},
+		}
+
+		response.Send(iris.StatusForbidden, fmt.Sprintf("该接口不接受 %s 认证方式", method), map[string]interface{}{"methods": methods}).Dispatch(ctx)
+	}
+}
+
+// API 令牌转换为同样的声明，scp 记录令牌的权限范围
+func apiToken(ctx iris.Context) (jwt.MapClaims, error) {
+	plain := bearer(ctx)
+	if !strings.HasPrefix(plain, models.TOKENPREFIX) {
+		return nil, ErrNoCredentials
+	}
+
+	token, err := services.VerifyAPIToken(plain)
+	if err != nil {
+		if err != services.ErrInvalidAPIToken {
+			log.Println(err)
+		}
+		return nil, err
+	}
+
+	return jwt.MapClaims{
+		"iss": "ects",
+		"sub": token.UserId,
+		"tok": token.Id,
+		"scp": token.Role,
+	}, nil
+}
+
+// 只处理本服务签发的 JWT，其他令牌交给身份提供方校验
+func signedToken(ctx iris.Context) (jwt.MapClaims, error) {
+	plain := bearer(ctx)
+	if plain == "" || strings.HasPrefix(plain, models.TOKENPREFIX) {
+		return nil, ErrNoCredentials
+	}
+
+	unverified := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(plain, unverified); err != nil || unverified["iss"] != "ects" {
+		return nil, ErrNoCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(plain, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("不支持的签名算法 %s", token.Header["alg"])
+		}
+		return []byte(config.Conf.Auth.Secret), nil
 	})
-)
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, errors.New("JWT 无效")
+	}
+
+	return claims, nil
+}
+
+// 每个请求使用 LDAP 账号和密码认证，适合无法保存令牌的脚本
+func ldapBasic(ctx iris.Context) (jwt.MapClaims, error) {
+	username, password, ok := ctx.Request().BasicAuth()
+	if !ok || !identity.LDAPEnabled() {
+		return nil, ErrNoCredentials
+	}
+
+	external, err := identity.Cached(identity.PROVIDERLDAP, username+"\x00"+password, func() (*identity.Identity, error) {
+		return identity.Authenticate(username, password)
+	})
+	if err != nil {
+		if err != identity.ErrInvalidCredentials {
+			log.Println(err)
+		}
+		return nil, err
+	}
+
+	return externalClaims(external)
+}
+
+// 使用身份提供方签发的访问令牌，通过用户信息接口识别用户
+func oidcBearer(ctx iris.Context) (jwt.MapClaims, error) {
+	plain := bearer(ctx)
+	if plain == "" || strings.HasPrefix(plain, models.TOKENPREFIX) || !identity.OIDCEnabled() {
+		return nil, ErrNoCredentials
+	}
+
+	external, err := identity.Cached(identity.PROVIDEROIDC, plain, func() (*identity.Identity, error) {
+		return identity.Introspect(plain)
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return externalClaims(external)
+}
+
+// 外部身份关联到本地用户后转换为声明，idp 记录身份提供方
+func externalClaims(external *identity.Identity) (jwt.MapClaims, error) {
+	user, err := services.ProvisionExternal(external)
+	if err != nil {
+		return nil, err
+	}
+
+	return jwt.MapClaims{
+		"iss": "ects",
+		"sub": user.Id,
+		"idp": external.Provider,
+	}, nil
+}
+
+// 获取 Authorization 头中的 Bearer 令牌，使用其他方式时返回空字符串
+func bearer(ctx iris.Context) string {
+	plain, err := jwtmiddleware.FromAuthHeader(ctx)
+	if err != nil {
+		return ""
+	}
+
+	return plain
+}
+
+func unauthenticated(ctx iris.Context) {
+	ctx.StatusCode(iris.StatusUnauthorized)
+	if _, err := ctx.JSON(response.Response{
+		Code:    iris.StatusUnauthorized,
+		Message: "Unauthenticated.",
+		Error:   response.CODEUNAUTHENTICATED,
+		Data:    make(map[string]interface{}),
+	}); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/kataras/iris"
+	"log"
+	"strings"
+	"time"
+)
+
+// 代理状态下禁止修改的接口
+var protected = []string{"/api/user", "/api/team", "/api/account"}
+
+// 限制管理员代理其他用户时的操作范围，并记录代理期间的每一个修改请求
+func Impersonation(ctx iris.Context) {
+	impersonator := utils.GetImpersonator(ctx)
+	if impersonator != "" && ctx.Method() != iris.MethodGet {
+		defer audit(ctx, impersonator)
+
+		for _, prefix := range protected {
+			if strings.HasPrefix(ctx.Path(), prefix) {
+				ctx.StatusCode(iris.StatusForbidden)
+				if _, err := ctx.JSON(response.Response{
+					Code:    iris.StatusForbidden,
+					Message: "代理状态下不能修改用户、团队和账户信息",
+					Error:   response.CODEFORBIDDEN,
+					Data:    make(map[string]interface{}),
+				}); err != nil {
+					log.Println(err)
+				}
+				return
+			}
+		}
+	}
+
+	ctx.Next()
+}
+
+// 记录代理请求的方法、路径和响应状态
+func audit(ctx iris.Context, impersonator string) {
+	result, err := json.Marshal(map[string]interface{}{
+		"method": ctx.Method(),
+		"path":   ctx.Path(),
+		"status": ctx.GetStatusCode(),
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	record := &models.Log{
+		UserId:       utils.GetUID(ctx),
+		Impersonator: impersonator,
+		Operation:    fmt.Sprintf("IMPERSONATED %s %s", ctx.Method(), ctx.Path()),
+		Result:       string(result),
+		CreatedAt:    time.Now(),
+	}
+
+	if err := record.Store(); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/internal/metrics"
+	"github.com/betterde/ects/internal/response"
+	"github.com/kataras/iris"
+	"log"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+)
+
+const (
+	FORWARDEDHEADER = "X-Ects-Forwarded" // 由其他主节点转发的请求，避免领导权变更期间循环转发
+	MASTERHEADER    = "X-Ects-Master"    // 处理请求的主节点角色，便于确认查询请求是否分散到了各个主节点
+
+	ROLELEADER    = "leader"
+	ROLESTANDBY   = "standby"
+	ROLEFORWARDED = "forwarded"
+)
+
+// 不修改数据的非 GET 接口，可以由任意主节点处理
+var readonly = []*regexp.Regexp{
+	regexp.MustCompile(`^/api/pipeline/[^/]+/nodes/preview$`),
+}
+
+// 只有领导者处理修改数据的请求，其他主节点将请求转发给领导者，查询请求由当前主节点直接处理
+func Leader(ctx iris.Context) {
+	leading := discover.Leading()
+	if leading || (config.Conf.Http.StandbyReads && reading(ctx)) {
+		role := ROLESTANDBY
+		if leading {
+			role = ROLELEADER
+		}
+		metrics.Requests.WithLabelValues(role).Inc()
+		ctx.Header(MASTERHEADER, role)
+		ctx.Next()
+		return
+	}
+
+	if ctx.GetHeader(FORWARDEDHEADER) != "" {
+		response.Send(iris.StatusServiceUnavailable, "主节点正在切换，请稍后重试", make(map[string]interface{})).Dispatch(ctx)
+		return
+	}
+
+	address, err := discover.Leader()
+	if err != nil || address == "" {
+		if err != nil {
+			log.Println(err)
+		}
+		response.Send(iris.StatusServiceUnavailable, "尚未选出领导者，请稍后重试", make(map[string]interface{})).Dispatch(ctx)
+		return
+	}
+
+	target, err := url.Parse(address)
+	if err != nil {
+		response.InternalServerError("领导者地址有误", err).Dispatch(ctx)
+		return
+	}
+
+	metrics.Requests.WithLabelValues(ROLEFORWARDED).Inc()
+	ctx.Request().Header.Set(FORWARDEDHEADER, "1")
+	httputil.NewSingleHostReverseProxy(target).ServeHTTP(ctx.ResponseWriter(), ctx.Request())
+}
+
+// 是否为不修改数据的请求
+func reading(ctx iris.Context) bool {
+	switch ctx.Method() {
+	case iris.MethodGet, iris.MethodHead, iris.MethodOptions:
+		return true
+	}
+
+	for _, pattern := range readonly {
+		if pattern.MatchString(ctx.Path()) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"github.com/betterde/ects/internal/response"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/kataras/iris"
+	"log"
+)
+
+// 必须修改密码时仍然允许访问的接口
+var passwordExempt = map[string]bool{
+	"/api/account/profile":          true,
+	"/api/account/profile/password": true,
+}
+
+// 用户被要求修改密码时，修改密码之前只能访问个人信息和修改密码接口
+func PasswordChange(ctx iris.Context) {
+	token, ok := ctx.Values().Get("jwt").(*jwt.Token)
+	if ok {
+		claims, _ := token.Claims.(jwt.MapClaims)
+		if change, _ := claims["chg"].(bool); change && !passwordExempt[ctx.Path()] {
+			ctx.StatusCode(iris.StatusForbidden)
+			if _, err := ctx.JSON(response.Response{
+				Code:    iris.StatusForbidden,
+				Message: "请先修改密码",
+				Error:   response.CODEPASSWORDCHANGE,
+				Data:    map[string]interface{}{"must_change": true},
+			}); err != nil {
+				log.Println(err)
+			}
+			return
+		}
+	}
+
+	ctx.Next()
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/kataras/iris"
+)
+
+// 查询请求不检查角色，修改数据的请求要求当前用户至少拥有指定角色的权限，使用 API 令牌时同时检查令牌的权限范围
+func Authorize(role string) iris.Handler {
+	return func(ctx iris.Context) {
+		if ctx.Method() == iris.MethodGet || ctx.Method() == iris.MethodHead || ctx.Method() == iris.MethodOptions {
+			ctx.Next()
+			return
+		}
+
+		user := &models.User{}
+		exist, err := models.Engine.Id(utils.GetUID(ctx)).Get(user)
+		if err != nil {
+			response.InternalServerError("获取用户信息失败", err).Dispatch(ctx)
+			return
+		}
+
+		// API 令牌的权限不超过签发时指定的范围
+		scope := utils.GetScope(ctx)
+		if !exist || !user.Can(role) || (scope != "" && !models.Covers(scope, role)) {
+			response.Send(iris.StatusForbidden, "当前用户没有执行该操作的权限", map[string]interface{}{"role": role}).Dispatch(ctx)
+			return
+		}
+
+		ctx.Next()
+	}
+}
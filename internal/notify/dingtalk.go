@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type (
+	// 钉钉群机器人，设置了密钥时使用加签方式调用
+	DingTalk struct {
+		Url    string
+		Secret string
+		Title  string
+		Text   string
+	}
+	dingTalkReply struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+)
+
+func (dingTalk *DingTalk) Send() error {
+	body, err := json.Marshal(map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"title": dingTalk.Title,
+			"text":  dingTalk.Text,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	address := dingTalk.Url
+	if dingTalk.Secret != "" {
+		address = signed(address, dingTalk.Secret, time.Now())
+	}
+
+	result, err := post(address, body, nil)
+	if err != nil {
+		return err
+	}
+
+	// 钉钉在参数或签名错误时同样返回 200，需要检查错误码
+	reply := &dingTalkReply{}
+	if err := json.Unmarshal(result, reply); err != nil {
+		return err
+	}
+
+	if reply.ErrCode != 0 {
+		return fmt.Errorf("钉钉返回错误 %d：%s", reply.ErrCode, reply.ErrMsg)
+	}
+
+	return nil
+}
+
+// 在地址上附加时间戳和签名，签名为使用密钥对 "时间戳\n密钥" 计算的 HmacSHA256
+func signed(address, secret string, now time.Time) string {
+	timestamp := fmt.Sprintf("%d", now.UnixNano()/int64(time.Millisecond))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+	sign := url.QueryEscape(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	separator := "?"
+	if strings.Contains(address, "?") {
+		separator = "&"
+	}
+
+	return fmt.Sprintf("%s%stimestamp=%s&sign=%s", address, separator, timestamp, sign)
+}
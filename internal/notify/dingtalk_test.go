@@ -0,0 +1,15 @@
+package notify
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSigned(t *testing.T) {
+	now := time.Unix(1548990000, 0)
+	expected := "https://oapi.dingtalk.com/robot/send?access_token=abc&timestamp=1548990000000&sign=%2Fc5d7oBU%2BqIKIi%2BsMNje2Mzls%2FdkZppqYauwIyJeLuI%3D"
+
+	if address := signed("https://oapi.dingtalk.com/robot/send?access_token=abc", "SECabc", now); address != expected {
+		t.Errorf("unexpected signed address %s", address)
+	}
+}
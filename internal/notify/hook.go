@@ -1 +1,26 @@
 package notify
+
+import (
+	"github.com/betterde/ects/models"
+	"net/http"
+)
+
+type (
+	// 通用 Webhook，请求体为渲染后的模板内容
+	Hook struct {
+		Url     string
+		Content string
+		// 外部系统传入的关联ID，通过请求头传递
+		CorrelationId string
+	}
+)
+
+func (hook *Hook) Send() error {
+	header := http.Header{}
+	if hook.CorrelationId != "" {
+		header.Set(models.CORRELATIONHEADER, hook.CorrelationId)
+	}
+
+	_, err := post(hook.Url, []byte(hook.Content), header)
+	return err
+}
@@ -1,7 +1,153 @@
 package notify
 
+import (
+	"bytes"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/models"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+)
+
+const NOTIFYTIMEOUT = 10 * time.Second // 调用聊天机器人和 Webhook 的超时时间
+
 type (
 	Notify interface {
 		Send() error
 	}
 )
+
+var client = &http.Client{Timeout: NOTIFYTIMEOUT}
+
+// 按照流水线的通知设置发送执行结果，单个渠道发送失败不影响其他渠道
+func Deliver(ctx *Context) {
+	notifications, err := models.Repo.Notifications(ctx.Pipeline.Id)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for index := range notifications {
+		notification := &notifications[index]
+		if !notification.Subscribed(ctx.Event) {
+			continue
+		}
+
+		if err := deliver(notification, ctx); err != nil {
+			log.Printf("Failed to send %s notification of pipeline %s: %s\n", notification.Channel, ctx.Pipeline.Id, err)
+		}
+	}
+}
+
+// 执行组结束时发送一条汇总通知，全部成功时发送给订阅了成功事件的设置，否则发送给订阅了失败事件的设置
+func DeliverGroup(ctx *Context) {
+	notifications, err := models.Repo.Notifications(ctx.Pipeline.Id)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	subscription := models.EVENTFAILURE
+	if ctx.Group.Outcome() == models.GROUPSUCCEEDED {
+		subscription = models.EVENTSUCCESS
+	}
+
+	ctx.Event = models.EVENTGROUP
+	for index := range notifications {
+		notification := &notifications[index]
+		if !notification.Subscribed(subscription) {
+			continue
+		}
+
+		if err := deliver(notification, ctx); err != nil {
+			log.Printf("Failed to send %s notification of run group %s: %s\n", notification.Channel, ctx.Group.Id, err)
+		}
+	}
+}
+
+// 执行结果对应的通知事件，没有对应事件时返回空
+func Event(status int) string {
+	switch status {
+	case models.RECORDFINISHED:
+		return models.EVENTSUCCESS
+	case models.RECORDFAILED:
+		return models.EVENTFAILURE
+	case models.RECORDTIMEOUT:
+		return models.EVENTTIMEOUT
+	}
+
+	return ""
+}
+
+// 使用通知模板渲染并通过对应的渠道发送
+func deliver(notification *models.PipelineNotification, ctx *Context) error {
+	subject, content, err := Render(notification.Channel, ctx.Event, ctx)
+	if err != nil {
+		return err
+	}
+
+	return driver(notification, ctx, subject, content).Send()
+}
+
+// 根据通知渠道创建驱动
+func driver(notification *models.PipelineNotification, ctx *Context, subject, content string) Notify {
+	switch notification.Channel {
+	case models.CHANNELMAIL:
+		mailer := &Mail{
+			From:       fmt.Sprintf("%s<%s>", "ECTS", config.Conf.Notification.User),
+			To:         notification.Target,
+			Subject:    subject,
+			Year:       time.Now().Year(),
+			SiteURL:    config.Conf.Notification.Url,
+			SiteTitle:  "Elastic Crontab System",
+			Greeting:   "Hello",
+			Intro:      content,
+			Salutation: "Regards",
+		}
+		return mailer.Generator(ctx.Event)
+	case models.CHANNELSLACK:
+		return &Slack{Url: notification.Target, Text: content}
+	case models.CHANNELDINGTALK:
+		return &DingTalk{Url: notification.Target, Secret: notification.Secret, Title: subject, Text: content}
+	}
+
+	// 执行组的汇总通知没有执行记录
+	correlation := ""
+	if ctx.Record != nil {
+		correlation = ctx.Record.CorrelationId
+	}
+
+	return &Hook{Url: notification.Target, Content: content, CorrelationId: correlation}
+}
+
+// 发送 JSON 请求，响应状态码不是 2xx 时返回错误
+func post(url string, body []byte, header http.Header) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for key := range header {
+		req.Header.Set(key, header.Get(key))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return result, fmt.Errorf("通知接口返回状态码 %d：%s", resp.StatusCode, result)
+	}
+
+	return result, nil
+}
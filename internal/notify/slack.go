@@ -0,0 +1,23 @@
+package notify
+
+import (
+	"encoding/json"
+)
+
+type (
+	// Slack 的 Incoming Webhook
+	Slack struct {
+		Url  string
+		Text string
+	}
+)
+
+func (slack *Slack) Send() error {
+	body, err := json.Marshal(map[string]string{"text": slack.Text})
+	if err != nil {
+		return err
+	}
+
+	_, err = post(slack.Url, body, nil)
+	return err
+}
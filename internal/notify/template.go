@@ -0,0 +1,186 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/betterde/ects/models"
+	"log"
+	"text/template"
+)
+
+type (
+	// 渲染通知模板时可用的执行记录字段
+	Context struct {
+		Pipeline *models.Pipeline        // 流水线
+		Record   *models.PipelineRecords // 流水线执行记录
+		Steps    []*models.TaskRecords   // 任务执行记录
+		Event    string                  // 触发事件
+		Group    *models.RunGroup        // 执行组，只在执行组的汇总通知中可用
+	}
+)
+
+// 各通知渠道内置的默认模板
+var defaults = map[string]map[string][2]string{
+	models.CHANNELMAIL: {
+		models.EVENTSUCCESS: {
+			"[ECTS] 流水线 {{.Pipeline.Name}} 执行成功",
+			"流水线 {{.Pipeline.Name}} 于 {{.Record.BeginWith}} 在节点 {{.Record.WorkerName}} 上执行成功，耗时 {{.Record.Duration}} 秒。{{if .Record.CorrelationId}}关联ID：{{.Record.CorrelationId}}。{{end}}",
+		},
+		models.EVENTFAILURE: {
+			"[ECTS] 流水线 {{.Pipeline.Name}} 执行失败",
+			"流水线 {{.Pipeline.Name}} 于 {{.Record.BeginWith}} 在节点 {{.Record.WorkerName}} 上执行失败，执行记录ID：{{.Record.Id}}。{{if .Record.CorrelationId}}关联ID：{{.Record.CorrelationId}}。{{end}}",
+		},
+		models.EVENTTIMEOUT: {
+			"[ECTS] 流水线 {{.Pipeline.Name}} 执行超时",
+			"流水线 {{.Pipeline.Name}} 于 {{.Record.BeginWith}} 在节点 {{.Record.WorkerName}} 上执行超过 {{.Pipeline.Timeout}} 秒被终止，执行记录ID：{{.Record.Id}}。{{if .Record.CorrelationId}}关联ID：{{.Record.CorrelationId}}。{{end}}",
+		},
+		models.EVENTGROUP: {
+			"[ECTS] 流水线 {{.Pipeline.Name}} 的执行组已结束",
+			"流水线 {{.Pipeline.Name}} 的执行组 {{.Group.Id}} 已结束，状态：{{.Group.Status}}。共下发 {{.Group.Total}} 次执行，成功 {{.Group.Succeeded}} 次，失败 {{.Group.Failed}} 次，未执行 {{.Group.Pending}} 次。",
+		},
+	},
+	// 聊天机器人只发送内容，钉钉使用标题作为会话列表中的摘要
+	models.CHANNELSLACK: {
+		models.EVENTSUCCESS: {
+			"",
+			":white_check_mark: 流水线 *{{.Pipeline.Name}}* 在节点 {{.Record.WorkerName}} 上执行成功，耗时 {{.Record.Duration}} 秒。执行记录ID：`{{.Record.Id}}`",
+		},
+		models.EVENTFAILURE: {
+			"",
+			":x: 流水线 *{{.Pipeline.Name}}* 在节点 {{.Record.WorkerName}} 上执行失败。执行记录ID：`{{.Record.Id}}`{{if .Record.CorrelationId}}，关联ID：`{{.Record.CorrelationId}}`{{end}}",
+		},
+		models.EVENTTIMEOUT: {
+			"",
+			":hourglass: 流水线 *{{.Pipeline.Name}}* 在节点 {{.Record.WorkerName}} 上执行超时。执行记录ID：`{{.Record.Id}}`{{if .Record.CorrelationId}}，关联ID：`{{.Record.CorrelationId}}`{{end}}",
+		},
+		models.EVENTGROUP: {
+			"",
+			":bar_chart: 流水线 *{{.Pipeline.Name}}* 的执行组已结束，状态：{{.Group.Status}}。共 {{.Group.Total}} 次，成功 {{.Group.Succeeded}} 次，失败 {{.Group.Failed}} 次，未执行 {{.Group.Pending}} 次。执行组ID：`{{.Group.Id}}`",
+		},
+	},
+	models.CHANNELDINGTALK: {
+		models.EVENTSUCCESS: {
+			"流水线 {{.Pipeline.Name}} 执行成功",
+			"#### 流水线 {{.Pipeline.Name}} 执行成功\n\n- 节点：{{.Record.WorkerName}}\n- 耗时：{{.Record.Duration}} 秒\n- 执行记录ID：{{.Record.Id}}",
+		},
+		models.EVENTFAILURE: {
+			"流水线 {{.Pipeline.Name}} 执行失败",
+			"#### 流水线 {{.Pipeline.Name}} 执行失败\n\n- 节点：{{.Record.WorkerName}}\n- 开始时间：{{.Record.BeginWith}}\n- 执行记录ID：{{.Record.Id}}{{if .Record.CorrelationId}}\n- 关联ID：{{.Record.CorrelationId}}{{end}}",
+		},
+		models.EVENTTIMEOUT: {
+			"流水线 {{.Pipeline.Name}} 执行超时",
+			"#### 流水线 {{.Pipeline.Name}} 执行超时\n\n- 节点：{{.Record.WorkerName}}\n- 开始时间：{{.Record.BeginWith}}\n- 执行记录ID：{{.Record.Id}}{{if .Record.CorrelationId}}\n- 关联ID：{{.Record.CorrelationId}}{{end}}",
+		},
+		models.EVENTGROUP: {
+			"流水线 {{.Pipeline.Name}} 的执行组已结束",
+			"#### 流水线 {{.Pipeline.Name}} 的执行组已结束\n\n- 状态：{{.Group.Status}}\n- 执行次数：{{.Group.Total}}\n- 成功：{{.Group.Succeeded}}\n- 失败：{{.Group.Failed}}\n- 未执行：{{.Group.Pending}}\n- 执行组ID：{{.Group.Id}}",
+		},
+	},
+	// 钩子的内容作为请求体发送，标题不使用
+	models.CHANNELHOOK: {
+		models.EVENTSUCCESS: {
+			"",
+			`{"event": "success", "pipeline_id": {{printf "%q" .Pipeline.Id}}, "pipeline": {{printf "%q" .Pipeline.Name}}, "record_id": {{printf "%q" .Record.Id}}, "correlation_id": {{printf "%q" .Record.CorrelationId}}, "node": {{printf "%q" .Record.WorkerName}}, "duration": {{.Record.Duration}}}`,
+		},
+		models.EVENTFAILURE: {
+			"",
+			`{"event": "failure", "pipeline_id": {{printf "%q" .Pipeline.Id}}, "pipeline": {{printf "%q" .Pipeline.Name}}, "record_id": {{printf "%q" .Record.Id}}, "correlation_id": {{printf "%q" .Record.CorrelationId}}, "node": {{printf "%q" .Record.WorkerName}}, "duration": {{.Record.Duration}}}`,
+		},
+		models.EVENTTIMEOUT: {
+			"",
+			`{"event": "timeout", "pipeline_id": {{printf "%q" .Pipeline.Id}}, "pipeline": {{printf "%q" .Pipeline.Name}}, "record_id": {{printf "%q" .Record.Id}}, "correlation_id": {{printf "%q" .Record.CorrelationId}}, "node": {{printf "%q" .Record.WorkerName}}, "duration": {{.Record.Duration}}}`,
+		},
+		models.EVENTGROUP: {
+			"",
+			`{"event": "group", "pipeline_id": {{printf "%q" .Pipeline.Id}}, "pipeline": {{printf "%q" .Pipeline.Name}}, "group_id": {{printf "%q" .Group.Id}}, "kind": {{printf "%q" .Group.Kind}}, "status": {{printf "%q" .Group.Status}}, "total": {{.Group.Total}}, "succeeded": {{.Group.Succeeded}}, "failed": {{.Group.Failed}}, "pending": {{.Group.Pending}}}`,
+		},
+	},
+}
+
+// 按项目模板、全局模板、内置模板的优先级渲染通知标题和内容，自定义模板无法使用时回退到内置模板
+func Render(channel, event string, ctx *Context) (subject, content string, err error) {
+	tpl, err := Lookup(channel, event, ctx.Pipeline.ProjectId)
+	if err == nil {
+		if subject, content, err = Execute(tpl, ctx); err == nil || tpl.Id == "" {
+			return
+		}
+	}
+
+	log.Printf("Notification template of %s %s failed, falling back to built-in: %v\n", channel, event, err)
+
+	if tpl, err = builtin(channel, event); err != nil {
+		return "", "", err
+	}
+
+	return Execute(tpl, ctx)
+}
+
+// 查找适用的通知模板
+func Lookup(channel, event, projectId string) (*models.NotificationTemplate, error) {
+	scopes := []string{""}
+	if projectId != "" {
+		scopes = []string{projectId, ""}
+	}
+
+	for _, scope := range scopes {
+		tpl, exist, err := models.Repo.Template(channel, event, scope)
+		if err != nil {
+			return nil, err
+		}
+
+		if exist {
+			return tpl, nil
+		}
+	}
+
+	return builtin(channel, event)
+}
+
+// 获取内置模板
+func builtin(channel, event string) (*models.NotificationTemplate, error) {
+	texts, exist := defaults[channel][event]
+	if !exist {
+		return nil, fmt.Errorf("通知渠道 %s 没有 %s 事件的模板", channel, event)
+	}
+
+	return &models.NotificationTemplate{
+		Channel: channel,
+		Event:   event,
+		Subject: texts[0],
+		Content: texts[1],
+	}, nil
+}
+
+// 使用执行记录渲染指定的模板
+func Execute(tpl *models.NotificationTemplate, ctx *Context) (subject, content string, err error) {
+	if subject, err = execute("subject", tpl.Subject, ctx); err != nil {
+		return
+	}
+
+	content, err = execute("content", tpl.Content, ctx)
+	return
+}
+
+// 校验模板语法
+func Parse(tpl *models.NotificationTemplate) error {
+	if _, err := template.New("subject").Parse(tpl.Subject); err != nil {
+		return err
+	}
+
+	_, err := template.New("content").Parse(tpl.Content)
+	return err
+}
+
+func execute(name, text string, ctx *Context) (string, error) {
+	tpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tpl.Execute(buf, ctx); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,433 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const VERSION = "3.0.3" // 生成的文档遵循的 OpenAPI 版本
+
+var (
+	pathParameter = regexp.MustCompile(`\{(\w+)\}`)
+	timeType      = reflect.TypeOf(time.Time{})
+	marshaler     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+type (
+	// 控制器的接口说明，Body 和 Result 为示例值，按照 json 和 validate 标签生成模型
+	Operation struct {
+		Method   string
+		Path     string // 相对于分组的路径，路径参数使用 {id} 表示
+		Summary  string
+		Query    []Parameter
+		Body     interface{} // 请求体
+		Result   interface{} // 响应中 data 字段的内容
+		Paged    bool        // 支持 page 和 limit 分页参数，响应包含 meta
+		Produces string      // 响应不是 JSON 时的内容类型
+	}
+	// 查询参数
+	Parameter struct {
+		Name        string
+		Type        string // string、integer、boolean，为空时为 string
+		Description string
+		Required    bool
+	}
+	// 挂载在同一个路径下的一组接口
+	Group struct {
+		Prefix     string
+		Tag        string
+		Public     bool // 不需要认证
+		Operations []Operation
+	}
+	// 文档的基本信息
+	Info struct {
+		Title       string
+		Version     string
+		Description string
+		Server      string // 接口的根路径
+	}
+	// 生成文档时收集结构体模型
+	generator struct {
+		schemas map[string]interface{}
+	}
+)
+
+// 生成 OpenAPI 文档
+func Document(info Info, groups []Group) map[string]interface{} {
+	generator := &generator{schemas: map[string]interface{}{
+		"Response": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"code":     map[string]interface{}{"type": "integer"},
+				"message":  map[string]interface{}{"type": "string"},
+				"data":     map[string]interface{}{},
+				"meta":     map[string]interface{}{"$ref": "#/components/schemas/Meta"},
+				"warnings": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			},
+		},
+		"Meta": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"page":        map[string]interface{}{"type": "integer"},
+				"limit":       map[string]interface{}{"type": "integer"},
+				"total":       map[string]interface{}{"type": "integer"},
+				"total_pages": map[string]interface{}{"type": "integer"},
+			},
+		},
+	}}
+
+	paths := make(map[string]interface{})
+	tags := make([]interface{}, 0, len(groups))
+	for _, group := range groups {
+		tags = append(tags, map[string]interface{}{"name": group.Tag})
+		for _, operation := range group.Operations {
+			path := strings.TrimSuffix(group.Prefix+operation.Path, "/")
+			item, exist := paths[path].(map[string]interface{})
+			if !exist {
+				item = make(map[string]interface{})
+				paths[path] = item
+			}
+			item[strings.ToLower(operation.Method)] = generator.operation(group, operation, path)
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": VERSION,
+		"info": map[string]interface{}{
+			"title":       info.Title,
+			"version":     info.Version,
+			"description": info.Description,
+		},
+		"servers": []interface{}{map[string]interface{}{"url": info.Server}},
+		"tags":    tags,
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": generator.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "登录获取的 JWT 或者 API 令牌",
+				},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"bearer": []string{}}},
+	}
+}
+
+// 生成单个接口的说明
+func (generator *generator) operation(group Group, operation Operation, path string) map[string]interface{} {
+	parameters := make([]interface{}, 0)
+	for _, match := range pathParameter.FindAllStringSubmatch(path, -1) {
+		parameters = append(parameters, map[string]interface{}{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+
+	query := operation.Query
+	if operation.Paged {
+		query = append([]Parameter{
+			{Name: "page", Type: "integer", Description: "页码，从 1 开始"},
+			{Name: "limit", Type: "integer", Description: "每页数量"},
+		}, query...)
+	}
+
+	for _, parameter := range query {
+		kind := parameter.Type
+		if kind == "" {
+			kind = "string"
+		}
+		parameters = append(parameters, map[string]interface{}{
+			"name":        parameter.Name,
+			"in":          "query",
+			"required":    parameter.Required,
+			"description": parameter.Description,
+			"schema":      map[string]interface{}{"type": kind},
+		})
+	}
+
+	result := map[string]interface{}{
+		"tags":        []string{group.Tag},
+		"summary":     operation.Summary,
+		"operationId": strings.ToLower(operation.Method) + pathParameter.ReplaceAllString(strings.Replace(path, "/", "_", -1), "by_$1"),
+		"parameters":  parameters,
+		"responses":   generator.responses(operation),
+	}
+
+	if group.Public {
+		result["security"] = []interface{}{}
+	}
+
+	if operation.Body != nil {
+		result["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": generator.schema(reflect.TypeOf(operation.Body))},
+			},
+		}
+	}
+
+	return result
+}
+
+// 生成接口的响应说明
+func (generator *generator) responses(operation Operation) map[string]interface{} {
+	var success map[string]interface{}
+	if operation.Produces != "" {
+		success = map[string]interface{}{
+			"description": http.StatusText(http.StatusOK),
+			"content": map[string]interface{}{
+				operation.Produces: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+			},
+		}
+	} else {
+		schema := map[string]interface{}{"$ref": "#/components/schemas/Response"}
+		if operation.Result != nil {
+			schema = map[string]interface{}{
+				"allOf": []interface{}{
+					schema,
+					map[string]interface{}{
+						"type":       "object",
+						"properties": map[string]interface{}{"data": generator.schema(reflect.TypeOf(operation.Result))},
+					},
+				},
+			}
+		}
+
+		success = map[string]interface{}{
+			"description": http.StatusText(http.StatusOK),
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schema},
+			},
+		}
+	}
+
+	responses := map[string]interface{}{strconv.Itoa(http.StatusOK): success}
+	failures := []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError}
+	if operation.Body != nil || len(operation.Query) > 0 {
+		failures = append(failures, http.StatusUnprocessableEntity)
+	}
+
+	for _, code := range failures {
+		responses[strconv.Itoa(code)] = map[string]interface{}{
+			"description": http.StatusText(code),
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Response"}},
+			},
+		}
+	}
+
+	return responses
+}
+
+// 按照类型生成模型，结构体放入 components 中通过名称引用
+func (generator *generator) schema(kind reflect.Type) map[string]interface{} {
+	for kind.Kind() == reflect.Ptr {
+		kind = kind.Elem()
+	}
+
+	switch {
+	case kind == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case kind.Kind() == reflect.Struct && (kind.Implements(marshaler) || reflect.PtrTo(kind).Implements(marshaler) || kind.Implements(textMarshaler) || reflect.PtrTo(kind).Implements(textMarshaler)):
+		// 自定义序列化的结构体，例如 utils.Time，按照字符串处理
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch kind.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if kind.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": generator.schema(kind.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": generator.schema(kind.Elem())}
+	case reflect.Struct:
+		name := schemaName(kind)
+		if name == "" {
+			return generator.object(kind)
+		}
+
+		if _, exist := generator.schemas[name]; !exist {
+			// 先占位，避免结构体互相引用时无限递归
+			generator.schemas[name] = map[string]interface{}{}
+			generator.schemas[name] = generator.object(kind)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+
+	return map[string]interface{}{}
+}
+
+// 生成结构体的属性，匿名嵌入的结构体展开到外层
+func (generator *generator) object(kind reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := make([]string, 0)
+
+	for index := 0; index < kind.NumField(); index++ {
+		field := kind.Field(index)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if tag[0] == "-" || field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		if field.Anonymous && tag[0] == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				nested := generator.object(embedded)
+				for name, property := range nested["properties"].(map[string]interface{}) {
+					properties[name] = property
+				}
+				if names, ok := nested["required"].([]string); ok {
+					required = append(required, names...)
+				}
+				continue
+			}
+		}
+
+		name := tag[0]
+		if name == "" {
+			name = field.Name
+		}
+
+		property := generator.schema(field.Type)
+		if constrain(property, field.Tag.Get("validate")) {
+			required = append(required, name)
+		}
+		properties[name] = property
+	}
+
+	result := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		result["required"] = required
+	}
+
+	return result
+}
+
+// 将 validate 标签转换为模型的约束，dive 之后的规则作用于数组元素，返回字段是否必填
+func constrain(property map[string]interface{}, rules string) bool {
+	if rules == "" || rules == "-" {
+		return false
+	}
+
+	required, diving := false, false
+	target := property
+	for _, rule := range strings.Split(rules, ",") {
+		name, value := rule, ""
+		if index := strings.Index(rule, "="); index >= 0 {
+			name, value = rule[:index], rule[index+1:]
+		}
+
+		switch name {
+		case "required":
+			required = required || !diving
+		case "dive":
+			// 只描述数组元素的约束，映射的键和值不再细分
+			items, ok := target["items"].(map[string]interface{})
+			if !ok {
+				return required
+			}
+			target, diving = items, true
+		case "oneof":
+			enum := make([]interface{}, 0)
+			for _, option := range strings.Fields(value) {
+				if target["type"] == "integer" {
+					if number, err := strconv.Atoi(option); err == nil {
+						enum = append(enum, number)
+					}
+					continue
+				}
+				enum = append(enum, option)
+			}
+			target["enum"] = enum
+		case "min", "gte", "max", "lte", "len":
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			lower := name == "min" || name == "gte"
+			upper := name == "max" || name == "lte"
+			bound(target, number, lower || name == "len", upper || name == "len")
+		case "uuid", "uuid4":
+			target["format"] = "uuid"
+		case "email":
+			target["format"] = "email"
+		case "url", "uri":
+			target["format"] = "uri"
+		}
+	}
+
+	return required
+}
+
+// 按照类型设置长度、数量或者取值范围
+func bound(target map[string]interface{}, number float64, lower bool, upper bool) {
+	prefix := ""
+	switch target["type"] {
+	case "string":
+		prefix = "Length"
+	case "array":
+		prefix = "Items"
+	case "object":
+		prefix = "Properties"
+	case "integer", "number":
+		if lower {
+			target["minimum"] = number
+		}
+		if upper {
+			target["maximum"] = number
+		}
+		return
+	default:
+		return
+	}
+
+	if lower {
+		target["min"+prefix] = int(number)
+	}
+	if upper {
+		target["max"+prefix] = int(number)
+	}
+}
+
+// 模型名称使用包名和类型名，避免不同控制器中的同名请求结构冲突
+func schemaName(kind reflect.Type) string {
+	if kind.Name() == "" {
+		return ""
+	}
+
+	path := kind.PkgPath()
+	if index := strings.LastIndex(path, "/"); index >= 0 {
+		path = path[index+1:]
+	}
+
+	if path == "" {
+		return kind.Name()
+	}
+
+	return path + "." + kind.Name()
+}
@@ -0,0 +1,80 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+type sample struct {
+	Id      string            `json:"id" validate:"required,uuid4"`
+	Mode    string            `json:"mode" validate:"omitempty,oneof=all any"`
+	Count   int               `json:"count" validate:"min=0,max=50"`
+	Nodes   []string          `json:"nodes" validate:"omitempty,max=10,dive,uuid4"`
+	Labels  map[string]string `json:"labels"`
+	Ignored string            `json:"-"`
+	Next    *sample           `json:"next"`
+}
+
+func TestSchema(t *testing.T) {
+	generator := &generator{schemas: make(map[string]interface{})}
+	if ref := generator.schema(reflect.TypeOf(&sample{})); ref["$ref"] != "#/components/schemas/openapi.sample" {
+		t.Fatalf("unexpected reference %v", ref)
+	}
+
+	schema := generator.schemas["openapi.sample"].(map[string]interface{})
+	properties := schema["properties"].(map[string]interface{})
+
+	if required := schema["required"].([]string); len(required) != 1 || required[0] != "id" {
+		t.Errorf("unexpected required fields %v", required)
+	}
+
+	if _, exist := properties["Ignored"]; exist {
+		t.Error("expected fields without a json name to be skipped")
+	}
+
+	if id := properties["id"].(map[string]interface{}); id["format"] != "uuid" {
+		t.Errorf("unexpected id schema %v", id)
+	}
+
+	if mode := properties["mode"].(map[string]interface{}); !reflect.DeepEqual(mode["enum"], []interface{}{"all", "any"}) {
+		t.Errorf("unexpected mode schema %v", mode)
+	}
+
+	if count := properties["count"].(map[string]interface{}); count["minimum"] != 0.0 || count["maximum"] != 50.0 {
+		t.Errorf("unexpected count schema %v", count)
+	}
+
+	nodes := properties["nodes"].(map[string]interface{})
+	if nodes["maxItems"] != 10 || nodes["items"].(map[string]interface{})["format"] != "uuid" {
+		t.Errorf("unexpected nodes schema %v", nodes)
+	}
+
+	if next := properties["next"].(map[string]interface{}); next["$ref"] != "#/components/schemas/openapi.sample" {
+		t.Errorf("unexpected recursive schema %v", next)
+	}
+}
+
+func TestDocument(t *testing.T) {
+	document := Document(Info{Title: "ECTS", Version: "test", Server: "/api"}, []Group{{
+		Prefix: "/pipeline",
+		Tag:    "pipeline",
+		Operations: []Operation{
+			{Method: "GET", Path: "", Summary: "list", Paged: true},
+			{Method: "POST", Path: "/{id}/run", Summary: "run", Body: sample{}},
+		},
+	}})
+
+	paths := document["paths"].(map[string]interface{})
+	run, exist := paths["/pipeline/{id}/run"].(map[string]interface{})["post"].(map[string]interface{})
+	if !exist {
+		t.Fatalf("missing operation in %v", paths)
+	}
+
+	if parameters := run["parameters"].([]interface{}); len(parameters) != 1 || parameters[0].(map[string]interface{})["in"] != "path" {
+		t.Errorf("unexpected parameters %v", parameters)
+	}
+
+	if _, exist := paths["/pipeline"].(map[string]interface{})["get"]; !exist {
+		t.Errorf("missing list operation in %v", paths)
+	}
+}
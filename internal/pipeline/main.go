@@ -5,36 +5,94 @@ import (
 	"encoding/json"
 	"github.com/betterde/ects/config"
 	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/internal/metrics"
 	"github.com/betterde/ects/internal/scheduler"
 	"github.com/betterde/ects/models"
 	"github.com/coreos/etcd/clientv3"
 	"github.com/coreos/etcd/mvcc/mvccpb"
 	"log"
-	"time"
 )
 
+// 监听流水线的变更并更新调度计划，监听中断或停滞时重新加载流水线后再次监听
 func WatchPipelines(local string) {
-	var curRevision int64 = 0
+	// 维护中的节点重启后先进入维护状态，再加载调度计划，避免错误地执行流水线
+	if node, err := models.Repo.Node(local); err != nil {
+		log.Println(err)
+	} else if node.Drained() {
+		scheduler.Instance.DispatchEvent(&scheduler.Event{Type: scheduler.DRAIN, Running: true})
+	}
+
+	known := make(map[string]bool)
+	startup := true
+	backoff := &discover.Backoff{}
+	for {
+		backoff.Start()
+		revision, err := load(local, known, startup)
+		if err == nil {
+			startup = false
+			err = watch(local, known, revision)
+		}
+		if err != nil {
+			log.Println(err)
+		}
+
+		// ETCD 不可用时逐渐延长等待时间
+		backoff.Wait(context.Background())
+	}
+}
+
+// 加载全部流水线并返回加载时的版本，known 记录已经加载的流水线，用于移除重建监听期间被删除的流水线
+func load(local string, known map[string]bool, startup bool) (int64, error) {
 	rangeResp, err := discover.Client.Get(context.TODO(), config.Conf.Etcd.Pipeline, clientv3.WithPrefix())
 	if err != nil {
-		panic(err)
+		return 0, err
 	}
-	curRevision = rangeResp.Header.Revision + 1
 
+	loaded := make(map[string]bool)
 	for _, obj := range rangeResp.Kvs {
 		var pipeline models.Pipeline
 		if err := json.Unmarshal(obj.Value, &pipeline); err != nil {
 			log.Println(err)
 		}
+		loaded[pipeline.Id] = true
 
-		scheduler.Instance.DispatchEvent(&scheduler.Event{
-			Type:     scheduler.PUT,
-			Pipeline: &pipeline,
-		})
+		// 启动时只需要加入调度计划，重建监听时还需要移除不再由当前节点执行的流水线
+		if event := dispatch(&pipeline, local); event.Type == scheduler.PUT {
+			event.Startup = startup
+			scheduler.Instance.DispatchEvent(event)
+		} else if !startup {
+			scheduler.Instance.DispatchEvent(event)
+		}
+	}
+
+	for id := range known {
+		if !loaded[id] {
+			scheduler.Instance.DispatchEvent(&scheduler.Event{
+				Type:     scheduler.DEL,
+				Pipeline: &models.Pipeline{Id: id},
+			})
+			delete(known, id)
+		}
 	}
+	for id := range loaded {
+		known[id] = true
+	}
+
+	return rangeResp.Header.Revision, nil
+}
 
-	watchChan := discover.Client.Watch(context.TODO(), config.Conf.Etcd.Pipeline, clientv3.WithPrefix(), clientv3.WithRev(curRevision), clientv3.WithPrevKV())
+// 从指定版本之后开始监听流水线的变更
+func watch(local string, known map[string]bool, revision int64) error {
+	ctx, guard := discover.Guarded(context.Background(), "pipelines")
+	defer guard.Stop()
+
+	watchChan := discover.Client.Watch(ctx, config.Conf.Etcd.Pipeline, clientv3.WithPrefix(), clientv3.WithRev(revision+1), clientv3.WithPrevKV(), clientv3.WithProgressNotify())
 	for watchResp := range watchChan {
+		guard.Touch()
+		if err := discover.Interrupted("pipelines", &watchResp); err != nil {
+			return err
+		}
+		metrics.Watched("pipelines", &watchResp)
 		for _, event := range watchResp.Events {
 			var pipeline models.Pipeline
 			switch event.Type {
@@ -43,54 +101,47 @@ func WatchPipelines(local string) {
 					log.Println(err)
 				}
 
-				for _, node := range pipeline.Nodes {
-					if node == local {
-						scheduler.Instance.DispatchEvent(&scheduler.Event{
-							Type:     scheduler.PUT,
-							Pipeline: &pipeline,
-						})
-					}
-				}
+				known[pipeline.Id] = true
+				scheduler.Instance.DispatchEvent(dispatch(&pipeline, local))
 			case mvccpb.DELETE:
 				if err := json.Unmarshal(event.PrevKv.Value, &pipeline); err != nil {
 					log.Println(err)
 				}
+
+				delete(known, pipeline.Id)
 				scheduler.Instance.DispatchEvent(&scheduler.Event{
 					Type:     scheduler.DEL,
 					Pipeline: &pipeline,
 				})
 			}
 		}
-
-		time.Sleep(1 * time.Second)
 	}
-}
-
-func WatchKiller() {
-	var curRevision int64 = 0
 
-	for {
-		rangeResp, err := discover.Client.Get(context.TODO(), config.Conf.Etcd.Pipeline, clientv3.WithPrefix())
+	// 停滞检测取消了监听或者客户端已关闭
+	return discover.ErrWatchClosed
+}
 
-		if err != nil {
-			continue
+// 根据当前节点是流水线的执行节点还是备用节点生成调度事件，都不是时从调度计划中移除
+func dispatch(pipeline *models.Pipeline, local string) *scheduler.Event {
+	for _, node := range pipeline.Nodes {
+		if node == local {
+			return &scheduler.Event{
+				Type:     scheduler.PUT,
+				Pipeline: pipeline,
+			}
 		}
-		curRevision = rangeResp.Header.Revision + 1
-		break
 	}
 
-	watchChan := discover.Client.Watch(context.TODO(), "", clientv3.WithPrefix(), clientv3.WithRev(curRevision))
-	for watchResp := range watchChan {
-		for _, event := range watchResp.Events {
-			var pipeline models.Pipeline
-			if err := json.Unmarshal(event.Kv.Value, &pipeline); err != nil {
-				log.Println(err)
-			}
-
-			switch event.Type {
-			case mvccpb.PUT:
-			case mvccpb.DELETE:
-			}
+	if pipeline.Standby == local {
+		return &scheduler.Event{
+			Type:     scheduler.PUT,
+			Pipeline: pipeline,
+			Standby:  true,
 		}
 	}
+
+	return &scheduler.Event{
+		Type:     scheduler.DEL,
+		Pipeline: pipeline,
+	}
 }
@@ -0,0 +1,280 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/internal/metrics"
+	"github.com/betterde/ects/models"
+	"github.com/betterde/ects/services"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/go-xorm/builder"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DRIFTMISSING = "missing"     // 流水线已绑定节点或待同步，但 ETCD 中不存在
+	DRIFTSTALE   = "stale"       // ETCD 中的流水线与数据库不一致
+	DRIFTORPHAN  = "orphan"      // ETCD 中的流水线在数据库中不存在
+	DRIFTNODE    = "node_status" // 节点的在线状态与注册中心不一致
+)
+
+type (
+	// 单次对账发现的差异数量和修复数量
+	Result struct {
+		Drift    map[string]int `json:"drift"`
+		Repaired int            `json:"repaired"`
+	}
+	// 参与调度的流水线字段，用于比较 ETCD 和数据库中的流水线是否一致
+	fingerprint struct {
+		Name        string                      `json:"name"`
+		ProjectId   string                      `json:"project_id"`
+		Spec        string                      `json:"spec"`
+		Timezone    string                      `json:"timezone"`
+		DST         string                      `json:"dst_policy"`
+		Status      int                         `json:"status"`
+		Finished    string                      `json:"finished"`
+		Failed      string                      `json:"failed"`
+		Standby     string                      `json:"standby"`
+		Overlap     int                         `json:"overlap"`
+		Concurrency string                      `json:"concurrency_policy"`
+		Singleton   int                         `json:"singleton"`
+		Misfire     string                      `json:"misfire"`
+		Policy      string                      `json:"policy"`
+		Critical    bool                        `json:"critical"`
+		Retries     int                         `json:"retries"`
+		Timeout     int                         `json:"timeout"`
+		Image       string                      `json:"image"`
+		Variables   models.Variables            `json:"variables"`
+		Nodes       []string                    `json:"nodes"`
+		Steps       []*models.PipelineTaskPivot `json:"steps"`
+	}
+)
+
+// 定期比较 ETCD 和数据库中的流水线和节点状态，修复不一致的数据
+func Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// 多个主节点同时运行时只由领导者对账
+			if !discover.Leading() {
+				continue
+			}
+
+			result, err := Reconcile()
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			if result.Repaired > 0 {
+				log.Printf("Reconciler repaired %d divergences: %v\n", result.Repaired, result.Drift)
+			}
+		}
+	}
+}
+
+// 执行一次对账，以数据库为准修复 ETCD 中的流水线，以注册中心为准修复节点的在线状态
+func Reconcile() (*Result, error) {
+	result := &Result{
+		Drift: map[string]int{DRIFTMISSING: 0, DRIFTSTALE: 0, DRIFTORPHAN: 0, DRIFTNODE: 0},
+	}
+
+	if err := pipelines(result); err != nil {
+		return nil, err
+	}
+
+	if err := nodes(result); err != nil {
+		return nil, err
+	}
+
+	for kind, count := range result.Drift {
+		metrics.ReconcileDrift.WithLabelValues(kind).Set(float64(count))
+	}
+	metrics.ReconcileLast.SetToCurrentTime()
+
+	return result, nil
+}
+
+// 对比流水线
+func pipelines(result *Result) error {
+	rows := make(map[string]models.Pipeline)
+	if err := models.Engine.Find(&rows); err != nil {
+		return err
+	}
+
+	bound := make([]string, 0)
+	if err := models.Engine.Table(new(models.PipelineNodePivot)).Distinct("pipeline_id").Cols("pipeline_id").Find(&bound); err != nil {
+		return err
+	}
+
+	resp, err := discover.Client.Get(context.TODO(), config.Conf.Etcd.Pipeline, clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+
+	stored := make(map[string][]byte, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		key := string(kv.Key)
+		id := key[strings.LastIndex(key, "/")+1:]
+		if _, exist := rows[id]; !exist {
+			result.Drift[DRIFTORPHAN]++
+			if err := discover.DeletePipeline(id); err != nil {
+				log.Println(err)
+				continue
+			}
+			result.repaired(DRIFTORPHAN)
+			continue
+		}
+		stored[id] = kv.Value
+	}
+
+	expected := make(map[string]bool, len(bound))
+	for _, id := range bound {
+		expected[id] = true
+	}
+
+	for id, row := range rows {
+		pipeline := row
+		value, exist := stored[id]
+		if !exist {
+			// 未绑定节点且已同步的流水线不需要下发
+			if !expected[id] && pipeline.Synced == models.SYNCED {
+				continue
+			}
+			result.Drift[DRIFTMISSING]++
+			result.sync(&pipeline, DRIFTMISSING)
+			continue
+		}
+
+		current := &models.Pipeline{}
+		if err := json.Unmarshal(value, current); err != nil {
+			log.Println(err)
+		}
+
+		// Build 会修改流水线，使用副本计算期望的数据
+		desired := pipeline
+		if _, err := desired.Build(); err != nil {
+			return err
+		}
+
+		if pipeline.Synced == models.SYNCPENDING || !equal(current, &desired) {
+			result.Drift[DRIFTSTALE]++
+			result.sync(&pipeline, DRIFTSTALE)
+		}
+	}
+
+	return nil
+}
+
+// 对比节点的在线状态，维护中的节点保持不变
+func nodes(result *Result) error {
+	resp, err := discover.Client.Get(context.TODO(), config.Conf.Etcd.Service, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return err
+	}
+
+	registered := make(map[string]bool, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		key := string(kv.Key)
+		registered[key[strings.LastIndex(key, "/")+1:]] = true
+	}
+
+	rows := make([]models.Node, 0)
+	if err := models.Engine.Cols("id", "status").Where(builder.Neq{"status": models.DRAINED}).Find(&rows); err != nil {
+		return err
+	}
+
+	for _, node := range rows {
+		status := models.OFFLINE
+		if registered[node.Id] {
+			status = models.ONLINE
+		}
+
+		if node.Status == status {
+			continue
+		}
+
+		result.Drift[DRIFTNODE]++
+		// 仅在状态未被其他请求修改时更新
+		if _, err := models.Engine.Table(new(models.Node)).Where(builder.Eq{"id": node.Id, "status": node.Status}).Update(map[string]interface{}{"status": status}); err != nil {
+			log.Println(err)
+			continue
+		}
+		result.repaired(DRIFTNODE)
+	}
+
+	return nil
+}
+
+// 重新同步流水线
+func (result *Result) sync(pipeline *models.Pipeline, kind string) {
+	if err := services.SyncPipeline(pipeline); err != nil {
+		log.Printf("Failed to reconcile pipeline %s: %s\n", pipeline.Id, err)
+		return
+	}
+	result.repaired(kind)
+}
+
+func (result *Result) repaired(kind string) {
+	result.Repaired++
+	metrics.ReconcileRepairs.WithLabelValues(kind).Inc()
+}
+
+// 比较参与调度的字段，节点和步骤的顺序不影响结果
+func equal(current, desired *models.Pipeline) bool {
+	left, err := json.Marshal(fingerprintOf(current))
+	if err != nil {
+		return false
+	}
+
+	right, err := json.Marshal(fingerprintOf(desired))
+	if err != nil {
+		return false
+	}
+
+	return string(left) == string(right)
+}
+
+func fingerprintOf(pipeline *models.Pipeline) *fingerprint {
+	nodes := append([]string{}, pipeline.Nodes...)
+	sort.Strings(nodes)
+
+	steps := append([]*models.PipelineTaskPivot{}, pipeline.Steps...)
+	sort.Slice(steps, func(i, j int) bool {
+		return steps[i].Id < steps[j].Id
+	})
+
+	return &fingerprint{
+		Name:        pipeline.Name,
+		ProjectId:   pipeline.ProjectId,
+		Spec:        pipeline.Spec,
+		Timezone:    pipeline.Timezone,
+		DST:         pipeline.DST,
+		Status:      pipeline.Status,
+		Finished:    pipeline.Finished,
+		Failed:      pipeline.Failed,
+		Standby:     pipeline.Standby,
+		Overlap:     pipeline.Overlap,
+		Concurrency: pipeline.Concurrency,
+		Singleton:   pipeline.Singleton,
+		Misfire:     pipeline.Misfire,
+		Policy:      pipeline.Policy,
+		Critical:    pipeline.Critical,
+		Retries:     pipeline.Retries,
+		Timeout:     pipeline.Timeout,
+		Image:       pipeline.Image,
+		Variables:   pipeline.Variables,
+		Nodes:       nodes,
+		Steps:       steps,
+	}
+}
@@ -0,0 +1,174 @@
+package request
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/betterde/ects/internal/message"
+	"github.com/betterde/ects/internal/response"
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+	"gopkg.in/go-playground/validator.v9"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+const MAXBODY = 1 << 20 // 请求体的最大字节数
+
+type (
+	// 单个字段的校验错误，Field 为 JSON 中的字段路径
+	FieldError struct {
+		Field   string `json:"field"`
+		Rule    string `json:"rule"`
+		Message string `json:"message"`
+	}
+)
+
+var validate = validator.New()
+
+func init() {
+	// 校验错误中使用 JSON 字段名
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "" || name == "-" {
+			return field.Name
+		}
+		return name
+	})
+}
+
+// 读取 JSON 请求体，统一 UUID 的格式后校验，失败时返回包含字段错误的 422 响应
+func Bind(ctx iris.Context, module string, target interface{}) (mvc.Response, bool) {
+	if fields := Decode(ctx, target); len(fields) > 0 {
+		return response.ValidationFailed(fields[0].Message, fields), false
+	}
+
+	return Validate(module, target)
+}
+
+// 按照字段的校验规则统一 UUID 的格式并校验
+func Validate(module string, target interface{}) (mvc.Response, bool) {
+	normalize(reflect.ValueOf(target))
+
+	if fields := check(module, target); len(fields) > 0 {
+		return response.ValidationFailed(fields[0].Message, fields), false
+	}
+
+	return mvc.Response{}, true
+}
+
+// 读取 JSON 请求体，拒绝未知字段和超过大小限制的请求体
+func Decode(ctx iris.Context, target interface{}) []*FieldError {
+	body := http.MaxBytesReader(ctx.ResponseWriter(), ctx.Request().Body, MAXBODY)
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(target)
+	if err == nil && decoder.More() {
+		err = fmt.Errorf("请求体只能包含一个 JSON 对象")
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	return []*FieldError{decodeError(err)}
+}
+
+// 将解析 JSON 的错误转换为字段错误
+func decodeError(err error) *FieldError {
+	switch value := err.(type) {
+	case *json.SyntaxError:
+		return &FieldError{Rule: "json", Message: fmt.Sprintf("请求体不是有效的 JSON：%s", value.Error())}
+	case *json.UnmarshalTypeError:
+		return &FieldError{Field: value.Field, Rule: "type", Message: fmt.Sprintf("字段 %s 的类型应为 %s", value.Field, value.Type.String())}
+	}
+
+	switch {
+	case err == io.EOF:
+		return &FieldError{Rule: "required", Message: "请求体不能为空"}
+	case err == io.ErrUnexpectedEOF:
+		return &FieldError{Rule: "json", Message: "请求体不是完整的 JSON"}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &FieldError{Field: field, Rule: "unknown", Message: fmt.Sprintf("不支持的字段 %s", field)}
+	case err.Error() == "http: request body too large":
+		return &FieldError{Rule: "max_body", Message: fmt.Sprintf("请求体不能超过 %d 字节", MAXBODY)}
+	}
+
+	return &FieldError{Rule: "json", Message: err.Error()}
+}
+
+// 校验结构体，返回全部字段错误
+func check(module string, target interface{}) []*FieldError {
+	err := validate.Struct(target)
+	if err == nil {
+		return nil
+	}
+
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return []*FieldError{{Rule: "invalid", Message: err.Error()}}
+	}
+
+	fields := make([]*FieldError, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		// 去掉命名空间中的结构体名称
+		field := fieldError.Namespace()
+		if index := strings.Index(field, "."); index >= 0 {
+			field = field[index+1:]
+		}
+
+		text := message.Lookup(module, fieldError.StructField(), fieldError.Tag())
+		if text == "" {
+			text = fmt.Sprintf("字段 %s 未通过 %s 校验", field, fieldError.Tag())
+		}
+
+		fields = append(fields, &FieldError{Field: field, Rule: fieldError.Tag(), Message: text})
+	}
+
+	return fields
+}
+
+// 去除 UUID 两端的空白并转换为小写，只处理校验规则中包含 uuid 的字段
+func normalize(value reflect.Value) {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		for index := 0; index < value.NumField(); index++ {
+			field := value.Field(index)
+			if !field.CanSet() {
+				continue
+			}
+
+			if strings.Contains(value.Type().Field(index).Tag.Get("validate"), "uuid") {
+				uuids(field)
+				continue
+			}
+			normalize(field)
+		}
+	case reflect.Slice, reflect.Array:
+		for index := 0; index < value.Len(); index++ {
+			normalize(value.Index(index))
+		}
+	}
+}
+
+// 统一字符串或字符串切片中 UUID 的格式
+func uuids(value reflect.Value) {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(strings.ToLower(strings.TrimSpace(value.String())))
+	case reflect.Slice:
+		for index := 0; index < value.Len(); index++ {
+			uuids(value.Index(index))
+		}
+	}
+}
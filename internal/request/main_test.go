@@ -0,0 +1,61 @@
+package request
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type sample struct {
+	PipelineId string   `json:"pipeline_id" validate:"required,uuid4"`
+	NodesId    []string `json:"nodes_id" validate:"omitempty,dive,uuid4"`
+	Name       string   `json:"name" validate:"required"`
+}
+
+func TestNormalize(t *testing.T) {
+	params := &sample{
+		PipelineId: " 9C4E1F0A-3B2D-4E5F-8A6B-7C8D9E0F1A2B ",
+		NodesId:    []string{"9C4E1F0A-3B2D-4E5F-8A6B-7C8D9E0F1A2B"},
+		Name:       " Keep ",
+	}
+	normalize(reflect.ValueOf(params))
+
+	if params.PipelineId != "9c4e1f0a-3b2d-4e5f-8a6b-7c8d9e0f1a2b" || params.NodesId[0] != params.PipelineId {
+		t.Errorf("expected normalized uuids, got %q and %v", params.PipelineId, params.NodesId)
+	}
+
+	if params.Name != " Keep " {
+		t.Errorf("expected fields without uuid rules to be untouched, got %q", params.Name)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	fields := check("pipeline", &sample{PipelineId: "invalid", NodesId: []string{"invalid"}})
+	if len(fields) != 3 {
+		t.Fatalf("expected 3 field errors, got %d", len(fields))
+	}
+
+	if fields[0].Field != "pipeline_id" || fields[0].Rule != "uuid4" {
+		t.Errorf("expected the json field name and rule, got %+v", fields[0])
+	}
+
+	if fields[1].Field != "nodes_id[0]" {
+		t.Errorf("expected the path of the slice element, got %q", fields[1].Field)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	decoder := json.NewDecoder(strings.NewReader(`{"name": "a", "extra": 1}`))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&sample{})
+
+	if field := decodeError(err); field.Rule != "unknown" || field.Field != "extra" {
+		t.Errorf("expected an unknown field error, got %+v", field)
+	}
+
+	err = json.Unmarshal([]byte(`{"name": 1}`), &sample{})
+	if field := decodeError(err); field.Rule != "type" || field.Field != "name" {
+		t.Errorf("expected a type error, got %+v", field)
+	}
+}
@@ -0,0 +1,68 @@
+package response
+
+import (
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/mvc"
+)
+
+// 稳定的错误码，客户端根据错误码判断错误类型，不要匹配本地化的错误信息
+const (
+	CODEBADREQUEST         = "BAD_REQUEST"
+	CODEUNAUTHENTICATED    = "UNAUTHENTICATED"
+	CODEFORBIDDEN          = "FORBIDDEN"
+	CODENOTFOUND           = "NOT_FOUND"
+	CODECONFLICT           = "CONFLICT"
+	CODEVALIDATION         = "VALIDATION_FAILED"
+	CODETOOMANYREQUESTS    = "TOO_MANY_REQUESTS"
+	CODEINTERNAL           = "INTERNAL_ERROR"
+	CODEUNAVAILABLE        = "SERVICE_UNAVAILABLE"
+	CODEPIPELINENOTFOUND   = "PIPELINE_NOT_FOUND"
+	CODEPROJECTNOTFOUND    = "PROJECT_NOT_FOUND"
+	CODETASKNOTFOUND       = "TASK_NOT_FOUND"
+	CODENODENOTFOUND       = "NODE_NOT_FOUND"
+	CODERUNNOTFOUND        = "RUN_NOT_FOUND"
+	CODENODEOFFLINE        = "NODE_OFFLINE"
+	CODECONTROLUNAVAILABLE = "CONTROL_UNAVAILABLE"
+	CODEETCDUNAVAILABLE    = "ETCD_UNAVAILABLE"
+	CODEUPSTREAM           = "UPSTREAM_UNAVAILABLE"
+	CODEPASSWORDCHANGE     = "PASSWORD_CHANGE_REQUIRED"
+	CODEBUDGETEXCEEDED     = "BUDGET_EXCEEDED"
+)
+
+// HTTP 状态码对应的默认错误码，成功响应没有错误码
+func codeOf(status int) string {
+	switch {
+	case status < iris.StatusBadRequest:
+		return ""
+	case status == iris.StatusUnauthorized:
+		return CODEUNAUTHENTICATED
+	case status == iris.StatusForbidden:
+		return CODEFORBIDDEN
+	case status == iris.StatusNotFound:
+		return CODENOTFOUND
+	case status == iris.StatusConflict:
+		return CODECONFLICT
+	case status == iris.StatusUnprocessableEntity:
+		return CODEVALIDATION
+	case status == iris.StatusTooManyRequests:
+		return CODETOOMANYREQUESTS
+	case status == iris.StatusBadGateway:
+		return CODEUPSTREAM
+	case status == iris.StatusServiceUnavailable:
+		return CODEUNAVAILABLE
+	case status < iris.StatusInternalServerError:
+		return CODEBADREQUEST
+	default:
+		return CODEINTERNAL
+	}
+}
+
+// 使用更具体的错误码替换响应的默认错误码
+func Coded(code string, resp mvc.Response) mvc.Response {
+	if result, ok := resp.Object.(Response); ok {
+		result.Error = code
+		resp.Object = result
+	}
+
+	return resp
+}
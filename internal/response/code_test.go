@@ -0,0 +1,35 @@
+package response
+
+import (
+	"errors"
+	"testing"
+)
+
+type reasoned struct{}
+
+func (reasoned) Error() string  { return "流水线不存在" }
+func (reasoned) Status() int    { return 404 }
+func (reasoned) Reason() string { return CODEPIPELINENOTFOUND }
+
+func TestErrorCode(t *testing.T) {
+	cases := []struct {
+		resp     Response
+		expected string
+	}{
+		{Success("", Payload{}).Object.(Response), ""},
+		{NotFound("").Object.(Response), CODENOTFOUND},
+		{ValidationError("").Object.(Response), CODEVALIDATION},
+		{Send(400, "", nil).Object.(Response), CODEBADREQUEST},
+		{Send(409, "", nil).Object.(Response), CODECONFLICT},
+		{BadGateway("", "", errors.New("")).Object.(Response), CODEETCDUNAVAILABLE},
+		{Coded(CODENODEOFFLINE, Send(400, "", nil)).Object.(Response), CODENODEOFFLINE},
+		{Error("", reasoned{}).Object.(Response), CODEPIPELINENOTFOUND},
+		{Error("", errors.New("")).Object.(Response), CODEINTERNAL},
+	}
+
+	for index, item := range cases {
+		if item.resp.Error != item.expected {
+			t.Errorf("case %d: expected %q, got %q", index, item.expected, item.resp.Error)
+		}
+	}
+}
@@ -8,15 +8,21 @@ import (
 
 type (
 	Meta struct {
-		Page  int `json:"page"`
-		Limit int `json:"limit"`
-		Total int `json:"total"`
+		Page       int    `json:"page"`
+		Limit      int    `json:"limit"`
+		Total      int    `json:"total"`
+		TotalPages int    `json:"total_pages"`
+		Next       int    `json:"next,omitempty"`
+		Prev       int    `json:"prev,omitempty"`
+		Links      *Links `json:"links,omitempty"`
 	}
 	Response struct {
-		Code    int         `json:"code"`
-		Message string      `json:"message"`
-		Data    interface{} `json:"data"`
-		Meta    *Meta       `json:"meta,omitempty"`
+		Code     int         `json:"code"`
+		Message  string      `json:"message"`
+		Data     interface{} `json:"data"`
+		Meta     *Meta       `json:"meta,omitempty"`
+		Warnings []string    `json:"warnings,omitempty"`
+		Error    string      `json:"error,omitempty"`
 	}
 	Payload map[string]interface{}
 )
@@ -24,26 +30,24 @@ type (
 // 发送成功响应
 func Success(message string, payload map[string]interface{}) mvc.Response {
 	data := payload["data"]
-	meta, ok := payload["meta"]
-	if ok {
-		return mvc.Response{
-			Code: iris.StatusOK,
-			Object: Response{
-				Code:    iris.StatusOK,
-				Message: message,
-				Data:    data,
-				Meta:    reflect.ValueOf(meta).Interface().(*Meta),
-			},
-		}
+	result := Response{
+		Code:    iris.StatusOK,
+		Message: message,
+		Data:    data,
+	}
+
+	if meta, ok := payload["meta"]; ok {
+		result.Meta = reflect.ValueOf(meta).Interface().(*Meta)
+	}
+
+	// 不影响请求结果的警告信息
+	if warnings, ok := payload["warnings"]; ok {
+		result.Warnings = warnings.([]string)
 	}
 
 	return mvc.Response{
-		Code: iris.StatusOK,
-		Object: Response{
-			Code:    iris.StatusOK,
-			Message: message,
-			Data:    data,
-		},
+		Code:   iris.StatusOK,
+		Object: result,
 	}
 }
 
@@ -54,6 +58,7 @@ func UnAuthenticated(message string) mvc.Response {
 		Object: Response{
 			Code:    iris.StatusUnauthorized,
 			Message: message,
+			Error:   codeOf(iris.StatusUnauthorized),
 			Data:    make(map[string]interface{}),
 		},
 	}
@@ -65,6 +70,7 @@ func NotFound(message string) mvc.Response {
 		Object: Response{
 			Code:    iris.StatusNotFound,
 			Message: message,
+			Error:   codeOf(iris.StatusNotFound),
 			Data:    make(map[string]interface{}),
 		},
 	}
@@ -76,28 +82,75 @@ func ValidationError(message string) mvc.Response {
 		Object: Response{
 			Code:    iris.StatusUnprocessableEntity,
 			Message: message,
+			Error:   codeOf(iris.StatusUnprocessableEntity),
 			Data:    make(map[string]interface{}),
 		},
 	}
 }
 
+// 请求参数未通过校验，返回全部字段错误
+func ValidationFailed(message string, errors interface{}) mvc.Response {
+	return mvc.Response{
+		Code: iris.StatusUnprocessableEntity,
+		Object: Response{
+			Code:    iris.StatusUnprocessableEntity,
+			Message: message,
+			Error:   codeOf(iris.StatusUnprocessableEntity),
+			Data: map[string]interface{}{
+				"errors": errors,
+			},
+		},
+	}
+}
+
 func InternalServerError(message string, err error) mvc.Response {
 	return mvc.Response{
 		Code: iris.StatusInternalServerError,
 		Object: Response{
 			Code:    iris.StatusInternalServerError,
 			Message: message,
+			Error:   codeOf(iris.StatusInternalServerError),
 			Data:    err,
 		},
 	}
 }
 
+// 数据已保存但同步到 ETCD 失败，返回错误原因和补救方法，其他上游服务不可用时使用 Coded 替换错误码
+func BadGateway(message string, hint string, err error) mvc.Response {
+	return mvc.Response{
+		Code: iris.StatusBadGateway,
+		Object: Response{
+			Code:    iris.StatusBadGateway,
+			Message: message,
+			Error:   CODEETCDUNAVAILABLE,
+			Data: map[string]string{
+				"error": err.Error(),
+				"hint":  hint,
+			},
+		},
+	}
+}
+
+// 按照错误声明的状态码和错误码返回错误，例如权限检查失败，未声明状态码时视为服务器内部错误
+func Error(message string, err error) mvc.Response {
+	if coded, ok := err.(interface{ Status() int }); ok {
+		resp := Send(coded.Status(), err.Error(), make(map[string]interface{}))
+		if reason, ok := err.(interface{ Reason() string }); ok && reason.Reason() != "" {
+			return Coded(reason.Reason(), resp)
+		}
+		return resp
+	}
+
+	return InternalServerError(message, err)
+}
+
 func Send(code int, message string, data interface{}) mvc.Response {
 	return mvc.Response{
 		Code: code,
 		Object: Response{
 			Code:    code,
 			Message: message,
+			Error:   codeOf(code),
 			Data:    data,
 		},
 	}
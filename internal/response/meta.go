@@ -0,0 +1,78 @@
+package response
+
+import (
+	"github.com/kataras/iris"
+	"net/url"
+	"strconv"
+)
+
+type (
+	Links struct {
+		Self  string `json:"self"`
+		First string `json:"first"`
+		Last  string `json:"last"`
+		Next  string `json:"next,omitempty"`
+		Prev  string `json:"prev,omitempty"`
+	}
+)
+
+// 根据分页参数和总数生成分页信息
+func NewMeta(ctx iris.Context, page, limit int, total int64) *Meta {
+	meta := &Meta{
+		Page:  page,
+		Limit: limit,
+		Total: int(total),
+	}
+
+	if limit > 0 {
+		meta.TotalPages = int((total + int64(limit) - 1) / int64(limit))
+	}
+
+	if page < meta.TotalPages {
+		meta.Next = page + 1
+	}
+
+	if page > 1 {
+		meta.Prev = page - 1
+		// 页码超出范围时指向最后一页
+		if meta.Prev > meta.TotalPages && meta.TotalPages > 0 {
+			meta.Prev = meta.TotalPages
+		}
+	}
+
+	meta.Links = links(ctx.Request().URL, meta)
+	return meta
+}
+
+// 生成当前请求对应的分页链接，保留其他查询参数
+func links(origin *url.URL, meta *Meta) *Links {
+	link := func(page int) string {
+		u := *origin
+		query := u.Query()
+		query.Set("page", strconv.Itoa(page))
+		query.Set("limit", strconv.Itoa(meta.Limit))
+		u.RawQuery = query.Encode()
+		return u.RequestURI()
+	}
+
+	last := meta.TotalPages
+	if last < 1 {
+		last = 1
+	}
+
+	result := &Links{
+		Self:  link(meta.Page),
+		First: link(1),
+		Last:  link(last),
+	}
+
+	if meta.Next > 0 {
+		result.Next = link(meta.Next)
+	}
+
+	if meta.Prev > 0 {
+		result.Prev = link(meta.Prev)
+	}
+
+	return result
+}
@@ -0,0 +1,85 @@
+package rungroup
+
+import (
+	"context"
+	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/internal/notify"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"log"
+	"time"
+)
+
+// 定期统计尚未结束的执行组，组内的执行全部结束后保存统计结果并发送汇总通知，只在领导者上执行
+func Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !discover.Leading() {
+				continue
+			}
+
+			if settled, err := Settle(time.Now()); err != nil {
+				log.Println(err)
+			} else if settled > 0 {
+				log.Printf("%d run groups finished\n", settled)
+			}
+		}
+	}
+}
+
+// 结束没有正在执行和等待执行的执行组，返回结束的数量
+func Settle(now time.Time) (int, error) {
+	groups := make([]*models.RunGroup, 0)
+	if err := models.Engine.Where(builder.IsNull{"finish_with"}).Find(&groups); err != nil {
+		return 0, err
+	}
+
+	settled := 0
+	for _, group := range groups {
+		if err := group.Tally(); err != nil {
+			return settled, err
+		}
+
+		if !group.Settled(now) {
+			continue
+		}
+
+		finished, err := group.Finish(now)
+		if err != nil {
+			return settled, err
+		}
+
+		if !finished {
+			continue
+		}
+
+		settled++
+		summarize(group)
+	}
+
+	return settled, nil
+}
+
+// 发送执行组的汇总通知
+func summarize(group *models.RunGroup) {
+	log.Printf("Run group %s of pipeline %s %s: %d succeeded, %d failed, %d not started\n", group.Id, group.PipelineId, group.Status, group.Succeeded, group.Failed, group.Pending)
+
+	pipeline := &models.Pipeline{}
+	exist, err := models.Engine.Id(group.PipelineId).Get(pipeline)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if !exist {
+		return
+	}
+
+	notify.DeliverGroup(&notify.Context{Pipeline: pipeline, Group: group})
+}
@@ -0,0 +1,22 @@
+package sandbox
+
+import (
+	"errors"
+)
+
+const (
+	COMMAND   = "sandbox"   // 在新的命名空间中初始化沙箱的隐藏子命令
+	WORKSPACE = "/tmp"      // 沙箱中挂载 tmpfs 的工作区
+	TMPFSSIZE = "size=512m" // 工作区的容量上限
+)
+
+var ErrUnsupported = errors.New("沙箱模式只支持 Linux 节点")
+
+type (
+	// 沙箱中执行的命令，由节点进程传给沙箱初始化进程
+	Options struct {
+		User    string // 执行用户，初始化完成后切换
+		Dir     string // 工作目录，为空时使用工作区
+		Command string
+	}
+)
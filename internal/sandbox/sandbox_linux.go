@@ -0,0 +1,143 @@
+//go:build linux
+// +build linux
+
+package sandbox
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// 创建在独立的挂载、进程和网络命名空间中执行命令的进程，由当前程序的沙箱子命令完成初始化后再执行命令
+func Command(options *Options) (*exec.Cmd, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{COMMAND, "--user", options.User, "--dir", options.Dir, "--", options.Command}
+	cmd := exec.Command(executable, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:    true,
+		Cloneflags: syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET | syscall.CLONE_NEWUTS | syscall.CLONE_NEWIPC,
+	}
+
+	return cmd, nil
+}
+
+// 在沙箱中初始化文件系统并执行命令，返回命令的退出码
+// 当前进程是新进程命名空间中的 1 号进程，退出时命名空间中的其他进程会被一起结束，新的网络命名空间中没有可用的网卡
+func Init(options *Options) (int, error) {
+	// 挂载操作不传播到节点
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return -1, err
+	}
+
+	if err := readonly(); err != nil {
+		return -1, err
+	}
+
+	// 新的进程命名空间需要重新挂载 proc，否则看到的仍然是节点的进程
+	if err := syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return -1, err
+	}
+
+	if err := syscall.Mount("tmpfs", WORKSPACE, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, TMPFSSIZE+",mode=1777"); err != nil {
+		return -1, err
+	}
+
+	cmd := exec.Command("/bin/bash", "-c", options.Command)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Dir = WORKSPACE
+	if options.Dir != "" {
+		cmd.Dir = options.Dir
+	}
+	cmd.Env = append(os.Environ(), "HOME="+WORKSPACE, "TMPDIR="+WORKSPACE)
+
+	if options.User != "" {
+		credential, err := lookup(options.User)
+		if err != nil {
+			return -1, err
+		}
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: credential}
+	}
+
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			if status.Signaled() {
+				return 128 + int(status.Signal()), nil
+			}
+			return status.ExitStatus(), nil
+		}
+	}
+
+	if err != nil {
+		return -1, err
+	}
+
+	return 0, nil
+}
+
+// 将所有挂载点重新挂载为只读，proc、sys 等虚拟文件系统重新挂载失败时忽略
+func readonly() error {
+	file, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	points := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 1 {
+			points = append(points, fields[1])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// 根目录必须成功，否则沙箱没有意义
+	if err := syscall.Mount("/", "/", "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return err
+	}
+	if err := syscall.Mount("", "/", "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY, ""); err != nil {
+		return err
+	}
+
+	for _, point := range points {
+		if point == "/" {
+			continue
+		}
+		_ = syscall.Mount("", point, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY, "")
+	}
+
+	return nil
+}
+
+// 获取执行用户的证书
+func lookup(username string) (*syscall.Credential, error) {
+	account, err := user.Lookup(username)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := strconv.Atoi(account.Uid)
+	if err != nil {
+		return nil, err
+	}
+
+	gid, err := strconv.Atoi(account.Gid)
+	if err != nil {
+		return nil, err
+	}
+
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}, nil
+}
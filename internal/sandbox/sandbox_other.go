@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package sandbox
+
+import "os/exec"
+
+// 非 Linux 节点不支持命名空间
+func Command(options *Options) (*exec.Cmd, error) {
+	return nil, ErrUnsupported
+}
+
+// 非 Linux 节点不支持命名空间
+func Init(options *Options) (int, error) {
+	return -1, ErrUnsupported
+}
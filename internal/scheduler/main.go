@@ -2,23 +2,53 @@ package scheduler
 
 import (
 	"context"
+	"errors"
+	"github.com/betterde/ects/config"
 	"github.com/betterde/ects/internal/actuator"
+	"github.com/betterde/ects/internal/clock"
+	"github.com/betterde/ects/internal/control"
+	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/internal/metrics"
+	"github.com/betterde/ects/internal/service"
 	"github.com/betterde/ects/models"
 	"github.com/gorhill/cronexpr"
 	"log"
+	"runtime"
+	"strconv"
+	"syscall"
 	"time"
 )
 
 const (
-	PUT  = 1 // 新增或更新事件
-	DEL  = 2 // 删除事件
-	KILL = 3 // 强行终止进程事件
+	PUT   = 1 // 新增或更新事件
+	DEL   = 2 // 删除事件
+	KILL  = 3 // 强行终止进程事件
+	RUN   = 4 // 立即执行事件
+	PROBE = 5 // 健康检查事件
+	DRAIN = 6 // 进入或退出维护状态事件
+
+	TAKEOVERGRACE = 5 * time.Second // 备用节点等待主节点执行的时间
 )
 
 type (
 	Event struct {
-		Type     int              // 事件类型
-		Pipeline *models.Pipeline // 流水线
+		Type     int                  // 事件类型
+		Pipeline *models.Pipeline     // 流水线
+		Trigger  *models.Trigger      // 立即执行指令
+		Standby  bool                 // 当前节点是否为流水线的备用节点
+		Running  bool                 // 维护事件中表示是否进入维护状态
+		Kill     *control.KillRequest // 强杀指令，可以只针对某一次执行
+		Reply    chan *Summary        // 需要回复的事件，处理完成后发送调度器的状态
+		Startup  bool                 // 节点启动时加载的流水线，需要补偿停机期间错过的执行
+	}
+	// 事件处理结果和调度器的状态
+	Summary struct {
+		Dropped int  // 丢弃的等待执行的指令数量
+		Killed  int  // 终止的正在执行的流水线数量
+		Running int  // 正在执行的流水线数量
+		Queued  int  // 等待执行的指令数量
+		Planned int  // 调度计划中的流水线数量
+		Drained bool // 是否处于维护状态
 	}
 	Contract interface {
 		Run(ctx context.Context)             // 运行调度器
@@ -29,56 +59,151 @@ type (
 )
 
 type Scheduler struct {
-	EventsChan chan *Event                 // 事件通道
-	ResultChan chan *models.Result         // 执行结果通道
-	Plan       map[string]*models.Pipeline // 调度计划
-	Running    map[string]*models.Pipeline // 正在运行的流水线
+	EventsChan chan *Event                       // 事件通道
+	ResultChan chan *models.Result               // 执行结果通道
+	Plan       map[string]*models.Pipeline       // 调度计划
+	Standby    map[string]*models.Pipeline       // 作为备用节点的调度计划
+	Running    map[string]int                    // 正在运行的流水线及其运行数量
+	Registered map[string]*discover.Registration // 执行登记，执行结果保存后释放
+	Queue      []*models.Trigger                 // 等待立即执行的流水线
+	Deferred   map[string]*models.Trigger        // 执行时间段外推迟执行的流水线，每条流水线只保留一次
+	Cancels    map[string]context.CancelFunc     // 正在执行的流水线的终止函数
+	Clock      *clock.Clock                      // 计算触发时间使用的时钟
+	Drained    bool                              // 维护状态下不再执行新的流水线，正在执行的流水线继续执行
 }
 
+var ErrDrained = errors.New("节点处于维护状态，不再执行新的流水线")
+
 var Instance *Scheduler
 
 // 运行调度器
 func (scheduler *Scheduler) Run(ctx context.Context) {
 	afterTimer := scheduler.TryExecute(ctx)
 	scheduleTimer := time.NewTimer(afterTimer)
+	heartbeat := time.NewTicker(discover.HEARTBEAT)
+	defer heartbeat.Stop()
+	scheduler.report()
 
 	for {
 		select {
 		case event := <-scheduler.EventsChan:
 			scheduler.eventHandler(event)
 		case <-scheduleTimer.C:
+		case <-heartbeat.C:
+			scheduler.report()
 		case result := <-scheduler.ResultChan:
-			if err := result.Pipeline.Store(); err != nil {
+			if scheduler.Running[result.Pipeline.PipelineId]--; scheduler.Running[result.Pipeline.PipelineId] <= 0 {
+				delete(scheduler.Running, result.Pipeline.PipelineId)
+			}
+			if finished, err := models.Repo.FinishRun(result.Pipeline); err != nil {
 				log.Fatal(err)
+			} else if !finished {
+				log.Printf("Run %s was marked lost before it finished, result discarded\n", result.Pipeline.Reference())
+			} else {
+				metrics.Observe(result.Pipeline)
 			}
 			for _, step := range result.Steps {
-				if err := step.Store(); err != nil {
+				if err := models.Repo.StoreStep(step); err != nil {
 					log.Fatal(err)
 				}
 			}
+			if cancel, exist := scheduler.Cancels[result.Pipeline.Id]; exist {
+				cancel()
+				delete(scheduler.Cancels, result.Pipeline.Id)
+			}
+			actuator.Forget(result.Pipeline.Id)
+			// 执行结果保存后才释放登记，避免主节点将已完成的执行判定为失联
+			if registration, exist := scheduler.Registered[result.Pipeline.Id]; exist {
+				registration.Release()
+				delete(scheduler.Registered, result.Pipeline.Id)
+			}
 		}
 
 		after := scheduler.TryExecute(ctx)
 		scheduleTimer.Reset(after)
+
+		metrics.QueueDepth.Set(float64(len(scheduler.Queue) + len(scheduler.Deferred)))
+		metrics.Running.Set(float64(len(scheduler.Registered)))
+		metrics.Planned.Set(float64(len(scheduler.Plan) + len(scheduler.Standby)))
 	}
 }
 
 // 尝试执行Pipeline
 func (scheduler *Scheduler) TryExecute(ctx context.Context) (after time.Duration) {
 	var nearTime time.Time
-	if len(scheduler.Plan) == 0 {
+
+	now := scheduler.Clock.Now()
+	open := scheduler.open(now)
+
+	if open {
+		// 优先执行手动触发和推迟执行的流水线
+		for _, trigger := range scheduler.Queue {
+			scheduler.launch(ctx, trigger)
+		}
+		scheduler.Queue = scheduler.Queue[:0]
+
+		// 项目仍然超出预算时重新推迟，不能在遍历时写回同一个集合
+		deferred := scheduler.Deferred
+		scheduler.Deferred = make(map[string]*models.Trigger, len(deferred))
+		for id, trigger := range deferred {
+			// 节点或项目达到并发上限、登记执行失败时保留推迟的执行，下次调度时重试
+			if !scheduler.launch(ctx, trigger) {
+				scheduler.Deferred[id] = trigger
+				continue
+			}
+
+			// 仍然超出预算时重新推迟，按照并发策略跳过时也没有开始执行
+			if _, started := scheduler.Registered[trigger.Id]; started {
+				log.Printf("Deferred run %s of pipeline %s launched\n", trigger.Id, id)
+			}
+		}
+	} else {
+		// 执行时间段外的手动触发留在队列中，开始执行时记录推迟的决定
+		for _, trigger := range scheduler.Queue {
+			if _, exist := trigger.Tags["window"]; !exist {
+				trigger.Tags = trigger.Tags.Merge(deferral(now))
+			}
+		}
+
+		// 等到最近一个时间段开始时执行队列中的流水线
+		if len(scheduler.Queue) > 0 || len(scheduler.Deferred) > 0 {
+			nearTime = service.Runtime.Windows.Next(now.Local())
+		}
+	}
+
+	if len(scheduler.Plan) == 0 && len(scheduler.Standby) == 0 {
 		after = 1 * time.Second
 		return
 	}
 
-	scheduler.ResultChan = make(chan *models.Result, 1000)
-
-	now := time.Now()
-
 	for _, pipe := range scheduler.Plan {
 		if pipe.NextTime.Before(now) || pipe.NextTime.Equal(now) {
-			actuator.RunPipeline(ctx, pipe, scheduler.ResultChan)
-			pipe.NextTime = pipe.Expression.Next(now)
+			// 维护状态下不通知备用节点，由备用节点接管
+			if scheduler.Drained {
+				log.Printf("Node %s is drained, pipeline %s skipped\n", service.Runtime.Id, pipe.Id)
+			} else if !open && scheduler.reroute(pipe) {
+				log.Printf("Node %s is outside its execution windows, pipeline %s rerouted\n", service.Runtime.Id, pipe.Id)
+			} else if !scheduler.elected(pipe) {
+				log.Printf("Pipeline %s is executed by another node at %s\n", pipe.Id, pipe.NextTime)
+			} else if !open {
+				scheduler.postpone(&models.Trigger{
+					Source:   models.TRIGGERSCHEDULE,
+					Pipeline: pipe,
+					Tags:     planned(pipe).Merge(deferral(pipe.NextTime)),
+				})
+			} else if scheduler.launch(ctx, &models.Trigger{
+				Source:   models.TRIGGERSCHEDULE,
+				Pipeline: pipe,
+				Tags:     scheduled(pipe),
+			}) {
+				// 告知备用节点本次执行已经处理
+				if pipe.Standby != "" {
+					if err := discover.Fire(pipe.Id, pipe.NextTime, service.Runtime.Id); err != nil {
+						log.Println(err)
+					}
+				}
+			}
+			pipe.NextTime = pipe.Next(now)
 		}
 
 		if nearTime.IsZero() || pipe.NextTime.Before(nearTime) {
@@ -86,21 +211,465 @@ func (scheduler *Scheduler) TryExecute(ctx context.Context) (after time.Duration
 		}
 	}
 
+	// 主节点离线或者达到并发上限而错过执行时，由备用节点接管
+	for _, pipe := range scheduler.Standby {
+		due := pipe.NextTime.Add(TAKEOVERGRACE)
+		if due.Before(now) || due.Equal(now) {
+			if scheduler.Drained {
+				log.Printf("Node %s is drained, takeover of pipeline %s skipped\n", service.Runtime.Id, pipe.Id)
+			} else if fired, err := discover.Fired(pipe.Id, pipe.NextTime); err != nil {
+				log.Println(err)
+			} else if !fired {
+				log.Printf("Pipeline %s missed by primary nodes, taken over by standby node %s\n", pipe.Id, service.Runtime.Id)
+				trigger := &models.Trigger{
+					Source:   models.TRIGGERSTANDBY,
+					Pipeline: pipe,
+					Tags:     rerouted(pipe, nil),
+				}
+				if open {
+					scheduler.launch(ctx, trigger)
+				} else {
+					trigger.Tags = trigger.Tags.Merge(deferral(pipe.NextTime))
+					scheduler.postpone(trigger)
+				}
+			}
+			pipe.NextTime = pipe.Next(now)
+			due = pipe.NextTime.Add(TAKEOVERGRACE)
+		}
+
+		if nearTime.IsZero() || due.Before(nearTime) {
+			nearTime = due
+		}
+	}
+
 	after = nearTime.Sub(now)
 	return
 }
 
+// 根据流水线的调度策略判断当前节点是否负责本次执行，单例执行以及 any 和 least-loaded 策略下每个计划时间只有一个节点执行
+func (scheduler *Scheduler) elected(pipe *models.Pipeline) bool {
+	if !exclusive(pipe) {
+		return true
+	}
+
+	// 并发已满时不参与竞选，避免竞选成功后无法执行
+	if service.Runtime.Capacity > 0 && len(scheduler.Registered) >= service.Runtime.Capacity {
+		return false
+	}
+
+	// 获取负载失败时退化为 any 策略，保证仍有节点执行
+	hints := pipe.Locality()
+	if pipe.Policy == models.POLICYLEASTLOADED || len(hints) > 0 {
+		if loads, err := discover.Loads(); err != nil {
+			log.Println(err)
+		} else {
+			// 优先由提供任务数据位置的节点执行，减少跨节点复制数据
+			candidates := discover.Nearest(pipe.Nodes, hints, loads)
+			if !nominated(candidates, service.Runtime.Id) {
+				log.Printf("Pipeline %s prefers nodes with its data locality %v\n", pipe.Id, hints)
+				return false
+			}
+
+			if pipe.Policy == models.POLICYLEASTLOADED {
+				if leader := discover.LeastLoaded(candidates, loads); leader != "" && leader != service.Runtime.Id {
+					return false
+				}
+			}
+		}
+	}
+
+	won, err := discover.Elect(pipe.Id, pipe.NextTime, service.Runtime.Id)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+
+	return won
+}
+
+// 节点是否在候选节点中
+func nominated(candidates []string, id string) bool {
+	for _, candidate := range candidates {
+		if candidate == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 每次只由一个节点执行的流水线，包括单例执行以及 any 和 least-loaded 策略
+func exclusive(pipe *models.Pipeline) bool {
+	return pipe.Singleton == 1 || pipe.Policy == models.POLICYANY || pipe.Policy == models.POLICYLEASTLOADED
+}
+
+// 当前时间是否在节点允许执行的时间段内，按照节点的本地时间判断
+func (scheduler *Scheduler) open(now time.Time) bool {
+	return service.Runtime.Windows.Open(now.Local())
+}
+
+// 执行时间段外将本次执行转交给其他节点，配置了备用节点时由备用节点接管，
+// 每次只由一个节点执行的流水线交给其他处于执行时间段内的绑定节点，没有可以转交的节点时返回 false
+func (scheduler *Scheduler) reroute(pipe *models.Pipeline) bool {
+	if pipe.Standby != "" && pipe.Standby != service.Runtime.Id {
+		if err := discover.Reroute(pipe.Id, pipe.NextTime, service.Runtime.Id); err != nil {
+			log.Println(err)
+			return false
+		}
+		return true
+	}
+
+	if !exclusive(pipe) {
+		return false
+	}
+
+	loads, err := discover.Loads()
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+
+	others := make([]string, 0, len(pipe.Nodes))
+	for _, id := range pipe.Nodes {
+		if id != service.Runtime.Id {
+			others = append(others, id)
+		}
+	}
+
+	if discover.LeastLoaded(others, loads) == "" {
+		return false
+	}
+
+	if err := discover.Reroute(pipe.Id, pipe.NextTime, service.Runtime.Id); err != nil {
+		log.Println(err)
+	}
+
+	return true
+}
+
+// 推迟到执行时间段开始后执行，同一条流水线已经推迟的执行合并后续的触发，只执行一次
+func (scheduler *Scheduler) postpone(trigger *models.Trigger) {
+	if scheduler.withhold(trigger) {
+		log.Printf("Node %s is outside its execution windows, pipeline %s deferred to %s\n", service.Runtime.Id, trigger.Pipeline.Id, service.Runtime.Windows.Next(scheduler.Clock.Now().Local()))
+	}
+}
+
+// 暂缓执行，同一条流水线已经暂缓的执行合并后续的触发，返回是否新增了暂缓的执行
+func (scheduler *Scheduler) withhold(trigger *models.Trigger) bool {
+	pipe := trigger.Pipeline
+	if deferred, exist := scheduler.Deferred[pipe.Id]; exist {
+		merged, _ := strconv.Atoi(deferred.Tags["merged"])
+		deferred.Tags["merged"] = strconv.Itoa(merged + 1)
+		log.Printf("Pipeline %s is already deferred, fire at %s merged\n", pipe.Id, pipe.NextTime)
+		return false
+	}
+
+	if trigger.Id == "" {
+		trigger.Id = models.NewRunId()
+	}
+
+	scheduler.Deferred[pipe.Id] = trigger
+	return true
+}
+
+// 项目超出预算时按照项目的处理方式跳过或者推迟非关键流水线的执行，返回是否已经处理本次执行
+func (scheduler *Scheduler) overspent(trigger *models.Trigger) bool {
+	pipe := trigger.Pipeline
+	if pipe.Critical || pipe.ProjectId == "" {
+		return false
+	}
+
+	budget, err := discover.Exhausted(pipe.ProjectId)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+
+	if budget == nil {
+		return false
+	}
+
+	// 执行组的多次执行不能合并，超出预算时只能跳过
+	if budget.Action != models.BUDGETDEFER || trigger.GroupId != "" {
+		log.Printf("Project %s exceeded its budget of %d node minutes, pipeline %s skipped\n", pipe.ProjectId, budget.Limit, pipe.Id)
+		return true
+	}
+
+	// 已经因为预算推迟的执行每次重试时不再重复记录
+	if _, exist := trigger.Tags["budget"]; exist {
+		scheduler.withhold(trigger)
+		return true
+	}
+
+	trigger.Tags = trigger.Tags.Merge(models.Tags{
+		"budget":        models.BUDGETDEFER,
+		"deferred_from": strconv.FormatInt(scheduler.Clock.Now().Unix(), 10),
+	})
+	if scheduler.withhold(trigger) {
+		log.Printf("Project %s exceeded its budget of %d node minutes, pipeline %s deferred\n", pipe.ProjectId, budget.Limit, pipe.Id)
+	}
+	return true
+}
+
+// 推迟执行的标签，记录原本的计划时间
+func deferral(at time.Time) models.Tags {
+	return models.Tags{
+		"window":        models.WINDOWDEFERRED,
+		"deferred_from": strconv.FormatInt(at.Unix(), 10),
+	}
+}
+
+// 其他节点在执行时间段外转交的执行，在执行记录中标记转交的节点
+func rerouted(pipe *models.Pipeline, tags models.Tags) models.Tags {
+	node, exist, err := discover.Rerouted(pipe.Id, pipe.NextTime)
+	if err != nil {
+		log.Println(err)
+		return tags
+	}
+
+	if !exist {
+		return tags
+	}
+
+	return tags.Merge(models.Tags{
+		"window":        models.WINDOWREROUTED,
+		"rerouted_from": node,
+	})
+}
+
+// 计划执行的标签，只有每次由一个节点执行的流水线可能由其他节点转交
+func scheduled(pipe *models.Pipeline) models.Tags {
+	if !exclusive(pipe) {
+		return planned(pipe)
+	}
+
+	return rerouted(pipe, planned(pipe))
+}
+
+// 单例执行的流水线在执行记录中标记计划时间和竞选成功的节点，便于按计划时间查询唯一的执行记录
+func planned(pipe *models.Pipeline) models.Tags {
+	if pipe.Singleton == 0 {
+		return nil
+	}
+
+	return models.Tags{
+		"planned": strconv.FormatInt(pipe.NextTime.Unix(), 10),
+		"elected": service.Runtime.Id,
+	}
+}
+
+// 上报节点的负载，供 least-loaded 策略选择执行节点
+func (scheduler *Scheduler) report() {
+	load := &discover.Load{
+		NodeId:   service.Runtime.Id,
+		Load:     service.LoadAverage(),
+		CPU:      runtime.NumCPU(),
+		Running:  len(scheduler.Registered),
+		Capacity: service.Runtime.Capacity,
+		Drained:  scheduler.Drained,
+		Closed:   !scheduler.open(scheduler.Clock.Now()),
+		Volumes:  service.Runtime.Volumes,
+		Time:     time.Now(),
+	}
+
+	go func() {
+		if err := discover.Report(load); err != nil {
+			log.Println(err)
+		}
+	}()
+}
+
+// 登记并异步执行流水线，并发策略不允许或者项目超出预算时跳过本次执行，节点或项目并发已满时返回 false
+func (scheduler *Scheduler) launch(ctx context.Context, trigger *models.Trigger) bool {
+	pipe := trigger.Pipeline
+	if len(pipe.Steps) == 0 {
+		return true
+	}
+
+	if scheduler.overspent(trigger) {
+		return true
+	}
+
+	if !scheduler.overlap(pipe) {
+		return true
+	}
+
+	if service.Runtime.Capacity > 0 && len(scheduler.Registered) >= service.Runtime.Capacity {
+		log.Printf("Node %s reached the max capacity, pipeline %s skipped\n", service.Runtime.Id, pipe.Id)
+		return false
+	}
+
+	if trigger.Id == "" {
+		trigger.Id = models.NewRunId()
+	}
+
+	registration, err := discover.Acquire(&discover.Run{
+		Id:            trigger.Id,
+		CorrelationId: trigger.CorrelationId,
+		GroupId:       trigger.GroupId,
+		PipelineId:    pipe.Id,
+		ProjectId:     pipe.ProjectId,
+		NodeId:        service.Runtime.Id,
+		BeginWith:     time.Now(),
+	}, concurrency(pipe.ProjectId))
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+
+	if registration == nil {
+		log.Printf("Project %s reached the max concurrency, pipeline %s skipped\n", pipe.ProjectId, pipe.Id)
+		return false
+	}
+
+	scheduler.Running[pipe.Id]++
+	scheduler.Registered[trigger.Id] = registration
+
+	// 调度计划中的流水线会被调度协程继续修改，执行时使用副本
+	snapshot := *pipe
+	run := *trigger
+	run.Pipeline = &snapshot
+	rctx, cancel := context.WithCancel(ctx)
+	scheduler.Cancels[trigger.Id] = cancel
+	go actuator.RunPipeline(rctx, &run, scheduler.ResultChan)
+	return true
+}
+
+// 按照流水线的并发策略处理上一次尚未结束的执行，返回是否继续执行本次流水线
+func (scheduler *Scheduler) overlap(pipe *models.Pipeline) bool {
+	if scheduler.Running[pipe.Id] == 0 {
+		return true
+	}
+
+	switch pipe.ConcurrencyMode() {
+	case models.CONCURRENCYFORBID:
+		log.Printf("Pipeline %s is still running, skipped\n", pipe.Id)
+		return false
+	case models.CONCURRENCYREPLACE:
+		for id, registration := range scheduler.Registered {
+			if registration.Run.PipelineId != pipe.Id {
+				continue
+			}
+			if cancel, exist := scheduler.Cancels[id]; exist {
+				log.Printf("Run %s of pipeline %s replaced\n", registration.Run.Reference(), pipe.Id)
+				cancel()
+			}
+		}
+	}
+
+	return true
+}
+
+// 获取项目的最大并发数
+func concurrency(projectId string) int {
+	if projectId == "" {
+		return 0
+	}
+
+	max, err := models.Repo.Concurrency(projectId)
+	if err != nil {
+		log.Println(err)
+		return 0
+	}
+
+	return max
+}
+
 // ETCD事件处理
 func (scheduler *Scheduler) eventHandler(event *Event) {
 	switch event.Type {
 	case PUT:
+		// 禁用的流水线不参与调度
+		if event.Pipeline.Status == models.PIPELINEDISABLED {
+			delete(scheduler.Plan, event.Pipeline.Id)
+			delete(scheduler.Standby, event.Pipeline.Id)
+			delete(scheduler.Deferred, event.Pipeline.Id)
+			break
+		}
 		event.Pipeline.Expression = cronexpr.MustParse(event.Pipeline.Spec)
-		event.Pipeline.NextTime = event.Pipeline.Expression.Next(time.Now())
-		scheduler.Plan[event.Pipeline.Id] = event.Pipeline
+		// 按照流水线指定的时区计算触发时间
+		event.Pipeline.Location = event.Pipeline.LoadLocation()
+		event.Pipeline.NextTime = event.Pipeline.Next(scheduler.Clock.Now())
+		// 推迟的执行使用更新后的流水线
+		if deferred, exist := scheduler.Deferred[event.Pipeline.Id]; exist {
+			deferred.Pipeline = event.Pipeline
+		}
+		if event.Standby {
+			delete(scheduler.Plan, event.Pipeline.Id)
+			scheduler.Standby[event.Pipeline.Id] = event.Pipeline
+		} else {
+			delete(scheduler.Standby, event.Pipeline.Id)
+			scheduler.Plan[event.Pipeline.Id] = event.Pipeline
+			if event.Startup {
+				scheduler.catchUp(event.Pipeline)
+			}
+		}
 	case DEL:
 		delete(scheduler.Plan, event.Pipeline.Id)
+		delete(scheduler.Standby, event.Pipeline.Id)
+		delete(scheduler.Deferred, event.Pipeline.Id)
 	case KILL:
-		// TODO KILL handler
+		kill := event.Kill
+		if kill.StepId != "" {
+			scheduler.reply(event, scheduler.killStep(kill))
+			break
+		}
+
+		// 丢弃等待执行的指令，需要时终止正在执行的流水线
+		summary := &Summary{}
+		queue := scheduler.Queue[:0]
+		for _, trigger := range scheduler.Queue {
+			if trigger.Pipeline == nil || !targeted(kill, trigger.Pipeline.Id, trigger.Id, trigger.GroupId) {
+				queue = append(queue, trigger)
+			} else {
+				summary.Dropped++
+			}
+		}
+		scheduler.Queue = queue
+
+		if trigger, exist := scheduler.Deferred[kill.PipelineId]; exist && targeted(kill, kill.PipelineId, trigger.Id, trigger.GroupId) {
+			delete(scheduler.Deferred, kill.PipelineId)
+			summary.Dropped++
+		}
+
+		for id, registration := range scheduler.Registered {
+			if !kill.Running || !targeted(kill, registration.Run.PipelineId, id, registration.Run.GroupId) {
+				continue
+			}
+			if cancel, exist := scheduler.Cancels[id]; exist {
+				log.Printf("Run %s of pipeline %s killed by %s\n", registration.Run.Reference(), kill.PipelineId, requester(kill))
+				actuator.Cancel(id, termination(kill))
+				// 确认收到终止指令，不阻塞调度协程
+				go func(id string) {
+					if err := models.Repo.Cancelling(id, kill.Requester); err != nil {
+						log.Println(err)
+					}
+				}(id)
+				cancel()
+				summary.Killed++
+			}
+		}
+		scheduler.reply(event, summary)
+	case PROBE:
+		scheduler.reply(event, &Summary{})
+	case DRAIN:
+		scheduler.Drained = event.Running
+		// 尚未开始执行的指令一并丢弃，由主节点选择其他节点执行
+		summary := &Summary{}
+		if scheduler.Drained {
+			summary.Dropped = len(scheduler.Queue) + len(scheduler.Deferred)
+			scheduler.Queue = scheduler.Queue[:0]
+			scheduler.Deferred = make(map[string]*models.Trigger)
+		}
+		log.Printf("Node %s drained: %t, %d queued triggers dropped\n", service.Runtime.Id, scheduler.Drained, summary.Dropped)
+		scheduler.reply(event, summary)
+	case RUN:
+		if scheduler.Drained {
+			scheduler.reply(event, &Summary{Dropped: 1})
+			break
+		}
+		scheduler.Queue = append(scheduler.Queue, event.Trigger)
+		scheduler.reply(event, &Summary{})
 	}
 }
 
@@ -109,12 +678,144 @@ func (scheduler *Scheduler) DispatchEvent(event *Event) {
 	scheduler.EventsChan <- event
 }
 
+// 补充调度器的状态并回复事件
+func (scheduler *Scheduler) reply(event *Event, summary *Summary) {
+	if event.Reply == nil {
+		return
+	}
+
+	summary.Running = len(scheduler.Registered)
+	summary.Queued = len(scheduler.Queue) + len(scheduler.Deferred)
+	summary.Planned = len(scheduler.Plan) + len(scheduler.Standby)
+	summary.Drained = scheduler.Drained
+	event.Reply <- summary
+}
+
+// 分发事件并等待调度协程处理完成
+func (scheduler *Scheduler) request(event *Event) *Summary {
+	event.Reply = make(chan *Summary, 1)
+	scheduler.DispatchEvent(event)
+	return <-event.Reply
+}
+
+// 执行控制服务下发的立即执行指令，维护状态下拒绝执行
+func (scheduler *Scheduler) Trigger(trigger *models.Trigger) error {
+	summary := scheduler.request(&Event{
+		Type:     RUN,
+		Pipeline: trigger.Pipeline,
+		Trigger:  trigger,
+	})
+
+	if summary.Dropped > 0 {
+		return ErrDrained
+	}
+
+	return nil
+}
+
+// 丢弃流水线等待执行的指令，需要时同时终止正在执行的流水线
+func (scheduler *Scheduler) Kill(request *control.KillRequest) (*control.KillReply, error) {
+	summary := scheduler.request(&Event{
+		Type:     KILL,
+		Pipeline: &models.Pipeline{Id: request.PipelineId},
+		Kill:     request,
+	})
+
+	return &control.KillReply{Dropped: summary.Dropped, Killed: summary.Killed}, nil
+}
+
+// 判断执行是否在强杀指令的范围内，指定了执行记录或者执行组时只处理对应的执行
+func targeted(kill *control.KillRequest, pipelineId, runId, groupId string) bool {
+	return pipelineId == kill.PipelineId && (kill.RunId == "" || runId == kill.RunId) && (kill.GroupId == "" || groupId == kill.GroupId)
+}
+
+// 只终止执行中的一个步骤，不影响等待执行的指令，流水线按照步骤失败继续执行
+func (scheduler *Scheduler) killStep(kill *control.KillRequest) *Summary {
+	summary := &Summary{}
+	registration, exist := scheduler.Registered[kill.RunId]
+	if !exist || registration.Run.PipelineId != kill.PipelineId {
+		return summary
+	}
+
+	if actuator.KillStep(kill.RunId, kill.StepId, termination(kill)) {
+		log.Printf("Step %s of run %s killed by %s\n", kill.StepId, registration.Run.Reference(), requester(kill))
+		summary.Killed++
+	}
+
+	return summary
+}
+
+// 强杀指令指定的终止方式
+func termination(kill *control.KillRequest) *actuator.Termination {
+	termination := &actuator.Termination{
+		Requester: kill.Requester,
+		Signal:    syscall.SIGTERM,
+		Grace:     time.Duration(kill.Grace) * time.Second,
+	}
+
+	if kill.Signal == control.SIGNALKILL {
+		termination.Signal = syscall.SIGKILL
+	}
+
+	return termination
+}
+
+// 强杀指令的发起方，未记录用户时为系统发起
+func requester(kill *control.KillRequest) string {
+	if kill.Requester == "" {
+		return "system"
+	}
+
+	return kill.Requester
+}
+
+// 返回节点的健康状况
+func (scheduler *Scheduler) Probe() (*control.ProbeReply, error) {
+	summary := scheduler.request(&Event{Type: PROBE})
+
+	return probeReply(scheduler, summary), nil
+}
+
+// 进入或退出维护状态，正在执行的流水线继续执行
+func (scheduler *Scheduler) Drain(drained bool) (*control.ProbeReply, error) {
+	summary := scheduler.request(&Event{Type: DRAIN, Running: drained})
+	return probeReply(scheduler, summary), nil
+}
+
+// 根据调度器的状态生成健康检查结果
+func probeReply(scheduler *Scheduler, summary *Summary) *control.ProbeReply {
+	return &control.ProbeReply{
+		Id:       service.Runtime.Id,
+		Name:     service.Runtime.Name,
+		Version:  service.Runtime.Version,
+		Running:  summary.Running,
+		Queued:   summary.Queued,
+		Planned:  summary.Planned,
+		Time:     scheduler.Clock.Now(),
+		Capacity: service.Runtime.Capacity,
+		Drained:  summary.Drained,
+	}
+}
+
 // 创建调度器
 func New() {
+	conf := config.Conf.Clock
+	if conf.Interval <= 0 {
+		conf.Interval = 300
+	}
+
 	Instance = &Scheduler{
+		Clock:      clock.New(conf.Source, conf.Authority, time.Duration(conf.MaxDrift)*time.Millisecond),
 		EventsChan: make(chan *Event, 100),
 		ResultChan: make(chan *models.Result, 100),
 		Plan:       make(map[string]*models.Pipeline),
-		Running:    make(map[string]*models.Pipeline),
+		Standby:    make(map[string]*models.Pipeline),
+		Running:    make(map[string]int),
+		Registered: make(map[string]*discover.Registration),
+		Queue:      make([]*models.Trigger, 0),
+		Deferred:   make(map[string]*models.Trigger),
+		Cancels:    make(map[string]context.CancelFunc),
 	}
+
+	go Instance.Clock.Sync(time.Duration(conf.Interval)*time.Second, nil)
 }
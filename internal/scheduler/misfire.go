@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/internal/service"
+	"github.com/betterde/ects/models"
+	"log"
+	"strconv"
+	"time"
+)
+
+// 节点启动时按照流水线的补偿策略，将停机期间错过的计划执行加入等待队列
+func (scheduler *Scheduler) catchUp(pipe *models.Pipeline) {
+	if pipe.Misfire != models.MISFIREONCE && pipe.Misfire != models.MISFIREALL {
+		return
+	}
+
+	if scheduler.Drained {
+		log.Printf("Node %s is drained, catch-up of pipeline %s skipped\n", service.Runtime.Id, pipe.Id)
+		return
+	}
+
+	// 每次只由一个节点执行的流水线，任一节点执行过即视为没有错过
+	nodeId := service.Runtime.Id
+	if exclusive(pipe) {
+		nodeId = ""
+	}
+
+	last, exist, err := models.Repo.LastScheduled(pipe.Id, nodeId)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	// 从未执行过的流水线没有可以比较的时间，不做补偿
+	if !exist {
+		return
+	}
+
+	missed := misfired(pipe.Next, last, scheduler.Clock.Now(), models.MISFIREMAXFIRES)
+	if len(missed) == 0 {
+		return
+	}
+
+	if pipe.Misfire == models.MISFIREONCE {
+		missed = missed[len(missed)-1:]
+	}
+
+	queued := 0
+	for _, fire := range missed {
+		// 多个节点同时启动时，每个错过的计划时间只由竞选成功的节点补偿
+		if exclusive(pipe) {
+			won, err := discover.Elect(pipe.Id, fire, service.Runtime.Id)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			if !won {
+				continue
+			}
+		}
+
+		scheduler.Queue = append(scheduler.Queue, &models.Trigger{
+			Source:   models.TRIGGERMISFIRE,
+			Pipeline: pipe,
+			Tags:     models.Tags{"planned": strconv.FormatInt(fire.Unix(), 10)},
+		})
+		queued++
+	}
+
+	log.Printf("Pipeline %s missed %d fires since %s, %d queued by policy %s\n", pipe.Id, len(missed), last.Format(time.RFC3339), queued, pipe.Misfire)
+}
+
+// 计算 last 之后到 now 为止错过的计划时间，最多返回最近的 limit 个，next 计算下一次触发时间
+func misfired(next func(time.Time) time.Time, last, now time.Time, limit int) []time.Time {
+	missed := make([]time.Time, 0)
+	for fire := next(last); !fire.IsZero() && !fire.After(now); fire = next(fire) {
+		missed = append(missed, fire)
+		if len(missed) > limit {
+			missed = missed[1:]
+		}
+	}
+
+	return missed
+}
@@ -0,0 +1,26 @@
+package scheduler
+
+import (
+	"github.com/gorhill/cronexpr"
+	"testing"
+	"time"
+)
+
+func TestMisfired(t *testing.T) {
+	expression := cronexpr.MustParse("0 0 * * * * *")
+	last := time.Date(2019, 3, 1, 8, 0, 5, 0, time.UTC)
+	now := time.Date(2019, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	missed := misfired(expression.Next, last, now, 100)
+	if len(missed) != 4 || missed[0].Hour() != 9 || missed[3].Hour() != 12 {
+		t.Errorf("expected fires from 9:00 to 12:00, got %v", missed)
+	}
+
+	if missed := misfired(expression.Next, last, now, 2); len(missed) != 2 || missed[0].Hour() != 11 {
+		t.Errorf("expected the latest 2 fires, got %v", missed)
+	}
+
+	if missed := misfired(expression.Next, now, now, 100); len(missed) != 0 {
+		t.Errorf("expected no fires, got %v", missed)
+	}
+}
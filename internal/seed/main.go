@@ -0,0 +1,350 @@
+package seed
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"github.com/go-xorm/xorm"
+	"github.com/gorhill/cronexpr"
+	"github.com/satori/go.uuid"
+	"log"
+	"math/rand"
+	"time"
+)
+
+const (
+	DEMOPROJECT = "ECTS Demo" // 演示项目的名称，用于判断是否已经创建过演示数据
+	DEMONODE    = "demo-worker"
+	DEMODAYS    = 7  // 生成的执行历史覆盖的天数
+	DEMORUNS    = 30 // 每条流水线最多生成的执行记录数
+)
+
+var ErrSeeded = errors.New("演示数据已存在，如需重新创建请先删除项目 " + DEMOPROJECT)
+
+type (
+	// 演示数据中的任务，Output 为生成执行历史时使用的输出
+	demoTask struct {
+		Task   models.Task
+		Output string
+	}
+	// 演示数据中的流水线，Steps 为任务的序号
+	demoPipeline struct {
+		Pipeline models.Pipeline
+		Steps    []int
+	}
+	// 创建的演示数据数量
+	Summary struct {
+		Project   string `json:"project"`
+		Node      string `json:"node"`
+		Tasks     int    `json:"tasks"`
+		Pipelines int    `json:"pipelines"`
+		Runs      int    `json:"runs"`
+		Steps     int    `json:"steps"`
+	}
+)
+
+// 创建演示项目、任务、流水线、绑定的演示节点和最近几天的执行历史，流水线处于禁用状态，不会被调度
+func Demo() (*Summary, error) {
+	if exist, err := models.Engine.Where(builder.Eq{"name": DEMOPROJECT}).Exist(&models.Project{}); err != nil {
+		return nil, err
+	} else if exist {
+		return nil, ErrSeeded
+	}
+
+	now := time.Now()
+	project := &models.Project{
+		Id:           uuid.NewV4().String(),
+		Name:         DEMOPROJECT,
+		Description:  "演示项目，可以随时删除",
+		BudgetAction: models.BUDGETDENY,
+		CreatedAt:    utils.Time(now),
+		UpdatedAt:    utils.Time(now),
+	}
+
+	// 演示节点不会上线，绑定的流水线不会被执行
+	node := &models.Node{
+		Id:          uuid.NewV4().String(),
+		Name:        DEMONODE,
+		Host:        "127.0.0.1",
+		Mode:        models.WORKER,
+		Status:      models.OFFLINE,
+		Version:     "demo",
+		Description: "演示数据创建的节点，可以随时删除",
+		Timezone:    time.Local.String(),
+		CreatedAt:   utils.Time(now),
+		UpdatedAt:   utils.Time(now),
+	}
+
+	tasks := tasks()
+	pipelines := pipelines(project.Id)
+	summary := &Summary{Project: project.Id, Node: node.Id, Tasks: len(tasks), Pipelines: len(pipelines)}
+
+	session := models.Engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+
+	err := func() error {
+		if _, err := session.Insert(project, node); err != nil {
+			return err
+		}
+
+		for index := range tasks {
+			tasks[index].Task.Id = uuid.NewV4().String()
+			if _, err := session.Insert(&tasks[index].Task); err != nil {
+				return err
+			}
+		}
+
+		random := rand.New(rand.NewSource(now.UnixNano()))
+		for _, demo := range pipelines {
+			pipeline := demo.Pipeline
+			pipeline.Id = uuid.NewV4().String()
+			pipeline.Nodes = []string{node.Id}
+			pipeline.Steps = make([]*models.PipelineTaskPivot, 0, len(demo.Steps))
+			for step, index := range demo.Steps {
+				pipeline.Steps = append(pipeline.Steps, &models.PipelineTaskPivot{
+					Id:         uuid.NewV4().String(),
+					PipelineId: pipeline.Id,
+					TaskId:     tasks[index].Task.Id,
+					Step:       step + 1,
+					Dependence: models.DEPENDENCESTRONG,
+					Condition:  models.CONDITIONSUCCESS,
+					LogLevel:   models.LOGFULL,
+					Inherit:    models.INHERITALL,
+					Task:       &tasks[index].Task,
+				})
+			}
+
+			if _, err := session.Insert(&pipeline); err != nil {
+				return err
+			}
+
+			for _, pivot := range pipeline.Steps {
+				if _, err := session.Insert(pivot); err != nil {
+					return err
+				}
+			}
+
+			if _, err := session.Insert(&models.PipelineNodePivot{Id: uuid.NewV4().String(), PipelineId: pipeline.Id, NodeId: node.Id}); err != nil {
+				return err
+			}
+
+			runs, steps, err := history(session, random, &pipeline, demo.Steps, tasks, node, now)
+			if err != nil {
+				return err
+			}
+			summary.Runs += runs
+			summary.Steps += steps
+		}
+
+		return nil
+	}()
+
+	if err != nil {
+		if err := session.Rollback(); err != nil {
+			log.Println(err)
+		}
+		return nil, err
+	}
+
+	return summary, session.Commit()
+}
+
+// 按照流水线的定时器生成最近几天的执行历史，大约每十次执行失败一次
+func history(session *xorm.Session, random *rand.Rand, pipeline *models.Pipeline, indexes []int, tasks []demoTask, node *models.Node, now time.Time) (int, int, error) {
+	expression, err := cronexpr.Parse(pipeline.Spec)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fires := make([]time.Time, 0, DEMORUNS)
+	for fire := expression.Next(now.AddDate(0, 0, -DEMODAYS)); !fire.IsZero() && fire.Before(now); fire = expression.Next(fire) {
+		fires = append(fires, fire)
+	}
+	if len(fires) > DEMORUNS {
+		fires = fires[len(fires)-DEMORUNS:]
+	}
+
+	snapshot, err := json.Marshal(pipeline)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	steps := 0
+	for _, fire := range fires {
+		record := &models.PipelineRecords{
+			Id:         uuid.NewV4().String(),
+			PipelineId: pipeline.Id,
+			NodeId:     node.Id,
+			WorkerName: node.Name,
+			Spec:       pipeline.Spec,
+			Trigger:    models.TRIGGERSCHEDULE,
+			Attempt:    1,
+			Snapshot:   string(snapshot),
+			Tags:       models.Tags{"demo": "true"},
+			Status:     models.RECORDFINISHED,
+			BeginWith:  utils.Time(fire),
+			CreatedAt:  utils.Time(fire),
+		}
+
+		// 失败的执行在最后一步失败
+		failed := random.Intn(10) == 0
+		begin := fire
+		for step, index := range indexes {
+			task := tasks[index]
+			duration := time.Duration(1+random.Intn(60)) * time.Second
+			taskRecord := &models.TaskRecords{
+				PipelineRecordId: record.Id,
+				TaskId:           task.Task.Id,
+				NodeId:           node.Id,
+				TaskName:         task.Task.Name,
+				WorkerName:       node.Name,
+				Content:          task.Task.Content,
+				Mode:             task.Task.Mode,
+				Url:              task.Task.Url,
+				Method:           task.Task.Method,
+				Status:           "finished",
+				Result:           task.Output,
+				Stdout:           task.Output,
+				Duration:         int64(duration.Seconds()),
+				BeginWith:        utils.Time(begin),
+				FinishWith:       utils.Time(begin.Add(duration)),
+				CreatedAt:        utils.Time(begin.Add(duration)),
+			}
+
+			if failed && step == len(indexes)-1 {
+				taskRecord.Status = "failed"
+				taskRecord.ExitCode = 1
+				taskRecord.Stderr = "error: connection refused"
+				taskRecord.Result = fmt.Sprintf("%s%s\n", task.Output, taskRecord.Stderr)
+				record.Status = models.RECORDFAILED
+			}
+
+			if _, err := session.Insert(taskRecord); err != nil {
+				return 0, 0, err
+			}
+			begin = begin.Add(duration)
+			steps++
+		}
+
+		record.FinishWith = utils.Time(begin)
+		record.UpdatedAt = utils.Time(begin)
+		record.HeartbeatAt = utils.Time(begin)
+		record.Duration = int64(begin.Sub(fire).Seconds())
+		if _, err := session.Insert(record); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return len(fires), steps, nil
+}
+
+// 演示任务，覆盖 Shell 和 HTTP 两种常用的任务类型
+func tasks() []demoTask {
+	return []demoTask{
+		{
+			Task: models.Task{
+				Name:        "Dump database",
+				Mode:        models.MODESHELL,
+				Content:     `pg_dump "$DATABASE_URL" | gzip > /tmp/ects-demo-$(date +%F).sql.gz`,
+				Description: "导出数据库",
+				Timeout:     600,
+			},
+			Output: "pg_dump: dumping contents of 12 tables\n",
+		},
+		{
+			Task: models.Task{
+				Name:          "Upload backup",
+				Mode:          models.MODESHELL,
+				Content:       `aws s3 cp /tmp/ects-demo-$(date +%F).sql.gz "s3://$BUCKET/"`,
+				Description:   "上传备份文件",
+				Retries:       2,
+				RetryInterval: 30,
+				Backoff:       2,
+			},
+			Output: "upload: ./ects-demo.sql.gz to s3://ects-demo-backups/ects-demo.sql.gz\n",
+		},
+		{
+			Task: models.Task{
+				Name:        "Check website",
+				Mode:        models.MODEHTTP,
+				Url:         "https://example.com/health",
+				Method:      "GET",
+				Description: "检查网站是否可以访问",
+				Timeout:     10,
+			},
+			Output: "{\"status\":\"ok\"}\n",
+		},
+		{
+			Task: models.Task{
+				Name:        "Clean temporary files",
+				Mode:        models.MODESHELL,
+				Content:     `find /tmp -name 'ects-demo-*' -mtime +7 -print -delete`,
+				Description: "清理一周前的临时文件",
+			},
+			Output: "/tmp/ects-demo-backup.sql.gz\n",
+		},
+		{
+			Task: models.Task{
+				Name:        "Send weekly report",
+				Mode:        models.MODESHELL,
+				Content:     `echo "weekly report generated at $(date)"`,
+				Description: "生成周报",
+			},
+			Output: "weekly report generated\n",
+		},
+	}
+}
+
+// 演示流水线，包含多步骤、高频和低频三种场景
+func pipelines(projectId string) []demoPipeline {
+	return []demoPipeline{
+		{
+			Pipeline: models.Pipeline{
+				Name:        "Nightly database backup",
+				ProjectId:   projectId,
+				Description: "每天凌晨两点导出数据库并上传",
+				Spec:        "0 0 2 * * * *",
+				Status:      models.PIPELINEDISABLED,
+				Synced:      models.SYNCPENDING,
+				Policy:      models.POLICYALL,
+				Misfire:     models.MISFIREONCE,
+				Timeout:     3600,
+				Variables:   models.Variables{"BUCKET": "ects-demo-backups", "DATABASE_URL": "postgres://demo@localhost/demo"},
+			},
+			Steps: []int{0, 1},
+		},
+		{
+			Pipeline: models.Pipeline{
+				Name:        "Website health check",
+				ProjectId:   projectId,
+				Description: "每五分钟检查一次网站",
+				Spec:        "0 */5 * * * * *",
+				Status:      models.PIPELINEDISABLED,
+				Synced:      models.SYNCPENDING,
+				Policy:      models.POLICYALL,
+				Concurrency: models.CONCURRENCYFORBID,
+				Misfire:     models.MISFIRESKIP,
+			},
+			Steps: []int{2},
+		},
+		{
+			Pipeline: models.Pipeline{
+				Name:        "Weekly cleanup",
+				ProjectId:   projectId,
+				Description: "每周日清理临时文件并发送周报",
+				Spec:        "0 0 3 * * 0 *",
+				Status:      models.PIPELINEDISABLED,
+				Synced:      models.SYNCPENDING,
+				Policy:      models.POLICYALL,
+				Misfire:     models.MISFIRESKIP,
+			},
+			Steps: []int{3, 4},
+		},
+	}
+}
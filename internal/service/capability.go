@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// 需要探测的解释器和工具，以及获取版本号的参数
+	probes = map[string][]string{
+		"bash":    {"bash", "--version"},
+		"python":  {"python", "--version"},
+		"python3": {"python3", "--version"},
+		"node":    {"node", "--version"},
+		"php":     {"php", "--version"},
+		"java":    {"java", "-version"},
+		"go":      {"go", "version"},
+		"git":     {"git", "--version"},
+		"docker":  {"docker", "--version"},
+	}
+	versionPattern = regexp.MustCompile(`\d+(\.\d+)+`)
+)
+
+// 探测当前节点已安装的解释器和工具版本
+func DetectCapabilities() map[string]string {
+	capabilities := make(map[string]string)
+	for name, probe := range probes {
+		if _, err := exec.LookPath(probe[0]); err != nil {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		output, err := exec.CommandContext(ctx, probe[0], probe[1:]...).CombinedOutput()
+		cancel()
+		if err != nil {
+			continue
+		}
+
+		line := strings.SplitN(strings.TrimSpace(string(output)), "\n", 2)[0]
+		version := versionPattern.FindString(line)
+		if version == "" {
+			version = "unknown"
+		}
+		capabilities[name] = version
+	}
+
+	// 创建命名空间需要 root 权限
+	if runtime.GOOS == "linux" && os.Geteuid() == 0 {
+		capabilities["sandbox"] = "unknown"
+	}
+
+	return capabilities
+}
+
+// 获取最近一分钟的系统平均负载，不支持的系统返回 0
+func LoadAverage() float64 {
+	content, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0
+	}
+
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return 0
+	}
+
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+
+	return load
+}
@@ -1,15 +1,25 @@
 package service
 
+import (
+	"github.com/betterde/ects/models"
+)
+
 type (
 	Instance struct {
-		Id          string `json:"id"`
-		Name        string `json:"name"`
-		Host        string `json:"host"`
-		Port        int    `json:"port"`
-		Mode        string `json:"mode"`
-		Status      string `json:"status"`
-		Version     string `json:"version"`
-		Description string `json:"description"`
+		Id           string                  `json:"id"`
+		Name         string                  `json:"name"`
+		Host         string                  `json:"host"`
+		Port         int                     `json:"port"`
+		Mode         string                  `json:"mode"`
+		Status       string                  `json:"status"`
+		Version      string                  `json:"version"`
+		Description  string                  `json:"description"`
+		Capabilities map[string]string       `json:"capabilities,omitempty"`
+		Volumes      []string                `json:"volumes,omitempty"`
+		Capacity     int                     `json:"capacity"`
+		Timezone     string                  `json:"timezone,omitempty"`
+		Policy       *models.NodePolicy      `json:"policy,omitempty"`
+		Windows      models.ExecutionWindows `json:"windows,omitempty"`
 	}
 )
 
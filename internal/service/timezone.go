@@ -0,0 +1,24 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 获取当前节点的时区名称，优先使用 IANA 名称，无法获取时使用时区缩写
+func DetectTimezone() string {
+	if tz := os.Getenv("TZ"); tz != "" && !strings.HasPrefix(tz, ":") && !strings.HasPrefix(tz, "/") {
+		return tz
+	}
+
+	if link, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+		if index := strings.Index(link, "zoneinfo/"); index >= 0 {
+			return link[index+len("zoneinfo/"):]
+		}
+	}
+
+	abbr, _ := time.Now().Zone()
+	return abbr
+}
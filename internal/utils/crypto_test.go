@@ -0,0 +1,22 @@
+package utils
+
+import "testing"
+
+func TestEncrypt(t *testing.T) {
+	ciphertext, err := Encrypt("passphrase", "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plaintext, err := Decrypt("passphrase", ciphertext); err != nil || plaintext != "s3cr3t" {
+		t.Errorf("expected the original value, got %q, %v", plaintext, err)
+	}
+
+	if _, err := Decrypt("another", ciphertext); err == nil {
+		t.Error("expected decryption with another passphrase to fail")
+	}
+
+	if _, err := Decrypt("passphrase", "bm9wZQ=="); err != ErrCiphertext {
+		t.Errorf("expected ErrCiphertext, got %v", err)
+	}
+}
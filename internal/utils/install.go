@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"github.com/betterde/ects/config"
 	"log"
+	"os"
+	"path/filepath"
 )
 
 var (
@@ -12,19 +14,21 @@ var (
 	err error
 )
 
+// 连接数据库服务，不指定具体的数据库
 func Init() {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/?charset=%s",
-		config.Conf.Database.User,
-		config.Conf.Database.Pass,
-		config.Conf.Database.Host,
-		config.Conf.Database.Port,
-		config.Conf.Database.Char,
-	)
-
-	DB, err = sql.Open("mysql", dsn)
+	database := &config.Conf.Database
+	DB, err = sql.Open(database.Dialect(), database.DataSource(""))
 }
 
 func IsDatabaseExist() bool {
+	database := &config.Conf.Database
+
+	// SQLite 的数据库就是文件
+	if database.Dialect() == config.DRIVERSQLITE {
+		_, err := os.Stat(database.Name)
+		return err == nil
+	}
+
 	Init()
 	defer func() {
 		if err := DB.Close(); err != nil {
@@ -32,23 +36,27 @@ func IsDatabaseExist() bool {
 		}
 	}()
 
-	statement := fmt.Sprintf("SHOW DATABASES LIKE '%s'", config.Conf.Database.Name)
-
 	var (
 		rows     *sql.Rows
 		Database string
 	)
 
-	rows, err = DB.Query(statement)
+	if database.Dialect() == config.DRIVERPOSTGRES {
+		rows, err = DB.Query("SELECT datname FROM pg_database WHERE datname = $1", database.Name)
+	} else {
+		rows, err = DB.Query(fmt.Sprintf("SHOW DATABASES LIKE '%s'", database.Name))
+	}
 	if err != nil {
 		log.Println(err)
+		return false
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		if err := rows.Scan(&Database); err != nil {
 			log.Println(err)
 		}
-		if Database == config.Conf.Database.Name {
+		if Database == database.Name {
 			return true
 		}
 	}
@@ -57,8 +65,26 @@ func IsDatabaseExist() bool {
 }
 
 func CreateDatabase() error {
+	database := &config.Conf.Database
+
+	switch database.Dialect() {
+	case config.DRIVERSQLITE:
+		// 数据库文件在第一次连接时创建，只需要确保目录存在
+		return os.MkdirAll(filepath.Dir(database.Name), 0755)
+	case config.DRIVERPOSTGRES:
+		// PostgreSQL 不支持 CREATE DATABASE IF NOT EXISTS
+		if IsDatabaseExist() {
+			return nil
+		}
+
+		Init()
+		defer DB.Close()
+		_, err := DB.Exec(fmt.Sprintf(`CREATE DATABASE "%s" ENCODING 'UTF8'`, database.Name))
+		return err
+	}
+
 	Init()
-	statement := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s DEFAULT CHARACTER SET %s DEFAULT COLLATE %s", config.Conf.Database.Name, config.Conf.Char, "utf8mb4_unicode_ci")
+	statement := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s DEFAULT CHARACTER SET %s DEFAULT COLLATE %s", database.Name, database.Char, "utf8mb4_unicode_ci")
 	_, err := DB.Query(statement)
 	return err
 }
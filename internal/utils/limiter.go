@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// 固定时间窗口内的请求次数限制，仅在当前进程内生效
+	Limiter struct {
+		mutex  sync.Mutex
+		limit  int
+		window time.Duration
+		hits   map[string]*hit
+	}
+	hit struct {
+		count int
+		reset time.Time
+	}
+)
+
+func NewLimiter(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		limit:  limit,
+		window: window,
+		hits:   make(map[string]*hit),
+	}
+}
+
+// 记录一次请求，返回是否允许
+func (limiter *Limiter) Allow(key string) bool {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := time.Now()
+	for k, h := range limiter.hits {
+		if now.After(h.reset) {
+			delete(limiter.hits, k)
+		}
+	}
+
+	h, exist := limiter.hits[key]
+	if !exist {
+		h = &hit{reset: now.Add(limiter.window)}
+		limiter.hits[key] = h
+	}
+
+	if h.count >= limiter.limit {
+		return false
+	}
+
+	h.count++
+	return true
+}
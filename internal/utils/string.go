@@ -1,6 +1,10 @@
 package utils
 
-import "math/rand"
+import (
+	"math/rand"
+	"strings"
+	"unicode/utf8"
+)
 
 const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
@@ -11,3 +15,22 @@ func Random(lenght int) string {
 	}
 	return string(b)
 }
+
+// 保留文本末尾不超过 limit 字节的部分，从完整的行开始，返回是否被截断
+func TailBytes(text string, limit int) (string, bool) {
+	if limit <= 0 || len(text) <= limit {
+		return text, false
+	}
+
+	tail := text[len(text)-limit:]
+	if index := strings.IndexByte(tail, '\n'); index >= 0 && index < len(tail)-1 {
+		return tail[index+1:], true
+	}
+
+	// 没有换行时从完整的字符开始
+	for len(tail) > 0 && !utf8.RuneStart(tail[0]) {
+		tail = tail[1:]
+	}
+
+	return tail, true
+}
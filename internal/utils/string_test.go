@@ -10,3 +10,17 @@ func TestRandom(t *testing.T) {
 		t.Errorf("随机生成字符串长度不匹配")
 	}
 }
+
+func TestTailBytes(t *testing.T) {
+	if text, truncated := TailBytes("short", 10); truncated || text != "short" {
+		t.Errorf("expected short text to be kept, got %q", text)
+	}
+
+	if text, truncated := TailBytes("first line\nsecond line\nthird\n", 16); !truncated || text != "third\n" {
+		t.Errorf("expected the tail to start at a complete line, got %q", text)
+	}
+
+	if text, truncated := TailBytes("输出没有换行", 7); !truncated || text != "换行" {
+		t.Errorf("expected the tail to start at a complete character, got %q", text)
+	}
+}
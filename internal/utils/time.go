@@ -11,6 +11,11 @@ type (
 const DefaultTimeFormat = "2006-01-02 15:04:05"
 
 func (t *Time) UnmarshalJSON(data []byte) error {
+	// 零值序列化为 null
+	if string(data) == "null" {
+		*t = Time{}
+		return nil
+	}
 	now, err := time.ParseInLocation(`"`+DefaultTimeFormat+`"`, string(data), time.Local)
 	*t = Time(now)
 	return err
@@ -10,3 +10,33 @@ func GetUID(ctx iris.Context) string {
 	claims, _ := token.Claims.(jwt.MapClaims)
 	return claims["sub"].(string)
 }
+
+// 获取代理当前用户操作的管理员ID，未代理时返回空字符串
+func GetImpersonator(ctx iris.Context) string {
+	token := ctx.Values().Get("jwt").(*jwt.Token)
+	claims, _ := token.Claims.(jwt.MapClaims)
+	if act, ok := claims["act"].(string); ok {
+		return act
+	}
+	return ""
+}
+
+// 获取当前请求使用的 API 令牌ID，使用登录令牌时返回空字符串
+func GetTokenId(ctx iris.Context) string {
+	token := ctx.Values().Get("jwt").(*jwt.Token)
+	claims, _ := token.Claims.(jwt.MapClaims)
+	if id, ok := claims["tok"].(string); ok {
+		return id
+	}
+	return ""
+}
+
+// 获取 API 令牌的权限范围，使用登录令牌时返回空字符串
+func GetScope(ctx iris.Context) string {
+	token := ctx.Values().Get("jwt").(*jwt.Token)
+	claims, _ := token.Claims.(jwt.MapClaims)
+	if scope, ok := claims["scp"].(string); ok {
+		return scope
+	}
+	return ""
+}
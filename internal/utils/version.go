@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// 比较两个以点分隔的版本号，a 大于 b 返回 1，小于返回 -1，相等返回 0
+func CompareVersion(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x > y {
+			return 1
+		}
+		if x < y {
+			return -1
+		}
+	}
+
+	return 0
+}
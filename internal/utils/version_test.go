@@ -0,0 +1,21 @@
+package utils
+
+import "testing"
+
+func TestCompareVersion(t *testing.T) {
+	cases := []struct {
+		a, b   string
+		result int
+	}{
+		{"3.6.9", "3.6", 1},
+		{"3.6", "3.6.0", 0},
+		{"2.7.18", "3.6", -1},
+		{"19.03.5", "18.09", 1},
+	}
+
+	for _, c := range cases {
+		if result := CompareVersion(c.a, c.b); result != c.result {
+			t.Errorf("版本号 %s 与 %s 的比较结果应为 %d，实际为 %d", c.a, c.b, c.result, result)
+		}
+	}
+}
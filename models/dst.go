@@ -0,0 +1,102 @@
+package models
+
+import (
+	"github.com/gorhill/cronexpr"
+	"sort"
+	"time"
+)
+
+const (
+	DSTSKIP   = "skip"   // 跳过夏令时开始时不存在的本地时间，重复的本地时间只在第一次出现时执行
+	DSTADJUST = "adjust" // 不存在的本地时间顺延到时钟调整之后执行，重复的本地时间只在第一次出现时执行
+	DSTTWICE  = "twice"  // 不存在的本地时间顺延执行，重复的本地时间在两次出现时各执行一次
+
+	DSTMAXSTEPS = 1000 // 计算下一次触发时间时最多跳过的本地时间
+)
+
+// 按照夏令时策略计算 after 之后的下一次触发时间，没有下一次触发时返回零值。
+// 定时器表达式按照 location 的本地时间匹配，本地时间在时钟调整时可能不存在或者出现两次
+func NextFire(expression *cronexpr.Expression, after time.Time, location *time.Location, policy string) time.Time {
+	if location == nil {
+		location = time.Local
+	}
+
+	// 先在没有时钟调整的 UTC 中按照本地时间的数值计算，再换算回实际的时间
+	wall := WallClock(after, location)
+
+	// 时钟回拨后本地时间会倒退，从一个调整周期之前开始查找，避免漏掉第二次出现的时间
+	if _, overlapped := Instants(wall, location); len(overlapped) > 1 {
+		wall = wall.Add(-overlapped[1].Sub(overlapped[0]))
+	}
+
+	for step := 0; step < DSTMAXSTEPS; step++ {
+		wall = expression.Next(wall)
+		if wall.IsZero() {
+			return time.Time{}
+		}
+
+		instant, instants := Instants(wall, location)
+		switch {
+		case len(instants) == 0:
+			// 夏令时开始，本地时间不存在
+			if policy != DSTSKIP && instant.After(after) {
+				return instant
+			}
+		case len(instants) > 1 && policy == DSTTWICE:
+			for _, candidate := range instants {
+				if candidate.After(after) {
+					return candidate
+				}
+			}
+		default:
+			if instants[0].After(after) {
+				return instants[0]
+			}
+		}
+	}
+
+	return time.Time{}
+}
+
+// 将 UTC 中表示的本地时间换算为 location 中的实际时间，按照先后顺序返回所有可能的时间：
+// 本地时间不存在时返回空，并返回按照调整前的偏移量顺延后的时间；本地时间重复时返回两个时间
+func Instants(wall time.Time, location *time.Location) (time.Time, []time.Time) {
+	seconds := wall.Unix()
+	offsets := make([]int, 0, 3)
+	for _, probe := range []int64{seconds - 86400, seconds, seconds + 86400} {
+		_, offset := time.Unix(probe, 0).In(location).Zone()
+		offsets = append(offsets, offset)
+	}
+
+	instants := make([]time.Time, 0, 2)
+	seen := make(map[int64]bool)
+	for _, offset := range offsets {
+		candidate := time.Unix(seconds-int64(offset), int64(wall.Nanosecond())).In(location)
+		if seen[candidate.Unix()] || !sameWall(candidate, wall) {
+			continue
+		}
+		seen[candidate.Unix()] = true
+		instants = append(instants, candidate)
+	}
+
+	sort.Slice(instants, func(i, j int) bool {
+		return instants[i].Before(instants[j])
+	})
+
+	if len(instants) > 0 {
+		return instants[0], instants
+	}
+
+	return time.Unix(seconds-int64(offsets[0]), int64(wall.Nanosecond())).In(location), instants
+}
+
+// 将时间在 location 中的本地时间表示为 UTC 中相同数值的时间
+func WallClock(instant time.Time, location *time.Location) time.Time {
+	local := instant.In(location)
+	return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), local.Nanosecond(), time.UTC)
+}
+
+func sameWall(instant, wall time.Time) bool {
+	return instant.Year() == wall.Year() && instant.YearDay() == wall.YearDay() &&
+		instant.Hour() == wall.Hour() && instant.Minute() == wall.Minute() && instant.Second() == wall.Second()
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"github.com/gorhill/cronexpr"
+	"testing"
+	"time"
+)
+
+func load(t *testing.T, name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("timezone %s not available: %s", name, err)
+	}
+	return location
+}
+
+func fires(expression *cronexpr.Expression, from, to time.Time, location *time.Location, policy string) []time.Time {
+	result := make([]time.Time, 0)
+	for fire := NextFire(expression, from, location, policy); !fire.IsZero() && fire.Before(to); fire = NextFire(expression, fire, location, policy) {
+		result = append(result, fire)
+	}
+	return result
+}
+
+func TestNextFireTransitions(t *testing.T) {
+	cases := []struct {
+		zone   string
+		spec   string
+		from   string
+		policy string
+		want   []string
+	}{
+		// 纽约 2019-03-10 02:00 时钟拨快到 03:00，02:30 不存在
+		{"America/New_York", "0 30 2 * * * *", "2019-03-09T12:00:00Z", DSTSKIP, []string{"2019-03-11T06:30:00Z"}},
+		{"America/New_York", "0 30 2 * * * *", "2019-03-09T12:00:00Z", DSTADJUST, []string{"2019-03-10T07:30:00Z", "2019-03-11T06:30:00Z"}},
+		{"America/New_York", "0 30 2 * * * *", "2019-03-09T12:00:00Z", DSTTWICE, []string{"2019-03-10T07:30:00Z", "2019-03-11T06:30:00Z"}},
+		// 纽约 2019-11-03 02:00 时钟回拨到 01:00，01:30 出现两次
+		{"America/New_York", "0 30 1 * * * *", "2019-11-02T12:00:00Z", DSTSKIP, []string{"2019-11-03T05:30:00Z", "2019-11-04T06:30:00Z"}},
+		{"America/New_York", "0 30 1 * * * *", "2019-11-02T12:00:00Z", DSTADJUST, []string{"2019-11-03T05:30:00Z", "2019-11-04T06:30:00Z"}},
+		{"America/New_York", "0 30 1 * * * *", "2019-11-02T12:00:00Z", DSTTWICE, []string{"2019-11-03T05:30:00Z", "2019-11-03T06:30:00Z", "2019-11-04T06:30:00Z"}},
+		// 伦敦 2019-03-31 01:00 拨快到 02:00
+		{"Europe/London", "0 15 1 * * * *", "2019-03-30T12:00:00Z", DSTSKIP, []string{"2019-04-01T00:15:00Z"}},
+		{"Europe/London", "0 15 1 * * * *", "2019-03-30T12:00:00Z", DSTADJUST, []string{"2019-03-31T01:15:00Z", "2019-04-01T00:15:00Z"}},
+		// 悉尼 2019-04-07 03:00 回拨到 02:00，南半球在四月结束夏令时
+		{"Australia/Sydney", "0 30 2 * * * *", "2019-04-06T00:00:00Z", DSTTWICE, []string{"2019-04-06T15:30:00Z", "2019-04-06T16:30:00Z", "2019-04-07T16:30:00Z"}},
+		// 没有夏令时的时区不受策略影响
+		{"Asia/Shanghai", "0 0 2 * * * *", "2019-03-09T12:00:00Z", DSTSKIP, []string{"2019-03-09T18:00:00Z", "2019-03-10T18:00:00Z"}},
+	}
+
+	for _, c := range cases {
+		location := load(t, c.zone)
+		from, _ := time.Parse(time.RFC3339, c.from)
+		last, _ := time.Parse(time.RFC3339, c.want[len(c.want)-1])
+		got := fires(cronexpr.MustParse(c.spec), from, last.Add(time.Second), location, c.policy)
+
+		if len(got) != len(c.want) {
+			t.Errorf("%s %s %s: got %v, want %v", c.zone, c.spec, c.policy, got, c.want)
+			continue
+		}
+		for index, fire := range got {
+			if want, _ := time.Parse(time.RFC3339, c.want[index]); !fire.Equal(want) {
+				t.Errorf("%s %s %s: fire %d is %s, want %s", c.zone, c.spec, c.policy, index, fire.UTC(), want)
+			}
+		}
+	}
+}
+
+// 在多个时区中逐年展开常见的定时器，检查触发时间严格递增、匹配本地时间并且符合夏令时策略
+func TestNextFireHarness(t *testing.T) {
+	zones := []string{"America/New_York", "Europe/London", "Australia/Sydney", "Asia/Tehran", "Australia/Lord_Howe", "UTC"}
+	specs := []string{"0 */15 * * * * *", "0 30 1 * * * *", "0 30 2 * * * *", "0 0 0 * * * *"}
+	from := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0)
+
+	for _, zone := range zones {
+		location := load(t, zone)
+		for _, spec := range specs {
+			expression := cronexpr.MustParse(spec)
+			for _, policy := range []string{DSTSKIP, DSTADJUST, DSTTWICE} {
+				seen := make(map[string]int)
+				var previous time.Time
+				for _, fire := range fires(expression, from, to, location, policy) {
+					if !fire.After(previous) {
+						t.Fatalf("%s %s %s: %s is not after %s", zone, spec, policy, fire, previous)
+					}
+					previous = fire
+
+					wall := fire.In(location).Format("2006-01-02 15:04:05")
+					seen[wall]++
+					clock := WallClock(fire, location)
+					_, instants := Instants(clock, location)
+
+					// 只有顺延的触发时间不匹配定时器
+					if policy == DSTSKIP && !expression.Next(clock.Add(-time.Second)).Equal(clock) {
+						t.Fatalf("%s %s %s: %s does not match the expression", zone, spec, policy, clock)
+					}
+
+					if policy != DSTTWICE && seen[wall] > 1 {
+						t.Fatalf("%s %s %s: local time %s fired twice", zone, spec, policy, wall)
+					}
+					if seen[wall] > len(instants) && len(instants) > 0 {
+						t.Fatalf("%s %s %s: local time %s fired %d times", zone, spec, policy, wall, seen[wall])
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"path"
+	"strings"
+)
+
+// 节点是否提供任务声明的数据位置，位置为绝对路径时匹配节点声明的同一目录或其子目录，否则按照数据卷标签精确匹配
+func Local(volumes []string, hint string) bool {
+	hint = strings.TrimSpace(hint)
+	if hint == "" {
+		return true
+	}
+
+	for _, volume := range volumes {
+		volume = strings.TrimSpace(volume)
+		if volume == hint {
+			return true
+		}
+
+		if !path.IsAbs(hint) || !path.IsAbs(volume) {
+			continue
+		}
+
+		root, target := path.Clean(volume), path.Clean(hint)
+		if root == "/" || target == root || strings.HasPrefix(target, root+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 节点满足的数据位置数量
+func LocalityScore(volumes, hints []string) int {
+	score := 0
+	for _, hint := range hints {
+		if Local(volumes, hint) {
+			score++
+		}
+	}
+
+	return score
+}
+
+// 流水线所有步骤声明的数据位置，去掉重复的位置
+func (pipeline *Pipeline) Locality() []string {
+	hints := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, step := range pipeline.Steps {
+		if step.Task == nil {
+			continue
+		}
+
+		for _, hint := range step.Task.Locality {
+			if hint = strings.TrimSpace(hint); hint != "" && !seen[hint] {
+				seen[hint] = true
+				hints = append(hints, hint)
+			}
+		}
+	}
+
+	return hints
+}
@@ -0,0 +1,29 @@
+package models
+
+import "testing"
+
+func TestLocal(t *testing.T) {
+	volumes := []string{"warehouse", "/data/archive/"}
+	cases := []struct {
+		hint string
+		want bool
+	}{
+		{"warehouse", true},
+		{"archive", false},
+		{"/data/archive", true},
+		{"/data/archive/2019/01", true},
+		{"/data/archived", false},
+		{"/data", false},
+		{"", true},
+	}
+
+	for _, item := range cases {
+		if got := Local(volumes, item.hint); got != item.want {
+			t.Errorf("Local(%v, %q) = %v, want %v", volumes, item.hint, got, item.want)
+		}
+	}
+
+	if score := LocalityScore(volumes, []string{"warehouse", "/data/archive/2019", "scratch"}); score != 2 {
+		t.Errorf("expected score 2, got %d", score)
+	}
+}
@@ -2,15 +2,35 @@ package models
 
 import (
 	"encoding/json"
+	"strings"
 	"time"
 )
 
+const (
+	RESOURCEPIPELINE = "pipeline"
+	RESOURCETASK     = "task"
+	RESOURCENODE     = "node"
+	RESOURCEPROJECT  = "project"
+	RESOURCETEAM     = "team"
+	RESOURCEUSER     = "user"
+	RESOURCETOKEN    = "token"
+	RESOURCERUN      = "run"
+	RESOURCETEMPLATE = "template"
+	RESOURCELIMIT    = "ratelimit"
+	RESOURCESECRET   = "secret"
+	RESOURCESYSTEM   = "system"
+)
+
 type Log struct {
-	Id        int64     `json:"id" xorm:"pk autoincr comment('ID') BIGINT(20)"`
-	UserId    string    `json:"user_id" xorm:"not null comment('用户ID') index CHAR(36)"`
-	Operation string    `json:"operation" xorm:"not null comment('操作') VARCHAR(255)"`
-	Result    string    `json:"result" xorm:"null comment('结果') LONGTEXT(0)"`
-	CreatedAt time.Time `json:"created_at" xorm:"not null comment('创建于') created DATETIME"`
+	Id           int64     `json:"id" xorm:"pk autoincr comment('ID') BIGINT(20)"`
+	UserId       string    `json:"user_id" xorm:"not null comment('用户ID') index CHAR(36)"`
+	Impersonator string    `json:"impersonator,omitempty" xorm:"null comment('代理操作的管理员ID') index CHAR(36)"`
+	Operation    string    `json:"operation" xorm:"not null comment('操作') VARCHAR(255)"`
+	Action       string    `json:"action" xorm:"null comment('动作') index VARCHAR(32)"`
+	Resource     string    `json:"resource" xorm:"null comment('操作对象类型') index VARCHAR(32)"`
+	ResourceId   string    `json:"resource_id" xorm:"null comment('操作对象ID') index VARCHAR(36)"`
+	Result       string    `json:"result" xorm:"null comment('结果') LONGTEXT(0)"`
+	CreatedAt    time.Time `json:"created_at" xorm:"not null comment('创建于') created DATETIME"`
 }
 
 // 定义日志表名称
@@ -26,6 +46,11 @@ func (log *Log) Store() error {
 
 // 创建用户操作日志
 func CreateLog(model Model, uid string, operation string) error {
+	return CreateImpersonatedLog(model, uid, "", operation)
+}
+
+// 创建管理员代理用户操作的日志
+func CreateImpersonatedLog(model Model, uid string, impersonator string, operation string) error {
 	var (
 		result string
 		err    error
@@ -36,16 +61,75 @@ func CreateLog(model Model, uid string, operation string) error {
 		return err
 	}
 
+	resource, id := describe(model)
 	log := &Log{
-		UserId:    uid,
-		Operation: operation,
-		Result:    result,
-		CreatedAt: time.Now(),
+		UserId:       uid,
+		Impersonator: impersonator,
+		Operation:    operation,
+		Action:       action(operation),
+		Resource:     resource,
+		ResourceId:   id,
+		Result:       result,
+		CreatedAt:    time.Now(),
 	}
 
 	return log.Store()
 }
 
+// 操作对象的类型和ID，关联关系记录为所属的流水线或团队
+func describe(model Model) (string, string) {
+	switch value := model.(type) {
+	case *Pipeline:
+		return RESOURCEPIPELINE, value.Id
+	case *PipelineTaskPivot:
+		return RESOURCEPIPELINE, value.PipelineId
+	case *PipelineNodePivot:
+		return RESOURCEPIPELINE, value.PipelineId
+	case *PipelineNotification:
+		return RESOURCEPIPELINE, value.PipelineId
+	case *Task:
+		return RESOURCETASK, value.Id
+	case *Node:
+		return RESOURCENODE, value.Id
+	case *Project:
+		return RESOURCEPROJECT, value.Id
+	case *Team:
+		return RESOURCETEAM, value.Id
+	case *TeamMember:
+		return RESOURCETEAM, value.TeamId
+	case *User:
+		return RESOURCEUSER, value.Id
+	case *Token:
+		return RESOURCETOKEN, value.Id
+	case *PipelineRecords:
+		return RESOURCERUN, value.Id
+	case *RunShare:
+		return RESOURCERUN, value.RunId
+	case *NotificationTemplate:
+		return RESOURCETEMPLATE, value.Id
+	case *RateLimit:
+		return RESOURCELIMIT, value.Id
+	case *Secret:
+		return RESOURCESECRET, value.Id
+	}
+
+	return RESOURCESYSTEM, ""
+}
+
+// 从操作中提取动作，例如 CREATE PIPELINE 的动作为 CREATE，BATCH BIND TASKS 的动作为 BIND
+func action(operation string) string {
+	if strings.HasPrefix(operation, "USER SIGN IN") {
+		return "SIGNIN"
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(operation, "BATCH "))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return fields[0]
+}
+
 // Marshal struct to json
 func (log *Log) MarshalJSON() ([]byte, error) {
 	type Alias Log
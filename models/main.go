@@ -1,11 +1,11 @@
 package models
 
 import (
-	"fmt"
 	"github.com/betterde/ects/config"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/go-xorm/core"
 	"github.com/go-xorm/xorm"
+	_ "github.com/lib/pq"
 	"time"
 )
 
@@ -27,15 +27,8 @@ var Engine *xorm.Engine
 const DefaultTimeFormat = "2006-01-02 15:04:05"
 
 func Connection() (*xorm.Engine, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s",
-		config.Conf.Database.User,
-		config.Conf.Database.Pass,
-		config.Conf.Database.Host,
-		config.Conf.Database.Port,
-		config.Conf.Database.Name,
-		config.Conf.Database.Char,
-	)
-	engine, err := xorm.NewEngine("mysql", dsn)
+	database := &config.Conf.Database
+	engine, err := xorm.NewEngine(database.Dialect(), database.DataSource(database.Name))
 	if engine != nil {
 		engine.SetMaxIdleConns(10)
 		engine.SetMaxOpenConns(30)
@@ -43,6 +36,13 @@ func Connection() (*xorm.Engine, error) {
 		engine.SetConnMaxLifetime(time.Second * 30)
 	}
 
+	// WAL 模式下读取不会阻塞写入，该模式会保存在数据库文件中
+	if err == nil && database.Dialect() == config.DRIVERSQLITE {
+		if _, err := engine.Exec("PRAGMA journal_mode=WAL"); err != nil {
+			return engine, err
+		}
+	}
+
 	go keepAlived()
 
 	return engine, err
@@ -58,9 +58,9 @@ func keepAlived() {
 	}
 }
 
-// 迁移数据库
-func Migrate() error {
-	tables := []interface{}{
+// 系统的全部数据表
+func tables() []interface{} {
+	return []interface{}{
 		&User{},
 		&Node{},
 		&Task{},
@@ -71,15 +71,40 @@ func Migrate() error {
 		&PipelineTaskPivot{},
 		&PipelineNodePivot{},
 		&TaskRecords{},
+		&Project{},
+		&NotificationTemplate{},
+		&Team{},
+		&TeamMember{},
+		&Token{},
+		&RateLimit{},
+		&PipelineNotification{},
+		&RunShare{},
+		&Secret{},
+		&RunGroup{},
+		&PipelineVersion{},
+		&TaskTemplate{},
 	}
+}
 
-	if err := Engine.DropTables(tables...); err != nil {
+// 迁移数据库
+func Migrate() error {
+	if err := Engine.DropTables(tables()...); err != nil {
 		return err
 	}
 
-	if err := Engine.Charset("utf8mb4").Sync2(tables...); err != nil {
+	if err := Engine.Charset("utf8mb4").Sync2(tables()...); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// 升级已安装系统的数据表结构，只新增表、字段和索引，不删除数据
+func Upgrade() error {
+	installed, err := Engine.IsTableExist(&User{})
+	if err != nil || !installed {
+		return err
+	}
+
+	return Engine.Charset("utf8mb4").Sync2(tables()...)
+}
@@ -3,29 +3,35 @@ package models
 import (
 	"encoding/json"
 	"github.com/betterde/ects/internal/utils"
-	"github.com/go-xorm/builder"
 )
 
 const (
 	ONLINE  = "online"
 	OFFLINE = "offline"
+	DRAINED = "drained" // 维护中，不再执行新的流水线，重新上线或离线时保持该状态
 	MASTER  = "master"
 	WORKER  = "worker"
 )
 
 type (
 	Node struct {
-		Id          string               `json:"id" xorm:"not null pk comment('用户ID') CHAR(36)"`
-		Name        string               `json:"name" xorm:"not null comment('名称') VARCHAR(255)"`
-		Host        string               `json:"host" xorm:"not null comment('主机地址') VARCHAR(255)"`
-		Port        int                  `json:"port" xorm:"not null comment('端口') SMALLINT(5)"`
-		Mode        string               `json:"mode" xorm:"not null comment('节点类型') CHAR(6)"`
-		Status      string               `json:"status" xorm:"not null default('connected') comment('状态') VARCHAR(255)"` // 状态
-		Version     string               `json:"version" xorm:"not null comment('版本') VARCHAR(255)"`                     // 版本
-		Description string               `json:"description" xorm:"comment('描述') VARCHAR(255)"`                          // 描述信息
-		CreatedAt   utils.Time           `json:"created_at" xorm:"not null created comment('创建于') DATETIME"`             // 创建于
-		UpdatedAt   utils.Time           `json:"updated_at" xorm:"not null updated comment('更新于') DATETIME"`             // 更新于
-		Pipelines   []*PipelineNodePivot `json:"pipelines" xorm:"-"`                                                     // 关联的流水线
+		Id           string               `json:"id" xorm:"not null pk comment('用户ID') CHAR(36)"`
+		Name         string               `json:"name" xorm:"not null comment('名称') VARCHAR(255)"`
+		Host         string               `json:"host" xorm:"not null comment('主机地址') VARCHAR(255)"`
+		Port         int                  `json:"port" xorm:"not null comment('端口') SMALLINT(5)"`
+		Mode         string               `json:"mode" xorm:"not null comment('节点类型') CHAR(6)"`
+		Status       string               `json:"status" xorm:"not null default('connected') comment('状态') VARCHAR(255)"` // 状态
+		Version      string               `json:"version" xorm:"not null comment('版本') VARCHAR(255)"`                     // 版本
+		Description  string               `json:"description" xorm:"comment('描述') VARCHAR(255)"`                          // 描述信息
+		Capabilities map[string]string    `json:"capabilities" xorm:"null comment('环境能力') TEXT"`                          // 已安装的解释器和工具
+		Volumes      []string             `json:"volumes" xorm:"null comment('数据卷') TEXT"`                                // 节点提供的数据卷标签或目录
+		Capacity     int                  `json:"capacity" xorm:"not null default 0 comment('最大并发数') INT(10)"`            // 同时执行的流水线上限，0 表示不限制
+		Timezone     string               `json:"timezone" xorm:"null comment('时区') VARCHAR(64)"`                         // 调度使用的本地时区
+		Policy       *NodePolicy          `json:"policy" xorm:"null comment('执行策略') TEXT"`                                // 允许执行的任务类型和项目
+		Windows      ExecutionWindows     `json:"windows" xorm:"null comment('执行时间段') TEXT"`                              // 允许执行流水线的时间段
+		CreatedAt    utils.Time           `json:"created_at" xorm:"not null created comment('创建于') DATETIME"`             // 创建于
+		UpdatedAt    utils.Time           `json:"updated_at" xorm:"not null updated comment('更新于') DATETIME"`             // 更新于
+		Pipelines    []*PipelineNodePivot `json:"pipelines" xorm:"-"`                                                     // 关联的流水线
 	}
 )
 
@@ -62,9 +68,18 @@ func (node *Node) Offline() {
 	}
 }
 
-// 创建或更新节点
+// 节点是否处于维护状态
+func (node *Node) Drained() bool {
+	return node.Status == DRAINED
+}
+
+// 创建或更新节点，维护中的节点重新注册时保持维护状态
 func (node *Node) CreateOrUpdate() error {
-	if count, err := Engine.Where(builder.Eq{"id": node.Id}).Count(&Node{}); count > 0 && err == nil {
+	origin := &Node{}
+	if exist, err := Engine.Id(node.Id).Cols("status").Get(origin); exist && err == nil {
+		if origin.Drained() {
+			node.Status = DRAINED
+		}
 		return node.Update()
 	}
 
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// 节点执行策略，由节点管理员在启动节点时设置，白名单为空时不限制
+type NodePolicy struct {
+	AllowModes    []string `json:"allow_modes,omitempty"`
+	DenyModes     []string `json:"deny_modes,omitempty"`
+	AllowProjects []string `json:"allow_projects,omitempty"`
+	DenyProjects  []string `json:"deny_projects,omitempty"`
+}
+
+// 检查流水线是否可以在节点上执行，返回第一个被拒绝的步骤
+func (policy *NodePolicy) Permit(pipeline *Pipeline) (*PipelineTaskPivot, error) {
+	if policy == nil {
+		return nil, nil
+	}
+
+	if contains(policy.DenyProjects, pipeline.ProjectId) {
+		return nil, fmt.Errorf("节点禁止执行项目 %s 的流水线", pipeline.ProjectId)
+	}
+
+	if len(policy.AllowProjects) > 0 && !contains(policy.AllowProjects, pipeline.ProjectId) {
+		return nil, fmt.Errorf("节点只允许执行指定项目的流水线")
+	}
+
+	for _, step := range pipeline.Steps {
+		if step.Task == nil {
+			continue
+		}
+
+		if !policy.AllowMode(step.Task.Mode) {
+			return step, fmt.Errorf("节点不允许执行 %s 类型的任务", step.Task.Mode)
+		}
+	}
+
+	return nil, nil
+}
+
+// 检查节点是否允许执行指定类型的任务
+func (policy *NodePolicy) AllowMode(mode string) bool {
+	if policy == nil {
+		return true
+	}
+
+	if contains(policy.DenyModes, mode) {
+		return false
+	}
+
+	return len(policy.AllowModes) == 0 || contains(policy.AllowModes, mode)
+}
+
+// 从数据库读取
+func (policy *NodePolicy) FromDB(data []byte) error {
+	return json.Unmarshal(data, policy)
+}
+
+// 保存到数据库
+func (policy *NodePolicy) ToDB() ([]byte, error) {
+	return json.Marshal(policy)
+}
+
+func contains(items []string, value string) bool {
+	for _, item := range items {
+		if item == value && value != "" {
+			return true
+		}
+	}
+
+	return false
+}
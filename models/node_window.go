@@ -0,0 +1,91 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	WINDOWDEFERRED = "deferred" // 执行时间段外推迟到时间段开始后执行
+	WINDOWREROUTED = "rerouted" // 执行时间段外转交给其他节点执行
+)
+
+// 节点允许执行流水线的时间段，格式为 HH:MM-HH:MM，按照节点的本地时间判断，结束时间早于开始时间时跨越午夜，为空时不限制
+type ExecutionWindows []string
+
+// 校验时间段的格式
+func (windows ExecutionWindows) Validate() error {
+	for _, window := range windows {
+		if _, _, err := span(window); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 判断时间是否在任一时间段内
+func (windows ExecutionWindows) Open(at time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+
+	minute := at.Hour()*60 + at.Minute()
+	for _, window := range windows {
+		begin, end, err := span(window)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case begin == end:
+			return true
+		case begin < end && minute >= begin && minute < end:
+			return true
+		case begin > end && (minute >= begin || minute < end):
+			return true
+		}
+	}
+
+	return false
+}
+
+// 获取 at 之后最近一个时间段的开始时间，at 在时间段内时直接返回 at
+func (windows ExecutionWindows) Next(at time.Time) time.Time {
+	if windows.Open(at) {
+		return at
+	}
+
+	var next time.Time
+	for _, window := range windows {
+		begin, _, err := span(window)
+		if err != nil {
+			continue
+		}
+
+		opening := time.Date(at.Year(), at.Month(), at.Day(), begin/60, begin%60, 0, 0, at.Location())
+		if !opening.After(at) {
+			opening = opening.AddDate(0, 0, 1)
+		}
+
+		if next.IsZero() || opening.Before(next) {
+			next = opening
+		}
+	}
+
+	return next
+}
+
+// 解析时间段，返回开始和结束时间距离零点的分钟数
+func span(window string) (int, int, error) {
+	var beginHour, beginMinute, endHour, endMinute int
+	if _, err := fmt.Sscanf(window, "%d:%d-%d:%d", &beginHour, &beginMinute, &endHour, &endMinute); err != nil {
+		return 0, 0, fmt.Errorf("执行时间段 %s 的格式应为 HH:MM-HH:MM", window)
+	}
+
+	if beginHour < 0 || beginHour > 23 || endHour < 0 || endHour > 23 || beginMinute < 0 || beginMinute > 59 || endMinute < 0 || endMinute > 59 {
+		return 0, 0, fmt.Errorf("执行时间段 %s 超出范围", window)
+	}
+
+	return beginHour*60 + beginMinute, endHour*60 + endMinute, nil
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/betterde/ects/internal/utils"
+)
+
+const (
+	CHANNELMAIL     = "mail"
+	CHANNELHOOK     = "hook"
+	CHANNELSLACK    = "slack"
+	CHANNELDINGTALK = "dingtalk"
+
+	EVENTSUCCESS = "success"
+	EVENTFAILURE = "failure"
+	EVENTTIMEOUT = "timeout"
+	EVENTGROUP   = "group" // 执行组结束时的汇总通知
+)
+
+// 通知消息模板，项目ID为空时为全局模板
+type NotificationTemplate struct {
+	Id        string     `json:"id" validate:"-" xorm:"not null pk comment('ID') CHAR(36)"`
+	Channel   string     `json:"channel" validate:"required,oneof=mail hook slack dingtalk" xorm:"not null comment('通知渠道') VARCHAR(32)"`
+	Event     string     `json:"event" validate:"required,oneof=success failure timeout group" xorm:"not null comment('触发事件') VARCHAR(32)"`
+	ProjectId string     `json:"project_id" validate:"omitempty,uuid4" xorm:"null index comment('项目ID') CHAR(36)"`
+	Subject   string     `json:"subject" validate:"-" xorm:"not null comment('标题模板，钩子渠道不使用') VARCHAR(255)"`
+	Content   string     `json:"content" validate:"required" xorm:"not null comment('内容模板') TEXT"`
+	CreatedAt utils.Time `json:"created_at" validate:"-" xorm:"not null created comment('创建于') DATETIME"`
+	UpdatedAt utils.Time `json:"updated_at" validate:"-" xorm:"not null updated comment('更新于') DATETIME"`
+}
+
+// 定义模型的数据表名称
+func (template *NotificationTemplate) TableName() string {
+	return "notification_templates"
+}
+
+// 创建模板
+func (template *NotificationTemplate) Store() error {
+	_, err := Engine.Insert(template)
+	return err
+}
+
+// 更新模板
+func (template *NotificationTemplate) Update() error {
+	_, err := Engine.Id(template.Id).AllCols().Update(template)
+	return err
+}
+
+// 删除模板
+func (template *NotificationTemplate) Destroy() error {
+	_, err := Engine.Delete(template)
+	return err
+}
+
+// 序列化
+func (template *NotificationTemplate) ToString() (string, error) {
+	result, err := json.Marshal(template)
+	return string(result), err
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	OUTPUTSTDOUT = "stdout"      // 使用步骤去掉首尾空白的标准输出作为输出值
+	OUTPUTFILE   = "ECTS_OUTPUT" // 步骤写入输出的文件路径所在的环境变量
+	MAXOUTPUTS   = 20            // 每个步骤最多传递给后续步骤的输出数量
+	MAXOUTPUT    = 32 << 10      // 单个输出值的最大字节数，超出时传递前面的部分
+)
+
+// 步骤传递给后续步骤的输出，键为后续步骤中的环境变量名，值为 stdout 或者写入 ECTS_OUTPUT 文件的键
+type Outputs map[string]string
+
+// 校验输出的数量、变量名和来源
+func (outputs Outputs) Check() error {
+	if len(outputs) > MAXOUTPUTS {
+		return fmt.Errorf("每个步骤最多传递 %d 个输出", MAXOUTPUTS)
+	}
+
+	for name, source := range outputs {
+		if !VariableName.MatchString(name) {
+			return fmt.Errorf("输出的环境变量名称 %s 格式有误，只能包含字母、数字和下划线，且不能以数字开头", name)
+		}
+
+		if source != OUTPUTSTDOUT && !VariableName.MatchString(source) {
+			return fmt.Errorf("输出 %s 的来源 %s 格式有误，只能为 stdout 或者写入 %s 文件的键", name, source, OUTPUTFILE)
+		}
+	}
+
+	return nil
+}
+
+// 是否需要读取写入 ECTS_OUTPUT 文件的值
+func (outputs Outputs) Written() bool {
+	for _, source := range outputs {
+		if source != OUTPUTSTDOUT {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 按照映射从标准输出和写入文件的值中取出输出，来源没有值时不设置对应的变量
+func (outputs Outputs) Resolve(stdout string, written Variables) Variables {
+	if len(outputs) == 0 {
+		return nil
+	}
+
+	resolved := make(Variables, len(outputs))
+	for name, source := range outputs {
+		value, exist := strings.TrimSpace(stdout), true
+		if source != OUTPUTSTDOUT {
+			value, exist = written[source]
+		}
+
+		if !exist {
+			continue
+		}
+
+		if len(value) > MAXOUTPUT {
+			value = value[:MAXOUTPUT]
+		}
+		resolved[name] = value
+	}
+
+	return resolved
+}
+
+// 解析写入 ECTS_OUTPUT 文件的内容，每行一个 KEY=VALUE，忽略空行和格式有误的行，同名的键以最后一行为准
+func ParseOutputs(content string) Variables {
+	written := make(Variables)
+	for _, line := range strings.Split(content, "\n") {
+		pair := strings.SplitN(strings.TrimSuffix(line, "\r"), "=", 2)
+		if len(pair) != 2 || !VariableName.MatchString(pair[0]) {
+			continue
+		}
+		written[pair[0]] = pair[1]
+	}
+
+	return written
+}
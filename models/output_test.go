@@ -0,0 +1,29 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestResolveOutputs(t *testing.T) {
+	outputs := Outputs{"BUILD_ID": "build_id", "REPORT": OUTPUTSTDOUT, "MISSING": "missing"}
+	if err := outputs.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	written := ParseOutputs("build_id=41\nignored line\nbuild_id=42\r\n1bad=x\nurl=http://host/?a=b\n")
+	if written["build_id"] != "42" || written["url"] != "http://host/?a=b" || len(written) != 2 {
+		t.Errorf("unexpected parsed outputs %v", written)
+	}
+
+	resolved := outputs.Resolve("  done\n", written)
+	if resolved["BUILD_ID"] != "42" || resolved["REPORT"] != "done" {
+		t.Errorf("unexpected resolved outputs %v", resolved)
+	}
+	if _, exist := resolved["MISSING"]; exist {
+		t.Errorf("expected outputs without a value to be omitted, got %v", resolved)
+	}
+
+	if err := (Outputs{"NEXT": "not-a-key"}).Check(); err == nil {
+		t.Error("expected an invalid source to be rejected")
+	}
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+const (
+	PARAMETERSTRING  = "string"  // 任意文本
+	PARAMETERNUMBER  = "number"  // 数字
+	PARAMETERBOOLEAN = "boolean" // true 或者 false
+	PARAMETERCHOICE  = "choice"  // 只能是候选值之一
+
+	MAXPARAMETERS = 20 // 流水线最多声明的参数数量
+)
+
+// 任务内容和环境变量中引用执行参数的占位符，格式为 {{ params.NAME }}
+var ParameterReference = regexp.MustCompile(`\{\{\s*params\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+type (
+	// 流水线声明的参数，手动执行时可以覆盖默认值，执行时作为环境变量注入步骤
+	Parameter struct {
+		Name        string   `json:"name" validate:"required,max=64"`
+		Type        string   `json:"type" validate:"omitempty,oneof=string number boolean choice"`
+		Default     string   `json:"default" validate:"max=4096"`
+		Description string   `json:"description" validate:"max=255"`
+		Required    bool     `json:"required"`
+		Options     []string `json:"options,omitempty" validate:"omitempty,max=100,dive,max=255"`
+	}
+	// 流水线声明的参数列表
+	Parameters []*Parameter
+)
+
+// 校验参数的名称、类型和默认值
+func (parameters Parameters) Check() error {
+	if len(parameters) > MAXPARAMETERS {
+		return fmt.Errorf("最多声明 %d 个参数", MAXPARAMETERS)
+	}
+
+	names := make(map[string]bool, len(parameters))
+	for _, parameter := range parameters {
+		if !VariableName.MatchString(parameter.Name) {
+			return fmt.Errorf("参数名称 %s 格式有误，只能包含字母、数字和下划线，且不能以数字开头", parameter.Name)
+		}
+
+		if names[parameter.Name] {
+			return fmt.Errorf("参数 %s 重复声明", parameter.Name)
+		}
+		names[parameter.Name] = true
+
+		if parameter.Type == PARAMETERCHOICE && len(parameter.Options) == 0 {
+			return fmt.Errorf("参数 %s 的类型为 choice，必须提供候选值", parameter.Name)
+		}
+
+		if parameter.Default != "" {
+			if err := parameter.accept(parameter.Default); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// 参数的默认值
+func (parameters Parameters) Defaults() Variables {
+	values := make(Variables, len(parameters))
+	for _, parameter := range parameters {
+		values[parameter.Name] = parameter.Default
+	}
+
+	return values
+}
+
+// 使用手动执行时传入的值覆盖默认值，拒绝未声明的参数、类型不符的值和缺少的必填参数
+func (parameters Parameters) Resolve(values Variables) (Variables, error) {
+	declared := make(map[string]*Parameter, len(parameters))
+	for _, parameter := range parameters {
+		declared[parameter.Name] = parameter
+	}
+
+	for name := range values {
+		if _, exist := declared[name]; !exist {
+			return nil, fmt.Errorf("流水线未声明参数 %s", name)
+		}
+	}
+
+	resolved := make(Variables, len(parameters))
+	for _, parameter := range parameters {
+		value, exist := values[parameter.Name]
+		if !exist {
+			value = parameter.Default
+		}
+
+		switch {
+		case value == "" && parameter.Required:
+			return nil, fmt.Errorf("参数 %s 为必填项", parameter.Name)
+		case value != "":
+			if err := parameter.accept(value); err != nil {
+				return nil, err
+			}
+		}
+		resolved[parameter.Name] = value
+	}
+
+	return resolved, nil
+}
+
+// 校验值是否符合参数的类型
+func (parameter *Parameter) accept(value string) error {
+	switch parameter.Type {
+	case PARAMETERNUMBER:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("参数 %s 必须是数字", parameter.Name)
+		}
+	case PARAMETERBOOLEAN:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("参数 %s 只能是 true 或者 false", parameter.Name)
+		}
+	case PARAMETERCHOICE:
+		for _, option := range parameter.Options {
+			if option == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("参数 %s 只能是 %v 之一", parameter.Name, parameter.Options)
+	}
+
+	return nil
+}
+
+// 使用本次执行的参数值替换文本中的占位符，没有对应参数的占位符保持不变
+func SubstituteParameters(text string, values Variables) string {
+	return ParameterReference.ReplaceAllStringFunc(text, func(reference string) string {
+		if value, exist := values[ParameterReference.FindStringSubmatch(reference)[1]]; exist {
+			return value
+		}
+		return reference
+	})
+}
@@ -0,0 +1,18 @@
+package models
+
+import "testing"
+
+func TestSubstituteParameters(t *testing.T) {
+	values := Variables{"date": "2019-09-01", "host": "db-2"}
+	cases := map[string]string{
+		"backup --date={{params.date}} --host={{ params.host }}": "backup --date=2019-09-01 --host=db-2",
+		"echo {{ params.missing }}":                              "echo {{ params.missing }}",
+		"echo {{ param.date }} {{ secret.TOKEN }}":               "echo {{ param.date }} {{ secret.TOKEN }}",
+	}
+
+	for text, expected := range cases {
+		if got := SubstituteParameters(text, values); got != expected {
+			t.Errorf("SubstituteParameters(%q) = %q, want %q", text, got, expected)
+		}
+	}
+}
@@ -10,6 +10,9 @@ type PasswordResets struct {
 	CreatedAt time.Time `xorm:"not null created comment('创建于') DATETIME"`
 }
 
+// 密码重置链接的有效期
+const RESETEXPIRES = time.Hour
+
 // 定义模型的数据表名称
 func (resets *PasswordResets) TableName() string {
 	return "password_resets"
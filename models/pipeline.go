@@ -5,25 +5,67 @@ import (
 	"github.com/betterde/ects/internal/utils"
 	"github.com/go-xorm/builder"
 	"github.com/gorhill/cronexpr"
+	"log"
 	"time"
 )
 
+const (
+	SYNCPENDING = 0 // 修改尚未同步到节点
+	SYNCED      = 1 // 已同步到节点
+
+	PIPELINEDISABLED = 0 // 禁用，不参与调度
+	PIPELINEENABLED  = 1 // 启用
+
+	POLICYALL         = "all"          // 绑定的节点都执行
+	POLICYANY         = "any"          // 每次只由最先竞选成功的一个节点执行
+	POLICYLEASTLOADED = "least-loaded" // 每次只由负载最低的一个节点执行
+
+	CONCURRENCYALLOW   = "allow"   // 上一次执行尚未结束时照常执行
+	CONCURRENCYFORBID  = "forbid"  // 上一次执行尚未结束时跳过本次执行
+	CONCURRENCYREPLACE = "replace" // 终止上一次执行后再执行
+
+	MISFIRESKIP     = "skip" // 跳过节点停机期间错过的执行
+	MISFIREONCE     = "once" // 节点启动时补偿执行一次
+	MISFIREALL      = "all"  // 节点启动时补偿全部错过的执行
+	MISFIREMAXFIRES = 100    // 最多补偿的执行次数
+)
+
 // 流水线模型
 type Pipeline struct {
 	Id           string               `json:"id" validate:"-" xorm:"not null pk comment('ID') CHAR(36)"`
 	Name         string               `json:"name" validate:"required" xorm:"not null comment('名称') VARCHAR(255)"`
+	ProjectId    string               `json:"project_id" validate:"omitempty,uuid4" xorm:"null index comment('项目ID') CHAR(36)"`
+	TeamId       string               `json:"team_id" validate:"omitempty,uuid4" xorm:"null index comment('团队ID') CHAR(36)"`
 	Description  string               `json:"description" validate:"-" xorm:"not null comment('描述') VARCHAR(255)"`
-	Spec         string               `json:"spec" validate:"required" xorm:"not null comment('定时器') CHAR(64)"`
+	Spec         string               `json:"spec" validate:"required" xorm:"not null comment('定时器') VARCHAR(64)"`
+	Timezone     string               `json:"timezone" validate:"omitempty,max=64" xorm:"null comment('定时器使用的时区') VARCHAR(64)"`
+	DST          string               `json:"dst_policy" validate:"omitempty,oneof=skip adjust twice" xorm:"'dst_policy' null comment('夏令时切换时的执行策略') VARCHAR(16)"`
+	SpecText     string               `json:"spec_description,omitempty" validate:"-" xorm:"-"`
 	Status       int                  `json:"status" validate:"numeric" xorm:"not null default 0 comment('状态') TINYINT(1)"`
 	Finished     string               `json:"finished" validate:"omitempty,uuid4" xorm:"null comment('成功时执行') CHAR(36)"`
 	Failed       string               `json:"failed" validate:"omitempty,uuid4" xorm:"null comment('失败时执行') CHAR(36)"`
+	Standby      string               `json:"standby" validate:"omitempty,uuid4" xorm:"null comment('备用节点') CHAR(36)"`
 	Overlap      int                  `json:"overlap" validate:"numeric" xorm:"not null default 0 comment('重复执行') TINYINT(1)"`
+	Concurrency  string               `json:"concurrency_policy" validate:"omitempty,oneof=allow forbid replace" xorm:"null comment('上一次执行尚未结束时的并发策略') VARCHAR(16)"`
+	Singleton    int                  `json:"singleton" validate:"numeric" xorm:"not null default 0 comment('每个计划时间只由一个绑定节点执行') TINYINT(1)"`
+	Misfire      string               `json:"misfire" validate:"omitempty,oneof=skip once all" xorm:"null comment('错过执行时的补偿策略') VARCHAR(16)"`
+	Policy       string               `json:"policy" validate:"omitempty,oneof=all any least-loaded" xorm:"not null default('all') comment('多节点调度策略') VARCHAR(32)"`
+	Critical     bool                 `json:"critical" validate:"-" xorm:"not null default false comment('关键流水线，不受项目预算限制') BOOL"`
+	Synced       int                  `json:"synced" validate:"-" xorm:"not null default 1 comment('是否已同步到节点') TINYINT(1)"`
+	Retention    int                  `json:"retention" validate:"numeric,min=0" xorm:"not null default 0 comment('输出保留天数') INT(10)"`
+	Keep         int                  `json:"keep" validate:"numeric,min=0" xorm:"not null default 0 comment('不受保留天数限制的最近执行次数') INT(10)"`
+	Retries      int                  `json:"retries" validate:"numeric,min=0" xorm:"not null default 0 comment('节点失联后重试次数') TINYINT(3)"`
+	Timeout      int                  `json:"timeout" validate:"numeric,min=0" xorm:"not null default 0 comment('超时时间') INT(10)"`
+	Image        string               `json:"image" validate:"omitempty,max=255" xorm:"null comment('Shell 步骤的执行镜像') VARCHAR(255)"`
+	Variables    Variables            `json:"variables" validate:"omitempty,dive,max=4096" xorm:"null comment('步骤的环境变量') TEXT"`
+	Parameters   Parameters           `json:"parameters" validate:"omitempty,dive" xorm:"null comment('手动执行时可以覆盖的参数') TEXT"`
 	CreatedAt    utils.Time           `json:"created_at" validate:"-" xorm:"not null created comment('创建于') DATETIME"`
 	UpdatedAt    utils.Time           `json:"updated_at" validate:"-" xorm:"not null updated comment('更新于') DATETIME"`
 	Nodes        []string             `json:"nodes" xorm:"-"`
 	Steps        []*PipelineTaskPivot `json:"steps" xorm:"-"`
 	Expression   *cronexpr.Expression `json:"-" xorm:"-"`
 	NextTime     time.Time            `json:"-" xorm:"-"`
+	Location     *time.Location       `json:"-" xorm:"-"`
 	FinishedTask *Task                `json:"finished_task,omitempty" xorm:"-"`
 	FailedTask   *Task                `json:"failed_task,omitempty" xorm:"-"`
 }
@@ -41,10 +83,23 @@ func (pipeline *Pipeline) Store() error {
 
 // 更新任务流水线属性
 func (pipeline *Pipeline) Update() error {
-	_, err := Engine.Id(pipeline.Id).Update(pipeline)
+	_, err := Engine.Id(pipeline.Id).MustCols("project_id", "team_id", "standby", "retention", "keep", "retries", "timeout", "image", "timezone", "dst_policy", "policy", "overlap", "concurrency_policy", "singleton", "misfire", "critical", "variables", "parameters").Update(pipeline)
 	return err
 }
 
+// 生效的并发策略，未设置时兼容原来的重复执行开关
+func (pipeline *Pipeline) ConcurrencyMode() string {
+	if pipeline.Concurrency != "" {
+		return pipeline.Concurrency
+	}
+
+	if pipeline.Overlap == 0 {
+		return CONCURRENCYFORBID
+	}
+
+	return CONCURRENCYALLOW
+}
+
 // 删除任务流水线
 func (pipeline *Pipeline) Destroy() error {
 	_, err := Engine.Delete(pipeline)
@@ -98,6 +153,26 @@ func (pipeline *Pipeline) Build() (origin []byte, err error) {
 	return
 }
 
+// 加载流水线指定的时区，未指定或者节点缺少时区数据时使用节点的本地时区
+func (pipeline *Pipeline) LoadLocation() *time.Location {
+	if pipeline.Timezone == "" {
+		return time.Local
+	}
+
+	location, err := time.LoadLocation(pipeline.Timezone)
+	if err != nil {
+		log.Printf("Failed to load timezone %s of pipeline %s: %s\n", pipeline.Timezone, pipeline.Id, err)
+		return time.Local
+	}
+
+	return location
+}
+
+// 按照流水线的时区和夏令时策略计算 after 之后的下一次触发时间
+func (pipeline *Pipeline) Next(after time.Time) time.Time {
+	return NextFire(pipeline.Expression, after, pipeline.Location, pipeline.DST)
+}
+
 // 序列化
 func (pipeline *Pipeline) ToString() (string, error) {
 	result, err := json.Marshal(pipeline)
@@ -1,6 +1,9 @@
 package models
 
-import "github.com/betterde/ects/internal/utils"
+import (
+	"encoding/json"
+	"github.com/betterde/ects/internal/utils"
+)
 
 type PipelineNodePivot struct {
 	Id         string     `json:"id" xorm:"not null pk comment('ID') CHAR(36)"`
@@ -26,3 +29,14 @@ func (pivot *PipelineNodePivot) Destroy() error {
 	_, err := Engine.Delete(pivot)
 	return err
 }
+
+func (pivot *PipelineNodePivot) Update() error {
+	_, err := Engine.Id(pivot.Id).Update(pivot)
+	return err
+}
+
+// 序列化
+func (pivot *PipelineNodePivot) ToString() (string, error) {
+	result, err := json.Marshal(pivot)
+	return string(result), err
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/betterde/ects/internal/utils"
+)
+
+// 流水线的通知设置，执行结束时由工作节点按照订阅的事件发送到对应的渠道
+type PipelineNotification struct {
+	Id         string     `json:"id" validate:"-" xorm:"not null pk comment('ID') CHAR(36)"`
+	PipelineId string     `json:"pipeline_id" validate:"-" xorm:"not null index comment('流水线ID') CHAR(36)"`
+	Channel    string     `json:"channel" validate:"required,oneof=mail slack dingtalk hook" xorm:"not null comment('通知渠道') VARCHAR(32)"`
+	Target     string     `json:"target" validate:"required,max=1024" xorm:"not null comment('收件地址或者 Webhook 地址') VARCHAR(1024)"`
+	Secret     string     `json:"secret,omitempty" validate:"max=255" xorm:"null comment('钉钉机器人的加签密钥') VARCHAR(255)"`
+	OnSuccess  bool       `json:"on_success" validate:"-" xorm:"not null default false comment('执行成功时通知') BOOL"`
+	OnFailure  bool       `json:"on_failure" validate:"-" xorm:"not null default true comment('执行失败时通知') BOOL"`
+	OnTimeout  bool       `json:"on_timeout" validate:"-" xorm:"not null default true comment('执行超时时通知') BOOL"`
+	CreatedAt  utils.Time `json:"created_at" validate:"-" xorm:"not null created comment('创建于') DATETIME"`
+	UpdatedAt  utils.Time `json:"updated_at" validate:"-" xorm:"not null updated comment('更新于') DATETIME"`
+}
+
+// 定义模型的数据表名称
+func (notification *PipelineNotification) TableName() string {
+	return "pipeline_notifications"
+}
+
+// 是否订阅了指定的事件
+func (notification *PipelineNotification) Subscribed(event string) bool {
+	switch event {
+	case EVENTSUCCESS:
+		return notification.OnSuccess
+	case EVENTFAILURE:
+		return notification.OnFailure
+	case EVENTTIMEOUT:
+		return notification.OnTimeout
+	}
+
+	return false
+}
+
+// 创建通知设置
+func (notification *PipelineNotification) Store() error {
+	_, err := Engine.Insert(notification)
+	return err
+}
+
+// 更新通知设置
+func (notification *PipelineNotification) Update() error {
+	_, err := Engine.Id(notification.Id).AllCols().Update(notification)
+	return err
+}
+
+// 删除通知设置
+func (notification *PipelineNotification) Destroy() error {
+	_, err := Engine.Delete(notification)
+	return err
+}
+
+// 序列化，不包含加签密钥
+func (notification *PipelineNotification) ToString() (string, error) {
+	masked := *notification
+	masked.Secret = ""
+	result, err := json.Marshal(masked)
+	return string(result), err
+}
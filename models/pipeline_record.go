@@ -1,25 +1,58 @@
 package models
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/betterde/ects/internal/utils"
+	"github.com/go-xorm/builder"
+	"log"
+	"time"
+)
+
+const (
+	RECORDFAILED    = 0 // 执行失败
+	RECORDFINISHED  = 1 // 执行成功
+	RECORDRUNNING   = 2 // 正在执行
+	RECORDLOST      = 3 // 执行节点失联
+	RECORDTIMEOUT   = 4 // 执行超时
+	RECORDCANCELLED = 5 // 被用户终止
+
+	CANCELREQUESTED = "cancel_requested" // 主节点已下发终止指令，等待工作节点确认
+	CANCELLING      = "cancelling"       // 工作节点已确认，正在终止进程
+	CANCELLED       = "cancelled"        // 进程已经结束
+
+	RECORDHEARTBEAT = 30 * time.Second // 执行期间更新心跳的间隔
 )
 
 type (
 	// 流水线调度记录模型
 	PipelineRecords struct {
-		Id         string         `json:"id" xorm:"not null pk comment('ID') CHAR(36)"`
-		PipelineId string         `json:"pipeline_id" xorm:"not null comment('流水线ID') index CHAR(36)"`
-		NodeId     string         `json:"node_id" xorm:"not null comment('节点ID') index CHAR(36)"`
-		WorkerName string         `json:"worker_name" xorm:"not null comment('节点名称') VARCHAR(255)"`
-		Spec       string         `json:"spec" xorm:"comment('定时器') CHAR(64)"`
-		Status     int            `json:"status" xorm:"not null default 1 comment('状态') TINYINT(1)"`
-		Duration   int64          `json:"duration" xorm:"not null comment('持续时间') INT(10)"`
-		BeginWith  utils.Time     `json:"begin_with" xorm:"not null comment('开始于') DATETIME"`
-		FinishWith utils.Time     `json:"finish_with" xorm:"not null comment('结束于') DATETIME"`
-		CreatedAt  utils.Time     `json:"created_at" validate:"-" xorm:"not null created comment('创建于') DATETIME"`
-		UpdatedAt  utils.Time     `json:"updated_at" validate:"-" xorm:"not null updated comment('更新于') DATETIME"`
-		Steps      []*TaskRecords `json:"steps" xorm:"-"`
+		Id         string `json:"id" xorm:"not null pk comment('ID') VARCHAR(36)"`
+		PipelineId string `json:"pipeline_id" xorm:"not null comment('流水线ID') index CHAR(36)"`
+		NodeId     string `json:"node_id" xorm:"not null comment('节点ID') index CHAR(36)"`
+		WorkerName string `json:"worker_name" xorm:"not null comment('节点名称') VARCHAR(255)"`
+		Spec       string `json:"spec" xorm:"comment('定时器') VARCHAR(64)"`
+		Trigger    string `json:"trigger" xorm:"not null default 'schedule' comment('触发方式') VARCHAR(32)"`
+		ReplayOf   string `json:"replay_of" xorm:"null comment('重放的记录ID') VARCHAR(36)"`
+		Attempt    int    `json:"attempt" xorm:"not null default 1 comment('第几次执行') TINYINT(3)"`
+		Snapshot   string `json:"-" xorm:"null comment('流水线快照') TEXT"`
+		Tags       Tags   `json:"tags" xorm:"null comment('标签') TEXT"`
+		// 外部系统传入的关联ID
+		CorrelationId string         `json:"correlation_id" xorm:"null index comment('关联ID') VARCHAR(128)"`
+		Parameters    Variables      `json:"parameters,omitempty" xorm:"null comment('执行时使用的参数') TEXT"`
+		GroupId       string         `json:"group_id,omitempty" xorm:"null index comment('执行组ID') CHAR(36)"`
+		Status        int            `json:"status" xorm:"not null default 1 comment('状态') TINYINT(1)"`
+		Cancellation  string         `json:"cancellation,omitempty" xorm:"null comment('终止进度') VARCHAR(32)"`
+		CancelledBy   string         `json:"cancelled_by,omitempty" xorm:"null comment('发起终止的用户ID') VARCHAR(36)"`
+		Duration      int64          `json:"duration" xorm:"not null comment('持续时间') INT(10)"`
+		BeginWith     utils.Time     `json:"begin_with" xorm:"not null comment('开始于') DATETIME"`
+		FinishWith    utils.Time     `json:"finish_with" xorm:"not null comment('结束于') DATETIME"`
+		HeartbeatAt   utils.Time     `json:"heartbeat_at" xorm:"null comment('心跳时间') DATETIME"`
+		CreatedAt     utils.Time     `json:"created_at" validate:"-" xorm:"not null created comment('创建于') DATETIME"`
+		UpdatedAt     utils.Time     `json:"updated_at" validate:"-" xorm:"not null updated comment('更新于') DATETIME"`
+		Steps         []*TaskRecords `json:"steps" xorm:"-"`
+		Cost          float64        `json:"cost,omitempty" xorm:"-"` // 按照配置的费率估算的费用
 	}
 	// 流水线执行结果
 	Result struct {
@@ -39,14 +72,73 @@ func (records *PipelineRecords) Store() error {
 	return err
 }
 
+// 执行期间定期更新心跳，直到 ctx 结束
+func (records *PipelineRecords) Heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(RECORDHEARTBEAT)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := Repo.Heartbeat(records.Id, now); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
 // 更新记录
 func (records *PipelineRecords) Update() error {
-	_, err := Engine.Update(records)
+	_, err := Engine.Id(records.Id).AllCols().Update(records)
 	return err
 }
 
+// 保存执行结果，记录已被主节点标记为失联时不覆盖，返回是否保存成功
+func (records *PipelineRecords) Finish() (bool, error) {
+	affected, err := Engine.Id(records.Id).Where(builder.Eq{"status": RECORDRUNNING}).AllCols().Update(records)
+	return affected > 0, err
+}
+
+// 记录终止的进度，只更新正在执行且终止进度没有超过 from 的记录，返回更新的记录数
+func Cancel(cond builder.Cond, from []string, to, requester string) (int64, error) {
+	columns := map[string]interface{}{"cancellation": to}
+	if requester != "" {
+		columns["cancelled_by"] = requester
+	}
+
+	progress := builder.Or(builder.IsNull{"cancellation"}, builder.In("cancellation", append(from, "")))
+	return Engine.Table(new(PipelineRecords)).Where(builder.Eq{"status": RECORDRUNNING}.And(cond, progress)).Update(columns)
+}
+
+// 获取流水线最近一次计划执行的开始时间，nodeId 不为空时只查询该节点的执行记录
+func LastScheduled(pipelineId, nodeId string) (time.Time, bool, error) {
+	cond := builder.Eq{"pipeline_id": pipelineId, "trigger": []string{TRIGGERSCHEDULE, TRIGGERSTANDBY, TRIGGERMISFIRE}}
+	if nodeId != "" {
+		cond["node_id"] = nodeId
+	}
+
+	record := &PipelineRecords{}
+	exist, err := Engine.Where(cond).Desc("begin_with").Cols("begin_with").Get(record)
+	if err != nil || !exist {
+		return time.Time{}, false, err
+	}
+
+	return time.Time(record.BeginWith), true, nil
+}
+
 // 序列化
 func (records *PipelineRecords) ToString() (string, error) {
 	result, err := json.Marshal(records)
 	return string(result), err
 }
+
+// 日志中使用的执行记录描述，包含外部系统的关联ID
+func (records *PipelineRecords) Reference() string {
+	if records.CorrelationId == "" {
+		return records.Id
+	}
+
+	return fmt.Sprintf("%s [correlation %s]", records.Id, records.CorrelationId)
+}
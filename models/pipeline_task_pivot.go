@@ -2,8 +2,36 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/betterde/ects/internal/utils"
 	"github.com/go-xorm/builder"
+	"strings"
+	"time"
+)
+
+const (
+	DEPENDENCESTRONG = "strong" // 前置步骤失败时跳过
+	DEPENDENCEWEAK   = "weak"   // 前置步骤失败时仍然执行
+
+	CONDITIONSUCCESS = "on_success" // 前面的步骤都成功时执行
+	CONDITIONFAILURE = "on_failure" // 前面的步骤失败时执行，用于清理和告警
+	CONDITIONALWAYS  = "always"     // 无论前面的步骤是否成功都执行，用于收尾
+
+	LOGFULL  = "full"  // 保存完整输出
+	LOGQUIET = "quiet" // 只保存退出码和末尾几行输出
+
+	TAILLINES = 20 // 静默模式默认保留的末尾行数
+
+	INHERITALL       = "all"       // 继承节点的全部环境变量
+	INHERITALLOWLIST = "allowlist" // 只继承允许列表中的环境变量
+	INHERITNONE      = "none"      // 不继承节点的环境变量
+
+	OVERRIDEDISABLED = -1 // 步骤上的超时时间、重试间隔或者重试次数设置为 -1 时不使用任务的设置，表示不限制超时、立即重试或者不重试
+)
+
+var (
+	ErrUnknownDepends = errors.New("依赖的步骤不属于该流水线")
+	ErrCyclicDepends  = errors.New("步骤之间存在循环依赖")
 )
 
 type PipelineTaskPivot struct {
@@ -11,13 +39,21 @@ type PipelineTaskPivot struct {
 	PipelineId  string     `json:"pipeline_id" validate:"required,uuid4" xorm:"not null comment('ID') index CHAR(36)"`
 	TaskId      string     `json:"task_id" validate:"required,uuid4" xorm:"not null comment('ID') index CHAR(36)"`
 	Step        int        `json:"step" validate:"numeric" xorm:"not null comment('步骤') SMALLINT(5)"`
-	Timeout     int        `json:"timeout" validate:"numeric" xorm:"not null default 0 comment('超时时间') INT(10)"`
-	Interval    int        `json:"interval" validate:"numeric" xorm:"not null default 0 comment('间隔时间') INT(10)"`
-	Retries     int        `json:"retries" validate:"numeric" xorm:"not null default 0 comment('重试次数') TINYINT(3)"`
+	Timeout     int        `json:"timeout" validate:"numeric,min=-1" xorm:"not null default 0 comment('超时时间，0 使用任务的设置') INT(10)"`
+	Interval    int        `json:"interval" validate:"numeric,min=-1,max=3600" xorm:"not null default 0 comment('首次重试前等待的秒数，0 使用任务的设置') INT(10)"`
+	Retries     int        `json:"retries" validate:"numeric,min=-1,max=10" xorm:"not null default 0 comment('重试次数，0 使用任务的设置') TINYINT(3)"`
 	Directory   string     `json:"directory" validate:"omitempty" xorm:"null comment('工作目录') VARCHAR(255)"`
 	User        string     `json:"user" validate:"omitempty" xorm:"null comment('运行用户') VARCHAR(255)"`
 	Environment string     `json:"environment" validate:"omitempty" xorm:"null comment('环境变量') VARCHAR(255)"`
 	Dependence  string     `json:"dependence" validate:"required" xorm:"not null default 'strong' comment('依赖') VARCHAR(255)"`
+	Pipe        int        `json:"pipe" validate:"numeric" xorm:"not null default 0 comment('输出到下一步') TINYINT(1)"`
+	Condition   string     `json:"condition" validate:"omitempty,oneof=on_success on_failure always" xorm:"not null default 'on_success' comment('执行条件') VARCHAR(16)"`
+	Depends     []string   `json:"depends" validate:"omitempty,dive,uuid4" xorm:"null comment('依赖的步骤') TEXT"`
+	LogLevel    string     `json:"log_level" validate:"omitempty,oneof=full quiet" xorm:"not null default 'full' comment('日志级别') VARCHAR(16)"`
+	TailLines   int        `json:"tail_lines" validate:"min=0,max=1000" xorm:"not null default 0 comment('静默模式保留的末尾行数') INT(10)"`
+	Inherit     string     `json:"inherit" validate:"omitempty,oneof=all allowlist none" xorm:"not null default 'all' comment('继承节点环境变量的方式') VARCHAR(16)"`
+	Allowlist   []string   `json:"allowlist" validate:"omitempty,max=100,dive,min=1,max=128" xorm:"null comment('允许继承的环境变量') TEXT"`
+	Outputs     Outputs    `json:"outputs" validate:"-" xorm:"null comment('传递给后续步骤的输出') TEXT"`
 	CreatedAt   utils.Time `json:"created_at" validate:"-" xorm:"not null created comment('创建于') DATETIME"`
 	UpdatedAt   utils.Time `json:"updated_at" validate:"-" xorm:"not null updated comment('更新于') DATETIME"`
 	Task        *Task      `json:"task" validate:"-" xorm:"-"`
@@ -36,7 +72,22 @@ func (pivot *PipelineTaskPivot) Store() error {
 
 // 更新中间表
 func (pivot *PipelineTaskPivot) Update() error {
-	_, err := Engine.Table(pivot.TableName()).Where(builder.Eq{"id": pivot.Id}).Update(map[string]interface{}{
+	depends, err := json.Marshal(pivot.Depends)
+	if err != nil {
+		return err
+	}
+
+	allowlist, err := json.Marshal(pivot.Allowlist)
+	if err != nil {
+		return err
+	}
+
+	outputs, err := json.Marshal(pivot.Outputs)
+	if err != nil {
+		return err
+	}
+
+	_, err = Engine.Table(pivot.TableName()).Where(builder.Eq{"id": pivot.Id}).Update(map[string]interface{}{
 		"task_id":     pivot.TaskId,
 		"step":        pivot.Step,
 		"timeout":     pivot.Timeout,
@@ -46,6 +97,14 @@ func (pivot *PipelineTaskPivot) Update() error {
 		"user":        pivot.User,
 		"environment": pivot.Environment,
 		"dependence":  pivot.Dependence,
+		"pipe":        pivot.Pipe,
+		"condition":   pivot.Condition,
+		"depends":     string(depends),
+		"log_level":   pivot.LogLevel,
+		"tail_lines":  pivot.TailLines,
+		"inherit":     pivot.Inherit,
+		"allowlist":   string(allowlist),
+		"outputs":     string(outputs),
 	})
 	return err
 }
@@ -61,3 +120,153 @@ func (pivot *PipelineTaskPivot) ToString() (string, error) {
 	result, err := json.Marshal(pivot)
 	return string(result), err
 }
+
+// 是否有步骤声明了依赖，此时按照依赖关系并行执行，未声明依赖的步骤作为起点
+func Dependent(steps []*PipelineTaskPivot) bool {
+	for _, step := range steps {
+		if len(step.Depends) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 检查依赖的步骤是否存在以及是否存在循环依赖
+func CheckDepends(steps []*PipelineTaskPivot) error {
+	pending := make(map[string]int, len(steps))
+	dependents := make(map[string][]string)
+
+	for _, step := range steps {
+		pending[step.Id] = len(step.Depends)
+	}
+
+	for _, step := range steps {
+		for _, id := range step.Depends {
+			if _, exist := pending[id]; !exist || id == step.Id {
+				return ErrUnknownDepends
+			}
+			dependents[id] = append(dependents[id], step.Id)
+		}
+	}
+
+	queue := make([]string, 0)
+	for id, count := range pending {
+		if count == 0 {
+			queue = append(queue, id)
+		}
+	}
+
+	visited := 0
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		visited++
+		for _, dependent := range dependents[id] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				queue = append(queue, dependent)
+			}
+		}
+	}
+
+	if visited != len(steps) {
+		return ErrCyclicDepends
+	}
+
+	return nil
+}
+
+// 按照执行条件判断步骤是否执行，failed 表示前面的步骤是否失败，未设置条件时只在前面的步骤都成功时执行
+func (pivot *PipelineTaskPivot) Runnable(failed bool) bool {
+	switch pivot.Condition {
+	case CONDITIONALWAYS:
+		return true
+	case CONDITIONFAILURE:
+		return failed
+	default:
+		return !failed
+	}
+}
+
+// 步骤实际的超时秒数，步骤上的设置优先于任务的设置，0 表示不限制
+func (pivot *PipelineTaskPivot) EffectiveTimeout() int {
+	switch {
+	case pivot.Timeout > 0:
+		return pivot.Timeout
+	case pivot.Timeout == OVERRIDEDISABLED || pivot.Task == nil:
+		return 0
+	default:
+		return pivot.Task.Timeout
+	}
+}
+
+// 步骤实际的重试次数，步骤上的设置优先于任务的设置
+func (pivot *PipelineTaskPivot) EffectiveRetries() int {
+	switch {
+	case pivot.Retries > 0:
+		return pivot.Retries
+	case pivot.Retries == OVERRIDEDISABLED || pivot.Task == nil:
+		return 0
+	default:
+		return pivot.Task.Retries
+	}
+}
+
+// 第几次重试前需要等待的时间，步骤上设置了重试间隔时按照任务的增长倍数计算
+func (pivot *PipelineTaskPivot) RetryWait(attempt int) time.Duration {
+	var backoff float64
+	if pivot.Task != nil {
+		backoff = pivot.Task.Backoff
+	}
+
+	switch {
+	case pivot.Interval > 0:
+		return retryWait(pivot.Interval, backoff, attempt)
+	case pivot.Interval == OVERRIDEDISABLED || pivot.Task == nil:
+		return 0
+	default:
+		return pivot.Task.RetryWait(attempt)
+	}
+}
+
+// 是否只保存末尾几行输出，返回保留的行数
+func (pivot *PipelineTaskPivot) Quiet() (bool, int) {
+	if pivot.LogLevel != LOGQUIET {
+		return false, 0
+	}
+
+	if pivot.TailLines > 0 {
+		return true, pivot.TailLines
+	}
+
+	return true, TAILLINES
+}
+
+// 按照继承方式过滤节点的环境变量，PATH 始终保留以便查找命令，允许列表支持以 * 结尾的前缀
+func (pivot *PipelineTaskPivot) Inherited(environ []string) []string {
+	if pivot.Inherit == "" || pivot.Inherit == INHERITALL {
+		return append([]string{}, environ...)
+	}
+
+	inherited := make([]string, 0)
+	for _, variable := range environ {
+		name := strings.SplitN(variable, "=", 2)[0]
+		if name == "PATH" || (pivot.Inherit == INHERITALLOWLIST && allowed(pivot.Allowlist, name)) {
+			inherited = append(inherited, variable)
+		}
+	}
+
+	return inherited
+}
+
+// 环境变量名是否在允许列表中
+func allowed(allowlist []string, name string) bool {
+	for _, pattern := range allowlist {
+		if pattern == name || (strings.HasSuffix(pattern, "*") && strings.HasPrefix(name, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunnable(t *testing.T) {
+	cases := []struct {
+		condition string
+		failed    bool
+		want      bool
+	}{
+		{"", false, true},
+		{"", true, false},
+		{CONDITIONSUCCESS, true, false},
+		{CONDITIONFAILURE, false, false},
+		{CONDITIONFAILURE, true, true},
+		{CONDITIONALWAYS, false, true},
+		{CONDITIONALWAYS, true, true},
+	}
+
+	for _, item := range cases {
+		pivot := &PipelineTaskPivot{Condition: item.condition}
+		if got := pivot.Runnable(item.failed); got != item.want {
+			t.Errorf("Runnable(%q, failed=%v) = %v, want %v", item.condition, item.failed, got, item.want)
+		}
+	}
+}
+
+func TestEffectiveOverrides(t *testing.T) {
+	task := &Task{Timeout: 60, Retries: 3, RetryInterval: 10, Backoff: 2}
+
+	inherited := &PipelineTaskPivot{Task: task}
+	if inherited.EffectiveTimeout() != 60 || inherited.EffectiveRetries() != 3 || inherited.RetryWait(2) != 20*time.Second {
+		t.Errorf("expected a step without overrides to use the task settings, got %d, %d, %v", inherited.EffectiveTimeout(), inherited.EffectiveRetries(), inherited.RetryWait(2))
+	}
+
+	overridden := &PipelineTaskPivot{Task: task, Timeout: 5, Retries: 1, Interval: 3}
+	if overridden.EffectiveTimeout() != 5 || overridden.EffectiveRetries() != 1 || overridden.RetryWait(2) != 6*time.Second {
+		t.Errorf("expected step overrides to take precedence, got %d, %d, %v", overridden.EffectiveTimeout(), overridden.EffectiveRetries(), overridden.RetryWait(2))
+	}
+
+	disabled := &PipelineTaskPivot{Task: task, Timeout: OVERRIDEDISABLED, Retries: OVERRIDEDISABLED, Interval: OVERRIDEDISABLED}
+	if disabled.EffectiveTimeout() != 0 || disabled.EffectiveRetries() != 0 || disabled.RetryWait(1) != 0 {
+		t.Errorf("expected -1 to disable the task settings, got %d, %d, %v", disabled.EffectiveTimeout(), disabled.EffectiveRetries(), disabled.RetryWait(1))
+	}
+}
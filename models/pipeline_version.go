@@ -0,0 +1,28 @@
+package models
+
+import (
+	"github.com/betterde/ects/internal/utils"
+)
+
+// 流水线定义的不可变快照，修改流水线、绑定节点或者修改步骤后保存一个新版本
+type PipelineVersion struct {
+	Id         string     `json:"id" xorm:"not null pk comment('ID') CHAR(36)"`
+	PipelineId string     `json:"pipeline_id" xorm:"not null unique(pipeline_version) comment('流水线ID') CHAR(36)"`
+	Version    int        `json:"version" xorm:"not null unique(pipeline_version) comment('版本号') INT(10)"`
+	Operation  string     `json:"operation" xorm:"not null comment('产生该版本的操作') VARCHAR(64)"`
+	UserId     string     `json:"user_id" xorm:"null comment('操作用户') CHAR(36)"`
+	Snapshot   string     `json:"-" xorm:"not null comment('流水线定义快照') TEXT"`
+	CreatedAt  utils.Time `json:"created_at" xorm:"not null created comment('创建于') DATETIME"`
+	Definition *Pipeline  `json:"definition,omitempty" xorm:"-"`
+}
+
+// 定义模型的数据表名称
+func (version *PipelineVersion) TableName() string {
+	return "pipeline_versions"
+}
+
+// 保存版本，版本创建后不再修改
+func (version *PipelineVersion) Store() error {
+	_, err := Engine.InsertOne(version)
+	return err
+}
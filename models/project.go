@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/betterde/ects/internal/utils"
+)
+
+const (
+	BUDGETDENY  = "deny"  // 超出预算时拒绝非关键流水线的执行
+	BUDGETDEFER = "defer" // 超出预算时推迟非关键流水线的执行，预算恢复后执行
+)
+
+// 项目模型，用于对流水线进行分组
+type Project struct {
+	Id             string     `json:"id" validate:"-" xorm:"not null pk comment('ID') CHAR(36)"`
+	Name           string     `json:"name" validate:"required" xorm:"not null comment('名称') VARCHAR(255)"`
+	TeamId         string     `json:"team_id" validate:"omitempty,uuid4" xorm:"null index comment('团队ID') CHAR(36)"`
+	Description    string     `json:"description" validate:"-" xorm:"null comment('描述') VARCHAR(255)"`
+	MaxConcurrency int        `json:"max_concurrency" validate:"numeric,min=0" xorm:"not null default 0 comment('最大并发数') INT(10)"`
+	Budget         int        `json:"budget" validate:"numeric,min=0" xorm:"not null default 0 comment('每月的节点分钟预算') INT(10)"`
+	BudgetAction   string     `json:"budget_action" validate:"omitempty,oneof=deny defer" xorm:"not null default 'deny' comment('超出预算时的处理方式') VARCHAR(16)"`
+	CreatedAt      utils.Time `json:"created_at" validate:"-" xorm:"not null created comment('创建于') DATETIME"`
+	UpdatedAt      utils.Time `json:"updated_at" validate:"-" xorm:"not null updated comment('更新于') DATETIME"`
+}
+
+// 定义模型的数据表名称
+func (project *Project) TableName() string {
+	return "projects"
+}
+
+// 创建项目
+func (project *Project) Store() error {
+	_, err := Engine.Insert(project)
+	return err
+}
+
+// 更新项目
+func (project *Project) Update() error {
+	_, err := Engine.Id(project.Id).MustCols("team_id", "max_concurrency", "budget", "budget_action").Update(project)
+	return err
+}
+
+// 删除项目
+func (project *Project) Destroy() error {
+	_, err := Engine.Delete(project)
+	return err
+}
+
+// 序列化
+func (project *Project) ToString() (string, error) {
+	result, err := json.Marshal(project)
+	return string(result), err
+}
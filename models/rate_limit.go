@@ -0,0 +1,59 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/betterde/ects/internal/utils"
+)
+
+// 限流分组，引用同一分组的任务在所有工作节点上共享每秒执行次数的上限，用于保护共同访问的下游系统
+type RateLimit struct {
+	Id          string     `json:"id" validate:"-" xorm:"not null pk comment('ID') CHAR(36)"`
+	Name        string     `json:"name" validate:"required,max=64" xorm:"not null unique comment('名称') VARCHAR(64)"`
+	Rate        float64    `json:"rate" validate:"gt=0,lte=10000" xorm:"not null comment('每秒允许执行的次数') DOUBLE"`
+	Burst       int        `json:"burst" validate:"gte=0,lte=10000" xorm:"not null default 0 comment('允许突发执行的次数，为 0 时等于每秒次数') INT(10)"`
+	Description string     `json:"description" validate:"-" xorm:"null comment('描述') VARCHAR(255)"`
+	CreatedAt   utils.Time `json:"created_at" validate:"-" xorm:"not null created comment('创建于') DATETIME"`
+	UpdatedAt   utils.Time `json:"updated_at" validate:"-" xorm:"not null updated comment('更新于') DATETIME"`
+}
+
+// 定义模型的数据表名称
+func (limit *RateLimit) TableName() string {
+	return "rate_limits"
+}
+
+// 令牌桶的容量，未设置突发次数时至少允许执行一次
+func (limit *RateLimit) Capacity() float64 {
+	if limit.Burst > 0 {
+		return float64(limit.Burst)
+	}
+
+	if limit.Rate < 1 {
+		return 1
+	}
+
+	return limit.Rate
+}
+
+// 创建限流分组
+func (limit *RateLimit) Store() error {
+	_, err := Engine.Insert(limit)
+	return err
+}
+
+// 更新限流分组
+func (limit *RateLimit) Update() error {
+	_, err := Engine.Id(limit.Id).MustCols("burst", "description").Update(limit)
+	return err
+}
+
+// 删除限流分组
+func (limit *RateLimit) Destroy() error {
+	_, err := Engine.Delete(limit)
+	return err
+}
+
+// 序列化
+func (limit *RateLimit) ToString() (string, error) {
+	result, err := json.Marshal(limit)
+	return string(result), err
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"github.com/go-xorm/builder"
+	"time"
+)
+
+type (
+	// 工作节点执行流水线时读写数据的接口，默认直接访问数据库，代理模式下通过主节点访问
+	Repository interface {
+		StoreRun(record *PipelineRecords) error                                         // 保存开始执行的流水线记录
+		Heartbeat(runId string, at time.Time) error                                     // 更新正在执行的记录的心跳
+		Cancelling(runId, requester string) error                                       // 确认收到终止指令
+		FinishRun(record *PipelineRecords) (bool, error)                                // 保存执行结果，返回是否保存成功
+		StoreStep(step *TaskRecords) error                                              // 保存步骤的执行记录
+		LastScheduled(pipelineId, nodeId string) (time.Time, bool, error)               // 流水线最近一次计划执行的开始时间
+		Node(id string) (*Node, error)                                                  // 获取节点的状态
+		Concurrency(projectId string) (int, error)                                      // 获取项目的最大并发数
+		RateLimit(name string) (*RateLimit, bool, error)                                // 按名称获取限流分组
+		OpenSecrets(names []string) (map[string]string, error)                          // 按名称解密多个密钥
+		Notifications(pipelineId string) ([]PipelineNotification, error)                // 获取流水线的通知设置
+		Template(channel, event, projectId string) (*NotificationTemplate, bool, error) // 获取指定范围的通知模板
+	}
+	// 直接访问数据库
+	Database struct{}
+)
+
+var Repo Repository = Database{}
+
+func (Database) StoreRun(record *PipelineRecords) error {
+	return record.Store()
+}
+
+func (Database) Heartbeat(runId string, at time.Time) error {
+	_, err := Engine.Table(new(PipelineRecords)).Where(builder.Eq{"id": runId, "status": RECORDRUNNING}).Update(map[string]interface{}{"heartbeat_at": at})
+	return err
+}
+
+func (Database) Cancelling(runId, requester string) error {
+	_, err := Cancel(builder.Eq{"id": runId}, []string{CANCELREQUESTED}, CANCELLING, requester)
+	return err
+}
+
+func (Database) FinishRun(record *PipelineRecords) (bool, error) {
+	return record.Finish()
+}
+
+func (Database) StoreStep(step *TaskRecords) error {
+	return step.Store()
+}
+
+func (Database) LastScheduled(pipelineId, nodeId string) (time.Time, bool, error) {
+	return LastScheduled(pipelineId, nodeId)
+}
+
+func (Database) Node(id string) (*Node, error) {
+	node := &Node{}
+	_, err := Engine.Id(id).Cols("id", "status").Get(node)
+	return node, err
+}
+
+func (Database) Concurrency(projectId string) (int, error) {
+	project := &Project{}
+	_, err := Engine.Id(projectId).Cols("max_concurrency").Get(project)
+	return project.MaxConcurrency, err
+}
+
+func (Database) RateLimit(name string) (*RateLimit, bool, error) {
+	limit := &RateLimit{}
+	exist, err := Engine.Where(builder.Eq{"name": name}).Get(limit)
+	return limit, exist, err
+}
+
+func (Database) OpenSecrets(names []string) (map[string]string, error) {
+	return OpenSecrets(names)
+}
+
+func (Database) Notifications(pipelineId string) ([]PipelineNotification, error) {
+	notifications := make([]PipelineNotification, 0)
+	err := Engine.Where(builder.Eq{"pipeline_id": pipelineId}).Find(&notifications)
+	return notifications, err
+}
+
+func (Database) Template(channel, event, projectId string) (*NotificationTemplate, bool, error) {
+	tpl := &NotificationTemplate{}
+	exist, err := Engine.Where(builder.Eq{"channel": channel, "event": event, "project_id": projectId}).Get(tpl)
+	return tpl, exist, err
+}
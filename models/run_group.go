@@ -0,0 +1,115 @@
+package models
+
+import (
+	"github.com/betterde/ects/internal/utils"
+	"github.com/go-xorm/builder"
+	"time"
+)
+
+const (
+	GROUPFANOUT   = "fanout"   // 使用多组参数各执行一次
+	GROUPBACKFILL = "backfill" // 补跑一段时间内的计划执行
+
+	GROUPRUNNING   = "running"
+	GROUPSUCCEEDED = "succeeded" // 全部执行成功
+	GROUPFAILED    = "failed"    // 至少一次执行失败、超时、失联或者没有执行
+	GROUPCANCELLED = "cancelled" // 整组被取消
+
+	GROUPMAXRUNS = 500            // 每组最多的执行次数
+	GROUPSTALE   = 24 * time.Hour // 超过该时间仍有执行没有开始时，按照未执行结束执行组
+)
+
+// 扇出或者补跑创建的一组相关执行，组内的执行不单独发送通知，全部结束后发送一条汇总通知
+type RunGroup struct {
+	Id         string     `json:"id" xorm:"not null pk comment('ID') CHAR(36)"`
+	PipelineId string     `json:"pipeline_id" xorm:"not null index comment('流水线ID') CHAR(36)"`
+	Kind       string     `json:"kind" xorm:"not null comment('类型') VARCHAR(32)"`
+	UserId     string     `json:"user_id" xorm:"null comment('创建者') CHAR(36)"`
+	Status     string     `json:"status" xorm:"not null index comment('状态') VARCHAR(32)"`
+	Total      int        `json:"total" xorm:"not null default 0 comment('下发的执行数量') INT(10)"`
+	Running    int        `json:"running" xorm:"not null default 0 comment('正在执行的数量') INT(10)"`
+	Succeeded  int        `json:"succeeded" xorm:"not null default 0 comment('执行成功的数量') INT(10)"`
+	Failed     int        `json:"failed" xorm:"not null default 0 comment('执行失败、超时或者失联的数量') INT(10)"`
+	Pending    int        `json:"pending" xorm:"not null default 0 comment('尚未开始执行的数量') INT(10)"`
+	FinishWith utils.Time `json:"finish_with" xorm:"null comment('结束于') DATETIME"`
+	CreatedAt  utils.Time `json:"created_at" xorm:"not null created comment('创建于') DATETIME"`
+	UpdatedAt  utils.Time `json:"updated_at" xorm:"not null updated comment('更新于') DATETIME"`
+}
+
+// 定义模型的数据表名称
+func (group *RunGroup) TableName() string {
+	return "run_groups"
+}
+
+// 创建执行组
+func (group *RunGroup) Store() error {
+	_, err := Engine.Insert(group)
+	return err
+}
+
+// 按照组内的执行记录统计各状态的数量，失联后重试的执行只统计最后一次
+func (group *RunGroup) Tally() error {
+	records := make([]PipelineRecords, 0)
+	if err := Engine.Cols("id", "status", "replay_of").Where(builder.Eq{"group_id": group.Id}).Find(&records); err != nil {
+		return err
+	}
+
+	replayed := make(map[string]bool, len(records))
+	for _, record := range records {
+		if record.ReplayOf != "" {
+			replayed[record.ReplayOf] = true
+		}
+	}
+
+	group.Running, group.Succeeded, group.Failed = 0, 0, 0
+	for _, record := range records {
+		if replayed[record.Id] {
+			continue
+		}
+
+		switch record.Status {
+		case RECORDRUNNING:
+			group.Running++
+		case RECORDFINISHED:
+			group.Succeeded++
+		default:
+			group.Failed++
+		}
+	}
+
+	group.Pending = group.Total - group.Running - group.Succeeded - group.Failed
+	if group.Pending < 0 {
+		group.Pending = 0
+	}
+
+	return nil
+}
+
+// 统计后判断执行组是否已经结束，取消或者超时后没有正在执行的记录即视为结束
+func (group *RunGroup) Settled(now time.Time) bool {
+	if group.Running > 0 {
+		return false
+	}
+
+	return group.Pending == 0 || group.Status == GROUPCANCELLED || now.Sub(time.Time(group.CreatedAt)) > GROUPSTALE
+}
+
+// 执行组结束后的状态
+func (group *RunGroup) Outcome() string {
+	switch {
+	case group.Status == GROUPCANCELLED:
+		return GROUPCANCELLED
+	case group.Failed > 0 || group.Pending > 0:
+		return GROUPFAILED
+	}
+
+	return GROUPSUCCEEDED
+}
+
+// 结束执行组并保存统计结果，多个主节点同时处理时只有一个会成功
+func (group *RunGroup) Finish(now time.Time) (bool, error) {
+	group.Status = group.Outcome()
+	group.FinishWith = utils.Time(now)
+	affected, err := Engine.Id(group.Id).Where(builder.IsNull{"finish_with"}).Cols("status", "running", "succeeded", "failed", "pending", "finish_with").Update(group)
+	return affected > 0, err
+}
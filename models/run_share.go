@@ -0,0 +1,55 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/betterde/ects/internal/utils"
+	"time"
+)
+
+const SHAREMAXTTL = 30 * 24 * time.Hour // 分享链接的最长有效期
+
+// 执行记录的只读分享链接，链接本身经过签名，删除记录即可撤销
+type RunShare struct {
+	Id          string     `json:"id" xorm:"not null pk comment('ID') CHAR(36)"`
+	RunId       string     `json:"run_id" xorm:"not null index comment('执行记录ID') VARCHAR(36)"`
+	UserId      string     `json:"user_id" xorm:"not null index comment('创建者') CHAR(36)"`
+	Note        string     `json:"note" xorm:"null comment('分享对象或用途') VARCHAR(255)"`
+	Visits      int        `json:"visits" xorm:"not null default 0 comment('访问次数') INT(10)"`
+	ExpiresAt   utils.Time `json:"expires_at" xorm:"not null comment('过期时间') DATETIME"`
+	LastVisitAt utils.Time `json:"last_visit_at" xorm:"null comment('最后访问时间') DATETIME"`
+	CreatedAt   utils.Time `json:"created_at" xorm:"not null created comment('创建于') DATETIME"`
+}
+
+// 定义模型的数据表名称
+func (share *RunShare) TableName() string {
+	return "run_shares"
+}
+
+// 判断分享链接是否已过期
+func (share *RunShare) Expired(now time.Time) bool {
+	return now.After(time.Time(share.ExpiresAt))
+}
+
+// 创建分享链接
+func (share *RunShare) Store() error {
+	_, err := Engine.Insert(share)
+	return err
+}
+
+// 更新分享链接
+func (share *RunShare) Update() error {
+	_, err := Engine.Id(share.Id).Update(share)
+	return err
+}
+
+// 撤销分享链接
+func (share *RunShare) Destroy() error {
+	_, err := Engine.Delete(share)
+	return err
+}
+
+// 序列化
+func (share *RunShare) ToString() (string, error) {
+	result, err := json.Marshal(share)
+	return string(result), err
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/go-xorm/builder"
+	"regexp"
+)
+
+var (
+	ErrSecretKey = errors.New("未配置加密密钥使用的口令 secrets.key")
+	// 密钥名称只能包含字母、数字和下划线，不能以数字开头
+	SecretName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// 任务中引用密钥的占位符
+	SecretReference = regexp.MustCompile(`\{\{\s*secret\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+)
+
+// 任务密钥，值加密后保存，任务通过 {{secret.NAME}} 引用，工作节点在执行前解密替换
+type Secret struct {
+	Id          string     `json:"id" validate:"-" xorm:"not null pk comment('ID') CHAR(36)"`
+	Name        string     `json:"name" validate:"required,max=64" xorm:"not null unique comment('名称') VARCHAR(64)"`
+	Value       string     `json:"value,omitempty" validate:"required,max=4096" xorm:"-"`
+	Cipher      string     `json:"-" validate:"-" xorm:"not null comment('密文') TEXT"`
+	Description string     `json:"description" validate:"max=255" xorm:"null comment('描述') VARCHAR(255)"`
+	CreatedAt   utils.Time `json:"created_at" validate:"-" xorm:"not null created comment('创建于') DATETIME"`
+	UpdatedAt   utils.Time `json:"updated_at" validate:"-" xorm:"not null updated comment('更新于') DATETIME"`
+}
+
+// 定义模型的数据表名称
+func (secret *Secret) TableName() string {
+	return "secrets"
+}
+
+// 加密后创建密钥
+func (secret *Secret) Store() error {
+	if err := secret.Seal(); err != nil {
+		return err
+	}
+
+	_, err := Engine.Insert(secret)
+	return err
+}
+
+// 加密后更新密钥的值
+func (secret *Secret) Update() error {
+	if err := secret.Seal(); err != nil {
+		return err
+	}
+
+	_, err := Engine.Id(secret.Id).MustCols("cipher", "description").Update(secret)
+	return err
+}
+
+// 删除密钥
+func (secret *Secret) Destroy() error {
+	_, err := Engine.Delete(secret)
+	return err
+}
+
+// 加密明文，加密后清空明文
+func (secret *Secret) Seal() error {
+	if config.Conf.Secrets.Key == "" {
+		return ErrSecretKey
+	}
+
+	cipher, err := utils.Encrypt(config.Conf.Secrets.Key, secret.Value)
+	if err != nil {
+		return err
+	}
+
+	secret.Cipher = cipher
+	secret.Value = ""
+	return nil
+}
+
+// 解密密钥的值
+func (secret *Secret) Open() (string, error) {
+	if config.Conf.Secrets.Key == "" {
+		return "", ErrSecretKey
+	}
+
+	return utils.Decrypt(config.Conf.Secrets.Key, secret.Cipher)
+}
+
+// 序列化，不包含密钥的值
+func (secret *Secret) ToString() (string, error) {
+	result, err := json.Marshal(secret)
+	return string(result), err
+}
+
+// 按名称解密多个密钥，任一密钥不存在或无法解密时返回错误
+func OpenSecrets(names []string) (map[string]string, error) {
+	secrets := make([]Secret, 0)
+	if err := Engine.Where(builder.Eq{"name": names}).Find(&secrets); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(secrets))
+	for index := range secrets {
+		value, err := secrets[index].Open()
+		if err != nil {
+			return nil, fmt.Errorf("解密密钥 %s 失败：%s", secrets[index].Name, err)
+		}
+		values[secrets[index].Name] = value
+	}
+
+	for _, name := range names {
+		if _, exist := values[name]; !exist {
+			return nil, fmt.Errorf("密钥 %s 不存在", name)
+		}
+	}
+
+	return values, nil
+}
+
+// 获取文本中引用的密钥名称，去除重复的名称
+func SecretNames(texts ...string) []string {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, text := range texts {
+		for _, match := range SecretReference.FindAllStringSubmatch(text, -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				names = append(names, match[1])
+			}
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,7 @@
+//go:build cgo
+// +build cgo
+
+package models
+
+// SQLite 驱动依赖 CGO，使用 CGO_ENABLED=0 编译的版本只支持 MySQL 和 PostgreSQL
+import _ "github.com/mattn/go-sqlite3"
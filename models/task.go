@@ -1,28 +1,50 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"github.com/betterde/ects/internal/utils"
+	"math"
+	"strings"
+	"time"
 )
 
 const (
-	MODESHELL = "shell"
-	MODEHTTP  = "http"
-	MODEMAIL  = "mail"
-	MODEHOOK  = "hook"
+	MODESHELL  = "shell"
+	MODEHTTP   = "http"
+	MODEMAIL   = "mail"
+	MODEHOOK   = "hook"
+	MODEDOCKER = "docker"
+
+	RETRYMAXWAIT = 3600 // 重试前最多等待的秒数
 )
 
 // 任务模型
 type Task struct {
-	Id          string     `json:"id" validate:"-" xorm:"not null pk comment('用户ID') CHAR(36)"`
-	Name        string     `json:"name" validate:"required" xorm:"not null comment('名称') VARCHAR(255)"`
-	Mode        string     `json:"mode" validate:"required" xorm:"not null default('shell') comment('任务模式') VARCHAR(32)"`
-	Url         string     `json:"url" validate:"omitempty" xorm:"null comment('请求URL') VARCHAR(255)"`
-	Method      string     `json:"method" validate:"omitempty" xorm:"null comment('任务模式') VARCHAR(255)"`
-	Content     string     `json:"content" validate:"omitempty" xorm:"null comment('内容') TEXT"`
-	Description string     `json:"description" validate:"-" xorm:"null comment('描述') VARCHAR(255)"`
-	CreatedAt   utils.Time `json:"created_at" validate:"-" xorm:"not null created comment('创建于') DATETIME"`
-	UpdatedAt   utils.Time `json:"updated_at" validate:"-" xorm:"not null updated comment('更新于') DATETIME"`
+	Id            string     `json:"id" validate:"-" xorm:"not null pk comment('用户ID') CHAR(36)"`
+	Name          string     `json:"name" validate:"required" xorm:"not null comment('名称') VARCHAR(255)"`
+	Mode          string     `json:"mode" validate:"required" xorm:"not null default('shell') comment('任务模式') VARCHAR(32)"`
+	Url           string     `json:"url" validate:"omitempty" xorm:"null comment('请求URL') VARCHAR(255)"`
+	Method        string     `json:"method" validate:"omitempty" xorm:"null comment('任务模式') VARCHAR(255)"`
+	Content       string     `json:"content" validate:"omitempty" xorm:"null comment('内容') TEXT"`
+	Description   string     `json:"description" validate:"-" xorm:"null comment('描述') VARCHAR(255)"`
+	Requirements  []string   `json:"requirements" validate:"-" xorm:"null comment('环境依赖') TEXT"`
+	Locality      []string   `json:"locality" validate:"omitempty,dive,max=255" xorm:"null comment('数据位置') TEXT"`
+	Image         string     `json:"image" validate:"-" xorm:"null comment('Docker 镜像') VARCHAR(255)"`
+	Env           []string   `json:"env" validate:"-" xorm:"null comment('容器环境变量') TEXT"`
+	Volumes       []string   `json:"volumes" validate:"-" xorm:"null comment('容器挂载卷') TEXT"`
+	Network       string     `json:"network" validate:"-" xorm:"null comment('容器网络') VARCHAR(255)"`
+	Sandbox       bool       `json:"sandbox" validate:"-" xorm:"not null default false comment('在 Linux 命名空间沙箱中执行') BOOL"`
+	StreamUrl     string     `json:"stream_url" validate:"omitempty,url" xorm:"null comment('输出流推送地址') VARCHAR(255)"`
+	Timeout       int        `json:"timeout" validate:"gte=0" xorm:"not null default 0 comment('超时时间') INT(10)"`
+	Retries       int        `json:"retries" validate:"gte=0,lte=10" xorm:"not null default 0 comment('失败后重试次数') TINYINT(3)"`
+	RetryInterval int        `json:"retry_interval" validate:"gte=0,lte=3600" xorm:"not null default 0 comment('首次重试前等待的秒数') INT(10)"`
+	Backoff       float64    `json:"backoff" validate:"gte=0,lte=10" xorm:"not null default 0 comment('重试间隔的增长倍数') DOUBLE"`
+	RateLimit     string     `json:"rate_limit" validate:"max=64" xorm:"null comment('限流分组名称') VARCHAR(64)"`
+	Variables     Variables  `json:"variables" validate:"omitempty,dive,max=4096" xorm:"null comment('环境变量，覆盖流水线的同名变量') TEXT"`
+	CreatedAt     utils.Time `json:"created_at" validate:"-" xorm:"not null created comment('创建于') DATETIME"`
+	UpdatedAt     utils.Time `json:"updated_at" validate:"-" xorm:"not null updated comment('更新于') DATETIME"`
 }
 
 // 定义模型的数据表名称
@@ -38,7 +60,7 @@ func (task *Task) Store() error {
 
 // 更新任务
 func (task *Task) Update() error {
-	_, err := Engine.Id(task.Id).Update(task)
+	_, err := Engine.Id(task.Id).MustCols("locality", "image", "env", "volumes", "network", "sandbox", "stream_url", "timeout", "retries", "retry_interval", "backoff", "rate_limit", "variables").Update(task)
 	return err
 }
 
@@ -48,8 +70,33 @@ func (task *Task) Destroy() error {
 	return err
 }
 
+// 第几次重试前需要等待的时间，倍数小于等于 1 时每次等待相同的时间
+func (task *Task) RetryWait(attempt int) time.Duration {
+	return retryWait(task.RetryInterval, task.Backoff, attempt)
+}
+
+// 按照首次重试的等待秒数和增长倍数计算等待时间，最多等待 RETRYMAXWAIT 秒
+func retryWait(interval int, backoff float64, attempt int) time.Duration {
+	wait := float64(interval)
+	if backoff > 1 {
+		wait *= math.Pow(backoff, float64(attempt-1))
+	}
+
+	if wait > RETRYMAXWAIT {
+		wait = RETRYMAXWAIT
+	}
+
+	return time.Duration(wait * float64(time.Second))
+}
+
 // 序列化
 func (task *Task) ToString() (string, error) {
 	result, err := json.Marshal(task)
 	return string(result), err
 }
+
+// 执行内容的 SHA-256 摘要，包含任务类型、镜像、请求方法、地址和内容，密钥引用按照原文计算，轮换密钥不改变摘要
+func (task *Task) CommandHash() string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{task.Mode, task.Image, task.Method, task.Url, task.Content}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
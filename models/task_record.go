@@ -7,17 +7,28 @@ import (
 
 type TaskRecords struct {
 	Id               int64      `json:"id" xorm:"pk autoincr comment('ID') BIGINT(20)"`
-	PipelineRecordId string     `json:"pipeline_record_id" xorm:"not null comment('流水线记录ID') index CHAR(36)"`
+	PipelineRecordId string     `json:"pipeline_record_id" xorm:"not null comment('流水线记录ID') index VARCHAR(36)"`
 	TaskId           string     `json:"task_id" xorm:"not null comment('任务ID') index CHAR(36)"`
 	NodeId           string     `json:"node_id" xorm:"not null comment('节点ID') index CHAR(36)"`
 	TaskName         string     `json:"task_name" xorm:"not null comment('任务名称') VARCHAR(255)"`
 	WorkerName       string     `json:"worker_name" xorm:"not null comment('节点名称') VARCHAR(255)"`
 	Content          string     `json:"content" xorm:"not null comment('执行内容') TEXT"`
+	CommandHash      string     `json:"command_hash" xorm:"null index comment('执行内容的摘要') CHAR(64)"`
 	Mode             string     `json:"mode" xorm:"not null comment('执行方式') VARCHAR(255)"`
+	Url              string     `json:"url" xorm:"null comment('请求URL') VARCHAR(255)"`
+	Method           string     `json:"method" xorm:"null comment('请求方法') VARCHAR(255)"`
+	Directory        string     `json:"directory" xorm:"null comment('工作目录') VARCHAR(255)"`
+	User             string     `json:"user" xorm:"null comment('运行用户') VARCHAR(255)"`
+	Environment      string     `json:"environment" xorm:"null comment('环境变量') VARCHAR(255)"`
 	Timeout          int        `json:"timeout" xorm:"not null default 0 comment('超时时间') INT(10)"`
 	Retries          int        `json:"retries" xorm:"not null default 0 comment('重试次数') TINYINT(3)"`
 	Status           string     `json:"status" xorm:"not null default 'finished' comment('状态') VARCHAR(255)"`
 	Result           string     `json:"result" xorm:"not null comment('执行结果') TEXT"`
+	Stdout           string     `json:"stdout" xorm:"null comment('标准输出') TEXT"`
+	Stderr           string     `json:"stderr" xorm:"null comment('标准错误') TEXT"`
+	ExitCode         int        `json:"exit_code" xorm:"not null default 0 comment('退出码') INT(10)"`
+	Truncated        bool       `json:"truncated" xorm:"not null default false comment('输出超过大小限制，只保存了末尾部分') BOOL"`
+	Outputs          Variables  `json:"outputs,omitempty" xorm:"null comment('传递给后续步骤的输出') TEXT"`
 	Duration         int64      `json:"duration" xorm:"not null comment('持续时间') INT(10)"`
 	BeginWith        utils.Time `json:"begin_with" xorm:"not null comment('开始于') DATETIME"`
 	FinishWith       utils.Time `json:"finish_with" xorm:"not null comment('结束于') DATETIME"`
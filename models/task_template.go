@@ -0,0 +1,164 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/betterde/ects/internal/utils"
+	"regexp"
+)
+
+// 模板中的参数占位符，格式为 {{ param.NAME }}
+var TemplatePlaceholder = regexp.MustCompile(`\{\{\s*param\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// 任务模板，常用的命令定义一次，创建任务时填写参数替换占位符
+type TaskTemplate struct {
+	Id          string     `json:"id" validate:"-" xorm:"not null pk comment('ID') CHAR(36)"`
+	Name        string     `json:"name" validate:"required,max=255" xorm:"not null unique comment('名称') VARCHAR(255)"`
+	Description string     `json:"description" validate:"max=255" xorm:"null comment('描述') VARCHAR(255)"`
+	Mode        string     `json:"mode" validate:"required,oneof=shell http mail hook docker" xorm:"not null default('shell') comment('任务模式') VARCHAR(32)"`
+	Url         string     `json:"url" validate:"max=255" xorm:"null comment('请求URL') VARCHAR(255)"`
+	Method      string     `json:"method" validate:"max=255" xorm:"null comment('请求方法') VARCHAR(255)"`
+	Content     string     `json:"content" validate:"required" xorm:"not null comment('内容') TEXT"`
+	Image       string     `json:"image" validate:"max=255" xorm:"null comment('Docker 镜像') VARCHAR(255)"`
+	Env         []string   `json:"env" validate:"-" xorm:"null comment('容器环境变量') TEXT"`
+	Volumes     []string   `json:"volumes" validate:"-" xorm:"null comment('容器挂载卷') TEXT"`
+	Network     string     `json:"network" validate:"max=255" xorm:"null comment('容器网络') VARCHAR(255)"`
+	Timeout     int        `json:"timeout" validate:"gte=0" xorm:"not null default 0 comment('超时时间') INT(10)"`
+	Retries     int        `json:"retries" validate:"gte=0,lte=10" xorm:"not null default 0 comment('失败后重试次数') TINYINT(3)"`
+	Variables   Variables  `json:"variables" validate:"omitempty,dive,max=4096" xorm:"null comment('环境变量') TEXT"`
+	Parameters  Parameters `json:"parameters" validate:"omitempty,dive" xorm:"null comment('占位符对应的参数') TEXT"`
+	CreatedAt   utils.Time `json:"created_at" validate:"-" xorm:"not null created comment('创建于') DATETIME"`
+	UpdatedAt   utils.Time `json:"updated_at" validate:"-" xorm:"not null updated comment('更新于') DATETIME"`
+}
+
+// 定义模型的数据表名称
+func (template *TaskTemplate) TableName() string {
+	return "task_templates"
+}
+
+// 创建任务模板
+func (template *TaskTemplate) Store() error {
+	_, err := Engine.Insert(template)
+	return err
+}
+
+// 更新任务模板
+func (template *TaskTemplate) Update() error {
+	_, err := Engine.Id(template.Id).MustCols("description", "url", "method", "image", "env", "volumes", "network", "timeout", "retries", "variables", "parameters").Update(template)
+	return err
+}
+
+// 删除任务模板
+func (template *TaskTemplate) Destroy() error {
+	_, err := Engine.Delete(template)
+	return err
+}
+
+// 校验参数声明，模板中的占位符都必须声明对应的参数
+func (template *TaskTemplate) Check() error {
+	if err := template.Parameters.Check(); err != nil {
+		return err
+	}
+
+	if err := template.Variables.Check(); err != nil {
+		return err
+	}
+
+	declared := make(map[string]bool, len(template.Parameters))
+	for _, parameter := range template.Parameters {
+		declared[parameter.Name] = true
+	}
+
+	for _, text := range template.texts() {
+		for _, match := range TemplatePlaceholder.FindAllStringSubmatch(text, -1) {
+			if !declared[match[1]] {
+				return fmt.Errorf("占位符 %s 没有声明对应的参数", match[0])
+			}
+		}
+	}
+
+	return nil
+}
+
+// 使用参数值替换占位符生成任务，未填写的参数使用默认值
+func (template *TaskTemplate) Render(name string, values Variables) (*Task, error) {
+	declared := make(map[string]bool, len(template.Parameters))
+	for _, parameter := range template.Parameters {
+		declared[parameter.Name] = true
+	}
+
+	for key := range values {
+		if !declared[key] {
+			return nil, fmt.Errorf("模板未声明参数 %s", key)
+		}
+	}
+
+	resolved, err := template.Parameters.Resolve(values)
+	if err != nil {
+		return nil, err
+	}
+
+	fill := func(text string) string {
+		return TemplatePlaceholder.ReplaceAllStringFunc(text, func(placeholder string) string {
+			return resolved[TemplatePlaceholder.FindStringSubmatch(placeholder)[1]]
+		})
+	}
+
+	fillAll := func(texts []string) []string {
+		if texts == nil {
+			return nil
+		}
+
+		result := make([]string, 0, len(texts))
+		for _, text := range texts {
+			result = append(result, fill(text))
+		}
+
+		return result
+	}
+
+	if name == "" {
+		name = template.Name
+	}
+
+	task := &Task{
+		Name:        fill(name),
+		Mode:        template.Mode,
+		Url:         fill(template.Url),
+		Method:      template.Method,
+		Content:     fill(template.Content),
+		Description: template.Description,
+		Image:       fill(template.Image),
+		Env:         fillAll(template.Env),
+		Volumes:     fillAll(template.Volumes),
+		Network:     template.Network,
+		Timeout:     template.Timeout,
+		Retries:     template.Retries,
+	}
+
+	if template.Variables != nil {
+		task.Variables = make(Variables, len(template.Variables))
+		for key, value := range template.Variables {
+			task.Variables[key] = fill(value)
+		}
+	}
+
+	return task, nil
+}
+
+// 可以包含占位符的字段
+func (template *TaskTemplate) texts() []string {
+	texts := []string{template.Name, template.Url, template.Content, template.Image}
+	texts = append(append(texts, template.Env...), template.Volumes...)
+	for _, value := range template.Variables {
+		texts = append(texts, value)
+	}
+
+	return texts
+}
+
+// 序列化
+func (template *TaskTemplate) ToString() (string, error) {
+	result, err := json.Marshal(template)
+	return string(result), err
+}
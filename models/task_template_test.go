@@ -0,0 +1,48 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestTaskTemplateRender(t *testing.T) {
+	template := &TaskTemplate{
+		Name:      "backup {{ param.DATABASE }}",
+		Mode:      MODESHELL,
+		Content:   "mysqldump {{param.DATABASE}} > {{ param.TARGET }}/{{ param.DATABASE }}.sql",
+		Variables: Variables{"PASSWORD": "{{ secret.DB_PASSWORD }}"},
+		Parameters: Parameters{
+			{Name: "DATABASE", Required: true},
+			{Name: "TARGET", Default: "/backup"},
+		},
+	}
+
+	if err := template.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := template.Render("", Variables{"DATABASE": "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if task.Name != "backup orders" || task.Content != "mysqldump orders > /backup/orders.sql" {
+		t.Errorf("unexpected task %s: %s", task.Name, task.Content)
+	}
+
+	if task.Variables["PASSWORD"] != "{{ secret.DB_PASSWORD }}" {
+		t.Errorf("expected secret references to be kept, got %s", task.Variables["PASSWORD"])
+	}
+
+	if _, err := template.Render("", nil); err == nil {
+		t.Error("expected an error for the missing required parameter")
+	}
+
+	if _, err := template.Render("", Variables{"DATABASE": "orders", "HOST": "db"}); err == nil {
+		t.Error("expected an error for an undeclared parameter")
+	}
+
+	template.Content += " {{ param.UNKNOWN }}"
+	if err := template.Check(); err == nil {
+		t.Error("expected an error for an undeclared placeholder")
+	}
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/betterde/ects/internal/utils"
+)
+
+// 团队模型，流水线和项目可以共享给团队
+type Team struct {
+	Id          string     `json:"id" validate:"-" xorm:"not null pk comment('ID') CHAR(36)"`
+	Name        string     `json:"name" validate:"required" xorm:"not null comment('名称') unique VARCHAR(255)"`
+	Description string     `json:"description" validate:"-" xorm:"null comment('描述') VARCHAR(255)"`
+	CreatedAt   utils.Time `json:"created_at" validate:"-" xorm:"not null created comment('创建于') DATETIME"`
+	UpdatedAt   utils.Time `json:"updated_at" validate:"-" xorm:"not null updated comment('更新于') DATETIME"`
+}
+
+// 团队成员
+type TeamMember struct {
+	Id        string     `json:"id" xorm:"not null pk comment('ID') CHAR(36)"`
+	TeamId    string     `json:"team_id" xorm:"not null unique(team_user) comment('团队ID') CHAR(36)"`
+	UserId    string     `json:"user_id" xorm:"not null unique(team_user) index comment('用户ID') CHAR(36)"`
+	CreatedAt utils.Time `json:"created_at" xorm:"not null created comment('创建于') DATETIME"`
+	User      *User      `json:"user,omitempty" xorm:"-"`
+}
+
+// 定义模型的数据表名称
+func (team *Team) TableName() string {
+	return "teams"
+}
+
+// 创建团队
+func (team *Team) Store() error {
+	_, err := Engine.Insert(team)
+	return err
+}
+
+// 更新团队
+func (team *Team) Update() error {
+	_, err := Engine.Id(team.Id).Update(team)
+	return err
+}
+
+// 删除团队
+func (team *Team) Destroy() error {
+	_, err := Engine.Delete(team)
+	return err
+}
+
+// 序列化
+func (team *Team) ToString() (string, error) {
+	result, err := json.Marshal(team)
+	return string(result), err
+}
+
+// 定义模型的数据表名称
+func (member *TeamMember) TableName() string {
+	return "team_members"
+}
+
+// 添加团队成员
+func (member *TeamMember) Store() error {
+	_, err := Engine.Insert(member)
+	return err
+}
+
+func (member *TeamMember) Update() error {
+	_, err := Engine.Id(member.Id).Update(member)
+	return err
+}
+
+// 移除团队成员
+func (member *TeamMember) Destroy() error {
+	_, err := Engine.Delete(member)
+	return err
+}
+
+// 序列化
+func (member *TeamMember) ToString() (string, error) {
+	result, err := json.Marshal(member)
+	return string(result), err
+}
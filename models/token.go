@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/betterde/ects/internal/utils"
+	"time"
+)
+
+// API 令牌的前缀，用于和用户登录时签发的 JWT 区分
+const TOKENPREFIX = "ects_"
+
+// 供 CI 等外部系统调用接口的长期令牌，只保存摘要
+type Token struct {
+	Id         string     `json:"id" xorm:"not null pk comment('令牌ID') CHAR(36)"`
+	Name       string     `json:"name" xorm:"not null comment('名称') VARCHAR(255)"`
+	UserId     string     `json:"user_id" xorm:"not null comment('所属用户') index CHAR(36)"`
+	Role       string     `json:"role" xorm:"not null comment('权限范围') VARCHAR(16)"`
+	Digest     string     `json:"-" xorm:"not null comment('令牌摘要') unique CHAR(64)"`
+	Hint       string     `json:"hint" xorm:"not null comment('令牌的前几位，便于识别') VARCHAR(16)"`
+	ExpiresAt  utils.Time `json:"expires_at" xorm:"null comment('过期时间，为空时不过期') DATETIME"`
+	LastUsedAt utils.Time `json:"last_used_at" xorm:"null comment('最后使用时间') DATETIME"`
+	CreatedAt  utils.Time `json:"created_at" xorm:"not null created comment('创建于') DATETIME"`
+}
+
+// 定义模型的数据表名称
+func (token *Token) TableName() string {
+	return "tokens"
+}
+
+// 判断令牌是否已过期
+func (token *Token) Expired(now time.Time) bool {
+	expires := time.Time(token.ExpiresAt)
+	return !expires.IsZero() && now.After(expires)
+}
+
+func (token *Token) Store() error {
+	_, err := Engine.Insert(token)
+	return err
+}
+
+func (token *Token) Update() error {
+	_, err := Engine.Id(token.Id).Update(token)
+	return err
+}
+
+// 序列化
+func (token *Token) ToString() (string, error) {
+	result, err := json.Marshal(token)
+	return string(result), err
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"github.com/satori/go.uuid"
+	"regexp"
+	"time"
+)
+
+const (
+	TRIGGERSCHEDULE = "schedule"
+	TRIGGERREPLAY   = "replay"
+	TRIGGERRETRY    = "retry"
+	TRIGGERSTANDBY  = "standby"
+	TRIGGERMANUAL   = "manual"
+	TRIGGERWEBHOOK  = "webhook"  // 外部系统通过 Webhook 触发
+	TRIGGERMISFIRE  = "misfire"  // 补偿节点停机期间错过的计划执行
+	TRIGGERFANOUT   = "fanout"   // 扇出执行组中的一次执行
+	TRIGGERBACKFILL = "backfill" // 补跑执行组中的一次计划执行
+
+	RUNIDUUID = "uuid" // 随机的 UUID
+	RUNIDTIME = "time" // 以开始时间为前缀，可以按时间排序
+
+	CORRELATIONHEADER = "X-Correlation-ID" // 外部系统传入的关联ID
+	CORRELATIONMAXLEN = 128
+)
+
+var correlationPattern = regexp.MustCompile(`^[\w.:/@+=-]+$`)
+
+type (
+	// 立即执行流水线的指令
+	Trigger struct {
+		Id       string    `json:"id"`        // 执行记录ID
+		Source   string    `json:"source"`    // 触发来源
+		ReplayOf string    `json:"replay_of"` // 被重放或重试的执行记录ID
+		Attempt  int       `json:"attempt"`   // 第几次执行
+		Pipeline *Pipeline `json:"pipeline"`  // 需要执行的流水线
+		Tags     Tags      `json:"tags"`      // 触发来源的元数据，例如 Webhook 发送方、Git 提交
+		// 外部系统传入的关联ID，记录在执行记录、日志和通知中
+		CorrelationId string `json:"correlation_id,omitempty"`
+		// 手动执行时传入的参数，已经校验并填充默认值
+		Parameters Variables `json:"parameters,omitempty"`
+		// 所属的执行组，组内的执行不单独发送通知
+		GroupId string `json:"group_id,omitempty"`
+	}
+	// 执行记录的标签
+	Tags map[string]string
+)
+
+// 合并标签，已存在的标签不会被覆盖
+func (tags Tags) Merge(others Tags) Tags {
+	merged := make(Tags, len(tags)+len(others))
+	for key, value := range others {
+		merged[key] = value
+	}
+	for key, value := range tags {
+		merged[key] = value
+	}
+	return merged
+}
+
+// 按照配置的格式生成执行记录ID，长度不超过 36 个字符
+func NewRunId() string {
+	if config.Conf != nil && config.Conf.Run.IdFormat == RUNIDTIME {
+		suffix := make([]byte, 4)
+		if _, err := rand.Read(suffix); err == nil {
+			return fmt.Sprintf("%s-%x", time.Now().Format("20060102150405.000"), suffix)
+		}
+	}
+
+	return uuid.NewV4().String()
+}
+
+// 校验外部系统传入的关联ID
+func ValidCorrelationId(id string) bool {
+	return len(id) <= CORRELATIONMAXLEN && correlationPattern.MatchString(id)
+}
@@ -6,14 +6,29 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	ROLEADMIN    = "admin"    // 管理员，可以管理用户、团队和系统设置
+	ROLEOPERATOR = "operator" // 操作员，可以创建和修改流水线、任务和节点，执行和终止流水线
+	ROLEVIEWER   = "viewer"   // 只读用户，只能查看流水线和执行记录
+)
+
+// 角色的权限等级，高等级的角色拥有低等级角色的全部权限
+var roles = map[string]int{
+	ROLEVIEWER:   1,
+	ROLEOPERATOR: 2,
+	ROLEADMIN:    3,
+}
+
 type User struct {
-	Id        string     `json:"id" xorm:"not null pk comment('用户ID') CHAR(36)"`
-	Name      string     `json:"name" xorm:"not null comment('姓名') VARCHAR(255)"`
-	Email     string     `json:"email" xorm:"not null comment('邮箱') unique VARCHAR(255)"`
-	Password  string     `json:"-" xorm:"not null comment('密码') VARCHAR(255)"`
-	Manager   bool       `json:"manager" xorm:"not null default 0 comment('管理员') TINYINT(1)"`
-	CreatedAt utils.Time `json:"created_at" xorm:"not null created comment('创建于') DATETIME"`
-	UpdatedAt utils.Time `json:"updated_at" xorm:"not null updated comment('更新于') DATETIME"`
+	Id         string     `json:"id" xorm:"not null pk comment('用户ID') CHAR(36)"`
+	Name       string     `json:"name" xorm:"not null comment('姓名') VARCHAR(255)"`
+	Email      string     `json:"email" xorm:"not null comment('邮箱') unique VARCHAR(255)"`
+	Password   string     `json:"-" xorm:"not null comment('密码') VARCHAR(255)"`
+	Manager    bool       `json:"manager" xorm:"not null default false comment('管理员') BOOL"`
+	Role       string     `json:"role" xorm:"not null default '' comment('角色') VARCHAR(16)"`
+	MustChange bool       `json:"must_change" xorm:"not null default false comment('登录后必须修改密码') BOOL"`
+	CreatedAt  utils.Time `json:"created_at" xorm:"not null created comment('创建于') DATETIME"`
+	UpdatedAt  utils.Time `json:"updated_at" xorm:"not null updated comment('更新于') DATETIME"`
 }
 
 // Define table name
@@ -32,6 +47,41 @@ func ValidatePassword(password string, hashed []byte) (bool, error) {
 	return true, nil
 }
 
+// 判断是否是有效的角色
+func ValidRole(role string) bool {
+	_, ok := roles[role]
+	return ok
+}
+
+// 用户实际的角色，升级前创建的用户没有角色，管理员视为 admin，其余用户保留原有的权限视为 operator
+func (user *User) Authority() string {
+	if ValidRole(user.Role) {
+		return user.Role
+	}
+
+	if user.Manager {
+		return ROLEADMIN
+	}
+
+	return ROLEOPERATOR
+}
+
+// 判断用户是否拥有指定角色的权限
+func (user *User) Can(role string) bool {
+	return Covers(user.Authority(), role)
+}
+
+// 判断角色是否包含另一个角色的权限
+func Covers(role, other string) bool {
+	return roles[role] >= roles[other]
+}
+
+// 设置角色并同步管理员标记
+func (user *User) Assign(role string) {
+	user.Role = role
+	user.Manager = role == ROLEADMIN
+}
+
 // 更新用户信息
 func (user *User) Update() error {
 	_, err := Engine.Id(user.Id).Update(user)
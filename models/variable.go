@@ -0,0 +1,57 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+const MAXVARIABLES = 100 // 流水线或任务最多定义的环境变量数量
+
+var VariableName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// 流水线或任务定义的环境变量，执行时注入步骤的进程环境
+type Variables map[string]string
+
+// 校验环境变量的数量和名称
+func (variables Variables) Check() error {
+	if len(variables) > MAXVARIABLES {
+		return fmt.Errorf("最多定义 %d 个环境变量", MAXVARIABLES)
+	}
+
+	for name := range variables {
+		if !VariableName.MatchString(name) {
+			return fmt.Errorf("环境变量名称 %s 格式有误，只能包含字母、数字和下划线，且不能以数字开头", name)
+		}
+	}
+
+	return nil
+}
+
+// 转换为按名称排序的 KEY=VALUE 列表
+func (variables Variables) Environ() []string {
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := make([]string, 0, len(names))
+	for _, name := range names {
+		env = append(env, name+"="+variables[name])
+	}
+
+	return env
+}
+
+// 合并多层环境变量，后面的同名变量覆盖前面的
+func MergeVariables(layers ...Variables) Variables {
+	merged := make(Variables)
+	for _, layer := range layers {
+		for name, value := range layer {
+			merged[name] = value
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"github.com/betterde/ects/controllers/audit"
+	"github.com/betterde/ects/internal/middleware"
+	"github.com/kataras/iris/mvc"
+)
+
+func registerAudit(application *mvc.Application) {
+	application.Router.Use(middleware.Cache)
+	application.Handle(new(audit.Controller))
+}
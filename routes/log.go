@@ -2,9 +2,11 @@ package routes
 
 import (
 	"github.com/betterde/ects/controllers/log"
+	"github.com/betterde/ects/internal/middleware"
 	"github.com/kataras/iris/mvc"
 )
 
 func registerLog(application *mvc.Application) {
+	application.Router.Use(middleware.Cache)
 	application.Handle(new(log.Controller))
 }
@@ -2,11 +2,15 @@ package routes
 
 import (
 	"github.com/betterde/ects/controllers/node"
+	"github.com/betterde/ects/internal/middleware"
+	"github.com/betterde/ects/models"
 	"github.com/betterde/ects/services"
 	"github.com/kataras/iris/mvc"
 )
 
 func registerNode(application *mvc.Application) {
 	application.Register(services.NewNodeService())
+	application.Router.Use(middleware.Cache)
+	application.Router.Use(middleware.Authorize(models.ROLEOPERATOR))
 	application.Handle(new(node.Controller))
 }
@@ -2,11 +2,15 @@ package routes
 
 import (
 	"github.com/betterde/ects/controllers/pipeline"
+	"github.com/betterde/ects/internal/middleware"
+	"github.com/betterde/ects/models"
 	"github.com/betterde/ects/services"
 	"github.com/kataras/iris/mvc"
 )
 
 func registerPipeline(application *mvc.Application) {
 	application.Register(services.NewPipelineService())
+	application.Router.Use(middleware.Cache)
+	application.Router.Use(middleware.Authorize(models.ROLEOPERATOR))
 	application.Handle(new(pipeline.Controller))
 }
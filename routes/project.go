@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/betterde/ects/controllers/project"
+	"github.com/betterde/ects/internal/middleware"
+	"github.com/betterde/ects/models"
+	"github.com/kataras/iris/mvc"
+)
+
+func registerProject(application *mvc.Application) {
+	application.Router.Use(middleware.Authorize(models.ROLEOPERATOR))
+	application.Handle(new(project.Controller))
+}
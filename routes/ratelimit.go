@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/betterde/ects/controllers/ratelimit"
+	"github.com/betterde/ects/internal/middleware"
+	"github.com/betterde/ects/models"
+	"github.com/kataras/iris/mvc"
+)
+
+func registerRateLimit(application *mvc.Application) {
+	application.Router.Use(middleware.Authorize(models.ROLEADMIN))
+	application.Handle(new(ratelimit.Controller))
+}
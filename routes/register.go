@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/metrics"
 	"github.com/betterde/ects/internal/middleware"
 	"github.com/betterde/ects/web"
 	"github.com/kataras/iris"
@@ -18,20 +20,44 @@ func Register(app *iris.Application) {
 	})
 
 	mvc.Configure(app.PartyFunc("/api", func(api iris.Party) {
+		// 多个主节点同时运行时，修改数据的请求由领导者处理
+		api.Use(middleware.Leader)
 		mvc.Configure(api.Party("/auth"), authentication)
-		api.Use(middleware.JWTHandler.Serve)
+		// 分享链接通过签名校验，不需要登录
+		mvc.Configure(api.Party("/share"), registerShare)
+		// 接口文档不需要登录
+		api.Get("/spec", spec)
+		if config.Conf.Http.Swagger {
+			api.Get("/docs", swagger)
+		}
+		// 依次尝试配置中启用的认证方式，个别接口在路由注册时进一步限定认证方式
+		api.Use(middleware.Authenticate)
+		api.Use(middleware.Impersonation)
+		api.Use(middleware.PasswordChange)
 		mvc.Configure(api.Party("/task"), registerTask)
+		mvc.Configure(api.Party("/template"), registerTemplate)
 		mvc.Configure(api.Party("/node"), registerNode)
 		mvc.Configure(api.Party("/pipeline"), registerPipeline)
+		mvc.Configure(api.Party("/project"), registerProject)
 		mvc.Configure(api.Party("/dashboard"), registerDashboard)
 		mvc.Configure(api.Party("/user"), registerUser)
+		mvc.Configure(api.Party("/team"), registerTeam)
 		mvc.Configure(api.Party("/log"), registerLog)
+		mvc.Configure(api.Party("/audit"), registerAudit)
+		mvc.Configure(api.Party("/run"), registerRun)
 		mvc.Configure(api.Party("/setting"), registerSetting)
+		mvc.Configure(api.Party("/system"), registerSystem)
+		mvc.Configure(api.Party("/token"), registerToken)
+		mvc.Configure(api.Party("/ratelimit"), registerRateLimit)
+		mvc.Configure(api.Party("/secret"), registerSecret)
 		mvc.Configure(api.PartyFunc("/account", func(account iris.Party) {
 			mvc.Configure(account.Party("/profile"), registerProfile)
 		}))
 	}))
 
+	// 提供给 Prometheus 抓取，不需要认证
+	app.Get("/metrics", iris.FromStd(metrics.Handler()))
+
 	app.Use(iris.Gzip)
 	app.RegisterView(iris.HTML("./web/dist", ".html").Binary(web.Asset, web.AssetNames))
 
@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"github.com/betterde/ects/controllers/run"
+	"github.com/betterde/ects/internal/middleware"
+	"github.com/betterde/ects/models"
+	"github.com/kataras/iris/mvc"
+)
+
+func registerRun(application *mvc.Application) {
+	application.Router.Use(middleware.Cache)
+	application.Router.Use(middleware.Authorize(models.ROLEOPERATOR))
+	application.Handle(new(run.Controller))
+}
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/betterde/ects/controllers/secret"
+	"github.com/betterde/ects/internal/middleware"
+	"github.com/betterde/ects/models"
+	"github.com/kataras/iris/mvc"
+)
+
+func registerSecret(application *mvc.Application) {
+	application.Router.Use(middleware.Authorize(models.ROLEADMIN))
+	application.Handle(new(secret.Controller))
+}
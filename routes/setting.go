@@ -2,9 +2,12 @@ package routes
 
 import (
 	"github.com/betterde/ects/controllers/setting"
+	"github.com/betterde/ects/internal/middleware"
+	"github.com/betterde/ects/models"
 	"github.com/kataras/iris/mvc"
 )
 
 func registerSetting(application *mvc.Application) {
+	application.Router.Use(middleware.Authorize(models.ROLEADMIN))
 	application.Handle(new(setting.Controller))
 }
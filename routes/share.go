@@ -0,0 +1,10 @@
+package routes
+
+import (
+	"github.com/betterde/ects/controllers/run"
+	"github.com/kataras/iris/mvc"
+)
+
+func registerShare(application *mvc.Application) {
+	application.Handle(new(run.ShareController))
+}
@@ -0,0 +1,99 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/controllers/account"
+	"github.com/betterde/ects/controllers/audit"
+	"github.com/betterde/ects/controllers/auth"
+	"github.com/betterde/ects/controllers/dashboard"
+	logs "github.com/betterde/ects/controllers/log"
+	"github.com/betterde/ects/controllers/node"
+	"github.com/betterde/ects/controllers/organization"
+	"github.com/betterde/ects/controllers/pipeline"
+	"github.com/betterde/ects/controllers/project"
+	"github.com/betterde/ects/controllers/ratelimit"
+	"github.com/betterde/ects/controllers/run"
+	"github.com/betterde/ects/controllers/secret"
+	"github.com/betterde/ects/controllers/setting"
+	"github.com/betterde/ects/controllers/system"
+	"github.com/betterde/ects/controllers/task"
+	"github.com/betterde/ects/controllers/token"
+	"github.com/betterde/ects/internal/openapi"
+	"github.com/betterde/ects/internal/service"
+	"github.com/kataras/iris"
+	"html"
+	"log"
+	"strings"
+	"sync"
+)
+
+var (
+	document     map[string]interface{}
+	documentOnce sync.Once
+)
+
+// 与 Register 中挂载的路径保持一致
+func groups() []openapi.Group {
+	return []openapi.Group{
+		{Prefix: "/auth", Tag: "auth", Public: true, Operations: auth.Operations},
+		{Prefix: "/share", Tag: "share", Public: true, Operations: run.ShareOperations},
+		{Prefix: "/task", Tag: "task", Operations: task.Operations},
+		{Prefix: "/template", Tag: "template", Operations: task.TemplateOperations},
+		{Prefix: "/node", Tag: "node", Operations: node.Operations},
+		{Prefix: "/pipeline", Tag: "pipeline", Operations: pipeline.Operations},
+		{Prefix: "/project", Tag: "project", Operations: project.Operations},
+		{Prefix: "/dashboard", Tag: "dashboard", Operations: dashboard.Operations},
+		{Prefix: "/user", Tag: "user", Operations: organization.UserOperations},
+		{Prefix: "/team", Tag: "team", Operations: organization.TeamOperations},
+		{Prefix: "/log", Tag: "log", Operations: logs.Operations},
+		{Prefix: "/audit", Tag: "audit", Operations: audit.Operations},
+		{Prefix: "/run", Tag: "run", Operations: run.Operations},
+		{Prefix: "/setting", Tag: "setting", Operations: setting.Operations},
+		{Prefix: "/system", Tag: "system", Operations: system.Operations},
+		{Prefix: "/token", Tag: "token", Operations: token.Operations},
+		{Prefix: "/ratelimit", Tag: "ratelimit", Operations: ratelimit.Operations},
+		{Prefix: "/secret", Tag: "secret", Operations: secret.Operations},
+		{Prefix: "/account/profile", Tag: "account", Operations: account.Operations},
+	}
+}
+
+// 返回 OpenAPI 文档，首次请求时生成
+func spec(ctx iris.Context) {
+	documentOnce.Do(func() {
+		document = openapi.Document(openapi.Info{
+			Title:       "ECTS API",
+			Version:     service.Runtime.Version,
+			Description: "分布式任务调度系统的管理接口，请求需要携带登录获取的 JWT 或者 API 令牌",
+			Server:      "/api",
+		}, groups())
+	})
+
+	if _, err := ctx.JSON(document); err != nil {
+		log.Println(err)
+	}
+}
+
+// 加载 Swagger UI 展示 OpenAPI 文档
+func swagger(ctx iris.Context) {
+	assets := html.EscapeString(strings.TrimSuffix(config.Conf.Http.SwaggerUrl, "/"))
+	ctx.ContentType("text/html; charset=utf-8")
+	if _, err := ctx.WriteString(fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>ECTS API</title>
+<link rel="stylesheet" href="%[1]s/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="%[1]s/swagger-ui-bundle.js"></script>
+<script>
+SwaggerUIBundle({url: "/api/spec", dom_id: "#swagger-ui", persistAuthorization: true});
+</script>
+</body>
+</html>
+`, assets)); err != nil {
+		log.Println(err)
+	}
+}
@@ -2,11 +2,14 @@ package routes
 
 import (
 	"github.com/betterde/ects/controllers/task"
+	"github.com/betterde/ects/internal/middleware"
+	"github.com/betterde/ects/models"
 	"github.com/betterde/ects/services"
 	"github.com/kataras/iris/mvc"
 )
 
 func registerTask(application *mvc.Application) {
 	application.Register(services.NewTaskService())
+	application.Router.Use(middleware.Authorize(models.ROLEOPERATOR))
 	application.Handle(new(task.Controller))
 }
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/betterde/ects/controllers/organization"
+	"github.com/betterde/ects/internal/middleware"
+	"github.com/betterde/ects/models"
+	"github.com/kataras/iris/mvc"
+)
+
+func registerTeam(application *mvc.Application) {
+	application.Router.Use(middleware.Authorize(models.ROLEADMIN))
+	application.Handle(new(organization.TeamController))
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"github.com/betterde/ects/controllers/token"
+	"github.com/betterde/ects/internal/middleware"
+	"github.com/betterde/ects/services"
+	"github.com/kataras/iris/mvc"
+)
+
+func registerToken(application *mvc.Application) {
+	application.Register(services.NewUserService())
+	// 不能使用 API 令牌签发新的令牌
+	application.Router.Use(middleware.Require(middleware.AUTHJWT, middleware.AUTHLDAP, middleware.AUTHOIDC))
+	application.Handle(new(token.Controller))
+}
@@ -2,11 +2,14 @@ package routes
 
 import (
 	"github.com/betterde/ects/controllers/organization"
+	"github.com/betterde/ects/internal/middleware"
+	"github.com/betterde/ects/models"
 	"github.com/betterde/ects/services"
 	"github.com/kataras/iris/mvc"
 )
 
 func registerUser(application *mvc.Application) {
 	application.Register(services.NewUserService())
+	application.Router.Use(middleware.Authorize(models.ROLEADMIN))
 	application.Handle(new(organization.UserController))
 }
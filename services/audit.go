@@ -0,0 +1,12 @@
+package services
+
+import (
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/kataras/iris"
+)
+
+// 记录当前请求用户的操作日志，管理员代理操作时同时记录管理员
+func Audit(ctx iris.Context, model models.Model, operation string) error {
+	return models.CreateImpersonatedLog(model, utils.GetUID(ctx), utils.GetImpersonator(ctx), operation)
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"fmt"
+	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"github.com/gorhill/cronexpr"
+	"log"
+	"time"
+)
+
+type (
+	// 变更后绑定的节点及其当前状态
+	BindingNode struct {
+		Id       string `json:"id"`
+		Name     string `json:"name"`
+		Status   string `json:"status"`
+		Capacity int    `json:"capacity"`
+		Running  int    `json:"running"` // 节点最近上报的正在执行的流水线数量
+	}
+	// 一次计划执行在变更前后的执行节点
+	BindingFire struct {
+		Time      string   `json:"time"`
+		Before    []string `json:"before"`
+		After     []string `json:"after"`
+		Exclusive bool     `json:"exclusive"` // 是否只由列出的节点中的一个执行
+		Moved     bool     `json:"moved"`
+	}
+	// 绑定变更的模拟结果
+	BindingPreview struct {
+		Nodes     []*BindingNode  `json:"nodes"`
+		Added     []string        `json:"added"`
+		Removed   []string        `json:"removed"`
+		Running   []*discover.Run `json:"running"` // 在移除的节点上正在执行的流水线，变更后会继续执行到结束
+		Fires     []*BindingFire  `json:"fires"`
+		Conflicts []string        `json:"conflicts"`
+	}
+)
+
+// 按照节点能力选择工作节点，条件的值为空时只要求已安装，否则要求版本不低于该值
+func SelectNodes(selector map[string]string) ([]models.Node, error) {
+	nodes := make([]models.Node, 0)
+	if err := models.Engine.Where(builder.Eq{"mode": models.WORKER}).Asc("name").Find(&nodes); err != nil {
+		return nil, err
+	}
+
+	selected := make([]models.Node, 0)
+	for _, node := range nodes {
+		if matches(node.Capabilities, selector) {
+			selected = append(selected, node)
+		}
+	}
+
+	return selected, nil
+}
+
+// 模拟将流水线绑定到指定的节点，返回受影响的执行和容量冲突，不修改绑定关系
+func PreviewBinding(pipeline *models.Pipeline, nodesId []string, location *time.Location, count int) (*BindingPreview, error) {
+	relations := make([]models.PipelineNodePivot, 0)
+	if err := models.Engine.Where(builder.Eq{"pipeline_id": pipeline.Id}).Find(&relations); err != nil {
+		return nil, err
+	}
+
+	current := make([]string, 0, len(relations))
+	for _, relation := range relations {
+		current = append(current, relation.NodeId)
+	}
+
+	nodes := make(map[string]models.Node)
+	if err := models.Engine.Where(builder.Eq{"id": append(append([]string{}, current...), nodesId...)}).Find(&nodes); err != nil {
+		return nil, err
+	}
+
+	// Build 会追加节点和步骤，使用副本避免修改调用方的流水线
+	snapshot := *pipeline
+	snapshot.Nodes = nil
+	snapshot.Steps = nil
+	if _, err := snapshot.Build(); err != nil {
+		return nil, err
+	}
+
+	// 获取负载失败时只依据数据库中的节点状态判断
+	loads, err := discover.Loads()
+	if err != nil {
+		log.Println(err)
+		loads = make(map[string]*discover.Load)
+	}
+
+	preview := &BindingPreview{
+		Nodes:     make([]*BindingNode, 0, len(nodesId)),
+		Added:     difference(nodesId, current),
+		Removed:   difference(current, nodesId),
+		Running:   make([]*discover.Run, 0),
+		Fires:     make([]*BindingFire, 0, count),
+		Conflicts: make([]string, 0),
+	}
+
+	if len(nodesId) == 0 {
+		preview.Conflicts = append(preview.Conflicts, "没有节点，变更后流水线将不会执行")
+	}
+
+	before := make([]string, 0, len(current))
+	for _, id := range current {
+		if node, exist := nodes[id]; exist && node.Status == models.ONLINE {
+			before = append(before, id)
+		}
+	}
+
+	after := make([]string, 0, len(nodesId))
+	for _, id := range nodesId {
+		node, exist := nodes[id]
+		if !exist {
+			preview.Conflicts = append(preview.Conflicts, fmt.Sprintf("节点 %s 不存在", id))
+			continue
+		}
+
+		item := &BindingNode{
+			Id:       node.Id,
+			Name:     node.Name,
+			Status:   node.Status,
+			Capacity: node.Capacity,
+		}
+		if load, exist := loads[id]; exist {
+			item.Running = load.Running
+		}
+		preview.Nodes = append(preview.Nodes, item)
+
+		if conflict := conflictOf(&node, item, &snapshot); conflict != "" {
+			preview.Conflicts = append(preview.Conflicts, conflict)
+		}
+
+		if node.Mode == models.WORKER && node.Status == models.ONLINE {
+			after = append(after, id)
+		}
+	}
+
+	warnings, err := CheckRequirements(pipeline.Id, nodesId)
+	if err != nil {
+		log.Println(err)
+	}
+	preview.Conflicts = append(preview.Conflicts, warnings...)
+
+	if len(preview.Removed) > 0 {
+		runs, err := discover.Running("")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, run := range runs {
+			if run.PipelineId == pipeline.Id && contains(preview.Removed, run.NodeId) {
+				preview.Running = append(preview.Running, run)
+			}
+		}
+	}
+
+	// 停用的流水线不会被调度，无需预览计划执行
+	expression, err := cronexpr.Parse(pipeline.Spec)
+	if err != nil || pipeline.Status == models.PIPELINEDISABLED {
+		return preview, nil
+	}
+
+	exclusive := pipeline.Singleton == 1 || pipeline.Policy == models.POLICYANY || pipeline.Policy == models.POLICYLEASTLOADED
+	moved := len(difference(before, after)) > 0 || len(difference(after, before)) > 0
+	for _, fire := range expression.NextN(time.Now().In(location), uint(count)) {
+		preview.Fires = append(preview.Fires, &BindingFire{
+			Time:      fire.Format(time.RFC3339),
+			Before:    before,
+			After:     after,
+			Exclusive: exclusive,
+			Moved:     moved,
+		})
+	}
+
+	return preview, nil
+}
+
+// 检查节点是否可以执行流水线，可以执行时返回空字符串
+func conflictOf(node *models.Node, item *BindingNode, pipeline *models.Pipeline) string {
+	if node.Mode != models.WORKER {
+		return fmt.Sprintf("节点 %s 不是工作节点", node.Name)
+	}
+
+	switch node.Status {
+	case models.OFFLINE:
+		return fmt.Sprintf("节点 %s 已离线，恢复在线前不会执行流水线", node.Name)
+	case models.DRAINED:
+		return fmt.Sprintf("节点 %s 处于维护状态，不会执行新的流水线", node.Name)
+	}
+
+	if node.Capacity > 0 && item.Running >= node.Capacity {
+		return fmt.Sprintf("节点 %s 的并发已满（%d/%d），计划执行将被跳过", node.Name, item.Running, node.Capacity)
+	}
+
+	if _, err := node.Policy.Permit(pipeline); err != nil {
+		return fmt.Sprintf("节点 %s：%s", node.Name, err)
+	}
+
+	return ""
+}
+
+// 判断节点能力是否满足所有选择条件
+func matches(capabilities map[string]string, selector map[string]string) bool {
+	for name, version := range selector {
+		requirement := name
+		if version != "" {
+			requirement = name + ">=" + version
+		}
+
+		if !satisfied(capabilities, requirement) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// 返回在 items 中但不在 others 中的元素
+func difference(items []string, others []string) []string {
+	result := make([]string, 0)
+	for _, item := range items {
+		if !contains(others, item) {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+func contains(items []string, value string) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
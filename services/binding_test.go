@@ -0,0 +1,25 @@
+package services
+
+import "testing"
+
+func TestMatches(t *testing.T) {
+	capabilities := map[string]string{"python": "3.8.1", "docker": "unknown"}
+
+	if !matches(capabilities, map[string]string{"python": "3.6", "docker": ""}) {
+		t.Error("expected capabilities to match the selector")
+	}
+
+	if matches(capabilities, map[string]string{"python": "3.9"}) {
+		t.Error("expected an older version not to match")
+	}
+
+	if matches(capabilities, map[string]string{"node": ""}) {
+		t.Error("expected a missing capability not to match")
+	}
+}
+
+func TestDifference(t *testing.T) {
+	if result := difference([]string{"a", "b", "c"}, []string{"b"}); len(result) != 2 || result[0] != "a" || result[1] != "c" {
+		t.Errorf("unexpected difference %v", result)
+	}
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"fmt"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+	"time"
+)
+
+// 项目在统计周期内已使用的节点时长
+type budgetUsage struct {
+	Seconds int64 `xorm:"seconds"`
+}
+
+// 本月的开始时间
+func MonthOf(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+}
+
+// 项目在 [begin, end) 内已结束的执行使用的节点分钟，多节点执行时每个节点分别计算
+func BudgetUsed(projectId string, begin, end time.Time) (float64, error) {
+	usage := budgetUsage{}
+	_, err := models.Engine.Table(new(models.PipelineRecords)).
+		Join("INNER", "pipelines", "pipelines.id = pipeline_records.pipeline_id").
+		Select("SUM(pipeline_records.duration) AS seconds").
+		Where(builder.Eq{"pipelines.project_id": projectId}.
+			And(builder.Neq{"pipeline_records.status": models.RECORDRUNNING}).
+			And(builder.Gte{"pipeline_records.begin_with": begin}).
+			And(builder.Lt{"pipeline_records.begin_with": end})).
+		Get(&usage)
+
+	return float64(usage.Seconds) / 60, err
+}
+
+// 检查流水线所属项目本月的预算，关键流水线不受限制；超出预算时按照项目的处理方式拒绝执行，推迟执行时返回提示信息，
+// 执行组的多次执行不能合并推迟，deferrable 为 false 时一律拒绝
+func CheckBudget(pipeline *models.Pipeline, deferrable bool) (string, error) {
+	if pipeline.Critical || pipeline.ProjectId == "" {
+		return "", nil
+	}
+
+	project := &models.Project{}
+	exist, err := models.Engine.Id(pipeline.ProjectId).Cols("id", "name", "budget", "budget_action").Get(project)
+	if err != nil || !exist || project.Budget <= 0 {
+		return "", err
+	}
+
+	month := MonthOf(time.Now())
+	used, err := BudgetUsed(project.Id, month, month.AddDate(0, 1, 0))
+	if err != nil {
+		return "", err
+	}
+
+	if used < float64(project.Budget) {
+		return "", nil
+	}
+
+	if project.BudgetAction == models.BUDGETDEFER && deferrable {
+		return fmt.Sprintf("项目 %s 本月已使用 %.0f 节点分钟，超出预算 %d 分钟，本次执行将推迟到预算恢复后", project.Name, used, project.Budget), nil
+	}
+
+	return "", &PermissionError{
+		Code:    iris.StatusForbidden,
+		Cause:   response.CODEBUDGETEXCEEDED,
+		Message: fmt.Sprintf("项目 %s 本月已使用 %.0f 节点分钟，超出预算 %d 分钟，非关键流水线不能执行", project.Name, used, project.Budget),
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"github.com/gorhill/cronexpr"
+	"strings"
+	"time"
+)
+
+const (
+	CALENDARDAYS      = 14              // 未指定时导出的天数
+	CALENDARMAXDAYS   = 90              // 最多导出的天数
+	CALENDARMAXEVENTS = 500             // 每条流水线最多导出的触发次数，避免按秒执行的定时器生成过大的日历
+	CALENDARDURATION  = 5 * time.Minute // 没有执行记录时事件的默认时长
+	CALENDARSAMPLES   = 10              // 估算执行时长时参考的最近执行次数
+)
+
+// 将启用的流水线在 [from, from+days) 内的计划触发时间导出为 iCalendar 日历，事件时长按最近成功执行的平均耗时估算
+func Calendar(name string, pipelines []models.Pipeline, from time.Time, days int) ([]byte, error) {
+	end := from.AddDate(0, 0, days)
+
+	ids := make([]string, 0, len(pipelines))
+	for _, pipeline := range pipelines {
+		ids = append(ids, pipeline.Id)
+	}
+	zones := Timezones(ids)
+
+	buffer := &bytes.Buffer{}
+	line(buffer, "BEGIN:VCALENDAR")
+	line(buffer, "VERSION:2.0")
+	line(buffer, "PRODID:-//ECTS//Pipeline Schedule//EN")
+	line(buffer, "CALSCALE:GREGORIAN")
+	line(buffer, "METHOD:PUBLISH")
+	line(buffer, "X-WR-CALNAME:"+escape(name))
+
+	stamp := from.UTC().Format("20060102T150405Z")
+	for index := range pipelines {
+		pipeline := &pipelines[index]
+		if pipeline.Status != models.PIPELINEENABLED {
+			continue
+		}
+
+		expression, err := cronexpr.Parse(pipeline.Spec)
+		if err != nil {
+			continue
+		}
+
+		location, err := time.LoadLocation(Timezone(pipeline, zones))
+		if err != nil {
+			location = time.Local
+		}
+
+		duration, err := estimate(pipeline.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		description := escape(fmt.Sprintf("%s\n定时器：%s（%s）", pipeline.Description, pipeline.Spec, location.String()))
+		count := 0
+		for fire := models.NextFire(expression, from.Add(-time.Second), location, pipeline.DST); !fire.IsZero() && fire.Before(end) && count < CALENDARMAXEVENTS; fire = models.NextFire(expression, fire, location, pipeline.DST) {
+			line(buffer, "BEGIN:VEVENT")
+			line(buffer, fmt.Sprintf("UID:%s-%d@ects", pipeline.Id, fire.Unix()))
+			line(buffer, "DTSTAMP:"+stamp)
+			line(buffer, "DTSTART:"+fire.UTC().Format("20060102T150405Z"))
+			line(buffer, "DTEND:"+fire.Add(duration).UTC().Format("20060102T150405Z"))
+			line(buffer, "SUMMARY:"+escape(pipeline.Name))
+			line(buffer, "DESCRIPTION:"+description)
+			line(buffer, "END:VEVENT")
+			count++
+		}
+	}
+
+	line(buffer, "END:VCALENDAR")
+
+	return buffer.Bytes(), nil
+}
+
+// 按照最近几次成功执行的平均耗时估算事件时长
+func estimate(pipelineId string) (time.Duration, error) {
+	duration, exist, err := average(pipelineId)
+	if err != nil {
+		return 0, err
+	}
+
+	if !exist {
+		return CALENDARDURATION, nil
+	}
+
+	// 日历中不足一分钟的事件难以辨认
+	if duration > time.Minute {
+		return duration, nil
+	}
+
+	return time.Minute, nil
+}
+
+// 最近几次成功执行的平均耗时，没有成功执行的记录或者耗时都为 0 时返回 false
+func average(pipelineId string) (time.Duration, bool, error) {
+	records := make([]models.PipelineRecords, 0, CALENDARSAMPLES)
+	if err := models.Engine.Where(builder.Eq{"pipeline_id": pipelineId, "status": models.RECORDFINISHED}).Cols("duration").Desc("created_at").Limit(CALENDARSAMPLES).Find(&records); err != nil {
+		return 0, false, err
+	}
+
+	var total int64
+	for _, record := range records {
+		total += record.Duration
+	}
+
+	if len(records) == 0 || total == 0 {
+		return 0, false, nil
+	}
+
+	return time.Duration(total/int64(len(records))) * time.Second, true, nil
+}
+
+// 写入一行内容，超过 75 个字节的行按照 RFC 5545 折叠，不拆分多字节字符
+func line(buffer *bytes.Buffer, content string) {
+	width := 0
+	for _, char := range content {
+		size := len(string(char))
+		if width+size > 75 {
+			buffer.WriteString("\r\n ")
+			width = 1
+		}
+		buffer.WriteRune(char)
+		width += size
+	}
+	buffer.WriteString("\r\n")
+}
+
+// 转义文本中的特殊字符
+func escape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(strings.TrimSpace(text))
+}
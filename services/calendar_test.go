@@ -0,0 +1,28 @@
+package services
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLine(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	line(buffer, "SUMMARY:"+strings.Repeat("备份", 20))
+
+	for _, folded := range strings.Split(strings.TrimSuffix(buffer.String(), "\r\n"), "\r\n") {
+		if len(folded) > 75 {
+			t.Errorf("expected folded lines within 75 octets, got %d", len(folded))
+		}
+	}
+
+	if unfolded := strings.Replace(buffer.String(), "\r\n ", "", -1); unfolded != "SUMMARY:"+strings.Repeat("备份", 20)+"\r\n" {
+		t.Errorf("unexpected unfolded line %q", unfolded)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	if text := escape("a,b;c\\d\ne"); text != `a\,b\;c\\d\ne` {
+		t.Errorf("unexpected escaped text %q", text)
+	}
+}
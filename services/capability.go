@@ -0,0 +1,114 @@
+package services
+
+import (
+	"fmt"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"strings"
+)
+
+// 检查流水线中任务的环境依赖是否能被节点满足，返回不满足时的警告信息
+func CheckRequirements(pipelineId string, nodeIds []string) ([]string, error) {
+	warnings := make([]string, 0)
+
+	if nodeIds == nil {
+		relations := make([]models.PipelineNodePivot, 0)
+		if err := models.Engine.Where(builder.Eq{"pipeline_id": pipelineId}).Find(&relations); err != nil {
+			return warnings, err
+		}
+		for _, relation := range relations {
+			nodeIds = append(nodeIds, relation.NodeId)
+		}
+	}
+
+	pivots := make([]models.PipelineTaskPivot, 0)
+	if err := models.Engine.Where(builder.Eq{"pipeline_id": pipelineId}).Find(&pivots); err != nil {
+		return warnings, err
+	}
+
+	taskIds := make([]string, 0)
+	for _, pivot := range pivots {
+		taskIds = append(taskIds, pivot.TaskId)
+	}
+
+	if len(taskIds) == 0 || len(nodeIds) == 0 {
+		return warnings, nil
+	}
+
+	tasks := make([]models.Task, 0)
+	if err := models.Engine.Where(builder.Eq{"id": taskIds}).Find(&tasks); err != nil {
+		return warnings, err
+	}
+
+	nodes := make([]models.Node, 0)
+	if err := models.Engine.Where(builder.Eq{"id": nodeIds}).Find(&nodes); err != nil {
+		return warnings, err
+	}
+
+	pipeline := models.Pipeline{}
+	if _, err := models.Engine.Id(pipelineId).Get(&pipeline); err != nil {
+		return warnings, err
+	}
+
+	for _, node := range nodes {
+		// 没有安装 Docker 的节点直接在节点上执行，无法使用指定的镜像
+		if pipeline.Image != "" && !satisfied(node.Capabilities, "docker") {
+			warnings = append(warnings, fmt.Sprintf("节点 %s 未安装 Docker，将忽略流水线的执行镜像 %s", node.Name, pipeline.Image))
+		}
+
+		for _, task := range tasks {
+			if task.Mode == models.MODEDOCKER && !satisfied(node.Capabilities, "docker") {
+				warnings = append(warnings, fmt.Sprintf("节点 %s 未安装 Docker，无法执行任务 %s", node.Name, task.Name))
+			}
+
+			if task.Sandbox && !satisfied(node.Capabilities, "sandbox") {
+				warnings = append(warnings, fmt.Sprintf("节点 %s 不支持沙箱，任务 %s 将执行失败", node.Name, task.Name))
+			}
+
+			for _, requirement := range task.Requirements {
+				if !satisfied(node.Capabilities, requirement) {
+					warnings = append(warnings, fmt.Sprintf("节点 %s 不满足任务 %s 的环境依赖 %s", node.Name, task.Name, requirement))
+				}
+			}
+		}
+	}
+
+	// 绑定的节点都没有提供数据位置时仍然可以执行，但需要跨节点读取或复制数据
+	for _, task := range tasks {
+		for _, hint := range task.Locality {
+			local := false
+			for _, node := range nodes {
+				if models.Local(node.Volumes, hint) {
+					local = true
+					break
+				}
+			}
+
+			if !local {
+				warnings = append(warnings, fmt.Sprintf("绑定的节点均未提供任务 %s 的数据位置 %s", task.Name, hint))
+			}
+		}
+	}
+
+	return warnings, nil
+}
+
+// 判断节点能力是否满足单个依赖，依赖格式为 name 或 name>=version
+func satisfied(capabilities map[string]string, requirement string) bool {
+	name, version := requirement, ""
+	if index := strings.Index(requirement, ">="); index > 0 {
+		name, version = requirement[:index], requirement[index+2:]
+	}
+
+	installed, exist := capabilities[strings.TrimSpace(name)]
+	if !exist {
+		return false
+	}
+
+	if version == "" || installed == "unknown" {
+		return true
+	}
+
+	return utils.CompareVersion(installed, strings.TrimSpace(version)) >= 0
+}
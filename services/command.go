@@ -0,0 +1,91 @@
+package services
+
+import (
+	"encoding/json"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"sort"
+)
+
+// 执行内容与任务定义不一致的步骤
+type UnexpectedCommand struct {
+	Step     models.TaskRecords `json:"step"`
+	Expected []string           `json:"expected"` // 任务当前定义和历史定义的执行内容摘要
+}
+
+// 找出执行内容摘要不属于任务当前定义或者操作日志中任何历史定义的步骤，未记录摘要的步骤不参与校验
+func VerifyCommands(cond builder.Cond) ([]*UnexpectedCommand, error) {
+	steps := make([]models.TaskRecords, 0)
+	if err := models.Engine.Where(cond.And(builder.Neq{"command_hash": ""})).
+		Cols("id", "pipeline_record_id", "task_id", "node_id", "task_name", "worker_name", "mode", "command_hash", "status", "begin_with").
+		Asc("id").Find(&steps); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0)
+	for _, step := range steps {
+		ids = append(ids, step.TaskId)
+	}
+
+	known, err := commandHashes(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	unexpected := make([]*UnexpectedCommand, 0)
+	for _, step := range steps {
+		if known[step.TaskId][step.CommandHash] {
+			continue
+		}
+
+		expected := make([]string, 0, len(known[step.TaskId]))
+		for hash := range known[step.TaskId] {
+			expected = append(expected, hash)
+		}
+		sort.Strings(expected)
+
+		unexpected = append(unexpected, &UnexpectedCommand{Step: step, Expected: expected})
+	}
+
+	return unexpected, nil
+}
+
+// 任务当前定义以及创建、修改时记录在操作日志中的定义对应的执行内容摘要
+func commandHashes(ids []string) (map[string]map[string]bool, error) {
+	known := make(map[string]map[string]bool)
+	if len(ids) == 0 {
+		return known, nil
+	}
+
+	add := func(task *models.Task) {
+		if task.Id == "" || task.Mode == "" {
+			return
+		}
+		if known[task.Id] == nil {
+			known[task.Id] = make(map[string]bool)
+		}
+		known[task.Id][task.CommandHash()] = true
+	}
+
+	tasks := make([]*models.Task, 0)
+	if err := models.Engine.In("id", ids).Find(&tasks); err != nil {
+		return nil, err
+	}
+	for _, task := range tasks {
+		add(task)
+	}
+
+	logs := make([]models.Log, 0)
+	if err := models.Engine.Where(builder.Eq{"resource": models.RESOURCETASK}.And(builder.In("resource_id", ids))).Cols("resource_id", "result").Find(&logs); err != nil {
+		return nil, err
+	}
+	for _, log := range logs {
+		task := &models.Task{}
+		if err := json.Unmarshal([]byte(log.Result), task); err != nil {
+			continue
+		}
+		add(task)
+	}
+
+	return known, nil
+}
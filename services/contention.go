@@ -0,0 +1,294 @@
+package services
+
+import (
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"github.com/gorhill/cronexpr"
+	"sort"
+	"time"
+)
+
+const (
+	CONTENTIONHOURS     = 24   // 未指定时检查的小时数
+	CONTENTIONMAXHOURS  = 168  // 最多检查的小时数
+	CONTENTIONMAXEVENTS = 2000 // 每条流水线最多展开的触发次数
+)
+
+type (
+	// 节点上预计同时执行的流水线超过容量的时间段
+	Contention struct {
+		NodeId    string                `json:"node_id"`
+		NodeName  string                `json:"node_name"`
+		Capacity  int                   `json:"capacity"`
+		Begin     utils.Time            `json:"begin"`
+		End       utils.Time            `json:"end"`
+		Peak      int                   `json:"peak"`      // 时间段内预计同时执行的最大数量
+		Pipelines []*ContentionPipeline `json:"pipelines"` // 当前用户可见的流水线
+		Hidden    int                   `json:"hidden"`    // 当前用户不可见的流水线数量
+	}
+	// 参与争用的流水线
+	ContentionPipeline struct {
+		Id        string `json:"id"`
+		Name      string `json:"name"`
+		Duration  int64  `json:"duration"`  // 估算的执行时长，单位为秒
+		History   bool   `json:"history"`   // 是否按照最近的执行记录估算，否则使用默认时长
+		Exclusive bool   `json:"exclusive"` // 每次只由一个绑定节点执行，不一定在该节点上执行
+	}
+	// 流水线的一次计划执行
+	occurrence struct {
+		pipeline string
+		begin    time.Time
+		end      time.Time
+	}
+	// 同时执行的数量超过容量的时间段
+	window struct {
+		begin     time.Time
+		end       time.Time
+		peak      int
+		pipelines []string
+	}
+)
+
+// 按照定时器和最近的执行时长预测 [from, from+hours) 内绑定在同一节点上的流水线同时执行的数量超过节点容量的时间段，
+// visible 限定当前用户可见的流水线，pipelineId 不为空时只返回该流水线参与的时间段
+func Contentions(visible builder.Cond, pipelineId string, from time.Time, hours int) ([]*Contention, error) {
+	end := from.Add(time.Duration(hours) * time.Hour)
+
+	scope := builder.In("pipeline_id", builder.Select("id").From(new(models.Pipeline).TableName()).Where(visible))
+	if pipelineId != "" {
+		scope = builder.Eq{"pipeline_id": pipelineId}
+	}
+
+	relations := make([]models.PipelineNodePivot, 0)
+	if err := models.Engine.Where(scope).Find(&relations); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(relations))
+	for _, relation := range relations {
+		ids = append(ids, relation.NodeId)
+	}
+
+	result := make([]*Contention, 0)
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	// 不限制并发的节点不会发生争用
+	nodes := make([]*models.Node, 0)
+	if err := models.Engine.In("id", ids).Where(builder.Gt{"capacity": 0}).Find(&nodes); err != nil {
+		return nil, err
+	}
+
+	if len(nodes) == 0 {
+		return result, nil
+	}
+
+	ids = ids[:0]
+	for _, node := range nodes {
+		ids = append(ids, node.Id)
+	}
+
+	relations = relations[:0]
+	if err := models.Engine.In("node_id", ids).Find(&relations); err != nil {
+		return nil, err
+	}
+
+	bound := make(map[string]bool)
+	ids = ids[:0]
+	for _, relation := range relations {
+		if !bound[relation.PipelineId] {
+			bound[relation.PipelineId] = true
+			ids = append(ids, relation.PipelineId)
+		}
+	}
+
+	pipelines := make([]*models.Pipeline, 0)
+	if err := models.Engine.In("id", ids).Where(builder.Eq{"status": models.PIPELINEENABLED}).Find(&pipelines); err != nil {
+		return nil, err
+	}
+
+	allowed := make([]*models.Pipeline, 0)
+	if err := models.Engine.In("id", ids).Where(visible).Cols("id").Find(&allowed); err != nil {
+		return nil, err
+	}
+
+	shown := make(map[string]bool)
+	for _, pipeline := range allowed {
+		shown[pipeline.Id] = true
+	}
+
+	zones := Timezones(ids)
+	summaries := make(map[string]*ContentionPipeline)
+	schedules := make(map[string][]occurrence)
+	for _, pipeline := range pipelines {
+		expression, err := cronexpr.Parse(pipeline.Spec)
+		if err != nil {
+			continue
+		}
+
+		location, err := time.LoadLocation(Timezone(pipeline, zones))
+		if err != nil {
+			location = time.Local
+		}
+
+		duration, history, err := average(pipeline.Id)
+		if err != nil {
+			return nil, err
+		}
+		if !history {
+			duration = CALENDARDURATION
+		}
+		if duration < time.Second {
+			duration = time.Second
+		}
+
+		// 从检查范围开始前一个执行时长的位置展开，包含范围开始时仍在执行的记录
+		fires := make([]time.Time, 0)
+		for fire := models.NextFire(expression, from.Add(-duration).Add(-time.Second), location, pipeline.DST); !fire.IsZero() && fire.Before(end) && len(fires) < CONTENTIONMAXEVENTS; fire = models.NextFire(expression, fire, location, pipeline.DST) {
+			fires = append(fires, fire)
+		}
+
+		schedules[pipeline.Id] = expand(pipeline.Id, pipeline.ConcurrencyMode(), fires, duration)
+		summaries[pipeline.Id] = &ContentionPipeline{
+			Id:        pipeline.Id,
+			Name:      pipeline.Name,
+			Duration:  int64(duration / time.Second),
+			History:   history,
+			Exclusive: pipeline.Singleton == 1 || pipeline.Policy == models.POLICYANY || pipeline.Policy == models.POLICYLEASTLOADED,
+		}
+	}
+
+	for _, node := range nodes {
+		occurrences := make([]occurrence, 0)
+		for _, relation := range relations {
+			if relation.NodeId == node.Id {
+				occurrences = append(occurrences, schedules[relation.PipelineId]...)
+			}
+		}
+
+		for _, span := range overlaps(node.Capacity, occurrences) {
+			if !span.end.After(from) || (pipelineId != "" && !contains(span.pipelines, pipelineId)) {
+				continue
+			}
+
+			if span.begin.Before(from) {
+				span.begin = from
+			}
+			if span.end.After(end) {
+				span.end = end
+			}
+
+			contention := &Contention{
+				NodeId:    node.Id,
+				NodeName:  node.Name,
+				Capacity:  node.Capacity,
+				Begin:     utils.Time(span.begin),
+				End:       utils.Time(span.end),
+				Peak:      span.peak,
+				Pipelines: make([]*ContentionPipeline, 0, len(span.pipelines)),
+			}
+			for _, id := range span.pipelines {
+				if shown[id] {
+					contention.Pipelines = append(contention.Pipelines, summaries[id])
+				} else {
+					contention.Hidden++
+				}
+			}
+			result = append(result, contention)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return time.Time(result[i].Begin).Before(time.Time(result[j].Begin))
+	})
+
+	return result, nil
+}
+
+// 按照并发策略展开流水线的计划执行，禁止并发时跳过上一次执行尚未结束时的触发，替换时提前结束上一次执行
+func expand(pipeline, mode string, fires []time.Time, duration time.Duration) []occurrence {
+	occurrences := make([]occurrence, 0, len(fires))
+	for _, fire := range fires {
+		if last := len(occurrences) - 1; last >= 0 && fire.Before(occurrences[last].end) {
+			switch mode {
+			case models.CONCURRENCYFORBID:
+				continue
+			case models.CONCURRENCYREPLACE:
+				occurrences[last].end = fire
+			}
+		}
+
+		occurrences = append(occurrences, occurrence{pipeline: pipeline, begin: fire, end: fire.Add(duration)})
+	}
+
+	return occurrences
+}
+
+// 扫描所有计划执行的开始和结束时间，找出同时执行的数量超过容量的时间段，同一时刻先处理结束再处理开始
+func overlaps(capacity int, occurrences []occurrence) []window {
+	type event struct {
+		at    time.Time
+		delta int
+		index int
+	}
+
+	events := make([]event, 0, len(occurrences)*2)
+	for index, item := range occurrences {
+		if !item.end.After(item.begin) {
+			continue
+		}
+		events = append(events, event{at: item.begin, delta: 1, index: index}, event{at: item.end, delta: -1, index: index})
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].at.Equal(events[j].at) {
+			return events[i].delta < events[j].delta
+		}
+		return events[i].at.Before(events[j].at)
+	})
+
+	windows := make([]window, 0)
+	active := make(map[int]bool)
+	var current *window
+	seen := make(map[string]bool)
+	for _, item := range events {
+		if item.delta > 0 {
+			active[item.index] = true
+		} else {
+			delete(active, item.index)
+		}
+
+		if len(active) > capacity {
+			if current == nil {
+				current = &window{begin: item.at}
+				seen = make(map[string]bool)
+				// 同一时刻结束又开始的执行不拆分时间段
+				if last := len(windows) - 1; last >= 0 && windows[last].end.Equal(item.at) {
+					current = &windows[last]
+					windows = windows[:last]
+					for _, id := range current.pipelines {
+						seen[id] = true
+					}
+				}
+			}
+			if len(active) > current.peak {
+				current.peak = len(active)
+			}
+			for index := range active {
+				if id := occurrences[index].pipeline; !seen[id] {
+					seen[id] = true
+					current.pipelines = append(current.pipelines, id)
+				}
+			}
+		} else if current != nil {
+			current.end = item.at
+			sort.Strings(current.pipelines)
+			windows = append(windows, *current)
+			current = nil
+		}
+	}
+
+	return windows
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"github.com/betterde/ects/models"
+	"testing"
+	"time"
+)
+
+func TestOverlaps(t *testing.T) {
+	base := time.Date(2019, 8, 1, 2, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time {
+		return base.Add(time.Duration(minutes) * time.Minute)
+	}
+
+	occurrences := []occurrence{
+		{pipeline: "a", begin: at(0), end: at(30)},
+		{pipeline: "b", begin: at(10), end: at(20)},
+		{pipeline: "c", begin: at(20), end: at(40)},
+		{pipeline: "d", begin: at(60), end: at(70)},
+	}
+
+	windows := overlaps(1, occurrences)
+	if len(windows) != 1 {
+		t.Fatalf("expected 1 window, got %d", len(windows))
+	}
+
+	span := windows[0]
+	if !span.begin.Equal(at(10)) || !span.end.Equal(at(30)) || span.peak != 2 {
+		t.Errorf("unexpected window %v - %v peak %d", span.begin, span.end, span.peak)
+	}
+	if len(span.pipelines) != 3 || span.pipelines[0] != "a" || span.pipelines[2] != "c" {
+		t.Errorf("unexpected pipelines %v", span.pipelines)
+	}
+
+	if windows := overlaps(2, occurrences); len(windows) != 0 {
+		t.Errorf("expected no window within capacity, got %d", len(windows))
+	}
+}
+
+func TestExpand(t *testing.T) {
+	base := time.Date(2019, 8, 1, 2, 0, 0, 0, time.UTC)
+	fires := []time.Time{base, base.Add(time.Minute), base.Add(2 * time.Minute)}
+	duration := 90 * time.Second
+
+	if occurrences := expand("a", models.CONCURRENCYALLOW, fires, duration); len(occurrences) != 3 {
+		t.Errorf("expected 3 occurrences when allowed, got %d", len(occurrences))
+	}
+
+	forbid := expand("a", models.CONCURRENCYFORBID, fires, duration)
+	if len(forbid) != 2 || !forbid[1].begin.Equal(fires[2]) {
+		t.Errorf("expected overlapping fire to be skipped, got %v", forbid)
+	}
+
+	replace := expand("a", models.CONCURRENCYREPLACE, fires, duration)
+	if len(replace) != 3 || !replace[0].end.Equal(fires[1]) || !replace[2].end.Equal(fires[2].Add(duration)) {
+		t.Errorf("expected previous run to be replaced, got %v", replace)
+	}
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"math"
+	"sort"
+	"time"
+)
+
+type (
+	// 估算执行费用的费率，节点费用按照执行记录的时长计算，任务类型的费用按照步骤的时长计算
+	CostModel struct {
+		Currency   string
+		NodeMinute float64
+		Nodes      map[string]float64
+		Modes      map[string]float64
+	}
+	// 流水线在统计周期内的估算费用
+	CostEntry struct {
+		PipelineId string  `json:"pipeline_id"`
+		Name       string  `json:"name"`
+		Runs       int64   `json:"runs"`    // 执行次数，不包含正在执行的记录
+		Minutes    float64 `json:"minutes"` // 执行记录的总时长
+		Cost       float64 `json:"cost"`
+	}
+	// 月度费用报表
+	CostReport struct {
+		Month     string       `json:"month"`
+		Currency  string       `json:"currency"`
+		Total     float64      `json:"total"`
+		Pipelines []*CostEntry `json:"pipelines"`
+	}
+	// 按照流水线和节点汇总的执行时长
+	nodeUsage struct {
+		PipelineId string `xorm:"pipeline_id"`
+		WorkerName string `xorm:"worker_name"`
+		Runs       int64  `xorm:"runs"`
+		Seconds    int64  `xorm:"seconds"`
+	}
+	// 按照流水线和任务类型汇总的步骤时长
+	modeUsage struct {
+		PipelineId string `xorm:"pipeline_id"`
+		Mode       string `xorm:"mode"`
+		Seconds    int64  `xorm:"seconds"`
+	}
+)
+
+// 使用配置文件中的费率
+func Cost() *CostModel {
+	return &CostModel{
+		Currency:   config.Conf.Cost.Currency,
+		NodeMinute: config.Conf.Cost.NodeMinute,
+		Nodes:      config.Conf.Cost.Nodes,
+		Modes:      config.Conf.Cost.Modes,
+	}
+}
+
+// 是否配置了费率
+func (model *CostModel) Enabled() bool {
+	if model.NodeMinute > 0 {
+		return true
+	}
+
+	for _, rates := range []map[string]float64{model.Nodes, model.Modes} {
+		for _, rate := range rates {
+			if rate > 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// 节点每分钟的费用
+func (model *CostModel) nodeRate(name string) float64 {
+	if rate, exist := model.Nodes[name]; exist {
+		return rate
+	}
+
+	return model.NodeMinute
+}
+
+// 估算单次执行的费用
+func (model *CostModel) Estimate(record *models.PipelineRecords, steps []*models.TaskRecords) float64 {
+	cost := float64(record.Duration) / 60 * model.nodeRate(record.WorkerName)
+	for _, step := range steps {
+		cost += float64(step.Duration) / 60 * model.Modes[step.Mode]
+	}
+
+	return round(cost)
+}
+
+// 估算可见的流水线在 [begin, end) 内已结束的执行的费用，按照费用从高到低排列
+func (model *CostModel) Pipelines(visible builder.Cond, begin, end time.Time) ([]*CostEntry, error) {
+	pipelines := make([]models.Pipeline, 0)
+	if err := models.Engine.Where(visible).Cols("id", "name").Find(&pipelines); err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]*CostEntry, len(pipelines))
+	ids := make([]string, 0, len(pipelines))
+	for _, pipeline := range pipelines {
+		ids = append(ids, pipeline.Id)
+		entries[pipeline.Id] = &CostEntry{PipelineId: pipeline.Id, Name: pipeline.Name}
+	}
+
+	if len(ids) == 0 {
+		return make([]*CostEntry, 0), nil
+	}
+
+	cond := builder.In("pipeline_records.pipeline_id", ids).
+		And(builder.Neq{"pipeline_records.status": models.RECORDRUNNING}).
+		And(builder.Gte{"pipeline_records.begin_with": begin}).
+		And(builder.Lt{"pipeline_records.begin_with": end})
+
+	nodes := make([]nodeUsage, 0)
+	if err := models.Engine.Table(new(models.PipelineRecords)).
+		Select("pipeline_records.pipeline_id, pipeline_records.worker_name, COUNT(*) AS runs, SUM(pipeline_records.duration) AS seconds").
+		Where(cond).GroupBy("pipeline_records.pipeline_id, pipeline_records.worker_name").Find(&nodes); err != nil {
+		return nil, err
+	}
+
+	for _, usage := range nodes {
+		entry := entries[usage.PipelineId]
+		entry.Runs += usage.Runs
+		entry.Minutes += float64(usage.Seconds) / 60
+		entry.Cost += float64(usage.Seconds) / 60 * model.nodeRate(usage.WorkerName)
+	}
+
+	if len(model.Modes) > 0 {
+		modes := make([]modeUsage, 0)
+		if err := models.Engine.Table(new(models.TaskRecords)).
+			Join("INNER", "pipeline_records", "pipeline_records.id = task_records.pipeline_record_id").
+			Select("pipeline_records.pipeline_id, task_records.mode, SUM(task_records.duration) AS seconds").
+			Where(cond).GroupBy("pipeline_records.pipeline_id, task_records.mode").Find(&modes); err != nil {
+			return nil, err
+		}
+
+		for _, usage := range modes {
+			entries[usage.PipelineId].Cost += float64(usage.Seconds) / 60 * model.Modes[usage.Mode]
+		}
+	}
+
+	result := make([]*CostEntry, 0, len(entries))
+	for _, entry := range entries {
+		entry.Minutes = round(entry.Minutes)
+		entry.Cost = round(entry.Cost)
+		result = append(result, entry)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Cost != result[j].Cost {
+			return result[i].Cost > result[j].Cost
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// 估算可见的流水线在指定月份的执行费用
+func (model *CostModel) Report(visible builder.Cond, month time.Time) (*CostReport, error) {
+	entries, err := model.Pipelines(visible, month, month.AddDate(0, 1, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CostReport{Month: month.Format("2006-01"), Currency: model.Currency, Pipelines: entries}
+	for _, entry := range entries {
+		report.Total += entry.Cost
+	}
+	report.Total = round(report.Total)
+
+	return report, nil
+}
+
+// 保留四位小数
+func round(value float64) float64 {
+	return math.Round(value*10000) / 10000
+}
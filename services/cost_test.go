@@ -0,0 +1,26 @@
+package services
+
+import (
+	"github.com/betterde/ects/models"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	model := &CostModel{NodeMinute: 0.1, Nodes: map[string]float64{"gpu": 1}, Modes: map[string]float64{models.MODEDOCKER: 0.05}}
+	if !model.Enabled() {
+		t.Fatal("expected a model with rates to be enabled")
+	}
+
+	steps := []*models.TaskRecords{{Mode: models.MODESHELL, Duration: 60}, {Mode: models.MODEDOCKER, Duration: 120}}
+	if cost := model.Estimate(&models.PipelineRecords{WorkerName: "cpu", Duration: 180}, steps); cost != 0.4 {
+		t.Errorf("expected cost 0.4, got %v", cost)
+	}
+
+	if cost := model.Estimate(&models.PipelineRecords{WorkerName: "gpu", Duration: 180}, nil); cost != 3 {
+		t.Errorf("expected node specific rate, got %v", cost)
+	}
+
+	if (&CostModel{Modes: map[string]float64{models.MODESHELL: 0}}).Enabled() {
+		t.Error("expected a model without rates to be disabled")
+	}
+}
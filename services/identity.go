@@ -0,0 +1,86 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/identity"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/satori/go.uuid"
+	"log"
+	"strings"
+	"time"
+)
+
+// 使用外部身份登录，签发与本地账号相同的 JWT
+func SignInExternal(external *identity.Identity) (*models.User, string, error) {
+	user, err := ProvisionExternal(external)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, err := IssueToken(user)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := models.CreateLog(user, user.Id, "USER SIGN IN VIA "+strings.ToUpper(external.Provider)); err != nil {
+		log.Println(err)
+	}
+
+	return user, token, nil
+}
+
+// 按邮箱关联外部身份对应的本地用户，不存在时自动创建，匹配到用户组时同步角色
+func ProvisionExternal(external *identity.Identity) (*models.User, error) {
+	role := external.Role()
+	user := (&UserService{}).FindByEmail(external.Email)
+
+	if user == nil {
+		if role == "" {
+			role = config.Conf.Identity.DefaultRole
+		}
+
+		if !models.ValidRole(role) {
+			return nil, identity.ErrNoRole
+		}
+
+		// 外部用户不使用本地密码登录，设置无人知晓的随机密码
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+
+		pass, err := models.GeneratePassword(hex.EncodeToString(secret))
+		if err != nil {
+			return nil, err
+		}
+
+		name := external.Name
+		if name == "" {
+			name = external.Email
+		}
+
+		user = &models.User{
+			Id:        uuid.NewV4().String(),
+			Name:      name,
+			Email:     external.Email,
+			Password:  string(pass),
+			CreatedAt: utils.Time(time.Now()),
+			UpdatedAt: utils.Time(time.Now()),
+		}
+		user.Assign(role)
+
+		if err := user.Store(); err != nil {
+			return nil, err
+		}
+	} else if role != "" && role != user.Authority() {
+		user.Assign(role)
+		if _, err := models.Engine.Id(user.Id).Cols("role", "manager").Update(user); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidResetToken = errors.New("密码重置链接无效或已过期")
+)
+
+// 生成签名的密码重置令牌，令牌的摘要保存在数据库中，确保只能使用一次
+func IssueResetToken(email string) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	token := signResetToken(email, time.Now().Add(models.RESETEXPIRES), hex.EncodeToString(nonce))
+
+	// 只清理过期的令牌，避免他人反复请求使用户收到的链接失效
+	if _, err := models.Engine.Where(builder.Eq{"email": email}.And(builder.Lt{"created_at": time.Now().Add(-models.RESETEXPIRES)})).Delete(&models.PasswordResets{}); err != nil {
+		return "", err
+	}
+
+	reset := &models.PasswordResets{
+		Email:     email,
+		Token:     digest(token),
+		CreatedAt: time.Now(),
+	}
+
+	if _, err := models.Engine.Insert(reset); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// 校验密码重置令牌，返回令牌对应的邮箱
+func VerifyResetToken(token string) (string, error) {
+	email, err := parseResetToken(token, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	exist, err := models.Engine.Where(builder.Eq{"email": email, "token": digest(token)}).Exist(&models.PasswordResets{})
+	if err != nil {
+		return "", err
+	}
+
+	if !exist {
+		return "", ErrInvalidResetToken
+	}
+
+	return email, nil
+}
+
+// 生成包含邮箱、过期时间和随机数的签名令牌
+func signResetToken(email string, expires time.Time, nonce string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s|%d|%s", email, expires.Unix(), nonce)))
+	return payload + "." + sign(payload)
+}
+
+// 校验令牌的签名和有效期，返回令牌对应的邮箱
+func parseResetToken(token string, now time.Time) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(sign(parts[0])), []byte(parts[1])) {
+		return "", ErrInvalidResetToken
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalidResetToken
+	}
+
+	fields := strings.Split(string(decoded), "|")
+	if len(fields) != 3 {
+		return "", ErrInvalidResetToken
+	}
+
+	expires, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || now.Unix() > expires {
+		return "", ErrInvalidResetToken
+	}
+
+	return fields[0], nil
+}
+
+// 使用密码重置令牌设置新密码，令牌使用后失效
+func ResetPassword(token, password string) (*models.User, error) {
+	email, err := VerifyResetToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	user := models.User{}
+	exist, err := models.Engine.Where(builder.Eq{"email": email}).Get(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exist {
+		return nil, ErrInvalidResetToken
+	}
+
+	if err := ChangePassword(&user, password); err != nil {
+		return nil, err
+	}
+
+	if _, err := models.Engine.Where(builder.Eq{"email": email}).Delete(&models.PasswordResets{}); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// 修改用户密码，同时清除必须修改密码的标记
+func ChangePassword(user *models.User, password string) error {
+	hash, err := models.GeneratePassword(password)
+	if err != nil {
+		return err
+	}
+
+	user.Password = string(hash)
+	user.MustChange = false
+	_, err = models.Engine.Id(user.Id).Cols("password", "must_change").Update(user)
+	return err
+}
+
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(config.Conf.Auth.Secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func digest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
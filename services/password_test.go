@@ -0,0 +1,33 @@
+package services
+
+import (
+	"github.com/betterde/ects/config"
+	"testing"
+	"time"
+)
+
+func TestResetToken(t *testing.T) {
+	config.Conf = &config.Config{}
+	config.Conf.Auth.Secret = "secret"
+
+	now := time.Now()
+	token := signResetToken("user@example.com", now.Add(time.Hour), "nonce")
+
+	email, err := parseResetToken(token, now)
+	if err != nil || email != "user@example.com" {
+		t.Errorf("有效的令牌校验失败：%s %v", email, err)
+	}
+
+	if _, err := parseResetToken(token, now.Add(2*time.Hour)); err != ErrInvalidResetToken {
+		t.Errorf("过期的令牌应该校验失败")
+	}
+
+	if _, err := parseResetToken(token+"x", now); err != ErrInvalidResetToken {
+		t.Errorf("签名错误的令牌应该校验失败")
+	}
+
+	config.Conf.Auth.Secret = "another"
+	if _, err := parseResetToken(token, now); err != ErrInvalidResetToken {
+		t.Errorf("使用其他密钥签名的令牌应该校验失败")
+	}
+}
@@ -1,8 +1,27 @@
 package services
 
+import (
+	"github.com/betterde/ects/internal/response"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+)
+
+var ErrForbidden = &PermissionError{Code: iris.StatusForbidden, Cause: response.CODEFORBIDDEN, Message: "你不是该团队的成员"}
+
 type (
+	// 权限检查失败的原因，Code 为对应的 HTTP 状态码，Cause 为可选的错误码，其他调用方只需要判断错误类型
+	PermissionError struct {
+		Code    int
+		Cause   string
+		Message string
+	}
+
+	// 按照用户所在的团队检查数据的访问权限，HTTP、命令行和节点间调用共用同一套规则
 	PermissionInterface interface {
+		Authorize(uid, teamId string) error
+		Visible(uid string) (builder.Cond, error)
 	}
+
 	PermissionService struct {
 	}
 )
@@ -10,3 +29,41 @@ type (
 func NewPermissionService() PermissionInterface {
 	return &PermissionService{}
 }
+
+func (err *PermissionError) Error() string {
+	return err.Message
+}
+
+// 错误对应的 HTTP 状态码
+func (err *PermissionError) Status() int {
+	return err.Code
+}
+
+// 错误对应的错误码
+func (err *PermissionError) Reason() string {
+	return err.Cause
+}
+
+// 资源不存在时的错误
+func NotFound(reason, message string) error {
+	return &PermissionError{Code: iris.StatusNotFound, Cause: reason, Message: message}
+}
+
+// 检查用户是否可以访问共享给指定团队的数据，不能访问时返回 ErrForbidden
+func (service *PermissionService) Authorize(uid, teamId string) error {
+	ok, err := Accessible(uid, teamId)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// 用户可见数据的查询条件
+func (service *PermissionService) Visible(uid string) (builder.Cond, error) {
+	return Visible(uid)
+}
@@ -1,13 +1,40 @@
 package services
 
+import (
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/models"
+)
+
 type (
 	PipelineInterface interface {
+		PermissionInterface
+		Find(uid, id string) (*models.Pipeline, error)
 	}
 
 	PipelineService struct {
+		PermissionService
 	}
 )
 
 func NewPipelineService() PipelineInterface {
 	return &PipelineService{}
 }
+
+// 查询流水线并检查用户是否可以访问其所属团队的数据
+func (service *PipelineService) Find(uid, id string) (*models.Pipeline, error) {
+	pipeline := &models.Pipeline{}
+	exist, err := models.Engine.Id(id).Get(pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exist {
+		return nil, NotFound(response.CODEPIPELINENOTFOUND, "流水线不存在")
+	}
+
+	if err := service.Authorize(uid, pipeline.TeamId); err != nil {
+		return nil, err
+	}
+
+	return pipeline, nil
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/models"
+)
+
+type (
+	ProjectInterface interface {
+		PermissionInterface
+		Find(uid, id string) (*models.Project, error)
+	}
+
+	ProjectService struct {
+		PermissionService
+	}
+)
+
+func NewProjectService() ProjectInterface {
+	return &ProjectService{}
+}
+
+// 查询项目并检查用户是否可以访问其所属团队的数据
+func (service *ProjectService) Find(uid, id string) (*models.Project, error) {
+	project := &models.Project{}
+	exist, err := models.Engine.Id(id).Get(project)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exist {
+		return nil, NotFound(response.CODEPROJECTNOTFOUND, "项目不存在")
+	}
+
+	if err := service.Authorize(uid, project.TeamId); err != nil {
+		return nil, err
+	}
+
+	return project, nil
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"encoding/json"
+	"github.com/betterde/ects/internal/response"
+	"github.com/betterde/ects/models"
+)
+
+type (
+	RecordInterface interface {
+		PermissionInterface
+		Find(uid, id string) (*models.PipelineRecords, error)
+		Check(uid string, record *models.PipelineRecords) error
+	}
+
+	RecordService struct {
+		PermissionService
+	}
+)
+
+func NewRecordService() RecordInterface {
+	return &RecordService{}
+}
+
+// 查询执行记录并检查用户是否可以访问
+func (service *RecordService) Find(uid, id string) (*models.PipelineRecords, error) {
+	record := &models.PipelineRecords{}
+	exist, err := models.Engine.Id(id).Get(record)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exist {
+		return nil, NotFound(response.CODERUNNOTFOUND, "执行记录不存在")
+	}
+
+	if err := service.Check(uid, record); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// 检查用户是否可以访问执行记录，以流水线当前所属的团队为准，流水线已删除时使用快照中的团队
+func (service *RecordService) Check(uid string, record *models.PipelineRecords) error {
+	teamId := ""
+	current := models.Pipeline{}
+	if exist, err := models.Engine.Id(record.PipelineId).Get(&current); err != nil {
+		return err
+	} else if exist {
+		teamId = current.TeamId
+	} else if record.Snapshot != "" {
+		snapshot := models.Pipeline{}
+		if err := json.Unmarshal([]byte(record.Snapshot), &snapshot); err != nil {
+			return err
+		}
+		teamId = snapshot.TeamId
+	}
+
+	return service.Authorize(uid, teamId)
+}
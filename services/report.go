@@ -0,0 +1,123 @@
+package services
+
+import (
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"github.com/gorhill/cronexpr"
+	"math"
+	"sort"
+	"time"
+)
+
+// 单条流水线一个月内最多统计的调度次数，避免按秒执行的定时器占用过多内存
+const SLAMAXFIRES = 50000
+
+type (
+	// 流水线在统计周期内的调度情况
+	SLAEntry struct {
+		PipelineId string  `json:"pipeline_id"`
+		Name       string  `json:"name"`
+		Spec       string  `json:"spec"`
+		Scheduled  int     `json:"scheduled"`    // 按照定时器应该执行的次数
+		Executed   int     `json:"executed"`     // 实际由定时器触发执行的次数
+		Missed     int     `json:"missed"`       // 错过的次数
+		Succeeded  int     `json:"succeeded"`    // 执行成功的次数
+		OnTime     int     `json:"on_time"`      // 在允许的延迟内开始并执行成功的次数
+		OnTimeRate float64 `json:"on_time_rate"` // 准时率，百分比
+	}
+)
+
+// 统计项目中每条流水线在指定月份的计划调度次数、实际执行次数、错过次数和准时率
+func SLAReport(projectId string, month time.Time, tolerance time.Duration) ([]*SLAEntry, error) {
+	begin := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.Local)
+	end := begin.AddDate(0, 1, 0)
+	if now := time.Now(); end.After(now) {
+		end = now
+	}
+
+	pipelines := make([]models.Pipeline, 0)
+	if err := models.Engine.Where(builder.Eq{"project_id": projectId}).Asc("name").Find(&pipelines); err != nil {
+		return nil, err
+	}
+
+	entries := make([]*SLAEntry, 0, len(pipelines))
+	for _, pipeline := range pipelines {
+		entry := &SLAEntry{
+			PipelineId: pipeline.Id,
+			Name:       pipeline.Name,
+			Spec:       pipeline.Spec,
+		}
+		entries = append(entries, entry)
+
+		// 月中创建的流水线从创建时开始统计
+		from := begin
+		if created := time.Time(pipeline.CreatedAt); created.After(from) {
+			from = created
+		}
+
+		if !from.Before(end) {
+			continue
+		}
+
+		fires := schedule(pipeline.Spec, from, end, pipeline.LoadLocation(), pipeline.DST)
+
+		records := make([]models.PipelineRecords, 0)
+		cond := builder.Eq{"pipeline_id": pipeline.Id, "trigger": models.TRIGGERSCHEDULE}.And(builder.Gte{"begin_with": from}).And(builder.Lt{"begin_with": end})
+		if err := models.Engine.Cols("begin_with", "status").Where(cond).Asc("begin_with").Find(&records); err != nil {
+			return nil, err
+		}
+
+		succeeded := make([]time.Time, 0, len(records))
+		for _, record := range records {
+			if record.Status == models.RECORDFINISHED {
+				succeeded = append(succeeded, time.Time(record.BeginWith))
+			}
+		}
+
+		entry.Scheduled = len(fires)
+		entry.Executed = len(records)
+		entry.Succeeded = len(succeeded)
+		if entry.Scheduled > entry.Executed {
+			entry.Missed = entry.Scheduled - entry.Executed
+		}
+		entry.OnTime = punctual(fires, succeeded, tolerance)
+		if entry.Scheduled > 0 {
+			entry.OnTimeRate = math.Round(float64(entry.OnTime)/float64(entry.Scheduled)*10000) / 100
+		}
+	}
+
+	return entries, nil
+}
+
+// 按照时区和夏令时策略计算定时器在 [from, end) 范围内的触发时间
+func schedule(spec string, from, end time.Time, location *time.Location, policy string) []time.Time {
+	fires := make([]time.Time, 0)
+	expression, err := cronexpr.Parse(spec)
+	if err != nil {
+		return fires
+	}
+
+	for next := models.NextFire(expression, from.Add(-time.Second), location, policy); !next.IsZero() && next.Before(end) && len(fires) < SLAMAXFIRES; next = models.NextFire(expression, next, location, policy) {
+		fires = append(fires, next)
+	}
+
+	return fires
+}
+
+// 统计在允许的延迟内有成功执行记录的触发次数，每条执行记录只匹配一次触发，两个列表均已按时间排序
+func punctual(fires []time.Time, starts []time.Time, tolerance time.Duration) int {
+	count := 0
+	index := 0
+	for _, fire := range fires {
+		index += sort.Search(len(starts)-index, func(i int) bool {
+			return !starts[index+i].Before(fire)
+		})
+
+		if index < len(starts) && !starts[index].After(fire.Add(tolerance)) {
+			count++
+			index++
+		}
+	}
+
+	return count
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	from := time.Date(2019, 2, 1, 0, 0, 0, 0, time.Local)
+	end := from.AddDate(0, 1, 0)
+
+	if fires := schedule("0 0 3 * * * *", from, end, time.Local, ""); len(fires) != 28 {
+		t.Errorf("expected 28 fires in February 2019, got %d", len(fires))
+	}
+
+	if fires := schedule("0 0 0 1 * * *", from, end, time.Local, ""); len(fires) != 1 || !fires[0].Equal(from) {
+		t.Errorf("expected the start of the range to be included, got %v", fires)
+	}
+
+	if fires := schedule("invalid", from, end, time.Local, ""); len(fires) != 0 {
+		t.Errorf("expected no fires for an invalid spec, got %d", len(fires))
+	}
+}
+
+func TestPunctual(t *testing.T) {
+	base := time.Date(2019, 2, 1, 3, 0, 0, 0, time.Local)
+	fires := []time.Time{base, base.Add(time.Hour), base.Add(2 * time.Hour), base.Add(3 * time.Hour)}
+	starts := []time.Time{
+		base.Add(2 * time.Second),              // 准时
+		base.Add(time.Hour + 10*time.Minute),   // 延迟过久
+		base.Add(2*time.Hour + 30*time.Second), // 准时
+		base.Add(2*time.Hour + 40*time.Second), // 同一次触发的重复执行
+	}
+
+	if count := punctual(fires, starts, time.Minute); count != 2 {
+		t.Errorf("expected 2 punctual runs, got %d", count)
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/betterde/ects/config"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/satori/go.uuid"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidShareLink = errors.New("分享链接无效、已过期或已被撤销")
+
+// 创建执行记录的分享链接，返回的令牌包含分享ID、过期时间和签名
+func IssueShareLink(user string, record *models.PipelineRecords, note string, ttl time.Duration) (*models.RunShare, string, error) {
+	share := &models.RunShare{
+		Id:        uuid.NewV4().String(),
+		RunId:     record.Id,
+		UserId:    user,
+		Note:      note,
+		ExpiresAt: utils.Time(time.Now().Add(ttl).Truncate(time.Second)),
+	}
+
+	if err := share.Store(); err != nil {
+		return nil, "", err
+	}
+
+	return share, ShareToken(share), nil
+}
+
+// 生成分享链接的令牌
+func ShareToken(share *models.RunShare) string {
+	payload := fmt.Sprintf("%s.%d", share.Id, time.Time(share.ExpiresAt).Unix())
+	return payload + "." + signShare(payload)
+}
+
+// 校验分享链接的签名、有效期和是否已被撤销，通过后记录一次访问
+func VisitShareLink(token, address string) (*models.RunShare, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || !hmac.Equal([]byte(parts[2]), []byte(signShare(parts[0]+"."+parts[1]))) {
+		return nil, ErrInvalidShareLink
+	}
+
+	now := time.Now()
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.Unix() > expires {
+		return nil, ErrInvalidShareLink
+	}
+
+	share := &models.RunShare{}
+	if exist, err := models.Engine.Id(parts[0]).Get(share); err != nil {
+		return nil, err
+	} else if !exist || share.Expired(now) {
+		return nil, ErrInvalidShareLink
+	}
+
+	share.Visits++
+	share.LastVisitAt = utils.Time(now)
+	if err := share.Update(); err != nil {
+		log.Println(err)
+	}
+
+	// 访问者没有账号，日志记录在分享链接的创建者名下
+	if err := models.CreateLog(share, share.UserId, fmt.Sprintf("VISIT SHARED RUN FROM %s", address)); err != nil {
+		log.Println(err)
+	}
+
+	return share, nil
+}
+
+func signShare(payload string) string {
+	mac := hmac.New(sha256.New, []byte(config.Conf.Auth.Secret))
+	mac.Write([]byte("share:" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"fmt"
+	"github.com/betterde/ects/internal/discover"
+	"github.com/betterde/ects/models"
+	"log"
+)
+
+// 同步流水线到 ETCD，失败时将流水线标记为待同步，以便用户知道修改尚未下发到节点
+func SyncPipeline(pipeline *models.Pipeline) error {
+	// Build 会追加节点和步骤，避免重复构造时数据重复
+	pipeline.Nodes = nil
+	pipeline.Steps = nil
+	bytes, err := pipeline.Build()
+	if err == nil {
+		err = discover.PutPipeline(pipeline.Id, string(bytes))
+	}
+
+	MarkSynced(pipeline.Id, err == nil)
+	return err
+}
+
+// 从 ETCD 中删除流水线，失败时将流水线标记为待同步
+func RemovePipeline(id string) error {
+	err := discover.DeletePipeline(id)
+	MarkSynced(id, err == nil)
+	return err
+}
+
+// 更新流水线的同步状态
+func MarkSynced(id string, synced bool) {
+	status := models.SYNCPENDING
+	if synced {
+		status = models.SYNCED
+	}
+
+	if _, err := models.Engine.Table(new(models.Pipeline)).Id(id).Update(map[string]interface{}{"synced": status}); err != nil {
+		log.Println(err)
+	}
+}
+
+// 同步失败时提示用户如何重新同步
+func SyncHint(id string) string {
+	return fmt.Sprintf("修改已保存但尚未下发到节点，请稍后调用 PATCH /api/pipeline/%s 重新同步", id)
+}
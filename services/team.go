@@ -0,0 +1,46 @@
+package services
+
+import (
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+)
+
+// 判断用户是否是管理员
+func IsManager(uid string) (bool, error) {
+	user := models.User{}
+	exist, err := models.Engine.Id(uid).Get(&user)
+	if err != nil {
+		return false, err
+	}
+
+	return exist && user.Authority() == models.ROLEADMIN, nil
+}
+
+// 获取用户可见数据的查询条件，管理员可以看到全部数据，普通用户只能看到未共享给团队或者共享给所在团队的数据
+func Visible(uid string) (builder.Cond, error) {
+	manager, err := IsManager(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if manager {
+		return builder.NewCond(), nil
+	}
+
+	teams := builder.Select("team_id").From(new(models.TeamMember).TableName()).Where(builder.Eq{"user_id": uid})
+	return builder.Eq{"team_id": ""}.Or(builder.IsNull{"team_id"}).Or(builder.In("team_id", teams)), nil
+}
+
+// 判断用户是否可以访问共享给指定团队的数据
+func Accessible(uid, teamId string) (bool, error) {
+	if teamId == "" {
+		return true, nil
+	}
+
+	manager, err := IsManager(uid)
+	if err != nil || manager {
+		return manager, err
+	}
+
+	return models.Engine.Where(builder.Eq{"team_id": teamId, "user_id": uid}).Exist(&models.TeamMember{})
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"github.com/betterde/ects/internal/service"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"log"
+)
+
+// 获取流水线绑定节点的时区，节点时区不一致的流水线不返回
+func Timezones(ids []string) map[string]string {
+	zones := make(map[string]string)
+	if len(ids) == 0 {
+		return zones
+	}
+
+	relations := make([]models.PipelineNodePivot, 0)
+	if err := models.Engine.Where(builder.In("pipeline_id", ids)).Find(&relations); err != nil {
+		log.Println(err)
+		return zones
+	}
+
+	if len(relations) == 0 {
+		return zones
+	}
+
+	nodesId := make([]string, 0, len(relations))
+	for _, relation := range relations {
+		nodesId = append(nodesId, relation.NodeId)
+	}
+
+	nodes := make(map[string]models.Node)
+	if err := models.Engine.Cols("id", "timezone").Where(builder.In("id", nodesId)).Find(&nodes); err != nil {
+		log.Println(err)
+		return zones
+	}
+
+	conflicts := make(map[string]bool)
+	for _, relation := range relations {
+		zone := nodes[relation.NodeId].Timezone
+		if zone == "" || conflicts[relation.PipelineId] {
+			continue
+		}
+
+		if current, exist := zones[relation.PipelineId]; exist && current != zone {
+			conflicts[relation.PipelineId] = true
+			delete(zones, relation.PipelineId)
+			continue
+		}
+		zones[relation.PipelineId] = zone
+	}
+
+	return zones
+}
+
+// 流水线定时器使用的时区，优先使用流水线指定的时区，其次使用绑定节点的时区，未绑定节点或节点时区不一致时使用主节点的时区
+func Timezone(pipeline *models.Pipeline, zones map[string]string) string {
+	if pipeline.Timezone != "" {
+		return pipeline.Timezone
+	}
+
+	if zone, exist := zones[pipeline.Id]; exist {
+		return zone
+	}
+
+	return service.Runtime.Timezone
+}
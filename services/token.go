@@ -0,0 +1,71 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"github.com/satori/go.uuid"
+	"log"
+	"time"
+)
+
+var ErrInvalidAPIToken = errors.New("API 令牌无效、已过期或已被撤销")
+
+// 签发 API 令牌，权限范围不能超过所属用户的角色，明文只在创建时返回一次
+func IssueAPIToken(user *models.User, name, role string, ttl time.Duration) (*models.Token, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+
+	plain := models.TOKENPREFIX + hex.EncodeToString(secret)
+	token := &models.Token{
+		Id:     uuid.NewV4().String(),
+		Name:   name,
+		UserId: user.Id,
+		Role:   role,
+		Digest: digest(plain),
+		Hint:   plain[:len(models.TOKENPREFIX)+6],
+	}
+
+	if ttl > 0 {
+		token.ExpiresAt = utils.Time(time.Now().Add(ttl))
+	}
+
+	if err := token.Store(); err != nil {
+		return nil, "", err
+	}
+
+	return token, plain, nil
+}
+
+// 校验 API 令牌并记录最后使用时间
+func VerifyAPIToken(plain string) (*models.Token, error) {
+	token := &models.Token{}
+	exist, err := models.Engine.Where(builder.Eq{"digest": digest(plain)}).Get(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exist || token.Expired(time.Now()) {
+		return nil, ErrInvalidAPIToken
+	}
+
+	// 所属用户被删除后令牌随之失效
+	if exist, err := models.Engine.Id(token.UserId).Exist(&models.User{}); err != nil || !exist {
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidAPIToken
+	}
+
+	token.LastUsedAt = utils.Time(time.Now())
+	if _, err := models.Engine.Id(token.Id).Cols("last_used_at").Update(token); err != nil {
+		log.Println(err)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,544 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"github.com/go-xorm/xorm"
+	"github.com/satori/go.uuid"
+	"gopkg.in/yaml.v2"
+	"log"
+	"time"
+)
+
+const (
+	EXPORTVERSION = 1 // 导出文档的格式版本
+
+	CONFLICTFAIL   = "fail"   // 已存在同名流水线时拒绝导入
+	CONFLICTRENAME = "rename" // 已存在同名流水线时在名称后追加序号
+)
+
+var (
+	ErrExportVersion  = fmt.Errorf("只支持导入版本为 %d 的流水线文档", EXPORTVERSION)
+	ErrPipelineExists = errors.New("已存在同名的流水线")
+	ErrUnknownTask    = errors.New("引用的任务不在文档中")
+)
+
+// 导出时去掉的字段，导入时由目标环境重新生成
+var (
+	pipelineOmitted = []string{"id", "team_id", "project_id", "standby", "spec_description", "synced", "nodes", "steps", "finished_task", "failed_task", "created_at", "updated_at"}
+	taskOmitted     = []string{"created_at", "updated_at"}
+	stepOmitted     = []string{"pipeline_id", "task", "created_at", "updated_at"}
+)
+
+type (
+	// 导出的流水线文档，任务和步骤保留原来的ID作为文档内的引用，导入时重新生成ID
+	PipelineDocument struct {
+		Version  int                      `yaml:"version"`
+		Project  string                   `yaml:"project,omitempty"` // 所属项目的名称
+		Standby  string                   `yaml:"standby,omitempty"` // 备用节点的名称
+		Pipeline map[string]interface{}   `yaml:"pipeline"`
+		Tasks    []map[string]interface{} `yaml:"tasks"`
+		Steps    []map[string]interface{} `yaml:"steps"`
+		Nodes    []string                 `yaml:"nodes"` // 绑定节点的名称
+	}
+	// 从文档中解析出的流水线、任务和步骤
+	PipelineBundle struct {
+		Project  string
+		Standby  string
+		Pipeline *models.Pipeline
+		Tasks    []*models.Task
+		Steps    []*models.PipelineTaskPivot
+		Nodes    []string
+	}
+)
+
+// 将流水线连同任务、步骤和绑定的节点导出为 YAML 文档
+func ExportPipeline(pipeline *models.Pipeline) ([]byte, error) {
+	pipeline.Nodes = nil
+	pipeline.Steps = nil
+	if _, err := pipeline.Build(); err != nil {
+		return nil, err
+	}
+
+	document := &PipelineDocument{
+		Version: EXPORTVERSION,
+		Tasks:   make([]map[string]interface{}, 0),
+		Steps:   make([]map[string]interface{}, 0, len(pipeline.Steps)),
+		Nodes:   make([]string, 0, len(pipeline.Nodes)),
+	}
+
+	if pipeline.ProjectId != "" {
+		project := models.Project{}
+		if _, err := models.Engine.Id(pipeline.ProjectId).Get(&project); err != nil {
+			return nil, err
+		}
+		document.Project = project.Name
+	}
+
+	if pipeline.Standby != "" {
+		node := models.Node{}
+		if _, err := models.Engine.Id(pipeline.Standby).Cols("name").Get(&node); err != nil {
+			return nil, err
+		}
+		document.Standby = node.Name
+	}
+
+	if len(pipeline.Nodes) > 0 {
+		nodes := make([]models.Node, 0, len(pipeline.Nodes))
+		if err := models.Engine.Where(builder.In("id", pipeline.Nodes)).Cols("name").Asc("name").Find(&nodes); err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			document.Nodes = append(document.Nodes, node.Name)
+		}
+	}
+
+	// 同一个任务可能被多个步骤或者成功、失败时执行的任务引用，只导出一次
+	exported := make(map[string]bool)
+	tasks := make([]*models.Task, 0, len(pipeline.Steps)+2)
+	for _, step := range pipeline.Steps {
+		tasks = append(tasks, step.Task)
+	}
+	tasks = append(tasks, pipeline.FinishedTask, pipeline.FailedTask)
+
+	for _, task := range tasks {
+		if task == nil || task.Id == "" || exported[task.Id] {
+			continue
+		}
+		exported[task.Id] = true
+
+		fields, err := fieldsOf(task, taskOmitted)
+		if err != nil {
+			return nil, err
+		}
+		document.Tasks = append(document.Tasks, fields)
+	}
+
+	for _, step := range pipeline.Steps {
+		fields, err := fieldsOf(step, stepOmitted)
+		if err != nil {
+			return nil, err
+		}
+		document.Steps = append(document.Steps, fields)
+	}
+
+	fields, err := fieldsOf(pipeline, pipelineOmitted)
+	if err != nil {
+		return nil, err
+	}
+	document.Pipeline = fields
+
+	return yaml.Marshal(document)
+}
+
+// 解析导出的 YAML 文档，不认识的字段视为错误，避免导入时静默丢失配置
+func ParsePipeline(data []byte) (*PipelineBundle, error) {
+	document := &PipelineDocument{}
+	if err := yaml.UnmarshalStrict(data, document); err != nil {
+		return nil, err
+	}
+
+	if document.Version != EXPORTVERSION {
+		return nil, ErrExportVersion
+	}
+
+	bundle := &PipelineBundle{
+		Project:  document.Project,
+		Standby:  document.Standby,
+		Pipeline: &models.Pipeline{},
+		Tasks:    make([]*models.Task, 0, len(document.Tasks)),
+		Steps:    make([]*models.PipelineTaskPivot, 0, len(document.Steps)),
+		Nodes:    document.Nodes,
+	}
+
+	if err := fieldsTo(document.Pipeline, bundle.Pipeline); err != nil {
+		return nil, fmt.Errorf("流水线定义有误：%s", err)
+	}
+
+	for index, fields := range document.Tasks {
+		task := &models.Task{}
+		if err := fieldsTo(fields, task); err != nil {
+			return nil, fmt.Errorf("第 %d 个任务定义有误：%s", index+1, err)
+		}
+		bundle.Tasks = append(bundle.Tasks, task)
+	}
+
+	for index, fields := range document.Steps {
+		step := &models.PipelineTaskPivot{}
+		if err := fieldsTo(fields, step); err != nil {
+			return nil, fmt.Errorf("第 %d 个步骤定义有误：%s", index+1, err)
+		}
+		bundle.Steps = append(bundle.Steps, step)
+	}
+
+	return bundle, nil
+}
+
+// 在团队中重新创建文档中的流水线，所有ID重新生成，内容相同的已有任务直接复用，返回无法还原的项目、节点和密钥提示
+func ImportPipeline(bundle *PipelineBundle, teamId string, conflict string) (*models.Pipeline, []string, error) {
+	warnings := make([]string, 0)
+	pipeline := bundle.Pipeline
+	now := utils.Time(time.Now())
+
+	name, err := available(pipeline.Name, teamId, conflict)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pipeline.Id = uuid.NewV4().String()
+	pipeline.Name = name
+	pipeline.TeamId = teamId
+	pipeline.Synced = models.SYNCPENDING
+	pipeline.CreatedAt, pipeline.UpdatedAt = now, now
+
+	if bundle.Project != "" {
+		project := models.Project{}
+		if exist, err := models.Engine.Where(builder.Eq{"name": bundle.Project, "team_id": teamId}).Get(&project); err != nil {
+			return nil, nil, err
+		} else if exist {
+			pipeline.ProjectId = project.Id
+		} else {
+			warnings = append(warnings, fmt.Sprintf("项目 %s 不存在，流水线未归属任何项目", bundle.Project))
+		}
+	}
+
+	if bundle.Standby != "" {
+		node := models.Node{}
+		if exist, err := models.Engine.Where(builder.Eq{"name": bundle.Standby}).Cols("id").Get(&node); err != nil {
+			return nil, nil, err
+		} else if exist {
+			pipeline.Standby = node.Id
+		} else {
+			warnings = append(warnings, fmt.Sprintf("备用节点 %s 不存在，未设置备用节点", bundle.Standby))
+		}
+	}
+
+	// 文档中的任务ID到新任务ID的映射
+	tasks := make(map[string]string, len(bundle.Tasks))
+	created := make([]*models.Task, 0, len(bundle.Tasks))
+	for _, task := range bundle.Tasks {
+		existing := models.Task{}
+		exist, err := models.Engine.Where(builder.Eq{"name": task.Name, "mode": task.Mode, "content": task.Content, "url": task.Url}).Get(&existing)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if exist {
+			tasks[task.Id] = existing.Id
+			continue
+		}
+
+		reference := task.Id
+		task.Id = uuid.NewV4().String()
+		task.CreatedAt, task.UpdatedAt = now, now
+		tasks[reference] = task.Id
+		created = append(created, task)
+	}
+
+	remap := func(reference string) (string, error) {
+		if reference == "" {
+			return "", nil
+		}
+		if id, exist := tasks[reference]; exist {
+			return id, nil
+		}
+		return "", ErrUnknownTask
+	}
+
+	if pipeline.Finished, err = remap(pipeline.Finished); err != nil {
+		return nil, nil, err
+	}
+	if pipeline.Failed, err = remap(pipeline.Failed); err != nil {
+		return nil, nil, err
+	}
+
+	steps := make(map[string]string, len(bundle.Steps))
+	for _, step := range bundle.Steps {
+		steps[step.Id] = uuid.NewV4().String()
+	}
+
+	for _, step := range bundle.Steps {
+		step.Id = steps[step.Id]
+		step.PipelineId = pipeline.Id
+		step.CreatedAt, step.UpdatedAt = now, now
+		if step.TaskId, err = remap(step.TaskId); err != nil {
+			return nil, nil, err
+		}
+
+		for index, depend := range step.Depends {
+			id, exist := steps[depend]
+			if !exist {
+				return nil, nil, models.ErrUnknownDepends
+			}
+			step.Depends[index] = id
+		}
+	}
+
+	if err := models.CheckDepends(bundle.Steps); err != nil {
+		return nil, nil, err
+	}
+
+	relations := make([]*models.PipelineNodePivot, 0, len(bundle.Nodes))
+	if len(bundle.Nodes) > 0 {
+		nodes := make([]models.Node, 0, len(bundle.Nodes))
+		if err := models.Engine.Where(builder.In("name", bundle.Nodes)).Cols("id", "name").Find(&nodes); err != nil {
+			return nil, nil, err
+		}
+
+		found := make(map[string]bool, len(nodes))
+		for _, node := range nodes {
+			if found[node.Name] {
+				continue
+			}
+			found[node.Name] = true
+			pipeline.Nodes = append(pipeline.Nodes, node.Id)
+			relations = append(relations, &models.PipelineNodePivot{Id: uuid.NewV4().String(), PipelineId: pipeline.Id, NodeId: node.Id, CreatedAt: now})
+		}
+
+		for _, name := range bundle.Nodes {
+			if !found[name] {
+				warnings = append(warnings, fmt.Sprintf("节点 %s 不存在，未绑定", name))
+			}
+		}
+	}
+
+	missing, err := missingSecrets(bundle)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range missing {
+		warnings = append(warnings, fmt.Sprintf("引用的密钥 %s 不存在，请在执行前创建", name))
+	}
+
+	session := models.Engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return nil, nil, err
+	}
+
+	if err := insert(session, pipeline, created, bundle.Steps, relations); err != nil {
+		if err := session.Rollback(); err != nil {
+			log.Println(err)
+		}
+		return nil, nil, err
+	}
+
+	if err := session.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return pipeline, warnings, nil
+}
+
+// 复制流水线及其步骤，步骤引用原来的任务，不复制绑定的节点和备用节点，复制出的流水线处于禁用状态
+func ClonePipeline(source *models.Pipeline, name string) (*models.Pipeline, error) {
+	if name == "" {
+		name = fmt.Sprintf("Copy of %s", source.Name)
+	}
+
+	name, err := available(name, source.TeamId, CONFLICTRENAME)
+	if err != nil {
+		return nil, err
+	}
+
+	steps := make([]*models.PipelineTaskPivot, 0)
+	if err := models.Engine.Where(builder.Eq{"pipeline_id": source.Id}).Asc("step").Find(&steps); err != nil {
+		return nil, err
+	}
+
+	pipeline := *source
+	pipeline.Id = uuid.NewV4().String()
+	pipeline.Name = name
+	pipeline.Standby = ""
+	pipeline.Status = models.PIPELINEDISABLED
+	pipeline.Synced = models.SYNCPENDING
+	pipeline.Nodes = nil
+	pipeline.Steps = nil
+
+	// 步骤使用新的ID，依赖关系随之替换
+	ids := make(map[string]string, len(steps))
+	for _, step := range steps {
+		ids[step.Id] = uuid.NewV4().String()
+	}
+
+	for _, step := range steps {
+		step.Id = ids[step.Id]
+		step.PipelineId = pipeline.Id
+		for index, depend := range step.Depends {
+			step.Depends[index] = ids[depend]
+		}
+	}
+
+	session := models.Engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+
+	if err := insert(session, &pipeline, nil, steps, nil); err != nil {
+		if err := session.Rollback(); err != nil {
+			log.Println(err)
+		}
+		return nil, err
+	}
+
+	if err := session.Commit(); err != nil {
+		return nil, err
+	}
+
+	pipeline.Steps = steps
+	return &pipeline, nil
+}
+
+// 在同一个事务中保存导入的数据
+func insert(session *xorm.Session, pipeline *models.Pipeline, tasks []*models.Task, steps []*models.PipelineTaskPivot, relations []*models.PipelineNodePivot) error {
+	if _, err := session.Insert(pipeline); err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		if _, err := session.Insert(task); err != nil {
+			return err
+		}
+	}
+
+	for _, step := range steps {
+		if _, err := session.Insert(step); err != nil {
+			return err
+		}
+	}
+
+	for _, relation := range relations {
+		if _, err := session.Insert(relation); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 团队中可用的流水线名称，重名时按照冲突策略拒绝或者追加序号
+func available(name string, teamId string, conflict string) (string, error) {
+	candidate := name
+	for index := 2; ; index++ {
+		exist, err := models.Engine.Where(builder.Eq{"name": candidate, "team_id": teamId}).Exist(&models.Pipeline{})
+		if err != nil {
+			return "", err
+		}
+
+		if !exist {
+			return candidate, nil
+		}
+
+		if conflict != CONFLICTRENAME {
+			return "", ErrPipelineExists
+		}
+
+		candidate = fmt.Sprintf("%s (%d)", name, index)
+	}
+}
+
+// 文档中引用但当前环境不存在的密钥
+func missingSecrets(bundle *PipelineBundle) ([]string, error) {
+	texts := make([]string, 0)
+	for _, value := range bundle.Pipeline.Variables {
+		texts = append(texts, value)
+	}
+
+	for _, task := range bundle.Tasks {
+		texts = append(append(texts, task.Content, task.Url), task.Env...)
+		for _, value := range task.Variables {
+			texts = append(texts, value)
+		}
+	}
+
+	for _, step := range bundle.Steps {
+		texts = append(texts, step.Environment)
+	}
+
+	names := models.SecretNames(texts...)
+	if len(names) == 0 {
+		return names, nil
+	}
+
+	secrets := make([]models.Secret, 0, len(names))
+	if err := models.Engine.Where(builder.In("name", names)).Cols("name").Find(&secrets); err != nil {
+		return nil, err
+	}
+
+	exist := make(map[string]bool, len(secrets))
+	for _, secret := range secrets {
+		exist[secret.Name] = true
+	}
+
+	missing := make([]string, 0)
+	for _, name := range names {
+		if !exist[name] {
+			missing = append(missing, name)
+		}
+	}
+
+	return missing, nil
+}
+
+// 通过 JSON 转换为字段集合，字段名与接口一致
+func fieldsOf(value interface{}, omitted []string) (map[string]interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for _, field := range omitted {
+		delete(fields, field)
+	}
+
+	return fields, nil
+}
+
+// 将字段集合转换为模型，不认识的字段视为错误
+func fieldsTo(fields map[string]interface{}, target interface{}) error {
+	data, err := json.Marshal(stringKeys(fields))
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(target)
+}
+
+// YAML 解析出的嵌套映射的键为 interface{}，转换为字符串以便转换为 JSON
+func stringKeys(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			result[fmt.Sprint(key)] = stringKeys(item)
+		}
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			result[key] = stringKeys(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, 0, len(value))
+		for _, item := range value {
+			result = append(result, stringKeys(item))
+		}
+		return result
+	}
+
+	return value
+}
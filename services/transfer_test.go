@@ -0,0 +1,43 @@
+package services
+
+import "testing"
+
+func TestParsePipeline(t *testing.T) {
+	document := []byte(`version: 1
+pipeline:
+  name: backup
+  spec: "0 0 2 * * * *"
+  variables:
+    BUCKET: backups
+tasks:
+  - id: 0b5f3a52-64c2-4b8e-9a59-7a1d6b6c0f11
+    name: dump
+    mode: shell
+steps:
+  - id: 5a4c1f0e-0d6f-4b8b-8d0f-3f4f0c4f9a21
+    task_id: 0b5f3a52-64c2-4b8e-9a59-7a1d6b6c0f11
+    dependence: strong
+nodes: [worker]
+`)
+
+	bundle, err := ParsePipeline(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bundle.Pipeline.Name != "backup" || bundle.Pipeline.Variables["BUCKET"] != "backups" {
+		t.Errorf("unexpected pipeline %+v", bundle.Pipeline)
+	}
+
+	if len(bundle.Tasks) != 1 || len(bundle.Steps) != 1 || bundle.Steps[0].TaskId != bundle.Tasks[0].Id {
+		t.Errorf("unexpected tasks %+v and steps %+v", bundle.Tasks, bundle.Steps)
+	}
+
+	if _, err := ParsePipeline([]byte("version: 2\npipeline: {name: backup}\n")); err != ErrExportVersion {
+		t.Errorf("expected version error, got %v", err)
+	}
+
+	if _, err := ParsePipeline([]byte("version: 1\npipeline: {name: backup, unknown: 1}\n")); err == nil {
+		t.Error("expected unknown fields to be rejected")
+	}
+}
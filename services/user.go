@@ -165,6 +165,26 @@ func IssueToken(user *models.User) (string, error) {
 		"exp": time.Now().Add(time.Duration(config.Conf.Auth.TTL) * time.Second).Unix(),
 		"nbf": time.Now().Unix(),
 		"sub": user.Id,
+		"chg": user.MustChange,
+	})
+
+	return token.SignedString([]byte(config.Conf.Auth.Secret))
+}
+
+// Issue a short-lived token that lets the admin act as the target user
+func IssueImpersonationToken(admin, user *models.User) (string, error) {
+	ttl := config.Conf.Auth.TTL
+	if ttl > 3600 {
+		ttl = 3600
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": "ects",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Duration(ttl) * time.Second).Unix(),
+		"nbf": time.Now().Unix(),
+		"sub": user.Id,
+		"act": admin.Id,
 	})
 
 	return token.SignedString([]byte(config.Conf.Auth.Secret))
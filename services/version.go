@@ -0,0 +1,326 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/betterde/ects/internal/utils"
+	"github.com/betterde/ects/models"
+	"github.com/go-xorm/builder"
+	"github.com/kataras/iris"
+	"github.com/satori/go.uuid"
+	"log"
+	"reflect"
+	"sort"
+)
+
+var ErrVersionTask = errors.New("该版本引用的任务已被删除，无法回滚")
+
+// 回滚时恢复的流水线字段，状态和所属团队不属于流水线定义，保持不变
+var versionColumns = []string{"name", "project_id", "description", "spec", "timezone", "dst_policy", "finished", "failed", "standby", "overlap", "concurrency", "singleton", "misfire", "policy", "critical", "retention", "keep", "retries", "timeout", "image", "variables", "parameters"}
+
+// 两个版本之间的一处差异，新增时 Before 为空，删除时 After 为空
+type VersionChange struct {
+	Path   string      `json:"path"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// 为流水线当前的定义保存一个版本，定义与最新版本相同时不重复保存
+func RecordVersion(ctx iris.Context, id, operation string) (*models.PipelineVersion, error) {
+	pipeline := &models.Pipeline{}
+	exist, err := models.Engine.Id(id).Get(pipeline)
+	if err != nil || !exist {
+		return nil, err
+	}
+
+	if _, err := pipeline.Build(); err != nil {
+		return nil, err
+	}
+
+	snapshot, err := snapshotOf(pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := &models.PipelineVersion{}
+	found, err := models.Engine.Where(builder.Eq{"pipeline_id": id}).Desc("version").Get(latest)
+	if err != nil {
+		return nil, err
+	}
+
+	if found && latest.Snapshot == snapshot {
+		return latest, nil
+	}
+
+	version := &models.PipelineVersion{
+		Id:         uuid.NewV4().String(),
+		PipelineId: id,
+		Version:    latest.Version + 1,
+		Operation:  operation,
+		UserId:     utils.GetUID(ctx),
+		Snapshot:   snapshot,
+	}
+
+	return version, version.Store()
+}
+
+// 解析版本保存的流水线定义
+func DefinitionOf(version *models.PipelineVersion) (*models.Pipeline, error) {
+	pipeline := &models.Pipeline{}
+	if err := json.Unmarshal([]byte(version.Snapshot), pipeline); err != nil {
+		return nil, err
+	}
+
+	return pipeline, nil
+}
+
+// 比较两个版本的流水线定义，步骤按照ID对应，绑定的节点按照集合比较
+func DiffVersions(from, to *models.PipelineVersion) ([]VersionChange, error) {
+	return diffSnapshots(from.Snapshot, to.Snapshot)
+}
+
+// 将流水线恢复到指定版本的定义并重新同步到 ETCD，已经删除的节点不再绑定并返回警告
+func RollbackPipeline(current *models.Pipeline, version *models.PipelineVersion) (*models.Pipeline, []string, error) {
+	target, err := DefinitionOf(version)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	target.Id = current.Id
+	target.TeamId = current.TeamId
+	target.Status = current.Status
+
+	ids := []string{target.Finished, target.Failed}
+	for _, step := range target.Steps {
+		ids = append(ids, step.TaskId)
+	}
+
+	tasks := make(map[string]models.Task)
+	if err := models.Engine.Where(builder.In("id", ids)).Cols("id").Find(&tasks); err != nil {
+		return nil, nil, err
+	}
+
+	for _, id := range ids {
+		if _, exist := tasks[id]; id != "" && !exist {
+			return nil, nil, ErrVersionTask
+		}
+	}
+
+	warnings := make([]string, 0)
+	nodes := make(map[string]models.Node)
+	if len(target.Nodes) > 0 {
+		if err := models.Engine.Where(builder.In("id", target.Nodes)).Cols("id").Find(&nodes); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	relations := make([]*models.PipelineNodePivot, 0, len(target.Nodes))
+	for _, id := range target.Nodes {
+		if _, exist := nodes[id]; !exist {
+			warnings = append(warnings, fmt.Sprintf("节点 %s 已被删除，回滚后不再绑定", id))
+			continue
+		}
+		relations = append(relations, &models.PipelineNodePivot{PipelineId: target.Id, NodeId: id})
+	}
+
+	if target.Standby != "" {
+		if _, exist := nodes[target.Standby]; !exist {
+			if found, err := models.Engine.Id(target.Standby).Exist(&models.Node{}); err != nil {
+				return nil, nil, err
+			} else if !found {
+				warnings = append(warnings, fmt.Sprintf("备用节点 %s 已被删除，回滚后不再设置备用节点", target.Standby))
+				target.Standby = ""
+			}
+		}
+	}
+
+	session := models.Engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return nil, nil, err
+	}
+
+	rollback := func(err error) (*models.Pipeline, []string, error) {
+		if err := session.Rollback(); err != nil {
+			log.Println(err)
+		}
+		return nil, nil, err
+	}
+
+	if _, err := session.Id(target.Id).Cols(versionColumns...).Update(target); err != nil {
+		return rollback(err)
+	}
+
+	if _, err := session.Where(builder.Eq{"pipeline_id": target.Id}).Delete(&models.PipelineNodePivot{}); err != nil {
+		return rollback(err)
+	}
+
+	if len(relations) > 0 {
+		if _, err := session.Insert(relations); err != nil {
+			return rollback(err)
+		}
+	}
+
+	if _, err := session.Where(builder.Eq{"pipeline_id": target.Id}).Delete(&models.PipelineTaskPivot{}); err != nil {
+		return rollback(err)
+	}
+
+	for _, step := range target.Steps {
+		step.PipelineId = target.Id
+		if _, err := session.InsertOne(step); err != nil {
+			return rollback(err)
+		}
+	}
+
+	if err := session.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	pipeline := &models.Pipeline{}
+	if _, err := models.Engine.Id(target.Id).Get(pipeline); err != nil {
+		return nil, nil, err
+	}
+
+	return pipeline, warnings, SyncPipeline(pipeline)
+}
+
+// 序列化流水线定义，去掉与定义无关、每次保存都会变化的字段，节点和步骤排序后保存
+func snapshotOf(pipeline *models.Pipeline) (string, error) {
+	definition := *pipeline
+	definition.Status = 0
+	definition.Synced = 0
+	definition.SpecText = ""
+	definition.CreatedAt = utils.Time{}
+	definition.UpdatedAt = utils.Time{}
+	definition.FinishedTask = nil
+	definition.FailedTask = nil
+
+	definition.Nodes = append([]string{}, pipeline.Nodes...)
+	sort.Strings(definition.Nodes)
+
+	definition.Steps = make([]*models.PipelineTaskPivot, 0, len(pipeline.Steps))
+	for _, step := range pipeline.Steps {
+		copied := *step
+		copied.Task = nil
+		copied.CreatedAt = utils.Time{}
+		copied.UpdatedAt = utils.Time{}
+		definition.Steps = append(definition.Steps, &copied)
+	}
+	sort.Slice(definition.Steps, func(i, j int) bool {
+		return definition.Steps[i].Step < definition.Steps[j].Step
+	})
+
+	result, err := json.Marshal(&definition)
+	return string(result), err
+}
+
+func diffSnapshots(before, after string) ([]VersionChange, error) {
+	from, to := make(map[string]interface{}), make(map[string]interface{})
+	if err := json.Unmarshal([]byte(before), &from); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(after), &to); err != nil {
+		return nil, err
+	}
+
+	changes := make([]VersionChange, 0)
+	compare := func(path string, before, after interface{}) {
+		if !reflect.DeepEqual(before, after) {
+			changes = append(changes, VersionChange{Path: path, Before: before, After: after})
+		}
+	}
+
+	for key := range union(from, to) {
+		switch key {
+		case "created_at", "updated_at", "status", "synced":
+		case "nodes":
+			added, removed := membership(members(from[key]), members(to[key]))
+			for _, id := range added {
+				compare("nodes."+id, nil, id)
+			}
+			for _, id := range removed {
+				compare("nodes."+id, id, nil)
+			}
+		case "steps":
+			previous, next := stepsOf(from[key]), stepsOf(to[key])
+			for id := range union(previous, next) {
+				old, _ := previous[id].(map[string]interface{})
+				current, _ := next[id].(map[string]interface{})
+				if old == nil || current == nil {
+					compare("steps."+id, previous[id], next[id])
+					continue
+				}
+
+				for field := range union(old, current) {
+					if field != "created_at" && field != "updated_at" {
+						compare("steps."+id+"."+field, old[field], current[field])
+					}
+				}
+			}
+		default:
+			compare(key, from[key], to[key])
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes, nil
+}
+
+func union(maps ...map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, items := range maps {
+		for key := range items {
+			result[key] = nil
+		}
+	}
+
+	return result
+}
+
+func members(value interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	items, _ := value.([]interface{})
+	for _, item := range items {
+		if id, ok := item.(string); ok {
+			result[id] = nil
+		}
+	}
+
+	return result
+}
+
+func membership(before, after map[string]interface{}) ([]string, []string) {
+	added, removed := make([]string, 0), make([]string, 0)
+	for id := range after {
+		if _, exist := before[id]; !exist {
+			added = append(added, id)
+		}
+	}
+
+	for id := range before {
+		if _, exist := after[id]; !exist {
+			removed = append(removed, id)
+		}
+	}
+
+	return added, removed
+}
+
+func stepsOf(value interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	items, _ := value.([]interface{})
+	for _, item := range items {
+		if step, ok := item.(map[string]interface{}); ok {
+			if id, ok := step["id"].(string); ok {
+				result[id] = step
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"testing"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	before := `{"name":"backup","spec":"0 0 * * * * *","status":1,"nodes":["a","b"],"steps":[{"id":"s1","step":1,"timeout":10},{"id":"s2","step":2}]}`
+	after := `{"name":"backup","spec":"0 30 * * * * *","status":0,"nodes":["b","c"],"steps":[{"id":"s1","step":1,"timeout":20},{"id":"s3","step":2}]}`
+
+	changes, err := diffSnapshots(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"nodes.a", "nodes.c", "spec", "steps.s1.timeout", "steps.s2", "steps.s3"}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %v", len(expected), changes)
+	}
+
+	for index, path := range expected {
+		if changes[index].Path != path {
+			t.Errorf("expected change %d at %s, got %s", index, path, changes[index].Path)
+		}
+	}
+
+	if changes[0].After != nil || changes[1].Before != nil {
+		t.Errorf("expected node a removed and node c added, got %v", changes[:2])
+	}
+
+	if changes, err := diffSnapshots(before, before); err != nil || len(changes) != 0 {
+		t.Errorf("expected no changes between identical versions, got %v, %v", changes, err)
+	}
+}
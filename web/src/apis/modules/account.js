@@ -9,6 +9,13 @@ export default {
   signin(params) {
     return Vue.axios.post('/api/auth/signin', params)
   },
+  /**
+   * Fetch enabled identity providers
+   * @returns {AxiosPromise<any>}
+   */
+  providers() {
+    return Vue.axios.get('/api/auth/providers')
+  },
   /**
    * Fetch user profile
    * @returns {AxiosPromise<any>}